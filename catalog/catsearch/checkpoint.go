@@ -0,0 +1,110 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/mycanal"
+)
+
+// Checkpoint contains the binlog position up to which all changes have been
+// written to the Sink. File, Position and GTIDSet point to the end of the last
+// completed transaction, the GTID set never contains an open transaction.
+type Checkpoint struct {
+	File     string    `json:"file"`
+	Position uint      `json:"position"`
+	GTIDSet  string    `json:"gtid_set,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// IsZero reports whether the checkpoint has no position.
+func (cp Checkpoint) IsZero() bool {
+	return cp.File == "" && cp.GTIDSet == ""
+}
+
+// ApplyTo sets the start position of mycanal to the checkpoint. A zero
+// checkpoint does not change the options.
+func (cp Checkpoint) ApplyTo(o *mycanal.Options) {
+	if cp.GTIDSet != "" {
+		o.BinlogStartGTID = cp.GTIDSet
+		return
+	}
+	if cp.File != "" {
+		o.BinlogStartFile = cp.File
+		o.BinlogStartPosition = uint64(cp.Position)
+	}
+}
+
+// Checkpointer persists the checkpoint of the Indexer.
+type Checkpointer interface {
+	LoadCheckpoint(ctx context.Context) (Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, cp Checkpoint) error
+}
+
+// FileCheckpointer stores the checkpoint as JSON in a file. The file gets
+// replaced atomically.
+type FileCheckpointer struct {
+	Path string
+}
+
+// LoadCheckpoint reads the file. A missing file returns a zero checkpoint.
+func (fc FileCheckpointer) LoadCheckpoint(_ context.Context) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := ioutil.ReadFile(fc.Path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, errors.BadEncoding.New(err, "[catsearch] Failed to decode checkpoint file %q", fc.Path)
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint writes a temporary file and renames it.
+func (fc FileCheckpointer) SaveCheckpoint(_ context.Context, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fc.Path), filepath.Base(fc.Path)+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(f.Name(), fc.Path))
+}
@@ -0,0 +1,70 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestFileCheckpointer(t *testing.T) {
+	cp, cleanup := tempCheckpointer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	got, err := cp.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	want := Checkpoint{File: "mysql-bin.000001", Position: 4, Time: time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)}
+	assert.NoError(t, cp.SaveCheckpoint(ctx, want))
+	got, err = cp.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, want, got)
+
+	files, err := ioutil.ReadDir(filepath.Dir(cp.Path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "temporary file must be renamed")
+
+	assert.NoError(t, ioutil.WriteFile(cp.Path, []byte("{"), 0644))
+	_, err = cp.LoadCheckpoint(ctx)
+	assert.ErrorIsKind(t, errors.BadEncoding, err)
+
+	_, err = FileCheckpointer{Path: string(os.PathSeparator)}.LoadCheckpoint(ctx)
+	assert.Error(t, err)
+}
+
+func TestCheckpoint_ApplyTo(t *testing.T) {
+	var o mycanal.Options
+	Checkpoint{}.ApplyTo(&o)
+	assert.Exactly(t, mycanal.Options{}, o)
+
+	Checkpoint{File: "mysql-bin.000002", Position: 120}.ApplyTo(&o)
+	assert.Exactly(t, "mysql-bin.000002", o.BinlogStartFile)
+	assert.Exactly(t, uint64(120), o.BinlogStartPosition)
+
+	o = mycanal.Options{}
+	Checkpoint{File: "mysql-bin.000002", Position: 120, GTIDSet: "0-1-42"}.ApplyTo(&o)
+	assert.Exactly(t, "0-1-42", o.BinlogStartGTID)
+	assert.Exactly(t, "", o.BinlogStartFile)
+}
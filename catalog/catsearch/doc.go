@@ -0,0 +1,48 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package catsearch synchronises the catalog EAV entities with a search
+// engine. The name catsearch has been chosen to be unique so that one can use
+// goimports without conflicts.
+//
+// The Indexer listens via sql/mycanal to the changes of the entity, value,
+// website and category link tables of products and categories. It collects
+// the IDs of the affected entities, re-assembles their documents per store
+// view from the EAV attributes and pushes the documents in bulk to a Sink. A
+// document contains the static columns of the entity table, the attribute
+// values of the store view with a fallback to the default store and for
+// products the category IDs. Entities which have been deleted or which are
+// not assigned to the website of a store view get deleted from the index.
+//
+// The index name consists of Options.IndexPrefix, the name of the entity
+// type and the code of the store view, for example "product_default".
+//
+// Checkpoints
+//
+// The IDs get buffered and flushed after Options.BatchSize entities, after
+// Options.FlushInterval and before a binlog rotation. After a successful
+// flush the Checkpointer saves the end position and the GTID set of the last
+// transaction completed before the last collected event. A checkpoint never
+// points into a transaction. Start mycanal from this position, see
+// Checkpoint.ApplyTo, to not lose changes of an unflushed buffer after a
+// crash. Events might get indexed twice, which is harmless because documents
+// get always rebuilt from the database.
+//
+// Full reindex
+//
+// Indexer.Reindex reads all entities in batches and saves the binlog position
+// of the start as checkpoint. Follow the binlog from that position to apply
+// the changes made during the reindex. The tool catsearch_main.go provides
+// both modes on the command line.
+package catsearch
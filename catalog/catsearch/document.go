@@ -0,0 +1,338 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/dml"
+)
+
+// Document represents an entity of a store view in the search index.
+type Document struct {
+	EntityType string
+	EntityID   uint64
+	StoreID    uint32
+	StoreCode  string
+	// Fields contains the static columns and the attribute values by their
+	// code.
+	Fields map[string]interface{}
+}
+
+// ID returns the ID of the document within its index.
+func (d *Document) ID() string {
+	return strconv.FormatUint(d.EntityID, 10)
+}
+
+// MarshalJSON encodes the fields and the store ID into one JSON object.
+func (d *Document) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(d.Fields)+2)
+	for k, v := range d.Fields {
+		m[k] = v
+	}
+	m["entity_id"] = d.EntityID
+	m["store_id"] = d.StoreID
+	return json.Marshal(m)
+}
+
+// assembler builds the documents of an entity type for a batch of IDs.
+type assembler struct {
+	dbcp   *dml.ConnPool
+	et     EntityType
+	stores []Store
+	// attrs contains the indexed attributes of the entity type.
+	attrs []*Attribute
+	// indexName creates the index name of a store view.
+	indexName func(et EntityType, s Store) string
+}
+
+// entityValues contains the attribute values of an entity by store ID and
+// attribute code.
+type entityValues map[uint32]map[string]interface{}
+
+// assemble creates an index operation for each entity and store view. If the
+// entity does not exist or is not assigned to the website of a store view, a
+// delete operation gets created.
+func (a *assembler) assemble(ctx context.Context, ids []uint64) ([]Operation, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	entities, err := a.loadEntities(ctx, ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	websites, err := a.loadLinks(ctx, a.et.WebsiteTable, "website_id", ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	categories, err := a.loadLinks(ctx, a.et.CategoryTable, "category_id", ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	values, err := a.loadValues(ctx, ids)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ops := make([]Operation, 0, len(ids)*len(a.stores))
+	for _, id := range ids {
+		static, exists := entities[id]
+		for _, s := range a.stores {
+			index := a.indexName(a.et, s)
+			docID := strconv.FormatUint(id, 10)
+			if !exists || (a.et.WebsiteTable != "" && !containsUint64(websites[id], uint64(s.WebsiteID))) {
+				ops = append(ops, Operation{Action: ActionDelete, Index: index, ID: docID})
+				continue
+			}
+
+			doc := &Document{
+				EntityType: a.et.Name,
+				EntityID:   id,
+				StoreID:    s.ID,
+				StoreCode:  s.Code,
+				Fields:     make(map[string]interface{}, len(static)+len(a.attrs)+1),
+			}
+			for k, v := range static {
+				doc.Fields[k] = v
+			}
+			for k, v := range values[id][0] {
+				doc.Fields[k] = v
+			}
+			for k, v := range values[id][s.ID] {
+				doc.Fields[k] = v
+			}
+			if a.et.CategoryTable != "" {
+				cids := categories[id]
+				if cids == nil {
+					cids = []uint64{}
+				}
+				doc.Fields["category_ids"] = cids
+			}
+			ops = append(ops, Operation{Action: ActionIndex, Index: index, ID: docID, Document: doc})
+		}
+	}
+	return ops, nil
+}
+
+func (a *assembler) query(ctx context.Context, sel *dml.Select, fn func(*sql.Rows) error) error {
+	sqlStr, _, err := sel.ToSQL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	rows, err := a.dbcp.DB.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return errors.Wrapf(err, "[catsearch] Query failed: %q", sqlStr)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(rows.Err())
+}
+
+// loadEntities loads the static columns of the entity table.
+func (a *assembler) loadEntities(ctx context.Context, ids []uint64) (map[uint64]map[string]interface{}, error) {
+	entities := make(map[uint64]map[string]interface{}, len(ids))
+	var cols []string
+	sel := dml.NewSelect("*").From(a.et.EntityTable).Where(dml.Column("entity_id").In().Uint64s(ids...))
+	err := a.query(ctx, sel, func(rows *sql.Rows) error {
+		if cols == nil {
+			var err error
+			if cols, err = rows.Columns(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		vals := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return errors.WithStack(err)
+		}
+		static := make(map[string]interface{}, len(cols))
+		var id uint64
+		for i, c := range cols {
+			v := staticValue(vals[i])
+			if c == "entity_id" {
+				var err error
+				if id, err = toUint64(v); err != nil {
+					return errors.WithStack(err)
+				}
+				continue
+			}
+			static[c] = v
+		}
+		entities[id] = static
+		return nil
+	})
+	return entities, errors.WithStack(err)
+}
+
+// loadLinks loads the assigned websites or categories.
+func (a *assembler) loadLinks(ctx context.Context, table, column string, ids []uint64) (map[uint64][]uint64, error) {
+	if table == "" {
+		return nil, nil
+	}
+	links := make(map[uint64][]uint64, len(ids))
+	sel := dml.NewSelect("product_id", column).From(table).
+		Where(dml.Column("product_id").In().Uint64s(ids...)).
+		OrderBy("product_id", column)
+	err := a.query(ctx, sel, func(rows *sql.Rows) error {
+		var id, linkID uint64
+		if err := rows.Scan(&id, &linkID); err != nil {
+			return errors.WithStack(err)
+		}
+		links[id] = append(links[id], linkID)
+		return nil
+	})
+	return links, errors.WithStack(err)
+}
+
+// loadValues loads the attribute values of all stores from the value tables.
+func (a *assembler) loadValues(ctx context.Context, ids []uint64) (map[uint64]entityValues, error) {
+	values := make(map[uint64]entityValues, len(ids))
+	for _, bt := range BackendTypes {
+		byID := make(map[uint32]*Attribute)
+		var attrIDs []uint64
+		for _, attr := range a.attrs {
+			if attr.BackendType == bt {
+				byID[attr.ID] = attr
+				attrIDs = append(attrIDs, uint64(attr.ID))
+			}
+		}
+		if len(attrIDs) == 0 {
+			continue
+		}
+
+		sel := dml.NewSelect("entity_id", "attribute_id", "store_id", "value").From(a.et.ValueTable(bt)).
+			Where(
+				dml.Column("entity_id").In().Uint64s(ids...),
+				dml.Column("attribute_id").In().Uint64s(attrIDs...),
+			)
+		err := a.query(ctx, sel, func(rows *sql.Rows) error {
+			var id uint64
+			var attrID, storeID uint32
+			var raw sql.RawBytes
+			if err := rows.Scan(&id, &attrID, &storeID, &raw); err != nil {
+				return errors.WithStack(err)
+			}
+			attr, ok := byID[attrID]
+			if !ok {
+				return nil
+			}
+			v, err := attributeValue(bt, raw)
+			if err != nil {
+				return errors.Wrapf(err, "[catsearch] Attribute %q of entity %d", attr.Code, id)
+			}
+			ev := values[id]
+			if ev == nil {
+				ev = make(entityValues)
+				values[id] = ev
+			}
+			sv := ev[storeID]
+			if sv == nil {
+				sv = make(map[string]interface{})
+				ev[storeID] = sv
+			}
+			sv[attr.Code] = v
+			return nil
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return values, nil
+}
+
+// attributeValue converts the raw value by the backend type. NULL stays nil.
+func attributeValue(backendType string, raw sql.RawBytes) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	switch backendType {
+	case "int":
+		i, err := strconv.ParseInt(string(raw), 10, 64)
+		return i, errors.BadEncoding.New(err, "[catsearch] Invalid int %q", raw)
+	case "decimal":
+		f, err := strconv.ParseFloat(string(raw), 64)
+		return f, errors.BadEncoding.New(err, "[catsearch] Invalid decimal %q", raw)
+	}
+	return string(raw), nil
+}
+
+// staticValue converts the byte slices of the text protocol into strings.
+func staticValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.UTC().Format("2006-01-02 15:04:05")
+	}
+	return v
+}
+
+// toUint64 converts an ID of the database or of the binary log. The binary
+// log contains signed integers also for unsigned columns.
+func toUint64(v interface{}) (uint64, error) {
+	switch val := v.(type) {
+	case int8:
+		return uint64(uint8(val)), nil
+	case int16:
+		return uint64(uint16(val)), nil
+	case int32:
+		return uint64(uint32(val)), nil
+	case int64:
+		return uint64(val), nil
+	case int:
+		return uint64(val), nil
+	case uint8:
+		return uint64(val), nil
+	case uint16:
+		return uint64(val), nil
+	case uint32:
+		return uint64(val), nil
+	case uint64:
+		return val, nil
+	case uint:
+		return uint64(val), nil
+	case string:
+		u, err := strconv.ParseUint(val, 10, 64)
+		return u, errors.BadEncoding.New(err, "[catsearch] Invalid ID %q", val)
+	case []byte:
+		u, err := strconv.ParseUint(string(val), 10, 64)
+		return u, errors.BadEncoding.New(err, "[catsearch] Invalid ID %q", val)
+	}
+	return 0, errors.NotSupported.Newf("[catsearch] ID type %T not supported", v)
+}
+
+func containsUint64(haystack []uint64, needle uint64) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/dml"
+)
+
+// BackendTypes lists the backend types of the EAV value tables.
+var BackendTypes = [...]string{"datetime", "decimal", "int", "text", "varchar"}
+
+// EntityType describes the tables of an EAV entity which gets indexed.
+type EntityType struct {
+	// Code of the entity type in table eav_entity_type.
+	Code string
+	// Name gets used in the index name and in Document.EntityType.
+	Name string
+	// EntityTable contains the static attributes. The value tables carry the
+	// name of the entity table plus the suffix of the backend type.
+	EntityTable string
+	// WebsiteTable assigns an entity to websites with the columns
+	// product_id and website_id. Empty if the entity is available in all
+	// websites.
+	WebsiteTable string
+	// CategoryTable assigns an entity to categories with the columns
+	// product_id and category_id. The category IDs get added to the document
+	// as field category_ids. Optional.
+	CategoryTable string
+}
+
+// Entity types of the catalog.
+var (
+	Product = EntityType{
+		Code:          "catalog_product",
+		Name:          "product",
+		EntityTable:   "catalog_product_entity",
+		WebsiteTable:  "catalog_product_website",
+		CategoryTable: "catalog_category_product",
+	}
+	Category = EntityType{
+		Code:        "catalog_category",
+		Name:        "category",
+		EntityTable: "catalog_category_entity",
+	}
+)
+
+func (et EntityType) withTablePrefix(prefix string) EntityType {
+	if prefix == "" {
+		return et
+	}
+	et.EntityTable = prefix + et.EntityTable
+	if et.WebsiteTable != "" {
+		et.WebsiteTable = prefix + et.WebsiteTable
+	}
+	if et.CategoryTable != "" {
+		et.CategoryTable = prefix + et.CategoryTable
+	}
+	return et
+}
+
+// ValueTable returns the name of the value table for a backend type.
+func (et EntityType) ValueTable(backendType string) string {
+	return et.EntityTable + "_" + backendType
+}
+
+// Attribute contains the EAV metadata of an attribute.
+type Attribute struct {
+	ID             uint32
+	Code           string
+	EntityTypeCode string
+	BackendType    string
+	IsSearchable   bool
+	IsFilterable   bool
+	UsedForSortBy  bool
+	SearchWeight   int64
+}
+
+// loadAttributes loads the attributes of the entity types from tables
+// eav_attribute and catalog_eav_attribute. Static attributes get skipped
+// because they are columns of the entity table.
+func loadAttributes(ctx context.Context, dbcp *dml.ConnPool, tablePrefix string, entityTypeCodes []string) ([]*Attribute, error) {
+	sqlStr, _, err := dml.NewSelect(
+		"ea.attribute_id", "ea.attribute_code", "et.entity_type_code", "ea.backend_type",
+		"cea.is_searchable", "cea.is_filterable", "cea.used_for_sort_by", "cea.search_weight",
+	).
+		FromAlias(tablePrefix+"eav_attribute", "ea").
+		Join(
+			dml.MakeIdentifier(tablePrefix+"eav_entity_type").Alias("et"),
+			dml.Column("et.entity_type_id").Equal().Column("ea.entity_type_id"),
+		).
+		LeftJoin(
+			dml.MakeIdentifier(tablePrefix+"catalog_eav_attribute").Alias("cea"),
+			dml.Column("cea.attribute_id").Equal().Column("ea.attribute_id"),
+		).
+		Where(
+			dml.Column("et.entity_type_code").In().Strs(entityTypeCodes...),
+			dml.Column("ea.backend_type").NotEqual().Str("static"),
+		).
+		OrderBy("ea.attribute_id").ToSQL()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rows, err := dbcp.DB.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var attrs []*Attribute
+	for rows.Next() {
+		var a Attribute
+		var searchable, filterable, sortBy, weight sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.Code, &a.EntityTypeCode, &a.BackendType, &searchable, &filterable, &sortBy, &weight); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		a.IsSearchable = searchable.Int64 == 1
+		a.IsFilterable = filterable.Int64 == 1
+		a.UsedForSortBy = sortBy.Int64 == 1
+		a.SearchWeight = weight.Int64
+		attrs = append(attrs, &a)
+	}
+	return attrs, errors.WithStack(rows.Err())
+}
+
+// Store describes an active store view.
+type Store struct {
+	ID        uint32
+	Code      string
+	WebsiteID uint32
+}
+
+func loadStores(ctx context.Context, dbcp *dml.ConnPool, tablePrefix string) ([]Store, error) {
+	sqlStr, _, err := dml.NewSelect("store_id", "code", "website_id").From(tablePrefix+"store").
+		Where(
+			dml.Column("store_id").Greater().Int(0),
+			dml.Column("is_active").Equal().Int(1),
+		).
+		OrderBy("store_id").ToSQL()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	rows, err := dbcp.DB.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var stores []Store
+	for rows.Next() {
+		var s Store
+		if err := rows.Scan(&s.ID, &s.Code, &s.WebsiteID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		stores = append(stores, s)
+	}
+	return stores, errors.WithStack(rows.Err())
+}
@@ -0,0 +1,480 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/sql/mycanal"
+)
+
+var _ mycanal.RowsEventHandler = (*Indexer)(nil)
+
+// Options configures an Indexer.
+type Options struct {
+	// EntityTypes defines the indexed entities. Defaults to Product and
+	// Category.
+	EntityTypes []EntityType
+	// TablePrefix gets prepended to all table names.
+	TablePrefix string
+	// IndexPrefix gets prepended to all index names.
+	IndexPrefix string
+	// AttributeFilter selects the attributes of the documents. Defaults to
+	// all non-static attributes.
+	AttributeFilter func(*Attribute) bool
+	// BatchSize defines the number of entities per assembly and per call to
+	// Sink.Bulk. A flush starts after that many entities have been collected.
+	// Default 500.
+	BatchSize int
+	// FlushInterval flushes the collected entities periodically. Default one
+	// second, a negative value disables the periodic flush.
+	FlushInterval time.Duration
+	// Checkpointer saves the binlog position after each flush. Optional.
+	Checkpointer Checkpointer
+	Log          log.Logger
+}
+
+// route maps a table to the entity type and the column with the entity ID.
+type route struct {
+	et     *EntityType
+	column string
+	// metadata reports whether the table contains attributes or stores.
+	metadata bool
+}
+
+// metadata contains the stores and the indexed attributes per entity type
+// code.
+type metadata struct {
+	stores []Store
+	attrs  map[string][]*Attribute
+}
+
+// Indexer keeps the search indexes in sync with the catalog tables. It
+// implements mycanal.RowsEventHandler, see Register.
+type Indexer struct {
+	dbcp   *dml.ConnPool
+	sink   Sink
+	o      Options
+	routes map[string]route
+
+	// flushMu serializes the flushes, the reindex and the access to meta.
+	flushMu sync.Mutex
+	meta    *metadata
+
+	mu           sync.Mutex
+	pending      map[string]map[uint64]struct{}
+	pendingCount int
+	lastPos      mycanal.EventPosition
+	posChanged   bool
+	metaChanged  bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewIndexer creates a new Indexer which reads the catalog from dbcp and
+// writes the documents into the sink. Options can be nil. If the periodic
+// flush is enabled, Close must be called.
+func NewIndexer(dbcp *dml.ConnPool, sink Sink, o *Options) *Indexer {
+	ix := &Indexer{
+		dbcp:    dbcp,
+		sink:    sink,
+		routes:  make(map[string]route),
+		pending: make(map[string]map[uint64]struct{}),
+		done:    make(chan struct{}),
+	}
+	if o != nil {
+		ix.o = *o
+	}
+	if ix.o.EntityTypes == nil {
+		ix.o.EntityTypes = []EntityType{Product, Category}
+	}
+	ix.o.EntityTypes = append([]EntityType(nil), ix.o.EntityTypes...)
+	if ix.o.AttributeFilter == nil {
+		ix.o.AttributeFilter = func(*Attribute) bool { return true }
+	}
+	if ix.o.BatchSize <= 0 {
+		ix.o.BatchSize = 500
+	}
+	if ix.o.FlushInterval == 0 {
+		ix.o.FlushInterval = time.Second
+	}
+	if ix.o.Log == nil {
+		ix.o.Log = log.BlackHole{}
+	}
+
+	for i, et := range ix.o.EntityTypes {
+		et = et.withTablePrefix(ix.o.TablePrefix)
+		ix.o.EntityTypes[i] = et
+		etp := &ix.o.EntityTypes[i]
+		ix.routes[et.EntityTable] = route{et: etp, column: "entity_id"}
+		for _, bt := range BackendTypes {
+			ix.routes[et.ValueTable(bt)] = route{et: etp, column: "entity_id"}
+		}
+		if et.WebsiteTable != "" {
+			ix.routes[et.WebsiteTable] = route{et: etp, column: "product_id"}
+		}
+		if et.CategoryTable != "" {
+			ix.routes[et.CategoryTable] = route{et: etp, column: "product_id"}
+		}
+	}
+	for _, tn := range [...]string{"eav_attribute", "catalog_eav_attribute", "store"} {
+		ix.routes[ix.o.TablePrefix+tn] = route{metadata: true}
+	}
+
+	if ix.o.FlushInterval > 0 {
+		ix.wg.Add(1)
+		go ix.flushPeriodically()
+	}
+	return ix
+}
+
+// Tables returns the names of the tables the Indexer listens to.
+func (ix *Indexer) Tables() []string {
+	tables := make([]string, 0, len(ix.routes))
+	for tn := range ix.routes {
+		tables = append(tables, tn)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Register adds the Indexer as RowsEventHandler to the tables. Use for
+// example mycanal.ErrorPolicyRetry, so a failing search engine stops the
+// syncer instead of dropping changes.
+func (ix *Indexer) Register(c *mycanal.Canal, o mycanal.HandlerOptions) {
+	c.RegisterRowsEventHandlerWithOptions(ix.Tables(), o, ix)
+}
+
+// Do collects the IDs of the changed entities. A change of the attributes or
+// stores reloads the metadata with the next flush. New stores or attributes
+// require a Reindex to get added to all documents.
+func (ix *Indexer) Do(ctx context.Context, _ string, t *ddl.Table, rows [][]interface{}) error {
+	r, ok := ix.routes[t.Name]
+	if !ok {
+		return nil
+	}
+	ep, hasPos := mycanal.EventPositionFromContext(ctx)
+	// Only the end of a completed transaction can be resumed from.
+	hasPos = hasPos && !ep.Snapshot && (ep.CommitFile != "" || ep.GTIDSet != "")
+
+	if r.metadata {
+		ix.mu.Lock()
+		ix.metaChanged = true
+		if hasPos {
+			ix.lastPos, ix.posChanged = ep, true
+		}
+		ix.mu.Unlock()
+		return nil
+	}
+
+	col := -1
+	for i, c := range t.Columns {
+		if c.Field == r.column {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		return errors.NotFound.Newf("[catsearch] Column %q not found in table %q", r.column, t.Name)
+	}
+	ids := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		if col >= len(row) {
+			return errors.Mismatch.Newf("[catsearch] Row of table %q has %d columns, want at least %d", t.Name, len(row), col+1)
+		}
+		id, err := toUint64(row[col])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		ids = append(ids, id)
+	}
+
+	ix.mu.Lock()
+	ix.addPending(r.et.Name, ids...)
+	if hasPos {
+		ix.lastPos, ix.posChanged = ep, true
+	}
+	n := ix.pendingCount
+	ix.mu.Unlock()
+
+	if n >= ix.o.BatchSize {
+		return errors.WithStack(ix.Flush(ctx))
+	}
+	return nil
+}
+
+// addPending must be called with the mutex held.
+func (ix *Indexer) addPending(entityType string, ids ...uint64) {
+	p := ix.pending[entityType]
+	if p == nil {
+		p = make(map[uint64]struct{})
+		ix.pending[entityType] = p
+	}
+	for _, id := range ids {
+		if _, ok := p[id]; !ok {
+			p[id] = struct{}{}
+			ix.pendingCount++
+		}
+	}
+}
+
+// Complete flushes the collected entities before a binlog rotation.
+func (ix *Indexer) Complete(ctx context.Context) error {
+	return errors.WithStack(ix.Flush(ctx))
+}
+
+// String returns the name of the handler.
+func (ix *Indexer) String() string { return "catsearch.Indexer" }
+
+// Flush assembles the documents of the collected entities, writes them to the
+// sink and saves the checkpoint. The checkpoint gets taken from the commit
+// position and the GTID set of the last event position, which both exclude an
+// open transaction. On error the entities stay collected for the next flush.
+func (ix *Indexer) Flush(ctx context.Context) error {
+	ix.flushMu.Lock()
+	defer ix.flushMu.Unlock()
+
+	ix.mu.Lock()
+	pending := ix.pending
+	ix.pending = make(map[string]map[uint64]struct{})
+	ix.pendingCount = 0
+	pos, posChanged := ix.lastPos, ix.posChanged
+	ix.posChanged = false
+	metaChanged := ix.metaChanged
+	ix.metaChanged = false
+	ix.mu.Unlock()
+
+	err := ix.flush(ctx, pending, metaChanged)
+	if err == nil && posChanged && ix.o.Checkpointer != nil {
+		err = ix.o.Checkpointer.SaveCheckpoint(ctx, Checkpoint{File: pos.CommitFile, Position: pos.CommitPosition, GTIDSet: pos.GTIDSet, Time: pos.Timestamp})
+	}
+	if err != nil {
+		ix.mu.Lock()
+		for et, ids := range pending {
+			for id := range ids {
+				ix.addPending(et, id)
+			}
+		}
+		ix.posChanged = ix.posChanged || posChanged
+		ix.metaChanged = ix.metaChanged || metaChanged
+		ix.mu.Unlock()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (ix *Indexer) flush(ctx context.Context, pending map[string]map[uint64]struct{}, reloadMeta bool) error {
+	if len(pending) == 0 && !reloadMeta {
+		return nil
+	}
+	if ix.meta == nil || reloadMeta {
+		if err := ix.loadMetadata(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for _, et := range ix.o.EntityTypes {
+		p := pending[et.Name]
+		ids := make([]uint64, 0, len(p))
+		for id := range p {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for len(ids) > 0 {
+			n := ix.o.BatchSize
+			if n > len(ids) {
+				n = len(ids)
+			}
+			if err := ix.index(ctx, et, ids[:n]); err != nil {
+				return errors.WithStack(err)
+			}
+			ids = ids[n:]
+		}
+	}
+	return nil
+}
+
+// loadMetadata must be called with flushMu held.
+func (ix *Indexer) loadMetadata(ctx context.Context) error {
+	stores, err := loadStores(ctx, ix.dbcp, ix.o.TablePrefix)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	codes := make([]string, 0, len(ix.o.EntityTypes))
+	for _, et := range ix.o.EntityTypes {
+		codes = append(codes, et.Code)
+	}
+	attrs, err := loadAttributes(ctx, ix.dbcp, ix.o.TablePrefix, codes)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	m := &metadata{stores: stores, attrs: make(map[string][]*Attribute)}
+	for _, a := range attrs {
+		if ix.o.AttributeFilter(a) {
+			m.attrs[a.EntityTypeCode] = append(m.attrs[a.EntityTypeCode], a)
+		}
+	}
+	ix.meta = m
+	return nil
+}
+
+func (ix *Indexer) index(ctx context.Context, et EntityType, ids []uint64) error {
+	a := &assembler{
+		dbcp:      ix.dbcp,
+		et:        et,
+		stores:    ix.meta.stores,
+		attrs:     ix.meta.attrs[et.Code],
+		indexName: ix.IndexName,
+	}
+	ops, err := a.assemble(ctx, ids)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := ix.sink.Bulk(ctx, ops); err != nil {
+		return errors.WithStack(err)
+	}
+	if ix.o.Log.IsDebug() {
+		ix.o.Log.Debug("catsearch.Indexer.index", log.String("entity_type", et.Name), log.Int("entities", len(ids)), log.Int("operations", len(ops)))
+	}
+	return nil
+}
+
+// IndexName returns the name of the index of an entity type and a store view.
+func (ix *Indexer) IndexName(et EntityType, s Store) string {
+	return ix.o.IndexPrefix + et.Name + "_" + s.Code
+}
+
+// Reindex indexes all entities of the entity types, identified by their
+// names, or all entity types if no names have been provided. It returns the
+// number of indexed entities. The binlog position before the reindex gets
+// saved as checkpoint, so following the binlog afterwards catches up the
+// changes made during the reindex. Documents of entities deleted before the
+// reindex remain in the indexes.
+func (ix *Indexer) Reindex(ctx context.Context, entityTypeNames ...string) (int, error) {
+	ix.flushMu.Lock()
+	defer ix.flushMu.Unlock()
+
+	var ms ddl.MasterStatus
+	if ix.o.Checkpointer != nil {
+		if _, err := ix.dbcp.WithQueryBuilder(&ms).Load(ctx, &ms); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+	if err := ix.loadMetadata(ctx); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var count int
+	for _, et := range ix.o.EntityTypes {
+		if len(entityTypeNames) > 0 && !containsString(entityTypeNames, et.Name) {
+			continue
+		}
+		var lastID uint64
+		for {
+			ids, err := ix.entityIDs(ctx, et, lastID)
+			if err != nil {
+				return count, errors.WithStack(err)
+			}
+			if len(ids) == 0 {
+				break
+			}
+			if err := ix.index(ctx, et, ids); err != nil {
+				return count, errors.WithStack(err)
+			}
+			count += len(ids)
+			lastID = ids[len(ids)-1]
+			if len(ids) < ix.o.BatchSize {
+				break
+			}
+		}
+		if ix.o.Log.IsInfo() {
+			ix.o.Log.Info("catsearch.Indexer.Reindex", log.String("entity_type", et.Name), log.Int("entities", count))
+		}
+	}
+
+	if ix.o.Checkpointer != nil && ms.File != "" {
+		cp := Checkpoint{File: ms.File, Position: ms.Position, Time: time.Now()}
+		if err := ix.o.Checkpointer.SaveCheckpoint(ctx, cp); err != nil {
+			return count, errors.WithStack(err)
+		}
+	}
+	return count, nil
+}
+
+// entityIDs returns the next batch of entity IDs after lastID.
+func (ix *Indexer) entityIDs(ctx context.Context, et EntityType, lastID uint64) ([]uint64, error) {
+	sqlStr, _, err := dml.NewSelect("entity_id").From(et.EntityTable).
+		Where(dml.Column("entity_id").Greater().Uint64(lastID)).
+		OrderBy("entity_id").Limit(0, uint64(ix.o.BatchSize)).ToSQL()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	rows, err := ix.dbcp.DB.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	ids := make([]uint64, 0, ix.o.BatchSize)
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.WithStack(rows.Err())
+}
+
+func (ix *Indexer) flushPeriodically() {
+	defer ix.wg.Done()
+	t := time.NewTicker(ix.o.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ix.done:
+			return
+		case <-t.C:
+			if err := ix.Flush(context.Background()); err != nil && ix.o.Log.IsInfo() {
+				ix.o.Log.Info("catsearch.Indexer.flushPeriodically.error", log.Err(err))
+			}
+		}
+	}
+}
+
+// Close stops the periodic flush and flushes the collected entities.
+func (ix *Indexer) Close() error {
+	ix.closeOnce.Do(func() {
+		close(ix.done)
+	})
+	ix.wg.Wait()
+	return errors.WithStack(ix.Flush(context.Background()))
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
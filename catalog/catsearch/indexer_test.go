@@ -0,0 +1,278 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func expectMetadata(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `store_id`, `code`, `website_id` FROM `store` WHERE (`store_id` > 0) AND (`is_active` = 1) ORDER BY `store_id`")).
+		WillReturnRows(sqlmock.NewRows([]string{"store_id", "code", "website_id"}).
+			AddRow(1, "default", 1).
+			AddRow(2, "german", 2))
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `ea`.`attribute_id`, `ea`.`attribute_code`, `et`.`entity_type_code`, `ea`.`backend_type`, `cea`.`is_searchable`, `cea`.`is_filterable`, `cea`.`used_for_sort_by`, `cea`.`search_weight` FROM `eav_attribute` AS `ea` INNER JOIN `eav_entity_type` AS `et` ON (`et`.`entity_type_id` = `ea`.`entity_type_id`) LEFT JOIN `catalog_eav_attribute` AS `cea` ON (`cea`.`attribute_id` = `ea`.`attribute_id`) WHERE (`et`.`entity_type_code` IN ('catalog_product')) AND (`ea`.`backend_type` != 'static') ORDER BY `ea`.`attribute_id`")).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute_id", "attribute_code", "entity_type_code", "backend_type", "is_searchable", "is_filterable", "used_for_sort_by", "search_weight"}).
+			AddRow(73, "name", "catalog_product", "varchar", 1, 0, 1, 5).
+			AddRow(77, "price", "catalog_product", "decimal", 0, 1, 1, 1).
+			AddRow(97, "status", "catalog_product", "int", 0, 0, 0, nil).
+			AddRow(112, "news_from_date", "catalog_product", "datetime", 0, 0, 0, nil))
+}
+
+// expectProducts expects the queries to assemble the products 1 and 2.
+// Product 2 does not exist anymore and product 1 is only assigned to the
+// website of the default store view.
+func expectProducts(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT * FROM `catalog_product_entity` WHERE (`entity_id` IN (1,2))")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id", "sku", "type_id"}).AddRow(1, "SKU-1", "simple"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `product_id`, `website_id` FROM `catalog_product_website` WHERE (`product_id` IN (1,2)) ORDER BY `product_id`, `website_id`")).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "website_id"}).AddRow(1, 1))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `product_id`, `category_id` FROM `catalog_category_product` WHERE (`product_id` IN (1,2)) ORDER BY `product_id`, `category_id`")).
+		WillReturnRows(sqlmock.NewRows([]string{"product_id", "category_id"}).AddRow(1, 3).AddRow(1, 5))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id`, `attribute_id`, `store_id`, `value` FROM `catalog_product_entity_datetime` WHERE (`entity_id` IN (1,2)) AND (`attribute_id` IN (112))")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id", "attribute_id", "store_id", "value"}).AddRow(1, 112, 0, nil))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id`, `attribute_id`, `store_id`, `value` FROM `catalog_product_entity_decimal` WHERE (`entity_id` IN (1,2)) AND (`attribute_id` IN (77))")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id", "attribute_id", "store_id", "value"}).AddRow(1, 77, 0, "19.9900"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id`, `attribute_id`, `store_id`, `value` FROM `catalog_product_entity_int` WHERE (`entity_id` IN (1,2)) AND (`attribute_id` IN (97))")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id", "attribute_id", "store_id", "value"}).AddRow(1, 97, 0, "1"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id`, `attribute_id`, `store_id`, `value` FROM `catalog_product_entity_varchar` WHERE (`entity_id` IN (1,2)) AND (`attribute_id` IN (73))")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id", "attribute_id", "store_id", "value"}).
+			AddRow(1, 73, 0, "Shirt").
+			AddRow(1, 73, 1, "T-Shirt"))
+}
+
+func assertProducts(t *testing.T, sink *MemorySink) {
+	doc := sink.Document("product_default", "1")
+	assert.NotNil(t, doc)
+	assert.Exactly(t, map[string]interface{}{
+		"sku":            "SKU-1",
+		"type_id":        "simple",
+		"name":           "T-Shirt",
+		"price":          19.99,
+		"status":         int64(1),
+		"news_from_date": nil,
+		"category_ids":   []uint64{3, 5},
+	}, doc.Fields)
+	assert.Exactly(t, uint32(1), doc.StoreID)
+	assert.Nil(t, sink.Document("product_german", "1"), "not assigned to the website")
+	assert.Nil(t, sink.Document("product_default", "2"), "deleted product")
+	assert.Nil(t, sink.Document("product_german", "2"), "deleted product")
+}
+
+var (
+	testProductVarchar = ddl.NewTable("catalog_product_entity_varchar",
+		&ddl.Column{Field: "value_id", Key: "PRI"}, &ddl.Column{Field: "attribute_id"},
+		&ddl.Column{Field: "store_id"}, &ddl.Column{Field: "entity_id"}, &ddl.Column{Field: "value"},
+	)
+	testProductEntity = ddl.NewTable("catalog_product_entity",
+		&ddl.Column{Field: "entity_id", Key: "PRI"}, &ddl.Column{Field: "sku"}, &ddl.Column{Field: "type_id"},
+	)
+)
+
+func tempCheckpointer(t *testing.T) (FileCheckpointer, func()) {
+	dir, err := ioutil.TempDir("", "catsearch")
+	assert.NoError(t, err)
+	return FileCheckpointer{Path: filepath.Join(dir, "checkpoint.json")}, func() { os.RemoveAll(dir) }
+}
+
+func TestIndexer_Tables(t *testing.T) {
+	ix := NewIndexer(nil, NewMemorySink(), &Options{EntityTypes: []EntityType{Category}, TablePrefix: "m2_", FlushInterval: -1})
+	assert.Exactly(t, []string{
+		"m2_catalog_category_entity", "m2_catalog_category_entity_datetime", "m2_catalog_category_entity_decimal",
+		"m2_catalog_category_entity_int", "m2_catalog_category_entity_text", "m2_catalog_category_entity_varchar",
+		"m2_catalog_eav_attribute", "m2_eav_attribute", "m2_store",
+	}, ix.Tables())
+	assert.Exactly(t, "catalog_category_entity", Category.EntityTable, "global must not change")
+}
+
+func TestIndexer_DoFlush(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	cp, cleanup := tempCheckpointer(t)
+	defer cleanup()
+
+	sink := NewMemorySink()
+	assert.NoError(t, sink.Bulk(context.Background(), []Operation{
+		{Action: ActionIndex, Index: "product_german", ID: "2", Document: &Document{EntityID: 2}},
+	}))
+	ix := NewIndexer(dbc, sink, &Options{EntityTypes: []EntityType{Product}, FlushInterval: -1, Checkpointer: cp})
+
+	ts := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := mycanal.WithEventPosition(context.Background(), mycanal.EventPosition{
+		File: "mysql-bin.000003", Position: 420, CommitFile: "mysql-bin.000003", CommitPosition: 380, Timestamp: ts,
+	})
+	assert.NoError(t, ix.Do(ctx, mycanal.UpdateAction, testProductVarchar, [][]interface{}{
+		{int32(10), int16(73), int16(1), int32(1), "Shirt"},
+		{int32(10), int16(73), int16(1), int32(1), "T-Shirt"},
+	}))
+	assert.NoError(t, ix.Do(ctx, mycanal.DeleteAction, testProductEntity, [][]interface{}{{int32(2), "SKU-2", "simple"}}))
+	// Tables of other entities get ignored.
+	assert.NoError(t, ix.Do(ctx, mycanal.InsertAction, ddl.NewTable("sales_order"), [][]interface{}{{int32(1)}}))
+
+	expectMetadata(dbMock)
+	expectProducts(dbMock)
+	assert.NoError(t, ix.Close())
+	assertProducts(t, sink)
+
+	got, err := cp.LoadCheckpoint(context.Background())
+	assert.NoError(t, err)
+	assert.Exactly(t, "mysql-bin.000003", got.File)
+	assert.Exactly(t, uint(380), got.Position, "checkpoint must point to the end of the last transaction")
+	assert.True(t, got.Time.Equal(ts))
+}
+
+func TestIndexer_FlushError(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	cp, cleanup := tempCheckpointer(t)
+	defer cleanup()
+
+	mem := NewMemorySink()
+	var fail = true
+	sink := SinkFunc(func(ctx context.Context, ops []Operation) error {
+		if fail {
+			return errors.ConnectionFailed.Newf("search engine down")
+		}
+		return mem.Bulk(ctx, ops)
+	})
+	ix := NewIndexer(dbc, sink, &Options{EntityTypes: []EntityType{Product}, FlushInterval: -1, Checkpointer: cp})
+
+	ctx := mycanal.WithEventPosition(context.Background(), mycanal.EventPosition{
+		File: "mysql-bin.000003", Position: 420, CommitFile: "mysql-bin.000003", CommitPosition: 380, GTIDSet: "0-1-42",
+	})
+	assert.NoError(t, ix.Do(ctx, mycanal.InsertAction, testProductEntity, [][]interface{}{{int32(1), "SKU-1", "simple"}, {int32(2), "SKU-2", "simple"}}))
+
+	expectMetadata(dbMock)
+	expectProducts(dbMock)
+	assert.ErrorIsKind(t, errors.ConnectionFailed, ix.Flush(ctx))
+	got, err := cp.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero(), "checkpoint must not be saved")
+
+	fail = false
+	expectProducts(dbMock)
+	assert.NoError(t, ix.Flush(ctx))
+	assertProducts(t, mem)
+	got, err = cp.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint(380), got.Position)
+	assert.Exactly(t, "0-1-42", got.GTIDSet)
+}
+
+func TestIndexer_FlushOpenTransaction(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	cp, cleanup := tempCheckpointer(t)
+	defer cleanup()
+
+	sink := NewMemorySink()
+	ix := NewIndexer(dbc, sink, &Options{EntityTypes: []EntityType{Product}, FlushInterval: -1, Checkpointer: cp})
+
+	// Two rows events of a transaction which has not yet been committed.
+	// mycanal reports the GTID set of the completed transactions 1-5 while
+	// the open transaction has the GTID 6.
+	const gset = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	ctx := context.Background()
+	assert.NoError(t, ix.Do(mycanal.WithEventPosition(ctx, mycanal.EventPosition{
+		File: "mysql-bin.000003", Position: 420, CommitFile: "mysql-bin.000003", CommitPosition: 380, GTIDSet: gset,
+	}), mycanal.InsertAction, testProductEntity, [][]interface{}{{int32(1), "SKU-1", "simple"}}))
+	assert.NoError(t, ix.Do(mycanal.WithEventPosition(ctx, mycanal.EventPosition{
+		File: "mysql-bin.000003", Position: 510, CommitFile: "mysql-bin.000003", CommitPosition: 380, GTIDSet: gset,
+	}), mycanal.DeleteAction, testProductEntity, [][]interface{}{{int32(2), "SKU-2", "simple"}}))
+
+	expectMetadata(dbMock)
+	expectProducts(dbMock)
+	assert.NoError(t, ix.Flush(ctx))
+	assertProducts(t, sink)
+
+	got, err := cp.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, "mysql-bin.000003", got.File)
+	assert.Exactly(t, uint(380), got.Position, "checkpoint must not point into the open transaction")
+	assert.Exactly(t, gset, got.GTIDSet, "GTID set must not contain the open transaction")
+
+	// The restarted stream sends the open transaction again.
+	var o mycanal.Options
+	got.ApplyTo(&o)
+	assert.Exactly(t, gset, o.BinlogStartGTID)
+	assert.NoError(t, ix.Close())
+}
+
+func TestIndexer_BatchSize(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	sink := NewMemorySink()
+	ix := NewIndexer(dbc, sink, &Options{EntityTypes: []EntityType{Product}, FlushInterval: -1, BatchSize: 2})
+
+	ctx := context.Background()
+	assert.NoError(t, ix.Do(ctx, mycanal.InsertAction, testProductEntity, [][]interface{}{{int32(1), "SKU-1", "simple"}}))
+	assert.Exactly(t, 0, sink.Bulks)
+
+	expectMetadata(dbMock)
+	expectProducts(dbMock)
+	assert.NoError(t, ix.Do(ctx, mycanal.DeleteAction, testProductEntity, [][]interface{}{{int32(2), "SKU-2", "simple"}}))
+	assert.Exactly(t, 1, sink.Bulks)
+	assertProducts(t, sink)
+
+	// A change of the metadata reloads it with the next flush.
+	storeTbl := ddl.NewTable("store", &ddl.Column{Field: "store_id"})
+	assert.NoError(t, ix.Do(ctx, mycanal.InsertAction, storeTbl, [][]interface{}{{int16(3)}}))
+	expectMetadata(dbMock)
+	assert.NoError(t, ix.Close())
+}
+
+func TestIndexer_Reindex(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	cp, cleanup := tempCheckpointer(t)
+	defer cleanup()
+
+	sink := NewMemorySink()
+	ix := NewIndexer(dbc, sink, &Options{EntityTypes: []EntityType{Product}, FlushInterval: -1, BatchSize: 2, Checkpointer: cp})
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW MASTER STATUS")).
+		WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}).AddRow("mysql-bin.000007", 4711))
+	expectMetadata(dbMock)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id` FROM `catalog_product_entity` WHERE (`entity_id` > 0) ORDER BY `entity_id` LIMIT 0,2")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id"}).AddRow(1).AddRow(2))
+	expectProducts(dbMock)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id` FROM `catalog_product_entity` WHERE (`entity_id` > 2) ORDER BY `entity_id` LIMIT 0,2")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id"}))
+
+	n, err := ix.Reindex(context.Background())
+	assert.NoError(t, err, "%+v", err)
+	assert.Exactly(t, 2, n)
+	assertProducts(t, sink)
+
+	got, err := cp.LoadCheckpoint(context.Background())
+	assert.NoError(t, err)
+	assert.Exactly(t, "mysql-bin.000007", got.File)
+	assert.Exactly(t, uint(4711), got.Position)
+	assert.NoError(t, ix.Close())
+}
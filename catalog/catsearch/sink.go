@@ -0,0 +1,200 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/corestoreio/errors"
+)
+
+// Actions of an Operation.
+const (
+	ActionIndex  = "index"
+	ActionDelete = "delete"
+)
+
+// Operation adds, replaces or deletes a document in an index.
+type Operation struct {
+	Action string
+	Index  string
+	ID     string
+	// Document is nil for ActionDelete.
+	Document *Document
+}
+
+// Sink writes the operations into a search engine. Bulk gets called with up
+// to Options.BatchSize times the number of store views operations. Deleting a
+// non-existing document must not return an error.
+type Sink interface {
+	Bulk(ctx context.Context, ops []Operation) error
+}
+
+// SinkFunc implements the Sink interface.
+type SinkFunc func(ctx context.Context, ops []Operation) error
+
+// Bulk calls sf.
+func (sf SinkFunc) Bulk(ctx context.Context, ops []Operation) error {
+	return sf(ctx, ops)
+}
+
+// MemorySink stores the documents in memory, for example for tests or for a
+// local setup without search engine.
+type MemorySink struct {
+	mu      sync.RWMutex
+	indexes map[string]map[string]*Document
+	// Bulks counts the calls to Bulk.
+	Bulks int
+}
+
+// NewMemorySink creates a new MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{indexes: make(map[string]map[string]*Document)}
+}
+
+// Bulk applies the operations.
+func (ms *MemorySink) Bulk(_ context.Context, ops []Operation) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.Bulks++
+	for _, op := range ops {
+		idx := ms.indexes[op.Index]
+		switch op.Action {
+		case ActionIndex:
+			if idx == nil {
+				idx = make(map[string]*Document)
+				ms.indexes[op.Index] = idx
+			}
+			idx[op.ID] = op.Document
+		case ActionDelete:
+			delete(idx, op.ID)
+		default:
+			return errors.NotSupported.Newf("[catsearch] Action %q not supported", op.Action)
+		}
+	}
+	return nil
+}
+
+// Document returns a document of an index or nil.
+func (ms *MemorySink) Document(index, id string) *Document {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.indexes[index][id]
+}
+
+// Len returns the number of documents in an index.
+func (ms *MemorySink) Len(index string) int {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return len(ms.indexes[index])
+}
+
+// HTTPBulkSink writes the operations to the bulk API of Elasticsearch or
+// OpenSearch. The indexes get created by the search engine on first use,
+// unless templates or explicit mappings exist.
+type HTTPBulkSink struct {
+	// URL of the search engine, for example http://localhost:9200.
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Header gets added to each request, for example for authentication.
+	Header http.Header
+}
+
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// Bulk sends the operations as one NDJSON request. If the search engine
+// rejects a single operation, the error of kind Rejected contains the first
+// rejected operation. Deletes of missing documents do not count as error.
+func (hs *HTTPBulkSink) Bulk(ctx context.Context, ops []Operation) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, op := range ops {
+		if err := enc.Encode(map[string]bulkAction{op.Action: {Index: op.Index, ID: op.ID}}); err != nil {
+			return errors.WithStack(err)
+		}
+		if op.Action == ActionIndex {
+			if err := enc.Encode(op.Document); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(hs.URL, "/")+"/_bulk", &buf)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range hs.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	cl := hs.Client
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[catsearch] Bulk request to %q failed", hs.URL)
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Rejected.Newf("[catsearch] Bulk request to %q returned status %d: %s", hs.URL, resp.StatusCode, body)
+	}
+
+	var br bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&br); err != nil {
+		return errors.BadEncoding.New(err, "[catsearch] Failed to decode the bulk response")
+	}
+	if !br.Errors {
+		return nil
+	}
+	for _, item := range br.Items {
+		for action, res := range item {
+			if res.Status < 300 || (action == ActionDelete && res.Status == http.StatusNotFound) {
+				continue
+			}
+			return errors.Rejected.Newf("[catsearch] Bulk %s of document %q returned status %d: %s", action, res.ID, res.Status, res.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package catsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestHTTPBulkSink(t *testing.T) {
+	ops := []Operation{
+		{Action: ActionIndex, Index: "product_default", ID: "1", Document: &Document{EntityID: 1, StoreID: 1, Fields: map[string]interface{}{"name": "Shirt"}}},
+		{Action: ActionDelete, Index: "product_german", ID: "1"},
+	}
+
+	newServer := func(status int, response string, body *string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Exactly(t, "/_bulk", r.URL.Path)
+			assert.Exactly(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+			assert.Exactly(t, "ApiKey secret", r.Header.Get("Authorization"))
+			data, _ := ioutil.ReadAll(r.Body)
+			if body != nil {
+				*body = string(data)
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(response))
+		}))
+	}
+	header := http.Header{"Authorization": []string{"ApiKey secret"}}
+
+	t.Run("success", func(t *testing.T) {
+		var body string
+		srv := newServer(200, `{"errors":true,"items":[{"index":{"_id":"1","status":201}},{"delete":{"_id":"1","status":404}}]}`, &body)
+		defer srv.Close()
+		hs := &HTTPBulkSink{URL: srv.URL + "/", Header: header}
+		assert.NoError(t, hs.Bulk(context.Background(), ops))
+		assert.Exactly(t, `{"index":{"_index":"product_default","_id":"1"}}
+{"entity_id":1,"name":"Shirt","store_id":1}
+{"delete":{"_index":"product_german","_id":"1"}}
+`, body)
+	})
+	t.Run("rejected operation", func(t *testing.T) {
+		srv := newServer(200, `{"errors":true,"items":[{"index":{"_id":"1","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`, nil)
+		defer srv.Close()
+		err := (&HTTPBulkSink{URL: srv.URL, Header: header}).Bulk(context.Background(), ops)
+		assert.ErrorIsKind(t, errors.Rejected, err)
+		assert.Contains(t, err.Error(), "mapper_parsing_exception")
+	})
+	t.Run("status code", func(t *testing.T) {
+		srv := newServer(503, `unavailable`, nil)
+		defer srv.Close()
+		err := (&HTTPBulkSink{URL: srv.URL, Header: header}).Bulk(context.Background(), ops)
+		assert.ErrorIsKind(t, errors.Rejected, err)
+	})
+	t.Run("no operations", func(t *testing.T) {
+		assert.NoError(t, (&HTTPBulkSink{URL: "http://127.0.0.1:1"}).Bulk(context.Background(), nil))
+	})
+}
+
+func TestMemorySink(t *testing.T) {
+	ms := NewMemorySink()
+	assert.NoError(t, ms.Bulk(context.Background(), []Operation{
+		{Action: ActionIndex, Index: "product_default", ID: "1", Document: &Document{EntityID: 1}},
+		{Action: ActionIndex, Index: "product_default", ID: "2", Document: &Document{EntityID: 2}},
+		{Action: ActionDelete, Index: "product_default", ID: "1"},
+		{Action: ActionDelete, Index: "category_default", ID: "1"},
+	}))
+	assert.Exactly(t, 1, ms.Len("product_default"))
+	assert.Exactly(t, uint64(2), ms.Document("product_default", "2").EntityID)
+
+	err := ms.Bulk(context.Background(), []Operation{{Action: "upsert"}})
+	assert.ErrorIsKind(t, errors.NotSupported, err)
+}
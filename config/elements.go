@@ -306,13 +306,15 @@ func (ss Sections) AppendFields(r string, fs ...*Field) (_ Sections, index int)
 }
 
 // Validate checks for duplicated configuration paths in all three hierarchy
-// levels. Error behaviour: NotValid
+// levels and for circular DependsOn rules between fields. Error behaviour:
+// NotValid or Duplicated.
 func (ss Sections) Validate() error {
 	if len(ss) == 0 {
 		return nil
 	}
 
 	dups := make(map[string]bool) // pc path checker
+	deps := make(map[string][]string)
 	var buf strings.Builder
 	p := new(Path)
 	for _, s := range ss {
@@ -332,13 +334,97 @@ func (ss Sections) Validate() error {
 				if err := p.Parse(key); err != nil {
 					return errors.WithStack(err)
 				}
+				for _, fd := range f.DependsOn {
+					if err := Route(fd.Route).IsValid(); err != nil {
+						return errors.NotValid.New(err, "[config] Field %q contains an invalid DependsOn route %q", key, fd.Route)
+					}
+					deps[key] = append(deps[key], fd.Route)
+				}
 				buf.Reset()
 			}
 		}
 	}
+	return validateDependencyCycles(deps)
+}
+
+// validateDependencyCycles runs a depth first search over the graph of
+// depending routes and returns an error on the first detected cycle.
+func validateDependencyCycles(deps map[string][]string) error {
+	const (
+		stateVisiting = iota + 1
+		stateDone
+	)
+	state := make(map[string]uint8, len(deps))
+	var visit func(route string, trail []string) error
+	visit = func(route string, trail []string) error {
+		switch state[route] {
+		case stateVisiting:
+			return errors.NotValid.Newf("[config] Circular DependsOn detected: %s", strings.Join(append(trail, route), " -> "))
+		case stateDone:
+			return nil
+		}
+		state[route] = stateVisiting
+		for _, dr := range deps[route] {
+			if err := visit(dr, append(trail, route)); err != nil {
+				return err
+			}
+		}
+		state[route] = stateDone
+		return nil
+	}
+
+	routes := make([]string, 0, len(deps))
+	for r := range deps {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes) // deterministic error messages
+	for _, r := range routes {
+		if err := visit(r, nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Dependents returns all fields, as fully qualified route, which depend on the
+// provided route. UIs can use this function to toggle the visibility of fields
+// once the value of route changes. The returned slice is sorted.
+func (ss Sections) Dependents(route string) []string {
+	var routes []string
+	for _, s := range ss {
+		for _, g := range s.Groups {
+			for _, f := range g.Fields {
+				for _, fd := range f.DependsOn {
+					if fd.Route == route {
+						routes = append(routes, s.ID+sPathSeparator+g.ID+sPathSeparator+f.ID)
+						break
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// ObscureRoutes returns all routes of fields with type TypeObscure, for example
+// passwords or API keys. The returned slice is sorted and can be used in
+// SnapshotOptions.MaskRoutes.
+func (ss Sections) ObscureRoutes() []string {
+	var routes []string
+	for _, s := range ss {
+		for _, g := range s.Groups {
+			for _, f := range g.Fields {
+				if f.Type == TypeObscure {
+					routes = append(routes, s.ID+sPathSeparator+g.ID+sPathSeparator+f.ID)
+				}
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
 // SortAll recursively sorts all slices. Not thread safe.
 func (ss Sections) SortAll() Sections {
 	for _, s := range ss {
@@ -488,6 +574,9 @@ type FieldMeta struct {
 	ScopeID      scope.TypeID
 	Default      string
 	DefaultValid bool
+	// Required and DependsOn, see the same named fields in type Field.
+	Required  bool
+	DependsOn FieldDependencies
 	// Default sets the default value which gets later parsed into the desired
 	// final Go type. An empty string means not set or null.
 	valid bool
@@ -526,6 +615,60 @@ type Field struct {
 	// bool. An empty string is equal to NULL. A default gets requests if the
 	// value for a path cannot be retrieved from Level1 or Level2 storage.
 	Default string `json:",omitempty"`
+	// Required defines that the value cannot be empty when the field is
+	// active. A field is active if all DependsOn rules are satisfied or if the
+	// field has no dependencies.
+	Required bool `json:",omitempty"`
+	// DependsOn contains the rules on other routes which must be satisfied
+	// before this field is considered active. For example payment credentials
+	// depend on the route payment/method/active being "1". Inactive fields
+	// skip their validation observers, see ObserverValidator, during
+	// config.Service.Set.
+	DependsOn FieldDependencies `json:",omitempty"`
+}
+
+// FieldDependency defines a rule on which another Field depends on.
+type FieldDependency struct {
+	// Route to the field which gets evaluated, e.g. payment/paypal/active.
+	Route string
+	// Value defines the expected raw value of Route. An empty Value matches
+	// an empty or not found value.
+	Value string `json:",omitempty"`
+	// Predicate optional function to evaluate the raw value of Route. If set,
+	// Value gets ignored. Argument found reports if the value exists in any
+	// storage level or as default value.
+	Predicate func(v []byte, found bool) bool `json:"-"`
+}
+
+// IsSatisfied reports whether the raw value v of the depending route satisfies
+// the rule.
+func (fd FieldDependency) IsSatisfied(v []byte, found bool) bool {
+	if fd.Predicate != nil {
+		return fd.Predicate(v, found)
+	}
+	if !found {
+		return fd.Value == ""
+	}
+	return string(v) == fd.Value
+}
+
+// FieldDependencies contains a set of rules. All rules must be satisfied.
+type FieldDependencies []FieldDependency
+
+// IsSatisfied calls the function fn for each route and checks if the returned
+// value satisfies the rule. Returns true if all rules are satisfied or the
+// slice is empty.
+func (fds FieldDependencies) IsSatisfied(fn func(route string) (v []byte, found bool, err error)) (bool, error) {
+	for _, fd := range fds {
+		v, found, err := fn(fd.Route)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if !fd.IsSatisfied(v, found) {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // MakeFields wrapper to create a new Fields
@@ -616,6 +759,10 @@ func (f *Field) Update(new *Field) *Field {
 
 	f.Visible = new.Visible
 	f.CanBeEmpty = new.CanBeEmpty
+	f.Required = new.Required
+	if len(new.DependsOn) > 0 {
+		f.DependsOn = new.DependsOn
+	}
 
 	if new.Default != "" {
 		f.Default = new.Default
@@ -849,3 +849,79 @@ func TestSectionSliceAppendFields(t *testing.T) {
 		t.Errorf("\nWant: %s\nHave: %s\n", want, have)
 	}
 }
+
+func TestSections_Validate_DependsOn(t *testing.T) {
+	t.Parallel()
+
+	newSections := func(deps ...config.FieldDependencies) config.Sections {
+		return config.MakeSections(
+			&config.Section{
+				ID: `payment`,
+				Groups: config.MakeGroups(
+					&config.Group{
+						ID: `paypal`,
+						Fields: config.MakeFields(
+							&config.Field{ID: `active`, DependsOn: deps[0]},
+							&config.Field{ID: `api_key`, DependsOn: deps[1]},
+							&config.Field{ID: `api_secret`, DependsOn: deps[2]},
+						),
+					},
+				),
+			},
+		)
+	}
+
+	t.Run("no cycle", func(t *testing.T) {
+		ss := newSections(
+			nil,
+			config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+			config.FieldDependencies{{Route: "payment/paypal/api_key", Predicate: func(v []byte, found bool) bool { return found }}},
+		)
+		assert.NoError(t, ss.Validate())
+		assert.Exactly(t, []string{"payment/paypal/api_key"}, ss.Dependents("payment/paypal/active"))
+		assert.Exactly(t, []string{"payment/paypal/api_secret"}, ss.Dependents("payment/paypal/api_key"))
+		assert.Nil(t, ss.Dependents("payment/paypal/api_secret"))
+	})
+	t.Run("self reference", func(t *testing.T) {
+		ss := newSections(
+			config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+			nil, nil,
+		)
+		err := ss.Validate()
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+	t.Run("cycle over three fields", func(t *testing.T) {
+		ss := newSections(
+			config.FieldDependencies{{Route: "payment/paypal/api_secret"}},
+			config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+			config.FieldDependencies{{Route: "payment/paypal/api_key"}},
+		)
+		err := ss.Validate()
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		assert.EqualError(t, err, "[config] Circular DependsOn detected: payment/paypal/active -> payment/paypal/api_secret -> payment/paypal/api_key -> payment/paypal/active")
+	})
+	t.Run("invalid route", func(t *testing.T) {
+		ss := newSections(
+			nil,
+			config.FieldDependencies{{Route: "payment/paypal"}},
+			nil,
+		)
+		err := ss.Validate()
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
+
+func TestFieldDependency_IsSatisfied(t *testing.T) {
+	t.Parallel()
+	fd := config.FieldDependency{Route: "aa/bb/cc", Value: "1"}
+	assert.True(t, fd.IsSatisfied([]byte(`1`), true))
+	assert.False(t, fd.IsSatisfied([]byte(`0`), true))
+	assert.False(t, fd.IsSatisfied(nil, false))
+
+	fd = config.FieldDependency{Route: "aa/bb/cc"}
+	assert.True(t, fd.IsSatisfied(nil, false))
+
+	fd.Predicate = func(v []byte, found bool) bool { return found && len(v) > 2 }
+	assert.True(t, fd.IsSatisfied([]byte(`abc`), true))
+	assert.False(t, fd.IsSatisfied([]byte(`ab`), true))
+}
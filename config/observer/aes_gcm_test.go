@@ -21,6 +21,7 @@ import (
 	"github.com/corestoreio/errors"
 	"github.com/weiwolves/pkg/config"
 	"github.com/weiwolves/pkg/config/observer"
+	"github.com/weiwolves/pkg/config/storage"
 	"github.com/weiwolves/pkg/util/assert"
 )
 
@@ -106,3 +107,51 @@ func TestMustNewAESGCM(t *testing.T) {
 	}()
 	_ = observer.MustNewAESGCM(19, &observer.AESGCMOptions{})
 }
+
+func TestNewAESGCM_InactiveField(t *testing.T) {
+	t.Parallel()
+
+	stor := storage.NewMap()
+	srv := config.MustNewService(stor, config.Options{},
+		config.WithApplySections(
+			&config.Section{
+				ID: `payment`,
+				Groups: config.MakeGroups(
+					&config.Group{
+						ID: `paypal`,
+						Fields: config.MakeFields(
+							&config.Field{ID: `active`, Default: "0"},
+							&config.Field{
+								ID:        `api_secret`,
+								DependsOn: config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+							},
+						),
+					},
+				),
+			},
+		),
+	)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	o := &observer.AESGCMOptions{Key: "abcdefghijklmnop"}
+	assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "payment/paypal/api_secret", observer.MustNewAESGCM(config.EventOnBeforeSet, o)))
+	assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "payment/paypal/api_secret", observer.MustNewValidator(observer.ValidatorArg{
+		Funcs: []string{"utf8"},
+	})))
+
+	// the field is inactive, the validator gets skipped, the encryption not.
+	p := config.MustMakePath("payment/paypal/api_secret")
+	plainText := []byte(`Secret Password`)
+	assert.NoError(t, srv.Set(p, plainText))
+
+	stored, found, err := stor.Get(p)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotEqual(t, plainText, stored, "Secret must be stored encrypted")
+
+	obDec, err := observer.NewAESGCM(config.EventOnAfterGet, o)
+	assert.NoError(t, err)
+	decText, err := obDec.Observe(p, stored, true)
+	assert.NoError(t, err)
+	assert.Exactly(t, plainText, decText)
+}
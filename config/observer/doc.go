@@ -26,6 +26,10 @@
 // hex_encode, hex_decode, sha256, gzip, gunzip, AES-GCM encrypt/decrypt and any
 // custom modifier added via function RegisterModifier.
 //
+// The template observer expands references to other configuration values like
+// `${web/unsecure/base_url}` or to environment variables like `${env:HOST}`.
+// See NewTemplate and RegisterTemplateFactory.
+//
 // The list of validators and modifiers will be extended. Please suggest new
 // ones.
 //
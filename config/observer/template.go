@@ -0,0 +1,405 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/store/scope"
+)
+
+const (
+	templateStart     = "${"
+	templateEnd       = "}"
+	templateEnvPrefix = "env:"
+	templateMaxDepth  = 10
+)
+
+// TemplateGetter reads a configuration value without dispatching observers.
+// Implemented by *config.Service.
+type TemplateGetter interface {
+	GetRaw(p config.Path) *config.Value
+}
+
+// TemplateSubscriber subscribes to changes of configuration values. Implemented
+// by *config.Service.
+type TemplateSubscriber interface {
+	Subscribe(path string, mr config.MessageReceiver) (subscriptionID int, err error)
+	Unsubscribe(subscriptionID int) error
+}
+
+// TemplateOptions provides the dependencies for the template observer. Those
+// options cannot be set via JSON or protocol buffers.
+type TemplateOptions struct {
+	// Getter required, usually *config.Service.
+	Getter TemplateGetter
+	// Subscriber optional, usually *config.Service. If nil, caching of the
+	// expanded values gets disabled.
+	Subscriber TemplateSubscriber
+	// WebsiteID optional function which returns the website ID of a store ID.
+	// If nil, a reference within a store scoped value falls back directly to
+	// the default scope.
+	WebsiteID func(storeID uint32) (websiteID uint32, ok bool)
+}
+
+// TemplateArg defines the behaviour of the template observer. Can be created
+// via JSON or protocol buffers.
+//easyjson:json
+type TemplateArg struct {
+	// DisableCache disables the caching of expanded values.
+	DisableCache bool `json:"disable_cache,omitempty"`
+	// DisableEnv disables the expansion of environment variables.
+	DisableEnv bool `json:"disable_env,omitempty"`
+	// MaxDepth defines the maximum nesting level of references. Default 10.
+	MaxDepth int `json:"max_depth,omitempty"`
+}
+
+type templateEntry struct {
+	raw      string
+	expanded []byte
+}
+
+// template expands references to other configuration values and to
+// environment variables.
+type template struct {
+	TemplateOptions
+	arg TemplateArg
+
+	mu sync.RWMutex
+	// cache key is the fully qualified path of the observed value.
+	cache map[string]templateEntry
+	// deps key is the fully qualified path of a referenced value and the value
+	// contains the keys of the cache which depend on it.
+	deps map[string]map[string]struct{}
+	// subscribed contains all fully qualified paths which are registered with
+	// the Subscriber and their subscription ID.
+	subscribed map[string]int
+	// subscribing contains the paths which are currently getting registered
+	// with the Subscriber.
+	subscribing map[string]struct{}
+	// generation gets incremented by MessageConfig. An expanded value only gets
+	// cached if no referenced path has been changed during its expansion.
+	generation uint64
+	closed     bool
+}
+
+// NewTemplate creates a new observer which expands references in a value
+// during config.EventOnAfterGet. A reference has the form
+// `${section/group/field}` and gets resolved with the scope chain of the path
+// whose value has been found: store -> website -> default. A value of the
+// default scope resolves its references always in the default scope, even if
+// config.Scoped requested a store. Referenced values can contain
+// references themselves. A circular reference returns an error with kind
+// NotValid. The form `${env:HOST}` expands the environment variable HOST. Use
+// `$${` to write a literal `${`.
+//
+// Expanded values get cached and the cache entries get invalidated once a
+// referenced path changes, using the Subscribe mechanism of the config.Service.
+// The subscriptions get removed when the observer gets deregistered via
+// config.Service.DeregisterObserver. Environment variables are not watched for
+// changes.
+//		cfgSrv.RegisterObserver(config.EventOnAfterGet, "web", observer.MustNewTemplate(
+//			observer.TemplateOptions{Getter: cfgSrv, Subscriber: cfgSrv},
+//			observer.TemplateArg{},
+//		))
+func NewTemplate(o TemplateOptions, ta TemplateArg) (config.Observer, error) {
+	if o.Getter == nil {
+		return nil, errors.Empty.Newf("[config/observer] TemplateOptions.Getter cannot be nil")
+	}
+	if ta.MaxDepth < 1 {
+		ta.MaxDepth = templateMaxDepth
+	}
+	if o.Subscriber == nil {
+		ta.DisableCache = true
+	}
+	return &template{
+		TemplateOptions: o,
+		arg:             ta,
+		cache:           make(map[string]templateEntry),
+		deps:            make(map[string]map[string]struct{}),
+		subscribed:      make(map[string]int),
+		subscribing:     make(map[string]struct{}),
+	}, nil
+}
+
+// MustNewTemplate same as NewTemplate but panics on error.
+func MustNewTemplate(o TemplateOptions, ta TemplateArg) config.Observer {
+	t, err := NewTemplate(o, ta)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// RegisterTemplateFactory registers the template observer under the type name
+// "template" to make it available in the Configuration format, used by
+// RegisterWithJSON, the HTTP handler and the protocol buffers service. The
+// Configuration.Condition contains the JSON encoded TemplateArg, e.g.
+// `{"disable_env":true}` or `{}`.
+func RegisterTemplateFactory(o TemplateOptions) {
+	RegisterFactory("template", func(rawJSON []byte) (config.Observer, error) {
+		var ta TemplateArg
+		if err := json.Unmarshal(rawJSON, &ta); err != nil {
+			return nil, errors.BadEncoding.New(err, "[config/observer] Failed to decode: %q", string(rawJSON))
+		}
+		o, err := NewTemplate(o, ta)
+		return o, errors.WithStack(err)
+	})
+}
+
+// Observe expands the references in rawData.
+func (t *template) Observe(p config.Path, rawData []byte, found bool) ([]byte, error) {
+	if !found || !bytes.Contains(rawData, []byte(templateStart)) {
+		return rawData, nil
+	}
+
+	fq, err := p.FQ()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var generation uint64
+	if !t.arg.DisableCache {
+		t.mu.RLock()
+		e, ok := t.cache[fq]
+		generation = t.generation
+		t.mu.RUnlock()
+		if ok && e.raw == string(rawData) {
+			return e.expanded, nil
+		}
+	}
+
+	var deps []string
+	_, route := p.ScopeRoute()
+	stack := []string{route}
+	expanded, err := t.expand(p, string(rawData), stack, &deps)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[config/observer] Template with path %q", fq)
+	}
+
+	if !t.arg.DisableCache {
+		if err := t.store(fq, string(rawData), expanded, deps, generation); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return expanded, nil
+}
+
+func (t *template) expand(p config.Path, data string, stack []string, deps *[]string) ([]byte, error) {
+	if len(stack) > t.arg.MaxDepth {
+		return nil, errors.OutOfRange.Newf("[config/observer] Template maximum nesting depth of %d reached: %s", t.arg.MaxDepth, strings.Join(stack, " -> "))
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	for {
+		pos := strings.Index(data, templateStart)
+		if pos < 0 {
+			buf.WriteString(data)
+			break
+		}
+		if pos > 0 && data[pos-1] == '$' { // escaped $${
+			buf.WriteString(data[:pos])
+			buf.WriteString("{")
+			data = data[pos+len(templateStart):]
+			continue
+		}
+		buf.WriteString(data[:pos])
+		data = data[pos+len(templateStart):]
+
+		end := strings.Index(data, templateEnd)
+		if end < 0 {
+			return nil, errors.NotValid.Newf("[config/observer] Template reference %q not closed", templateStart+data)
+		}
+		ref := strings.TrimSpace(data[:end])
+		data = data[end+len(templateEnd):]
+
+		if strings.HasPrefix(ref, templateEnvPrefix) {
+			if t.arg.DisableEnv {
+				return nil, errors.NotAllowed.Newf("[config/observer] Template environment variables are disabled: %q", ref)
+			}
+			name := ref[len(templateEnvPrefix):]
+			ev, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, errors.NotFound.Newf("[config/observer] Template environment variable %q not found", name)
+			}
+			buf.WriteString(ev)
+			continue
+		}
+
+		for _, r := range stack {
+			if r == ref {
+				return nil, errors.NotValid.Newf("[config/observer] Template circular reference detected: %s -> %s", strings.Join(stack, " -> "), ref)
+			}
+		}
+
+		v, err := t.lookup(p, ref, deps)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if strings.Contains(v, templateStart) {
+			ev, err := t.expand(p, v, append(stack, ref), deps)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			buf.Write(ev)
+			continue
+		}
+		buf.WriteString(v)
+	}
+	return buf.Bytes(), nil
+}
+
+// lookup resolves the route within the scope chain of path p. All checked
+// paths are getting added to deps because a later write to any of them might
+// change the result.
+func (t *template) lookup(p config.Path, route string, deps *[]string) (string, error) {
+	scopeIDs := make(scope.TypeIDs, 0, 3)
+	switch scp, id := p.ScopeID.Unpack(); scp {
+	case scope.Store:
+		scopeIDs = append(scopeIDs, p.ScopeID)
+		if t.WebsiteID != nil {
+			if wID, ok := t.WebsiteID(id); ok {
+				scopeIDs = append(scopeIDs, scope.Website.WithID(wID))
+			}
+		}
+	case scope.Website:
+		scopeIDs = append(scopeIDs, p.ScopeID)
+	}
+	scopeIDs = append(scopeIDs, scope.DefaultTypeID)
+
+	for _, scpID := range scopeIDs {
+		rp, err := config.MakePathWithScope(scpID, route)
+		if err != nil {
+			return "", errors.Wrapf(err, "[config/observer] Template invalid reference %q", route)
+		}
+		fq, err := rp.FQ()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		*deps = append(*deps, fq)
+
+		v, ok, err := t.Getter.GetRaw(rp).Str()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if ok {
+			return v, nil
+		}
+	}
+	return "", errors.NotFound.Newf("[config/observer] Template reference %q not found in scopes %s", route, scopeIDs.String())
+}
+
+// store caches the expanded value and subscribes to the referenced paths. The
+// Subscriber gets called without holding the lock because the config.Service
+// calls MessageConfig while holding its own lock. The value does not get
+// cached if a referenced path had to be subscribed first, because a change of
+// that path during the expansion has not been reported, or if a referenced
+// path has changed since the expansion started.
+func (t *template) store(fq, raw string, expanded []byte, deps []string, generation uint64) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	var newDeps []string
+	for _, d := range deps {
+		_, ok1 := t.subscribed[d]
+		_, ok2 := t.subscribing[d]
+		if !ok1 && !ok2 {
+			t.subscribing[d] = struct{}{}
+			newDeps = append(newDeps, d)
+		}
+	}
+	if len(newDeps) == 0 && generation == t.generation {
+		t.cache[fq] = templateEntry{raw: raw, expanded: expanded}
+		for _, d := range deps {
+			if _, ok := t.deps[d]; !ok {
+				t.deps[d] = make(map[string]struct{})
+			}
+			t.deps[d][fq] = struct{}{}
+		}
+	}
+	t.mu.Unlock()
+
+	for i, d := range newDeps {
+		id, err := t.Subscriber.Subscribe(d, t)
+
+		t.mu.Lock()
+		delete(t.subscribing, d)
+		closed := t.closed
+		if err == nil && !closed {
+			t.subscribed[d] = id
+		}
+		if err != nil {
+			for _, d2 := range newDeps[i+1:] {
+				delete(t.subscribing, d2)
+			}
+		}
+		t.mu.Unlock()
+
+		switch {
+		case err != nil:
+			return errors.Wrapf(err, "[config/observer] Template failed to subscribe to path %q", d)
+		case closed:
+			if err := t.Subscriber.Unsubscribe(id); err != nil {
+				return errors.Wrapf(err, "[config/observer] Template failed to unsubscribe from path %q", d)
+			}
+		}
+	}
+	return nil
+}
+
+// Close removes all subscriptions and clears the cache. Afterwards the values
+// get expanded without caching. Gets called by config.Service.DeregisterObserver.
+func (t *template) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	subscribed := t.subscribed
+	t.subscribed = make(map[string]int)
+	t.cache = make(map[string]templateEntry)
+	t.deps = make(map[string]map[string]struct{})
+	t.mu.Unlock()
+
+	for d, id := range subscribed {
+		if err := t.Subscriber.Unsubscribe(id); err != nil {
+			return errors.Wrapf(err, "[config/observer] Template failed to unsubscribe from path %q", d)
+		}
+	}
+	return nil
+}
+
+// MessageConfig implements config.MessageReceiver and removes all cached
+// values which depend on path p.
+func (t *template) MessageConfig(p config.Path) error {
+	fq, err := p.FQ()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation++
+	for key := range t.deps[fq] {
+		delete(t.cache, key)
+	}
+	delete(t.deps, fq)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall json
+
+package observer_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/observer"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestRegisterTemplateFactory(t *testing.T) {
+	cfgSrv := config.MustNewService(storage.NewMap(
+		"default/0/web/unsecure/base_url", "http://example.com/",
+		"default/0/web/unsecure/base_link_url", "${web/unsecure/base_url}index.php/",
+	), config.Options{EnablePubSub: true})
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	observer.RegisterTemplateFactory(observer.TemplateOptions{Getter: cfgSrv, Subscriber: cfgSrv})
+
+	err := observer.RegisterWithJSON(cfgSrv, bytes.NewBufferString(`{"Collection":[{
+		"event":"after_get", "route":"web/unsecure", "type":"template", "condition":{"disable_env":true}
+	}]}`))
+	assert.NoError(t, err)
+	assert.Exactly(t, "http://example.com/index.php/", cfgSrv.Get(config.MustMakePath("web/unsecure/base_link_url")).UnsafeStr())
+
+	err = observer.RegisterWithJSON(cfgSrv, bytes.NewBufferString(`{"Collection":[{
+		"event":"after_get", "route":"web/unsecure", "type":"template", "condition":{"disable_env":"yes"}
+	}]}`))
+	assert.True(t, errors.BadEncoding.Match(err), "%+v", err)
+}
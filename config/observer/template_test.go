@@ -0,0 +1,269 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observer_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/observer"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTemplateService(t *testing.T, ta observer.TemplateArg, fqPathValue ...string) *config.Service {
+	cfgSrv := config.MustNewService(storage.NewMap(fqPathValue...), config.Options{EnablePubSub: true})
+	assert.NoError(t, cfgSrv.RegisterObserver(config.EventOnAfterGet, "web", observer.MustNewTemplate(
+		observer.TemplateOptions{
+			Getter:     cfgSrv,
+			Subscriber: cfgSrv,
+			WebsiteID: func(storeID uint32) (uint32, bool) {
+				return 1, storeID == 2
+			},
+		}, ta,
+	)))
+	return cfgSrv
+}
+
+func TestNewTemplate(t *testing.T) {
+	assert.NoError(t, os.Setenv("CS_TEST_TEMPLATE_HOST", "cdn.example.com"))
+	defer os.Unsetenv("CS_TEST_TEMPLATE_HOST")
+
+	cfgSrv := newTemplateService(t, observer.TemplateArg{},
+		"default/0/web/unsecure/base_url", "http://example.com/",
+		"websites/1/web/unsecure/base_url", "http://example.de/",
+		"default/0/web/unsecure/base_link_url", "${web/unsecure/base_url}index.php/",
+		"default/0/web/unsecure/base_media_url", "${web/unsecure/base_link_url}media/",
+		"websites/1/web/unsecure/base_media_url", "${web/unsecure/base_link_url}media/",
+		"stores/2/web/unsecure/base_media_url", "${web/unsecure/base_link_url}media/",
+		"stores/3/web/unsecure/base_media_url", "${web/unsecure/base_link_url}media/",
+		"default/0/web/unsecure/base_static_url", "https://${env:CS_TEST_TEMPLATE_HOST}/static/",
+		"default/0/web/secure/escaped", "$${web/unsecure/base_url}",
+		"default/0/web/secure/cycle_a", "a${web/secure/cycle_b}",
+		"default/0/web/secure/cycle_b", "b${web/secure/cycle_a}",
+		"default/0/web/secure/missing", "${web/secure/not_set}",
+		"default/0/web/secure/missing_env", "${env:CS_TEST_TEMPLATE_HOST_NOT_SET}",
+		"default/0/web/secure/unclosed", "${web/unsecure/base_url",
+	)
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	tests := []struct {
+		p       config.Path
+		want    string
+		errKind errors.Kind
+	}{
+		{config.MustMakePath("web/unsecure/base_link_url"), "http://example.com/index.php/", errors.NoKind},
+		{config.MustMakePath("web/unsecure/base_media_url"), "http://example.com/index.php/media/", errors.NoKind},
+		{config.MustMakePath("web/unsecure/base_media_url").BindWebsite(1), "http://example.de/index.php/media/", errors.NoKind},
+		{config.MustMakePath("web/unsecure/base_media_url").BindStore(2), "http://example.de/index.php/media/", errors.NoKind},
+		{config.MustMakePath("web/unsecure/base_media_url").BindStore(3), "http://example.com/index.php/media/", errors.NoKind},
+		{config.MustMakePath("web/unsecure/base_static_url"), "https://cdn.example.com/static/", errors.NoKind},
+		{config.MustMakePath("web/secure/escaped"), "${web/unsecure/base_url}", errors.NoKind},
+		{config.MustMakePath("web/secure/cycle_a"), "", errors.NotValid},
+		{config.MustMakePath("web/secure/missing"), "", errors.NotFound},
+		{config.MustMakePath("web/secure/missing_env"), "", errors.NotFound},
+		{config.MustMakePath("web/secure/unclosed"), "", errors.NotValid},
+	}
+	for _, test := range tests {
+		v, _, err := cfgSrv.Get(test.p).Str()
+		if test.errKind != errors.NoKind {
+			assert.True(t, test.errKind.Match(err), "Path %q: %+v", test.p.String(), err)
+			continue
+		}
+		assert.NoError(t, err, "Path %q", test.p.String())
+		assert.Exactly(t, test.want, v, "Path %q", test.p.String())
+	}
+}
+
+func TestNewTemplate_CacheInvalidation(t *testing.T) {
+	cfgSrv := newTemplateService(t, observer.TemplateArg{},
+		"default/0/web/unsecure/base_url", "http://example.com/",
+		"default/0/web/unsecure/base_link_url", "${web/unsecure/base_url}index.php/",
+	)
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	p := config.MustMakePath("web/unsecure/base_link_url")
+	assert.Exactly(t, "http://example.com/index.php/", cfgSrv.Get(p).UnsafeStr())
+	assert.Exactly(t, "http://example.com/index.php/", cfgSrv.Get(p).UnsafeStr(), "cached")
+
+	assert.NoError(t, cfgSrv.Set(config.MustMakePath("web/unsecure/base_url"), []byte("http://example.org/")))
+
+	var v string
+	for i := 0; i < 100; i++ { // pub sub runs asynchronously
+		if v = cfgSrv.Get(p).UnsafeStr(); v == "http://example.org/index.php/" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Exactly(t, "http://example.org/index.php/", v)
+
+	// changing the raw value itself bypasses the cache
+	assert.NoError(t, cfgSrv.Set(p, []byte("${web/unsecure/base_url}shop/")))
+	assert.Exactly(t, "http://example.org/shop/", cfgSrv.Get(p).UnsafeStr())
+}
+
+func TestNewTemplate_Errors(t *testing.T) {
+	t.Run("getter nil", func(t *testing.T) {
+		o, err := observer.NewTemplate(observer.TemplateOptions{}, observer.TemplateArg{})
+		assert.Nil(t, o)
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+
+	t.Run("env disabled", func(t *testing.T) {
+		cfgSrv := newTemplateService(t, observer.TemplateArg{DisableEnv: true},
+			"default/0/web/unsecure/base_url", "http://${env:HOME}/",
+		)
+		defer func() { assert.NoError(t, cfgSrv.Close()) }()
+		_, _, err := cfgSrv.Get(config.MustMakePath("web/unsecure/base_url")).Str()
+		assert.True(t, errors.NotAllowed.Match(err), "%+v", err)
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		cfgSrv := newTemplateService(t, observer.TemplateArg{MaxDepth: 2},
+			"default/0/web/aa/a", "${web/aa/b}",
+			"default/0/web/aa/b", "${web/aa/c}",
+			"default/0/web/aa/c", "${web/aa/d}",
+			"default/0/web/aa/d", "d",
+		)
+		defer func() { assert.NoError(t, cfgSrv.Close()) }()
+		_, _, err := cfgSrv.Get(config.MustMakePath("web/aa/a")).Str()
+		assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+		v, _, err := cfgSrv.Get(config.MustMakePath("web/aa/b")).Str()
+		assert.NoError(t, err)
+		assert.Exactly(t, "d", v)
+	})
+}
+
+func TestNewTemplate_DefaultValue(t *testing.T) {
+	cfgSrv := config.MustNewService(storage.NewMap(
+		"default/0/web/unsecure/base_link_url", "${web/unsecure/base_url}index.php/",
+	), config.Options{EnablePubSub: true},
+		config.WithFieldMeta(&config.FieldMeta{Route: "web/unsecure/base_url", Default: "http://default.com/"}),
+	)
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+	assert.NoError(t, cfgSrv.RegisterObserver(config.EventOnAfterGet, "web", observer.MustNewTemplate(
+		observer.TemplateOptions{Getter: cfgSrv, Subscriber: cfgSrv}, observer.TemplateArg{},
+	)))
+
+	v, ok, err := cfgSrv.Get(config.MustMakePath("web/unsecure/base_link_url")).Str()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Exactly(t, "http://default.com/index.php/", v)
+}
+
+type recordingSubscriber struct {
+	*config.Service
+	subscribed   []int
+	unsubscribed []int
+}
+
+func (rs *recordingSubscriber) Subscribe(path string, mr config.MessageReceiver) (int, error) {
+	id, err := rs.Service.Subscribe(path, mr)
+	rs.subscribed = append(rs.subscribed, id)
+	return id, err
+}
+
+func (rs *recordingSubscriber) Unsubscribe(subscriptionID int) error {
+	rs.unsubscribed = append(rs.unsubscribed, subscriptionID)
+	return rs.Service.Unsubscribe(subscriptionID)
+}
+
+func TestNewTemplate_DeregisterObserver(t *testing.T) {
+	cfgSrv := config.MustNewService(storage.NewMap(
+		"default/0/web/unsecure/base_url", "http://example.com/",
+		"default/0/web/unsecure/base_link_url", "${web/unsecure/base_url}index.php/",
+	), config.Options{EnablePubSub: true})
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	rs := &recordingSubscriber{Service: cfgSrv}
+	assert.NoError(t, cfgSrv.RegisterObserver(config.EventOnAfterGet, "web", observer.MustNewTemplate(
+		observer.TemplateOptions{Getter: cfgSrv, Subscriber: rs}, observer.TemplateArg{},
+	)))
+
+	p := config.MustMakePath("web/unsecure/base_link_url")
+	assert.Exactly(t, "http://example.com/index.php/", cfgSrv.Get(p).UnsafeStr())
+	assert.Len(t, rs.subscribed, 1)
+
+	assert.NoError(t, cfgSrv.DeregisterObserver(config.EventOnAfterGet, "web"))
+	assert.Exactly(t, rs.subscribed, rs.unsubscribed)
+	assert.Exactly(t, "${web/unsecure/base_url}index.php/", cfgSrv.Get(p).UnsafeStr())
+}
+
+func TestNewTemplate_Concurrent(t *testing.T) {
+	// Each store path gets expanded the first time while its references get
+	// subscribed and the writers trigger the delivery of messages.
+	const stores = 400
+	fqPathValue := []string{"default/0/web/unsecure/base_url", "http://example.com/"}
+	paths := make([]config.Path, 0, stores)
+	for st := 1; st <= stores; st++ {
+		fqPathValue = append(fqPathValue, fmt.Sprintf("stores/%d/web/unsecure/base_link_url", st), fmt.Sprintf("${web/unsecure/base_url}%d/", st))
+		paths = append(paths, config.MustMakePath("web/unsecure/base_link_url").BindStore(uint32(st)))
+	}
+	cfgSrv := newTemplateService(t, observer.TemplateArg{}, fqPathValue...)
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	pBase := config.MustMakePath("web/unsecure/base_url")
+	readersDone := make(chan struct{})
+	done := make(chan struct{})
+	var wgReaders, wgWriters sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wgReaders.Add(1)
+		go func(i int) {
+			defer wgReaders.Done()
+			for j := i; j < stores; j += 4 {
+				_, _, err := cfgSrv.Get(paths[j]).Str()
+				assert.NoError(t, err)
+			}
+		}(i)
+		wgWriters.Add(1)
+		go func(i int) {
+			defer wgWriters.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-readersDone:
+					return
+				default:
+				}
+				assert.NoError(t, cfgSrv.Set(pBase, []byte(fmt.Sprintf("http://example%d-%d.com/", i, j))))
+			}
+		}(i)
+	}
+	go func() {
+		wgReaders.Wait()
+		close(readersDone)
+		wgWriters.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("dead lock between the template observer and the config.Service")
+	}
+
+	assert.NoError(t, cfgSrv.Set(pBase, []byte("http://example.org/")))
+	var v string
+	for i := 0; i < 100; i++ { // pub sub runs asynchronously
+		if v = cfgSrv.Get(paths[0]).UnsafeStr(); v == "http://example.org/1/" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Exactly(t, "http://example.org/1/", v)
+}
@@ -212,6 +212,9 @@ func (v *validators) isValid(val string) error {
 	return errors.NotValid.Newf("[config/observer] The value %q can't be validated against %q", val, v.valType)
 }
 
+// IsValidator implements config.ObserverValidator.
+func (v *validators) IsValidator() bool { return true }
+
 // Observe validates the given rawData value. This functions runs in a hot path.
 func (v *validators) Observe(_ config.Path, rawData []byte, found bool) (rawData2 []byte, err error) {
 	if !utf8.Valid(rawData) {
@@ -271,6 +274,9 @@ func NewValidateMinMaxInt(minMax ...int64) (*ValidateMinMaxInt, error) {
 	}, nil
 }
 
+// IsValidator implements config.ObserverValidator.
+func (v ValidateMinMaxInt) IsValidator() bool { return true }
+
 // Observe runs the validation process.
 func (v ValidateMinMaxInt) Observe(p config.Path, rawData []byte, found bool) (rawData2 []byte, err error) {
 	condLen := len(v.Conditions)
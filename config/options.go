@@ -61,6 +61,11 @@ type Options struct {
 	// HotReloadSignals specifies custom signals to listen to. Defaults to
 	// syscall.SIGUSR2
 	HotReloadSignals []os.Signal
+	// WebsiteID optional function which returns the website ID of a store ID.
+	// It gets used to resolve the DependsOn rules of a store scoped path via
+	// the website scope. If nil, a store scoped path falls back directly to the
+	// default scope.
+	WebsiteID func(storeID uint32) (websiteID uint32, ok bool)
 }
 
 // LoadDataOption allows other storage backends to pump their data into the
@@ -135,6 +140,7 @@ func WithFieldMetaGenerator(fmGenerator func(*Service) (<-chan *FieldMeta, <-cha
 			s.mu.Lock()
 			defer func() {
 				once = true
+				s.updateDefaults()
 				s.mu.Unlock()
 			}()
 
@@ -182,6 +188,7 @@ func WithFieldMeta(fms ...*FieldMeta) LoadDataOption {
 			s.mu.Lock()
 			defer func() {
 				once = true
+				s.updateDefaults()
 				s.mu.Unlock()
 			}()
 
@@ -222,6 +229,7 @@ func WithApplySections(sections ...*Section) LoadDataOption {
 			buf := bufferpool.Get()
 			s.mu.Lock()
 			defer func() {
+				s.updateDefaults()
 				s.mu.Unlock()
 				bufferpool.Put(buf)
 				once = true
@@ -240,6 +248,8 @@ func WithApplySections(sections ...*Section) LoadDataOption {
 						fm.WriteScopePerm = f.Scopes
 						fm.Default = f.Default
 						fm.DefaultValid = f.Default != ""
+						fm.Required = f.Required
+						fm.DependsOn = f.DependsOn
 						s.routeConfig.PutMeta(route, fm)
 						buf.Reset()
 					}
@@ -82,13 +82,31 @@ type Observer interface {
 	Observe(p Path, rawData []byte, found bool) (newRawData []byte, err error)
 }
 
+// ObserverValidator gets implemented by an Observer which only validates the
+// raw data and never changes it. Inactive fields, see Field.DependsOn, skip
+// those observers during EventOnBeforeSet, all other observers, like
+// encryption, still run.
+type ObserverValidator interface {
+	Observer
+	// IsValidator returns true if the Observer only validates.
+	IsValidator() bool
+}
+
+func isValidator(o Observer) bool {
+	ov, ok := o.(ObserverValidator)
+	return ok && ov.IsValidator()
+}
+
 type observers []Observer
 
-func (fns observers) dispatch(p Path, v []byte, found bool) (_ []byte, err error) {
+func (fns observers) dispatch(p Path, v []byte, found, withValidators bool) (_ []byte, err error) {
 	if len(fns) == 0 {
 		return v, nil
 	}
 	for _, fn := range fns {
+		if !withValidators && isValidator(fn) {
+			continue
+		}
 		if v, err = fn.Observe(p, v, found); err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -185,6 +203,14 @@ func (trie *trieRoute) Get(key string) FieldMeta {
 // process runs on each tree level and dispatches the events and checks for
 // scope permission and default value.
 func (trie *trieRoute) process(key string, event uint8, p Path, v []byte, found bool) (v2 []byte, found2 bool, err error) {
+	return trie.processEvents(key, event, p, v, found, true)
+}
+
+// processEvents same as process but argument withValidators controls if the
+// registered observers implementing ObserverValidator get dispatched. All
+// other observers, scope permission checks and default values are always
+// applied.
+func (trie *trieRoute) processEvents(key string, event uint8, p Path, v []byte, found, withValidators bool) (v2 []byte, found2 bool, err error) {
 	if trie == nil {
 		return v, found, nil
 	}
@@ -200,7 +226,7 @@ func (trie *trieRoute) process(key string, event uint8, p Path, v []byte, found
 			return nil, false, errors.NotAllowed.Newf("[config] The path %q is not allowed to access this scope %s", p.String(), node.fm.WriteScopePerm.String())
 		}
 
-		if v, err = node.fm.Events[event].dispatch(p, v, found); err != nil {
+		if v, err = node.fm.Events[event].dispatch(p, v, found, withValidators); err != nil {
 			return nil, false, errors.WithStack(err)
 		}
 
@@ -269,10 +295,9 @@ func (trie *trieRoute) PutMeta(key string, fm *FieldMeta) bool {
 	return isNewVal
 }
 
-// DeleteEvent removes the fm associated with the given key. Returns true if a
-// node was found for the given key. If the node or any of its ancestors becomes
-// childless as a result, it is removed from the trie.
-func (trie *trieRoute) DeleteEvent(event uint8, key string) bool {
+// DeleteEvent removes the observers of the event associated with the given
+// key and returns them. Returns nil if no node was found for the given key.
+func (trie *trieRoute) DeleteEvent(event uint8, key string) observers {
 	key = buildTrieKey(key, 0)
 
 	node := trie
@@ -280,16 +305,16 @@ func (trie *trieRoute) DeleteEvent(event uint8, key string) bool {
 		node = node.children[part]
 		if node == nil {
 			// node does not exist
-			return false
+			return nil
 		}
 		if i == -1 {
 			break
 		}
 	}
 
+	removed := node.fm.Events[event]
 	node.fm.Events[event] = nil
-
-	return true // node (internal or not) existed and its fm was nil'd
+	return removed
 }
 
 // DeleteEvent removes the fm associated with the given key. Returns true if a
@@ -357,6 +382,24 @@ func (trie *trieRoute) walk(key string, walker walkFn) error {
 	return nil
 }
 
+// fieldDefault contains the default value of a trie node. isLeaf reports
+// whether the node has no children.
+type fieldDefault struct {
+	value  []byte
+	isLeaf bool
+}
+
+// collectDefaults adds all nodes with a valid default value to m. The key of m
+// is the trie key.
+func (trie *trieRoute) collectDefaults(key string, m map[string]fieldDefault) {
+	if trie.fm.valid && trie.fm.DefaultValid {
+		m[key] = fieldDefault{value: []byte(trie.fm.Default), isLeaf: trie.isLeaf()}
+	}
+	for part, child := range trie.children {
+		child.collectDefaults(key+part, m)
+	}
+}
+
 func (trie *trieRoute) isLeaf() bool {
 	return len(trie.children) == 0
 }
@@ -15,11 +15,13 @@
 package config
 
 import (
+	"io"
 	"os"
 	"os/signal"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/corestoreio/errors"
@@ -57,6 +59,15 @@ type Storager interface {
 	// Delete(p *Path) error TODO
 }
 
+// Notifier receives changes of configuration values which have been written by
+// another process or node directly into the Level2 storage, for example etcd
+// or the core_configuration table. Type *Service implements this interface.
+type Notifier interface {
+	// Notify applies the new value v of path p. Argument deleted reports
+	// whether the path has been removed from the storage.
+	Notify(p Path, v []byte, deleted bool) error
+}
+
 // ObserverRegisterer adds or removes observers for different events and theirs
 // routes. Extracted for testability in other packages. Type *Service implements
 // this interface.
@@ -90,6 +101,10 @@ type Service struct {
 	// routeConfig contains essential information about a route like scope for
 	// permission, default value or events.
 	routeConfig *trieRoute
+	// defaults contains a copy of the default values of routeConfig of type
+	// map[string]fieldDefault. It allows GetRaw to apply the default values
+	// without acquiring the lock.
+	defaults atomic.Value
 }
 
 // NewService creates the main new configuration for all scopes: default,
@@ -269,6 +284,65 @@ func (s *Service) Flush() error {
 	return nil
 }
 
+// Notify updates the Level1 cache with a value which has been changed outside
+// of this Service, e.g. by another node directly in etcd or in the
+// core_configuration table, and publishes the path to all subscribers. The
+// value won't be written to Level2 and no observers get dispatched. If argument
+// deleted is true, the path gets removed from the Level1 storage, if it
+// implements
+//		type deleter interface {
+//			Delete(Path) error
+//		}
+// otherwise the whole Level1 storage gets flushed, if supported.
+func (s *Service) Notify(p Path, v []byte, deleted bool) error {
+	type deleter interface {
+		Delete(Path) error
+	}
+	type flusher interface {
+		Flush() error
+	}
+
+	if p.UseEnvSuffix && p.envSuffix != s.envName {
+		p.envSuffix = s.envName
+	}
+	if err := p.IsValid(); err != nil {
+		return errors.WithStack(err)
+	}
+	if s.config.Log != nil && s.config.Log.IsDebug() {
+		s.config.Log.Debug("config.Service.Notify", log.Stringer("path", p), log.Int("data_length", len(v)), log.Bool("deleted", deleted))
+	}
+
+	if l1 := s.config.Level1; l1 != nil {
+		var err error
+		switch l1t := l1.(type) {
+		case deleter:
+			if deleted {
+				err = l1t.Delete(p)
+			} else {
+				err = l1.Set(p, v)
+			}
+		case flusher:
+			if deleted {
+				err = l1t.Flush()
+			} else {
+				err = l1.Set(p, v)
+			}
+		default:
+			if !deleted {
+				err = l1.Set(p, v)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "[config] Service.Notify.Level1 with path %q", p.String())
+		}
+	}
+
+	if s.pubSub != nil {
+		s.pubSub.sendMsg(p)
+	}
+	return nil
+}
+
 // Scoped creates a new scope base configuration reader which has the
 // implemented fall back hierarchy.
 func (s *Service) Scoped(websiteID, storeID uint32) Scoped {
@@ -292,14 +366,23 @@ func (s *Service) RegisterObserver(event uint8, route string, eo Observer) error
 
 // DeregisterObserver removes all observers for a specific route or route
 // prefix. Event argument is one of the constants starting with `EventOn...`.
+// Removed observers which implement io.Closer get closed, for example to
+// release their subscriptions.
 func (s *Service) DeregisterObserver(event uint8, route string) error {
 	if event >= eventMaxCount {
 		return errors.OutOfRange.Newf("[config] Service.DeregisterObserver event %d greater or equal than allowed %d", event, eventMaxCount)
 	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.routeConfig.DeleteEvent(event, route)
+	removed := s.routeConfig.DeleteEvent(event, route)
+	s.mu.Unlock()
 
+	for _, o := range removed {
+		if c, ok := o.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return errors.Wrapf(err, "[config] Service.DeregisterObserver.Close for route %q", route)
+			}
+		}
+	}
 	return nil
 }
 
@@ -329,10 +412,15 @@ func (s *Service) Set(p Path, v []byte) (err error) { // TODO v should be an imm
 		return
 	}
 
+	isActive, err := s.isFieldActive(p, v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	s.mu.RLock()
 	key := p.separatorSuffixRoute() // this can be optimized to move it into the process signature
 	key = buildTrieKey(key, p.ScopeID)
-	if v, _, err = s.routeConfig.process(key, EventOnBeforeSet, p, v, true); err != nil {
+	if v, _, err = s.routeConfig.processEvents(key, EventOnBeforeSet, p, v, true, isActive); err != nil {
 		s.mu.RUnlock()
 		return errors.WithStack(err)
 	}
@@ -354,6 +442,59 @@ func (s *Service) Set(p Path, v []byte) (err error) { // TODO v should be an imm
 	return
 }
 
+// isFieldActive evaluates the DependsOn rules of the FieldMeta of a path. The
+// depending routes get resolved in the scope of p and fall back like Scoped.Get
+// from store to website to default scope. An active field with the Required flag must not have an empty value.
+// An inactive field skips the observers of EventOnBeforeSet which implement
+// ObserverValidator.
+func (s *Service) isFieldActive(p Path, v []byte) (bool, error) {
+	s.mu.RLock()
+	fm := s.routeConfig.Get(string(p.route))
+	s.mu.RUnlock()
+	if !fm.valid {
+		return true, nil
+	}
+
+	scopeIDs := s.fallbackScopeIDs(p.ScopeID)
+	isActive, err := fm.DependsOn.IsSatisfied(func(route string) ([]byte, bool, error) {
+		var val *Value
+		for _, scpID := range scopeIDs {
+			val = s.Get(Path{route: Route(route), ScopeID: scpID})
+			if val.lastErr != nil || val.found == valFoundL1 || val.found == valFoundL2 {
+				break
+			}
+		}
+		return val.data, val.found > valFoundNo, val.lastErr
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "[config] Service.Set.DependsOn for path %q", p.String())
+	}
+	if isActive && fm.Required && len(v) == 0 {
+		return false, errors.Required.Newf("[config] Path %q requires a non-empty value", p.String())
+	}
+	return isActive, nil
+}
+
+// fallbackScopeIDs returns the scopes store->website->default starting at
+// scpID. The website of a store gets resolved via Options.WebsiteID, if set,
+// otherwise the store falls back directly to the default scope.
+func (s *Service) fallbackScopeIDs(scpID scope.TypeID) scope.TypeIDs {
+	scp, id := scpID.Unpack()
+	ids := make(scope.TypeIDs, 0, 3)
+	switch scp {
+	case scope.Store:
+		ids = append(ids, scpID)
+		if s.config.WebsiteID != nil {
+			if websiteID, ok := s.config.WebsiteID(id); ok {
+				ids = append(ids, scope.Website.WithID(websiteID))
+			}
+		}
+	case scope.Website:
+		ids = append(ids, scpID)
+	}
+	return append(ids, scope.DefaultTypeID)
+}
+
 // Get returns a configuration value from the Service, ignoring the scope
 // hierarchy/fallback logic using a direct match. Safe for concurrent use.
 // Example usage:
@@ -442,6 +583,74 @@ func (s *Service) Get(p Path) (v *Value) {
 	return
 }
 
+// GetRaw returns the value from the Level1 or Level2 storage without
+// dispatching any observers or checking permissions. If the value cannot be
+// found, GetRaw falls back to the default value of the FieldMeta data, like
+// Get. An observer must use GetRaw instead of Get to read the value of another
+// path, because Get holds a read lock while dispatching the observers and a
+// recursive read lock might dead lock.
+func (s *Service) GetRaw(p Path) (v *Value) {
+	if p.UseEnvSuffix && p.envSuffix != s.envName {
+		p.envSuffix = s.envName
+	}
+	v = &Value{
+		Path: p,
+	}
+
+	var ok bool
+	if s.config.Level1 != nil {
+		if v.data, ok, v.lastErr = s.config.Level1.Get(p); v.lastErr != nil || ok {
+			if ok {
+				v.found = valFoundL1
+			}
+			return
+		}
+	}
+	v.data, ok, v.lastErr = s.level2.Get(p)
+	switch {
+	case v.lastErr != nil:
+		v.lastErr = errors.Wrapf(v.lastErr, "[config] Service.GetRaw with path %q", p)
+	case ok:
+		v.found = valFoundL2
+	default:
+		if v.data, ok = s.defaultValue(p); ok {
+			v.found = valFoundDefaults
+		}
+	}
+	return
+}
+
+// updateDefaults copies the default values of routeConfig. The caller must hold
+// the write lock.
+func (s *Service) updateDefaults() {
+	m := make(map[string]fieldDefault)
+	s.routeConfig.collectDefaults("", m)
+	s.defaults.Store(m)
+}
+
+// defaultValue returns the default value of a path with the same rules as
+// trieRoute.process applies during EventOnAfterGet.
+func (s *Service) defaultValue(p Path) ([]byte, bool) {
+	m, _ := s.defaults.Load().(map[string]fieldDefault)
+	if len(m) == 0 {
+		return nil, false
+	}
+	key := buildTrieKey(p.separatorSuffixRoute(), p.ScopeID)
+	for _, i := segmentRoute(key, 0); ; _, i = segmentRoute(key, i) {
+		prefix := key
+		if i > 0 {
+			prefix = key[:i]
+		}
+		if fd, ok := m[prefix]; ok && (fd.isLeaf || p.ScopeID == 0 || p.ScopeID == scope.DefaultTypeID) {
+			return fd.value, true
+		}
+		if i == -1 {
+			break
+		}
+	}
+	return nil, false
+}
+
 // Subscribe adds an asynchronous Subscriber to be called when a write event
 // happens. See interface Subscriber for a detailed description. Path can be any
 // kind of level and can contain StrScope and Scope ID. Valid paths can be for
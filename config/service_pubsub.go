@@ -144,7 +144,10 @@ func (s *pubSub) publish() {
 				return
 			}
 
-			if len(s.subMap) == 0 {
+			s.mu.RLock()
+			hasSubs := len(s.subMap) > 0
+			s.mu.RUnlock()
+			if !hasSubs {
 				break
 			}
 			var evict []int
@@ -284,3 +284,40 @@ func TestPubSubEvict(t *testing.T) {
 	err = s.Close()
 	assert.True(t, errors.AlreadyClosed.Match(err), "Error: %s", err)
 }
+
+func TestService_Notify(t *testing.T) {
+	testPath := config.MustMakePath("aa/bb/cc").BindWebsite(3)
+
+	l1 := storage.NewMap()
+	l2 := storage.NewMap()
+	s := config.MustNewService(l2, config.Options{
+		Level1:       l1,
+		EnablePubSub: true,
+	})
+
+	msgC := make(chan string, 2)
+	_, err := s.Subscribe(testPath.String(), &testSubscriber{
+		t: t,
+		f: func(p config.Path) error {
+			msgC <- p.String()
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Notify(testPath, []byte(`remote`), false))
+	assert.Exactly(t, testPath.String(), <-msgC)
+	assert.Exactly(t, `"remote"`, s.Get(testPath).String())
+
+	_, ok, err := l2.Get(testPath)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Level2 must not be written by Notify")
+
+	assert.NoError(t, s.Notify(testPath, nil, true))
+	assert.Exactly(t, testPath.String(), <-msgC)
+	_, ok, err = l1.Get(testPath)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Level1 entry must be deleted")
+
+	assert.NoError(t, s.Close())
+}
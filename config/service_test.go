@@ -568,11 +568,14 @@ func TestService_DifferentStorageLevels(t *testing.T) {
 }
 
 type testObserver struct {
-	err     error
-	rawData []byte
-	observe func(p config.Path, rawData []byte, found bool) (rawData2 []byte, err error)
+	err       error
+	rawData   []byte
+	observe   func(p config.Path, rawData []byte, found bool) (rawData2 []byte, err error)
+	validator bool
 }
 
+func (to testObserver) IsValidator() bool { return to.validator }
+
 func (to testObserver) Observe(p config.Path, rawData []byte, found bool) (rawData2 []byte, err error) {
 	if to.observe != nil {
 		return to.observe(p, rawData, found)
@@ -862,3 +865,140 @@ func TestService_FieldMetaData_Fallbacks(t *testing.T) {
 		assert.Exactly(t, "\"Bitte wählen;Frau;Herr\"", str)
 	})
 }
+
+func TestService_FieldDependsOn(t *testing.T) {
+	t.Parallel()
+
+	srv := config.MustNewService(storage.NewMap(), config.Options{},
+		config.WithApplySections(
+			&config.Section{
+				ID: `payment`,
+				Groups: config.MakeGroups(
+					&config.Group{
+						ID: `paypal`,
+						Fields: config.MakeFields(
+							&config.Field{ID: `active`, Default: "0"},
+							&config.Field{
+								ID:        `api_key`,
+								Required:  true,
+								DependsOn: config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+							},
+						),
+					},
+				),
+			},
+		),
+	)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	var observerCalls int
+	assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "payment/paypal/api_key", testObserver{
+		observe: func(p config.Path, rawData []byte, found bool) ([]byte, error) {
+			observerCalls++
+			if len(rawData) < 4 {
+				return nil, errors.NotValid.Newf("API key too short")
+			}
+			return rawData, nil
+		},
+		validator: true,
+	}))
+	var modifierCalls int
+	assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "payment/paypal/api_key", testObserver{
+		observe: func(p config.Path, rawData []byte, found bool) ([]byte, error) {
+			modifierCalls++
+			return rawData, nil
+		},
+	}))
+
+	pKey := config.MustMakePath("payment/paypal/api_key")
+	pActive := config.MustMakePath("payment/paypal/active")
+
+	t.Run("inactive skips validation", func(t *testing.T) {
+		assert.NoError(t, srv.Set(pKey, nil))
+		assert.NoError(t, srv.Set(pKey.BindWebsite(2), []byte(`x`)))
+		assert.Exactly(t, 0, observerCalls)
+		assert.Exactly(t, 2, modifierCalls, "modifiers must run for inactive fields")
+	})
+	t.Run("active requires value", func(t *testing.T) {
+		assert.NoError(t, srv.Set(pActive.BindWebsite(2), []byte(`1`)))
+
+		err := srv.Set(pKey.BindWebsite(2), nil)
+		assert.True(t, errors.Required.Match(err), "%+v", err)
+
+		err = srv.Set(pKey.BindWebsite(2), []byte(`x`))
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		assert.NoError(t, srv.Set(pKey.BindWebsite(2), []byte(`x1y2z3`)))
+		assert.Exactly(t, 2, observerCalls)
+
+		// default scope still inactive
+		assert.NoError(t, srv.Set(pKey, []byte(`x`)))
+	})
+	t.Run("falls back to default scope", func(t *testing.T) {
+		assert.NoError(t, srv.Set(pActive, []byte(`1`)))
+		err := srv.Set(pKey.BindStore(3), nil)
+		assert.True(t, errors.Required.Match(err), "%+v", err)
+	})
+}
+
+func TestService_FieldDependsOn_WebsiteFallback(t *testing.T) {
+	t.Parallel()
+
+	srv := config.MustNewService(storage.NewMap(), config.Options{
+		WebsiteID: func(storeID uint32) (uint32, bool) {
+			switch storeID {
+			case 3:
+				return 2, true
+			case 4:
+				return 1, true
+			}
+			return 0, false
+		},
+	},
+		config.WithFieldMeta(
+			&config.FieldMeta{Route: "payment/paypal/active", Default: "0"},
+			&config.FieldMeta{
+				Route:     "payment/paypal/api_key",
+				Required:  true,
+				DependsOn: config.FieldDependencies{{Route: "payment/paypal/active", Value: "1"}},
+			},
+		),
+	)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	pKey := config.MustMakePath("payment/paypal/api_key")
+	assert.NoError(t, srv.Set(config.MustMakePath("payment/paypal/active").BindWebsite(2), []byte(`1`)))
+
+	// store 3 belongs to the active website 2
+	err := srv.Set(pKey.BindStore(3), nil)
+	assert.True(t, errors.Required.Match(err), "%+v", err)
+	// store 4 belongs to website 1 and falls back to the inactive default
+	assert.NoError(t, srv.Set(pKey.BindStore(4), nil))
+	// store 5 has no known website and falls back to the inactive default
+	assert.NoError(t, srv.Set(pKey.BindStore(5), nil))
+}
+
+func TestService_GetRaw_Defaults(t *testing.T) {
+	t.Parallel()
+
+	srv := config.MustNewService(storage.NewMap(
+		"websites/2/web/unsecure/base_url", "http://example.de/",
+	), config.Options{},
+		config.WithFieldMeta(&config.FieldMeta{Route: "web/unsecure/base_url", Default: "http://default.com/"}),
+	)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	p := config.MustMakePath("web/unsecure/base_url")
+	v, ok, err := srv.GetRaw(p).Str()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Exactly(t, "http://default.com/", v)
+
+	v, ok, err = srv.GetRaw(p.BindWebsite(2)).Str()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Exactly(t, "http://example.de/", v)
+
+	_, ok, err = srv.GetRaw(config.MustMakePath("web/unsecure/base_link_url")).Str()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
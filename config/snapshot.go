@@ -0,0 +1,432 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/store/scope"
+)
+
+// SnapshotMaskedValue replaces the value of a secret or encrypted path in a
+// Snapshot.
+const SnapshotMaskedValue = `******`
+
+// StorageIterator gets implemented by a Storager which can iterate over all of
+// its stored paths and values. The Service requires this interface on the
+// Level2 storage to create a Snapshot.
+type StorageIterator interface {
+	// Iterate calls fn for each stored path and value. Returning an error
+	// terminates the iteration.
+	Iterate(fn func(p Path, v []byte) error) error
+}
+
+// TxStorager gets implemented by a Storager which can write several values
+// atomically. ImportSnapshot requires this interface.
+type TxStorager interface {
+	// BeginTx starts a transaction. Values written via the returned StorageTx
+	// become visible to other readers after Commit.
+	BeginTx(ctx context.Context) (StorageTx, error)
+}
+
+// StorageTx writes values within a transaction. Either Commit or Rollback must
+// be called.
+type StorageTx interface {
+	Setter
+	Commit() error
+	Rollback() error
+}
+
+// SnapshotOptions applies options to Service.Snapshot.
+type SnapshotOptions struct {
+	// Scopes restricts the snapshot to the provided scopes. Empty slice
+	// includes all scopes.
+	Scopes scope.TypeIDs
+	// WithLevel1 adds the values of the Level1 storage, for example loaded by
+	// the file loaders via LoadDataOption.WithUseStorageLevel(1). Like in
+	// Service.Get, a Level1 value takes precedence over the Level2 value of
+	// the same path. Level1 must implement interface StorageIterator.
+	WithLevel1 bool
+	// WithDefaults adds the default values of the FieldMeta data, if a path has
+	// not been stored in Level1 or Level2.
+	WithDefaults bool
+	// MaskRoutes contains route prefixes whose values gets replaced with
+	// SnapshotMaskedValue, for example payment credentials. See also
+	// Sections.ObscureRoutes.
+	MaskRoutes []string
+	// MaskFn optional custom function to decide if the value of a path must be
+	// masked.
+	MaskFn func(Path) bool
+}
+
+func (so SnapshotOptions) isScopeAllowed(id scope.TypeID) bool {
+	if len(so.Scopes) == 0 {
+		return true
+	}
+	for _, s := range so.Scopes {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (so SnapshotOptions) isMasked(p Path) bool {
+	for _, r := range so.MaskRoutes {
+		if p.RouteHasPrefix(r) {
+			return true
+		}
+	}
+	return so.MaskFn != nil && so.MaskFn(p)
+}
+
+// SnapshotValue represents a single fully qualified path with its value.
+type SnapshotValue struct {
+	// Path the fully qualified path, e.g. stores/2/web/unsecure/base_url. The
+	// environment suffix of a path gets replaced by EnvNamePlaceHolder.
+	Path  string `json:"path" yaml:"path"`
+	Value string `json:"value" yaml:"value"`
+	// Masked reports whether the value has been replaced by
+	// SnapshotMaskedValue. Masked values won't be imported.
+	Masked bool `json:"masked,omitempty" yaml:"masked,omitempty"`
+}
+
+// Snapshot contains all effective configuration values of a Service, sorted by
+// path. A Snapshot can be written to a file, compared with another Snapshot
+// and imported into a Storager, for example to promote configuration values
+// from staging to production.
+type Snapshot struct {
+	// EnvName contains the environment name of the source Service.
+	EnvName string          `json:"env_name,omitempty" yaml:"env_name,omitempty"`
+	Values  []SnapshotValue `json:"values" yaml:"values"`
+}
+
+// Sort sorts the values by path.
+func (sn *Snapshot) Sort() {
+	sort.Slice(sn.Values, func(i, j int) bool { return sn.Values[i].Path < sn.Values[j].Path })
+}
+
+// WriteJSON writes the snapshot in a deterministic, indented JSON format.
+func (sn *Snapshot) WriteJSON(w io.Writer) error {
+	sn.Sort()
+	je := json.NewEncoder(w)
+	je.SetIndent("", "  ")
+	return errors.WithStack(je.Encode(sn))
+}
+
+// ReadSnapshotJSON reads a Snapshot written by function Snapshot.WriteJSON.
+func ReadSnapshotJSON(r io.Reader) (*Snapshot, error) {
+	sn := new(Snapshot)
+	if err := json.NewDecoder(r).Decode(sn); err != nil {
+		return nil, errors.CorruptData.New(err, "[config] ReadSnapshotJSON")
+	}
+	sn.Sort()
+	return sn, nil
+}
+
+// Snapshot creates a sorted snapshot of all values stored in the Level2
+// storage and, depending on the options, in the Level1 storage and of the
+// default values. Level2 must implement interface StorageIterator. Environment
+// aware paths get their environment suffix replaced with EnvNamePlaceHolder.
+func (s *Service) Snapshot(o SnapshotOptions) (*Snapshot, error) {
+	si, ok := s.level2.(StorageIterator)
+	if !ok {
+		return nil, errors.NotSupported.Newf("[config] Service.Snapshot: Level2 storage %T does not implement interface StorageIterator", s.level2)
+	}
+	var si1 StorageIterator
+	if o.WithLevel1 && s.config.Level1 != nil {
+		if si1, ok = s.config.Level1.(StorageIterator); !ok {
+			return nil, errors.NotSupported.Newf("[config] Service.Snapshot: Level1 storage %T does not implement interface StorageIterator", s.config.Level1)
+		}
+	}
+
+	sn := &Snapshot{EnvName: s.envName}
+	seen := make(map[string]bool)
+	add := func(p Path, v []byte) error {
+		if !o.isScopeAllowed(p.ScopeID) {
+			return nil
+		}
+		fq, err := p.FQ()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if s.isEnvRoute(p.route) {
+			fq = fq[:len(fq)-len(s.envName)] + EnvNamePlaceHolder
+		}
+		if seen[fq] {
+			return nil
+		}
+		seen[fq] = true
+		sv := SnapshotValue{Path: fq, Value: string(v)}
+		if o.isMasked(p) {
+			sv.Value = SnapshotMaskedValue
+			sv.Masked = true
+		}
+		sn.Values = append(sn.Values, sv)
+		return nil
+	}
+
+	// The first added value of a path wins, hence the order Level1, Level2
+	// and defaults.
+	if si1 != nil {
+		if err := si1.Iterate(add); err != nil {
+			return nil, errors.Wrap(err, "[config] Service.Snapshot.Level1.Iterate")
+		}
+	}
+	if err := si.Iterate(add); err != nil {
+		return nil, errors.Wrap(err, "[config] Service.Snapshot.Iterate")
+	}
+
+	if o.WithDefaults {
+		s.mu.RLock()
+		err := s.routeConfig.Walk(func(key string, fm FieldMeta) error {
+			if !fm.DefaultValid {
+				return nil
+			}
+			p, err := trieKeyToPath(key)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return add(p, []byte(fm.Default))
+		})
+		s.mu.RUnlock()
+		if err != nil {
+			return nil, errors.Wrap(err, "[config] Service.Snapshot.Walk")
+		}
+	}
+
+	sn.Sort()
+	return sn, nil
+}
+
+// isEnvRoute reports whether the route has been written for an environment
+// aware Path, which means the route has one segment more than PathLevels and
+// that segment equals the environment name of the Service.
+func (s *Service) isEnvRoute(r Route) bool {
+	if s.envName == "" {
+		return false
+	}
+	segs := strings.Split(string(r), sPathSeparator)
+	return len(segs) == PathLevels+1 && segs[PathLevels] == s.envName
+}
+
+// trieKeyToPath converts the key of the trieRoute, e.g. /aa/bb/cc or
+// /aa/bb/cc/websites/2, into a Path.
+func trieKeyToPath(key string) (Path, error) {
+	key = strings.TrimPrefix(key, sPathSeparator)
+	p := Path{route: Route(key), ScopeID: scope.DefaultTypeID}
+	if parts := strings.Split(key, sPathSeparator); len(parts) >= PathLevels+2 {
+		scp, id := parts[len(parts)-2], parts[len(parts)-1]
+		if isDigitOnly(id) && scope.FromString(scp).IsWebSiteOrStore() {
+			id64, err := strconv.ParseUint(id, 10, 32)
+			if err != nil {
+				return Path{}, errors.NotValid.New(err, "[config] Invalid scope ID in key %q", key)
+			}
+			p.route = Route(strings.Join(parts[:len(parts)-2], sPathSeparator))
+			p.ScopeID = scope.FromString(scp).WithID(uint32(id64))
+		}
+	}
+	return p, errors.WithStack(p.IsValid())
+}
+
+// SnapshotImportOptions applies options to the functions ImportSnapshot and
+// ImportSnapshotBestEffort.
+type SnapshotImportOptions struct {
+	// EnvName replaces the EnvNamePlaceHolder in the paths of the snapshot.
+	// Must be set if the snapshot contains environment aware paths.
+	EnvName string
+}
+
+// importValues validates and parses all unmasked values of the snapshot.
+func (sn *Snapshot) importValues(o SnapshotImportOptions) ([]Path, [][]byte, error) {
+	paths := make([]Path, 0, len(sn.Values))
+	values := make([][]byte, 0, len(sn.Values))
+	for _, sv := range sn.Values {
+		if sv.Masked {
+			continue
+		}
+		fq := sv.Path
+		if strings.HasSuffix(fq, sPathSeparator+EnvNamePlaceHolder) {
+			if o.EnvName == "" {
+				return nil, nil, errors.NotValid.Newf("[config] ImportSnapshot path %q requires an environment name", fq)
+			}
+			fq = fq[:len(fq)-len(EnvNamePlaceHolder)] + o.EnvName
+		}
+		var p Path
+		if err := p.Parse(fq); err != nil {
+			return nil, nil, errors.Wrapf(err, "[config] ImportSnapshot with path %q", sv.Path)
+		}
+		paths = append(paths, p)
+		values = append(values, []byte(sv.Value))
+	}
+	return paths, values, nil
+}
+
+// ImportSnapshot writes all unmasked values of the snapshot within one
+// transaction into the Storager. All paths get validated before writing. If
+// writing a value fails, the transaction gets rolled back and no value has been
+// written. The Storager must implement interface TxStorager, otherwise an error
+// with behaviour NotSupported gets returned. See ImportSnapshotBestEffort for
+// other Storagers.
+func ImportSnapshot(ctx context.Context, st Storager, sn *Snapshot, o SnapshotImportOptions) error {
+	tst, ok := st.(TxStorager)
+	if !ok {
+		return errors.NotSupported.Newf("[config] ImportSnapshot: Storager %T does not implement interface TxStorager", st)
+	}
+	paths, values, err := sn.importValues(o)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx, err := tst.BeginTx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[config] ImportSnapshot.BeginTx")
+	}
+	for i, p := range paths {
+		if err := tx.Set(p, values[i]); err != nil {
+			err = errors.Wrapf(err, "[config] ImportSnapshot.Set with path %q", p.String())
+			if errR := tx.Rollback(); errR != nil {
+				err = errors.Wrapf(err, "[config] ImportSnapshot.Rollback failed: %s", errR)
+			}
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "[config] ImportSnapshot.Commit")
+	}
+	return nil
+}
+
+// ImportSnapshotBestEffort writes all unmasked values of the snapshot into a
+// Storager which does not support transactions. All paths get validated before
+// writing. The import is not atomic: other readers can see a partially
+// imported snapshot. If writing a value fails, the previously written values
+// get restored on a best effort basis, a failed restore gets reported in the
+// returned error and leaves the Storager in a mixed state. A path which did not
+// exist before gets removed, if the Storager implements
+//		type deleter interface {
+//			Delete(Path) error
+//		}
+// otherwise its value gets set to nil. Prefer ImportSnapshot.
+func ImportSnapshotBestEffort(st Storager, sn *Snapshot, o SnapshotImportOptions) (err error) {
+	type deleter interface {
+		Delete(Path) error
+	}
+
+	paths, values, err := sn.importValues(o)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	type prevValue struct {
+		p     Path
+		v     []byte
+		found bool
+	}
+	prevValues := make([]prevValue, 0, len(paths))
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(prevValues) - 1; i >= 0; i-- {
+			pv := prevValues[i]
+			var errR error
+			switch d, ok := st.(deleter); {
+			case pv.found:
+				errR = st.Set(pv.p, pv.v)
+			case ok:
+				errR = d.Delete(pv.p)
+			default:
+				errR = st.Set(pv.p, nil)
+			}
+			if errR != nil {
+				err = errors.Wrapf(err, "[config] ImportSnapshotBestEffort rollback of path %q failed: %s", pv.p.String(), errR)
+			}
+		}
+	}()
+
+	for i, p := range paths {
+		v, found, err := st.Get(p)
+		if err != nil {
+			return errors.Wrapf(err, "[config] ImportSnapshotBestEffort.Get with path %q", p.String())
+		}
+		prevValues = append(prevValues, prevValue{p: p, v: v, found: found})
+		if err := st.Set(p, values[i]); err != nil {
+			return errors.Wrapf(err, "[config] ImportSnapshotBestEffort.Set with path %q", p.String())
+		}
+	}
+	return nil
+}
+
+// Kinds of a SnapshotDiff.
+const (
+	SnapshotDiffAdded   = "added"
+	SnapshotDiffRemoved = "removed"
+	SnapshotDiffChanged = "changed"
+)
+
+// SnapshotDiff describes the difference of a path between two snapshots.
+type SnapshotDiff struct {
+	Path string `json:"path" yaml:"path"`
+	// Kind one of the constants SnapshotDiff*.
+	Kind string `json:"kind" yaml:"kind"`
+	Old  string `json:"old,omitempty" yaml:"old,omitempty"`
+	New  string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// DiffSnapshots compares two snapshots and returns the differences sorted by
+// path. Masked values are only compared by their existence because their real
+// value is unknown.
+func DiffSnapshots(from, to *Snapshot) []SnapshotDiff {
+	fromValues := make(map[string]SnapshotValue, len(from.Values))
+	for _, sv := range from.Values {
+		fromValues[sv.Path] = sv
+	}
+
+	var diffs []SnapshotDiff
+	for _, tv := range to.Values {
+		fv, ok := fromValues[tv.Path]
+		delete(fromValues, tv.Path)
+		switch {
+		case !ok:
+			diffs = append(diffs, SnapshotDiff{Path: tv.Path, Kind: SnapshotDiffAdded, New: tv.Value})
+		case fv.Masked || tv.Masked:
+			// cannot compare
+		case fv.Value != tv.Value:
+			diffs = append(diffs, SnapshotDiff{Path: tv.Path, Kind: SnapshotDiffChanged, Old: fv.Value, New: tv.Value})
+		}
+	}
+	for _, fv := range fromValues {
+		diffs = append(diffs, SnapshotDiff{Path: fv.Path, Kind: SnapshotDiffRemoved, Old: fv.Value})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+// DiffSnapshot compares the snapshot `from` with the current values of the
+// Service. See DiffSnapshots.
+func (s *Service) DiffSnapshot(from *Snapshot, o SnapshotOptions) ([]SnapshotDiff, error) {
+	to, err := s.Snapshot(o)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return DiffSnapshots(from, to), nil
+}
@@ -0,0 +1,293 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/store/scope"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// failingTxStorage fails to write a route within a transaction.
+type failingTxStorage struct {
+	config.Storager
+	failRoute string
+}
+
+func (fs failingTxStorage) BeginTx(ctx context.Context) (config.StorageTx, error) {
+	tx, err := fs.Storager.(config.TxStorager).BeginTx(ctx)
+	return failingTx{StorageTx: tx, failRoute: fs.failRoute}, err
+}
+
+type failingTx struct {
+	config.StorageTx
+	failRoute string
+}
+
+func (ft failingTx) Set(p config.Path, v []byte) error {
+	if p.RouteHasPrefix(ft.failRoute) {
+		return errors.WriteFailed.Newf("failed to write %q", p.String())
+	}
+	return ft.StorageTx.Set(p, v)
+}
+
+type failingStorage struct {
+	config.Storager
+	failRoute string
+}
+
+func (fs failingStorage) Set(p config.Path, v []byte) error {
+	if p.RouteHasPrefix(fs.failRoute) {
+		return errors.WriteFailed.Newf("failed to write %q", p.String())
+	}
+	return fs.Storager.Set(p, v)
+}
+
+func (fs failingStorage) Delete(p config.Path) error {
+	return fs.Storager.(interface{ Delete(config.Path) error }).Delete(p)
+}
+
+func newSnapshotService(t *testing.T) *config.Service {
+	srv := config.MustNewService(storage.NewMap(
+		"default/0/web/unsecure/base_url", "http://example.com",
+		"websites/2/web/unsecure/base_url", "http://example.de",
+		"stores/3/web/secure/base_url", "https://example.ch",
+		"default/0/payment/paypal/api_key", "S3cr3t",
+		"default/0/web/cookie/domain/STAGING", "staging.example.com",
+	), config.Options{EnvName: "STAGING"},
+		config.WithFieldMeta(&config.FieldMeta{Route: "catalog/search/engine", Default: "mysql", DefaultValid: true}),
+	)
+	return srv
+}
+
+func TestService_Snapshot(t *testing.T) {
+	srv := newSnapshotService(t)
+
+	t.Run("all values", func(t *testing.T) {
+		sn, err := srv.Snapshot(config.SnapshotOptions{
+			MaskRoutes:   []string{"payment/paypal/api_key"},
+			WithDefaults: true,
+		})
+		assert.NoError(t, err)
+		assert.Exactly(t, "STAGING", sn.EnvName)
+		assert.Exactly(t, []config.SnapshotValue{
+			{Path: "default/0/catalog/search/engine", Value: "mysql"},
+			{Path: "default/0/payment/paypal/api_key", Value: config.SnapshotMaskedValue, Masked: true},
+			{Path: "default/0/web/cookie/domain/{CS_ENV}", Value: "staging.example.com"},
+			{Path: "default/0/web/unsecure/base_url", Value: "http://example.com"},
+			{Path: "stores/3/web/secure/base_url", Value: "https://example.ch"},
+			{Path: "websites/2/web/unsecure/base_url", Value: "http://example.de"},
+		}, sn.Values)
+	})
+
+	t.Run("filter scopes", func(t *testing.T) {
+		sn, err := srv.Snapshot(config.SnapshotOptions{
+			Scopes: scope.TypeIDs{scope.Website.WithID(2), scope.Store.WithID(3)},
+		})
+		assert.NoError(t, err)
+		assert.Exactly(t, []config.SnapshotValue{
+			{Path: "stores/3/web/secure/base_url", Value: "https://example.ch"},
+			{Path: "websites/2/web/unsecure/base_url", Value: "http://example.de"},
+		}, sn.Values)
+	})
+
+	t.Run("with Level1", func(t *testing.T) {
+		srv := config.MustNewService(storage.NewMap(
+			"default/0/web/unsecure/base_url", "http://example.com",
+		), config.Options{
+			Level1: storage.NewMap(
+				"default/0/web/unsecure/base_url", "http://file.example.com",
+				"websites/2/web/secure/base_url", "https://file.example.de",
+			),
+		},
+			config.WithFieldMeta(&config.FieldMeta{Route: "web/unsecure/base_url", Default: "http://default.com", DefaultValid: true}),
+			config.WithFieldMeta(&config.FieldMeta{Route: "catalog/search/engine", Default: "mysql", DefaultValid: true}),
+		)
+		sn, err := srv.Snapshot(config.SnapshotOptions{WithLevel1: true, WithDefaults: true})
+		assert.NoError(t, err)
+		assert.Exactly(t, []config.SnapshotValue{
+			{Path: "default/0/catalog/search/engine", Value: "mysql"},
+			{Path: "default/0/web/unsecure/base_url", Value: "http://file.example.com"},
+			{Path: "websites/2/web/secure/base_url", Value: "https://file.example.de"},
+		}, sn.Values)
+
+		sn, err = srv.Snapshot(config.SnapshotOptions{})
+		assert.NoError(t, err)
+		assert.Exactly(t, []config.SnapshotValue{
+			{Path: "default/0/web/unsecure/base_url", Value: "http://example.com"},
+		}, sn.Values)
+	})
+
+	t.Run("env name only as suffix of a route", func(t *testing.T) {
+		srv := config.MustNewService(storage.NewMap(
+			"default/0/web/cookie/domain/STAGING", "staging.example.com",
+			"default/0/web/cookie/path/x/STAGING", "/x",
+		), config.Options{EnvName: "STAGING"})
+		sn, err := srv.Snapshot(config.SnapshotOptions{})
+		assert.NoError(t, err)
+		assert.Exactly(t, []config.SnapshotValue{
+			{Path: "default/0/web/cookie/domain/{CS_ENV}", Value: "staging.example.com"},
+			{Path: "default/0/web/cookie/path/x/STAGING", Value: "/x"},
+		}, sn.Values)
+	})
+
+	t.Run("Level2 not iterable", func(t *testing.T) {
+		srv := config.MustNewService(failingStorage{Storager: storage.NewMap()}, config.Options{})
+		sn, err := srv.Snapshot(config.SnapshotOptions{})
+		assert.Nil(t, sn)
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+}
+
+func TestSnapshot_JSON(t *testing.T) {
+	srv := newSnapshotService(t)
+	sn, err := srv.Snapshot(config.SnapshotOptions{})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, sn.WriteJSON(&buf))
+
+	sn2, err := config.ReadSnapshotJSON(&buf)
+	assert.NoError(t, err)
+	assert.Exactly(t, sn, sn2)
+
+	sn3, err := config.ReadSnapshotJSON(bytes.NewBufferString(`{"values":[`))
+	assert.Nil(t, sn3)
+	assert.True(t, errors.CorruptData.Match(err), "%+v", err)
+}
+
+func TestImportSnapshot(t *testing.T) {
+	srcSrv := newSnapshotService(t)
+	sn, err := srcSrv.Snapshot(config.SnapshotOptions{MaskRoutes: []string{"payment/"}})
+	assert.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		dst := storage.NewMap("default/0/web/unsecure/base_url", "http://old.com")
+		assert.NoError(t, config.ImportSnapshot(context.Background(), dst, sn, config.SnapshotImportOptions{EnvName: "PRODUCTION"}))
+
+		dstSrv := config.MustNewService(dst, config.Options{EnvName: "PRODUCTION"})
+		diffs, err := dstSrv.DiffSnapshot(sn, config.SnapshotOptions{MaskRoutes: []string{"payment/"}})
+		assert.NoError(t, err)
+		assert.Exactly(t, []config.SnapshotDiff{
+			{Path: "default/0/payment/paypal/api_key", Kind: config.SnapshotDiffRemoved, Old: config.SnapshotMaskedValue},
+		}, diffs, "masked values are not imported")
+
+		v, ok, err := dst.Get(config.MustMakePath("web/cookie/domain/PRODUCTION"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Exactly(t, "staging.example.com", string(v))
+
+		_, ok, err = dst.Get(config.MustMakePath("payment/paypal/api_key"))
+		assert.NoError(t, err)
+		assert.False(t, ok, "masked value must not be imported")
+	})
+
+	t.Run("missing env name", func(t *testing.T) {
+		dst := storage.NewMap()
+		err := config.ImportSnapshot(context.Background(), dst, sn, config.SnapshotImportOptions{})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+
+	t.Run("invalid path writes nothing", func(t *testing.T) {
+		dst := storage.NewMap()
+		err := config.ImportSnapshot(context.Background(), dst, &config.Snapshot{Values: []config.SnapshotValue{
+			{Path: "default/0/web/unsecure/base_url", Value: "http://example.com"},
+			{Path: "default/0/web", Value: "x"},
+		}}, config.SnapshotImportOptions{})
+		assert.Error(t, err)
+		_, ok, err := dst.Get(config.MustMakePath("web/unsecure/base_url"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		m := storage.NewMap("default/0/web/unsecure/base_url", "http://old.com")
+		dst := failingTxStorage{Storager: m, failRoute: "web/unsecure"}
+		err := config.ImportSnapshot(context.Background(), dst, sn, config.SnapshotImportOptions{EnvName: "PRODUCTION"})
+		assert.True(t, errors.WriteFailed.Match(err), "%+v", err)
+
+		v, ok, err := m.Get(config.MustMakePath("web/unsecure/base_url"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Exactly(t, "http://old.com", string(v))
+
+		_, ok, err = m.Get(config.MustMakePath("web/cookie/domain/PRODUCTION"))
+		assert.NoError(t, err)
+		assert.False(t, ok, "no value must be written")
+	})
+
+	t.Run("without transactions", func(t *testing.T) {
+		dst := failingStorage{Storager: storage.NewMap()}
+		err := config.ImportSnapshot(context.Background(), dst, sn, config.SnapshotImportOptions{EnvName: "PRODUCTION"})
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+}
+
+func TestImportSnapshotBestEffort(t *testing.T) {
+	srcSrv := newSnapshotService(t)
+	sn, err := srcSrv.Snapshot(config.SnapshotOptions{MaskRoutes: []string{"payment/"}})
+	assert.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		dst := failingStorage{Storager: storage.NewMap()}
+		assert.NoError(t, config.ImportSnapshotBestEffort(dst, sn, config.SnapshotImportOptions{EnvName: "PRODUCTION"}))
+		v, ok, err := dst.Get(config.MustMakePath("web/cookie/domain/PRODUCTION"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Exactly(t, "staging.example.com", string(v))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		m := storage.NewMap("default/0/web/unsecure/base_url", "http://old.com")
+		dst := failingStorage{Storager: m, failRoute: "web/unsecure"}
+		err := config.ImportSnapshotBestEffort(dst, sn, config.SnapshotImportOptions{EnvName: "PRODUCTION"})
+		assert.True(t, errors.WriteFailed.Match(err), "%+v", err)
+
+		v, ok, err := m.Get(config.MustMakePath("web/unsecure/base_url"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Exactly(t, "http://old.com", string(v))
+
+		_, ok, err = m.Get(config.MustMakePath("web/cookie/domain/PRODUCTION"))
+		assert.NoError(t, err)
+		assert.False(t, ok, "previously imported path must be removed")
+	})
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &config.Snapshot{Values: []config.SnapshotValue{
+		{Path: "default/0/aa/bb/cc", Value: "1"},
+		{Path: "default/0/aa/bb/dd", Value: "2"},
+		{Path: "default/0/aa/bb/ee", Value: config.SnapshotMaskedValue, Masked: true},
+		{Path: "default/0/aa/bb/ff", Value: "4"},
+	}}
+	to := &config.Snapshot{Values: []config.SnapshotValue{
+		{Path: "default/0/aa/bb/cc", Value: "1"},
+		{Path: "default/0/aa/bb/dd", Value: "22"},
+		{Path: "default/0/aa/bb/ee", Value: "secret"},
+		{Path: "stores/1/aa/bb/cc", Value: "5"},
+	}}
+	assert.Exactly(t, []config.SnapshotDiff{
+		{Path: "default/0/aa/bb/dd", Kind: config.SnapshotDiffChanged, Old: "2", New: "22"},
+		{Path: "default/0/aa/bb/ff", Kind: config.SnapshotDiffRemoved, Old: "4"},
+		{Path: "stores/1/aa/bb/cc", Kind: config.SnapshotDiffAdded, New: "5"},
+	}, config.DiffSnapshots(from, to))
+}
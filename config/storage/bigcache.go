@@ -64,3 +64,11 @@ func (s *bcStorage) Get(p config.Path) (v []byte, found bool, err error) {
 
 	return val, true, nil
 }
+
+// Delete removes a path from the cache.
+func (s *bcStorage) Delete(p config.Path) error {
+	if err := s.bc.Delete(p.String()); err != nil && err != bigcache.ErrEntryNotFound {
+		return err
+	}
+	return nil
+}
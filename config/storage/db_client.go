@@ -67,8 +67,10 @@ type dbStats struct {
 // Service connects the MySQL/MariaDB with the config.Service type. Implements
 // interface config.Storager.
 type DB struct {
-	cfg DBOptions
+	cfg  DBOptions
+	tbls *ddl.Tables
 
+	sqlAll   *dml.Select
 	sqlRead  *dml.Select
 	sqlWrite *dml.Insert
 
@@ -125,7 +127,7 @@ func NewDB(tbls *ddl.Tables, o DBOptions) (*DB, error) {
 		return nil, errors.WithStack(err)
 	}
 
-	qryAll := tbl.Select("scope", "scope_id", "path").OrderBy("scope", "scope_id", "path")
+	qryAll := tbl.Select("scope", "scope_id", "path", "value").OrderBy("scope", "scope_id", "path")
 	qryAll.Log = o.Log
 
 	qryRead := tbl.Select("value").Where(
@@ -141,7 +143,9 @@ func NewDB(tbls *ddl.Tables, o DBOptions) (*DB, error) {
 
 	dbs := &DB{
 		cfg:              o,
+		tbls:             tbls,
 		tickerDaemonStop: make(chan struct{}),
+		sqlAll:           qryAll,
 		sqlRead:          qryRead,
 		sqlWrite:         qryWrite,
 	}
@@ -253,8 +257,7 @@ func (dbs *DB) Set(p config.Path, value []byte) error {
 
 	ctx, cancel := context.WithTimeout(ctx, dbs.cfg.ContextTimeoutWrite)
 	defer cancel()
-	scp, path := p.ScopeRoute()
-	res, err := dbs.stmtWrite.Uint64(scp.ToUint64()).String(path).Bytes(value).ExecContext(ctx)
+	res, err := dbs.stmtWrite.ExecContext(ctx, writeArgs(p, value)...)
 	dbs.stmtWrite.Reset()
 	if dbs.cfg.Log != nil && dbs.cfg.Log.IsDebug() {
 		li, err1 := res.LastInsertId()
@@ -273,6 +276,51 @@ func (dbs *DB) Set(p config.Path, value []byte) error {
 	return err
 }
 
+// writeArgs returns the arguments for the columns scope, scope_id, path and
+// value of the write statement.
+func writeArgs(p config.Path, value []byte) []interface{} {
+	scp, path := p.ScopeRoute()
+	s, id := scp.Unpack()
+	return []interface{}{s.StrType(), uint(id), path, value}
+}
+
+// BeginTx implements config.TxStorager. The returned transaction writes with
+// its own statement and does not use the prepared statements of the DB.
+func (dbs *DB) BeginTx(ctx context.Context) (config.StorageTx, error) {
+	tx, err := dbs.tbls.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &dbTx{
+		ctx:  ctx,
+		tx:   tx,
+		stmt: tx.WithQueryBuilder(dbs.sqlWrite),
+	}, nil
+}
+
+// dbTx writes values within a database transaction.
+type dbTx struct {
+	ctx  context.Context
+	tx   *dml.Tx
+	stmt *dml.DBR
+}
+
+// Set implements config.StorageTx.
+func (t *dbTx) Set(p config.Path, value []byte) error {
+	_, err := t.stmt.ExecContext(t.ctx, writeArgs(p, value)...)
+	return errors.Wrapf(err, "[config/storage] DB.Tx.Set with path %q", p.String())
+}
+
+// Commit implements config.StorageTx.
+func (t *dbTx) Commit() error {
+	return errors.WithStack(t.tx.Commit())
+}
+
+// Rollback implements config.StorageTx.
+func (t *dbTx) Rollback() error {
+	return errors.WithStack(t.tx.Rollback())
+}
+
 // Get performs a read operation from the database and returns a value from
 // the table. The `ok` return argument can be true even if byte slice `v` is
 // nil, which means that the path and scope are stored in the database table.
@@ -305,7 +353,7 @@ func (dbs *DB) Get(p config.Path) (v []byte, ok bool, err error) {
 	defer cancel()
 	scp, path := p.ScopeRoute()
 	s, id := scp.Unpack()
-	nv, found, err := dbs.stmtRead.String(s.StrType()).Uint(uint(id)).String(path).LoadNullString(ctx)
+	nv, found, err := dbs.stmtRead.LoadNullString(ctx, s.StrType(), uint(id), path)
 	defer dbs.stmtRead.Reset()
 	if err != nil {
 		return nil, false, errors.Wrapf(err, "[config/storage] DB Scope %q Path %q", scp.String(), path)
@@ -320,6 +368,29 @@ func (dbs *DB) Get(p config.Path) (v []byte, ok bool, err error) {
 	return ret, true, nil
 }
 
+// Iterate implements config.StorageIterator and loads all rows of the table
+// ordered by scope, scope_id and path.
+func (dbs *DB) Iterate(fn func(p config.Path, v []byte) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbs.cfg.ContextTimeoutRead)
+	defer cancel()
+	return dbs.sqlAll.WithDBR().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		var ccd CoreConfiguration
+		if err := ccd.MapColumns(cm); err != nil {
+			return errors.Wrapf(err, "[config/storage] DB.Iterate at row %d", cm.Count)
+		}
+		scp := scope.FromString(ccd.Scope).WithID(uint32(ccd.ScopeID))
+		p, err := config.MakePathWithScope(scp, ccd.Path)
+		if err != nil {
+			return errors.Wrapf(err, "[config/storage] DB.Iterate Path %q Scope: %q", ccd.Path, scp)
+		}
+		var v []byte
+		if ccd.Value.Valid {
+			v = []byte(ccd.Value.Data)
+		}
+		return fn(p, v)
+	})
+}
+
 // Statistics returns live statistics about opening and closing prepared statements.
 func (dbs *DB) Statistics() (value dbStats, set dbStats) {
 	dbs.muRead.Lock()
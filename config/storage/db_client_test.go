@@ -33,7 +33,10 @@ import (
 	"github.com/fortytw2/leaktest"
 )
 
-var _ config.Storager = (*storage.DB)(nil)
+var (
+	_ config.Storager   = (*storage.DB)(nil)
+	_ config.TxStorager = (*storage.DB)(nil)
+)
 
 func mustNewTables(ctx context.Context, opts ...ddl.TableOption) (tm *ddl.Tables) {
 	t, err := storage.NewTables(ctx, opts...)
@@ -218,8 +221,9 @@ func TestService_Set(t *testing.T) {
 				prepIns = dbMock.ExpectPrepare(dmltest.SQLMockQuoteMeta("INSERT INTO `core_configuration` (`scope`,`scope_id`,`path`,`value`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`)"))
 			}
 
+			scp, sID := test.scopeID.Unpack()
 			prepIns.ExpectExec().
-				WithArgs(test.scopeID, test.path, test.value).
+				WithArgs(scp.StrType(), sID, test.path, test.value).
 				WillReturnResult(sqlmock.NewResult(j, 0))
 			assert.NoError(t, dbs.Set(config.MustMakePathWithScope(test.scopeID, test.path), test.value))
 
@@ -291,8 +295,9 @@ func TestService_Set(t *testing.T) {
 		prepIns := dbMock.ExpectPrepare(dmltest.SQLMockQuoteMeta("INSERT INTO `core_configuration` (`scope`,`scope_id`,`path`,`value`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`)"))
 		for i, test := range serviceMultiTests {
 
+			scp, sID := test.scopeID.Unpack()
 			prepIns.ExpectExec().
-				WithArgs(test.scopeID, test.path, test.value).
+				WithArgs(scp.StrType(), sID, test.path, test.value).
 				WillDelayFor(time.Millisecond * 110).
 				WillReturnResult(sqlmock.NewResult(int64(i), 0))
 			haveErr := dbs.Set(config.MustMakePathWithScope(test.scopeID, test.path), test.value)
@@ -344,3 +349,50 @@ func Test_WithCoreConfigData(t *testing.T) {
 	assert.True(t, ok)
 	assert.Exactly(t, "{{unsecure_base_url}}skin/", v)
 }
+
+func TestDB_BeginTx(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery("SELECT.+FROM information_schema.COLUMNS").WithArgs().WillReturnRows(
+		dmltest.MustMockRows(dmltest.WithFile("testdata", "core_configuration_columns.csv")),
+	)
+	dbs, err := storage.NewDB(mustNewTables(context.TODO(), ddl.WithConnPool(dbc)), storage.DBOptions{
+		SkipSchemaValidation: true,
+	})
+	assert.NoError(t, err)
+	defer dmltest.Close(t, dbs)
+
+	const insertSQL = "INSERT INTO `core_configuration` (`scope`,`scope_id`,`path`,`value`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`)"
+
+	t.Run("commit", func(t *testing.T) {
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(insertSQL)).
+			WithArgs("websites", 10, "testService/secure/base_url", []byte("http://corestore.io")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(insertSQL)).
+			WithArgs("stores", 9, "testService/log/active", []byte("1")).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		dbMock.ExpectCommit()
+
+		tx, err := dbs.BeginTx(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Set(config.MustMakePathWithScope(scope.Website.WithID(10), "testService/secure/base_url"), []byte("http://corestore.io")))
+		assert.NoError(t, tx.Set(config.MustMakePathWithScope(scope.Store.WithID(9), "testService/log/active"), []byte("1")))
+		assert.NoError(t, tx.Commit())
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(insertSQL)).
+			WithArgs("default", 0, "testService/checkout/multishipping", []byte("false")).
+			WillReturnError(errors.ConnectionFailed.Newf("Upsss"))
+		dbMock.ExpectRollback()
+
+		tx, err := dbs.BeginTx(context.Background())
+		assert.NoError(t, err)
+		err = tx.Set(config.MustMakePath("testService/checkout/multishipping"), []byte("false"))
+		assert.True(t, errors.ConnectionFailed.Match(err), "%+v", err)
+		assert.NoError(t, tx.Rollback())
+	})
+}
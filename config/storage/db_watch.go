@@ -0,0 +1,272 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/store/scope"
+	"github.com/weiwolves/pkg/util/conv"
+)
+
+// DBWatchOptions applies options to the WatchDB function.
+type DBWatchOptions struct {
+	// TableName if set, specifies the alternate table name, default:
+	// `core_configuration` aka constant TableNameCoreConfiguration.
+	TableName string
+	Log       log.Logger
+	// PollInterval defines the duration between two queries. Default 5s.
+	PollInterval time.Duration
+	// ContextTimeoutRead default 10s.
+	ContextTimeoutRead time.Duration
+	// CommitLag defines how far each poll reaches back before the latest
+	// seen `version_ts`. A transaction gets its timestamp at the start but
+	// becomes visible at the commit, hence its rows can appear after rows with
+	// a later timestamp. Rows of transactions which commit later than the
+	// CommitLag get missed. Default 1m.
+	CommitLag time.Duration
+}
+
+// dbWatchKey identifies a row version which has already been notified.
+type dbWatchKey struct {
+	scope     string
+	scopeID   int32
+	path      string
+	versionTS int64
+}
+
+// WatchDB polls the table core_configuration for rows which have been changed
+// since the last poll. The system versioning column `version_ts` detects the
+// changes. Each poll queries the rows since the latest seen `version_ts` minus
+// the CommitLag and skips the rows which have already been notified, so rows
+// with the same timestamp or rows which commit late do not get lost. Each
+// changed row gets forwarded once to the Notifier, usually the
+// *config.Service, which updates its Level1 cache and informs its subscribers.
+// Deleted rows cannot be detected via polling, use NewDBBinlogHandler for that
+// purpose. WatchDB blocks until the context gets canceled or a query fails. Run
+// it in its own goroutine.
+func WatchDB(ctx context.Context, tbls *ddl.Tables, n config.Notifier, o DBWatchOptions) error {
+	tn := o.TableName
+	if tn == "" {
+		tn = TableNameCoreConfiguration
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = time.Second * 5 // just a guess
+	}
+	if o.ContextTimeoutRead == 0 {
+		o.ContextTimeoutRead = time.Second * 10 // just a guess
+	}
+	if o.CommitLag == 0 {
+		o.CommitLag = time.Minute // just a guess
+	}
+
+	tbl, err := tbls.Table(tn)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	qryLast := tbl.Select("version_ts").OrderByDesc("version_ts").Limit(0, 1)
+	qryLast.Log = o.Log
+	qryChanged := tbl.Select("scope", "scope_id", "path", "value", "version_ts").Where(
+		dml.Column("version_ts").GreaterOrEqual().PlaceHolder(),
+	).OrderBy("version_ts")
+	qryChanged.Log = o.Log
+
+	ctxLast, cancel := context.WithTimeout(ctx, o.ContextTimeoutRead)
+	lastTS, _, err := qryLast.WithDBR().LoadNullTime(ctxLast)
+	cancel()
+	if err != nil {
+		return errors.Wrapf(err, "[config/storage] WatchDB.LoadNullTime from table %q", tn)
+	}
+	if !lastTS.Valid {
+		lastTS = lastTS.SetValid(time.Unix(0, 0)) // empty table
+	}
+	// The rows up to lastTS are already known to the caller, the rows within
+	// the CommitLag get notified once more with the first poll.
+	seen := make(map[dbWatchKey]struct{})
+
+	ticker := time.NewTicker(o.PollInterval)
+	defer ticker.Stop()
+	dbr := qryChanged.WithDBR()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			ctxPoll, cancel := context.WithTimeout(ctx, o.ContextTimeoutRead)
+			err := dbr.IterateSerial(ctxPoll, func(cm *dml.ColumnMap) error {
+				var ccd CoreConfiguration
+				if err := ccd.MapColumns(cm); err != nil {
+					return errors.Wrapf(err, "[config/storage] WatchDB.IterateSerial at row %d", cm.Count)
+				}
+				key := dbWatchKey{scope: ccd.Scope, scopeID: ccd.ScopeID, path: ccd.Path, versionTS: ccd.VersionTs.UnixNano()}
+				if _, ok := seen[key]; ok {
+					return nil
+				}
+				var v []byte
+				if ccd.Value.Valid {
+					v = []byte(ccd.Value.Data)
+				}
+				scp := scope.FromString(ccd.Scope).WithID(uint32(ccd.ScopeID))
+				p, err := config.MakePathWithScope(scp, ccd.Path)
+				if err != nil {
+					return errors.Wrapf(err, "[config/storage] WatchDB.config.MakePathWithScope Path %q Scope: %q", ccd.Path, scp)
+				}
+				if err := n.Notify(p, v, false); err != nil {
+					return errors.Wrapf(err, "[config/storage] WatchDB.Notify Path %q", p.String())
+				}
+				seen[key] = struct{}{}
+				if ccd.VersionTs.After(lastTS.Time) {
+					lastTS = lastTS.SetValid(ccd.VersionTs)
+				}
+				return nil
+			}, lastTS.Time.Add(-o.CommitLag))
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				return errors.WithStack(err)
+			}
+			minTS := lastTS.Time.Add(-o.CommitLag).UnixNano()
+			for key := range seen {
+				if key.versionTS < minTS {
+					delete(seen, key)
+				}
+			}
+		}
+	}
+}
+
+// The row event actions as sent by package sql/mycanal.
+const (
+	binlogActionInsert = "insert"
+	binlogActionUpdate = "update"
+	binlogActionDelete = "delete"
+)
+
+// DBBinlogHandler has the same method set as mycanal.RowsEventHandler. It is
+// declared here to avoid a dependency on package sql/mycanal, which depends on
+// package config.
+type DBBinlogHandler interface {
+	Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error
+	Complete(context.Context) error
+	String() string
+}
+
+// dbBinlogHandler receives row events for the table core_configuration from
+// the binary log.
+type dbBinlogHandler struct {
+	n config.Notifier
+}
+
+// NewDBBinlogHandler creates a new mycanal.RowsEventHandler which forwards all
+// INSERT, UPDATE and DELETE statements on the table core_configuration to the
+// Notifier, usually the *config.Service. In contrast to WatchDB, deleted rows
+// are also detected. Register the handler with the table name of the
+// core_configuration table:
+//		c.RegisterRowsEventHandler([]string{storage.TableNameCoreConfiguration}, storage.NewDBBinlogHandler(cfgSrv))
+func NewDBBinlogHandler(n config.Notifier) DBBinlogHandler {
+	return dbBinlogHandler{n: n}
+}
+
+// Do implements mycanal.RowsEventHandler.
+func (h dbBinlogHandler) Do(_ context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	idxScope, idxScopeID, idxPath, idxValue := -1, -1, -1, -1
+	for i, c := range t.Columns {
+		switch c.Field {
+		case "scope":
+			idxScope = i
+		case "scope_id":
+			idxScopeID = i
+		case "path":
+			idxPath = i
+		case "value":
+			idxValue = i
+		}
+	}
+	if idxScope < 0 || idxScopeID < 0 || idxPath < 0 || idxValue < 0 {
+		return errors.NotFound.Newf("[config/storage] DBBinlogHandler table %q misses one of the columns scope, scope_id, path or value", t.Name)
+	}
+
+	toPath := func(row []interface{}) (config.Path, []byte, error) {
+		if len(row) <= idxValue || len(row) <= idxPath {
+			return config.Path{}, nil, errors.OutOfRange.Newf("[config/storage] DBBinlogHandler row has not enough columns: %d", len(row))
+		}
+		scpStr, err := conv.ToStringE(row[idxScope])
+		if err != nil {
+			return config.Path{}, nil, errors.WithStack(err)
+		}
+		scpID, err := conv.ToInt64E(row[idxScopeID])
+		if err != nil {
+			return config.Path{}, nil, errors.WithStack(err)
+		}
+		route, err := conv.ToStringE(row[idxPath])
+		if err != nil {
+			return config.Path{}, nil, errors.WithStack(err)
+		}
+		v, err := conv.ToByteE(row[idxValue])
+		if err != nil {
+			return config.Path{}, nil, errors.WithStack(err)
+		}
+		p, err := config.MakePathWithScope(scope.FromString(scpStr).WithID(uint32(scpID)), route)
+		return p, v, errors.WithStack(err)
+	}
+
+	switch action {
+	case binlogActionInsert, binlogActionDelete:
+		for _, row := range rows {
+			p, v, err := toPath(row)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := h.n.Notify(p, v, action == binlogActionDelete); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case binlogActionUpdate:
+		// rows contains pairs of [before update row, after update row]
+		for i := 1; i < len(rows); i += 2 {
+			pBefore, _, err := toPath(rows[i-1])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			p, v, err := toPath(rows[i])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if pBefore.String() != p.String() {
+				if err := h.n.Notify(pBefore, nil, true); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			if err := h.n.Notify(p, v, false); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Complete implements mycanal.RowsEventHandler.
+func (h dbBinlogHandler) Complete(context.Context) error { return nil }
+
+// String implements mycanal.RowsEventHandler.
+func (h dbBinlogHandler) String() string { return "config/storage.DBBinlogHandler" }
@@ -0,0 +1,155 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storage_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+var _ mycanal.RowsEventHandler = storage.NewDBBinlogHandler(nil)
+
+type notifyRecorder struct {
+	mu      sync.Mutex
+	paths   []string
+	values  []string
+	deleted []bool
+	// cancel gets called after cancelAfter notifications, if set.
+	cancel      context.CancelFunc
+	cancelAfter int
+}
+
+func (nr *notifyRecorder) Notify(p config.Path, v []byte, deleted bool) error {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	nr.paths = append(nr.paths, p.String())
+	nr.values = append(nr.values, string(v))
+	nr.deleted = append(nr.deleted, deleted)
+	if nr.cancel != nil && len(nr.paths) == nr.cancelAfter {
+		nr.cancel()
+	}
+	return nil
+}
+
+func TestNewDBBinlogHandler(t *testing.T) {
+	tbl := ddl.NewTable(storage.TableNameCoreConfiguration,
+		&ddl.Column{Field: "id"},
+		&ddl.Column{Field: "scope"},
+		&ddl.Column{Field: "scope_id"},
+		&ddl.Column{Field: "expires"},
+		&ddl.Column{Field: "path"},
+		&ddl.Column{Field: "value"},
+	)
+	ctx := context.Background()
+
+	t.Run("insert and delete", func(t *testing.T) {
+		nr := new(notifyRecorder)
+		h := storage.NewDBBinlogHandler(nr)
+		assert.NoError(t, h.Do(ctx, mycanal.InsertAction, tbl, [][]interface{}{
+			{int64(1), "websites", int32(2), nil, "aa/bb/cc", []byte(`v1`)},
+		}))
+		assert.NoError(t, h.Do(ctx, mycanal.DeleteAction, tbl, [][]interface{}{
+			{int64(2), "default", int32(0), nil, "aa/bb/dd", "v2"},
+		}))
+		assert.Exactly(t, []string{"websites/2/aa/bb/cc", "default/0/aa/bb/dd"}, nr.paths)
+		assert.Exactly(t, []string{"v1", "v2"}, nr.values)
+		assert.Exactly(t, []bool{false, true}, nr.deleted)
+	})
+
+	t.Run("update with changed path", func(t *testing.T) {
+		nr := new(notifyRecorder)
+		h := storage.NewDBBinlogHandler(nr)
+		assert.NoError(t, h.Do(ctx, mycanal.UpdateAction, tbl, [][]interface{}{
+			{int64(1), "stores", int32(2), nil, "aa/bb/cc", "old"},
+			{int64(1), "stores", int32(2), nil, "aa/bb/ee", "new"},
+		}))
+		assert.Exactly(t, []string{"stores/2/aa/bb/cc", "stores/2/aa/bb/ee"}, nr.paths)
+		assert.Exactly(t, []bool{true, false}, nr.deleted)
+	})
+}
+
+func TestWatchDB(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	ts := time.Date(2020, 3, 12, 10, 0, 0, 0, time.UTC)
+	lag := time.Second
+	cols := []string{"scope", "scope_id", "path", "value", "version_ts"}
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `version_ts` FROM `core_configuration`")).
+		WillReturnRows(sqlmock.NewRows([]string{"version_ts"}).AddRow(ts))
+	// first poll: the row at ts has been known before, the row at ts+1s is new.
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `scope`, `scope_id`, `path`, `value`, `version_ts` FROM `core_configuration` AS `main_table` WHERE (`version_ts` >= ?) ORDER BY `version_ts`")).
+		WithArgs(ts.Add(-lag)).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("default", 0, "aa/bb/cc", "v1", ts).
+			AddRow("websites", 2, "aa/bb/cc", "v2", ts.Add(time.Second)),
+		)
+	// second poll: a late committed row shares the timestamp of an already
+	// notified row and another one has an earlier timestamp.
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `scope`, `scope_id`, `path`, `value`, `version_ts` FROM `core_configuration` AS `main_table` WHERE (`version_ts` >= ?) ORDER BY `version_ts`")).
+		WithArgs(ts).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("default", 0, "aa/bb/cc", "v1", ts).
+			AddRow("stores", 3, "aa/bb/dd", "v4", ts.Add(500*time.Millisecond)).
+			AddRow("websites", 2, "aa/bb/cc", "v2", ts.Add(time.Second)).
+			AddRow("default", 0, "aa/bb/ee", "v3", ts.Add(time.Second)),
+		)
+
+	tbls, err := ddl.NewTables(ddl.WithConnPool(dbc), ddl.WithTable(storage.TableNameCoreConfiguration,
+		&ddl.Column{Field: "id", Key: "PRI"},
+		&ddl.Column{Field: "scope"},
+		&ddl.Column{Field: "scope_id"},
+		&ddl.Column{Field: "path"},
+		&ddl.Column{Field: "value"},
+		&ddl.Column{Field: "version_ts"},
+	))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nr := &notifyRecorder{cancel: cancel, cancelAfter: 4}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- storage.WatchDB(ctx, tbls, nr, storage.DBWatchOptions{
+			PollInterval: 10 * time.Millisecond,
+			CommitLag:    lag,
+		})
+	}()
+
+	select {
+	case err := <-errC:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchDB has not been stopped")
+	}
+
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+	assert.Exactly(t, []string{"default/0/aa/bb/cc", "websites/2/aa/bb/cc", "stores/3/aa/bb/dd", "default/0/aa/bb/ee"}, nr.paths)
+	assert.Exactly(t, []string{"v1", "v2", "v4", "v3"}, nr.values)
+}
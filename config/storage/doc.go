@@ -17,6 +17,10 @@
 //
 // Use Go build tags to enable special storage clients or file format loading
 // functions. Supported tags are: bigcache (store in big cache), db (store in
-// MySQL/MariaDB), etcdv3 (store in etcd cluster/server), load from json and
-// yaml.
+// MySQL/MariaDB), etcdv3 (store in etcd cluster/server), load from json,
+// yaml, toml and hcl.
+//
+// Changes written by other nodes directly into etcd or into the
+// core_configuration table can be streamed into a config.Service via
+// WatchEtcdv3, WatchDB or the binlog based NewDBBinlogHandler.
 package storage
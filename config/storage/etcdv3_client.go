@@ -178,6 +178,88 @@ func (cm Etcdv3FakeClient) Do(ctx context.Context, op clientv3.Op) (clientv3.OpR
 
 func (cm Etcdv3FakeClient) Txn(ctx context.Context) clientv3.Txn { return nil }
 
+// Etcdv3FakeWatcher implementation for testing purposes. Function Watch
+// returns the channel WatchChan.
+type Etcdv3FakeWatcher struct {
+	WatchChan clientv3.WatchChan
+	CloseErr  error
+}
+
+func (fw Etcdv3FakeWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	return fw.WatchChan
+}
+
+func (fw Etcdv3FakeWatcher) Close() error { return fw.CloseErr }
+
+// WatchEtcdv3 listens for changes below the current or configured etcd key
+// prefix and forwards each PUT or DELETE event to the Notifier, usually the
+// *config.Service, which updates its Level1 cache and informs its subscribers.
+// Changes written by other nodes directly into etcd are hence visible without
+// a hot reload. WatchEtcdv3 blocks until the context gets canceled or the watch
+// fails. A compacted revision restarts the watch from the compacted revision.
+// Run it in its own goroutine.
+func WatchEtcdv3(ctx context.Context, w clientv3.Watcher, n config.Notifier, o Etcdv3Options) error {
+	if o.KeyPrefix == "" {
+		o.KeyPrefix = Etcdv3DefaultKeyPrefix
+	}
+
+	var rev int64
+	for {
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		wctx, cancel := context.WithCancel(ctx)
+		nextRev, err := etcdv3Watch(wctx, w.Watch(wctx, o.KeyPrefix, opts...), n, o.KeyPrefix)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return errors.WithStack(err)
+		case nextRev == 0:
+			return nil // channel has been closed
+		}
+		rev = nextRev
+	}
+}
+
+// etcdv3Watch processes the watch channel. It returns the compacted revision
+// if the watch must be restarted.
+func etcdv3Watch(ctx context.Context, wc clientv3.WatchChan, n config.Notifier, keyPrefix string) (compactRev int64, _ error) {
+	var p config.Path
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, nil
+		case wr, ok := <-wc:
+			if !ok {
+				return 0, nil
+			}
+			if wr.CompactRevision > 0 {
+				return wr.CompactRevision, nil
+			}
+			if err := wr.Err(); err != nil {
+				return 0, errors.Wrap(err, "[storage/etcdv3] WatchResponse")
+			}
+			for _, ev := range wr.Events {
+				if ev.Kv == nil {
+					continue
+				}
+				key := strings.TrimPrefix(string(ev.Kv.Key), keyPrefix)
+				if err := p.Parse(key); err != nil {
+					return 0, errors.Wrapf(err, "[storage/etcdv3] Watch with key %q", ev.Kv.Key)
+				}
+				isDeleted := ev.Type == mvccpb.DELETE
+				if err := n.Notify(p, ev.Kv.Value, isDeleted); err != nil {
+					return 0, errors.Wrapf(err, "[storage/etcdv3] Watch.Notify with Path %q", p.String())
+				}
+				p.Reset()
+			}
+		}
+	}
+}
+
 // WithLoadFromEtcdv3 reads the all keys and their values with the current or configured
 // etcd key prefix and applies it to the config.service. This function option
 // can be set when creating a new config.service or updating its internal DB.
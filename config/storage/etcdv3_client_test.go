@@ -210,3 +210,46 @@ func TestWithLoadData_Success(t *testing.T) {
 	assert.Exactly(t, `"46aaccbebf47d8f8fce8c02d621aa573"`, cfgSrv.Get(p.BindStore(1)).String())
 	assert.Exactly(t, `"e30d8df9810bc36105c96ad3ae76ffd3"`, cfgSrv.Get(p.BindDefault()).String())
 }
+
+func TestWatchEtcdv3(t *testing.T) {
+	l1 := NewMap()
+	cfgSrv := config.MustNewService(NewMap(), config.Options{
+		Level1: l1,
+	})
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	p := config.MustMakePathWithScope(scope.Website.WithID(2), "payment/datatr/sha1")
+	assert.NoError(t, l1.Set(p.BindStore(1), []byte(`old`)))
+
+	wc := make(chan clientv3.WatchResponse, 1)
+	wc <- clientv3.WatchResponse{
+		Events: []*clientv3.Event{
+			{
+				Type: mvccpb.PUT,
+				Kv: &mvccpb.KeyValue{
+					Key:   []byte(Etcdv3DefaultKeyPrefix + `websites/2/payment/datatr/sha1`),
+					Value: []byte(`fc9d6fd2d8db223be4a7484a8619f26b`),
+				},
+			},
+			{
+				Type: mvccpb.DELETE,
+				Kv: &mvccpb.KeyValue{
+					Key: []byte(Etcdv3DefaultKeyPrefix + `stores/1/payment/datatr/sha1`),
+				},
+			},
+		},
+	}
+	close(wc)
+
+	err := WatchEtcdv3(context.Background(), Etcdv3FakeWatcher{WatchChan: wc}, cfgSrv, Etcdv3Options{})
+	assert.NoError(t, err)
+
+	v, ok, err := l1.Get(p)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Exactly(t, `fc9d6fd2d8db223be4a7484a8619f26b`, string(v))
+
+	_, ok, err = l1.Get(p.BindStore(1))
+	assert.NoError(t, err)
+	assert.False(t, ok, "Path should be deleted from the Level1 storage")
+}
@@ -0,0 +1,90 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall hcl
+
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/corestoreio/errors"
+	"github.com/hashicorp/hcl"
+	"github.com/weiwolves/pkg/config"
+)
+
+// WithLoadHCL reads the configuration values from a HCL file, as known from
+// Terraform, and applies it to the config.service. "testdata/example.hcl"
+// provides an example HCL file. Scope IDs must be quoted:
+//		"web/unsecure/base_url" {
+//			default { "0" = "http://eshop.dev/" }
+//			stores  { "2" = "http://eshop.dev/de-de/" }
+//		}
+// Loads all data into RAM before processing it.
+func WithLoadHCL(opts ...option) config.LoadDataOption {
+	return config.MakeLoadDataOption(func(s *config.Service) (err error) {
+		for i := 0; i < len(opts) && err == nil; i++ {
+			err = opts[i](s, loadHCL)
+		}
+		return
+	}).WithUseStorageLevel(1)
+}
+
+func decodeHCL(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.ReadFailed.New(err, "[config/storage] HCL.ReadAll")
+	}
+	return hcl.Decode(v, string(data))
+}
+
+func loadHCL(s config.Setter, r io.Reader) error {
+	var hd map[string]map[string]interface{}
+	if err := decodeHCL(r, &hd); err != nil {
+		return errors.CorruptData.New(err, "[config/storage] HCL.Decode")
+	}
+	return errors.WithStack(setScopedMap(s, hd, "[config/storage] WithLoadHCL"))
+}
+
+// WithLoadFieldMetaHCL reads the immutable default values and permissions from
+// a HCL file and applies it to the config.Service. The data gets loaded only
+// once. "testdata/example_field_meta.hcl" provides an example HCL file.
+func WithLoadFieldMetaHCL(opts ...option) config.LoadDataOption {
+	return config.WithFieldMetaGenerator(func(s *config.Service) (<-chan *config.FieldMeta, <-chan error) {
+		fmC := make(chan *config.FieldMeta)
+		errC := make(chan error)
+
+		go func() {
+			defer func() { close(fmC); close(errC) }()
+
+			loadHcl := func(_ config.Setter, r io.Reader) error {
+				var hd map[string]fieldMetaRaw
+				if err := decodeHCL(r, &hd); err != nil {
+					return errors.Fatal.New(err, "[config/storage] HCL.Decode")
+				}
+				return sendFieldMeta(fmC, hd)
+			}
+
+			for _, opt := range opts {
+				if err := opt(s, loadHcl); err != nil {
+					errC <- errors.WithStack(err)
+					return
+				}
+			}
+		}()
+
+		return fmC, errC
+	})
+}
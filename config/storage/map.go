@@ -15,6 +15,7 @@
 package storage
 
 import (
+	"context"
 	"sync"
 
 	"github.com/corestoreio/errors"
@@ -70,6 +71,73 @@ func (sp *kvmap) Get(p config.Path) (v []byte, found bool, err error) {
 	return nil, false, nil
 }
 
+// Delete removes a path from the storage.
+func (sp *kvmap) Delete(p config.Path) error {
+	sp.Lock()
+	delete(sp.kv, makeCacheKey(p.ScopeRoute()))
+	sp.Unlock()
+	return nil
+}
+
+// BeginTx implements config.TxStorager. The written values get buffered and
+// applied at once with Commit.
+func (sp *kvmap) BeginTx(_ context.Context) (config.StorageTx, error) {
+	return &kvmapTx{m: sp, kv: make(map[cacheKey]string)}, nil
+}
+
+// kvmapTx buffers the values of a transaction.
+type kvmapTx struct {
+	m    *kvmap
+	kv   map[cacheKey]string
+	done bool
+}
+
+// Set implements config.StorageTx.
+func (tx *kvmapTx) Set(p config.Path, value []byte) error {
+	if tx.done {
+		return errors.AlreadyClosed.Newf("[config/storage] kvmap transaction already committed or rolled back")
+	}
+	tx.kv[makeCacheKey(p.ScopeRoute())] = string(value)
+	return nil
+}
+
+// Commit implements config.StorageTx.
+func (tx *kvmapTx) Commit() error {
+	if tx.done {
+		return errors.AlreadyClosed.Newf("[config/storage] kvmap transaction already committed or rolled back")
+	}
+	tx.done = true
+	tx.m.Lock()
+	for k, v := range tx.kv {
+		tx.m.kv[k] = v
+	}
+	tx.m.Unlock()
+	return nil
+}
+
+// Rollback implements config.StorageTx.
+func (tx *kvmapTx) Rollback() error {
+	tx.done = true
+	tx.kv = nil
+	return nil
+}
+
+// Iterate implements config.StorageIterator. The iteration order is random.
+func (sp *kvmap) Iterate(fn func(p config.Path, v []byte) error) error {
+	sp.RLock()
+	defer sp.RUnlock()
+	for k, v := range sp.kv {
+		p, err := config.MakePathWithScope(k.scp, k.route)
+		if err != nil {
+			return errors.Wrapf(err, "[config/storage] kvmap.Iterate with route %q", k.route)
+		}
+		if err := fn(p, []byte(v)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 // Flush purges all stored items from the cache.
 func (sp *kvmap) Flush() error {
 	sp.Lock()
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +build csall json yaml
+// +build csall json yaml toml hcl
 
 package storage
 
@@ -0,0 +1,152 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall toml hcl
+
+package storage
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/store/scope"
+	"github.com/weiwolves/pkg/util/conv"
+)
+
+// setScopedMap writes the decoded data of the TOML or HCL files into the
+// Setter. The first level contains the route, the second level the scope
+// (default, websites or stores) and the third level the scope ID with its
+// value. A scalar value on the second level applies to scope ID zero. HCL
+// decodes blocks into slices of maps, hence the additional type switch case.
+func setScopedMap(s config.Setter, data map[string]map[string]interface{}, errPrefix string) error {
+	var p config.Path
+	setFn := func(route, scp, scpID string, dataIF interface{}) error {
+		d, err := conv.ToByteE(dataIF)
+		if err != nil {
+			return errors.CorruptData.New(err, "%s failed to convert %v into a byte slice for path: %q %q %q", errPrefix, dataIF, route, scp, scpID)
+		}
+		if err := p.ParseStrings(scp, scpID, route); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := s.Set(p, d); err != nil {
+			return errors.Wrapf(err, "%s Service.Set failed with %q", errPrefix, p.String())
+		}
+		return nil
+	}
+	setMapFn := func(route, scp string, m map[string]interface{}) error {
+		for scpID, dataIF := range m {
+			if err := setFn(route, scp, scpID, dataIF); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for route, v1 := range data {
+		for scp, v2 := range v1 {
+			switch v2t := v2.(type) {
+			case map[string]interface{}:
+				if err := setMapFn(route, scp, v2t); err != nil {
+					return err
+				}
+			case []map[string]interface{}:
+				for _, m := range v2t {
+					if err := setMapFn(route, scp, m); err != nil {
+						return err
+					}
+				}
+			case string, int, int64, float64, bool:
+				if err := setFn(route, scp, "0", v2t); err != nil {
+					return err
+				}
+			default:
+				return errors.CorruptData.Newf("%s unexpected data in %#v", errPrefix, v2)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldMetaRaw defines the structure of the FieldMeta data in TOML and HCL
+// files. Same structure as in the YAML file.
+type fieldMetaRaw struct {
+	Default  interface{}            `toml:"default" hcl:"default"`
+	Perm     string                 `toml:"perm" hcl:"perm"`
+	Websites map[string]interface{} `toml:"websites" hcl:"websites"`
+	Stores   map[string]interface{} `toml:"stores" hcl:"stores"`
+}
+
+// sendFieldMeta sends the decoded FieldMeta data, sorted by route, into the
+// channel.
+func sendFieldMeta(fmC chan<- *config.FieldMeta, data map[string]fieldMetaRaw) error {
+	routes := make([]string, 0, len(data))
+	for route := range data {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	for _, route := range routes {
+		meta := data[route]
+		var wsp scope.Perm
+		if meta.Perm != "" {
+			var err error
+			wsp, err = scope.MakePerm(meta.Perm)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		var def string
+		if meta.Default != nil {
+			var err error
+			if def, err = conv.ToStringE(meta.Default); err != nil {
+				return errors.CorruptData.New(err, "[config/storage] Default value of route %q", route)
+			}
+		}
+		fmC <- &config.FieldMeta{
+			Route:          route,
+			WriteScopePerm: wsp,
+			DefaultValid:   def != "",
+			Default:        def,
+		}
+		if err := sendScopedFieldMeta(fmC, meta.Websites, route, scope.Website); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := sendScopedFieldMeta(fmC, meta.Stores, route, scope.Store); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func sendScopedFieldMeta(fmC chan<- *config.FieldMeta, data map[string]interface{}, route string, scp scope.Type) error {
+	for idStr, defaultIF := range data {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			return errors.NotValid.New(err, "[config/storage] Invalid scope ID %q for route %q", idStr, route)
+		}
+		defaultVal, err := conv.ToStringE(defaultIF)
+		if err != nil {
+			return errors.CorruptData.New(err, "[config/storage] Default value of route %q and ID %d", route, id)
+		}
+		fmC <- &config.FieldMeta{
+			Route:        route,
+			ScopeID:      scp.WithID(uint32(id)),
+			DefaultValid: defaultVal != "",
+			Default:      defaultVal,
+		}
+	}
+	return nil
+}
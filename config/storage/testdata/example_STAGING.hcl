@@ -0,0 +1,3 @@
+"web/unsecure/base_url" {
+  default { "0" = "http://staging.eshop.dev/" }
+}
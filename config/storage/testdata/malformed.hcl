@@ -0,0 +1,3 @@
+"vendor/bar/environment" {
+  default { 0 = "192.168.33.1" }
+}
@@ -0,0 +1,81 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"strconv"
+
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/storage/tinylfu"
+)
+
+type tinyLFUValue []byte
+
+func (v tinyLFUValue) Size() int { return 1 }
+
+// tinyLFUCache wraps a sharded W-TinyLFU cache. It is safe for concurrent
+// access.
+type tinyLFUCache struct {
+	c *tinylfu.Cache
+}
+
+// NewTinyLFU creates a new sharded W-TinyLFU cache suitable as Level1 storage.
+// Compared to the LRU it has less lock contention and frequently requested
+// paths survive a scan over many rarely used paths. Each path counts as one
+// entry, hence Options.Capacity defines the maximum number of entries. A
+// Options.DefaultTTL lets the values expire.
+func NewTinyLFU(o tinylfu.Options) config.Storager {
+	if o.Capacity == 0 {
+		o.Capacity = 1024
+	}
+	return tinyLFUCache{
+		c: tinylfu.NewWithOptions(o),
+	}
+}
+
+func tinyLFUKey(p config.Path) string {
+	scp, route := p.ScopeRoute()
+	buf := make([]byte, 0, 16+len(route))
+	buf = strconv.AppendUint(buf, scp.ToUint64(), 36)
+	buf = append(buf, '/')
+	buf = append(buf, route...)
+	return string(buf)
+}
+
+// Set adds a value to the cache.
+func (c tinyLFUCache) Set(p config.Path, value []byte) error {
+	c.c.Set(tinyLFUKey(p), tinyLFUValue(value))
+	return nil
+}
+
+// Get looks up a path's value from the cache.
+func (c tinyLFUCache) Get(p config.Path) (v []byte, found bool, err error) {
+	if val, ok := c.c.Get(tinyLFUKey(p)); ok {
+		return val.(tinyLFUValue), true, nil
+	}
+	return nil, false, nil
+}
+
+// Delete removes a path from the cache.
+func (c tinyLFUCache) Delete(p config.Path) error {
+	c.c.Delete(tinyLFUKey(p))
+	return nil
+}
+
+// Flush purges all stored items from the cache.
+func (c tinyLFUCache) Flush() error {
+	c.c.Clear()
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/storage/tinylfu"
+	"github.com/weiwolves/pkg/sync/bgwork"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestTinyLFUGet(t *testing.T) {
+	c := storage.NewTinyLFU(tinylfu.Options{})
+	for _, tt := range lruGetTests {
+		assert.NoError(t, c.Set(tt.keyToAdd, testLRUData))
+		val, ok, err := c.Get(tt.keyToGet)
+		assert.NoError(t, err)
+		if ok != tt.expectedOk {
+			t.Fatalf("%s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && !bytes.Equal(val, testLRUData) {
+			t.Fatalf("%s expected get to return %q but got %q", tt.name, testLRUData, val)
+		}
+	}
+
+	p := config.MustMakePath("aa/bb/cc").BindStore(6)
+	type deleter interface{ Delete(config.Path) error }
+	assert.NoError(t, c.(deleter).Delete(p))
+	_, ok, err := c.Get(p)
+	assert.NoError(t, err)
+	assert.False(t, ok, "path must be deleted")
+
+	type flusher interface{ Flush() error }
+	assert.NoError(t, c.(flusher).Flush())
+	_, ok, err = c.Get(config.MustMakePath("aa/bb/cc"))
+	assert.NoError(t, err)
+	assert.False(t, ok, "cache must be flushed")
+}
+
+func TestTinyLFU_Parallel(t *testing.T) {
+	c := storage.NewTinyLFU(tinylfu.Options{Capacity: 5})
+	for _, tt := range lruGetTests {
+		assert.NoError(t, c.Set(tt.keyToAdd, testLRUData))
+	}
+
+	bgwork.Wait(len(lruGetTests), func(idx int) {
+		tt := lruGetTests[idx]
+		val, ok, err := c.Get(tt.keyToGet)
+		if err != nil {
+			panic(err)
+		}
+		if ok && !bytes.Equal(val, testLRUData) {
+			panic(fmt.Sprintf("%s expected get to return %s but got %v", tt.name, testLRUData, val))
+		}
+		if !tt.expectedOk && ok {
+			panic(fmt.Sprintf("%s: unexpected cache hit", tt.name))
+		}
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall toml
+
+package storage
+
+import (
+	"io"
+
+	"github.com/BurntSushi/toml"
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+)
+
+// WithLoadTOML reads the configuration values from a TOML file and applies it
+// to the config.service. "testdata/example.toml" provides an example TOML file.
+// The table header contains the quoted route and the scope, the keys the scope
+// IDs:
+//		["web/unsecure/base_url".default]
+//		0 = "http://eshop.dev/"
+//		["web/unsecure/base_url".stores]
+//		2 = "http://eshop.dev/de-de/"
+// Loads all data into RAM before processing it.
+func WithLoadTOML(opts ...option) config.LoadDataOption {
+	return config.MakeLoadDataOption(func(s *config.Service) (err error) {
+		for i := 0; i < len(opts) && err == nil; i++ {
+			err = opts[i](s, loadTOML)
+		}
+		return
+	}).WithUseStorageLevel(1)
+}
+
+func loadTOML(s config.Setter, r io.Reader) error {
+	var td map[string]map[string]interface{}
+	if _, err := toml.DecodeReader(r, &td); err != nil {
+		return errors.CorruptData.New(err, "[config/storage] TOML.Decode")
+	}
+	return errors.WithStack(setScopedMap(s, td, "[config/storage] WithLoadTOML"))
+}
+
+// WithLoadFieldMetaTOML reads the immutable default values and permissions from
+// a TOML file and applies it to the config.Service. The data gets loaded only
+// once. "testdata/example_field_meta.toml" provides an example TOML file.
+func WithLoadFieldMetaTOML(opts ...option) config.LoadDataOption {
+	return config.WithFieldMetaGenerator(func(s *config.Service) (<-chan *config.FieldMeta, <-chan error) {
+		fmC := make(chan *config.FieldMeta)
+		errC := make(chan error)
+
+		go func() {
+			defer func() { close(fmC); close(errC) }()
+
+			loadToml := func(_ config.Setter, r io.Reader) error {
+				var td map[string]fieldMetaRaw
+				if _, err := toml.DecodeReader(r, &td); err != nil {
+					return errors.Fatal.New(err, "[config/storage] TOML.Decode")
+				}
+				return sendFieldMeta(fmC, td)
+			}
+
+			for _, opt := range opts {
+				if err := opt(s, loadToml); err != nil {
+					errC <- errors.WithStack(err)
+					return
+				}
+			}
+		}()
+
+		return fmC, errC
+	})
+}
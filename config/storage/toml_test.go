@@ -0,0 +1,113 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall toml
+
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/store/scope"
+	"github.com/weiwolves/pkg/util/assert"
+	"github.com/fortytw2/leaktest"
+)
+
+func TestWithLoadTOML(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{},
+			storage.WithLoadTOML(storage.WithFiles([]string{"testdata", "example.toml"})),
+		)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		assert.Exactly(t, `"192.168.33.1"`, cfgSrv.Get(config.MustMakePath("vendor/bar/environment")).String())
+		assert.Exactly(t, `"false"`, cfgSrv.Get(config.MustMakePathWithScope(scope.Website.WithID(2), "google/analytics/active")).String())
+		assert.Exactly(t, `"1"`, cfgSrv.Get(config.MustMakePath("dev/log/active")).String())
+		assert.Exactly(t, 2.002, cfgSrv.Get(config.MustMakePathWithScope(scope.Store.WithID(2), "dev/js/merge_files")).UnsafeFloat64())
+		assert.Exactly(t, `"http://eshop.dev/"`, cfgSrv.Get(config.MustMakePath("web/unsecure/base_url")).String())
+		assert.Exactly(t, `"http://eshop.dev/ch-fr/"`, cfgSrv.Get(config.MustMakePathWithScope(scope.Store.WithID(7), "web/unsecure/base_url")).String())
+	})
+
+	t.Run("env name in glob", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{EnvName: "STAGING"},
+			storage.WithLoadTOML(storage.WithGlob("testdata/example_{CS_ENV}.toml")),
+		)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		assert.Exactly(t, `"http://staging.eshop.dev/"`, cfgSrv.Get(config.MustMakePath("web/unsecure/base_url")).String())
+	})
+
+	t.Run("malformed toml", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{},
+			storage.WithLoadTOML(storage.WithFile("testdata", "malformed.toml")),
+		)
+		assert.Nil(t, cfgSrv)
+		assert.True(t, errors.CorruptData.Match(err), "%+v", err)
+	})
+}
+
+func TestWithLoadFieldMetaTOML(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	t.Run("success", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{},
+			storage.WithLoadFieldMetaTOML(storage.WithFiles([]string{"testdata", "example_field_meta.toml"})),
+		)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+
+		scpd13 := cfgSrv.Scoped(1, 3)
+		scpd24 := cfgSrv.Scoped(2, 4)
+		assert.Exactly(t, `"8080"`, scpd13.Get(scope.Default, "carrier/dpd/port").String())
+		assert.Exactly(t, `"60s"`, scpd13.Get(scope.Default, "carrier/dpd/timeout").String())
+		assert.Exactly(t, `"50s"`, scpd13.Get(scope.Website, "carrier/dpd/timeout").String())
+		assert.Exactly(t, `"40s"`, scpd24.Get(scope.Website, "carrier/dpd/timeout").String())
+		assert.Exactly(t, `"prdUser0"`, scpd13.Get(scope.Website, "carrier/dpd/username").String())
+		assert.Exactly(t, `"prdUser1"`, scpd13.Get(scope.Store, "carrier/dpd/username").String())
+		assert.Exactly(t, `"prdUser2"`, scpd24.Get(scope.Store, "carrier/dpd/username").String())
+
+		err = cfgSrv.Set(config.MustMakePath("carrier/dpd/port").BindWebsite(1), []byte(`return error`))
+		assert.True(t, errors.NotAllowed.Match(err), "%+v", err)
+		err = cfgSrv.Set(config.MustMakePath("carrier/dpd/timeout").BindStore(1), []byte(`return error`))
+		assert.True(t, errors.NotAllowed.Match(err), "%+v", err)
+	})
+
+	t.Run("malformed toml", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{},
+			storage.WithLoadFieldMetaTOML(storage.WithFiles([]string{"testdata", "malformed.toml"})),
+		)
+		assert.Nil(t, cfgSrv)
+		assert.True(t, errors.Fatal.Match(err), "%+v", err)
+	})
+	t.Run("file not found", func(t *testing.T) {
+		cfgSrv, err := config.NewService(
+			storage.NewMap(), config.Options{},
+			storage.WithLoadFieldMetaTOML(storage.WithFiles([]string{"testdata", "malformed_field_meta_XXXZ.toml"})),
+		)
+		assert.Nil(t, cfgSrv)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+}
@@ -145,3 +145,26 @@ func sendFM(fmC chan *config.FieldMeta, data map[int64]string, route string, scp
 		}
 	}
 }
+
+// WriteSnapshotYAML writes the snapshot as YAML into w. The snapshot gets
+// sorted by path.
+func WriteSnapshotYAML(w io.Writer, sn *config.Snapshot) error {
+	sn.Sort()
+	ye := yaml.NewEncoder(w)
+	if err := ye.Encode(sn); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ye.Close())
+}
+
+// ReadSnapshotYAML reads a snapshot written by function WriteSnapshotYAML.
+func ReadSnapshotYAML(r io.Reader) (*config.Snapshot, error) {
+	sn := new(config.Snapshot)
+	d := yaml.NewDecoder(r)
+	d.SetStrict(true)
+	if err := d.Decode(sn); err != nil {
+		return nil, errors.CorruptData.New(err, "[config/storage] ReadSnapshotYAML")
+	}
+	sn.Sort()
+	return sn, nil
+}
@@ -17,6 +17,8 @@
 package storage_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/corestoreio/errors"
@@ -115,3 +117,24 @@ func TestWithLoadFieldMetaYAML(t *testing.T) {
 		assert.True(t, errors.NotFound.Match(err), "%+v", err)
 	})
 }
+
+func TestSnapshotYAML(t *testing.T) {
+	cfgSrv := config.MustNewService(storage.NewMap(
+		"websites/2/web/unsecure/base_url", "http://example.de",
+		"default/0/web/unsecure/base_url", "http://example.com",
+	), config.Options{})
+	sn, err := cfgSrv.Snapshot(config.SnapshotOptions{})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, storage.WriteSnapshotYAML(&buf, sn))
+	assert.Exactly(t, "values:\n- path: default/0/web/unsecure/base_url\n  value: http://example.com\n- path: websites/2/web/unsecure/base_url\n  value: http://example.de\n", buf.String())
+
+	sn2, err := storage.ReadSnapshotYAML(&buf)
+	assert.NoError(t, err)
+	assert.Exactly(t, sn, sn2)
+
+	sn2, err = storage.ReadSnapshotYAML(strings.NewReader("values:\n- pathX: a"))
+	assert.Nil(t, sn2)
+	assert.True(t, errors.CorruptData.Match(err), "%+v", err)
+}
@@ -14,4 +14,16 @@
 
 // Package runmode defines store specific middleware to initialize the scope and
 // its ID per request.
+//
+// Host and path based store resolution
+//
+// The StoreResolver maps the host and URL path prefix of a request to a store
+// by using the configured base URLs of each store. Use it as the Calculater of
+// the WithRunMode middleware:
+//	sr, err := runmode.NewStoreResolver(storeSrv, cfgSrv, runmode.ResolverOptions{
+//		ConfigSubscriber: cfgSrv, // reload on base URL changes
+//	})
+//	// reload on changes to websites, groups or stores
+//	err = storeSrv.Options(sr.StoreOption(ctx))
+//	mw := runmode.WithRunMode(storeSrv, runmode.Options{Calculater: sr})
 package runmode
@@ -0,0 +1,306 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runmode
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/store"
+	"github.com/weiwolves/pkg/store/scope"
+)
+
+// Default configuration paths which contain the base URLs of a store.
+const (
+	ConfigPathSecureBaseURL   = `web/secure/base_url`
+	ConfigPathUnsecureBaseURL = `web/unsecure/base_url`
+)
+
+// ConfigScoper provides the scoped configuration for a store. Implemented by
+// config.Service and config.FakeService.
+type ConfigScoper interface {
+	Scoped(websiteID, storeID uint32) config.Scoped
+}
+
+// ResolverOptions additional customizations for the StoreResolver.
+type ResolverOptions struct {
+	// ConfigPaths optional routes to the base URLs of a store. Defaults to
+	// web/secure/base_url and web/unsecure/base_url.
+	ConfigPaths []string
+	// ConfigSubscriber optional, if set the StoreResolver subscribes to the
+	// ConfigPaths and reloads its routing table on changes.
+	ConfigSubscriber config.Subscriber
+	// Fallback optional Calculater when no route matches the request.
+	// Defaults to the run mode Default.
+	Fallback Calculater
+	// Log can be nil, defaults to black hole.
+	Log log.Logger
+}
+
+// StoreResolver resolves the store of a request by its host and URL path
+// prefix. The routing table gets built from the base URLs of all active stores
+// as found in the configuration, for example:
+//	https://de.shop.com/ => store de
+//	https://shop.com/fr/ => store fr
+//	https://*.shop.com/  => store int, matches any sub domain of shop.com
+// Exact hosts take precedence over wildcard hosts and longer path prefixes over
+// shorter ones. If several stores share the same base URL, the default store
+// of the website wins. The routing table gets replaced atomically on reload,
+// so readers never block. StoreResolver implements interface Calculater and
+// can be used in WithRunMode. Safe for concurrent use.
+type StoreResolver struct {
+	srv      *store.Service
+	cfg      ConfigScoper
+	paths    []string
+	fallback Calculater
+	log      log.Logger
+	closed   int32
+	table    atomic.Value // *routingTable
+}
+
+type pathRoute struct {
+	prefix    string // without trailing slash, empty for the root
+	websiteID uint32
+	storeID   uint32
+	priority  int
+}
+
+type hostRoute struct {
+	host   string // for wildcards without the leading "*."
+	routes []pathRoute
+}
+
+type routingTable struct {
+	exact     map[string]*hostRoute
+	wildcards []*hostRoute // sorted by longest host first
+}
+
+// NewStoreResolver creates a new StoreResolver and builds the routing table.
+// An invalid base URL returns a NotValid error.
+func NewStoreResolver(srv *store.Service, cfg ConfigScoper, o ResolverOptions) (*StoreResolver, error) {
+	r := &StoreResolver{
+		srv:      srv,
+		cfg:      cfg,
+		paths:    o.ConfigPaths,
+		fallback: o.Fallback,
+		log:      o.Log,
+	}
+	if len(r.paths) == 0 {
+		r.paths = []string{ConfigPathSecureBaseURL, ConfigPathUnsecureBaseURL}
+	}
+	if r.fallback == nil {
+		r.fallback = RunModeFunc(func(*http.Request) scope.TypeID { return Default })
+	}
+	if r.log == nil {
+		r.log = log.BlackHole{}
+	}
+	if err := r.Reload(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if o.ConfigSubscriber != nil {
+		for _, p := range r.paths {
+			if _, err := o.ConfigSubscriber.Subscribe(p, r); err != nil {
+				return nil, errors.Wrapf(err, "[runmode] NewStoreResolver.Subscribe %q", p)
+			}
+		}
+	}
+	return r, nil
+}
+
+// Reload rebuilds the routing table from the current stores and their base
+// URLs. On error the previous routing table stays active.
+func (r *StoreResolver) Reload() error {
+	rt, err := r.buildTable()
+	if err != nil {
+		if r.log.IsInfo() {
+			r.log.Info("runmode.StoreResolver.Reload.Error", log.Err(err))
+		}
+		return errors.WithStack(err)
+	}
+	r.table.Store(rt)
+	if r.log.IsDebug() {
+		r.log.Debug("runmode.StoreResolver.Reload", log.Int("exact_hosts", len(rt.exact)), log.Int("wildcard_hosts", len(rt.wildcards)))
+	}
+	return nil
+}
+
+// MessageConfig reloads the routing table when a base URL changes. Implements
+// interface config.MessageReceiver. After Close it returns an error to get
+// unsubscribed.
+func (r *StoreResolver) MessageConfig(config.Path) error {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return errors.AlreadyClosed.Newf("[runmode] StoreResolver already closed")
+	}
+	return r.Reload()
+}
+
+// StoreOption returns a store.Option which reloads the routing table whenever
+// the websites, groups or stores of the store.Service change. Apply it via
+// store.Service.Options.
+func (r *StoreResolver) StoreOption(ctx context.Context) store.Option {
+	return store.WithOnChange(ctx, func(*store.Service) {
+		if atomic.LoadInt32(&r.closed) == 0 {
+			_ = r.Reload() // error already logged and previous table stays active
+		}
+	})
+}
+
+// Close stops further reloads triggered by configuration or store changes.
+func (r *StoreResolver) Close() error {
+	atomic.StoreInt32(&r.closed, 1)
+	return nil
+}
+
+// Resolve returns the website and store ID for the host and URL path of the
+// request. Returns false if no route matches.
+func (r *StoreResolver) Resolve(req *http.Request) (websiteID, storeID uint32, ok bool) {
+	rt, _ := r.table.Load().(*routingTable)
+	if rt == nil {
+		return 0, 0, false
+	}
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	path := req.URL.Path
+
+	if hr, ok := rt.exact[host]; ok {
+		if pr, ok := hr.match(path); ok {
+			return pr.websiteID, pr.storeID, true
+		}
+	}
+	for _, hr := range rt.wildcards {
+		if strings.HasSuffix(host, "."+hr.host) {
+			if pr, ok := hr.match(path); ok {
+				return pr.websiteID, pr.storeID, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// CalculateRunMode returns the store scope of the resolved store or the result
+// of the Fallback Calculater. Implements interface Calculater.
+func (r *StoreResolver) CalculateRunMode(req *http.Request) scope.TypeID {
+	if _, storeID, ok := r.Resolve(req); ok {
+		return scope.Store.WithID(storeID)
+	}
+	return r.fallback.CalculateRunMode(req)
+}
+
+func (hr *hostRoute) match(path string) (pathRoute, bool) {
+	for _, pr := range hr.routes {
+		if pr.prefix == "" || path == pr.prefix || strings.HasPrefix(path, pr.prefix+"/") {
+			return pr, true
+		}
+	}
+	return pathRoute{}, false
+}
+
+func (hr *hostRoute) add(pr pathRoute) {
+	for i, pr2 := range hr.routes {
+		if pr2.prefix == pr.prefix {
+			if pr.priority > pr2.priority {
+				hr.routes[i] = pr
+			}
+			return
+		}
+	}
+	hr.routes = append(hr.routes, pr)
+}
+
+func (r *StoreResolver) buildTable() (*routingTable, error) {
+	rt := &routingTable{
+		exact: make(map[string]*hostRoute),
+	}
+	wildcards := make(map[string]*hostRoute)
+
+	var defaultStoreID uint32
+	if st, err := r.srv.DefaultStoreView(); err == nil {
+		defaultStoreID = st.StoreID
+	}
+
+	stores := r.srv.Stores()
+	for _, st := range stores.Data {
+		if st.StoreID == 0 || !st.IsActive {
+			continue // admin store or not reachable from the frontend
+		}
+
+		pr := pathRoute{
+			websiteID: st.WebsiteID,
+			storeID:   st.StoreID,
+		}
+		switch _, wsStoreID, err := r.srv.DefaultStoreID(scope.Website.WithID(st.WebsiteID)); {
+		case st.StoreID == defaultStoreID:
+			pr.priority = 2
+		case err == nil && st.StoreID == wsStoreID:
+			pr.priority = 1
+		}
+
+		scpCfg := r.cfg.Scoped(st.WebsiteID, st.StoreID)
+		for _, p := range r.paths {
+			rawURL, ok, err := scpCfg.Get(scope.Store, p).Str()
+			if err != nil {
+				return nil, errors.Wrapf(err, "[runmode] StoreResolver Store ID %d path %q", st.StoreID, p)
+			}
+			if !ok || rawURL == "" || strings.Contains(rawURL, "{{") {
+				continue // not set or a placeholder like {{unsecure_base_url}}
+			}
+			u, err := url.Parse(rawURL)
+			if err != nil || u.Host == "" {
+				return nil, errors.NotValid.Newf("[runmode] StoreResolver Store ID %d contains an invalid base URL %q in path %q", st.StoreID, rawURL, p)
+			}
+
+			host := strings.ToLower(u.Hostname())
+			hosts := rt.exact
+			if strings.HasPrefix(host, "*.") {
+				host = host[2:]
+				hosts = wildcards
+			}
+			hr, ok := hosts[host]
+			if !ok {
+				hr = &hostRoute{host: host}
+				hosts[host] = hr
+			}
+			pr.prefix = strings.TrimRight(u.Path, "/")
+			hr.add(pr)
+		}
+	}
+
+	sortRoutes := func(hr *hostRoute) {
+		sort.SliceStable(hr.routes, func(i, j int) bool {
+			return len(hr.routes[i].prefix) > len(hr.routes[j].prefix)
+		})
+	}
+	for _, hr := range rt.exact {
+		sortRoutes(hr)
+	}
+	for _, hr := range wildcards {
+		sortRoutes(hr)
+		rt.wildcards = append(rt.wildcards, hr)
+	}
+	sort.Slice(rt.wildcards, func(i, j int) bool {
+		return len(rt.wildcards[i].host) > len(rt.wildcards[j].host)
+	})
+	return rt, nil
+}
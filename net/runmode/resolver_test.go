@@ -0,0 +1,142 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runmode_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/net/runmode"
+	"github.com/weiwolves/pkg/store"
+	"github.com/weiwolves/pkg/store/mock"
+	"github.com/weiwolves/pkg/store/scope"
+	"github.com/weiwolves/pkg/util/assert"
+	"github.com/corestoreio/errors"
+)
+
+var _ runmode.Calculater = (*runmode.StoreResolver)(nil)
+var _ config.MessageReceiver = (*runmode.StoreResolver)(nil)
+
+func TestStoreResolver_Resolve(t *testing.T) {
+	cfg := config.NewFakeService(storage.NewMap(
+		"default/0/web/unsecure/base_url", "http://shop.com/",
+		"default/0/web/secure/base_url", "{{unsecure_base_url}}",
+		"websites/1/web/secure/base_url", "https://shop.com/",
+		"stores/1/web/secure/base_url", "https://de.shop.com/",
+		"stores/4/web/secure/base_url", "https://shop.com/uk/",
+		"stores/5/web/secure/base_url", "https://*.shop.com.au/",
+		"stores/6/web/secure/base_url", "https://*.nz.shop.com.au/kiwi",
+	))
+	srv := mock.NewServiceEuroOZ()
+
+	r, err := runmode.NewStoreResolver(srv, cfg, runmode.ResolverOptions{})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		url           string
+		wantWebsiteID uint32
+		wantStoreID   uint32
+		wantOK        bool
+	}{
+		{"https://de.shop.com/", 1, 1, true},
+		{"https://DE.shop.com:8443/checkout", 1, 1, true},
+		{"https://shop.com/uk", 1, 4, true},
+		{"https://shop.com/uk/basket", 1, 4, true},
+		{"https://shop.com/ukraine", 1, 2, true}, // no segment match, falls back to the default store view at, ch is inactive
+		{"http://shop.com/", 1, 2, true},
+		{"https://www.shop.com.au/", 2, 5, true},
+		{"https://a.b.shop.com.au/", 2, 5, true},
+		{"https://shop.com.au/", 0, 0, false},
+		{"https://akl.nz.shop.com.au/kiwi/", 2, 6, true},
+		{"https://akl.nz.shop.com.au/", 2, 5, true},
+		{"https://example.com/", 0, 0, false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		websiteID, storeID, ok := r.Resolve(req)
+		assert.Exactly(t, test.wantOK, ok, "%s", test.url)
+		assert.Exactly(t, test.wantWebsiteID, websiteID, "%s", test.url)
+		assert.Exactly(t, test.wantStoreID, storeID, "%s", test.url)
+	}
+
+	assert.Exactly(t, scope.Store.WithID(4), r.CalculateRunMode(httptest.NewRequest("GET", "https://shop.com/uk/", nil)))
+	assert.Exactly(t, runmode.Default, r.CalculateRunMode(httptest.NewRequest("GET", "https://example.com/", nil)))
+}
+
+func TestStoreResolver_InvalidURL(t *testing.T) {
+	cfg := config.NewFakeService(storage.NewMap(
+		"stores/1/web/secure/base_url", "de.shop.com",
+	))
+	r, err := runmode.NewStoreResolver(mock.NewServiceEuroOZ(), cfg, runmode.ResolverOptions{})
+	assert.Nil(t, r)
+	assert.ErrorIsKind(t, errors.NotValid, err)
+}
+
+func TestStoreResolver_Reload(t *testing.T) {
+	m := storage.NewMap(
+		"stores/1/web/secure/base_url", "https://de.shop.com/",
+		"stores/4/web/secure/base_url", "https://uk.shop.com/",
+	)
+	cfg := config.NewFakeService(m)
+	var subscribedPaths []string
+	cfg.SubscribeFn = func(path string, _ config.MessageReceiver) (int, error) {
+		subscribedPaths = append(subscribedPaths, path)
+		return len(subscribedPaths), nil
+	}
+	srv := mock.NewServiceEuroOZ()
+
+	r, err := runmode.NewStoreResolver(srv, cfg, runmode.ResolverOptions{
+		ConfigPaths:      []string{runmode.ConfigPathSecureBaseURL},
+		ConfigSubscriber: cfg,
+	})
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{runmode.ConfigPathSecureBaseURL}, subscribedPaths)
+
+	resolve := func(url string) uint32 {
+		_, storeID, _ := r.Resolve(httptest.NewRequest("GET", url, nil))
+		return storeID
+	}
+	assert.Exactly(t, uint32(4), resolve("https://uk.shop.com/"))
+
+	t.Run("config change", func(t *testing.T) {
+		p := config.MustMakePath(runmode.ConfigPathSecureBaseURL).BindStore(4)
+		assert.NoError(t, m.Set(p, []byte("https://gb.shop.com/")))
+		assert.NoError(t, r.MessageConfig(p))
+		assert.Exactly(t, uint32(0), resolve("https://uk.shop.com/"))
+		assert.Exactly(t, uint32(4), resolve("https://gb.shop.com/"))
+	})
+
+	t.Run("store change", func(t *testing.T) {
+		assert.NoError(t, srv.Options(r.StoreOption(context.Background())))
+		assert.NoError(t, srv.UpdateStore(&store.Store{StoreID: 4, Code: `uk`, WebsiteID: 1, GroupID: 2, Name: `UK`, SortOrder: 10, IsActive: false}))
+		// the store group 2 has no other store, so store 4 stays the default
+		// store of its group but is not reachable anymore.
+		deadline := time.Now().Add(time.Second)
+		for resolve("https://gb.shop.com/") != 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Exactly(t, uint32(0), resolve("https://gb.shop.com/"))
+		assert.Exactly(t, uint32(1), resolve("https://de.shop.com/"))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		assert.NoError(t, r.Close())
+		assert.ErrorIsKind(t, errors.AlreadyClosed, r.MessageConfig(config.Path{}))
+	})
+}
@@ -540,6 +540,41 @@ func (c *Column) IsFloat() bool {
 	return false
 }
 
+// DecimalBounds returns the smallest and the largest value which can be stored
+// in a decimal or numeric column. Unsigned columns have a minimum of zero.
+// Returns an error with kind NotSupported for other column types.
+func (c *Column) DecimalBounds() (min, max null.Decimal, err error) {
+	if c.DataType != "decimal" && c.DataType != "numeric" {
+		return min, max, errors.NotSupported.Newf("[ddl] Column %q with type %q is not a decimal type", c.Field, c.DataType)
+	}
+	if max, err = null.MakeDecimalMax(int32(c.Precision.Int64), int32(c.Scale.Int64)); err != nil {
+		return min, max, errors.Wrapf(err, "[ddl] Column %q", c.Field)
+	}
+	min = max.Neg()
+	if c.IsUnsigned() {
+		min = null.MakeDecimalInt64(0, max.Scale)
+	}
+	return min, max, nil
+}
+
+// BoundDecimal rounds d to the scale of the decimal column and checks if it
+// fits into its precision. Negative values in an unsigned column and values
+// exceeding the precision return an error with kind OutOfRange. NULL stays
+// NULL.
+func (c *Column) BoundDecimal(d null.Decimal, rm null.RoundingMode) (null.Decimal, error) {
+	if _, _, err := c.DecimalBounds(); err != nil {
+		return null.Decimal{}, errors.WithStack(err)
+	}
+	bd, err := d.Bound(int32(c.Precision.Int64), int32(c.Scale.Int64), rm)
+	if err != nil {
+		return null.Decimal{}, errors.Wrapf(err, "[ddl] Column %q", c.Field)
+	}
+	if bd.Sign() < 0 && c.IsUnsigned() {
+		return null.Decimal{}, errors.OutOfRange.Newf("[ddl] Column %q is unsigned and cannot store %s", c.Field, d)
+	}
+	return bd, nil
+}
+
 // IsTime returns true if the column is a date, datetime, time or timestamp.
 func (c *Column) IsTime() bool {
 	switch c.DataType {
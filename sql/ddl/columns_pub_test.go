@@ -246,6 +246,34 @@ func TestColumn_IsUnsigned(t *testing.T) {
 	assert.False(t, adminUserColumns.ByField("reload_acl_flag").IsUnsigned())
 }
 
+func TestColumn_DecimalBounds(t *testing.T) {
+	price := &ddl.Column{Field: "price", DataType: "decimal", Precision: null.MakeInt64(12), Scale: null.MakeInt64(4), ColumnType: "decimal(12,4)"}
+	qty := &ddl.Column{Field: "qty", DataType: "decimal", Precision: null.MakeInt64(5), Scale: null.MakeInt64(2), ColumnType: "decimal(5,2) unsigned"}
+
+	min, max, err := price.DecimalBounds()
+	assert.NoError(t, err)
+	assert.Exactly(t, "-99999999.9999", min.String())
+	assert.Exactly(t, "99999999.9999", max.String())
+
+	min, max, err = qty.DecimalBounds()
+	assert.NoError(t, err)
+	assert.Exactly(t, "0", min.String())
+	assert.Exactly(t, "999.99", max.String())
+
+	_, _, err = adminUserColumns.ByField("lognum").DecimalBounds()
+	assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+
+	d, err := price.BoundDecimal(null.MustMakeDecimalBytes([]byte("19.123456")), null.RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Exactly(t, "19.1235", d.String())
+
+	_, err = price.BoundDecimal(null.MustMakeDecimalBytes([]byte("100000000")), null.RoundHalfUp)
+	assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+
+	_, err = qty.BoundDecimal(null.MustMakeDecimalBytes([]byte("-1")), null.RoundHalfUp)
+	assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+}
+
 func TestColumn_IsCurrentTimestamp(t *testing.T) {
 	assert.True(t, adminUserColumns.ByField("modified").IsCurrentTimestamp())
 	assert.False(t, adminUserColumns.ByField("reload_acl_flag").IsCurrentTimestamp())
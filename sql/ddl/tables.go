@@ -794,6 +794,12 @@ func (tm *Tables) Transaction(ctx context.Context, opts *sql.TxOptions, fns ...f
 	return tm.dcp.Transaction(ctx, opts, fns...)
 }
 
+// BeginTx starts a transaction. The caller must call Commit or Rollback on the
+// returned Tx.
+func (tm *Tables) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dml.Tx, error) {
+	return tm.dcp.BeginTx(ctx, opts)
+}
+
 // SingleConnection runs all fns in a single connection and guarantees no change
 // to the connection. Single session. If more than one `fns` gets added, the
 // last function of the fns slice runs in a defer statement before the
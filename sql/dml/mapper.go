@@ -290,6 +290,74 @@ func (b *ColumnMap) Scan(r *sql.Rows) error {
 	return nil
 }
 
+// ScanValues assigns already decoded values, for example a row of the binary
+// log, instead of scanning a *sql.Rows. The values must be in the order of the
+// columns passed to NewColumnMap. Signed and unsigned integers of all sizes,
+// strings and null.Decimal get converted into the representation of the MySQL
+// text protocol. After a call to ScanValues the ColumnMap runs in mode
+// ColumnMapScan and a ColumnMapper can read the values as usual.
+func (b *ColumnMap) ScanValues(values ...interface{}) error {
+	if len(values) != b.columnsLen {
+		return errors.Mismatch.Newf("[dml] ColumnMap.ScanValues: Got %d values but %d columns: %v", len(values), b.columnsLen, b.columns)
+	}
+	if !b.initialized {
+		b.scanCol = make([]scannedColumn, b.columnsLen)
+		b.scanArgs = make([]interface{}, b.columnsLen)
+		for i := 0; i < b.columnsLen; i++ {
+			b.scanArgs[i] = &b.scanCol[i]
+		}
+		b.initialized = true
+		b.Count = 0
+		b.HasRows = true
+	} else {
+		b.Count++
+	}
+	b.scanErr = nil
+	b.index = -1
+	for i, v := range values {
+		b.scanCol[i].reset()
+		if err := b.scanCol[i].Scan(scanValue(v)); err != nil {
+			return errors.Wrapf(err, "[dml] ColumnMap.ScanValues Column %q", b.columns[i])
+		}
+	}
+	return nil
+}
+
+// scanValue converts the value into one of the types scannedColumn supports.
+// Like the text protocol an uint64 larger than math.MaxInt64 becomes a byte
+// slice.
+func scanValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint8:
+		return int64(val)
+	case uint16:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case uint:
+		return scanValue(uint64(val))
+	case uint64:
+		if val > math.MaxInt64 {
+			return strconv.AppendUint(nil, val, 10)
+		}
+		return int64(val)
+	case string:
+		return []byte(val)
+	case null.Decimal:
+		if !val.Valid {
+			return nil
+		}
+		return []byte(val.String())
+	}
+	return v
+}
+
 // Err returns the delayed error from one of the scans and parsings. Function is
 // idempotent.
 func (b *ColumnMap) Err() error {
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -176,6 +177,55 @@ func TestScannedColumn_Scan(t *testing.T) {
 	assert.ErrorIsKind(t, errors.NotSupported, err)
 }
 
+func TestColumnMap_ScanValues(t *testing.T) {
+	t.Parallel()
+
+	cm := NewColumnMap(0, "entity_id", "store_id", "big", "name", "price", "note", "created_at")
+	err := cm.ScanValues(int32(4711), int8(-2), uint64(math.MaxUint64), "Gopher",
+		null.MakeDecimalInt64(1234, 2), nil, "2019-03-04 05:06:07")
+	assert.NoError(t, err)
+	assert.Exactly(t, ColumnMapScan, cm.Mode())
+
+	var (
+		entityID  int64
+		storeID   uint8
+		big       uint64
+		name      string
+		price     null.Decimal
+		note      null.String
+		createdAt time.Time
+	)
+	for cm.Next() {
+		switch cm.Column() {
+		case "entity_id":
+			cm.Int64(&entityID)
+		case "store_id":
+			cm.Uint8(&storeID)
+		case "big":
+			cm.Uint64(&big)
+		case "name":
+			cm.String(&name)
+		case "price":
+			cm.Decimal(&price)
+		case "note":
+			cm.NullString(&note)
+		case "created_at":
+			cm.Time(&createdAt)
+		}
+	}
+	assert.NoError(t, cm.Err())
+	assert.Exactly(t, int64(4711), entityID)
+	assert.Exactly(t, uint8(254), storeID)
+	assert.Exactly(t, uint64(math.MaxUint64), big)
+	assert.Exactly(t, "Gopher", name)
+	assert.Exactly(t, "12.34", price.String())
+	assert.False(t, note.Valid)
+	assert.Exactly(t, "2019-03-04 05:06:07", createdAt.Format("2006-01-02 15:04:05"))
+
+	err = cm.ScanValues(int32(1))
+	assert.ErrorIsKind(t, errors.Mismatch, err)
+}
+
 func TestColumnMap_Scan_Empty_Bytes(t *testing.T) {
 	t.Parallel()
 
@@ -47,6 +47,7 @@ type Select struct {
 	IsStraightJoin       bool // See StraightJoin()
 	IsSQLNoCache         bool // See SQLNoCache()
 	IsForUpdate          bool // See ForUpdate()
+	IsSkipLocked         bool // See ForUpdateSkipLocked()
 	IsLockInShareMode    bool // See LockInShareMode()
 	IsOrderByDeactivated bool // See OrderByDeactivated()
 	IsOrderByRand        bool // enables the original slow ORDER BY RAND() clause
@@ -176,6 +177,17 @@ func (b *Select) ForUpdate() *Select {
 	return b
 }
 
+// ForUpdateSkipLocked same as ForUpdate but a locking read never waits to
+// acquire a row lock and rows locked by another transaction get removed from
+// the result set. Useful for implementing queue like tables where several
+// workers claim rows. Requires at least MySQL 8.0.1 or MariaDB 10.6.
+// https://dev.mysql.com/doc/refman/8.0/en/innodb-locking-reads.html#innodb-locking-reads-nowait-skip-locked
+func (b *Select) ForUpdateSkipLocked() *Select {
+	b.IsForUpdate = true
+	b.IsSkipLocked = true
+	return b
+}
+
 // LockInShareMode sets a shared mode lock on any rows that are read. Other
 // sessions can read the rows, but cannot modify them until your transaction
 // commits. If any of these rows were changed by another transaction that has
@@ -547,6 +559,9 @@ func (b *Select) toSQL(w *bytes.Buffer, placeHolders []string) (_placeHolders []
 		w.WriteString(" LOCK IN SHARE MODE")
 	case b.IsForUpdate:
 		w.WriteString(" FOR UPDATE")
+		if b.IsSkipLocked {
+			w.WriteString(" SKIP LOCKED")
+		}
 	}
 	return placeHolders, err
 }
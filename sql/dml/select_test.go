@@ -902,6 +902,13 @@ func TestSelect_Locks(t *testing.T) {
 			"SELECT `p1`.*, `p2`.`name` AS `p2Name`, `p2`.`email` AS `p2Email` FROM `dml_people` AS `p1` FOR UPDATE",
 		)
 	})
+	t.Run("FOR UPDATE SKIP LOCKED", func(t *testing.T) {
+		s := NewSelect("id").From("dml_people").
+			Where(Column("id").Greater().Int(3)).Limit(0, 10).ForUpdateSkipLocked()
+		compareToSQL2(t, s, errors.NoKind,
+			"SELECT `id` FROM `dml_people` WHERE (`id` > 3) LIMIT 0,10 FOR UPDATE SKIP LOCKED",
+		)
+	})
 }
 
 func TestSelect_Columns(t *testing.T) {
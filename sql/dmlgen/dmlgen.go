@@ -827,6 +827,7 @@ func (g *Generator) GenerateGo(wMain, wTest io.Writer) error {
 		t.fnEntityDBAssignLastInsertID(mainGen, g)
 		t.fnEntityDBMapColumns(mainGen, g)
 		t.fnEntityDBMHandler(mainGen, g)
+		t.fnEntityDecodeRow(mainGen, g)
 		t.fnEntityEmpty(mainGen, g)
 		t.fnEntityIsSet(mainGen, g)
 		t.fnEntityGetSetPrivateFields(mainGen, g)
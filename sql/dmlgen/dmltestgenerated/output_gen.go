@@ -484,6 +484,17 @@ func (e *CatalogProductIndexEAVDecimalIDX) Upsert(ctx context.Context, dbm *DBM,
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *CatalogProductIndexEAVDecimalIDX) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *CatalogProductIndexEAVDecimalIDX) Empty() *CatalogProductIndexEAVDecimalIDX {
 	*e = CatalogProductIndexEAVDecimalIDX{}
@@ -1018,6 +1029,17 @@ func (e *CoreConfiguration) Upsert(ctx context.Context, dbm *DBM, opts ...dml.DB
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *CoreConfiguration) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *CoreConfiguration) Empty() *CoreConfiguration { *e = CoreConfiguration{}; return e }
 
@@ -1573,6 +1595,17 @@ func (e *CustomerAddressEntity) Upsert(ctx context.Context, dbm *DBM, opts ...dm
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *CustomerAddressEntity) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *CustomerAddressEntity) Empty() *CustomerAddressEntity {
 	*e = CustomerAddressEntity{}
@@ -2139,6 +2172,17 @@ func (e *CustomerEntity) Upsert(ctx context.Context, dbm *DBM, opts ...dml.DBRFu
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *CustomerEntity) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *CustomerEntity) Empty() *CustomerEntity { *e = CustomerEntity{}; return e }
 
@@ -2751,6 +2795,17 @@ func (e *DmlgenTypes) Upsert(ctx context.Context, dbm *DBM, opts ...dml.DBRFunc)
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *DmlgenTypes) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *DmlgenTypes) Empty() *DmlgenTypes { *e = DmlgenTypes{}; return e }
 
@@ -3371,6 +3426,17 @@ func (e *SalesOrderStatusState) Upsert(ctx context.Context, dbm *DBM, opts ...dm
 	return res, nil
 }
 
+// DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the
+// fields. Argument columns contains the column names in the order of the values.
+// Auto generated.
+func (e *SalesOrderStatusState) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.MapColumns(cm)
+}
+
 // Empty empties all the fields of the current object. Also known as Reset.
 func (e *SalesOrderStatusState) Empty() *SalesOrderStatusState {
 	*e = SalesOrderStatusState{}
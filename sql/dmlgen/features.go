@@ -29,6 +29,7 @@ const (
 	FeatureDBUpdate
 	FeatureDBUpsert
 	FeatureEntityCopy
+	FeatureEntityDecodeRow // decodes binary log rows of sql/mycanal
 	FeatureEntityEmpty
 	FeatureEntityGetSetPrivateFields
 	FeatureEntityIsSet
@@ -62,6 +63,7 @@ var featureNames = map[FeatureToggle]string{
 	FeatureDBUpdate:                    "FeatureDBUpdate",
 	FeatureDBUpsert:                    "FeatureDBUpsert",
 	FeatureEntityCopy:                  "FeatureEntityCopy",
+	FeatureEntityDecodeRow:             "FeatureEntityDecodeRow",
 	FeatureEntityEmpty:                 "FeatureEntityEmpty",
 	FeatureEntityGetSetPrivateFields:   "FeatureEntityGetSetPrivateFields",
 	FeatureEntityIsSet:                 "FeatureEntityIsSet",
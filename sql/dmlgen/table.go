@@ -454,6 +454,34 @@ func (t *Table) fnEntityDBMapColumns(mainGen *codegen.Go, g *Generator) {
 	mainGen.Pln(`}`)
 }
 
+func (t *Table) fnEntityDecodeRow(mainGen *codegen.Go, g *Generator) {
+	// DecodeRow requires the MapColumns function and views do not appear in
+	// the binary log.
+	if t.Table.IsView() || !g.hasFeature(t.featuresInclude, t.featuresExclude, FeatureEntityDecodeRow) ||
+		!g.hasFeature(t.featuresInclude, t.featuresExclude, FeatureDBMapColumns|
+			FeatureDB|FeatureDBSelect|FeatureDBDelete|
+			FeatureDBInsert|FeatureDBUpdate|FeatureDBUpsert) {
+		return
+	}
+	mainGen.C(`DecodeRow assigns a row of the binary log, as received by sql/mycanal, to the fields.`,
+		`Argument columns contains the column names in the order of the values. Auto generated.`)
+	mainGen.Pln(`func (e *`, t.EntityName(), `) DecodeRow(columns []string, values []interface{}) error {`)
+	{
+		mainGen.In()
+		mainGen.Pln(`cm := dml.NewColumnMap(0, columns...)`)
+		mainGen.Pln(`if err := cm.ScanValues(values...); err != nil {`)
+		{
+			mainGen.In()
+			mainGen.Pln(`return errors.WithStack(err)`)
+			mainGen.Out()
+		}
+		mainGen.Pln(`}`)
+		mainGen.Pln(`return e.MapColumns(cm)`)
+		mainGen.Out()
+	}
+	mainGen.Pln(`}`)
+}
+
 func (t *Table) hasPKAutoInc() bool {
 	var hasPKAutoInc bool
 	t.Table.Columns.Each(func(c *ddl.Column) {
@@ -34,22 +34,30 @@ const (
 // Configuration paths for config.Service
 const (
 	ConfigPathBackendPosition     = `sql/mycanal/master_position`
+	ConfigPathBackendGTID         = `sql/mycanal/master_gtid`
 	ConfigPathIncludeTableRegex   = `sql/mycanal/include_table_regex`
 	ConfigPathExcludeTableRegex   = `sql/mycanal/exclude_table_regex`
 	ConfigPathBinlogStartFile     = `sql/mycanal/binlog_start_file`
 	ConfigPathBinlogStartPosition = `sql/mycanal/binlog_start_position`
 	ConfigPathBinlogSlaveID       = `sql/mycanal/binlog_slave_id`
 	ConfigPathServerFlavor        = `sql/mycanal/server_flavor`
+	ConfigPathFailoverHosts       = `sql/mycanal/failover_hosts`
 )
 
 // Canal can sync your MySQL data. MySQL must use the binlog format ROW.
 type Canal struct {
 	opts                      Options
-	configPathBackendPosition *config.Path
-	// mclose acts only during the call to Close().
+	configPathBackendPosition config.Path
+	configPathBackendGTID     config.Path
+	// mclose acts only during the call to Close() and during a failover.
 	mclose sync.Mutex
 	// DSN contains the parsed DSN
 	dsn *mysql.Config
+	// dbFactory creates the connection pool, also for the hosts of a failover.
+	dbFactory DBConFactory
+	// gtidEnabled gets set when the server runs with GTIDs and the stream
+	// position gets tracked via masterGTID.
+	gtidEnabled bool
 
 	cfgScope config.Scoped // required
 	syncer   *myreplicator.BinlogSyncer
@@ -63,7 +71,10 @@ type Canal struct {
 	rsMu sync.RWMutex
 	// the empty map key declares event handler for all tables, filtered  by the regexes.
 	// Otherwise an event handler is only registered for a specific table.
-	rsHandlers map[string][]RowsEventHandler
+	rsHandlers map[string][]*rowsEventHandler
+	// deadLetterTables contains the tables of ErrorPolicyDeadLetter. Their
+	// events never get passed to a handler.
+	deadLetterTables map[string]bool
 
 	// dbcp is a database connection pool
 	dbcp *dml.ConnPool
@@ -156,6 +167,10 @@ func withUpdateBinlogStart(c *Canal) error {
 		c.masterStatus.Position = uint(c.opts.BinlogStartPosition)
 		return nil
 	}
+	if c.opts.BinlogStartFile == "" && c.opts.savedPosition.File != "" {
+		c.masterStatus = c.opts.savedPosition
+		return nil
+	}
 
 	if c.opts.MasterStatusQueryTimeout == 0 {
 		c.opts.MasterStatusQueryTimeout = time.Second * 20
@@ -241,7 +256,36 @@ type Options struct {
 
 	BinlogStartFile     string
 	BinlogStartPosition uint64
-	BinlogSlaveId       uint64
+	// Snapshot enables the initial snapshot. Before the binlog stream starts,
+	// all allowed tables get read in chunks within one consistent read view
+	// and their rows get delivered as InsertAction to the RowsEventHandlers.
+	// Tables without a RowsEventHandler get skipped. The binlog stream then
+	// continues at the position of the read view. Snapshot cannot be combined
+	// with BinlogStartFile. The snapshot gets skipped if a previous run has
+	// persisted its position at ConfigPathBackendPosition or its GTID set at
+	// ConfigPathBackendGTID, then the stream resumes there. With flavor
+	// `mysql` the RELOAD privilege is required for a short global read lock
+	// to determine the binlog position of the read view.
+	Snapshot bool
+	// SnapshotChunkSize defines the number of rows per SELECT query and per
+	// call to RowsEventHandler.Do during the snapshot. Default 1000.
+	SnapshotChunkSize int
+	BinlogSlaveId     uint64
+	// BinlogStartGTID defines the GTID set to start the stream from. If empty
+	// it gets loaded from the GTID set persisted at ConfigPathBackendGTID, so
+	// a restarted Canal resumes where it has stopped. If still empty, the
+	// stream starts at the currently executed GTID set of the server.
+	BinlogStartGTID string
+	// DisableGTID uses binlog file and position even if the server runs with
+	// GTIDs. By default the GTID mode gets detected, MySQL requires
+	// gtid_mode=ON, MariaDB always writes GTIDs.
+	DisableGTID bool
+	// FailoverHosts contains additional "host:port" addresses of servers in
+	// the same replication topology. If the connection to the current server
+	// gets lost, Canal connects to the next writable server of the list,
+	// including the host of the DSN, and resumes the stream by GTID. Requires
+	// the GTID mode.
+	FailoverHosts []string
 	// Flavor defines if `mariadb` or `mysql` should be used. Defaults to
 	// `mariadb`.
 	Flavor                   string
@@ -250,6 +294,13 @@ type Options struct {
 	// syncer has been closed. The syncer does not "see" the changes comming
 	// from the queries executed in the call back.
 	OnClose func(*dml.ConnPool) error
+
+	// savedPosition contains the position persisted at
+	// ConfigPathBackendPosition by a previous run.
+	savedPosition ddl.MasterStatus
+	// resumable gets set if a previous run has persisted its position or
+	// its GTID set.
+	resumable bool
 }
 
 func (o *Options) loadFromConfigService() (err error) {
@@ -300,6 +351,25 @@ func (o *Options) loadFromConfigService() (err error) {
 		v := o.ConfigScoped.Get(scope.Default, ConfigPathServerFlavor)
 		o.Flavor = v.UnsafeStr()
 	}
+	if o.BinlogStartGTID == "" {
+		v := o.ConfigScoped.Get(scope.Default, ConfigPathBackendGTID)
+		o.BinlogStartGTID = v.UnsafeStr()
+		o.resumable = o.BinlogStartGTID != ""
+	}
+	if v := o.ConfigScoped.Get(scope.Default, ConfigPathBackendPosition).UnsafeStr(); v != "" {
+		if err = o.savedPosition.FromString(v); err != nil {
+			err = errors.Wrapf(err, "[mycanal] Failed to parse the saved position %q", v)
+			return
+		}
+		o.resumable = true
+	}
+	if o.FailoverHosts == nil {
+		v := o.ConfigScoped.Get(scope.Default, ConfigPathFailoverHosts)
+		if o.FailoverHosts, err = v.Strs(o.FailoverHosts...); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+	}
 
 	return nil
 }
@@ -319,11 +389,16 @@ func NewCanal(dsn string, db DBConFactory, opt *Options) (*Canal, error) {
 	if err := opt.loadFromConfigService(); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if opt.Snapshot && opt.BinlogStartFile != "" {
+		return nil, errors.NotValid.Newf("[mycanal] Options Snapshot and BinlogStartFile %q cannot be used together", opt.BinlogStartFile)
+	}
 
 	c := &Canal{
 		opts:                      *opt,
 		configPathBackendPosition: config.MustMakePath(ConfigPathBackendPosition),
+		configPathBackendGTID:     config.MustMakePath(ConfigPathBackendGTID),
 		dsn:                       pDSN,
+		dbFactory:                 db,
 		closed:                    new(int32),
 		tables:                    ddl.MustNewTables(),
 	}
@@ -342,7 +417,7 @@ func NewCanal(dsn string, db DBConFactory, opt *Options) (*Canal, error) {
 	}
 
 	initOptFn := [...]func(c *Canal) error{
-		withUpdateBinlogStart, withPrepareSyncer, withCheckBinlogRowFormat,
+		withUpdateBinlogStart, withGTIDStart, withPrepareSyncer, withCheckBinlogRowFormat,
 		withIncludeTables(opt.IncludeTableRegex), withExcludeTables(opt.ExcludeTableRegex),
 	}
 	for _, optFn := range initOptFn {
@@ -360,14 +435,17 @@ func NewCanal(dsn string, db DBConFactory, opt *Options) (*Canal, error) {
 	return c, nil
 }
 
-// TODO continue sync from last stored master position
-
-func (c *Canal) masterSave(fileName string, pos uint) error {
+// masterSave stores the current position and, if not nil, the GTID set. Both
+// get persisted at most once per second.
+func (c *Canal) masterSave(fileName string, pos uint, gset simysql.GTIDSet) error {
 	c.masterMu.Lock()
 	defer c.masterMu.Unlock()
 
 	c.masterStatus.File = fileName
 	c.masterStatus.Position = pos
+	if gset != nil {
+		c.masterGTID = gset
+	}
 
 	now := time.Now()
 	if now.Sub(c.masterLastSaveTime) < time.Second {
@@ -393,22 +471,44 @@ func (c *Canal) masterSave(fileName string, pos uint) error {
 		}
 		return errors.WithStack(err)
 	}
+	if c.masterGTID != nil {
+		if err := c.opts.ConfigSet.Set(c.configPathBackendGTID, []byte(c.masterGTID.String())); err != nil {
+			if c.opts.Log.IsInfo() {
+				c.opts.Log.Info("mycanal.masterSave.gtid.error",
+					log.Err(err), log.String("database", c.dsn.DBName), log.Stringer("master_gtid", c.masterGTID))
+			}
+			return errors.WithStack(err)
+		}
+	}
 
 	c.masterLastSaveTime = now
 
 	return nil
 }
 
-// SyncedPosition returns the current synced position as retrieved from the SQl
-// server.
+// SyncedPosition returns the end position of the last completed transaction
+// as retrieved from the SQl server.
 func (c *Canal) SyncedPosition() ddl.MasterStatus {
 	c.masterMu.RLock()
 	defer c.masterMu.RUnlock()
 	return c.masterStatus
 }
 
+// SyncedGTIDSet returns the GTID set of the last completed transaction or nil
+// if the GTID mode is not in use.
+func (c *Canal) SyncedGTIDSet() simysql.GTIDSet {
+	c.masterMu.RLock()
+	defer c.masterMu.RUnlock()
+	if c.masterGTID == nil {
+		return nil
+	}
+	return c.masterGTID.Clone()
+}
+
 // Start starts the sync process in the background as a goroutine. You can stop
-// the goroutine via the context.
+// the goroutine via the context. If Options.Snapshot has been enabled and no
+// position of a previous run has been saved, the snapshot runs first in the
+// same goroutine.
 func (c *Canal) Start(ctx context.Context) error {
 	go c.run(ctx)
 	return nil
@@ -419,10 +519,36 @@ func (c *Canal) run(ctx context.Context) {
 	// refactor for better error handling
 	defer c.wg.Done()
 	c.wg.Add(1)
-	if err := c.startSyncBinlog(ctx); err != nil {
-		if !c.isClosed() && c.opts.Log.IsInfo() {
+	if c.opts.Snapshot && c.opts.resumable {
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("[mycanal] Canal skips the snapshot and resumes at the saved position",
+				log.Stringer("position", c.SyncedPosition()), log.String("gtid_set", c.opts.BinlogStartGTID))
+		}
+	} else if c.opts.Snapshot {
+		if err := c.snapshot(ctx); err != nil {
+			if !c.isClosed() && c.opts.Log.IsInfo() {
+				c.opts.Log.Info("[mycanal] Canal start has encountered a snapshot error", log.Err(err))
+			}
+			return
+		}
+	}
+	for {
+		err := c.startSyncBinlog(ctx)
+		if err == nil || c.isClosed() {
+			return
+		}
+		if c.opts.Log.IsInfo() {
 			c.opts.Log.Info("[mycanal] Canal start has encountered a sync binlog error", log.Err(err))
 		}
+		if !errors.ConnectionLost.Match(err) || c.SyncedGTIDSet() == nil || len(c.opts.FailoverHosts) == 0 {
+			return
+		}
+		if err := c.failover(ctx); err != nil {
+			if !c.isClosed() && c.opts.Log.IsInfo() {
+				c.opts.Log.Info("[mycanal] Canal failover has failed", log.Err(err))
+			}
+			return
+		}
 	}
 }
 
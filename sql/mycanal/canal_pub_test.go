@@ -65,7 +65,7 @@ func TestNewCanal_FailedMasterStatus(t *testing.T) {
 		`root:@x'err(localhost:3306)/TestDB?allowNativePasswords=false&maxAllowedPacket=0`,
 		mycanal.WithDB(dbc.DB), &mycanal.Options{})
 	assert.Nil(t, c)
-	assert.True(t, errors.MatchKind(err, errors.AlreadyClosed), "%+v", err)
+	assert.True(t, errors.AlreadyClosed.Match(err), "%+v", err)
 }
 
 func TestNewCanal_CheckBinlogRowFormat_Wrong(t *testing.T) {
@@ -79,6 +79,9 @@ func TestNewCanal_CheckBinlogRowFormat_Wrong(t *testing.T) {
 			sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
 				FromCSVString(`mysqlbin.log:0001,4711,,,`),
 		)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'gtid_binlog_pos')")).
+		WithArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}))
 	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'binlog_format')")).
 		WithArgs().
 		WillReturnRows(
@@ -90,7 +93,7 @@ func TestNewCanal_CheckBinlogRowFormat_Wrong(t *testing.T) {
 		`root:@x'err(localhost:3306)/TestDB?allowNativePasswords=false&maxAllowedPacket=0`,
 		mycanal.WithDB(dbc.DB), &mycanal.Options{})
 	assert.Nil(t, c)
-	assert.True(t, errors.MatchKind(err, errors.NotSupported), "%+v", err)
+	assert.True(t, errors.NotSupported.Match(err), "%+v", err)
 	assert.Contains(t, err.Error(), `a cat`)
 }
 
@@ -111,6 +114,9 @@ func TestNewCanal_CheckBinlogRowFormat_Error(t *testing.T) {
 			sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
 				FromCSVString(`mysqlbin.log:0001,4711,,,`),
 		)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'gtid_binlog_pos')")).
+		WithArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}))
 	wantErr := errors.NotImplemented.Newf("MySQL Syntax not implemted")
 	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'binlog_format')")).
 		WillReturnError(wantErr)
@@ -119,7 +125,7 @@ func TestNewCanal_CheckBinlogRowFormat_Error(t *testing.T) {
 		`root:@x'err(localhost:3306)/TestDB?allowNativePasswords=false&maxAllowedPacket=0`,
 		mycanal.WithDB(dbc.DB), &mycanal.Options{})
 	assert.Nil(t, c)
-	assert.True(t, errors.MatchKind(err, errors.NotImplemented), "%+v", err)
+	assert.True(t, errors.NotImplemented.Match(err), "%+v", err)
 	assert.Contains(t, err.Error(), `MySQL Syntax not implemted`)
 }
 
@@ -137,6 +143,9 @@ func newTestCanal(t *testing.T) (*mycanal.Canal, sqlmock.Sqlmock, func()) {
 			sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
 				FromCSVString(`mysqlbin.log:0001,4711,,,`),
 		)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'gtid_binlog_pos')")).
+		WithArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}))
 	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SHOW VARIABLES WHERE (`Variable_name` LIKE 'binlog_format')")).
 		WithArgs().
 		WillReturnRows(
@@ -20,6 +20,7 @@ import (
 	"github.com/corestoreio/errors"
 	"github.com/weiwolves/pkg/config"
 	"github.com/weiwolves/pkg/config/storage"
+	"github.com/weiwolves/pkg/sql/ddl"
 	"github.com/weiwolves/pkg/util/assert"
 )
 
@@ -45,6 +46,9 @@ func TestOptions_LoadFromConfigService(t *testing.T) {
 		`default/0/sql/mycanal/binlog_start_position`, "123456",
 		`default/0/sql/mycanal/binlog_slave_id`, "4711",
 		`default/0/sql/mycanal/server_flavor`, "mysql",
+		`default/0/sql/mycanal/master_gtid`, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23",
+		`default/0/sql/mycanal/master_position`, "mysql-bin.000002;236423",
+		`default/0/sql/mycanal/failover_hosts`, "db2:3306,db3:3306",
 	)).Scoped(1, 1)
 
 	o := &Options{
@@ -59,4 +63,25 @@ func TestOptions_LoadFromConfigService(t *testing.T) {
 	assert.Exactly(t, uint64(123456), o.BinlogStartPosition, "BinlogStartPosition")
 	assert.Exactly(t, uint64(4711), o.BinlogSlaveId, "BinlogSlaveId")
 	assert.Exactly(t, "mysql", o.Flavor, "Flavor")
+	assert.Exactly(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", o.BinlogStartGTID, "BinlogStartGTID")
+	assert.Exactly(t, []string{"db2:3306", "db3:3306"}, o.FailoverHosts, "FailoverHosts")
+	assert.Exactly(t, ddl.MasterStatus{File: "mysql-bin.000002", Position: 236423}, o.savedPosition, "savedPosition")
+	assert.True(t, o.resumable, "resumable")
+
+	t.Run("first run", func(t *testing.T) {
+		o := &Options{
+			ConfigScoped: config.NewFakeService(storage.NewMap()).Scoped(1, 1),
+		}
+		assert.NoError(t, o.loadFromConfigService())
+		assert.False(t, o.resumable, "resumable")
+	})
+}
+
+func TestFailoverOrder(t *testing.T) {
+	t.Parallel()
+
+	hosts := []string{"db1:3306", "db2:3306", "db3:3306"}
+	assert.Exactly(t, []string{"db3:3306", "db1:3306", "db2:3306"}, failoverOrder("db2:3306", hosts))
+	assert.Exactly(t, []string{"db2:3306", "db3:3306", "db1:3306"}, failoverOrder("db1:3306", hosts))
+	assert.Exactly(t, []string{"db1:3306", "db2:3306", "db3:3306", "db0:3306"}, failoverOrder("db0:3306", hosts))
 }
@@ -49,4 +49,37 @@
 // Thus, triggers must keep operating. On busy servers, we have seen that even
 // as the online operation throttles, the master is brought down by the load of
 // the triggers.
+//
+// Snapshot
+//
+// The binary log contains only changes. To let the RowsEventHandlers also see
+// the existing rows, enable Options.Snapshot. The tables get read in chunks
+// within one consistent read view, their rows get delivered as insert actions
+// and the binlog stream continues at the position of that read view. A
+// restarted Canal, which finds the position saved by a previous run, skips the
+// snapshot and resumes at that position.
+//
+// GTID
+//
+// If the server runs with GTIDs, Canal tracks the GTID set of each completed
+// transaction and persists it via Options.ConfigSet. A restarted Canal
+// resumes from that GTID set. Together with Options.FailoverHosts Canal
+// connects to a new primary after the connection to the current one has been
+// lost.
+//
+// Typed row changes
+//
+// Entities generated by dmlgen with the feature FeatureEntityDecodeRow
+// implement the RowDecoder interface. RegisterRowChangeHandler decodes each row
+// into such an entity and pairs the before and after images of updates, so a
+// handler receives for example *CustomerEntity instead of raw rows.
+//
+// Handler options
+//
+// RegisterRowsEventHandlerWithOptions sets an ErrorPolicy per handler: skip
+// and log, stop the syncer, retry with backoff or write the rows into a dead
+// letter table. HandlerOptions.Concurrency splits the rows of one event by
+// their primary key across parallel calls of Do. HandlerStats reports the
+// counters and the lag between writing an event and processing it.
+// DeregisterRowsEventHandler removes handlers at runtime.
 package mycanal
@@ -0,0 +1,211 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	simysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+)
+
+// withGTIDStart detects the GTID mode of the server and sets the GTID set to
+// start from. An explicit BinlogStartFile disables the GTID mode.
+func withGTIDStart(c *Canal) error {
+	if c.opts.DisableGTID || c.opts.BinlogStartFile != "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.MasterStatusQueryTimeout)
+	defer cancel()
+
+	enabled, err := detectGTIDMode(ctx, c.dbcp, c.opts.Flavor)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !enabled {
+		if c.opts.BinlogStartGTID != "" {
+			return errors.NotSupported.Newf("[mycanal] BinlogStartGTID %q has been set but the server does not run with GTIDs", c.opts.BinlogStartGTID)
+		}
+		return nil
+	}
+	c.gtidEnabled = true
+
+	gs := c.opts.BinlogStartGTID
+	if gs == "" {
+		if gs, err = executedGTIDSet(ctx, c.dbcp, c.opts.Flavor, c.masterStatus); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if gs == "" {
+		// A server without any GTID transaction. Starting with an empty set
+		// would replay all binary logs, so start at the file position and
+		// track the GTIDs after the next restart.
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("mycanal.withGTIDStart.empty_gtid_set", log.Stringer("position", c.masterStatus))
+		}
+		return nil
+	}
+
+	c.masterGTID, err = simysql.ParseGTIDSet(c.opts.Flavor, gs)
+	return errors.Wrapf(err, "[mycanal] Failed to parse GTID set %q", gs)
+}
+
+// detectGTIDMode reports whether the server writes GTIDs into the binary log.
+// MySQL requires gtid_mode=ON, MariaDB supports GTIDs since 10.0.2 without
+// any configuration.
+func detectGTIDMode(ctx context.Context, dbcp *dml.ConnPool, flavor string) (bool, error) {
+	varName := "gtid_mode"
+	if flavor == MariaDBFlavor {
+		varName = "gtid_binlog_pos"
+	}
+	v := ddl.NewVariables(varName)
+	if _, err := dbcp.WithQueryBuilder(v).Load(ctx, v); err != nil {
+		return false, errors.WithStack(err)
+	}
+	if flavor == MariaDBFlavor {
+		_, ok := v.String(varName)
+		return ok, nil
+	}
+	return v.EqualFold(varName, "ON"), nil
+}
+
+// executedGTIDSet returns the GTID set the server has written into its binary
+// log. For MySQL the set gets taken from the already loaded master status.
+func executedGTIDSet(ctx context.Context, dbcp *dml.ConnPool, flavor string, ms ddl.MasterStatus) (string, error) {
+	if flavor != MariaDBFlavor {
+		return ms.ExecutedGTIDSet, nil
+	}
+	const varName = "gtid_binlog_pos"
+	v := ddl.NewVariables(varName)
+	if _, err := dbcp.WithQueryBuilder(v).Load(ctx, v); err != nil {
+		return "", errors.WithStack(err)
+	}
+	gs, _ := v.String(varName)
+	return gs, nil
+}
+
+// failover connects to the next writable server of the FailoverHosts. The
+// host of the DSN gets tried last. The stream continues at the last GTID set.
+func (c *Canal) failover(ctx context.Context) error {
+	defer log.WhenDone(c.opts.Log).Info("myCanal.failover")
+
+	current := c.dsn.Addr
+	hosts := failoverOrder(current, c.opts.FailoverHosts)
+	for _, addr := range hosts {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		err := c.switchHost(ctx, addr)
+		if err == nil {
+			if c.opts.Log.IsInfo() {
+				c.opts.Log.Info("myCanal.failover.switched", log.String("from", current), log.String("to", addr),
+					log.Stringer("gtid", c.SyncedGTIDSet()))
+			}
+			return nil
+		}
+		if errors.AlreadyClosed.Match(err) {
+			return err
+		}
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("myCanal.failover.host.error", log.Err(err), log.String("host", addr))
+		}
+	}
+	return errors.ConnectionFailed.Newf("[mycanal] Failover failed: No writable server found in %v", hosts)
+}
+
+// failoverOrder returns the hosts to try. It starts with the host following
+// the current one and ends with the current host.
+func failoverOrder(current string, failoverHosts []string) []string {
+	hosts := make([]string, 0, len(failoverHosts)+1)
+	for i, h := range failoverHosts {
+		if h == current {
+			hosts = append(append(hosts, failoverHosts[i+1:]...), failoverHosts[:i]...)
+			return append(hosts, current)
+		}
+	}
+	hosts = append(hosts, failoverHosts...)
+	return append(hosts, current)
+}
+
+// switchHost replaces the connection pool and the syncer with new ones for
+// the host `addr`, if the server accepts writes and runs with GTIDs.
+func (c *Canal) switchHost(ctx context.Context, addr string) (err error) {
+	dsn := c.dsn.Clone()
+	dsn.Addr = addr
+
+	dbcp, err := c.dbFactory(dsn.FormatDSN())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil && c.dbcp != dbcp {
+			_ = dbcp.Close()
+		}
+	}()
+
+	qCtx, cancel := context.WithTimeout(ctx, c.opts.MasterStatusQueryTimeout)
+	defer cancel()
+
+	v := ddl.NewVariables("read_only")
+	if _, err = dbcp.WithQueryBuilder(v).Load(qCtx, v); err != nil {
+		return errors.WithStack(err)
+	}
+	if v.EqualFold("read_only", "ON") {
+		return errors.NotAllowed.Newf("[mycanal] Server %q is read only", addr)
+	}
+	enabled, err := detectGTIDMode(qCtx, dbcp, c.opts.Flavor)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !enabled {
+		return errors.NotSupported.Newf("[mycanal] Server %q does not run with GTIDs", addr)
+	}
+
+	c.mclose.Lock()
+	defer c.mclose.Unlock()
+	if c.isClosed() {
+		return errors.AlreadyClosed.Newf("[mycanal] Canal already closed")
+	}
+
+	if c.syncer != nil {
+		if err2 := c.syncer.Close(); err2 != nil && c.opts.Log.IsInfo() {
+			c.opts.Log.Info("myCanal.switchHost.syncer.close.error", log.Err(err2), log.String("host", c.dsn.Addr))
+		}
+	}
+	if err2 := c.dbcp.Close(); err2 != nil && c.opts.Log.IsInfo() {
+		c.opts.Log.Info("myCanal.switchHost.dbcp.close.error", log.Err(err2), log.String("host", c.dsn.Addr))
+	}
+
+	c.dsn = dsn
+	c.dbcp = dbcp
+	if err = c.tables.Options(ddl.WithConnPool(dbcp)); err != nil {
+		return errors.WithStack(err)
+	}
+	c.tables.DeleteAllFromCache()
+
+	// File names and positions differ between servers, only the GTID set
+	// stays valid.
+	c.masterMu.Lock()
+	c.masterStatus = ddl.MasterStatus{}
+	c.masterLastSaveTime = time.Time{}
+	c.masterMu.Unlock()
+
+	return errors.WithStack(withPrepareSyncer(c))
+}
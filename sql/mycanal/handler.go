@@ -2,6 +2,7 @@ package mycanal
 
 import (
 	"context"
+	"time"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
@@ -33,59 +34,175 @@ type RowsEventHandler interface {
 	String() string
 }
 
+// EventPosition describes the binary log position of the rows passed to
+// RowsEventHandler.Do. File and Position point to the end of the rows event,
+// which might be in the middle of a transaction. CommitFile and CommitPosition
+// point to the end of the last completed transaction and GTIDSet contains the
+// set of that transaction, if GTIDs are in use. Only the commit position and
+// the GTID set are safe to resume the binlog stream from. Timestamp reports
+// when the server has written the event. Rows of the snapshot have Snapshot
+// set to true and carry the position of the read view.
+type EventPosition struct {
+	File           string
+	Position       uint
+	CommitFile     string
+	CommitPosition uint
+	GTIDSet        string
+	Timestamp      time.Time
+	Snapshot       bool
+}
+
+type keyEventPosition struct{}
+
+// WithEventPosition adds the position to the context. Canal calls it before
+// the RowsEventHandlers run, it can be used to test a RowsEventHandler.
+func WithEventPosition(ctx context.Context, ep EventPosition) context.Context {
+	return context.WithValue(ctx, keyEventPosition{}, ep)
+}
+
+// EventPositionFromContext returns the position of the rows within the
+// RowsEventHandler.Do function.
+func EventPositionFromContext(ctx context.Context) (EventPosition, bool) {
+	ep, ok := ctx.Value(keyEventPosition{}).(EventPosition)
+	return ep, ok
+}
+
 // RegisterRowsEventHandler adds a new event handler to the internal list. If a
 // table name gets provided the event handler is bound to that exact table name,
 // if the table has not been excluded via the global regexes. An empty tableName
 // calls the event handler for all tables. If a table name already exists, the
-// RowsEventHandler gets appended to that list.
+// RowsEventHandler gets appended to that list. The handlers use the default
+// HandlerOptions.
 func (c *Canal) RegisterRowsEventHandler(tableNames []string, h ...RowsEventHandler) {
-	// TODO consider an API to Deregister all handlers for a table name
+	c.RegisterRowsEventHandlerWithOptions(tableNames, HandlerOptions{}, h...)
+}
+
+// RegisterRowsEventHandlerWithOptions same as RegisterRowsEventHandler but
+// applies the error policy and the concurrency of the options to the
+// handlers.
+func (c *Canal) RegisterRowsEventHandlerWithOptions(tableNames []string, o HandlerOptions, h ...RowsEventHandler) {
 	c.rsMu.Lock()
 	defer c.rsMu.Unlock()
 
 	if c.rsHandlers == nil {
-		c.rsHandlers = make(map[string][]RowsEventHandler)
+		c.rsHandlers = make(map[string][]*rowsEventHandler)
+	}
+	if len(tableNames) == 0 {
+		tableNames = []string{""}
 	}
 	for _, tn := range tableNames {
 		hs := c.rsHandlers[tn]
-		c.rsHandlers[tn] = append(hs, h...)
+		for _, rh := range h {
+			hs = append(hs, newRowsEventHandler(tn, rh, o))
+		}
+		c.rsHandlers[tn] = hs
 	}
-	if len(tableNames) == 0 {
-		hs := c.rsHandlers[""]
-		c.rsHandlers[""] = append(hs, h...)
+	if o.ErrorPolicy == ErrorPolicyDeadLetter {
+		if c.deadLetterTables == nil {
+			c.deadLetterTables = make(map[string]bool)
+		}
+		c.deadLetterTables[o.deadLetterTable()] = true
 	}
 }
 
-func (c *Canal) processRowsEventHandler(ctx context.Context, action string, table *ddl.Table, rows [][]interface{}) error {
-	c.rsMu.RLock()
-	defer c.rsMu.RUnlock()
+// DeregisterRowsEventHandler removes the RowsEventHandlers bound to the table
+// names and returns the number of removed handlers. An empty table name
+// addresses the handlers for all tables and nil tableNames addresses every
+// table name. Without handler names all handlers of the tables get removed,
+// otherwise only the handlers whose String function returns one of the names.
+// Running calls to Do and Complete finish.
+func (c *Canal) DeregisterRowsEventHandler(tableNames []string, handlerNames ...string) int {
+	c.rsMu.Lock()
+	defer c.rsMu.Unlock()
 
-	erg, ctx := errgroup.WithContext(ctx)
+	if tableNames == nil {
+		tableNames = make([]string, 0, len(c.rsHandlers))
+		for tn := range c.rsHandlers {
+			tableNames = append(tableNames, tn)
+		}
+	}
 
-	errGoFn := func(h RowsEventHandler) func() error {
-		return func() error {
-			if err := h.Do(ctx, action, table, rows); err != nil {
-				isInterr := errors.MatchKind(err, errors.Interrupted)
-				if c.opts.Log.IsDebug() {
-					c.opts.Log.Debug("myCanal.processRowsEventHandler.Go.Do.error", log.Err(err), log.Stringer("handler_name", h),
-						log.Bool("is_interrupted", isInterr),
-						log.String("action", action), log.String("schema", c.dsn.DBName), log.String("table", table.Name))
-				}
-				if isInterr {
-					return errors.WithStack(err)
-				}
+	var removed int
+	for _, tn := range tableNames {
+		hs := c.rsHandlers[tn]
+		kept := hs[:0]
+		for _, h := range hs {
+			if len(handlerNames) > 0 && !containsString(handlerNames, h.String()) {
+				kept = append(kept, h)
+				continue
 			}
-			return nil
+			removed++
+		}
+		for i := len(kept); i < len(hs); i++ {
+			hs[i] = nil // avoid memory leaks
+		}
+		if len(kept) == 0 {
+			delete(c.rsHandlers, tn)
+		} else {
+			c.rsHandlers[tn] = kept
 		}
 	}
-	if hs, ok := c.rsHandlers[table.Name]; ok && table.Name != "" {
+
+	// Rebuild the dead letter tables, other handlers might still use them.
+	c.deadLetterTables = nil
+	for _, hs := range c.rsHandlers {
 		for _, h := range hs {
-			erg.Go(errGoFn(h))
+			if h.o.ErrorPolicy != ErrorPolicyDeadLetter {
+				continue
+			}
+			if c.deadLetterTables == nil {
+				c.deadLetterTables = make(map[string]bool)
+			}
+			c.deadLetterTables[h.o.deadLetterTable()] = true
+		}
+	}
+	return removed
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
 		}
 	}
+	return false
+}
+
+// hasRowsEventHandler reports whether at least one RowsEventHandler gets
+// called for the table.
+func (c *Canal) hasRowsEventHandler(tableName string) bool {
+	c.rsMu.RLock()
+	defer c.rsMu.RUnlock()
+	return len(c.rsHandlers[""]) > 0 || len(c.rsHandlers[tableName]) > 0
+}
+
+// rowsEventHandlers returns the handlers for the table. The lock gets only
+// held while copying, so handlers can be deregistered while others run.
+func (c *Canal) rowsEventHandlers(tableName string) []*rowsEventHandler {
+	c.rsMu.RLock()
+	defer c.rsMu.RUnlock()
+	if c.deadLetterTables[tableName] {
+		return nil
+	}
+	var hs []*rowsEventHandler
+	if tableName != "" {
+		hs = append(hs, c.rsHandlers[tableName]...)
+	}
+	return append(hs, c.rsHandlers[""]...)
+}
 
-	for _, h := range c.rsHandlers[""] {
-		erg.Go(errGoFn(h))
+func (c *Canal) processRowsEventHandler(ctx context.Context, action string, table *ddl.Table, rows [][]interface{}) error {
+	hs := c.rowsEventHandlers(table.Name)
+	if len(hs) == 0 {
+		return nil
+	}
+
+	erg, ctx := errgroup.WithContext(ctx)
+	for _, h := range hs {
+		h := h
+		erg.Go(func() error {
+			return c.handleRows(ctx, h, action, table, rows)
+		})
 	}
 	return errors.WithStack(erg.Wait())
 }
@@ -93,25 +210,19 @@ func (c *Canal) processRowsEventHandler(ctx context.Context, action string, tabl
 func (c *Canal) flushEventHandlers(ctx context.Context) error {
 	defer log.WhenDone(c.opts.Log).Info("myCanal.flushEventHandlers")
 	c.rsMu.RLock()
-	defer c.rsMu.RUnlock()
+	var hs []*rowsEventHandler
+	for _, ths := range c.rsHandlers {
+		hs = append(hs, ths...)
+	}
+	c.rsMu.RUnlock()
 
 	erg, ctx := errgroup.WithContext(ctx)
 
-	for tblName, hs := range c.rsHandlers {
-		for _, h := range hs {
-			h := h
-			erg.Go(func() error {
-				if err := h.Complete(ctx); err != nil {
-					isInterr := errors.MatchKind(err, errors.Interrupted)
-					c.opts.Log.Info("myCanal.flushEventHandlers.Go.Complete.error",
-						log.Err(err), log.Bool("is_interrupted", isInterr), log.Stringer("handler_name", h), log.String("table_name", tblName))
-					if isInterr {
-						return errors.WithStack(err)
-					}
-				}
-				return nil
-			})
-		}
+	for _, h := range hs {
+		h := h
+		erg.Go(func() error {
+			return c.completeHandler(ctx, h)
+		})
 	}
 	return errors.Wrap(erg.Wait(), "[mycanal] flushEventHandlers errgroup Wait")
 }
@@ -0,0 +1,425 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrorPolicy defines how Canal reacts if RowsEventHandler.Do or
+// RowsEventHandler.Complete returns an error. An error with behaviour
+// "Interrupted" stops the syncer independent of the policy.
+type ErrorPolicy uint8
+
+// Error policies of a RowsEventHandler.
+const (
+	// ErrorPolicySkip logs the error and continues with the next event. The
+	// rows get lost for this handler. Default policy.
+	ErrorPolicySkip ErrorPolicy = iota
+	// ErrorPolicyStop stops the syncer. The binlog position does not get
+	// saved, so a restarted Canal delivers the event again.
+	ErrorPolicyStop
+	// ErrorPolicyRetry calls Do or Complete again with an exponential backoff
+	// and stops the syncer after HandlerOptions.MaxAttempts failed attempts.
+	ErrorPolicyRetry
+	// ErrorPolicyDeadLetter writes the rows, the binlog position and the error
+	// into HandlerOptions.DeadLetterTable and continues. The syncer stops if
+	// the rows cannot be written. The table must exist within the database of
+	// Canal, its events get never passed to a handler. A failed Complete gets
+	// written with the action `complete` and without rows:
+	//
+	//	CREATE TABLE `mycanal_dead_letter` (
+	//	  `id` bigint unsigned NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	//	  `handler` varchar(255) NOT NULL,
+	//	  `table_name` varchar(64) NOT NULL,
+	//	  `action` varchar(10) NOT NULL,
+	//	  `binlog_file` varchar(255) NOT NULL,
+	//	  `binlog_position` bigint unsigned NOT NULL,
+	//	  `gtid_set` text NOT NULL,
+	//	  `event_time` datetime NULL,
+	//	  `rows` longtext NOT NULL,
+	//	  `error` text NOT NULL,
+	//	  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	//	);
+	ErrorPolicyDeadLetter
+)
+
+// DefaultDeadLetterTable gets used by ErrorPolicyDeadLetter if
+// HandlerOptions.DeadLetterTable is empty.
+const DefaultDeadLetterTable = "mycanal_dead_letter"
+
+// completeAction marks the dead letters of a failed RowsEventHandler.Complete.
+const completeAction = "complete"
+
+// HandlerOptions configures the error handling and the concurrency of a
+// RowsEventHandler. The zero value calls Do once per event and skips the rows
+// on error.
+type HandlerOptions struct {
+	ErrorPolicy ErrorPolicy
+	// MaxAttempts defines the calls to Do of ErrorPolicyRetry. Default 3.
+	MaxAttempts int
+	// RetryBackoff defines the wait time before the second attempt, it
+	// doubles for each further attempt. Default 100ms.
+	RetryBackoff time.Duration
+	// DeadLetterTable defines the table of ErrorPolicyDeadLetter. Default
+	// DefaultDeadLetterTable.
+	DeadLetterTable string
+	// Concurrency defines the maximum number of parallel calls to Do for the
+	// rows of one event. The rows get partitioned by the hash of their primary
+	// key, so all changes of a row get passed in order to the same call. The
+	// rows of tables without primary key and of update events with a changed
+	// primary key get never split. Events get still processed one after
+	// another. Default 1.
+	Concurrency int
+}
+
+func (o HandlerOptions) deadLetterTable() string {
+	if o.DeadLetterTable == "" {
+		return DefaultDeadLetterTable
+	}
+	return o.DeadLetterTable
+}
+
+// HandlerStats contains the counters of a RowsEventHandler since its
+// registration. Lag measures the time between writing the event on the
+// server and the return of Do. The binary log stores seconds, so the lag has
+// an inaccuracy of up to one second. Rows of the snapshot do not affect the
+// lag.
+type HandlerStats struct {
+	// Table contains the table name the handler has been registered for, an
+	// empty string for all tables.
+	Table   string
+	Handler string
+	// Calls counts the successful calls to Do.
+	Calls uint64
+	// Rows counts the rows passed to the successful calls of Do.
+	Rows uint64
+	// Errors counts the failed calls after all attempts.
+	Errors uint64
+	// Retries counts the repeated calls of ErrorPolicyRetry.
+	Retries uint64
+	// SkippedRows counts the rows dropped by ErrorPolicySkip.
+	SkippedRows uint64
+	// DeadLetterRows counts the rows written by ErrorPolicyDeadLetter.
+	DeadLetterRows uint64
+	// LastEventTime contains the time when the server has written the last
+	// processed event.
+	LastEventTime time.Time
+	LastLag       time.Duration
+	MaxLag        time.Duration
+}
+
+// rowsEventHandler wraps a registered RowsEventHandler with its options and
+// counters.
+type rowsEventHandler struct {
+	RowsEventHandler
+	table string
+	o     HandlerOptions
+
+	mu    sync.Mutex
+	stats HandlerStats
+}
+
+func newRowsEventHandler(table string, h RowsEventHandler, o HandlerOptions) *rowsEventHandler {
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	return &rowsEventHandler{
+		RowsEventHandler: h,
+		table:            table,
+		o:                o,
+		stats: HandlerStats{
+			Table:   table,
+			Handler: h.String(),
+		},
+	}
+}
+
+// attempts returns the number of calls to Do or Complete before the error
+// policy applies.
+func (h *rowsEventHandler) attempts() int {
+	if h.o.ErrorPolicy == ErrorPolicyRetry {
+		return h.o.MaxAttempts
+	}
+	return 1
+}
+
+func (h *rowsEventHandler) count(fn func(s *HandlerStats)) {
+	h.mu.Lock()
+	fn(&h.stats)
+	h.mu.Unlock()
+}
+
+// HandlerStats returns the counters of all registered RowsEventHandlers,
+// sorted by table and handler name.
+func (c *Canal) HandlerStats() []HandlerStats {
+	c.rsMu.RLock()
+	var hs []*rowsEventHandler
+	for _, ths := range c.rsHandlers {
+		hs = append(hs, ths...)
+	}
+	c.rsMu.RUnlock()
+
+	stats := make([]HandlerStats, 0, len(hs))
+	for _, h := range hs {
+		h.mu.Lock()
+		stats = append(stats, h.stats)
+		h.mu.Unlock()
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Table != stats[j].Table {
+			return stats[i].Table < stats[j].Table
+		}
+		return stats[i].Handler < stats[j].Handler
+	})
+	return stats
+}
+
+// handleRows passes the rows to the handler, in parallel if the options allow
+// it.
+func (c *Canal) handleRows(ctx context.Context, h *rowsEventHandler, action string, t *ddl.Table, rows [][]interface{}) error {
+	parts := partitionRows(h.o.Concurrency, action, t, rows)
+	if len(parts) == 1 {
+		return c.callHandler(ctx, h, action, t, parts[0])
+	}
+	erg, ctx := errgroup.WithContext(ctx)
+	for _, p := range parts {
+		p := p
+		erg.Go(func() error {
+			return c.callHandler(ctx, h, action, t, p)
+		})
+	}
+	return errors.WithStack(erg.Wait())
+}
+
+// withRetry calls fn once or, with ErrorPolicyRetry, up to MaxAttempts times
+// with an exponential backoff. Cancelled reports whether the context has ended
+// while waiting for the next attempt.
+func (c *Canal) withRetry(ctx context.Context, h *rowsEventHandler, fn func() error) (cancelled bool, err error) {
+	backoff := h.o.RetryBackoff
+	for i := 0; i < h.attempts(); i++ {
+		if i > 0 {
+			h.count(func(s *HandlerStats) { s.Retries++ })
+			select {
+			case <-ctx.Done():
+				return true, errors.WithStack(ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = fn(); err == nil || errors.Interrupted.Match(err) {
+			return false, err
+		}
+	}
+	return false, err
+}
+
+// callHandler calls Do and applies the error policy.
+func (c *Canal) callHandler(ctx context.Context, h *rowsEventHandler, action string, t *ddl.Table, rows [][]interface{}) error {
+	cancelled, err := c.withRetry(ctx, h, func() error {
+		return h.Do(ctx, action, t, rows)
+	})
+	if err == nil {
+		c.countSuccess(ctx, h, len(rows))
+		return nil
+	}
+	if cancelled {
+		return err
+	}
+
+	h.count(func(s *HandlerStats) { s.Errors++ })
+	isInterr := errors.Interrupted.Match(err)
+	if c.opts.Log.IsInfo() {
+		c.opts.Log.Info("myCanal.callHandler.Do.error", log.Err(err), log.Stringer("handler_name", h),
+			log.Bool("is_interrupted", isInterr), log.Int("error_policy", int(h.o.ErrorPolicy)),
+			log.String("action", action), log.String("schema", c.dsn.DBName), log.String("table", t.Name), log.Int("rows", len(rows)))
+	}
+
+	switch {
+	case isInterr:
+		return errors.WithStack(err)
+	case h.o.ErrorPolicy == ErrorPolicyStop, h.o.ErrorPolicy == ErrorPolicyRetry:
+		return errors.Interrupted.New(err, "[mycanal] Handler %q failed for table %q after %d attempt(s)", h, t.Name, h.attempts())
+	case h.o.ErrorPolicy == ErrorPolicyDeadLetter:
+		if dlErr := c.writeDeadLetter(ctx, h, action, t.Name, rows, err); dlErr != nil {
+			return errors.Interrupted.New(dlErr, "[mycanal] Handler %q failed to write the dead letter for table %q: %s", h, t.Name, err)
+		}
+		h.count(func(s *HandlerStats) { s.DeadLetterRows += uint64(len(rows)) })
+	default:
+		h.count(func(s *HandlerStats) { s.SkippedRows += uint64(len(rows)) })
+	}
+	return nil
+}
+
+// completeHandler calls Complete and applies the error policy.
+func (c *Canal) completeHandler(ctx context.Context, h *rowsEventHandler) error {
+	cancelled, err := c.withRetry(ctx, h, func() error {
+		return h.Complete(ctx)
+	})
+	if err == nil || cancelled {
+		return err
+	}
+
+	h.count(func(s *HandlerStats) { s.Errors++ })
+	isInterr := errors.Interrupted.Match(err)
+	if c.opts.Log.IsInfo() {
+		c.opts.Log.Info("myCanal.completeHandler.Complete.error", log.Err(err), log.Stringer("handler_name", h),
+			log.Bool("is_interrupted", isInterr), log.Int("error_policy", int(h.o.ErrorPolicy)), log.String("table_name", h.table))
+	}
+
+	switch {
+	case isInterr:
+		return errors.Interrupted.New(err, "[mycanal] Handler %q failed to complete", h)
+	case h.o.ErrorPolicy == ErrorPolicyStop, h.o.ErrorPolicy == ErrorPolicyRetry:
+		return errors.Interrupted.New(err, "[mycanal] Handler %q failed to complete after %d attempt(s)", h, h.attempts())
+	case h.o.ErrorPolicy == ErrorPolicyDeadLetter:
+		if dlErr := c.writeDeadLetter(ctx, h, completeAction, h.table, nil, err); dlErr != nil {
+			return errors.Interrupted.New(dlErr, "[mycanal] Handler %q failed to write the dead letter of Complete: %s", h, err)
+		}
+	}
+	return nil
+}
+
+func (c *Canal) countSuccess(ctx context.Context, h *rowsEventHandler, rows int) {
+	ep, ok := EventPositionFromContext(ctx)
+	var lag time.Duration
+	if ok && !ep.Snapshot && !ep.Timestamp.IsZero() {
+		lag = time.Since(ep.Timestamp)
+	}
+	h.count(func(s *HandlerStats) {
+		s.Calls++
+		s.Rows += uint64(rows)
+		if ok && !ep.Snapshot && !ep.Timestamp.IsZero() {
+			s.LastEventTime = ep.Timestamp
+			s.LastLag = lag
+			if lag > s.MaxLag {
+				s.MaxLag = lag
+			}
+		}
+	})
+}
+
+func (c *Canal) writeDeadLetter(ctx context.Context, h *rowsEventHandler, action, tableName string, rows [][]interface{}, handlerErr error) error {
+	if c.dbcp == nil {
+		return errors.NotSupported.Newf("[mycanal] Database connection is nil")
+	}
+	rowsJSON, err := json.Marshal(deadLetterRows(rows))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ep, _ := EventPositionFromContext(ctx)
+	var eventTime interface{}
+	if !ep.Timestamp.IsZero() {
+		eventTime = ep.Timestamp.UTC()
+	}
+
+	ins := dml.NewInsert(h.o.deadLetterTable()).AddColumns(
+		"handler", "table_name", "action", "binlog_file", "binlog_position", "gtid_set", "event_time", "rows", "error",
+	).BuildValues()
+	_, err = c.dbcp.WithQueryBuilder(ins).ExecContext(ctx,
+		h.String(), tableName, action, ep.File, uint64(ep.Position), ep.GTIDSet, eventTime, string(rowsJSON), handlerErr.Error(),
+	)
+	return errors.WithStack(err)
+}
+
+// deadLetterRows converts UTF-8 byte slices to strings, so they are readable
+// in the JSON. Other byte slices become base64 encoded.
+func deadLetterRows(rows [][]interface{}) [][]interface{} {
+	ret := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		ret[i] = make([]interface{}, len(row))
+		for j, v := range row {
+			if b, ok := v.([]byte); ok && utf8.Valid(b) {
+				v = string(b)
+			}
+			ret[i][j] = v
+		}
+	}
+	return ret
+}
+
+// partitionRows splits the rows into up to n partitions by the hash of their
+// primary key. Update rows stay in pairs of before and after image. The order
+// of the rows within a partition stays the same.
+func partitionRows(n int, action string, t *ddl.Table, rows [][]interface{}) [][][]interface{} {
+	step := 1
+	if action == UpdateAction {
+		step = 2
+	}
+	if n < 2 || len(rows) <= step {
+		return [][][]interface{}{rows}
+	}
+	var pks []int
+	for i, c := range t.Columns {
+		if c.IsPK() {
+			pks = append(pks, i)
+		}
+	}
+	if len(pks) == 0 {
+		return [][][]interface{}{rows}
+	}
+
+	keys := make([]uint32, 0, len(rows)/step)
+	for i := 0; i+step <= len(rows); i += step {
+		k := pkHash(pks, rows[i])
+		if step == 2 && k != pkHash(pks, rows[i+1]) {
+			// A changed primary key can conflict with another row of the event.
+			return [][][]interface{}{rows}
+		}
+		keys = append(keys, k)
+	}
+
+	parts := make([][][]interface{}, n)
+	for i, k := range keys {
+		p := k % uint32(n)
+		parts[p] = append(parts[p], rows[i*step:i*step+step]...)
+	}
+	ret := parts[:0]
+	for _, p := range parts {
+		if len(p) > 0 {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+func pkHash(pks []int, row []interface{}) uint32 {
+	h := fnv.New32a()
+	for _, i := range pks {
+		if i < len(row) {
+			fmt.Fprintf(h, "%v\x00", row[i])
+		}
+	}
+	return h.Sum32()
+}
@@ -0,0 +1,318 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/go-sql-driver/mysql"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+type testPolicyHandler struct {
+	name string
+	// failures defines the number of calls returning err.
+	failures int
+	// completeFailures defines the number of calls to Complete returning err.
+	completeFailures int
+	err              error
+
+	mu        sync.Mutex
+	calls     int
+	completes int
+	rows      [][]interface{}
+}
+
+func (h *testPolicyHandler) Do(_ context.Context, _ string, _ *ddl.Table, rows [][]interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	if h.calls <= h.failures {
+		return h.err
+	}
+	h.rows = append(h.rows, rows...)
+	return nil
+}
+
+func (h *testPolicyHandler) Complete(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.completes++
+	if h.completes <= h.completeFailures {
+		return h.err
+	}
+	return nil
+}
+
+func (h *testPolicyHandler) String() string { return h.name }
+
+func newTestPolicyCanal() *Canal {
+	return &Canal{
+		opts: Options{Log: log.BlackHole{}},
+		dsn:  &mysql.Config{DBName: "shop"},
+	}
+}
+
+var testPolicyTable = ddl.NewTable("customer",
+	&ddl.Column{Field: "id", Key: "PRI", DataType: "int", ColumnType: "int(10) unsigned"},
+	&ddl.Column{Field: "name", DataType: "varchar", ColumnType: "varchar(255)"},
+)
+
+func TestCanal_DeregisterRowsEventHandler(t *testing.T) {
+	t.Parallel()
+
+	c := newTestPolicyCanal()
+	c.RegisterRowsEventHandler([]string{"customer", "order"}, &testPolicyHandler{name: "h1"}, &testPolicyHandler{name: "h2"})
+	c.RegisterRowsEventHandler(nil, &testPolicyHandler{name: "h3"})
+	assert.Len(t, c.HandlerStats(), 5)
+
+	assert.Exactly(t, 1, c.DeregisterRowsEventHandler([]string{"customer"}, "h1"))
+	assert.Exactly(t, 0, c.DeregisterRowsEventHandler([]string{"customer"}, "h1"))
+	assert.Len(t, c.rowsEventHandlers("customer"), 2)
+
+	assert.Exactly(t, 1, c.DeregisterRowsEventHandler([]string{""}))
+	assert.False(t, c.hasRowsEventHandler("invoice"))
+
+	assert.Exactly(t, 2, c.DeregisterRowsEventHandler(nil, "h2"))
+	stats := c.HandlerStats()
+	assert.Len(t, stats, 1)
+	assert.Exactly(t, "order", stats[0].Table)
+	assert.Exactly(t, "h1", stats[0].Handler)
+
+	assert.Exactly(t, 1, c.DeregisterRowsEventHandler(nil))
+	assert.Len(t, c.rsHandlers, 0)
+}
+
+func TestCanal_ErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	rows := [][]interface{}{{int32(1), "Ada"}}
+	errTemp := errors.Temporary.Newf("temporary failure")
+
+	run := func(o HandlerOptions, h *testPolicyHandler) (HandlerStats, error) {
+		c := newTestPolicyCanal()
+		c.RegisterRowsEventHandlerWithOptions([]string{"customer"}, o, h)
+		err := c.processRowsEventHandler(context.Background(), InsertAction, testPolicyTable, rows)
+		return c.HandlerStats()[0], err
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		s, err := run(HandlerOptions{}, &testPolicyHandler{failures: 1, err: errTemp})
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(1), s.Errors)
+		assert.Exactly(t, uint64(1), s.SkippedRows)
+		assert.Exactly(t, uint64(0), s.Calls)
+	})
+	t.Run("skip interrupted", func(t *testing.T) {
+		_, err := run(HandlerOptions{}, &testPolicyHandler{failures: 1, err: errors.Interrupted.Newf("stop")})
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+	})
+	t.Run("stop", func(t *testing.T) {
+		s, err := run(HandlerOptions{ErrorPolicy: ErrorPolicyStop}, &testPolicyHandler{failures: 1, err: errTemp})
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+		assert.Exactly(t, uint64(1), s.Errors)
+	})
+	t.Run("retry succeeds", func(t *testing.T) {
+		h := &testPolicyHandler{failures: 2, err: errTemp}
+		s, err := run(HandlerOptions{ErrorPolicy: ErrorPolicyRetry, RetryBackoff: time.Millisecond}, h)
+		assert.NoError(t, err)
+		assert.Exactly(t, 3, h.calls)
+		assert.Exactly(t, uint64(2), s.Retries)
+		assert.Exactly(t, uint64(1), s.Calls)
+		assert.Exactly(t, uint64(1), s.Rows)
+		assert.Exactly(t, uint64(0), s.Errors)
+	})
+	t.Run("retry fails", func(t *testing.T) {
+		h := &testPolicyHandler{failures: 5, err: errTemp}
+		s, err := run(HandlerOptions{ErrorPolicy: ErrorPolicyRetry, MaxAttempts: 2, RetryBackoff: time.Millisecond}, h)
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+		assert.Exactly(t, 2, h.calls)
+		assert.Exactly(t, uint64(1), s.Retries)
+		assert.Exactly(t, uint64(1), s.Errors)
+	})
+	t.Run("retry interrupted", func(t *testing.T) {
+		h := &testPolicyHandler{failures: 5, err: errors.Interrupted.Newf("stop")}
+		_, err := run(HandlerOptions{ErrorPolicy: ErrorPolicyRetry, RetryBackoff: time.Millisecond}, h)
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+		assert.Exactly(t, 1, h.calls)
+	})
+}
+
+func TestCanal_ErrorPolicyDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	c := newTestPolicyCanal()
+	c.dbcp = dbc
+	c.RegisterRowsEventHandlerWithOptions([]string{"customer"}, HandlerOptions{ErrorPolicy: ErrorPolicyDeadLetter},
+		&testPolicyHandler{name: "indexer", failures: 2, err: errors.Temporary.Newf("temporary failure")})
+
+	ts := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx := WithEventPosition(context.Background(), EventPosition{File: "mysql-bin.000042", Position: 4711, Timestamp: ts})
+
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `mycanal_dead_letter` (`handler`,`table_name`,`action`,`binlog_file`,`binlog_position`,`gtid_set`,`event_time`,`rows`,`error`) VALUES (?,?,?,?,?,?,?,?,?)")).
+		WithArgs("indexer", "customer", InsertAction, "mysql-bin.000042", uint64(4711), "", ts, `[[1,"Ada"]]`, "temporary failure").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	err := c.processRowsEventHandler(ctx, InsertAction, testPolicyTable, [][]interface{}{{int32(1), []byte("Ada")}})
+	assert.NoError(t, err)
+
+	dbMock.ExpectExec("INSERT INTO `mycanal_dead_letter`").WillReturnError(errors.ConnectionLost.Newf("gone"))
+	err = c.processRowsEventHandler(ctx, InsertAction, testPolicyTable, [][]interface{}{{int32(2), "Bob"}})
+	assert.ErrorIsKind(t, errors.Interrupted, err)
+
+	s := c.HandlerStats()[0]
+	assert.Exactly(t, uint64(1), s.DeadLetterRows)
+	assert.Exactly(t, uint64(2), s.Errors)
+
+	// Events of the dead letter table never reach a handler.
+	c.RegisterRowsEventHandler(nil, &testPolicyHandler{name: "all"})
+	assert.Len(t, c.rowsEventHandlers(DefaultDeadLetterTable), 0)
+	assert.Len(t, c.rowsEventHandlers("customer"), 2)
+
+	// Without a dead letter handler the table becomes a regular table.
+	assert.Exactly(t, 1, c.DeregisterRowsEventHandler([]string{"customer"}, "indexer"))
+	assert.Len(t, c.rowsEventHandlers(DefaultDeadLetterTable), 1)
+}
+
+func TestCanal_ErrorPolicyComplete(t *testing.T) {
+	t.Parallel()
+
+	errTemp := errors.Temporary.Newf("temporary failure")
+
+	run := func(c *Canal, o HandlerOptions, h *testPolicyHandler) (HandlerStats, error) {
+		c.RegisterRowsEventHandlerWithOptions([]string{"customer"}, o, h)
+		err := c.flushEventHandlers(context.Background())
+		return c.HandlerStats()[0], err
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		s, err := run(newTestPolicyCanal(), HandlerOptions{}, &testPolicyHandler{completeFailures: 1, err: errTemp})
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(1), s.Errors)
+	})
+	t.Run("stop", func(t *testing.T) {
+		_, err := run(newTestPolicyCanal(), HandlerOptions{ErrorPolicy: ErrorPolicyStop}, &testPolicyHandler{completeFailures: 1, err: errTemp})
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+	})
+	t.Run("retry succeeds", func(t *testing.T) {
+		h := &testPolicyHandler{completeFailures: 2, err: errTemp}
+		s, err := run(newTestPolicyCanal(), HandlerOptions{ErrorPolicy: ErrorPolicyRetry, RetryBackoff: time.Millisecond}, h)
+		assert.NoError(t, err)
+		assert.Exactly(t, 3, h.completes)
+		assert.Exactly(t, uint64(2), s.Retries)
+		assert.Exactly(t, uint64(0), s.Errors)
+	})
+	t.Run("retry fails", func(t *testing.T) {
+		h := &testPolicyHandler{completeFailures: 5, err: errTemp}
+		s, err := run(newTestPolicyCanal(), HandlerOptions{ErrorPolicy: ErrorPolicyRetry, MaxAttempts: 2, RetryBackoff: time.Millisecond}, h)
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+		assert.Exactly(t, 2, h.completes)
+		assert.Exactly(t, uint64(1), s.Errors)
+	})
+	t.Run("dead letter", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `mycanal_dead_letter` (`handler`,`table_name`,`action`,`binlog_file`,`binlog_position`,`gtid_set`,`event_time`,`rows`,`error`) VALUES (?,?,?,?,?,?,?,?,?)")).
+			WithArgs("indexer", "customer", "complete", "", uint64(0), "", nil, `[]`, "temporary failure").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		dbMock.ExpectExec("INSERT INTO `mycanal_dead_letter`").WillReturnError(errors.ConnectionLost.Newf("gone"))
+
+		c := newTestPolicyCanal()
+		c.dbcp = dbc
+		h := &testPolicyHandler{name: "indexer", completeFailures: 2, err: errTemp}
+		s, err := run(c, HandlerOptions{ErrorPolicy: ErrorPolicyDeadLetter}, h)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(1), s.Errors)
+
+		err = c.flushEventHandlers(context.Background())
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+	})
+}
+
+func TestCanal_HandlerConcurrency(t *testing.T) {
+	t.Parallel()
+
+	c := newTestPolicyCanal()
+	h := &testPolicyHandler{name: "parallel"}
+	c.RegisterRowsEventHandlerWithOptions(nil, HandlerOptions{Concurrency: 4}, h)
+
+	var rows [][]interface{}
+	for i := 0; i < 100; i++ {
+		rows = append(rows, []interface{}{int32(i % 10), "before"}, []interface{}{int32(i % 10), "after"})
+	}
+	ctx := WithEventPosition(context.Background(), EventPosition{Timestamp: time.Now().Add(-2 * time.Second)})
+	assert.NoError(t, c.processRowsEventHandler(ctx, UpdateAction, testPolicyTable, rows))
+
+	assert.Len(t, h.rows, 200)
+	assert.True(t, h.calls > 1 && h.calls <= 4, "calls %d", h.calls)
+	// The pairs of one primary key stay together and in order.
+	for i := 0; i < len(h.rows); i += 2 {
+		assert.Exactly(t, h.rows[i][0], h.rows[i+1][0])
+		assert.Exactly(t, "before", h.rows[i][1])
+		assert.Exactly(t, "after", h.rows[i+1][1])
+	}
+
+	s := c.HandlerStats()[0]
+	assert.Exactly(t, uint64(h.calls), s.Calls)
+	assert.Exactly(t, uint64(200), s.Rows)
+	assert.True(t, s.LastLag >= 2*time.Second, "lag %s", s.LastLag)
+	assert.True(t, s.MaxLag >= s.LastLag)
+}
+
+func TestPartitionRows(t *testing.T) {
+	t.Parallel()
+
+	rows := [][]interface{}{{int32(1), "a"}, {int32(2), "b"}, {int32(1), "c"}, {int32(3), "d"}}
+
+	t.Run("no concurrency", func(t *testing.T) {
+		assert.Len(t, partitionRows(1, InsertAction, testPolicyTable, rows), 1)
+	})
+	t.Run("without primary key", func(t *testing.T) {
+		tbl := ddl.NewTable("log", &ddl.Column{Field: "id"}, &ddl.Column{Field: "msg"})
+		assert.Len(t, partitionRows(4, InsertAction, tbl, rows), 1)
+	})
+	t.Run("changed primary key", func(t *testing.T) {
+		upd := [][]interface{}{{int32(1), "a"}, {int32(5), "a"}, {int32(2), "b"}, {int32(2), "c"}}
+		assert.Len(t, partitionRows(4, UpdateAction, testPolicyTable, upd), 1)
+	})
+	t.Run("keeps order per key", func(t *testing.T) {
+		parts := partitionRows(8, InsertAction, testPolicyTable, rows)
+		var total int
+		for _, p := range parts {
+			total += len(p)
+			var seenA bool
+			for _, r := range p {
+				if r[1] == "a" {
+					seenA = true
+				}
+				if r[1] == "c" {
+					assert.True(t, seenA, "row c must follow row a")
+				}
+			}
+		}
+		assert.Exactly(t, 4, total)
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+)
+
+// RowDecoder gets implemented by the entities generated with dmlgen and the
+// feature FeatureEntityDecodeRow. DecodeRow assigns the values of one row of
+// the binary log to the fields of the entity. Argument columns contains the
+// column names in the order of the values.
+type RowDecoder interface {
+	DecodeRow(columns []string, values []interface{}) error
+}
+
+// RowChange describes the change of one row. For InsertAction only After has
+// been set, for DeleteAction only Before and for UpdateAction both fields.
+// Before and After contain the types returned by the newDecoder function of
+// RegisterRowChangeHandler. The Table must only be used for reading.
+type RowChange struct {
+	Action string
+	Table  *ddl.Table
+	Before RowDecoder
+	After  RowDecoder
+}
+
+// RowChangeFunc handles a typed row change. Same error rules apply as for
+// RowsEventHandler.Do.
+type RowChangeFunc func(context.Context, RowChange) error
+
+// RegisterRowChangeHandler registers a handler for the table which receives
+// typed row changes instead of the raw rows. newDecoder must return a new
+// instance of the generated entity for each row, for example:
+//
+//	c.RegisterRowChangeHandler("customer_entity",
+//		func() mycanal.RowDecoder { return new(CustomerEntity) },
+//		func(ctx context.Context, rc mycanal.RowChange) error {
+//			ce := rc.After.(*CustomerEntity)
+//			// ...
+//			return nil
+//		})
+//
+// The handler runs like any other RowsEventHandler and gets called once per
+// row.
+func (c *Canal) RegisterRowChangeHandler(tableName string, newDecoder func() RowDecoder, fn RowChangeFunc) {
+	c.RegisterRowsEventHandler([]string{tableName}, &rowChangeHandler{
+		tableName:  tableName,
+		newDecoder: newDecoder,
+		fn:         fn,
+	})
+}
+
+// rowChangeHandler converts the raw rows into RowChange events.
+type rowChangeHandler struct {
+	tableName  string
+	newDecoder func() RowDecoder
+	fn         RowChangeFunc
+}
+
+func (h *rowChangeHandler) Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	columns := t.Columns.FieldNames()
+
+	if action == UpdateAction {
+		// Update events contain the rows in pairs of [before, after].
+		if len(rows)%2 != 0 {
+			return errors.Mismatch.Newf("[mycanal] Table %q: Update event contains an odd number of %d rows", t.Name, len(rows))
+		}
+		for i := 0; i < len(rows); i += 2 {
+			rc := RowChange{Action: action, Table: t}
+			var err error
+			if rc.Before, err = h.decode(t, columns, rows[i]); err != nil {
+				return errors.WithStack(err)
+			}
+			if rc.After, err = h.decode(t, columns, rows[i+1]); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := h.fn(ctx, rc); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	}
+
+	for _, row := range rows {
+		rd, err := h.decode(t, columns, row)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rc := RowChange{Action: action, Table: t}
+		if action == DeleteAction {
+			rc.Before = rd
+		} else {
+			rc.After = rd
+		}
+		if err := h.fn(ctx, rc); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (h *rowChangeHandler) decode(t *ddl.Table, columns []string, row []interface{}) (RowDecoder, error) {
+	if len(row) != len(t.Columns) {
+		return nil, errors.Mismatch.Newf("[mycanal] Table %q: Row contains %d values but the table %d columns", t.Name, len(row), len(t.Columns))
+	}
+	values := make([]interface{}, len(row))
+	for i, v := range row {
+		values[i] = unsignedValue(t.Columns[i], v)
+	}
+	rd := h.newDecoder()
+	if err := rd.DecodeRow(columns, values); err != nil {
+		return nil, errors.Wrapf(err, "[mycanal] Table %q: Failed to decode row", t.Name)
+	}
+	return rd, nil
+}
+
+func (h *rowChangeHandler) Complete(context.Context) error { return nil }
+
+func (h *rowChangeHandler) String() string { return "RowChangeHandler:" + h.tableName }
+
+// unsignedValue converts the signed integers of the binlog decoder into
+// unsigned integers, if the column has been declared as unsigned.
+func unsignedValue(c *ddl.Column, v interface{}) interface{} {
+	if !c.IsUnsigned() {
+		return v
+	}
+	switch val := v.(type) {
+	case int8:
+		return uint8(val)
+	case int16:
+		return uint16(val)
+	case int32:
+		if c.DataType == "mediumint" {
+			return uint32(val) & 0xffffff
+		}
+		return uint32(val)
+	case int64:
+		return uint64(val)
+	}
+	return v
+}
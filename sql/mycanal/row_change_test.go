@@ -0,0 +1,117 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+type testRowEntity struct {
+	EntityID uint32
+	StoreID  uint16
+	Value    string
+}
+
+func (e *testRowEntity) DecodeRow(columns []string, values []interface{}) error {
+	cm := dml.NewColumnMap(0, columns...)
+	if err := cm.ScanValues(values...); err != nil {
+		return errors.WithStack(err)
+	}
+	for cm.Next() {
+		switch c := cm.Column(); c {
+		case "entity_id":
+			cm.Uint32(&e.EntityID)
+		case "store_id":
+			cm.Uint16(&e.StoreID)
+		case "value":
+			cm.String(&e.Value)
+		default:
+			return errors.NotFound.Newf("[mycanal_test] Column %q not found", c)
+		}
+	}
+	return errors.WithStack(cm.Err())
+}
+
+func TestRowChangeHandler(t *testing.T) {
+	t.Parallel()
+
+	tbl := ddl.NewTable("catalog_product_entity_varchar",
+		&ddl.Column{Field: "entity_id", Key: "PRI", DataType: "int", ColumnType: "int(10) unsigned"},
+		&ddl.Column{Field: "store_id", Key: "PRI", DataType: "smallint", ColumnType: "smallint(5) unsigned"},
+		&ddl.Column{Field: "value", DataType: "varchar", ColumnType: "varchar(255)"},
+	)
+
+	newHandler := func(changes *[]RowChange) *rowChangeHandler {
+		return &rowChangeHandler{
+			tableName:  tbl.Name,
+			newDecoder: func() RowDecoder { return new(testRowEntity) },
+			fn: func(_ context.Context, rc RowChange) error {
+				*changes = append(*changes, rc)
+				return nil
+			},
+		}
+	}
+
+	t.Run("update pairs", func(t *testing.T) {
+		var changes []RowChange
+		err := newHandler(&changes).Do(context.Background(), UpdateAction, tbl, [][]interface{}{
+			{int32(-1), int16(1), "before"},
+			{int32(-1), int16(1), "after"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+		assert.Exactly(t, &testRowEntity{EntityID: 4294967295, StoreID: 1, Value: "before"}, changes[0].Before)
+		assert.Exactly(t, &testRowEntity{EntityID: 4294967295, StoreID: 1, Value: "after"}, changes[0].After)
+	})
+	t.Run("update odd rows", func(t *testing.T) {
+		var changes []RowChange
+		err := newHandler(&changes).Do(context.Background(), UpdateAction, tbl, [][]interface{}{
+			{int32(1), int16(1), "before"},
+		})
+		assert.ErrorIsKind(t, errors.Mismatch, err)
+		assert.Len(t, changes, 0)
+	})
+	t.Run("insert and delete", func(t *testing.T) {
+		var changes []RowChange
+		h := newHandler(&changes)
+		assert.NoError(t, h.Do(context.Background(), InsertAction, tbl, [][]interface{}{{int32(2), int16(-1), "new"}}))
+		assert.NoError(t, h.Do(context.Background(), DeleteAction, tbl, [][]interface{}{{int32(3), int16(0), "old"}}))
+		assert.Len(t, changes, 2)
+		assert.Nil(t, changes[0].Before)
+		assert.Exactly(t, &testRowEntity{EntityID: 2, StoreID: 65535, Value: "new"}, changes[0].After)
+		assert.Exactly(t, &testRowEntity{EntityID: 3, StoreID: 0, Value: "old"}, changes[1].Before)
+		assert.Nil(t, changes[1].After)
+	})
+}
+
+func TestUnsignedValue(t *testing.T) {
+	t.Parallel()
+
+	unsigned := func(dataType string) *ddl.Column {
+		return &ddl.Column{Field: "x", DataType: dataType, ColumnType: dataType + " unsigned"}
+	}
+	assert.Exactly(t, uint8(255), unsignedValue(unsigned("tinyint"), int8(-1)))
+	assert.Exactly(t, uint16(65535), unsignedValue(unsigned("smallint"), int16(-1)))
+	assert.Exactly(t, uint32(16777215), unsignedValue(unsigned("mediumint"), int32(-1)))
+	assert.Exactly(t, uint32(4294967295), unsignedValue(unsigned("int"), int32(-1)))
+	assert.Exactly(t, uint64(18446744073709551615), unsignedValue(unsigned("bigint"), int64(-1)))
+	assert.Exactly(t, int32(-1), unsignedValue(&ddl.Column{Field: "x", DataType: "int", ColumnType: "int(11)"}, int32(-1)))
+}
@@ -0,0 +1,44 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sink publishes the row changes of mycanal as change envelopes to
+// message brokers.
+//
+// A Handler gets registered as mycanal.RowsEventHandler. It converts each row
+// of a rows event into an Envelope containing the schema, the table, the
+// primary key, the operation, the before and after image of the row, the
+// binary log position including the GTID set and the time stamp of the event.
+// An Encoder serializes the Envelope as JSON or as protocol buffer, see file
+// change_envelope.proto for the schema.
+//
+// Publishers transport the encoded envelopes. Available are Kafka (via an
+// adapter to a producer of your choice), NATS, Redis Streams (build tag
+// `redis`), HTTP webhooks and local files. A Publisher must return only after
+// the broker has acknowledged the messages.
+//
+// # Delivery guarantees
+//
+// The Handler publishes synchronously within RowsEventHandler.Do. Canal
+// persists the binary log position only after all handlers have returned. If
+// publishing fails after all retries, the Handler returns an error of kind
+// errors.Interrupted, which stops Canal without persisting the position. After
+// a restart the rows get published again, hence the delivery is at least once
+// and consumers must handle duplicates, for example by comparing the
+// position.
+//
+// Canal processes the rows events one after another, so the envelopes of a
+// table get published in the order of the binary log. The message key of an
+// envelope is the schema and table name, a Kafka producer assigns therefore
+// all changes of a table to the same partition.
+package sink
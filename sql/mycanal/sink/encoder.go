@@ -0,0 +1,247 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// Encoder serializes an Envelope.
+type Encoder interface {
+	Encode(*Envelope) ([]byte, error)
+	// ContentType returns the MIME type of the encoded data.
+	ContentType() string
+}
+
+// JSONEncoder encodes an Envelope as JSON. Byte slices become base64 encoded
+// strings.
+type JSONEncoder struct{}
+
+// Encode implements Encoder.
+func (JSONEncoder) Encode(e *Envelope) ([]byte, error) {
+	data, err := json.Marshal(e)
+	return data, errors.WithStack(err)
+}
+
+// ContentType returns application/json.
+func (JSONEncoder) ContentType() string { return "application/json" }
+
+// ProtoEncoder encodes an Envelope as protocol buffer message ChangeEnvelope
+// as defined in change_envelope.proto.
+type ProtoEncoder struct{}
+
+// ContentType returns application/x-protobuf.
+func (ProtoEncoder) ContentType() string { return "application/x-protobuf" }
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Encode implements Encoder.
+func (ProtoEncoder) Encode(e *Envelope) ([]byte, error) {
+	buf := make([]byte, 0, 256)
+	buf = appendProtoString(buf, 1, e.Schema)
+	buf = appendProtoString(buf, 2, e.Table)
+	buf = appendProtoString(buf, 3, e.Op)
+	var err error
+	for _, f := range [...]struct {
+		num uint64
+		m   map[string]interface{}
+	}{{4, e.PK}, {5, e.Before}, {6, e.After}} {
+		if buf, err = appendProtoColumns(buf, f.num, f.m); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	buf = appendProtoString(buf, 7, e.Position.File)
+	if e.Position.Position > 0 {
+		buf = appendProtoVarint(appendProtoTag(buf, 8, wireVarint), uint64(e.Position.Position))
+	}
+	buf = appendProtoString(buf, 9, e.Position.GTIDSet)
+	if !e.Timestamp.IsZero() {
+		buf = appendProtoVarint(appendProtoTag(buf, 10, wireVarint), uint64(e.Timestamp.UnixNano()))
+	}
+	if e.Snapshot {
+		buf = appendProtoVarint(appendProtoTag(buf, 11, wireVarint), 1)
+	}
+	return buf, nil
+}
+
+func appendProtoTag(buf []byte, num uint64, wireType uint64) []byte {
+	return appendProtoVarint(buf, num<<3|wireType)
+}
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendProtoBytes(buf []byte, num uint64, b []byte) []byte {
+	buf = appendProtoVarint(appendProtoTag(buf, num, wireBytes), uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendProtoString(buf []byte, num uint64, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	buf = appendProtoVarint(appendProtoTag(buf, num, wireBytes), uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendProtoColumns(buf []byte, num uint64, m map[string]interface{}) ([]byte, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var col []byte
+	for _, name := range names {
+		col = appendProtoString(col[:0], 1, name)
+		switch v := m[name].(type) {
+		case nil:
+		case int64:
+			col = appendProtoVarint(appendProtoTag(col, 2, wireVarint), uint64(v<<1)^uint64(v>>63))
+		case uint64:
+			col = appendProtoVarint(appendProtoTag(col, 3, wireVarint), v)
+		case float64:
+			col = appendProtoTag(col, 4, wireFixed64)
+			col = append(col, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(col[len(col)-8:], math.Float64bits(v))
+		case string:
+			col = appendProtoVarint(appendProtoTag(col, 5, wireBytes), uint64(len(v)))
+			col = append(col, v...)
+		case []byte:
+			col = appendProtoBytes(col, 6, v)
+		default:
+			return nil, errors.NotSupported.Newf("[sink] Column %q: Type %T not supported", name, v)
+		}
+		buf = appendProtoBytes(buf, num, col)
+	}
+	return buf, nil
+}
+
+// DecodeProto decodes the protocol buffer message ChangeEnvelope into `e`.
+func DecodeProto(data []byte, e *Envelope) error {
+	return protoFields(data, func(num, v uint64, b []byte) (err error) {
+		switch num {
+		case 1:
+			e.Schema = string(b)
+		case 2:
+			e.Table = string(b)
+		case 3:
+			e.Op = string(b)
+		case 4:
+			e.PK, err = decodeProtoColumn(e.PK, b)
+		case 5:
+			e.Before, err = decodeProtoColumn(e.Before, b)
+		case 6:
+			e.After, err = decodeProtoColumn(e.After, b)
+		case 7:
+			e.Position.File = string(b)
+		case 8:
+			e.Position.Position = uint(v)
+		case 9:
+			e.Position.GTIDSet = string(b)
+		case 10:
+			e.Timestamp = time.Unix(0, int64(v))
+		case 11:
+			e.Snapshot = v != 0
+		}
+		return err
+	})
+}
+
+func decodeProtoColumn(m map[string]interface{}, data []byte) (map[string]interface{}, error) {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	var name string
+	var value interface{}
+	err := protoFields(data, func(num, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			name = string(b)
+		case 2:
+			value = int64(v>>1) ^ -int64(v&1)
+		case 3:
+			value = v
+		case 4:
+			value = math.Float64frombits(v)
+		case 5:
+			value = string(b)
+		case 6:
+			value = append([]byte{}, b...)
+		}
+		return nil
+	})
+	m[name] = value
+	return m, errors.WithStack(err)
+}
+
+// protoFields iterates over the fields of a message. For wire type bytes the
+// argument b contains the data, otherwise v the number.
+func protoFields(data []byte, fn func(num, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.BadEncoding.Newf("[sink] Invalid protocol buffer tag")
+		}
+		data = data[n:]
+		num, wireType := tag>>3, tag&7
+
+		var v uint64
+		var b []byte
+		switch wireType {
+		case wireVarint:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errors.BadEncoding.Newf("[sink] Invalid protocol buffer varint of field %d", num)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errors.BadEncoding.Newf("[sink] Invalid protocol buffer fixed64 of field %d", num)
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errors.BadEncoding.Newf("[sink] Invalid protocol buffer fixed32 of field %d", num)
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return errors.BadEncoding.Newf("[sink] Invalid protocol buffer length of field %d", num)
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		default:
+			return errors.NotSupported.Newf("[sink] Protocol buffer wire type %d of field %d not supported", wireType, num)
+		}
+		if err := fn(num, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
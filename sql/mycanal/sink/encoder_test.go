@@ -0,0 +1,86 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTestEnvelope() *Envelope {
+	return &Envelope{
+		Schema: "magento",
+		Table:  "sales_order",
+		Op:     OpUpdate,
+		PK:     map[string]interface{}{"entity_id": uint64(7)},
+		Before: map[string]interface{}{"entity_id": uint64(7), "state": "new", "grand_total": "19.9900", "discount": float64(-1.5), "qty": int64(-3), "blob": []byte{0x0, 0xff}, "customer_id": nil},
+		After:  map[string]interface{}{"entity_id": uint64(7), "state": "processing", "grand_total": "19.9900", "discount": float64(-1.5), "qty": int64(-3), "blob": []byte{0x0, 0xff}, "customer_id": nil},
+		Position: Position{
+			File:     "mysql-bin.000003",
+			Position: 4711,
+			GTIDSet:  "0-1-99",
+		},
+		Timestamp: time.Unix(1600000000, 0).UTC(),
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	t.Parallel()
+
+	e := newTestEnvelope()
+	e.Before = nil
+	e.After = map[string]interface{}{"entity_id": uint64(7), "state": "processing", "blob": []byte{0x0, 0xff}, "customer_id": nil}
+	data, err := JSONEncoder{}.Encode(e)
+	assert.NoError(t, err)
+	assert.Exactly(t,
+		`{"schema":"magento","table":"sales_order","op":"update","pk":{"entity_id":7},"after":{"blob":"AP8=","customer_id":null,"entity_id":7,"state":"processing"},"position":{"file":"mysql-bin.000003","pos":4711,"gtid":"0-1-99"},"ts":"2020-09-13T12:26:40Z"}`,
+		string(data))
+}
+
+func TestProtoEncoder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trip", func(t *testing.T) {
+		e := newTestEnvelope()
+		e.Timestamp = time.Unix(1600000000, 0)
+		e.Snapshot = true
+		data, err := ProtoEncoder{}.Encode(e)
+		assert.NoError(t, err)
+
+		var have Envelope
+		assert.NoError(t, DecodeProto(data, &have))
+		assert.Exactly(t, e, &have)
+	})
+	t.Run("deterministic", func(t *testing.T) {
+		data1, err := ProtoEncoder{}.Encode(newTestEnvelope())
+		assert.NoError(t, err)
+		data2, err := ProtoEncoder{}.Encode(newTestEnvelope())
+		assert.NoError(t, err)
+		assert.Exactly(t, data1, data2)
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := ProtoEncoder{}.Encode(&Envelope{After: map[string]interface{}{"x": int32(1)}})
+		assert.ErrorIsKind(t, errors.NotSupported, err)
+	})
+	t.Run("corrupt data", func(t *testing.T) {
+		data, err := ProtoEncoder{}.Encode(newTestEnvelope())
+		assert.NoError(t, err)
+		var have Envelope
+		assert.ErrorIsKind(t, errors.BadEncoding, DecodeProto(data[:len(data)-3], &have))
+	})
+}
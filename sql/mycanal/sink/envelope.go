@@ -0,0 +1,190 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/storage/null"
+)
+
+// Op constants define the operation of an Envelope. They are equal to the
+// action constants of package mycanal.
+const (
+	OpInsert = mycanal.InsertAction
+	OpUpdate = mycanal.UpdateAction
+	OpDelete = mycanal.DeleteAction
+)
+
+// Position points into the binary log after the row change.
+type Position struct {
+	File     string `json:"file"`
+	Position uint   `json:"pos"`
+	GTIDSet  string `json:"gtid,omitempty"`
+}
+
+// Envelope describes the change of one row. Before is empty for inserts and
+// After is empty for deletes. The values of the maps are nil, int64, uint64,
+// float64, string or []byte. Text, decimal and temporal columns become a
+// string, binary and blob columns a []byte.
+type Envelope struct {
+	Schema    string                 `json:"schema"`
+	Table     string                 `json:"table"`
+	Op        string                 `json:"op"`
+	PK        map[string]interface{} `json:"pk"`
+	Before    map[string]interface{} `json:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty"`
+	Position  Position               `json:"position"`
+	Timestamp time.Time              `json:"ts"`
+	// Snapshot reports that the row has been read by the snapshot and not
+	// from the binary log. The Op is then always OpInsert.
+	Snapshot bool `json:"snapshot,omitempty"`
+}
+
+// Key returns the message key, which is the schema and the table name
+// separated by a dot.
+func (e *Envelope) Key() string {
+	return e.Schema + "." + e.Table
+}
+
+// newEnvelopes converts the rows of one rows event into envelopes. Update
+// events contain the rows in pairs of [before, after].
+func newEnvelopes(schema, action string, t *ddl.Table, rows [][]interface{}, ep mycanal.EventPosition) ([]*Envelope, error) {
+	step := 1
+	if action == OpUpdate {
+		step = 2
+		if len(rows)%2 != 0 {
+			return nil, errors.Mismatch.Newf("[sink] Table %q: Update event contains an odd number of %d rows", t.Name, len(rows))
+		}
+	}
+
+	envs := make([]*Envelope, 0, len(rows)/step)
+	for i := 0; i < len(rows); i += step {
+		e := &Envelope{
+			Schema: schema,
+			Table:  t.Name,
+			Op:     action,
+			Position: Position{
+				File:     ep.File,
+				Position: ep.Position,
+				GTIDSet:  ep.GTIDSet,
+			},
+			Timestamp: ep.Timestamp,
+			Snapshot:  ep.Snapshot,
+		}
+		var err error
+		switch action {
+		case OpInsert:
+			e.After, err = rowMap(t, rows[i])
+		case OpDelete:
+			e.Before, err = rowMap(t, rows[i])
+		case OpUpdate:
+			if e.Before, err = rowMap(t, rows[i]); err == nil {
+				e.After, err = rowMap(t, rows[i+1])
+			}
+		default:
+			err = errors.NotSupported.Newf("[sink] Table %q: Action %q not supported", t.Name, action)
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		img := e.After
+		if img == nil {
+			img = e.Before
+		}
+		e.PK = make(map[string]interface{}, 2)
+		for _, c := range t.Columns {
+			if c.IsPK() {
+				e.PK[c.Field] = img[c.Field]
+			}
+		}
+		envs = append(envs, e)
+	}
+	return envs, nil
+}
+
+func rowMap(t *ddl.Table, row []interface{}) (map[string]interface{}, error) {
+	if len(row) != len(t.Columns) {
+		return nil, errors.Mismatch.Newf("[sink] Table %q: Row contains %d values but the table %d columns", t.Name, len(row), len(t.Columns))
+	}
+	m := make(map[string]interface{}, len(row))
+	for i, c := range t.Columns {
+		m[c.Field] = columnValue(c, row[i])
+	}
+	return m, nil
+}
+
+// columnValue converts a value of the binlog decoder or of the snapshot into
+// one of the types an Envelope supports. The binlog decoder reports unsigned
+// integers as signed integers.
+func columnValue(c *ddl.Column, v interface{}) interface{} {
+	unsigned := c.IsUnsigned()
+	switch val := v.(type) {
+	case int8:
+		if unsigned {
+			return uint64(uint8(val))
+		}
+		return int64(val)
+	case int16:
+		if unsigned {
+			return uint64(uint16(val))
+		}
+		return int64(val)
+	case int32:
+		if unsigned && c.DataType == "mediumint" {
+			return uint64(uint32(val) & 0xffffff)
+		}
+		if unsigned {
+			return uint64(uint32(val))
+		}
+		return int64(val)
+	case int64:
+		if unsigned {
+			return uint64(val)
+		}
+		return val
+	case int:
+		return int64(val)
+	case uint8:
+		return uint64(val)
+	case uint16:
+		return uint64(val)
+	case uint32:
+		return uint64(val)
+	case uint:
+		return uint64(val)
+	case float32:
+		return float64(val)
+	case null.Decimal:
+		if !val.Valid {
+			return nil
+		}
+		return val.String()
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []byte:
+		dt := c.DataType
+		if strings.Contains(dt, "blob") || strings.Contains(dt, "binary") {
+			return val
+		}
+		return string(val)
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/storage/null"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTestTable() *ddl.Table {
+	tbl := ddl.NewTable("catalog_product_entity_decimal",
+		&ddl.Column{Field: "value_id", Key: "PRI", DataType: "int", ColumnType: "int(10) unsigned"},
+		&ddl.Column{Field: "store_id", DataType: "smallint", ColumnType: "smallint(5) unsigned"},
+		&ddl.Column{Field: "value", DataType: "decimal", ColumnType: "decimal(12,4)"},
+		&ddl.Column{Field: "note", DataType: "text", ColumnType: "text"},
+	)
+	tbl.Schema = "magento"
+	return tbl
+}
+
+func TestNewEnvelopes(t *testing.T) {
+	t.Parallel()
+
+	tbl := newTestTable()
+	ep := mycanal.EventPosition{File: "mysql-bin.000003", Position: 4711, GTIDSet: "0-1-99", Timestamp: time.Unix(1600000000, 0)}
+
+	t.Run("update", func(t *testing.T) {
+		envs, err := newEnvelopes("magento", mycanal.UpdateAction, tbl, [][]interface{}{
+			{int32(-1), int16(-1), null.MakeDecimalInt64(12345, 2), []byte("old")},
+			{int32(-1), int16(2), null.Decimal{}, []byte("new")},
+		}, ep)
+		assert.NoError(t, err)
+		assert.Len(t, envs, 1)
+		assert.Exactly(t, &Envelope{
+			Schema: "magento",
+			Table:  "catalog_product_entity_decimal",
+			Op:     OpUpdate,
+			PK:     map[string]interface{}{"value_id": uint64(4294967295)},
+			Before: map[string]interface{}{"value_id": uint64(4294967295), "store_id": uint64(65535), "value": "123.45", "note": "old"},
+			After:  map[string]interface{}{"value_id": uint64(4294967295), "store_id": uint64(2), "value": nil, "note": "new"},
+			Position: Position{
+				File:     "mysql-bin.000003",
+				Position: 4711,
+				GTIDSet:  "0-1-99",
+			},
+			Timestamp: time.Unix(1600000000, 0),
+		}, envs[0])
+	})
+	t.Run("delete", func(t *testing.T) {
+		envs, err := newEnvelopes("magento", mycanal.DeleteAction, tbl, [][]interface{}{
+			{int32(3), int16(0), nil, nil},
+			{int32(4), int16(0), nil, nil},
+		}, ep)
+		assert.NoError(t, err)
+		assert.Len(t, envs, 2)
+		assert.Nil(t, envs[1].After)
+		assert.Exactly(t, map[string]interface{}{"value_id": uint64(4)}, envs[1].PK)
+		assert.Exactly(t, "magento.catalog_product_entity_decimal", envs[1].Key())
+	})
+	t.Run("update odd rows", func(t *testing.T) {
+		_, err := newEnvelopes("magento", mycanal.UpdateAction, tbl, [][]interface{}{{int32(3), int16(0), nil, nil}}, ep)
+		assert.ErrorIsKind(t, errors.Mismatch, err)
+	})
+	t.Run("row length mismatch", func(t *testing.T) {
+		_, err := newEnvelopes("magento", mycanal.InsertAction, tbl, [][]interface{}{{int32(3)}}, ep)
+		assert.ErrorIsKind(t, errors.Mismatch, err)
+	})
+}
+
+func TestColumnValue(t *testing.T) {
+	t.Parallel()
+
+	col := func(dataType, columnType string) *ddl.Column {
+		return &ddl.Column{Field: "x", DataType: dataType, ColumnType: columnType}
+	}
+	assert.Exactly(t, uint64(255), columnValue(col("tinyint", "tinyint(3) unsigned"), int8(-1)))
+	assert.Exactly(t, int64(-1), columnValue(col("tinyint", "tinyint(3)"), int8(-1)))
+	assert.Exactly(t, uint64(16777215), columnValue(col("mediumint", "mediumint(8) unsigned"), int32(-1)))
+	assert.Exactly(t, uint64(18446744073709551615), columnValue(col("bigint", "bigint(20) unsigned"), int64(-1)))
+	assert.Exactly(t, float64(1.5), columnValue(col("float", "float"), float32(1.5)))
+	assert.Exactly(t, []byte{0x1, 0x2}, columnValue(col("varbinary", "varbinary(16)"), []byte{0x1, 0x2}))
+	assert.Exactly(t, "{}", columnValue(col("json", "json"), []byte("{}")))
+	assert.Exactly(t, "2020-01-02 03:04:05", columnValue(col("datetime", "datetime"), "2020-01-02 03:04:05"))
+}
@@ -0,0 +1,105 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/corestoreio/errors"
+)
+
+// FileOptions configures a FilePublisher.
+type FileOptions struct {
+	// NoSync disables the fsync after each Publish call. Without fsync the
+	// messages of the last Publish calls can get lost after a crash of the
+	// operating system.
+	NoSync bool
+}
+
+// FilePublisher appends the messages to a local file. JSON encoded messages
+// get written one per line, all other messages get a varint length prefix,
+// which is the delimited format of protocol buffers.
+type FilePublisher struct {
+	o  FileOptions
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// NewFilePublisher opens or creates the file and appends to it. Options can
+// be nil.
+func NewFilePublisher(fileName string, o *FileOptions) (*FilePublisher, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fp := &FilePublisher{
+		f: f,
+		w: bufio.NewWriter(f),
+	}
+	if o != nil {
+		fp.o = *o
+	}
+	return fp, nil
+}
+
+// Publish implements Publisher.
+func (fp *FilePublisher) Publish(_ context.Context, msgs []Message) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.f == nil {
+		return errors.AlreadyClosed.Newf("[sink] FilePublisher already closed")
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, m := range msgs {
+		if m.ContentType == (JSONEncoder{}).ContentType() {
+			_, _ = fp.w.Write(m.Value)
+			_ = fp.w.WriteByte('\n')
+			continue
+		}
+		n := binary.PutUvarint(lenBuf[:], uint64(len(m.Value)))
+		_, _ = fp.w.Write(lenBuf[:n])
+		_, _ = fp.w.Write(m.Value)
+	}
+	if err := fp.w.Flush(); err != nil {
+		// bufio.Writer keeps the error, a retry requires a reset.
+		fp.w.Reset(fp.f)
+		return errors.WriteFailed.New(err, "[sink] Failed to write to file %q", fp.f.Name())
+	}
+	if fp.o.NoSync {
+		return nil
+	}
+	return errors.WithStack(fp.f.Sync())
+}
+
+// Close closes the file.
+func (fp *FilePublisher) Close() error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if fp.f == nil {
+		return nil
+	}
+	err := fp.w.Flush()
+	if err2 := fp.f.Close(); err == nil {
+		err = err2
+	}
+	fp.f = nil
+	return errors.WithStack(err)
+}
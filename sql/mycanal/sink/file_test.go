@@ -0,0 +1,54 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestFilePublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "cdc.log")
+
+	fp, err := NewFilePublisher(fileName, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, fp.Publish(context.Background(), []Message{
+		{Value: []byte(`{"a":1}`), ContentType: "application/json"},
+		{Value: []byte(`{"a":2}`), ContentType: "application/json"},
+	}))
+	assert.NoError(t, fp.Publish(context.Background(), []Message{
+		{Value: []byte("\x0a\x01x"), ContentType: "application/x-protobuf"},
+	}))
+	assert.NoError(t, fp.Close())
+	assert.ErrorIsKind(t, errors.AlreadyClosed, fp.Publish(context.Background(), nil))
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Exactly(t, "{\"a\":1}\n{\"a\":2}\n\x03\x0a\x01x", string(data))
+
+	l, n := binary.Uvarint(data[16:])
+	assert.Exactly(t, uint64(3), l)
+	assert.Exactly(t, 1, n)
+}
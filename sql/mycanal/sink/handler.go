@@ -0,0 +1,140 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/mycanal"
+)
+
+// Options configures a Handler.
+type Options struct {
+	// Encoder defaults to JSONEncoder.
+	Encoder Encoder
+	// Schema sets the schema name of the envelopes. Defaults to the schema of
+	// the ddl.Table.
+	Schema string
+	// TopicPrefix gets prepended to the topic of each message.
+	TopicPrefix string
+	// MaxAttempts defines how often a failed Publish call gets repeated.
+	// Defaults to 3.
+	MaxAttempts int
+	// RetryBackoff defines the wait time before the first retry. It doubles
+	// with each further retry. Defaults to 100ms.
+	RetryBackoff time.Duration
+	// Log can be nil.
+	Log log.Logger
+}
+
+// Handler implements mycanal.RowsEventHandler and publishes each row change
+// as Envelope.
+type Handler struct {
+	pub Publisher
+	o   Options
+}
+
+var _ mycanal.RowsEventHandler = (*Handler)(nil)
+
+// NewHandler creates a new Handler which publishes to `p`. Options can be
+// nil. Register the Handler with mycanal.Canal.RegisterRowsEventHandler.
+func NewHandler(p Publisher, o *Options) *Handler {
+	h := &Handler{pub: p}
+	if o != nil {
+		h.o = *o
+	}
+	if h.o.Encoder == nil {
+		h.o.Encoder = JSONEncoder{}
+	}
+	if h.o.MaxAttempts < 1 {
+		h.o.MaxAttempts = 3
+	}
+	if h.o.RetryBackoff <= 0 {
+		h.o.RetryBackoff = 100 * time.Millisecond
+	}
+	return h
+}
+
+// Do publishes the rows. If publishing fails after all attempts, the returned
+// error has the kind errors.Interrupted, so Canal stops without persisting the
+// binary log position.
+func (h *Handler) Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	ep, _ := mycanal.EventPositionFromContext(ctx)
+	schema := h.o.Schema
+	if schema == "" {
+		schema = t.Schema
+	}
+	envs, err := newEnvelopes(schema, action, t, rows, ep)
+	if err != nil {
+		return errors.Interrupted.New(err, "[sink] Failed to convert rows of table %q", t.Name)
+	}
+
+	msgs := make([]Message, len(envs))
+	for i, e := range envs {
+		data, err := h.o.Encoder.Encode(e)
+		if err != nil {
+			return errors.Interrupted.New(err, "[sink] Failed to encode row of table %q", t.Name)
+		}
+		key := e.Key()
+		msgs[i] = Message{
+			Topic:       h.o.TopicPrefix + key,
+			Key:         []byte(key),
+			Value:       data,
+			ContentType: h.o.Encoder.ContentType(),
+			Envelope:    e,
+		}
+	}
+
+	if err := h.publish(ctx, msgs); err != nil {
+		return errors.Interrupted.New(err, "[sink] Failed to publish %d messages of table %q at position %s:%d", len(msgs), t.Name, ep.File, ep.Position)
+	}
+	return nil
+}
+
+func (h *Handler) publish(ctx context.Context, msgs []Message) (err error) {
+	backoff := h.o.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		if err = h.pub.Publish(ctx, msgs); err == nil {
+			return nil
+		}
+		if attempt >= h.o.MaxAttempts {
+			return errors.WithStack(err)
+		}
+		if h.o.Log != nil && h.o.Log.IsInfo() {
+			h.o.Log.Info("sink.Handler.publish.retry", log.Err(err), log.Int("attempt", attempt), log.Duration("backoff", backoff))
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.WithStack(ctx.Err())
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Complete returns nil because Do publishes synchronously.
+func (h *Handler) Complete(context.Context) error { return nil }
+
+// String returns the name of the handler.
+func (h *Handler) String() string { return "sink.Handler" }
+
+// Close closes the Publisher.
+func (h *Handler) Close() error { return errors.WithStack(h.pub.Close()) }
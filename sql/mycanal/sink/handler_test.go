@@ -0,0 +1,79 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestHandler_Do(t *testing.T) {
+	t.Parallel()
+
+	tbl := newTestTable()
+	ctx := mycanal.WithEventPosition(context.Background(), mycanal.EventPosition{File: "mysql-bin.000001", Position: 333})
+	rows := [][]interface{}{
+		{int32(1), int16(0), nil, []byte("a")},
+		{int32(2), int16(0), nil, []byte("b")},
+	}
+
+	t.Run("publishes in order with retry", func(t *testing.T) {
+		var calls int
+		var have []Message
+		h := NewHandler(PublisherFunc(func(_ context.Context, msgs []Message) error {
+			calls++
+			if calls == 1 {
+				return errors.ConnectionLost.Newf("broker gone")
+			}
+			have = msgs
+			return nil
+		}), &Options{TopicPrefix: "cdc.", RetryBackoff: time.Millisecond})
+
+		assert.NoError(t, h.Do(ctx, mycanal.InsertAction, tbl, rows))
+		assert.Exactly(t, 2, calls)
+		assert.Len(t, have, 2)
+		assert.Exactly(t, "cdc.magento.catalog_product_entity_decimal", have[0].Topic)
+		assert.Exactly(t, []byte("magento.catalog_product_entity_decimal"), have[0].Key)
+		assert.Exactly(t, "application/json", have[0].ContentType)
+		assert.Exactly(t, map[string]interface{}{"value_id": uint64(2)}, have[1].Envelope.PK)
+		assert.Exactly(t, uint(333), have[1].Envelope.Position.Position)
+	})
+
+	t.Run("interrupts canal after all attempts", func(t *testing.T) {
+		var calls int
+		h := NewHandler(PublisherFunc(func(_ context.Context, msgs []Message) error {
+			calls++
+			return errors.ConnectionLost.Newf("broker gone")
+		}), &Options{MaxAttempts: 2, RetryBackoff: time.Millisecond})
+
+		err := h.Do(ctx, mycanal.DeleteAction, tbl, rows)
+		assert.ErrorIsKind(t, errors.Interrupted, err)
+		assert.Exactly(t, 2, calls)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		h := NewHandler(PublisherFunc(func(_ context.Context, msgs []Message) error {
+			return errors.ConnectionLost.Newf("broker gone")
+		}), &Options{RetryBackoff: time.Hour})
+		assert.ErrorIsKind(t, errors.Interrupted, h.Do(cctx, mycanal.InsertAction, tbl, rows))
+	})
+}
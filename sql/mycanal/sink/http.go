@@ -0,0 +1,98 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/corestoreio/errors"
+)
+
+// HTTP header names set by the HTTPPublisher.
+const (
+	HeaderTopic = "X-Sink-Topic"
+	HeaderKey   = "X-Sink-Key"
+)
+
+// HTTPOptions configures a HTTPPublisher.
+type HTTPOptions struct {
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Header gets added to each request, for example an Authorization
+	// header.
+	Header http.Header
+}
+
+// HTTPPublisher sends each message with a POST request to a webhook. The body
+// contains the encoded Envelope, the headers X-Sink-Topic and X-Sink-Key the
+// topic and the key. Any status code other than 2xx counts as failure.
+type HTTPPublisher struct {
+	url string
+	o   HTTPOptions
+}
+
+// NewHTTPPublisher creates a new publisher for the URL. Options can be nil.
+func NewHTTPPublisher(url string, o *HTTPOptions) *HTTPPublisher {
+	hp := &HTTPPublisher{url: url}
+	if o != nil {
+		hp.o = *o
+	}
+	if hp.o.Client == nil {
+		hp.o.Client = http.DefaultClient
+	}
+	return hp
+}
+
+// Publish implements Publisher.
+func (hp *HTTPPublisher) Publish(ctx context.Context, msgs []Message) error {
+	for _, m := range msgs {
+		if err := hp.post(ctx, m); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (hp *HTTPPublisher) post(ctx context.Context, m Message) error {
+	req, err := http.NewRequest(http.MethodPost, hp.url, bytes.NewReader(m.Value))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range hp.o.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", m.ContentType)
+	req.Header.Set(HeaderTopic, m.Topic)
+	req.Header.Set(HeaderKey, string(m.Key))
+
+	resp, err := hp.o.Client.Do(req)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[sink] Failed to POST to %q", hp.url)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Rejected.Newf("[sink] Webhook %q responded with status %d for topic %q", hp.url, resp.StatusCode, m.Topic)
+	}
+	return nil
+}
+
+// Close does nothing.
+func (hp *HTTPPublisher) Close() error { return nil }
@@ -0,0 +1,56 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestHTTPPublisher(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "reject" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, r.Header.Get(HeaderTopic)+"|"+r.Header.Get(HeaderKey)+"|"+
+			r.Header.Get("Content-Type")+"|"+r.Header.Get("Authorization")+"|"+string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	hp := NewHTTPPublisher(srv.URL, &HTTPOptions{Header: http.Header{"Authorization": []string{"Bearer x"}}})
+	defer hp.Close()
+
+	assert.NoError(t, hp.Publish(context.Background(), []Message{
+		{Topic: "cdc.db.t1", Key: []byte("db.t1"), Value: []byte("1"), ContentType: "application/json"},
+		{Topic: "cdc.db.t1", Key: []byte("db.t1"), Value: []byte("2"), ContentType: "application/json"},
+	}))
+	assert.Exactly(t, []string{
+		"cdc.db.t1|db.t1|application/json|Bearer x|1",
+		"cdc.db.t1|db.t1|application/json|Bearer x|2",
+	}, bodies)
+
+	err := hp.Publish(context.Background(), []Message{{Topic: "cdc.db.t1", Value: []byte("reject")}})
+	assert.ErrorIsKind(t, errors.Rejected, err)
+}
@@ -0,0 +1,83 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+)
+
+// KafkaMessage gets sent by a KafkaProducer.
+type KafkaMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string][]byte
+}
+
+// KafkaProducer gets implemented by a synchronous Kafka client, for example
+// by a wrapper around sarama.SyncProducer.SendMessages. SendMessages must
+// return after all messages have been acknowledged (acks=all recommended) and
+// must keep the order of messages with the same key. This package does not
+// depend on a Kafka client library.
+type KafkaProducer interface {
+	SendMessages(ctx context.Context, msgs []KafkaMessage) error
+	Close() error
+}
+
+// KafkaOptions configures a KafkaPublisher.
+type KafkaOptions struct {
+	// Topic sends all messages to this topic instead of one topic per table.
+	// The key still contains the schema and table name, hence all changes
+	// of a table end up in the same partition.
+	Topic string
+}
+
+// KafkaPublisher publishes the messages via a KafkaProducer. The header
+// content-type contains the ContentType of the message.
+type KafkaPublisher struct {
+	p KafkaProducer
+	o KafkaOptions
+}
+
+// NewKafkaPublisher creates a new publisher. Options can be nil.
+func NewKafkaPublisher(p KafkaProducer, o *KafkaOptions) *KafkaPublisher {
+	kp := &KafkaPublisher{p: p}
+	if o != nil {
+		kp.o = *o
+	}
+	return kp
+}
+
+// Publish implements Publisher.
+func (kp *KafkaPublisher) Publish(ctx context.Context, msgs []Message) error {
+	kms := make([]KafkaMessage, len(msgs))
+	for i, m := range msgs {
+		kms[i] = KafkaMessage{
+			Topic:   m.Topic,
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: map[string][]byte{"content-type": []byte(m.ContentType)},
+		}
+		if kp.o.Topic != "" {
+			kms[i].Topic = kp.o.Topic
+		}
+	}
+	return errors.WithStack(kp.p.SendMessages(ctx, kms))
+}
+
+// Close closes the KafkaProducer.
+func (kp *KafkaPublisher) Close() error { return errors.WithStack(kp.p.Close()) }
@@ -0,0 +1,53 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+type testKafkaProducer struct {
+	msgs   []KafkaMessage
+	closed bool
+}
+
+func (p *testKafkaProducer) SendMessages(_ context.Context, msgs []KafkaMessage) error {
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *testKafkaProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestKafkaPublisher(t *testing.T) {
+	p := &testKafkaProducer{}
+	kp := NewKafkaPublisher(p, &KafkaOptions{Topic: "cdc"})
+	assert.NoError(t, kp.Publish(context.Background(), []Message{
+		{Topic: "db.t1", Key: []byte("db.t1"), Value: []byte("1"), ContentType: "application/x-protobuf"},
+	}))
+	assert.NoError(t, kp.Close())
+	assert.True(t, p.closed)
+	assert.Exactly(t, []KafkaMessage{{
+		Topic:   "cdc",
+		Key:     []byte("db.t1"),
+		Value:   []byte("1"),
+		Headers: map[string][]byte{"content-type": []byte("application/x-protobuf")},
+	}}, p.msgs)
+}
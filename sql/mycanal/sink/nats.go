@@ -0,0 +1,178 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// NATSOptions configures a NATSPublisher.
+type NATSOptions struct {
+	// Name of the client, visible in the monitoring of the server.
+	Name  string
+	User  string
+	Pass  string
+	Token string
+	// Timeout for connecting and for the acknowledgement of a Publish call.
+	// Defaults to 5s.
+	Timeout time.Duration
+}
+
+// NATSPublisher publishes to a NATS server via the text protocol. The topic
+// becomes the subject. After the messages a PING gets sent, the PONG of the
+// server confirms that the server has processed all messages. TLS is not
+// supported. The connection gets established again after an error.
+type NATSPublisher struct {
+	addr string
+	o    NATSOptions
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewNATSPublisher connects to the server with the address host:port.
+// Options can be nil.
+func NewNATSPublisher(addr string, o *NATSOptions) (*NATSPublisher, error) {
+	np := &NATSPublisher{addr: addr}
+	if o != nil {
+		np.o = *o
+	}
+	if np.o.Timeout <= 0 {
+		np.o.Timeout = 5 * time.Second
+	}
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	if err := np.connect(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return np, nil
+}
+
+func (np *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", np.addr, np.o.Timeout)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[sink] Failed to connect to NATS server %q", np.addr)
+	}
+	_ = conn.SetDeadline(time.Now().Add(np.o.Timeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO") {
+		_ = conn.Close()
+		return errors.ConnectionFailed.Newf("[sink] NATS server %q did not send INFO: %q %v", np.addr, line, err)
+	}
+
+	connect, err := json.Marshal(struct {
+		Verbose  bool   `json:"verbose"`
+		Pedantic bool   `json:"pedantic"`
+		Name     string `json:"name,omitempty"`
+		User     string `json:"user,omitempty"`
+		Pass     string `json:"pass,omitempty"`
+		Token    string `json:"auth_token,omitempty"`
+	}{Name: np.o.Name, User: np.o.User, Pass: np.o.Pass, Token: np.o.Token})
+	if err != nil {
+		_ = conn.Close()
+		return errors.WithStack(err)
+	}
+	np.conn, np.r, np.w = conn, r, bufio.NewWriter(conn)
+	_, _ = np.w.WriteString("CONNECT ")
+	_, _ = np.w.Write(connect)
+	_, _ = np.w.WriteString("\r\n")
+	if err := np.ping(); err != nil {
+		np.closeConn()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ping flushes the buffer and waits for the PONG.
+func (np *NATSPublisher) ping() error {
+	_, _ = np.w.WriteString("PING\r\n")
+	if err := np.w.Flush(); err != nil {
+		return errors.ConnectionLost.New(err, "[sink] Failed to write to NATS server %q", np.addr)
+	}
+	for {
+		line, err := np.r.ReadString('\n')
+		if err != nil {
+			return errors.ConnectionLost.New(err, "[sink] Failed to read from NATS server %q", np.addr)
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			_, _ = np.w.WriteString("PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.Rejected.Newf("[sink] NATS server %q: %s", np.addr, line)
+		}
+		// +OK and INFO get ignored.
+	}
+}
+
+func (np *NATSPublisher) closeConn() {
+	if np.conn != nil {
+		_ = np.conn.Close()
+	}
+	np.conn, np.r, np.w = nil, nil, nil
+}
+
+// Publish implements Publisher.
+func (np *NATSPublisher) Publish(ctx context.Context, msgs []Message) error {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	if np.conn == nil {
+		if err := np.connect(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	deadline := time.Now().Add(np.o.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = np.conn.SetDeadline(deadline)
+
+	for _, m := range msgs {
+		_, _ = np.w.WriteString("PUB ")
+		_, _ = np.w.WriteString(m.Topic)
+		_ = np.w.WriteByte(' ')
+		_, _ = np.w.WriteString(strconv.Itoa(len(m.Value)))
+		_, _ = np.w.WriteString("\r\n")
+		_, _ = np.w.Write(m.Value)
+		_, _ = np.w.WriteString("\r\n")
+	}
+	if err := np.ping(); err != nil {
+		np.closeConn()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (np *NATSPublisher) Close() error {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	np.closeConn()
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// testNATSServer implements the parts of the NATS protocol the NATSPublisher
+// requires.
+type testNATSServer struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	msgs []string
+	conn []string
+}
+
+func newTestNATSServer(t *testing.T) *testNATSServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &testNATSServer{ln: ln}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *testNATSServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	_, _ = io.WriteString(c, "INFO {\"server_id\":\"test\"}\r\n")
+	var failed bool
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			s.mu.Lock()
+			s.conn = append(s.conn, strings.TrimSpace(strings.TrimPrefix(line, "CONNECT ")))
+			s.mu.Unlock()
+		case "PUB":
+			l, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, l+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			if fields[1] == "invalid" {
+				failed = true
+				continue
+			}
+			s.mu.Lock()
+			s.msgs = append(s.msgs, fields[1]+":"+string(payload[:l]))
+			s.mu.Unlock()
+		case "PING":
+			if failed {
+				_, _ = io.WriteString(c, "-ERR 'Invalid Subject'\r\n")
+				return
+			}
+			_, _ = io.WriteString(c, "PONG\r\n")
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	srv := newTestNATSServer(t)
+	defer srv.ln.Close()
+
+	np, err := NewNATSPublisher(srv.ln.Addr().String(), &NATSOptions{Name: "mycanal", Token: "s3cr3t"})
+	assert.NoError(t, err)
+	defer np.Close()
+
+	assert.NoError(t, np.Publish(context.Background(), []Message{
+		{Topic: "cdc.db.t1", Value: []byte("1")},
+		{Topic: "cdc.db.t1", Value: []byte("2\r\n2")},
+	}))
+
+	err = np.Publish(context.Background(), []Message{{Topic: "invalid", Value: []byte("3")}})
+	assert.ErrorIsKind(t, errors.Rejected, err)
+
+	// reconnects after the error
+	assert.NoError(t, np.Publish(context.Background(), []Message{{Topic: "cdc.db.t2", Value: []byte("4")}}))
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Exactly(t, []string{"cdc.db.t1:1", "cdc.db.t1:2\r\n2", "cdc.db.t2:4"}, srv.msgs)
+	assert.Exactly(t, []string{
+		`{"verbose":false,"pedantic":false,"name":"mycanal","auth_token":"s3cr3t"}`,
+		`{"verbose":false,"pedantic":false,"name":"mycanal","auth_token":"s3cr3t"}`,
+	}, srv.conn)
+}
+
+func TestNATSPublisher_ConnectionFailed(t *testing.T) {
+	_, err := NewNATSPublisher("127.0.0.1:1", nil)
+	assert.ErrorIsKind(t, errors.ConnectionFailed, err)
+}
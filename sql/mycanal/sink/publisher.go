@@ -0,0 +1,52 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+)
+
+// Message contains an encoded Envelope.
+type Message struct {
+	// Topic names the stream, subject or topic of the broker. It consists of
+	// Options.TopicPrefix and the Envelope.Key.
+	Topic string
+	// Key contains the schema and table name, see Envelope.Key.
+	Key         []byte
+	Value       []byte
+	ContentType string
+	// Envelope contains the not encoded change.
+	Envelope *Envelope
+}
+
+// Publisher transports the messages to a broker.
+type Publisher interface {
+	// Publish sends the messages in the provided order. It returns after the
+	// broker has acknowledged all messages. Publish gets called
+	// sequentially.
+	Publish(ctx context.Context, msgs []Message) error
+	// Close closes the connection to the broker.
+	Close() error
+}
+
+// PublisherFunc implements the Publish function of the Publisher interface.
+// Close returns always nil.
+type PublisherFunc func(ctx context.Context, msgs []Message) error
+
+// Publish calls pf.
+func (pf PublisherFunc) Publish(ctx context.Context, msgs []Message) error { return pf(ctx, msgs) }
+
+// Close returns nil.
+func (pf PublisherFunc) Close() error { return nil }
@@ -0,0 +1,80 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build redis csall
+
+package sink
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisOptions configures a RedisPublisher.
+type RedisOptions struct {
+	// MaxLen trims each stream to approximately this length, if greater
+	// zero.
+	MaxLen int
+}
+
+// RedisPublisher appends the messages with XADD to Redis Streams. The topic
+// becomes the stream name. An entry has the fields key, content_type and
+// value. Redis 5.0 or newer is required.
+type RedisPublisher struct {
+	pool *redis.Pool
+	o    RedisOptions
+}
+
+// NewRedisPublisher creates a new publisher. Options can be nil.
+func NewRedisPublisher(pool *redis.Pool, o *RedisOptions) *RedisPublisher {
+	rp := &RedisPublisher{pool: pool}
+	if o != nil {
+		rp.o = *o
+	}
+	return rp
+}
+
+// Publish implements Publisher. All XADD commands get sent in one pipeline.
+func (rp *RedisPublisher) Publish(ctx context.Context, msgs []Message) error {
+	conn, err := rp.pool.GetContext(ctx)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[sink] Failed to get a Redis connection")
+	}
+	defer conn.Close()
+
+	for _, m := range msgs {
+		args := make(redis.Args, 0, 11).Add(m.Topic)
+		if rp.o.MaxLen > 0 {
+			args = args.Add("MAXLEN", "~", rp.o.MaxLen)
+		}
+		args = args.Add("*", "key", m.Key, "content_type", m.ContentType, "value", m.Value)
+		if err := conn.Send("XADD", args...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return errors.ConnectionLost.New(err, "[sink] Failed to send XADD")
+	}
+	for _, m := range msgs {
+		if _, err := conn.Receive(); err != nil {
+			return errors.Wrapf(err, "[sink] XADD to stream %q failed", m.Topic)
+		}
+	}
+	return nil
+}
+
+// Close closes the pool.
+func (rp *RedisPublisher) Close() error { return errors.WithStack(rp.pool.Close()) }
@@ -0,0 +1,84 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build redis csall
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/gomodule/redigo/redis"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// testRedisConn records the sent commands. miniredis does not support
+// streams.
+type testRedisConn struct {
+	sent    []string
+	pending int
+	err     error
+}
+
+func (c *testRedisConn) Close() error { return nil }
+func (c *testRedisConn) Err() error   { return nil }
+func (c *testRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (c *testRedisConn) Send(cmd string, args ...interface{}) error {
+	s := cmd
+	for _, a := range args {
+		if b, ok := a.([]byte); ok {
+			a = string(b)
+		}
+		s += fmt.Sprintf(" %v", a)
+	}
+	c.sent = append(c.sent, s)
+	c.pending++
+	return nil
+}
+func (c *testRedisConn) Flush() error { return nil }
+func (c *testRedisConn) Receive() (interface{}, error) {
+	c.pending--
+	if c.err != nil {
+		return nil, c.err
+	}
+	return []byte("1600000000000-0"), nil
+}
+
+func TestRedisPublisher(t *testing.T) {
+	conn := &testRedisConn{}
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }}
+
+	rp := NewRedisPublisher(pool, &RedisOptions{MaxLen: 1000})
+	assert.NoError(t, rp.Publish(context.Background(), []Message{
+		{Topic: "cdc.db.t1", Key: []byte("db.t1"), Value: []byte("1"), ContentType: "application/json"},
+		{Topic: "cdc.db.t1", Key: []byte("db.t1"), Value: []byte("2"), ContentType: "application/json"},
+	}))
+	assert.Exactly(t, []string{
+		"XADD cdc.db.t1 MAXLEN ~ 1000 * key db.t1 content_type application/json value 1",
+		"XADD cdc.db.t1 MAXLEN ~ 1000 * key db.t1 content_type application/json value 2",
+	}, conn.sent)
+	assert.Exactly(t, 0, conn.pending)
+
+	conn.err = redis.Error("ERR unknown command 'XADD'")
+	err := rp.Publish(context.Background(), []Message{{Topic: "cdc.db.t1"}})
+	assert.Error(t, err)
+	assert.True(t, errors.Cause(err) == conn.err, "%+v", err)
+	assert.NoError(t, rp.Close())
+}
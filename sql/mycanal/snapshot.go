@@ -0,0 +1,417 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	simysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/storage/null"
+)
+
+const defaultSnapshotChunkSize = 1000
+
+// snapshot reads all allowed tables, which have at least one RowsEventHandler,
+// within one consistent read view and delivers their rows as InsertAction. The
+// binlog position belonging to the read view becomes the new start position of
+// the binlog stream, hence no row change gets lost or delivered twice.
+func (c *Canal) snapshot(ctx context.Context) (err error) {
+	defer log.WhenDone(c.opts.Log).Info("myCanal.snapshot")
+
+	dbc, err := c.dbcp.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		// The transaction only reads, COMMIT releases the read view.
+		if _, err2 := dbc.DB.ExecContext(context.Background(), "COMMIT"); err == nil && err2 != nil {
+			err = errors.WithStack(err2)
+		}
+		if err2 := dbc.Close(); err == nil && err2 != nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+
+	pos, err := c.snapshotBegin(ctx, dbc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if c.opts.Log.IsDebug() {
+		c.opts.Log.Debug("myCanal.snapshot.position", log.Stringer("position", pos))
+	}
+
+	ctx = WithEventPosition(ctx, EventPosition{
+		File:           pos.File,
+		Position:       pos.Position,
+		CommitFile:     pos.File,
+		CommitPosition: pos.Position,
+		GTIDSet:        pos.ExecutedGTIDSet,
+		Timestamp:      time.Now(),
+		Snapshot:       true,
+	})
+
+	tableNames, err := dbc.WithRawSQL("SELECT `TABLE_NAME` FROM `information_schema`.`TABLES` WHERE `TABLE_SCHEMA`=? AND `TABLE_TYPE`='BASE TABLE' ORDER BY `TABLE_NAME`").
+		LoadStrings(ctx, nil, c.dsn.DBName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, tn := range tableNames {
+		if !c.isTableAllowed(tn) || !c.hasRowsEventHandler(tn) {
+			continue
+		}
+		if err := c.snapshotTable(ctx, dbc, tn); err != nil {
+			return errors.Wrapf(err, "[mycanal] Snapshot of table %q.%q failed", c.dsn.DBName, tn)
+		}
+	}
+
+	if err := c.flushEventHandlers(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var gset simysql.GTIDSet
+	if c.gtidEnabled && pos.ExecutedGTIDSet != "" {
+		if gset, err = simysql.ParseGTIDSet(c.opts.Flavor, pos.ExecutedGTIDSet); err != nil {
+			return errors.Wrapf(err, "[mycanal] Failed to parse snapshot GTID set %q", pos.ExecutedGTIDSet)
+		}
+	}
+
+	c.masterMu.Lock()
+	c.masterStatus = pos
+	c.masterGTID = gset
+	c.masterMu.Unlock()
+	if err := c.masterSave(pos.File, pos.Position, gset); err != nil {
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("myCanal.snapshot.master.position.Failed", log.Err(err), log.Stringer("position", pos))
+		}
+	}
+	return nil
+}
+
+// snapshotBegin starts the transaction with a consistent read view and returns
+// the binlog position of that read view. MariaDB reports the position lock
+// free via the session status variables binlog_snapshot_file and
+// binlog_snapshot_position. MySQL requires a short global read lock, which
+// gets released as soon as the read view has been created. For the lock the
+// RELOAD privilege is required.
+func (c *Canal) snapshotBegin(ctx context.Context, dbc *dml.Conn) (ms ddl.MasterStatus, err error) {
+	if _, err = dbc.DB.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return ms, errors.WithStack(err)
+	}
+
+	if c.opts.Flavor == MariaDBFlavor {
+		if _, err = dbc.DB.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+			return ms, errors.WithStack(err)
+		}
+		v := &ddl.Variables{
+			Data: make(map[string]string),
+			Show: dml.NewShow().Session().Status().Where(
+				dml.Column("Variable_name").In().Strs("binlog_snapshot_file", "binlog_snapshot_position"),
+			),
+		}
+		if _, err = dbc.WithQueryBuilder(v).Load(ctx, v); err != nil {
+			return ms, errors.WithStack(err)
+		}
+		ms.File, _ = v.String("binlog_snapshot_file")
+		p, _ := v.Uint64("binlog_snapshot_position")
+		ms.Position = uint(p)
+		if ms.File == "" || ms.Position == 0 {
+			return ms, errors.NotSupported.Newf("[mycanal] MariaDB does not report a binlog snapshot position. Is the binary log enabled?")
+		}
+		if c.gtidEnabled {
+			gs, _, err := dbc.WithRawSQL("SELECT BINLOG_GTID_POS(?,?)").LoadNullString(ctx, ms.File, ms.Position)
+			if err != nil {
+				return ms, errors.WithStack(err)
+			}
+			ms.ExecutedGTIDSet = gs.Data
+		}
+		return ms, nil
+	}
+
+	if _, err = dbc.DB.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		return ms, errors.WithStack(err)
+	}
+	defer func() {
+		if _, err2 := dbc.DB.ExecContext(ctx, "UNLOCK TABLES"); err == nil && err2 != nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+	if _, err = dbc.DB.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return ms, errors.WithStack(err)
+	}
+	if _, err = dbc.WithQueryBuilder(&ms).Load(ctx, &ms); err != nil {
+		return ms, errors.WithStack(err)
+	}
+	return ms, nil
+}
+
+// snapshotTable reads the table in chunks, ordered by the primary key. The
+// next chunk starts after the primary key of the last row of the previous
+// chunk, so no table lock and no OFFSET are required. Tables without a
+// primary key fall back to LIMIT with OFFSET.
+func (c *Canal) snapshotTable(ctx context.Context, dbc *dml.Conn, tableName string) error {
+	t, err := c.FindTable(ctx, tableName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	chunkSize := c.opts.SnapshotChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+	var pkIdx []int
+	for i, col := range t.Columns {
+		if col.IsPK() {
+			pkIdx = append(pkIdx, i)
+		}
+	}
+
+	var lastPK []interface{}
+	var offset, rowCount int
+	for {
+		rows, last, err := c.snapshotChunk(ctx, dbc, t, snapshotChunkSQL(t, pkIdx, lastPK != nil, offset, chunkSize), lastPK)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		rowCount += len(rows)
+		if err := c.processRowsEventHandler(ctx, InsertAction, t, rows); err != nil {
+			return errors.WithStack(err)
+		}
+		if len(rows) < chunkSize {
+			break
+		}
+		if len(pkIdx) == 0 {
+			offset += len(rows)
+			continue
+		}
+		lastPK = make([]interface{}, len(pkIdx))
+		for i, idx := range pkIdx {
+			lastPK[i] = last[idx]
+		}
+	}
+	if c.opts.Log.IsDebug() {
+		c.opts.Log.Debug("myCanal.snapshotTable", log.String("table", tableName), log.Int("rows", rowCount))
+	}
+	return nil
+}
+
+// snapshotChunk returns the converted rows and the unconverted values of the
+// last row. The latter serve as arguments for the next chunk because the
+// converted values of unsigned columns might be negative.
+func (c *Canal) snapshotChunk(ctx context.Context, dbc *dml.Conn, t *ddl.Table, query string, args []interface{}) (rows [][]interface{}, last []interface{}, _ error) {
+	rs, err := dbc.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer rs.Close()
+
+	dest := make([]interface{}, len(t.Columns))
+	for rs.Next() {
+		last = make([]interface{}, len(t.Columns))
+		for i := range last {
+			dest[i] = &last[i]
+		}
+		if err := rs.Scan(dest...); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		row := make([]interface{}, len(t.Columns))
+		for i, col := range t.Columns {
+			row[i] = snapshotValue(col, last[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows, last, errors.WithStack(rs.Err())
+}
+
+// snapshotChunkSQL builds the SELECT statement for one chunk. If afterPK is
+// true, the statement contains place holders for the primary key values of
+// the last row of the previous chunk.
+func snapshotChunkSQL(t *ddl.Table, pkIdx []int, afterPK bool, offset, limit int) string {
+	var buf bytes.Buffer
+	buf.WriteString("SELECT ")
+	for i, col := range t.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		dml.Quoter.WriteIdentifier(&buf, col.Field)
+	}
+	buf.WriteString(" FROM ")
+	dml.Quoter.WriteIdentifier(&buf, t.Name)
+
+	writePK := func() {
+		for i, idx := range pkIdx {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			dml.Quoter.WriteIdentifier(&buf, t.Columns[idx].Field)
+		}
+	}
+	if len(pkIdx) > 0 {
+		if afterPK {
+			buf.WriteString(" WHERE (")
+			writePK()
+			buf.WriteString(") > (")
+			buf.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(pkIdx)), ","))
+			buf.WriteByte(')')
+		}
+		buf.WriteString(" ORDER BY ")
+		writePK()
+	}
+	buf.WriteString(" LIMIT ")
+	buf.WriteString(strconv.Itoa(limit))
+	if len(pkIdx) == 0 && offset > 0 {
+		buf.WriteString(" OFFSET ")
+		buf.WriteString(strconv.Itoa(offset))
+	}
+	return buf.String()
+}
+
+// snapshotValue converts a value of the text or binary protocol into the type
+// the binlog decoder produces for the same column, so a RowsEventHandler can
+// treat snapshot rows and binlog rows alike. Integers become the signed type
+// of the column width, unsigned values keep their bits as in the binlog. float
+// becomes float32, double float64, decimal a null.Decimal, bit an int64 and
+// enum and set the int64 index and bit mask of the value. blob, text, json and
+// geometry columns stay []byte and all other columns become a string.
+func snapshotValue(c *ddl.Column, v interface{}) interface{} {
+	var raw []byte
+	switch val := v.(type) {
+	case []byte:
+		raw = val
+	case string:
+		raw = []byte(val)
+	case int64:
+		raw = strconv.AppendInt(nil, val, 10)
+	case uint64:
+		raw = strconv.AppendUint(nil, val, 10)
+	case float32:
+		raw = strconv.AppendFloat(nil, float64(val), 'g', -1, 32)
+	case float64:
+		raw = strconv.AppendFloat(nil, val, 'g', -1, 64)
+	default: // nil and time.Time
+		return v
+	}
+
+	str := string(raw)
+	switch c.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year":
+		var i int64
+		var err error
+		if c.IsUnsigned() {
+			var u uint64
+			u, err = strconv.ParseUint(str, 10, 64)
+			i = int64(u)
+		} else {
+			i, err = strconv.ParseInt(str, 10, 64)
+		}
+		if err != nil {
+			break
+		}
+		switch c.DataType {
+		case "tinyint":
+			return int8(i)
+		case "smallint":
+			return int16(i)
+		case "mediumint":
+			return int32(i<<8) >> 8 // sign extends the 24 bits
+		case "int", "integer":
+			return int32(i)
+		case "year":
+			return int(i)
+		}
+		return i
+	case "float":
+		if f, err := strconv.ParseFloat(str, 32); err == nil {
+			return float32(f)
+		}
+	case "double", "real":
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return f
+		}
+	case "decimal", "numeric":
+		if d, err := null.MakeDecimalBytes(raw); err == nil {
+			return d
+		}
+	case "bit":
+		var i int64
+		for _, b := range raw {
+			i = i<<8 | int64(b)
+		}
+		return i
+	case "enum":
+		for i, ev := range enumValues(c.ColumnType) {
+			if ev == str {
+				return int64(i + 1)
+			}
+		}
+		return int64(0) // the empty string of an invalid value
+	case "set":
+		var i int64
+		sv := enumValues(c.ColumnType)
+		for _, member := range strings.Split(str, ",") {
+			for j, ev := range sv {
+				if ev == member {
+					i |= 1 << uint(j)
+				}
+			}
+		}
+		return i
+	case "json", "geometry", "point", "linestring", "polygon", "multipoint",
+		"multilinestring", "multipolygon", "geometrycollection":
+		return raw
+	}
+	if strings.Contains(c.DataType, "blob") || strings.Contains(c.DataType, "text") {
+		return raw
+	}
+	return str
+}
+
+// enumValues returns the values of an enum or set column type like
+// enum('a','b').
+func enumValues(columnType string) []string {
+	i := strings.IndexByte(columnType, '(')
+	if i < 0 {
+		return nil
+	}
+	var vals []string
+	var buf strings.Builder
+	var quoted bool
+	for ct := columnType[i+1:]; len(ct) > 0; ct = ct[1:] {
+		switch {
+		case quoted && strings.HasPrefix(ct, "''"):
+			buf.WriteByte('\'')
+			ct = ct[1:]
+		case ct[0] == '\'':
+			if quoted {
+				vals = append(vals, buf.String())
+				buf.Reset()
+			}
+			quoted = !quoted
+		case quoted:
+			buf.WriteByte(ct[0])
+		}
+	}
+	return vals
+}
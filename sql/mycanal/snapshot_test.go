@@ -0,0 +1,181 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	simysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/myreplicator"
+	"github.com/weiwolves/pkg/storage/null"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestSnapshotChunkSQL(t *testing.T) {
+	t.Parallel()
+
+	tbl := ddl.NewTable("catalog_product_entity_int",
+		&ddl.Column{Field: "entity_id", Key: "PRI", DataType: "int", ColumnType: "int(10) unsigned"},
+		&ddl.Column{Field: "store_id", Key: "PRI", DataType: "smallint", ColumnType: "smallint(5) unsigned"},
+		&ddl.Column{Field: "value", DataType: "int", ColumnType: "int(11)"},
+	)
+
+	t.Run("first chunk", func(t *testing.T) {
+		assert.Exactly(t,
+			"SELECT `entity_id`,`store_id`,`value` FROM `catalog_product_entity_int` ORDER BY `entity_id`,`store_id` LIMIT 500",
+			snapshotChunkSQL(tbl, []int{0, 1}, false, 0, 500))
+	})
+	t.Run("next chunk", func(t *testing.T) {
+		assert.Exactly(t,
+			"SELECT `entity_id`,`store_id`,`value` FROM `catalog_product_entity_int` WHERE (`entity_id`,`store_id`) > (?,?) ORDER BY `entity_id`,`store_id` LIMIT 500",
+			snapshotChunkSQL(tbl, []int{0, 1}, true, 0, 500))
+	})
+	t.Run("without primary key", func(t *testing.T) {
+		assert.Exactly(t,
+			"SELECT `entity_id`,`store_id`,`value` FROM `catalog_product_entity_int` LIMIT 500 OFFSET 1000",
+			snapshotChunkSQL(tbl, nil, false, 1000, 500))
+	})
+}
+
+func TestSnapshotValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		col  *ddl.Column
+		have interface{}
+		want interface{}
+	}{
+		{&ddl.Column{DataType: "int", ColumnType: "int(11)"}, []byte("-42"), int32(-42)},
+		{&ddl.Column{DataType: "bigint", ColumnType: "bigint(20) unsigned"}, []byte("18446744073709551615"), int64(-1)},
+		{&ddl.Column{DataType: "double", ColumnType: "double"}, []byte("3.5"), 3.5},
+		{&ddl.Column{DataType: "decimal", ColumnType: "decimal(12,4)"}, []byte("12.3400"), null.MakeDecimalInt64(123400, 4)},
+		{&ddl.Column{DataType: "varchar", ColumnType: "varchar(255)"}, []byte("Gopher"), "Gopher"},
+		{&ddl.Column{DataType: "blob", ColumnType: "blob"}, []byte{0x1, 0x2}, []byte{0x1, 0x2}},
+		{&ddl.Column{DataType: "enum", ColumnType: "enum('a','it''s')"}, []byte("it's"), int64(2)},
+		// the binary protocol of prepared statements
+		{&ddl.Column{DataType: "int", ColumnType: "int(11)"}, int64(7), int32(7)},
+		{&ddl.Column{DataType: "smallint", ColumnType: "smallint(5) unsigned"}, int64(65535), int16(-1)},
+		{&ddl.Column{DataType: "float", ColumnType: "float"}, float32(0.1), float32(0.1)},
+		{&ddl.Column{DataType: "varchar", ColumnType: "varchar(255)"}, nil, nil},
+	}
+	for i, test := range tests {
+		assert.Exactly(t, test.want, snapshotValue(test.col, test.have), "Index %d", i)
+	}
+}
+
+// decodeBinlogValue decodes a single column of a WRITE_ROWS_EVENTv2 with the
+// binlog parser. meta contains the column meta data of the table map event
+// and data the encoded value.
+func decodeBinlogValue(t *testing.T, typ byte, meta, data []byte) interface{} {
+	p := myreplicator.NewBinlogParser()
+	event := func(et myreplicator.EventType, body []byte) {
+		h := make([]byte, myreplicator.EventHeaderSize)
+		h[4] = byte(et)
+		binary.LittleEndian.PutUint32(h[9:], uint32(myreplicator.EventHeaderSize+len(body)))
+		if _, err := p.Parse(append(h, body...)); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+
+	body := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(body, 4)
+	copy(body[2:], "5.5.0-test")
+	body[56] = byte(myreplicator.EventHeaderSize)
+	// post header lengths of 8 select a table ID size of 6 bytes.
+	event(myreplicator.FORMAT_DESCRIPTION_EVENT, append(body, bytes.Repeat([]byte{8}, 40)...))
+
+	body = []byte{7, 0, 0, 0, 0, 0, 1, 0, 1, 'd', 0, 1, 't', 0, 1, typ, byte(len(meta))}
+	body = append(body, meta...)
+	event(myreplicator.TABLE_MAP_EVENT, append(body, 0))
+
+	var row []interface{}
+	body = []byte{7, 0, 0, 0, 0, 0, 1, 0, 2, 0, 1, 0xff, 0}
+	h := make([]byte, myreplicator.EventHeaderSize)
+	h[4] = byte(myreplicator.WRITE_ROWS_EVENTv2)
+	body = append(body, data...)
+	binary.LittleEndian.PutUint32(h[9:], uint32(myreplicator.EventHeaderSize+len(body)))
+	ev, err := p.Parse(append(h, body...))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if re, ok := ev.Event.(*myreplicator.RowsEvent); ok && len(re.Rows) == 1 {
+		row = re.Rows[0]
+	}
+	if len(row) != 1 {
+		t.Fatalf("Expected one row with one column: %#v", ev.Event)
+	}
+	return row[0]
+}
+
+// TestSnapshotValue_Binlog compares the values of the text protocol converted
+// by snapshotValue with the values of the binlog decoder.
+func TestSnapshotValue_Binlog(t *testing.T) {
+	t.Parallel()
+
+	le := func(v uint64, n int) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, v)
+		return b[:n]
+	}
+	datetime2 := func(year, month, day, hour, min, sec int64) []byte {
+		v := ((year*13+month)<<5|day)<<17 | hour<<12 | min<<6 | sec
+		v += 0x8000000000
+		return []byte{byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	tests := []struct {
+		col  *ddl.Column
+		typ  byte
+		meta []byte
+		data []byte
+		text string
+	}{
+		{&ddl.Column{DataType: "tinyint", ColumnType: "tinyint(4)"}, simysql.MYSQL_TYPE_TINY, nil, []byte{0xfb}, "-5"},
+		{&ddl.Column{DataType: "tinyint", ColumnType: "tinyint(3) unsigned"}, simysql.MYSQL_TYPE_TINY, nil, []byte{200}, "200"},
+		{&ddl.Column{DataType: "smallint", ColumnType: "smallint(6)"}, simysql.MYSQL_TYPE_SHORT, nil, le(uint64(0xfed4), 2), "-300"},
+		{&ddl.Column{DataType: "smallint", ColumnType: "smallint(5) unsigned"}, simysql.MYSQL_TYPE_SHORT, nil, le(65535, 2), "65535"},
+		{&ddl.Column{DataType: "mediumint", ColumnType: "mediumint(9)"}, simysql.MYSQL_TYPE_INT24, nil, []byte{0xfe, 0xff, 0xff}, "-2"},
+		{&ddl.Column{DataType: "mediumint", ColumnType: "mediumint(8) unsigned"}, simysql.MYSQL_TYPE_INT24, nil, []byte{0xff, 0xff, 0xff}, "16777215"},
+		{&ddl.Column{DataType: "int", ColumnType: "int(11)"}, simysql.MYSQL_TYPE_LONG, nil, le(uint64(0xfffeee90), 4), "-70000"},
+		{&ddl.Column{DataType: "int", ColumnType: "int(10) unsigned"}, simysql.MYSQL_TYPE_LONG, nil, le(4294967295, 4), "4294967295"},
+		{&ddl.Column{DataType: "bigint", ColumnType: "bigint(20)"}, simysql.MYSQL_TYPE_LONGLONG, nil, le(1<<62, 8), "4611686018427387904"},
+		{&ddl.Column{DataType: "bigint", ColumnType: "bigint(20) unsigned"}, simysql.MYSQL_TYPE_LONGLONG, nil, le(18446744073709551615, 8), "18446744073709551615"},
+		{&ddl.Column{DataType: "year", ColumnType: "year(4)"}, simysql.MYSQL_TYPE_YEAR, nil, []byte{120}, "2020"},
+		{&ddl.Column{DataType: "float", ColumnType: "float"}, simysql.MYSQL_TYPE_FLOAT, []byte{4}, le(uint64(math.Float32bits(0.1)), 4), "0.1"},
+		{&ddl.Column{DataType: "double", ColumnType: "double"}, simysql.MYSQL_TYPE_DOUBLE, []byte{8}, le(math.Float64bits(3.25), 8), "3.25"},
+		{&ddl.Column{DataType: "decimal", ColumnType: "decimal(10,2)"}, simysql.MYSQL_TYPE_NEWDECIMAL, []byte{10, 2}, []byte{0x80, 0x00, 0x04, 0xd2, 0x38}, "1234.56"},
+		{&ddl.Column{DataType: "decimal", ColumnType: "decimal(10,2)"}, simysql.MYSQL_TYPE_NEWDECIMAL, []byte{10, 2}, []byte{0x7f, 0xff, 0xff, 0xfe, 0xcd}, "-1.50"},
+		{&ddl.Column{DataType: "bit", ColumnType: "bit(10)"}, simysql.MYSQL_TYPE_BIT, []byte{2, 1}, []byte{0x02, 0x01}, "\x02\x01"},
+		{&ddl.Column{DataType: "enum", ColumnType: "enum('a','b','c')"}, simysql.MYSQL_TYPE_STRING, []byte{simysql.MYSQL_TYPE_ENUM, 1}, []byte{2}, "b"},
+		{&ddl.Column{DataType: "set", ColumnType: "set('x','y','z')"}, simysql.MYSQL_TYPE_STRING, []byte{simysql.MYSQL_TYPE_SET, 1}, []byte{5}, "x,z"},
+		{&ddl.Column{DataType: "char", ColumnType: "char(10)"}, simysql.MYSQL_TYPE_STRING, []byte{simysql.MYSQL_TYPE_STRING, 10}, []byte("\x03abc"), "abc"},
+		{&ddl.Column{DataType: "varchar", ColumnType: "varchar(255)"}, simysql.MYSQL_TYPE_VARCHAR, []byte{255, 0}, []byte("\x06Gopher"), "Gopher"},
+		{&ddl.Column{DataType: "varbinary", ColumnType: "varbinary(16)"}, simysql.MYSQL_TYPE_VARCHAR, []byte{16, 0}, []byte{2, 0, 1}, "\x00\x01"},
+		{&ddl.Column{DataType: "text", ColumnType: "text"}, simysql.MYSQL_TYPE_BLOB, []byte{2}, []byte("\x05\x00hello"), "hello"},
+		{&ddl.Column{DataType: "blob", ColumnType: "blob"}, simysql.MYSQL_TYPE_BLOB, []byte{2}, []byte{2, 0, 0xca, 0xfe}, "\xca\xfe"},
+		{&ddl.Column{DataType: "json", ColumnType: "json"}, simysql.MYSQL_TYPE_JSON, []byte{4}, []byte{5, 0, 0, 0, 0x0c, 3, 'a', 'b', 'c'}, `"abc"`},
+		{&ddl.Column{DataType: "date", ColumnType: "date"}, simysql.MYSQL_TYPE_DATE, nil, le(2020*16*32+1*32+2, 3), "2020-01-02"},
+		{&ddl.Column{DataType: "datetime", ColumnType: "datetime"}, simysql.MYSQL_TYPE_DATETIME2, []byte{0}, datetime2(2020, 1, 2, 3, 4, 5), "2020-01-02 03:04:05"},
+	}
+	for _, test := range tests {
+		want := decodeBinlogValue(t, test.typ, test.meta, test.data)
+		have := snapshotValue(test.col, []byte(test.text))
+		assert.Exactly(t, want, have, "Column type %q", test.col.ColumnType)
+	}
+}
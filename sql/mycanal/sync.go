@@ -7,6 +7,7 @@ import (
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
+	simysql "github.com/siddontang/go-mysql/mysql"
 	"github.com/weiwolves/pkg/sql/ddl"
 	"github.com/weiwolves/pkg/sql/myreplicator"
 )
@@ -96,7 +97,7 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 	}
 
 	c.masterMu.RLock()
-	pos := c.masterStatus
+	sp := syncPosition{pos: c.masterStatus, commitPos: c.masterStatus}
 	c.masterMu.RUnlock()
 	for {
 		ev, err := s.GetEvent(ctxArg)
@@ -107,102 +108,118 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 				}
 				return nil
 			}
+			return errors.ConnectionLost.New(err, "[mycanal] Failed to read the next binlog event at position %s", sp.pos)
+		}
+		if err := c.handleEvent(ctxArg, ev, &sp); err != nil {
 			return errors.WithStack(err)
 		}
+	}
+}
 
-		currentPos := pos
-		//next binlog pos
-		pos.Position = uint(ev.Header.LogPos)
+// syncPosition tracks the position of the binlog stream. pos points to the end
+// of the last event and commitPos to the end of the last completed
+// transaction.
+type syncPosition struct {
+	pos       ddl.MasterStatus
+	commitPos ddl.MasterStatus
+}
 
-		switch e := ev.Event.(type) {
-		case *myreplicator.RotateEvent:
-			if err := c.flushEventHandlers(ctxArg); err != nil {
-				// todo maybe better err handling ...
-				return errors.WithStack(err)
-			}
-			pos.File = string(e.NextLogName)
-			pos.Position = uint(e.Position)
-			// r.ev <- pos
+// handleEvent processes one event of the binlog stream and saves the position
+// and the GTID set of the last completed transaction.
+func (c *Canal) handleEvent(ctx context.Context, ev *myreplicator.BinlogEvent, sp *syncPosition) error {
+	currentPos := sp.pos
+	// gset contains the GTID set of a completed transaction
+	var gset simysql.GTIDSet
+	//next binlog pos
+	sp.pos.Position = uint(ev.Header.LogPos)
+
+	switch e := ev.Event.(type) {
+	case *myreplicator.RotateEvent:
+		if err := c.flushEventHandlers(ctx); err != nil {
+			// todo maybe better err handling ...
+			return errors.WithStack(err)
+		}
+		sp.pos.File = string(e.NextLogName)
+		sp.pos.Position = uint(e.Position)
+		sp.commitPos = sp.pos
+		// r.ev <- pos
 
+		if c.opts.Log.IsDebug() {
+			c.opts.Log.Debug("myCanal.startSyncBinlog.rotateEvent.newPosition", log.Stringer("position", sp.pos))
+		}
+
+		// call event handler OnRotate(e)
+
+	case *myreplicator.RowsEvent:
+		// we only focus row based event.
+		// NotFound errors get ignores. For example table has been deleted
+		// and an old event pops in.
+		ep := EventPosition{
+			File:           sp.pos.File,
+			Position:       sp.pos.Position,
+			CommitFile:     sp.commitPos.File,
+			CommitPosition: sp.commitPos.Position,
+			Timestamp:      time.Unix(int64(ev.Header.Timestamp), 0),
+		}
+		if gs := c.SyncedGTIDSet(); gs != nil {
+			ep.GTIDSet = gs.String()
+		}
+		if err := c.handleRowsEvent(WithEventPosition(ctx, ep), ev); err != nil {
+			isNotFound := errors.NotFound.Match(err)
 			if c.opts.Log.IsDebug() {
-				c.opts.Log.Debug("myCanal.startSyncBinlog.rotateEvent.newPosition", log.Stringer("position", pos))
+				c.opts.Log.Debug("myCanal.startSyncBinlog.rowsEvent.newPosition", log.Err(err),
+					log.Stringer("header_position", sp.pos), log.Stringer("current_position", currentPos),
+					log.Bool("ignore_not_found_error", isNotFound))
+			}
+			if !isNotFound {
+				return errors.WithStack(err)
 			}
+			return nil // to not save the master position, not necessary.
+		}
+	case *myreplicator.XIDEvent:
+		gset = e.GSet
+		sp.commitPos = sp.pos
+
+	case *myreplicator.MariadbGTIDEvent, *myreplicator.GTIDEvent:
+		// The BinlogSyncer adds the GTID to its set, which gets reported
+		// by the XIDEvent or QueryEvent completing the transaction.
+
+	case *myreplicator.QueryEvent:
+		// DDL statements and the BEGIN of a transaction. Only the GTID set
+		// of a query completing a transaction gets stored, so that the set
+		// never contains the open transaction.
+		if !e.IsBegin() {
+			// DDL statements and the COMMIT of non-transactional tables
+			gset = e.GSet
+			sp.commitPos = sp.pos
+		}
 
-			// call event handler OnRotate(e)
+		// handle alert table query
+		c.clearTableCacheOnDDLStmt(e.Schema, e.Query)
 
-		case *myreplicator.RowsEvent:
-			// we only focus row based event.
-			// NotFound errors get ignores. For example table has been deleted
-			// and an old event pops in.
-			if err = c.handleRowsEvent(ctxArg, ev); err != nil {
-				isNotFound := errors.MatchKind(err, errors.NotFound)
-				if c.opts.Log.IsDebug() {
-					c.opts.Log.Debug("myCanal.startSyncBinlog.rowsEvent.newPosition", log.Err(err),
-						log.Stringer("header_position", pos), log.Stringer("current_position", currentPos),
-						log.Bool("ignore_not_found_error", isNotFound))
-				}
-				if !isNotFound {
-					return errors.WithStack(err)
-				}
-				continue // to not save the master position, not necessary.
-			}
-		case *myreplicator.XIDEvent:
-			// TODO implement
-			// if e.GSet != nil {
-			// 	c.master.UpdateGTIDSet(e.GSet)
-			// }
-
-		case *myreplicator.MariadbGTIDEvent:
-			// TODO implement
-			// gtid, err := mysql.ParseMariadbGTIDSet(e.GTID.String())
-			// if err != nil {
-			// 	return errors.WithStack(err)
-			// }
-			// if err := c.eventHandler.OnGTID(gtid); err != nil {
-			// 	return errors.Trace(err)
-			// }
-
-		case *myreplicator.GTIDEvent:
-			// TODO implement
-			// u, _ := uuid.FromBytes(e.SID)
-			// gtid, err := mysql.ParseMysqlGTIDSet(fmt.Sprintf("%s:%d", u.String(), e.GNO))
-			// if err != nil {
-			// 	return errors.Trace(err)
-			// }
-			// if err := c.eventHandler.OnGTID(gtid); err != nil {
-			// 	return errors.Trace(err)
-			// }
-
-		case *myreplicator.QueryEvent:
-			// TODO implement GTID set but review if it makes sense to import siddontang/go-mysql/mysql
-			// if e.GSet != nil {
-			// 	c.master.UpdateGTIDSet(e.GSet)
-			// }
-
-			// handle alert table query
-			c.clearTableCacheOnDDLStmt(e.Schema, e.Query)
-
-			// For now really necessary.
-			// TODO: call two more event handlers: on OnTableChanged(db,table) and OnDDL(pos, e)
-
-			// save master position, so no continue
-		case
-			*myreplicator.TableMapEvent,
-			*myreplicator.FormatDescriptionEvent:
-			// don't update Master with file and position
-		default:
-			if c.opts.Log.IsDebug() {
-				c.opts.Log.Debug("myCanal.startSyncBinlog.unknown.event", log.ObjectTypeOf("event_type", ev.Event), log.Stringer("position", pos))
-			}
-			continue
+		// For now really necessary.
+		// TODO: call two more event handlers: on OnTableChanged(db,table) and OnDDL(pos, e)
+
+		// save master position, so no continue
+	case
+		*myreplicator.TableMapEvent,
+		*myreplicator.FormatDescriptionEvent:
+		// don't update Master with file and position
+	default:
+		if c.opts.Log.IsDebug() {
+			c.opts.Log.Debug("myCanal.startSyncBinlog.unknown.event", log.ObjectTypeOf("event_type", ev.Event), log.Stringer("position", sp.pos))
 		}
+		return nil
+	}
 
-		if err := c.masterSave(pos.File, pos.Position); err != nil {
-			if c.opts.Log.IsInfo() {
-				c.opts.Log.Info("myCanal.startSyncBinlog.master.position.Failed", log.Err(err), log.Stringer("position", pos))
-			}
+	// Only the end of a completed transaction gets saved, so that a
+	// restarted stream never begins within a transaction.
+	if err := c.masterSave(sp.commitPos.File, sp.commitPos.Position, gset); err != nil {
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("myCanal.startSyncBinlog.master.position.Failed", log.Err(err), log.Stringer("position", sp.pos))
 		}
 	}
+	return nil
 }
 
 // handleRowsEvent handles an event on the rows and calls all registered rows
@@ -0,0 +1,109 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mycanal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/go-sql-driver/mysql"
+	simysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/config"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/myreplicator"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// configRecorder records the values written via config.Setter.
+type configRecorder map[string]string
+
+func (cr configRecorder) Set(p config.Path, value []byte) error {
+	cr[p.String()] = string(value)
+	return nil
+}
+
+type testPositionHandler struct {
+	positions []EventPosition
+}
+
+func (h *testPositionHandler) Do(ctx context.Context, _ string, _ *ddl.Table, _ [][]interface{}) error {
+	ep, _ := EventPositionFromContext(ctx)
+	h.positions = append(h.positions, ep)
+	return nil
+}
+
+func (h *testPositionHandler) Complete(context.Context) error { return nil }
+
+func (h *testPositionHandler) String() string { return "testPositionHandler" }
+
+func TestCanal_HandleEvent_OpenTransaction(t *testing.T) {
+	t.Parallel()
+
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562:"
+	mustGSet := func(s string) simysql.GTIDSet {
+		gs, err := simysql.ParseGTIDSet(simysql.MySQLFlavor, sid+s)
+		assert.NoError(t, err)
+		return gs
+	}
+
+	cr := configRecorder{}
+	c := &Canal{
+		opts: Options{Log: log.BlackHole{}, ConfigSet: cr},
+		dsn:  &mysql.Config{DBName: "shop"},
+		tables: ddl.MustNewTables(ddl.WithTable("customer",
+			&ddl.Column{Field: "id", Key: "PRI", DataType: "int", ColumnType: "int(10) unsigned"},
+			&ddl.Column{Field: "name", DataType: "varchar", ColumnType: "varchar(255)"},
+		)),
+		configPathBackendPosition: config.MustMakePath(ConfigPathBackendPosition),
+		configPathBackendGTID:     config.MustMakePath(ConfigPathBackendGTID),
+		masterStatus:              ddl.MasterStatus{File: "mysql-bin.000001", Position: 4},
+		masterGTID:                mustGSet("1-5"),
+	}
+	h := &testPositionHandler{}
+	c.RegisterRowsEventHandler([]string{"customer"}, h)
+
+	ctx := context.Background()
+	sp := syncPosition{pos: c.masterStatus, commitPos: c.masterStatus}
+	event := func(logPos uint32, et myreplicator.EventType, e myreplicator.EventDecoder) {
+		ev := &myreplicator.BinlogEvent{
+			Header: &myreplicator.EventHeader{LogPos: logPos, EventType: et},
+			Event:  e,
+		}
+		assert.NoError(t, c.handleEvent(ctx, ev, &sp))
+	}
+
+	event(100, myreplicator.GTID_EVENT, &myreplicator.GTIDEvent{GNO: 6})
+	// The GTID set of a BEGIN must be ignored even if it contains the open
+	// transaction.
+	event(200, myreplicator.QUERY_EVENT, &myreplicator.QueryEvent{Query: []byte("BEGIN"), GSet: mustGSet("1-6")})
+	event(300, myreplicator.WRITE_ROWS_EVENTv2, &myreplicator.RowsEvent{
+		Table: &myreplicator.TableMapEvent{Schema: []byte("shop"), Table: []byte("customer")},
+		Rows:  [][]interface{}{{int32(1), "Ada"}},
+	})
+	// now the connection gets lost.
+
+	assert.Len(t, h.positions, 1)
+	assert.Exactly(t, sid+"1-5", h.positions[0].GTIDSet)
+	assert.Exactly(t, uint(4), h.positions[0].CommitPosition)
+	assert.Exactly(t, uint(300), h.positions[0].Position)
+	assert.Exactly(t, sid+"1-5", c.SyncedGTIDSet().String())
+	assert.Exactly(t, sid+"1-5", cr[c.configPathBackendGTID.String()], "the persisted GTID set must not contain the open transaction")
+	assert.Exactly(t, ddl.MasterStatus{File: "mysql-bin.000001", Position: 4}, c.SyncedPosition())
+
+	event(400, myreplicator.XID_EVENT, &myreplicator.XIDEvent{GSet: mustGSet("1-6")})
+	assert.Exactly(t, sid+"1-6", c.SyncedGTIDSet().String())
+	assert.Exactly(t, ddl.MasterStatus{File: "mysql-bin.000001", Position: 400}, c.SyncedPosition())
+}
@@ -0,0 +1,212 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package myreplicator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+)
+
+// Row actions of a RowsEvent.
+const (
+	RowsActionInsert = "insert"
+	RowsActionUpdate = "update"
+	RowsActionDelete = "delete"
+)
+
+// RowsAction returns the action of a rows event type or an empty string if the
+// type is not a rows event.
+func RowsAction(t EventType) string {
+	switch t {
+	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2:
+		return RowsActionInsert
+	case UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2:
+		return RowsActionUpdate
+	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
+		return RowsActionDelete
+	}
+	return ""
+}
+
+// FileFilter restricts the events of binary log files. Zero values disable a
+// restriction. Start values are inclusive, stop values exclusive, like the
+// options of the mysqlbinlog tool. A start position should point to the
+// beginning of a transaction, otherwise the rows events miss their table map
+// events.
+type FileFilter struct {
+	// Schema restricts the table map, rows and query events to this
+	// database. BEGIN and COMMIT query events get always returned.
+	Schema string
+	// Tables restricts the table map and rows events to these table names.
+	Tables []string
+	// StartTime skips all events written before.
+	StartTime time.Time
+	// StopTime stops at the first event written at or after the time.
+	StopTime time.Time
+	// StartPosition skips all events before the binary log file and the
+	// position.
+	StartPosition ddl.MasterStatus
+	// StopPosition stops at the first event starting at or after the binary
+	// log file and the position.
+	StopPosition ddl.MasterStatus
+}
+
+// OnFileEventFunc gets called for each event of a binary log file.
+type OnFileEventFunc func(fileName string, e *BinlogEvent) error
+
+var errStopParsing = errors.New("[myreplicator] stop parsing")
+
+// accept reports whether the event passes the filter. Argument stop becomes
+// true, if no further events must be parsed.
+func (ff FileFilter) accept(fileName string, e *BinlogEvent) (ok bool, stop bool) {
+	h := e.Header
+	ts := time.Unix(int64(h.Timestamp), 0)
+	start := ddl.MasterStatus{File: fileName, Position: uint(h.LogPos - h.EventSize)}
+	if h.LogPos < h.EventSize {
+		start.Position = 0
+	}
+
+	switch {
+	case !ff.StopTime.IsZero() && h.Timestamp > 0 && !ts.Before(ff.StopTime):
+		return false, true
+	case ff.StopPosition.File != "" && start.Position > 0 && start.Compare(ff.StopPosition) >= 0:
+		return false, true
+	case !ff.StartTime.IsZero() && ts.Before(ff.StartTime):
+		return false, false
+	case ff.StartPosition.File != "" && start.Compare(ff.StartPosition) < 0:
+		return false, false
+	}
+
+	switch ev := e.Event.(type) {
+	case *TableMapEvent:
+		return ff.acceptTable(ev.Schema, ev.Table), false
+	case *RowsEvent:
+		return ev.Table != nil && ff.acceptTable(ev.Table.Schema, ev.Table.Table), false
+	case *QueryEvent:
+		if ff.Schema == "" || isTxQuery(ev.Query) {
+			return true, false
+		}
+		return string(ev.Schema) == ff.Schema, false
+	}
+	return true, false
+}
+
+func (ff FileFilter) acceptTable(schema, table []byte) bool {
+	if ff.Schema != "" && string(schema) != ff.Schema {
+		return false
+	}
+	if len(ff.Tables) == 0 {
+		return true
+	}
+	for _, t := range ff.Tables {
+		if t == string(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTxQuery reports whether the query starts or ends a transaction.
+func isTxQuery(query []byte) bool {
+	q := bytes.TrimSpace(query)
+	return bytes.EqualFold(q, []byte("BEGIN")) || bytes.EqualFold(q, []byte("COMMIT")) ||
+		bytes.EqualFold(q, []byte("ROLLBACK"))
+}
+
+// BinlogFiles returns the binary log files of a directory, for example of a
+// directory written by BinlogSyncer.StartBackup, sorted by name. Files
+// without the binary log header, like the index file, get skipped.
+func BinlogFiles(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	files := make([]string, 0, len(fis))
+	head := make([]byte, len(BinLogFileHeader))
+	for _, fi := range fis {
+		if fi.IsDir() || fi.Size() < int64(len(BinLogFileHeader)) {
+			continue
+		}
+		fileName := filepath.Join(dir, fi.Name())
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		_, err = io.ReadFull(f, head)
+		_ = f.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if bytes.Equal(head, BinLogFileHeader) {
+			files = append(files, fileName)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ParseFiles parses the binary log files in the provided order and calls
+// onEvent for each event passing the filter. The file names of the filter
+// positions get compared to the base names of the files. The parser can be
+// nil.
+func ParseFiles(ctx context.Context, p *BinlogParser, files []string, ff FileFilter, onEvent OnFileEventFunc) error {
+	if p == nil {
+		p = NewBinlogParser()
+	}
+	for _, fileName := range files {
+		baseName := filepath.Base(fileName)
+		if ff.StartPosition.File != "" && baseName < ff.StartPosition.File {
+			continue
+		}
+		if ff.StopPosition.File != "" && baseName > ff.StopPosition.File {
+			return nil
+		}
+		var offset int64
+		if baseName == ff.StartPosition.File {
+			offset = int64(ff.StartPosition.Position)
+		}
+
+		p.Reset()
+		err := p.ParseFile(fileName, offset, func(e *BinlogEvent) error {
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			ok, stop := ff.accept(baseName, e)
+			if stop {
+				return errStopParsing
+			}
+			if !ok {
+				return nil
+			}
+			return onEvent(baseName, e)
+		})
+		if errors.Cause(err) == errStopParsing {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "[myreplicator] Failed to parse file %q", fileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build ignore
+
+// This tool prints the events of binary log files as SQL or JSON, like the
+// mysqlbinlog tool, or replays them into another database for a point-in-time
+// recovery.
+//
+//	go run binlogfile_main.go -dir ./backup -start-datetime '2019-05-01 10:00:00'
+//	go run binlogfile_main.go -format json -tables catalog_product_entity mysql-bin.000042
+//	go run binlogfile_main.go -dsn 'user:pw@tcp(localhost:3306)/restore' -replay -stop-position 4711 -stop-file mysql-bin.000043 -dir ./backup
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/sql/myreplicator"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+func main() {
+	var (
+		dir, format, dsn, tables string
+		startTime, stopTime      string
+		ff                       myreplicator.FileFilter
+		replay, replayQueries    bool
+	)
+	flag.StringVar(&dir, "dir", "", "Directory with the binary log files, for example written by BinlogSyncer.StartBackup. Alternatively pass the files as arguments.")
+	flag.StringVar(&format, "format", myreplicator.EventFormatSQL, "Output format: sql or json")
+	flag.StringVar(&ff.Schema, "schema", "", "Restricts the events to this database")
+	flag.StringVar(&tables, "tables", "", "Comma separated list of table names")
+	flag.StringVar(&startTime, "start-datetime", "", "Skips the events before this UTC time, format "+timeLayout)
+	flag.StringVar(&stopTime, "stop-datetime", "", "Stops at this UTC time, format "+timeLayout)
+	flag.StringVar(&ff.StartPosition.File, "start-file", "", "Binary log file to start with")
+	flag.UintVar(&ff.StartPosition.Position, "start-position", 0, "Position in the start file")
+	flag.StringVar(&ff.StopPosition.File, "stop-file", "", "Binary log file to stop in")
+	flag.UintVar(&ff.StopPosition.Position, "stop-position", 0, "Position in the stop file")
+	flag.StringVar(&dsn, "dsn", os.Getenv(dml.EnvDSN), "Database for the column names and the replay")
+	flag.BoolVar(&replay, "replay", false, "Applies the events to the database of the DSN instead of printing them")
+	flag.BoolVar(&replayQueries, "replay-queries", false, "Replays also the query events, like DDL statements")
+	flag.Parse()
+
+	if tables != "" {
+		ff.Tables = strings.Split(tables, ",")
+	}
+	var err error
+	if ff.StartTime, err = parseTime(startTime); err != nil {
+		fatal(err)
+	}
+	if ff.StopTime, err = parseTime(stopTime); err != nil {
+		fatal(err)
+	}
+
+	files := flag.Args()
+	if dir != "" {
+		if files, err = myreplicator.BinlogFiles(dir); err != nil {
+			fatal(err)
+		}
+	}
+	if len(files) == 0 {
+		fatal(errors.Empty.Newf("[binlogfile] Please provide a -dir or binary log files"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	var dbcp *dml.ConnPool
+	if dsn != "" {
+		if dbcp, err = dml.NewConnPool(dml.WithDSN(dsn)); err != nil {
+			fatal(err)
+		}
+		defer dbcp.Close()
+	}
+
+	var onEvent myreplicator.OnFileEventFunc
+	if replay {
+		if dbcp == nil {
+			fatal(errors.Empty.Newf("[binlogfile] Replay requires a -dsn"))
+		}
+		r, err := myreplicator.NewReplayer(dbcp, &myreplicator.ReplayOptions{ReplayQueries: replayQueries})
+		if err != nil {
+			fatal(err)
+		}
+		defer func() {
+			if err := r.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+			}
+			fmt.Fprintf(os.Stderr, "Applied %d rows\n", r.RowsApplied)
+		}()
+		onEvent = func(_ string, e *myreplicator.BinlogEvent) error {
+			return r.Apply(ctx, e)
+		}
+	} else {
+		ew, err := myreplicator.NewEventWriter(os.Stdout, format)
+		if err != nil {
+			fatal(err)
+		}
+		if dbcp != nil {
+			tbls, err := ddl.NewTables(ddl.WithConnPool(dbcp))
+			if err != nil {
+				fatal(err)
+			}
+			// The tables get loaded from the default database of the DSN.
+			ew.ColumnNames = func(_, name string) []string {
+				t, err := tbls.Table(name)
+				if err != nil {
+					if err := tbls.Options(ddl.WithCreateTable(ctx, name, "")); err != nil {
+						return nil
+					}
+					if t, err = tbls.Table(name); err != nil {
+						return nil
+					}
+				}
+				return t.Columns.FieldNames()
+			}
+		}
+		onEvent = ew.WriteEvent
+	}
+
+	if err := myreplicator.ParseFiles(ctx, nil, files, ff, onEvent); err != nil {
+		fatal(err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(timeLayout, s, time.UTC)
+	return t, errors.NotValid.New(err, "[binlogfile] Invalid time %q", s)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "%+v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,322 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package myreplicator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// binlogTestWriter writes a binary log file without checksums containing the
+// table shop.customer(id INT, name VARCHAR(255)).
+type binlogTestWriter struct {
+	buf bytes.Buffer
+}
+
+func newBinlogTestWriter() *binlogTestWriter {
+	w := &binlogTestWriter{}
+	w.buf.Write(BinLogFileHeader)
+
+	body := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(body, 4)
+	copy(body[2:], "5.5.0-test")
+	body[56] = byte(EventHeaderSize)
+	// post header lengths of 8 select a table ID size of 6 bytes.
+	body = append(body, bytes.Repeat([]byte{8}, 40)...)
+	w.event(100, FORMAT_DESCRIPTION_EVENT, body)
+	return w
+}
+
+func (w *binlogTestWriter) event(ts uint32, et EventType, body []byte) {
+	h := make([]byte, EventHeaderSize)
+	size := uint32(EventHeaderSize + len(body))
+	binary.LittleEndian.PutUint32(h[0:], ts)
+	h[4] = byte(et)
+	binary.LittleEndian.PutUint32(h[5:], 1)
+	binary.LittleEndian.PutUint32(h[9:], size)
+	binary.LittleEndian.PutUint32(h[13:], uint32(w.buf.Len())+size)
+	w.buf.Write(h)
+	w.buf.Write(body)
+}
+
+func (w *binlogTestWriter) query(ts uint32, query string) {
+	body := make([]byte, 13)
+	body[8] = byte(len("shop"))
+	body = append(body, "shop"...)
+	body = append(body, 0)
+	body = append(body, query...)
+	w.event(ts, QUERY_EVENT, body)
+}
+
+func (w *binlogTestWriter) xid(ts uint32, xid uint64) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, xid)
+	w.event(ts, XID_EVENT, body)
+}
+
+func (w *binlogTestWriter) tableMap(ts uint32, table string) {
+	body := []byte{7, 0, 0, 0, 0, 0, 1, 0}
+	body = append(body, byte(len("shop")))
+	body = append(body, "shop"...)
+	body = append(body, 0, byte(len(table)))
+	body = append(body, table...)
+	body = append(body, 0)
+	// two columns: LONG and VARCHAR(255), the null bitmap allows NULL for
+	// the name.
+	body = append(body, 2, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, 2, 0xff, 0x00, 0x02)
+	w.event(ts, TABLE_MAP_EVENT, body)
+}
+
+type testRow struct {
+	id   uint32
+	name string
+}
+
+func (w *binlogTestWriter) rows(ts uint32, et EventType, rows ...testRow) {
+	body := []byte{7, 0, 0, 0, 0, 0}
+	body = append(body, byte(RowsEventStmtEndFlag), 0, 2, 0, 2, 0x03)
+	if et == UPDATE_ROWS_EVENTv2 {
+		body = append(body, 0x03)
+	}
+	for _, r := range rows {
+		body = append(body, 0)
+		var id [4]byte
+		binary.LittleEndian.PutUint32(id[:], r.id)
+		body = append(body, id[:]...)
+		body = append(body, byte(len(r.name)))
+		body = append(body, r.name...)
+	}
+	w.event(ts, et, body)
+}
+
+func (w *binlogTestWriter) writeFile(t *testing.T, fileName string) {
+	assert.NoError(t, ioutil.WriteFile(fileName, w.buf.Bytes(), 0644))
+}
+
+// writeTestBinlogs writes two binary log files with four transactions into a
+// temporary directory.
+func writeTestBinlogs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "myreplicator")
+	assert.NoError(t, err)
+
+	w := newBinlogTestWriter()
+	w.query(100, "BEGIN")
+	w.tableMap(100, "customer")
+	w.rows(100, WRITE_ROWS_EVENTv2, testRow{1, "Ada"}, testRow{2, "Bob"})
+	w.xid(100, 11)
+	w.query(200, "BEGIN")
+	w.tableMap(200, "customer")
+	w.rows(200, UPDATE_ROWS_EVENTv2, testRow{1, "Ada"}, testRow{1, "Ada L"})
+	w.xid(200, 12)
+	w.query(300, "BEGIN")
+	w.tableMap(300, "customer")
+	w.rows(300, DELETE_ROWS_EVENTv2, testRow{2, "Bob"})
+	w.xid(300, 13)
+	w.writeFile(t, filepath.Join(dir, "mysql-bin.000001"))
+
+	w = newBinlogTestWriter()
+	w.query(400, "BEGIN")
+	w.tableMap(400, "log")
+	w.rows(400, WRITE_ROWS_EVENTv2, testRow{3, "x"})
+	w.xid(400, 14)
+	w.writeFile(t, filepath.Join(dir, "mysql-bin.000002"))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte("mysql-bin.000001\n"), 0644))
+	return dir
+}
+
+type collectedEvent struct {
+	file string
+	pos  uint32
+	typ  EventType
+}
+
+func collectEvents(t *testing.T, dir string, ff FileFilter) []collectedEvent {
+	files, err := BinlogFiles(dir)
+	assert.NoError(t, err)
+	var events []collectedEvent
+	err = ParseFiles(context.Background(), nil, files, ff, func(fileName string, e *BinlogEvent) error {
+		events = append(events, collectedEvent{file: fileName, pos: e.Header.LogPos - e.Header.EventSize, typ: e.Header.EventType})
+		return nil
+	})
+	assert.NoError(t, err, "%+v", err)
+	return events
+}
+
+func countEventTypes(events []collectedEvent, et EventType) (n int) {
+	for _, e := range events {
+		if e.typ == et {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBinlogFiles(t *testing.T) {
+	dir := writeTestBinlogs(t)
+	defer os.RemoveAll(dir)
+
+	files, err := BinlogFiles(dir)
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{
+		filepath.Join(dir, "mysql-bin.000001"),
+		filepath.Join(dir, "mysql-bin.000002"),
+	}, files)
+}
+
+func TestParseFiles(t *testing.T) {
+	dir := writeTestBinlogs(t)
+	defer os.RemoveAll(dir)
+
+	t.Run("all events", func(t *testing.T) {
+		events := collectEvents(t, dir, FileFilter{})
+		assert.Exactly(t, 2, countEventTypes(events, FORMAT_DESCRIPTION_EVENT))
+		assert.Exactly(t, 2, countEventTypes(events, WRITE_ROWS_EVENTv2))
+		assert.Exactly(t, 1, countEventTypes(events, UPDATE_ROWS_EVENTv2))
+		assert.Exactly(t, 1, countEventTypes(events, DELETE_ROWS_EVENTv2))
+		assert.Exactly(t, 4, countEventTypes(events, XID_EVENT))
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		events := collectEvents(t, dir, FileFilter{
+			StartTime: time.Unix(200, 0),
+			StopTime:  time.Unix(300, 0),
+		})
+		assert.Len(t, events, 4)
+		assert.Exactly(t, UPDATE_ROWS_EVENTv2, events[2].typ)
+	})
+
+	t.Run("tables", func(t *testing.T) {
+		events := collectEvents(t, dir, FileFilter{Schema: "shop", Tables: []string{"log"}})
+		assert.Exactly(t, 1, countEventTypes(events, WRITE_ROWS_EVENTv2))
+		assert.Exactly(t, 1, countEventTypes(events, TABLE_MAP_EVENT))
+		assert.Exactly(t, 4, countEventTypes(events, QUERY_EVENT), "BEGIN events must be kept")
+	})
+
+	t.Run("positions", func(t *testing.T) {
+		all := collectEvents(t, dir, FileFilter{})
+		// all[5] is the second BEGIN and all[9] the third BEGIN.
+		events := collectEvents(t, dir, FileFilter{
+			StartPosition: ddl.MasterStatus{File: "mysql-bin.000001", Position: uint(all[5].pos)},
+			StopPosition:  ddl.MasterStatus{File: "mysql-bin.000001", Position: uint(all[9].pos)},
+		})
+		assert.Exactly(t, []EventType{QUERY_EVENT, TABLE_MAP_EVENT, UPDATE_ROWS_EVENTv2, XID_EVENT},
+			[]EventType{events[0].typ, events[1].typ, events[2].typ, events[3].typ})
+		assert.Len(t, events, 4)
+
+		events = collectEvents(t, dir, FileFilter{
+			StartPosition: ddl.MasterStatus{File: "mysql-bin.000002", Position: 4},
+		})
+		assert.Exactly(t, 1, countEventTypes(events, WRITE_ROWS_EVENTv2))
+		assert.Exactly(t, "mysql-bin.000002", events[0].file)
+	})
+}
+
+func TestEventWriter(t *testing.T) {
+	dir := writeTestBinlogs(t)
+	defer os.RemoveAll(dir)
+	files, err := BinlogFiles(dir)
+	assert.NoError(t, err)
+
+	t.Run("SQL", func(t *testing.T) {
+		var buf bytes.Buffer
+		ew, err := NewEventWriter(&buf, EventFormatSQL)
+		assert.NoError(t, err)
+		ew.ColumnNames = func(schema, table string) []string {
+			if table == "customer" {
+				return []string{"id", "name"}
+			}
+			return nil
+		}
+		assert.NoError(t, ParseFiles(context.Background(), nil, files, FileFilter{StartTime: time.Unix(200, 0)}, ew.WriteEvent))
+
+		out := buf.String()
+		assert.Contains(t, out, "UPDATE `shop`.`customer` SET `id`=1, `name`='Ada L' WHERE `id`<=>1 AND `name`<=>'Ada' LIMIT 1;\n")
+		assert.Contains(t, out, "DELETE FROM `shop`.`customer` WHERE `id`<=>2 AND `name`<=>'Bob' LIMIT 1;\n")
+		assert.Contains(t, out, "INSERT INTO `shop`.`log` SET @1=3, @2='x';\n")
+		assert.Contains(t, out, "COMMIT; # xid=14\n")
+		assert.NotContains(t, out, "Bob' LIMIT 1;\nINSERT INTO `shop`.`customer`")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		ew, err := NewEventWriter(&buf, EventFormatJSON)
+		assert.NoError(t, err)
+		assert.NoError(t, ParseFiles(context.Background(), nil, files[1:], FileFilter{Tables: []string{"log"}}, ew.WriteEvent))
+		assert.Contains(t, buf.String(), `"schema":"shop","table":"log","action":"insert","rows":[[3,"x"]]}`)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := NewEventWriter(ioutil.Discard, "xml")
+		assert.ErrorIsKind(t, errors.NotSupported, err)
+	})
+}
+
+func TestReplayer(t *testing.T) {
+	dir := writeTestBinlogs(t)
+	defer os.RemoveAll(dir)
+	files, err := BinlogFiles(dir)
+	assert.NoError(t, err)
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	tbls, err := ddl.NewTables(
+		ddl.WithTable("customer",
+			&ddl.Column{Field: "id", Pos: 1, DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI"},
+			&ddl.Column{Field: "name", Pos: 2, DataType: "varchar", ColumnType: "varchar(255)", Null: "YES"},
+		),
+	)
+	assert.NoError(t, err)
+
+	r, err := NewReplayer(dbc, &ReplayOptions{Tables: tbls})
+	assert.NoError(t, err)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `customer` (`id`,`name`) VALUES (?,?)")).
+		WithArgs(uint64(1), "Ada").WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `customer` (`id`,`name`) VALUES (?,?)")).
+		WithArgs(uint64(2), "Bob").WillReturnResult(sqlmock.NewResult(2, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `customer` SET `id`=?, `name`=? WHERE (`id` = ?) LIMIT 1")).
+		WithArgs(uint64(1), "Ada L", uint64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `customer` WHERE (`id` = ?) LIMIT 1")).
+		WithArgs(uint64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	ctx := context.Background()
+	err = ParseFiles(ctx, nil, files, FileFilter{Tables: []string{"customer"}}, func(_ string, e *BinlogEvent) error {
+		return r.Apply(ctx, e)
+	})
+	assert.NoError(t, err, "%+v", err)
+	assert.NoError(t, r.Close())
+	assert.Exactly(t, uint64(4), r.RowsApplied)
+}
@@ -108,7 +108,11 @@ type BinlogSyncer struct {
 
 	nextPos ddl.MasterStatus
 
-	gset mysql.GTIDSet
+	// gset contains the GTID of the open transaction while committedGset
+	// contains only the completed transactions. A reconnect continues from
+	// committedGset, so the open transaction gets sent again.
+	gset          mysql.GTIDSet
+	committedGset mysql.GTIDSet
 
 	running bool
 
@@ -408,6 +412,12 @@ func (b *BinlogSyncer) StartSyncGTID(gset mysql.GTIDSet) (*BinlogStream, error)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	// The GTID set gets updated with each GTID event and the committed set
+	// with each completed transaction, so reconnects continue from the last
+	// completed transaction and XIDEvent.GSet and QueryEvent.GSet get
+	// populated.
+	b.gset = gset.Clone()
+	b.committedGset = gset.Clone()
 
 	return b.startDumpStream(), nil
 }
@@ -581,12 +591,13 @@ func (b *BinlogSyncer) retrySync() error {
 
 	b.parser.Reset()
 
-	if b.gset != nil {
-		if err := b.prepareSyncGTID(b.gset); err != nil {
+	if b.committedGset != nil {
+		if err := b.prepareSyncGTID(b.committedGset); err != nil {
 			return errors.WithStack(err)
 		}
+		b.gset = b.committedGset.Clone()
 		if b.cfg.Log.IsDebug() {
-			b.cfg.Log.Debug("BinlogSyncer.retrySync.start", log.Stringer("pos", b.gset))
+			b.cfg.Log.Debug("BinlogSyncer.retrySync.start", log.Stringer("pos", b.committedGset))
 		}
 	} else {
 		if err := b.prepareSyncPos(b.nextPos); err != nil {
@@ -778,8 +789,13 @@ func (b *BinlogSyncer) parseEvent(s *BinlogStream, data []byte) error {
 			return errors.WithStack(err)
 		}
 	case *XIDEvent:
+		b.commitGtidSet()
 		event.GSet = b.getGtidSet()
 	case *QueryEvent:
+		// Only the BEGIN of a transaction does not complete it.
+		if !event.IsBegin() {
+			b.commitGtidSet()
+		}
 		event.GSet = b.getGtidSet()
 	}
 
@@ -804,11 +820,19 @@ func (b *BinlogSyncer) parseEvent(s *BinlogStream, data []byte) error {
 	return nil
 }
 
+// commitGtidSet marks the open transaction as completed.
+func (b *BinlogSyncer) commitGtidSet() {
+	if b.gset != nil {
+		b.committedGset = b.gset.Clone()
+	}
+}
+
+// getGtidSet returns a copy of the GTID set of the completed transactions.
 func (b *BinlogSyncer) getGtidSet() mysql.GTIDSet {
-	if b.gset == nil {
+	if b.committedGset == nil {
 		return nil
 	}
-	return b.gset.Clone()
+	return b.committedGset.Clone()
 }
 
 // LastConnectionID returns last connectionID.
@@ -0,0 +1,90 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package myreplicator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/corestoreio/log"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestBinlogSyncer_CommittedGTIDSet(t *testing.T) {
+	const sid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	gset, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, sid+":1-5")
+	assert.NoError(t, err)
+
+	b := &BinlogSyncer{
+		cfg:           &BinlogSyncerConfig{Log: log.BlackHole{}},
+		parser:        NewBinlogParser(),
+		ctx:           context.Background(),
+		gset:          gset.Clone(),
+		committedGset: gset.Clone(),
+	}
+	s := newBinlogStreamer(b.cfg.Log)
+
+	var logPos uint32
+	// event builds an event without checksum, parses it and returns the event
+	// sent to the stream.
+	event := func(et EventType, body []byte) EventDecoder {
+		size := uint32(EventHeaderSize + len(body))
+		logPos += size
+		data := make([]byte, 1+EventHeaderSize, 1+size)
+		data[0] = mysql.OK_HEADER
+		data[5] = byte(et)
+		binary.LittleEndian.PutUint32(data[6:], 1)
+		binary.LittleEndian.PutUint32(data[10:], size)
+		binary.LittleEndian.PutUint32(data[14:], logPos)
+		assert.NoError(t, b.parseEvent(s, append(data, body...)))
+		return (<-s.bleChan).Event
+	}
+	query := func(q string) EventDecoder {
+		body := make([]byte, 13)
+		body[8] = byte(len("shop"))
+		body = append(body, "shop"...)
+		body = append(body, 0)
+		return event(QUERY_EVENT, append(body, q...))
+	}
+	gtid := func(gno uint64) {
+		body := []byte{1, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], gno)
+		event(GTID_EVENT, append(body, n[:]...))
+	}
+
+	fde := make([]byte, 2+50+4+1)
+	binary.LittleEndian.PutUint16(fde, 4)
+	copy(fde[2:], "5.5.0-test")
+	fde[56] = byte(EventHeaderSize)
+	// post header lengths of 8 select a table ID size of 6 bytes.
+	event(FORMAT_DESCRIPTION_EVENT, append(fde, bytes.Repeat([]byte{8}, 40)...))
+
+	gtid(6)
+	assert.Exactly(t, sid+":1-5", query("BEGIN").(*QueryEvent).GSet.String(), "BEGIN must not contain the open transaction")
+	assert.Exactly(t, sid+":1-6", event(XID_EVENT, make([]byte, 8)).(*XIDEvent).GSet.String())
+
+	gtid(7)
+	assert.Exactly(t, sid+":1-7", query("ALTER TABLE customer ADD email VARCHAR(255)").(*QueryEvent).GSet.String(), "a DDL statement completes a transaction")
+
+	// the connection gets lost within the transaction
+	gtid(8)
+	query("BEGIN")
+	assert.Exactly(t, sid+":1-8", b.gset.String())
+	assert.Exactly(t, sid+":1-7", b.committedGset.String(), "a reconnect must send the open transaction again")
+}
@@ -1,2 +1,8 @@
 // Package myreplicator handles the MySQL binary replication protocol.
+//
+// Besides streaming from a server, the binary log files on disk, for example
+// the backups written by BinlogSyncer.StartBackup, can be parsed with
+// ParseFiles, printed as SQL or JSON with an EventWriter and applied to
+// another database with a Replayer for a point-in-time recovery. The tool
+// binlogfile_main.go wraps these functions like mysqlbinlog.
 package myreplicator
@@ -1,6 +1,7 @@
 package myreplicator
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -246,10 +247,18 @@ type QueryEvent struct {
 	Schema        []byte
 	Query         []byte
 
-	// in fact QueryEvent dosen't have the GTIDSet information, just for beneficial to use
+	// GSet gets set by the BinlogSyncer and contains the GTIDs of the
+	// completed transactions. For the BEGIN of a transaction it does not
+	// contain the GTID of the transaction.
 	GSet mysql.GTIDSet
 }
 
+// IsBegin reports whether the query starts a transaction. All other queries,
+// like DDL statements, complete a transaction.
+func (e *QueryEvent) IsBegin() bool {
+	return bytes.EqualFold(bytes.TrimSpace(e.Query), []byte("BEGIN"))
+}
+
 func (e *QueryEvent) decode(data []byte) error {
 	pos := 0
 
@@ -0,0 +1,304 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package myreplicator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/storage/null"
+)
+
+// Output formats of the EventWriter.
+const (
+	EventFormatSQL  = "sql"
+	EventFormatJSON = "json"
+)
+
+// EventWriter writes binary log events in a human readable format, like the
+// mysqlbinlog tool. Format EventFormatSQL writes each event as a comment line
+// followed by the statement. Rows events become INSERT, UPDATE and DELETE
+// statements. Format EventFormatJSON writes one JSON object per line.
+type EventWriter struct {
+	// ColumnNames returns the column names of a table in the order of the
+	// table definition. The binary log contains only the position of a
+	// column. Without column names the SQL output contains @1, @2, ... as
+	// placeholders for the column names. Optional.
+	ColumnNames func(schema, table string) []string
+
+	w      io.Writer
+	format string
+	buf    bytes.Buffer
+}
+
+// NewEventWriter creates a new EventWriter for the format EventFormatSQL or
+// EventFormatJSON.
+func NewEventWriter(w io.Writer, format string) (*EventWriter, error) {
+	if format != EventFormatSQL && format != EventFormatJSON {
+		return nil, errors.NotSupported.Newf("[myreplicator] EventWriter format %q not supported", format)
+	}
+	return &EventWriter{w: w, format: format}, nil
+}
+
+// WriteEvent writes the event of the binary log file. It can be used as
+// OnFileEventFunc.
+func (ew *EventWriter) WriteEvent(fileName string, e *BinlogEvent) error {
+	ew.buf.Reset()
+	var err error
+	if ew.format == EventFormatJSON {
+		err = ew.writeJSON(fileName, e)
+	} else {
+		err = ew.writeSQL(fileName, e)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = ew.w.Write(ew.buf.Bytes())
+	return errors.WithStack(err)
+}
+
+func eventStartPos(h *EventHeader) uint32 {
+	if h.LogPos < h.EventSize {
+		return 0
+	}
+	return h.LogPos - h.EventSize
+}
+
+func (ew *EventWriter) columnNames(t *TableMapEvent) []string {
+	var names []string
+	if ew.ColumnNames != nil {
+		names = ew.ColumnNames(string(t.Schema), string(t.Table))
+	}
+	if len(names) == int(t.ColumnCount) {
+		return names
+	}
+	return nil
+}
+
+func (ew *EventWriter) writeSQL(fileName string, e *BinlogEvent) error {
+	h := e.Header
+	fmt.Fprintf(&ew.buf, "# at %d %s %s server_id=%d end_log_pos=%d %s\n", eventStartPos(h), fileName,
+		time.Unix(int64(h.Timestamp), 0).UTC().Format("2006-01-02 15:04:05"), h.ServerID, h.LogPos, h.EventType)
+
+	switch ev := e.Event.(type) {
+	case *QueryEvent:
+		ew.buf.Write(bytes.TrimSpace(ev.Query))
+		ew.buf.WriteString(";\n")
+	case *XIDEvent:
+		fmt.Fprintf(&ew.buf, "COMMIT; # xid=%d\n", ev.XID)
+	case *RowsEvent:
+		return ew.writeRowsSQL(h.EventType, ev)
+	}
+	return nil
+}
+
+func (ew *EventWriter) writeRowsSQL(et EventType, ev *RowsEvent) error {
+	if ev.Table == nil {
+		return nil
+	}
+	names := ew.columnNames(ev.Table)
+	writeName := func(i int) {
+		if names == nil {
+			ew.buf.WriteByte('@')
+			ew.buf.WriteString(strconv.Itoa(i + 1))
+			return
+		}
+		dml.Quoter.WriteIdentifier(&ew.buf, names[i])
+	}
+	writeValue := func(v interface{}) error {
+		return errors.WithStack(writeSQLValue(&ew.buf, v))
+	}
+	table := dml.Quoter.QualifierName(string(ev.Table.Schema), string(ev.Table.Table))
+
+	// writeList writes the columns of the bitmap separated by sep.
+	writeList := func(bitmap []byte, row []interface{}, sep string, nullSafe bool) error {
+		n := 0
+		for i, v := range row {
+			if !isBitSet(bitmap, i) {
+				continue
+			}
+			if n > 0 {
+				ew.buf.WriteString(sep)
+			}
+			n++
+			writeName(i)
+			if nullSafe {
+				ew.buf.WriteString("<=>")
+			} else {
+				ew.buf.WriteByte('=')
+			}
+			if err := writeValue(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch RowsAction(et) {
+	case RowsActionInsert:
+		for _, row := range ev.Rows {
+			ew.buf.WriteString("INSERT INTO ")
+			ew.buf.WriteString(table)
+			ew.buf.WriteString(" SET ")
+			if err := writeList(ev.ColumnBitmap1, row, ", ", false); err != nil {
+				return err
+			}
+			ew.buf.WriteString(";\n")
+		}
+	case RowsActionUpdate:
+		bitmap2 := ev.ColumnBitmap2
+		if bitmap2 == nil {
+			bitmap2 = ev.ColumnBitmap1
+		}
+		for i := 0; i+1 < len(ev.Rows); i += 2 {
+			ew.buf.WriteString("UPDATE ")
+			ew.buf.WriteString(table)
+			ew.buf.WriteString(" SET ")
+			if err := writeList(bitmap2, ev.Rows[i+1], ", ", false); err != nil {
+				return err
+			}
+			ew.buf.WriteString(" WHERE ")
+			if err := writeList(ev.ColumnBitmap1, ev.Rows[i], " AND ", true); err != nil {
+				return err
+			}
+			ew.buf.WriteString(" LIMIT 1;\n")
+		}
+	case RowsActionDelete:
+		for _, row := range ev.Rows {
+			ew.buf.WriteString("DELETE FROM ")
+			ew.buf.WriteString(table)
+			ew.buf.WriteString(" WHERE ")
+			if err := writeList(ev.ColumnBitmap1, row, " AND ", true); err != nil {
+				return err
+			}
+			ew.buf.WriteString(" LIMIT 1;\n")
+		}
+	}
+	return nil
+}
+
+// writeSQLValue writes the value as SQL literal.
+func writeSQLValue(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("NULL")
+		return nil
+	case null.Decimal:
+		if !val.Valid {
+			buf.WriteString("NULL")
+			return nil
+		}
+		buf.WriteString(val.String())
+		return nil
+	case float32:
+		v = float64(val)
+	case uint8:
+		v = uint64(val)
+	case uint16:
+		v = uint64(val)
+	case uint32:
+		v = uint64(val)
+	}
+	s, _, err := dml.Interpolate("?").Unsafe(v).ToSQL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	buf.WriteString(s)
+	return nil
+}
+
+type jsonEvent struct {
+	File      string          `json:"file"`
+	Pos       uint32          `json:"pos"`
+	EndPos    uint32          `json:"end_pos"`
+	Timestamp time.Time       `json:"ts"`
+	ServerID  uint32          `json:"server_id"`
+	Type      string          `json:"type"`
+	Schema    string          `json:"schema,omitempty"`
+	Table     string          `json:"table,omitempty"`
+	Query     string          `json:"query,omitempty"`
+	XID       uint64          `json:"xid,omitempty"`
+	Action    string          `json:"action,omitempty"`
+	Columns   []string        `json:"columns,omitempty"`
+	Rows      [][]interface{} `json:"rows,omitempty"`
+	NextFile  string          `json:"next_file,omitempty"`
+	NextPos   uint64          `json:"next_pos,omitempty"`
+}
+
+func (ew *EventWriter) writeJSON(fileName string, e *BinlogEvent) error {
+	h := e.Header
+	je := jsonEvent{
+		File:      fileName,
+		Pos:       eventStartPos(h),
+		EndPos:    h.LogPos,
+		Timestamp: time.Unix(int64(h.Timestamp), 0).UTC(),
+		ServerID:  h.ServerID,
+		Type:      h.EventType.String(),
+	}
+	switch ev := e.Event.(type) {
+	case *QueryEvent:
+		je.Schema = string(ev.Schema)
+		je.Query = string(ev.Query)
+	case *XIDEvent:
+		je.XID = ev.XID
+	case *RotateEvent:
+		je.NextFile = string(ev.NextLogName)
+		je.NextPos = ev.Position
+	case *TableMapEvent:
+		je.Schema = string(ev.Schema)
+		je.Table = string(ev.Table)
+	case *RowsEvent:
+		if ev.Table != nil {
+			je.Schema = string(ev.Table.Schema)
+			je.Table = string(ev.Table.Table)
+			je.Columns = ew.columnNames(ev.Table)
+		}
+		je.Action = RowsAction(h.EventType)
+		je.Rows = make([][]interface{}, len(ev.Rows))
+		for i, row := range ev.Rows {
+			je.Rows[i] = make([]interface{}, len(row))
+			for j, v := range row {
+				je.Rows[i][j] = jsonValue(v)
+			}
+		}
+	}
+	enc := json.NewEncoder(&ew.buf)
+	enc.SetEscapeHTML(false)
+	return errors.WithStack(enc.Encode(je))
+}
+
+// jsonValue converts byte slices containing valid UTF-8 into strings, all other
+// byte slices get base64 encoded by package encoding/json.
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+	case null.Decimal:
+		if !val.Valid {
+			return nil
+		}
+		return json.Number(val.String())
+	}
+	return v
+}
@@ -0,0 +1,273 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package myreplicator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+)
+
+// ReplayOptions configures a Replayer.
+type ReplayOptions struct {
+	// Tables provides the column definitions of the target tables. Defaults
+	// to loading the definitions from the target database.
+	Tables *ddl.Tables
+	// ReplayQueries executes the query events other than BEGIN, COMMIT and
+	// ROLLBACK, for example DDL statements. The queries run in the default
+	// database of the connection pool.
+	ReplayQueries bool
+}
+
+// Replayer applies the events of a binary log to another database, for
+// example for a point-in-time recovery from the files written by
+// BinlogSyncer.StartBackup. The transactions of the binary log become
+// transactions on the target database. The rows get written into the tables
+// of the default database of the connection pool, the schema of the binary
+// log gets ignored. UPDATE and DELETE statements identify a row by its
+// primary key or, without a primary key, by all columns of the before image.
+type Replayer struct {
+	dbcp   *dml.ConnPool
+	tables *ddl.Tables
+	o      ReplayOptions
+	tx     *dml.Tx
+	// inTx reports whether a BEGIN query event has been applied. The
+	// transaction on the target database starts with the first row, so
+	// filtered transactions do not cause empty ones.
+	inTx bool
+	// RowsApplied counts the written rows.
+	RowsApplied uint64
+}
+
+// NewReplayer creates a new Replayer for the target database. Options can be
+// nil.
+func NewReplayer(dbcp *dml.ConnPool, o *ReplayOptions) (*Replayer, error) {
+	r := &Replayer{dbcp: dbcp}
+	if o != nil {
+		r.o = *o
+	}
+	r.tables = r.o.Tables
+	if r.tables == nil {
+		var err error
+		if r.tables, err = ddl.NewTables(ddl.WithConnPool(dbcp)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return r, nil
+}
+
+// Apply applies one event. Use it within an OnFileEventFunc of ParseFiles.
+func (r *Replayer) Apply(ctx context.Context, e *BinlogEvent) error {
+	switch ev := e.Event.(type) {
+	case *QueryEvent:
+		return errors.WithStack(r.applyQuery(ctx, ev))
+	case *XIDEvent:
+		return errors.WithStack(r.commit())
+	case *RowsEvent:
+		return errors.WithStack(r.applyRows(ctx, RowsAction(e.Header.EventType), ev))
+	}
+	return nil
+}
+
+func (r *Replayer) applyQuery(ctx context.Context, ev *QueryEvent) error {
+	q := strings.TrimSpace(string(ev.Query))
+	switch {
+	case strings.EqualFold(q, "BEGIN"):
+		if err := r.commit(); err != nil {
+			return errors.WithStack(err)
+		}
+		r.inTx = true
+	case strings.EqualFold(q, "ROLLBACK"):
+		return errors.WithStack(r.rollback())
+	case isTxQuery(ev.Query):
+		return errors.WithStack(r.commit())
+	case r.o.ReplayQueries:
+		// DDL statements commit implicitly.
+		if err := r.commit(); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := r.dbcp.DB.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "[myreplicator] Replayer failed to execute query %q", q)
+		}
+		r.tables.DeleteAllFromCache()
+	}
+	return nil
+}
+
+func (r *Replayer) table(ctx context.Context, name string) (*ddl.Table, error) {
+	t, err := r.tables.Table(name)
+	if err == nil {
+		return t, nil
+	}
+	if !errors.NotFound.Match(err) {
+		return nil, errors.WithStack(err)
+	}
+	if err := r.tables.Options(ddl.WithCreateTable(ctx, name, "")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r.tables.Table(name)
+}
+
+func (r *Replayer) exec(ctx context.Context, qb dml.QueryBuilder, args []interface{}) error {
+	if r.inTx && r.tx == nil {
+		tx, err := r.dbcp.BeginTx(ctx, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		r.tx = tx
+	}
+	var dbr *dml.DBR
+	if r.tx != nil {
+		dbr = r.tx.WithQueryBuilder(qb)
+	} else {
+		dbr = r.dbcp.WithQueryBuilder(qb)
+	}
+	if _, err := dbr.ExecContext(ctx, args...); err != nil {
+		return errors.WithStack(err)
+	}
+	r.RowsApplied++
+	return nil
+}
+
+func (r *Replayer) applyRows(ctx context.Context, action string, ev *RowsEvent) error {
+	if ev.Table == nil {
+		return nil
+	}
+	t, err := r.table(ctx, string(ev.Table.Table))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(t.Columns) != int(ev.ColumnCount) {
+		return errors.Mismatch.Newf("[myreplicator] Replayer: Table %q has %d columns but the binary log %d", t.Name, len(t.Columns), ev.ColumnCount)
+	}
+
+	switch action {
+	case RowsActionInsert:
+		for _, row := range ev.Rows {
+			cols, args := replayColumns(t, ev.ColumnBitmap1, row)
+			if err := r.exec(ctx, dml.NewInsert(t.Name).AddColumns(cols...).BuildValues(), args); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case RowsActionUpdate:
+		bitmap2 := ev.ColumnBitmap2
+		if bitmap2 == nil {
+			bitmap2 = ev.ColumnBitmap1
+		}
+		for i := 0; i+1 < len(ev.Rows); i += 2 {
+			cols, args := replayColumns(t, bitmap2, ev.Rows[i+1])
+			wheres, whereArgs := replayWhere(t, ev.ColumnBitmap1, ev.Rows[i])
+			u := dml.NewUpdate(t.Name).AddColumns(cols...).Where(wheres...).Limit(1)
+			if err := r.exec(ctx, u, append(args, whereArgs...)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case RowsActionDelete:
+		for _, row := range ev.Rows {
+			wheres, whereArgs := replayWhere(t, ev.ColumnBitmap1, row)
+			if err := r.exec(ctx, dml.NewDelete(t.Name).Where(wheres...).Limit(1), whereArgs); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// replayColumns returns the columns of the bitmap and their values.
+func replayColumns(t *ddl.Table, bitmap []byte, row []interface{}) ([]string, []interface{}) {
+	cols := make([]string, 0, len(row))
+	args := make([]interface{}, 0, len(row))
+	for i, c := range t.Columns {
+		if isBitSet(bitmap, i) {
+			cols = append(cols, c.Field)
+			args = append(args, replayValue(c, row[i]))
+		}
+	}
+	return cols, args
+}
+
+// replayWhere identifies the row by its primary key. Without a primary key in
+// the image all columns get compared NULL safe.
+func replayWhere(t *ddl.Table, bitmap []byte, row []interface{}) (dml.Conditions, []interface{}) {
+	var cnds dml.Conditions
+	var args []interface{}
+	for i, c := range t.Columns {
+		if c.IsPK() && isBitSet(bitmap, i) {
+			cnds = append(cnds, dml.Column(c.Field).PlaceHolder())
+			args = append(args, replayValue(c, row[i]))
+		}
+	}
+	if len(cnds) > 0 {
+		return cnds, args
+	}
+	for i, c := range t.Columns {
+		if isBitSet(bitmap, i) {
+			cnds = append(cnds, dml.Column(c.Field).SpaceShip().PlaceHolder())
+			args = append(args, replayValue(c, row[i]))
+		}
+	}
+	return cnds, args
+}
+
+// replayValue converts the signed integers, which the binary log contains for
+// unsigned columns, into unsigned integers.
+func replayValue(c *ddl.Column, v interface{}) interface{} {
+	if !c.IsUnsigned() {
+		return v
+	}
+	switch val := v.(type) {
+	case int8:
+		return uint64(uint8(val))
+	case int16:
+		return uint64(uint16(val))
+	case int32:
+		if c.DataType == "mediumint" {
+			return uint64(uint32(val) & 0xffffff)
+		}
+		return uint64(uint32(val))
+	case int64:
+		return uint64(val)
+	}
+	return v
+}
+
+func (r *Replayer) commit() error {
+	r.inTx = false
+	if r.tx == nil {
+		return nil
+	}
+	tx := r.tx
+	r.tx = nil
+	return errors.WithStack(tx.Commit())
+}
+
+func (r *Replayer) rollback() error {
+	r.inTx = false
+	if r.tx == nil {
+		return nil
+	}
+	tx := r.tx
+	r.tx = nil
+	return errors.WithStack(tx.Rollback())
+}
+
+// Close rolls back an incomplete transaction, for example if the binary log
+// ends within a transaction.
+func (r *Replayer) Close() error {
+	return errors.WithStack(r.rollback())
+}
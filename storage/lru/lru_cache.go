@@ -44,6 +44,8 @@ type Cache struct {
 	size      int64
 	capacity  int64
 	evictions int64
+	hits      int64
+	misses    int64
 }
 
 // Value is the interface values that go into Cache need to satisfy
@@ -83,8 +85,10 @@ func (lru *Cache) Get(key string) (v Value, ok bool) {
 
 	element, ok := lru.table[key]
 	if element == nil {
+		lru.misses++
 		return nil, false
 	}
+	lru.hits++
 	lru.moveToFront(element)
 	return element.Value.(*entry).value, true
 }
@@ -179,7 +183,8 @@ func (lru *Cache) StatsJSON() string {
 		return "{}"
 	}
 	l, s, c, e, o := lru.Stats()
-	return fmt.Sprintf("{\"Length\": %v, \"Size\": %v, \"Capacity\": %v, \"Evictions\": %v, \"OldestAccess\": \"%v\"}", l, s, c, e, o)
+	h, m := lru.HitsMisses()
+	return fmt.Sprintf("{\"Length\": %v, \"Size\": %v, \"Capacity\": %v, \"Evictions\": %v, \"Hits\": %v, \"Misses\": %v, \"OldestAccess\": \"%v\"}", l, s, c, e, h, m, o)
 }
 
 // Length returns how many elements are in the cache
@@ -210,6 +215,14 @@ func (lru *Cache) Evictions() int64 {
 	return lru.evictions
 }
 
+// HitsMisses returns how often Get has found or not found a key. Peek does not
+// change the counters.
+func (lru *Cache) HitsMisses() (hits, misses int64) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.hits, lru.misses
+}
+
 // Oldest returns the insertion time of the oldest element in the cache,
 // or a IsZero() time if cache is empty.
 func (lru *Cache) Oldest() (oldest time.Time) {
@@ -179,6 +179,27 @@ func TestPeek(t *testing.T) {
 	}
 }
 
+func TestHitsMisses(t *testing.T) {
+	cache := New(100)
+	cache.Set("key", &CacheValue{1})
+	cache.Get("key")
+	cache.Get("key")
+	cache.Get("notthere")
+	cache.Peek("key")
+	cache.Peek("notthere")
+
+	if h, m := cache.HitsMisses(); h != 2 || m != 1 {
+		t.Errorf("cache.HitsMisses() = %d, %d, expected 2, 1", h, m)
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(cache.StatsJSON()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["Hits"].(float64) != 2 || m["Misses"].(float64) != 1 {
+		t.Errorf("cache.StatsJSON() returned bad hits/misses: %v", m)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	cache := New(100)
 	value := &CacheValue{1}
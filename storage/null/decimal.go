@@ -44,10 +44,11 @@ var bytesZero = []byte(`0`)
 
 // Decimal defines a container type for any MySQL/MariaDB
 // decimal/numeric/float/double data type and their representation in Go. It can
-// store arbitrary large values. Decimal does not perform any kind of
-// calculations. Helpful packages for arbitrary precision calculations are
+// store arbitrary large values. Decimal provides exact arithmetic via Add, Sub,
+// Mul, Div, Neg, Abs, Cmp and Round. NULL values propagate through all
+// calculations. For more complex calculations use packages like
 // github.com/ericlagergren/decimal or gopkg.in/inf.v0 or
-// github.com/shopspring/decimal or a future new Go type.
+// github.com/shopspring/decimal.
 // https://dev.mysql.com/doc/refman/5.7/en/precision-math-decimal-characteristics.html
 // https://dev.mysql.com/doc/refman/5.7/en/floating-point-types.html
 type Decimal struct {
@@ -0,0 +1,287 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package null
+
+import (
+	"math/big"
+
+	"github.com/corestoreio/errors"
+)
+
+// MySQL/MariaDB limits of the DECIMAL(M,D) data type.
+const (
+	DecimalMaxPrecision = 65
+	DecimalMaxScale     = 30
+)
+
+// RoundingMode defines how a Decimal gets rounded when digits after the dot
+// must be removed.
+type RoundingMode uint8
+
+// Supported rounding modes. The zero value is RoundHalfUp, which is the
+// rounding mode of MySQL/MariaDB for DECIMAL columns.
+const (
+	// RoundHalfUp rounds towards the nearest neighbour, if both neighbours are
+	// equidistant it rounds away from zero: 2.5 => 3, -2.5 => -3.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds towards the nearest neighbour, if both neighbours
+	// are equidistant it rounds towards the even neighbour: 2.5 => 2, 3.5 => 4.
+	RoundHalfEven
+	// RoundHalfDown rounds towards the nearest neighbour, if both neighbours
+	// are equidistant it rounds towards zero: 2.5 => 2, -2.5 => -2.
+	RoundHalfDown
+	// RoundDown truncates all digits: 2.9 => 2, -2.9 => -2.
+	RoundDown
+	// RoundUp rounds away from zero: 2.1 => 3, -2.1 => -3.
+	RoundUp
+	// RoundBankers is an alias for RoundHalfEven.
+	RoundBankers = RoundHalfEven
+)
+
+var bigTen = big.NewInt(10)
+
+func pow10Big(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// bigInt returns the signed unscaled value.
+func (d Decimal) bigInt() *big.Int {
+	i := new(big.Int)
+	if d.PrecisionStr != "" {
+		if _, ok := i.SetString(d.PrecisionStr, 10); !ok {
+			i.SetInt64(0)
+		}
+	} else {
+		i.SetUint64(d.Precision)
+	}
+	if d.Negative {
+		i.Neg(i)
+	}
+	return i
+}
+
+// makeDecimalBig creates a valid Decimal from the signed unscaled value i.
+func makeDecimalBig(i *big.Int, scale int32, quote bool) Decimal {
+	d := Decimal{
+		Scale:    scale,
+		Negative: i.Sign() < 0,
+		Valid:    true,
+		Quote:    quote,
+	}
+	abs := new(big.Int).Abs(i)
+	if abs.IsUint64() {
+		d.Precision = abs.Uint64()
+	} else {
+		d.PrecisionStr = abs.String()
+	}
+	return d
+}
+
+// rescale aligns the unscaled value i from scale `from` to scale `to`.
+func rescale(i *big.Int, from, to int32, rm RoundingMode) *big.Int {
+	switch {
+	case to == from:
+		return i
+	case to > from:
+		return new(big.Int).Mul(i, pow10Big(to-from))
+	}
+	return quoRound(i, pow10Big(from-to), rm)
+}
+
+// quoRound divides x by y and rounds the quotient according to the rounding
+// mode. y must not be zero.
+func quoRound(x, y *big.Int, rm RoundingMode) *big.Int {
+	neg := (x.Sign() < 0) != (y.Sign() < 0)
+	ax := new(big.Int).Abs(x)
+	ay := new(big.Int).Abs(y)
+	q, r := new(big.Int).QuoRem(ax, ay, new(big.Int))
+	if r.Sign() != 0 {
+		half := new(big.Int).Lsh(r, 1).Cmp(ay) // compares 2*r with y
+		var inc bool
+		switch rm {
+		case RoundHalfUp:
+			inc = half >= 0
+		case RoundHalfEven:
+			inc = half > 0 || (half == 0 && q.Bit(0) == 1)
+		case RoundHalfDown:
+			inc = half > 0
+		case RoundUp:
+			inc = true
+		}
+		if inc {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return q
+}
+
+func maxScale(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Add returns d + d2 with the larger scale of both. If any of the operands
+// is NULL the result is NULL.
+func (d Decimal) Add(d2 Decimal) Decimal {
+	if !d.Valid || !d2.Valid {
+		return Decimal{}
+	}
+	s := maxScale(d.Scale, d2.Scale)
+	i := rescale(d.bigInt(), d.Scale, s, RoundDown)
+	i.Add(i, rescale(d2.bigInt(), d2.Scale, s, RoundDown))
+	return makeDecimalBig(i, s, d.Quote)
+}
+
+// Sub returns d - d2 with the larger scale of both. If any of the operands
+// is NULL the result is NULL.
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	return d.Add(d2.Neg())
+}
+
+// Mul returns d * d2 with the scale d.Scale + d2.Scale. Use Round to reduce
+// the scale. If any of the operands is NULL the result is NULL.
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	if !d.Valid || !d2.Valid {
+		return Decimal{}
+	}
+	i := d.bigInt()
+	i.Mul(i, d2.bigInt())
+	return makeDecimalBig(i, d.Scale+d2.Scale, d.Quote)
+}
+
+// Div returns d / d2 with the provided scale and rounds the result according
+// to the rounding mode. If any of the operands is NULL the result is NULL. A
+// division by zero returns an error with kind NotValid.
+func (d Decimal) Div(d2 Decimal, scale int32, rm RoundingMode) (Decimal, error) {
+	if !d.Valid || !d2.Valid {
+		return Decimal{}, nil
+	}
+	if scale < 0 {
+		return Decimal{}, errors.NotValid.Newf("[null] Decimal.Div scale %d cannot be negative", scale)
+	}
+	y := d2.bigInt()
+	if y.Sign() == 0 {
+		return Decimal{}, errors.NotValid.Newf("[null] Decimal.Div division by zero: %s / %s", d, d2)
+	}
+	// d/d2 = (x*10^-s1) / (y*10^-s2) = x/y * 10^(s2-s1), scaled by 10^scale
+	x := d.bigInt()
+	if exp := scale - d.Scale + d2.Scale; exp >= 0 {
+		x.Mul(x, pow10Big(exp))
+	} else {
+		y.Mul(y, pow10Big(-exp))
+	}
+	return makeDecimalBig(quoRound(x, y, rm), scale, d.Quote), nil
+}
+
+// Neg returns -d. NULL stays NULL.
+func (d Decimal) Neg() Decimal {
+	if !d.Valid {
+		return d
+	}
+	d.Negative = !d.Negative && !d.IsZero()
+	return d
+}
+
+// Abs returns the absolute value of d. NULL stays NULL.
+func (d Decimal) Abs() Decimal {
+	d.Negative = false
+	return d
+}
+
+// Sign returns -1 if d < 0, 0 if d == 0 or NULL and +1 if d > 0.
+func (d Decimal) Sign() int {
+	switch {
+	case !d.Valid || d.IsZero():
+		return 0
+	case d.Negative:
+		return -1
+	}
+	return 1
+}
+
+// IsZero returns true if the value equals zero, independent of the scale. A
+// NULL value is not zero.
+func (d Decimal) IsZero() bool {
+	return d.Valid && d.Precision == 0 && (d.PrecisionStr == "" || d.bigInt().Sign() == 0)
+}
+
+// Cmp compares d with d2 independent of their scales and returns -1 if
+// d < d2, 0 if d == d2 and +1 if d > d2. A NULL value is always less than a
+// non-NULL value, two NULL values are equal. This behaviour matches the
+// ordering of NULL values in MySQL/MariaDB.
+func (d Decimal) Cmp(d2 Decimal) int {
+	switch {
+	case !d.Valid && !d2.Valid:
+		return 0
+	case !d.Valid:
+		return -1
+	case !d2.Valid:
+		return 1
+	}
+	s := maxScale(d.Scale, d2.Scale)
+	return rescale(d.bigInt(), d.Scale, s, RoundDown).Cmp(rescale(d2.bigInt(), d2.Scale, s, RoundDown))
+}
+
+// Round returns d with the provided scale. Removed digits get rounded
+// according to the rounding mode. A larger scale appends zeros. NULL stays
+// NULL.
+func (d Decimal) Round(scale int32, rm RoundingMode) Decimal {
+	if !d.Valid || scale < 0 {
+		return d
+	}
+	return makeDecimalBig(rescale(d.bigInt(), d.Scale, scale, rm), scale, d.Quote)
+}
+
+// MakeDecimalMax returns the largest value which fits into a DECIMAL(M,D)
+// column, e.g. DECIMAL(5,2) returns 999.99. The smallest value is its negation.
+func MakeDecimalMax(precision, scale int32) (Decimal, error) {
+	if err := validateDecimalPrecisionScale(precision, scale); err != nil {
+		return Decimal{}, errors.WithStack(err)
+	}
+	i := pow10Big(precision)
+	i.Sub(i, big.NewInt(1))
+	return makeDecimalBig(i, scale, false), nil
+}
+
+func validateDecimalPrecisionScale(precision, scale int32) error {
+	if precision < 1 || precision > DecimalMaxPrecision || scale < 0 || scale > DecimalMaxScale || scale > precision {
+		return errors.NotValid.Newf("[null] Invalid DECIMAL(%d,%d): precision must be between 1 and %d and scale between 0 and min(%d,precision)",
+			precision, scale, DecimalMaxPrecision, DecimalMaxScale)
+	}
+	return nil
+}
+
+// Bound converts d to fit into a DECIMAL(M,D) column, where M is the
+// precision and D the scale. The value gets rounded to the scale. If the
+// rounded value has more than M-D digits before the dot, an error with kind
+// OutOfRange gets returned. NULL stays NULL.
+func (d Decimal) Bound(precision, scale int32, rm RoundingMode) (Decimal, error) {
+	if err := validateDecimalPrecisionScale(precision, scale); err != nil {
+		return Decimal{}, errors.WithStack(err)
+	}
+	if !d.Valid {
+		return d, nil
+	}
+	i := rescale(d.bigInt(), d.Scale, scale, rm)
+	if new(big.Int).Abs(i).Cmp(pow10Big(precision)) >= 0 {
+		return Decimal{}, errors.OutOfRange.Newf("[null] Decimal %s does not fit into DECIMAL(%d,%d)", d, precision, scale)
+	}
+	return makeDecimalBig(i, scale, d.Quote), nil
+}
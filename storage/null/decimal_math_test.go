@@ -0,0 +1,150 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package null
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	d := func(s string) Decimal { return MustMakeDecimalBytes([]byte(s)) }
+	null := Decimal{}
+
+	tests := []struct {
+		name string
+		have Decimal
+		want string
+	}{
+		{"Add", d("1.1").Add(d("2.22")), "3.32"},
+		{"Add negative", d("1.1").Add(d("-2.22")), "-1.12"},
+		{"Add NULL", d("1.1").Add(null), "NULL"},
+		{"Add big", d("18446744073709551615").Add(d("1")), "18446744073709551616"},
+		{"Add float error", d("0.1").Add(d("0.2")), "0.3"},
+		{"Sub", d("10").Sub(d("0.01")), "9.99"},
+		{"Sub zero", d("-5.5").Sub(d("-5.5")), "0"},
+		{"Sub NULL", null.Sub(d("1")), "NULL"},
+		{"Mul", d("19.99").Mul(d("3")), "59.97"},
+		{"Mul negative", d("-1.5").Mul(d("-1.5")), "2.25"},
+		{"Mul big", d("99999999999.99999999").Mul(d("99999999999.99999999")), "9999999999999999998000.0000000000000001"},
+		{"Mul NULL", d("2").Mul(null), "NULL"},
+		{"Neg", d("4.2").Neg(), "-4.2"},
+		{"Neg zero", d("0").Neg(), "0"},
+		{"Neg NULL", null.Neg(), "NULL"},
+		{"Abs", d("-4.2").Abs(), "4.2"},
+		{"Round HalfUp", d("2.345").Round(2, RoundHalfUp), "2.35"},
+		{"Round HalfUp negative", d("-2.345").Round(2, RoundHalfUp), "-2.35"},
+		{"Round HalfEven down", d("2.345").Round(2, RoundHalfEven), "2.34"},
+		{"Round HalfEven up", d("2.355").Round(2, RoundBankers), "2.36"},
+		{"Round HalfDown", d("2.345").Round(2, RoundHalfDown), "2.34"},
+		{"Round Down", d("-2.349").Round(2, RoundDown), "-2.34"},
+		{"Round Up", d("2.341").Round(2, RoundUp), "2.35"},
+		{"Round larger scale", d("2.3").Round(3, RoundHalfUp), "2.3"},
+		{"Round NULL", null.Round(2, RoundHalfUp), "NULL"},
+	}
+	for _, test := range tests {
+		assert.Exactly(t, test.want, test.have.String(), test.name)
+	}
+
+	assert.Exactly(t, int32(3), d("2.3").Round(3, RoundHalfUp).Scale)
+	assert.Exactly(t, int32(4), d("19.99").Mul(d("3.00")).Scale)
+}
+
+func TestDecimal_Div(t *testing.T) {
+	d := func(s string) Decimal { return MustMakeDecimalBytes([]byte(s)) }
+
+	tests := []struct {
+		a, b  string
+		scale int32
+		rm    RoundingMode
+		want  string
+	}{
+		{"10", "3", 4, RoundHalfUp, "3.3333"},
+		{"20", "3", 4, RoundHalfUp, "6.6667"},
+		{"20", "3", 4, RoundDown, "6.6666"},
+		{"-20", "3", 4, RoundHalfUp, "-6.6667"},
+		{"1", "8", 2, RoundHalfEven, "0.12"},
+		{"3", "8", 2, RoundHalfEven, "0.38"},
+		{"1", "8", 2, RoundHalfUp, "0.13"},
+		{"100.00", "0.25", 0, RoundHalfUp, "400"},
+		{"0.001", "1000", 6, RoundHalfUp, "0.000001"},
+		{"119.00", "1.19", 2, RoundHalfUp, "100"},
+	}
+	for _, test := range tests {
+		have, err := d(test.a).Div(d(test.b), test.scale, test.rm)
+		assert.NoError(t, err)
+		assert.Exactly(t, test.want, have.String(), "%s / %s", test.a, test.b)
+	}
+
+	have, err := d("1").Div(d("0.00"), 2, RoundHalfUp)
+	assert.False(t, have.Valid)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+	have, err = d("1").Div(Decimal{}, 2, RoundHalfUp)
+	assert.NoError(t, err)
+	assert.False(t, have.Valid)
+}
+
+func TestDecimal_Cmp(t *testing.T) {
+	d := func(s string) Decimal { return MustMakeDecimalBytes([]byte(s)) }
+
+	assert.Exactly(t, 0, d("1.10").Cmp(d("1.1")))
+	assert.Exactly(t, -1, d("1.09").Cmp(d("1.1")))
+	assert.Exactly(t, 1, d("-1").Cmp(d("-1.5")))
+	assert.Exactly(t, 1, d("18446744073709551616").Cmp(d("18446744073709551615")))
+	assert.Exactly(t, -1, Decimal{}.Cmp(d("-1")))
+	assert.Exactly(t, 1, d("-1").Cmp(Decimal{}))
+	assert.Exactly(t, 0, Decimal{}.Cmp(Decimal{}))
+
+	assert.Exactly(t, -1, d("-0.1").Sign())
+	assert.Exactly(t, 0, d("0.00").Sign())
+	assert.Exactly(t, 0, Decimal{}.Sign())
+	assert.True(t, d("0.000").IsZero())
+	assert.False(t, Decimal{}.IsZero())
+}
+
+func TestDecimal_Bound(t *testing.T) {
+	d := func(s string) Decimal { return MustMakeDecimalBytes([]byte(s)) }
+
+	max, err := MakeDecimalMax(5, 2)
+	assert.NoError(t, err)
+	assert.Exactly(t, "999.99", max.String())
+
+	have, err := d("999.994").Bound(5, 2, RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Exactly(t, "999.99", have.String())
+
+	have, err = d("-12.3").Bound(5, 2, RoundHalfUp)
+	assert.NoError(t, err)
+	assert.Exactly(t, "-12.3", have.String())
+	assert.Exactly(t, int32(2), have.Scale)
+
+	_, err = d("999.995").Bound(5, 2, RoundHalfUp)
+	assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+
+	_, err = d("-1000").Bound(5, 2, RoundHalfUp)
+	assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+
+	have, err = Decimal{}.Bound(5, 2, RoundHalfUp)
+	assert.NoError(t, err)
+	assert.False(t, have.Valid)
+
+	_, err = d("1").Bound(66, 2, RoundHalfUp)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	_, err = MakeDecimalMax(2, 3)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
@@ -47,12 +47,15 @@ func NewBigCacheClient(c bigcache.Config) NewStorageFn {
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		return bigCacheWrapper{bc}, nil
+		return bigCacheWrapper{BigCache: bc, idx: newTagIndex(true)}, nil
 	}
 }
 
 type bigCacheWrapper struct {
 	*bigcache.BigCache
+	// idx tracks additionally all keys because the iterator of bigcache v1
+	// returns corrupt keys.
+	idx *tagIndex
 }
 
 func (w bigCacheWrapper) Set(_ context.Context, keys []string, values [][]byte, _ []time.Duration) (err error) {
@@ -62,6 +65,11 @@ func (w bigCacheWrapper) Set(_ context.Context, keys []string, values [][]byte,
 			return errors.Wrapf(err, "[objcache] With key %q", key)
 		}
 	}
+	w.idx.touch(keys)
+	w.idx.prune(w.BigCache.Len(), func(key string) bool {
+		_, err := w.BigCache.Get(key)
+		return err == nil
+	})
 	return nil
 }
 
@@ -81,16 +89,53 @@ func (w bigCacheWrapper) Get(_ context.Context, keys []string) (values [][]byte,
 }
 
 func (w bigCacheWrapper) Delete(_ context.Context, keys []string) (err error) {
+	w.idx.removeKeys(keys)
 	for i := 0; i < len(keys) && err == nil; i++ {
-		err = w.BigCache.Delete(keys[i])
+		if err = w.BigCache.Delete(keys[i]); err == bigcache.ErrEntryNotFound {
+			err = nil
+		}
 	}
 	return
 }
 
 func (w bigCacheWrapper) Truncate(ctx context.Context) (err error) {
+	w.idx.reset()
 	return w.BigCache.Reset()
 }
 
+// SetWithTags writes the keys and assigns the tags in an in-memory index.
+// Evicted keys get pruned from the index once it grows too large.
+func (w bigCacheWrapper) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error {
+	if err := w.Set(ctx, keys, values, expirations); err != nil {
+		return errors.WithStack(err)
+	}
+	w.idx.add(keys, tags)
+	return nil
+}
+
+func (w bigCacheWrapper) DeleteByTag(ctx context.Context, tags []string) error {
+	return errors.WithStack(w.Delete(ctx, w.idx.keysByTags(tags)))
+}
+
+func (w bigCacheWrapper) DeleteByPrefix(ctx context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(w.Delete(ctx, w.idx.keysByPrefix(prefixes)))
+}
+
+// BackendStats returns the number of entries, the allocated bytes as Capacity
+// and the hit and miss counters of bigcache.
+func (w bigCacheWrapper) BackendStats(_ context.Context) (BackendStats, error) {
+	s := w.BigCache.Stats()
+	return BackendStats{
+		Items:    int64(w.BigCache.Len()),
+		Capacity: int64(w.BigCache.Capacity()),
+		Hits:     s.Hits,
+		Misses:   s.Misses,
+	}, nil
+}
+
 func (w bigCacheWrapper) Close() error {
 	return nil
 }
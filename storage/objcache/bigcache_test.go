@@ -91,3 +91,12 @@ func TestWithBigCache_Delete(t *testing.T) {
 	t.Parallel()
 	newTestServiceDelete(t, objcache.NewBigCacheClient(bigcache.Config{}))
 }
+
+func TestNewBigCacheClient_Invalidator(t *testing.T) {
+	testInvalidatorConformance(t, objcache.NewBigCacheClient(bigcache.Config{}))
+}
+
+func TestWithBigCache_BackendStats(t *testing.T) {
+	bs := testBackendStats(t, objcache.NewBigCacheClient(bigcache.Config{}))
+	assert.True(t, bs.Capacity > 0, "Capacity must be greater zero")
+}
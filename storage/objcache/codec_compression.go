@@ -0,0 +1,168 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/weiwolves/pkg/util/gzippool"
+)
+
+// Compression defines the algorithm of the compression codec.
+type Compression uint8
+
+// Supported compression algorithms.
+const (
+	CompressionGzip Compression = iota + 1
+	CompressionZstd
+	CompressionS2
+)
+
+// CompressionOptions configures NewCompressionCodec.
+type CompressionOptions struct {
+	// Algorithm selects the compression. Default CompressionS2.
+	Algorithm Compression
+	// Threshold defines the minimum size in bytes of an encoded value to get
+	// compressed. Smaller values get stored uncompressed. Default 1024. A
+	// negative value compresses all values.
+	Threshold int
+	// Level sets for zstd the zstd compatible level (1-22) and for s2 the
+	// better mode when greater than one. Gzip uses the pooled writers of
+	// package util/gzippool with their default level.
+	Level int
+}
+
+// NewCompressionCodec wraps a Codecer and compresses the encoded values which
+// are larger than the threshold. Each value gets prefixed with a header which
+// describes the algorithm, hence the algorithm can be changed without
+// flushing the cache. Values written without the compression codec can still
+// be decoded. Types which implement one of the marshaler interfaces bypass the
+// wrapped Codecer, their marshaled bytes get compressed.
+func NewCompressionCodec(c Codecer, o CompressionOptions) (Codecer, error) {
+	if c == nil {
+		return nil, errors.Empty.Newf("[objcache] NewCompressionCodec requires a Codecer")
+	}
+	if o.Algorithm == 0 {
+		o.Algorithm = CompressionS2
+	}
+	if o.Threshold == 0 {
+		o.Threshold = 1024
+	}
+
+	cc := &compressionCodec{o: o}
+	switch o.Algorithm {
+	case CompressionGzip, CompressionS2:
+	case CompressionZstd:
+		var opts []zstd.EOption
+		if o.Level > 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.Level)))
+		}
+		var err error
+		if cc.zstdEnc, err = zstd.NewWriter(nil, opts...); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	default:
+		return nil, errors.NotSupported.Newf("[objcache] Compression algorithm %d not supported", o.Algorithm)
+	}
+	return &wrapperCodec{
+		codec:  c,
+		pack:   cc.compress,
+		unpack: cc.decompress,
+	}, nil
+}
+
+type compressionCodec struct {
+	o       CompressionOptions
+	zstdEnc *zstd.Encoder
+	// zstdDec gets created lazily because any codec must be able to decode
+	// all algorithms.
+	zstdDecOnce sync.Once
+	zstdDec     *zstd.Decoder
+	zstdDecErr  error
+}
+
+func (cc *compressionCodec) compress(raw []byte) ([]byte, error) {
+	if len(raw) < cc.o.Threshold {
+		return append([]byte{codecMagic, codecFormatRaw}, raw...), nil
+	}
+	switch cc.o.Algorithm {
+	case CompressionGzip:
+		buf := bytes.NewBuffer(make([]byte, 0, len(raw)/2))
+		buf.Write([]byte{codecMagic, codecFormatGzip})
+		zw := gzippool.GetWriter(buf)
+		_, err := zw.Write(raw)
+		if err2 := zw.Close(); err == nil {
+			err = err2
+		}
+		gzippool.PutWriter(zw)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return cc.zstdEnc.EncodeAll(raw, []byte{codecMagic, codecFormatZstd}), nil
+	default:
+		dst := make([]byte, codecHeaderLength, codecHeaderLength+s2.MaxEncodedLen(len(raw)))
+		dst[0], dst[1] = codecMagic, codecFormatS2
+		if cc.o.Level > 1 {
+			return append(dst, s2.EncodeBetter(dst[codecHeaderLength:cap(dst)], raw)...), nil
+		}
+		return append(dst, s2.Encode(dst[codecHeaderLength:cap(dst)], raw)...), nil
+	}
+}
+
+func (cc *compressionCodec) decompress(data []byte) ([]byte, error) {
+	if !hasCodecHeader(data) {
+		return data, nil // written without compression codec
+	}
+	body := data[codecHeaderLength:]
+	switch data[1] {
+	case codecFormatRaw:
+		return body, nil
+	case codecFormatGzip:
+		zr := gzippool.GetReader(bytes.NewReader(body))
+		defer gzippool.PutReader(zr)
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(zr); err != nil {
+			return nil, errors.CorruptData.New(err, "[objcache] Failed to decompress gzip data")
+		}
+		return buf.Bytes(), nil
+	case codecFormatZstd:
+		cc.zstdDecOnce.Do(func() {
+			cc.zstdDec, cc.zstdDecErr = zstd.NewReader(nil)
+		})
+		if cc.zstdDecErr != nil {
+			return nil, errors.WithStack(cc.zstdDecErr)
+		}
+		raw, err := cc.zstdDec.DecodeAll(body, nil)
+		if err != nil {
+			return nil, errors.CorruptData.New(err, "[objcache] Failed to decompress zstd data")
+		}
+		return raw, nil
+	case codecFormatS2:
+		raw, err := s2.Decode(nil, body)
+		if err != nil {
+			return nil, errors.CorruptData.New(err, "[objcache] Failed to decompress s2 data")
+		}
+		return raw, nil
+	case codecFormatAESGCM:
+		return nil, errors.NotSupported.Newf("[objcache] Data is encrypted, the compression codec must be wrapped by the AES-GCM codec")
+	}
+	return nil, errors.NotSupported.Newf("[objcache] Unknown codec format %#x", data[1])
+}
@@ -0,0 +1,126 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/corestoreio/errors"
+)
+
+// AESGCMKey defines an AES key and its ID. The ID gets stored next to the
+// encrypted data to find the key for decryption.
+type AESGCMKey struct {
+	ID byte
+	// Key should be the AES key, either 16, 24, or 32 bytes to select
+	// AES-128, AES-192, or AES-256.
+	Key []byte
+}
+
+// AESGCMOptions configures NewAESGCMCodec.
+type AESGCMOptions struct {
+	// Keys contains at least one key. The first key encrypts, all keys
+	// decrypt. To rotate a key, prepend the new key and remove the old key
+	// once all cached values, encrypted with the old key, have expired.
+	Keys []AESGCMKey
+	// AllowUnencrypted decodes values which have been written without the
+	// AES-GCM codec. Enable it only while migrating an existing cache.
+	AllowUnencrypted bool
+}
+
+const aesGCMNonceLength = 12
+
+// NewAESGCMCodec wraps a Codecer and encrypts the encoded values with the
+// AES-GCM authenticated encryption. Each value gets prefixed with a header,
+// the key ID and a random nonce. The header and the key ID get authenticated.
+// To compress and encrypt a value, wrap a compression codec:
+//	NewAESGCMCodec(NewCompressionCodec(codec, ...), ...)
+// Types which implement one of the marshaler interfaces bypass the wrapped
+// Codecer, their marshaled bytes get encrypted.
+func NewAESGCMCodec(c Codecer, o AESGCMOptions) (Codecer, error) {
+	if c == nil {
+		return nil, errors.Empty.Newf("[objcache] NewAESGCMCodec requires a Codecer")
+	}
+	if len(o.Keys) == 0 {
+		return nil, errors.Empty.Newf("[objcache] NewAESGCMCodec requires at least one key")
+	}
+	ac := &aesGCMCodec{
+		o:     o,
+		aeads: make(map[byte]cipher.AEAD, len(o.Keys)),
+	}
+	for _, k := range o.Keys {
+		if _, ok := ac.aeads[k.ID]; ok {
+			return nil, errors.AlreadyExists.Newf("[objcache] AES-GCM key ID %d already exists", k.ID)
+		}
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, errors.NotValid.New(err, "[objcache] AES-GCM key ID %d", k.ID)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ac.aeads[k.ID] = aead
+	}
+	ac.encKeyID = o.Keys[0].ID
+	return &wrapperCodec{
+		codec:  c,
+		pack:   ac.encrypt,
+		unpack: ac.decrypt,
+	}, nil
+}
+
+type aesGCMCodec struct {
+	o        AESGCMOptions
+	aeads    map[byte]cipher.AEAD
+	encKeyID byte
+}
+
+// aesGCMPrefixLength contains the header, the key ID and the nonce.
+const aesGCMPrefixLength = codecHeaderLength + 1 + aesGCMNonceLength
+
+func (ac *aesGCMCodec) encrypt(raw []byte) ([]byte, error) {
+	aead := ac.aeads[ac.encKeyID]
+	dst := make([]byte, aesGCMPrefixLength, aesGCMPrefixLength+len(raw)+aead.Overhead())
+	dst[0], dst[1], dst[2] = codecMagic, codecFormatAESGCM, ac.encKeyID
+	nonce := dst[codecHeaderLength+1 : aesGCMPrefixLength]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead.Seal(dst, nonce, raw, dst[:codecHeaderLength+1]), nil
+}
+
+func (ac *aesGCMCodec) decrypt(data []byte) ([]byte, error) {
+	if !hasCodecHeader(data) || data[1] != codecFormatAESGCM {
+		if ac.o.AllowUnencrypted {
+			return data, nil
+		}
+		return nil, errors.NotValid.Newf("[objcache] Data is not encrypted with AES-GCM")
+	}
+	if len(data) < aesGCMPrefixLength {
+		return nil, errors.CorruptData.Newf("[objcache] AES-GCM data too short")
+	}
+	aead, ok := ac.aeads[data[2]]
+	if !ok {
+		return nil, errors.NotValid.Newf("[objcache] AES-GCM key ID %d not available", data[2])
+	}
+	raw, err := aead.Open(nil, data[codecHeaderLength+1:aesGCMPrefixLength], data[aesGCMPrefixLength:], data[:codecHeaderLength+1])
+	if err != nil {
+		return nil, errors.NotValid.New(err, "[objcache] AES-GCM authentication failed with key ID %d", data[2])
+	}
+	return raw, nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+type codecTestItem struct {
+	ID   int
+	HTML string
+}
+
+// codecBinaryItem bypasses the Codecer because it implements the binary
+// marshaler interfaces.
+type codecBinaryItem struct {
+	Email string
+}
+
+func (c codecBinaryItem) MarshalBinary() ([]byte, error) { return []byte(c.Email), nil }
+
+func (c *codecBinaryItem) UnmarshalBinary(data []byte) error {
+	c.Email = string(data)
+	return nil
+}
+
+// newCodecService returns a Service without level1 and the raw level2
+// storage, to inspect the written bytes.
+func newCodecService(t *testing.T, c objcache.Codecer) (*objcache.Service, objcache.Storager) {
+	level2 := sharedStorage(t, objcache.NewCacheSimpleInmemory)
+	p, err := objcache.NewService(nil, level2, newSrvOpt(c))
+	assert.NoError(t, err)
+	st, _ := level2()
+	return p, st
+}
+
+func rawValue(t *testing.T, st objcache.Storager, key string) []byte {
+	vals, err := st.Get(context.Background(), []string{key})
+	assert.NoError(t, err)
+	return vals[0]
+}
+
+func TestNewCompressionCodec(t *testing.T) {
+	ctx := context.Background()
+	large := codecTestItem{ID: 1, HTML: strings.Repeat("<div class=\"product\">Gopher</div>", 200)}
+	small := codecTestItem{ID: 2, HTML: "<p>Gopher</p>"}
+
+	runner := func(algo objcache.Compression, level int) func(*testing.T) {
+		return func(t *testing.T) {
+			c, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: algo, Level: level})
+			assert.NoError(t, err)
+			p, st := newCodecService(t, c)
+
+			assert.NoError(t, p.Set(ctx, "large", large, 0))
+			assert.NoError(t, p.Set(ctx, "small", small, 0))
+			assert.True(t, len(rawValue(t, st, "large")) < len(large.HTML)/10, "large value must be compressed")
+			assert.Exactly(t, []byte{0xc5, 0x01}, rawValue(t, st, "small")[:2])
+
+			var haveLarge, haveSmall codecTestItem
+			assert.NoError(t, p.Get(ctx, "large", &haveLarge))
+			assert.NoError(t, p.Get(ctx, "small", &haveSmall))
+			assert.Exactly(t, large, haveLarge)
+			assert.Exactly(t, small, haveSmall)
+		}
+	}
+	t.Run("gzip", runner(objcache.CompressionGzip, 0))
+	t.Run("zstd", runner(objcache.CompressionZstd, 0))
+	t.Run("zstd level 19", runner(objcache.CompressionZstd, 19))
+	t.Run("s2", runner(objcache.CompressionS2, 0))
+	t.Run("s2 better", runner(objcache.CompressionS2, 2))
+
+	t.Run("decodes other algorithms and legacy data", func(t *testing.T) {
+		gz, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: objcache.CompressionGzip})
+		assert.NoError(t, err)
+		zs, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: objcache.CompressionZstd})
+		assert.NoError(t, err)
+
+		pPlain, st := newCodecService(t, JSONCodec{})
+		pGzip, err := objcache.NewService(nil, func() (objcache.Storager, error) { return st, nil }, newSrvOpt(gz))
+		assert.NoError(t, err)
+		pZstd, err := objcache.NewService(nil, func() (objcache.Storager, error) { return st, nil }, newSrvOpt(zs))
+		assert.NoError(t, err)
+
+		assert.NoError(t, pPlain.Set(ctx, "legacy", large, 0))
+		assert.NoError(t, pGzip.Set(ctx, "gzip", large, 0))
+
+		var have codecTestItem
+		assert.NoError(t, pZstd.Get(ctx, "legacy", &have))
+		assert.Exactly(t, large, have)
+		have = codecTestItem{}
+		assert.NoError(t, pZstd.Get(ctx, "gzip", &have))
+		assert.Exactly(t, large, have)
+
+		have = codecTestItem{}
+		assert.NoError(t, pZstd.Get(ctx, "not_found", &have))
+		assert.Exactly(t, codecTestItem{}, have)
+	})
+
+	t.Run("corrupt data", func(t *testing.T) {
+		c, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{})
+		assert.NoError(t, err)
+		p, st := newCodecService(t, c)
+		assert.NoError(t, st.Set(ctx, []string{"k1", "k2"}, [][]byte{{0xc5, 0x04, 0xff, 0xff}, {0xc5, 0x7f, 0x01}}, nil))
+		var have codecTestItem
+		err = p.Get(ctx, "k1", &have)
+		assert.True(t, errors.CorruptData.Match(err), "%+v", err)
+		err = p.Get(ctx, "k2", &have)
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: 99})
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+		_, err = objcache.NewCompressionCodec(nil, objcache.CompressionOptions{})
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+}
+
+func TestNewAESGCMCodec(t *testing.T) {
+	ctx := context.Background()
+	key1 := objcache.AESGCMKey{ID: 1, Key: bytes.Repeat([]byte{'a'}, 32)}
+	key2 := objcache.AESGCMKey{ID: 2, Key: bytes.Repeat([]byte{'b'}, 16)}
+	pii := codecTestItem{ID: 3, HTML: "customer@example.com"}
+
+	t.Run("encrypts and authenticates", func(t *testing.T) {
+		c, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+		assert.NoError(t, err)
+		p, st := newCodecService(t, c)
+
+		assert.NoError(t, p.Set(ctx, "pii", pii, 0))
+		raw := rawValue(t, st, "pii")
+		assert.Exactly(t, []byte{0xc5, 0x10, 0x01}, raw[:3])
+		assert.False(t, bytes.Contains(raw, []byte("customer")), "value must be encrypted")
+
+		var have codecTestItem
+		assert.NoError(t, p.Get(ctx, "pii", &have))
+		assert.Exactly(t, pii, have)
+
+		// the same value gets encrypted with a different nonce
+		assert.NoError(t, p.Set(ctx, "pii2", pii, 0))
+		assert.False(t, bytes.Equal(raw, rawValue(t, st, "pii2")))
+
+		tampered := append([]byte{}, raw...)
+		tampered[len(tampered)-1] ^= 0xff
+		assert.NoError(t, st.Set(ctx, []string{"tampered"}, [][]byte{tampered}, nil))
+		err = p.Get(ctx, "tampered", &have)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		cOld, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+		assert.NoError(t, err)
+		cNew, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key2, key1}})
+		assert.NoError(t, err)
+		cNewOnly, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key2}})
+		assert.NoError(t, err)
+
+		pOld, st := newCodecService(t, cOld)
+		shared := func() (objcache.Storager, error) { return st, nil }
+		pNew, err := objcache.NewService(nil, shared, newSrvOpt(cNew))
+		assert.NoError(t, err)
+		pNewOnly, err := objcache.NewService(nil, shared, newSrvOpt(cNewOnly))
+		assert.NoError(t, err)
+
+		assert.NoError(t, pOld.Set(ctx, "old", pii, 0))
+		assert.NoError(t, pNew.Set(ctx, "new", pii, 0))
+		assert.Exactly(t, byte(2), rawValue(t, st, "new")[2])
+
+		var have codecTestItem
+		assert.NoError(t, pNew.Get(ctx, "old", &have))
+		assert.Exactly(t, pii, have)
+		assert.NoError(t, pNewOnly.Get(ctx, "new", &have))
+
+		err = pNewOnly.Get(ctx, "old", &have)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+
+	t.Run("unencrypted data", func(t *testing.T) {
+		pPlain, st := newCodecService(t, JSONCodec{})
+		assert.NoError(t, pPlain.Set(ctx, "plain", pii, 0))
+		shared := func() (objcache.Storager, error) { return st, nil }
+
+		strict, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+		assert.NoError(t, err)
+		pStrict, err := objcache.NewService(nil, shared, newSrvOpt(strict))
+		assert.NoError(t, err)
+		var have codecTestItem
+		err = pStrict.Get(ctx, "plain", &have)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+		lax, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}, AllowUnencrypted: true})
+		assert.NoError(t, err)
+		pLax, err := objcache.NewService(nil, shared, newSrvOpt(lax))
+		assert.NoError(t, err)
+		assert.NoError(t, pLax.Get(ctx, "plain", &have))
+		assert.Exactly(t, pii, have)
+	})
+
+	t.Run("compressed and encrypted", func(t *testing.T) {
+		cc, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: objcache.CompressionZstd, Threshold: -1})
+		assert.NoError(t, err)
+		c, err := objcache.NewAESGCMCodec(cc, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+		assert.NoError(t, err)
+		p, _ := newCodecService(t, c)
+
+		large := codecTestItem{ID: 4, HTML: strings.Repeat("customer@example.com ", 100)}
+		assert.NoError(t, p.Set(ctx, "large", large, 0))
+		var have codecTestItem
+		assert.NoError(t, p.Get(ctx, "large", &have))
+		assert.Exactly(t, large, have)
+	})
+
+	t.Run("marshaler types get encrypted", func(t *testing.T) {
+		cc, err := objcache.NewCompressionCodec(JSONCodec{}, objcache.CompressionOptions{Algorithm: objcache.CompressionS2, Threshold: -1})
+		assert.NoError(t, err)
+		for _, c := range []objcache.Codecer{JSONCodec{}, cc} {
+			c, err := objcache.NewAESGCMCodec(c, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+			assert.NoError(t, err)
+			p, st := newCodecService(t, c)
+
+			item := codecBinaryItem{Email: "customer@example.com"}
+			assert.NoError(t, p.Set(ctx, "binary", item, 0))
+			raw := rawValue(t, st, "binary")
+			assert.Exactly(t, []byte{0xc5, 0x10, 0x01}, raw[:3])
+			assert.False(t, bytes.Contains(raw, []byte("customer")), "value must be encrypted")
+
+			var have codecBinaryItem
+			assert.NoError(t, p.Get(ctx, "binary", &have))
+			assert.Exactly(t, item, have)
+		}
+	})
+
+	t.Run("with PrimeObjects", func(t *testing.T) {
+		gob.Register(codecTestItem{})
+		c, err := objcache.NewAESGCMCodec(gobCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1}})
+		assert.NoError(t, err)
+		level2 := sharedStorage(t, objcache.NewCacheSimpleInmemory)
+		so := newSrvOpt(c, codecTestItem{})
+		p, err := objcache.NewService(nil, level2, so)
+		assert.NoError(t, err)
+		assert.Exactly(t, c, so.Codec, "the options of the caller must not change")
+		st, _ := level2()
+
+		assert.NoError(t, p.Set(ctx, "pii", pii, 0))
+		item := codecBinaryItem{Email: "customer@example.com"}
+		assert.NoError(t, p.Set(ctx, "binary", item, 0))
+		for _, key := range []string{"pii", "binary"} {
+			raw := rawValue(t, st, key)
+			assert.Exactly(t, []byte{0xc5, 0x10, 0x01}, raw[:3], "Key %q", key)
+			assert.False(t, bytes.Contains(raw, []byte("customer")), "value of key %q must be encrypted", key)
+		}
+
+		var have codecTestItem
+		assert.NoError(t, p.Get(ctx, "pii", &have))
+		assert.Exactly(t, pii, have)
+		var haveItem codecBinaryItem
+		assert.NoError(t, p.Get(ctx, "binary", &haveItem))
+		assert.Exactly(t, item, haveItem)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{})
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+		_, err = objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{{ID: 1, Key: []byte("short")}}})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		_, err = objcache.NewAESGCMCodec(JSONCodec{}, objcache.AESGCMOptions{Keys: []objcache.AESGCMKey{key1, key1}})
+		assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+	})
+}
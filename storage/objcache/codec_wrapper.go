@@ -0,0 +1,155 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/corestoreio/errors"
+)
+
+// The compression and encryption codecs prepend a two byte header to their
+// output: codecMagic followed by the format. Neither gob nor JSON output can
+// start with codecMagic, hence data written without a wrapper codec gets
+// detected and passed unchanged to the wrapped codec.
+const codecMagic byte = 0xC5
+
+const (
+	codecFormatRaw byte = iota + 1 // below the compression threshold
+	codecFormatGzip
+	codecFormatZstd
+	codecFormatS2
+	codecFormatAESGCM byte = 0x10
+)
+
+const codecHeaderLength = 2
+
+func hasCodecHeader(data []byte) bool {
+	return len(data) >= codecHeaderLength && data[0] == codecMagic
+}
+
+// wrapperCodec encodes a value with the wrapped Codecer and transforms the
+// resulting bytes. The decoder reverts the transformation.
+type wrapperCodec struct {
+	codec Codecer
+	// pack transforms the encoded bytes and prepends the header.
+	pack func(raw []byte) ([]byte, error)
+	// unpack reverts pack. It receives the whole data including an optional
+	// header.
+	unpack func(data []byte) ([]byte, error)
+}
+
+func (wc *wrapperCodec) NewEncoder(w io.Writer) Encoder {
+	return wrapperEncoder{wc: wc, w: w}
+}
+
+func (wc *wrapperCodec) NewDecoder(r io.Reader) Decoder {
+	return wrapperDecoder{wc: wc, r: r}
+}
+
+// newPrimedCodec replaces the innermost codec of a wrapper codec chain with a
+// pooled codec, primed with the types. The wrapper codecs stay on top, so that
+// packBytes and unpackBytes still find them. The chain gets copied because the
+// passed codec might be shared between services.
+func newPrimedCodec(c Codecer, types ...interface{}) Codecer {
+	wc, ok := c.(*wrapperCodec)
+	if !ok {
+		return newPooledCodec(c, types...)
+	}
+	return &wrapperCodec{
+		codec:  newPrimedCodec(wc.codec, types...),
+		pack:   wc.pack,
+		unpack: wc.unpack,
+	}
+}
+
+// packBytes applies the transformations of all wrapper codecs in the chain to
+// the raw bytes, starting with the innermost wrapper, like the encoders do.
+// Used for types which implement one of the marshaler interfaces and hence
+// bypass the encoders.
+func packBytes(c Codecer, raw []byte) ([]byte, error) {
+	wc, ok := c.(*wrapperCodec)
+	if !ok {
+		return raw, nil
+	}
+	raw, err := packBytes(wc.codec, raw)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return wc.pack(raw)
+}
+
+// unpackBytes reverts packBytes. Empty data, a cache miss, gets returned
+// unchanged.
+func unpackBytes(c Codecer, data []byte) ([]byte, error) {
+	wc, ok := c.(*wrapperCodec)
+	if !ok || len(data) == 0 {
+		return data, nil
+	}
+	raw, err := wc.unpack(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return unpackBytes(wc.codec, raw)
+}
+
+type wrapperEncoder struct {
+	wc *wrapperCodec
+	w  io.Writer
+}
+
+func (we wrapperEncoder) Encode(src interface{}) error {
+	var buf bytes.Buffer
+	enc := we.wc.codec.NewEncoder(&buf)
+	err := enc.Encode(src)
+	if pc, ok := we.wc.codec.(*pooledCodec); ok {
+		pc.PutEncoder(enc)
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	data, err := we.wc.pack(buf.Bytes())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = we.w.Write(data)
+	return err
+}
+
+type wrapperDecoder struct {
+	wc *wrapperCodec
+	r  io.Reader
+}
+
+func (wd wrapperDecoder) Decode(dst interface{}) error {
+	data, err := ioutil.ReadAll(wd.r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	raw := data
+	if len(data) > 0 { // a cache miss has no data
+		if raw, err = wd.wc.unpack(data); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	dec := wd.wc.codec.NewDecoder(bytes.NewReader(raw))
+	err = dec.Decode(dst)
+	if pc, ok := wd.wc.codec.(*pooledCodec); ok {
+		pc.PutDecoder(dec)
+	}
+	return err
+}
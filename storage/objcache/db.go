@@ -17,9 +17,418 @@
 package objcache
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/sql/ddl"
 	"github.com/weiwolves/pkg/sql/dml"
 )
 
+// TableNameDBCache defines the default table name for the database cache.
+const TableNameDBCache = "objcache"
+
+// dbTagTableSuffix gets appended to the cache table name to form the name of
+// the table which assigns the tags to the keys.
+const dbTagTableSuffix = "_tag"
+
+const dbCreateTable = "CREATE TABLE IF NOT EXISTS `%s` (\n" +
+	"  `id` VARBINARY(255) NOT NULL,\n" +
+	"  `value` LONGBLOB NULL,\n" +
+	"  `expires_at` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT 'Unix timestamp, 0 never expires',\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `IDX_EXPIRES_AT` (`expires_at`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='objcache'"
+
+const dbCreateTagTable = "CREATE TABLE IF NOT EXISTS `%s` (\n" +
+	"  `id` VARBINARY(255) NOT NULL,\n" +
+	"  `tag` VARBINARY(255) NOT NULL,\n" +
+	"  PRIMARY KEY (`tag`,`id`),\n" +
+	"  KEY `IDX_ID` (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='objcache tags'"
+
+// WithDBCreateTable creates the cache table and its tag table, named
+// tableName+"_tag", if they do not yet exist. An empty tableName falls back to
+// TableNameDBCache.
+//		tbls, err := ddl.NewTables(ddl.WithConnPool(dbc), objcache.WithDBCreateTable(ctx, ""))
+func WithDBCreateTable(ctx context.Context, tableName string) ddl.TableOption {
+	if tableName == "" {
+		tableName = TableNameDBCache
+	}
+	tagTable := tableName + dbTagTableSuffix
+	return ddl.WithCreateTable(ctx,
+		tableName, fmt.Sprintf(dbCreateTable, tableName),
+		tagTable, fmt.Sprintf(dbCreateTagTable, tagTable),
+	)
+}
+
+// DBOptions applies several options to the database cache client.
+type DBOptions struct {
+	// TableName if set, specifies the alternate table name, default:
+	// `objcache` aka constant TableNameDBCache.
+	TableName string
+	Log       log.Logger
+	// BatchSize defines the maximum number of keys per query. Default 500.
+	BatchSize int
+	// PurgeInterval enables the background purging of expired rows, if
+	// greater than zero. Expired rows get always lazily removed while reading
+	// them.
+	PurgeInterval time.Duration
+	// ContextTimeoutPurge default 30s.
+	ContextTimeoutPurge time.Duration
+}
+
+// NewDBClient creates a new database backed cache with the default options. The
+// tables must exist, see function WithDBCreateTable. Argument db can be a
+// *sql.DB, *dml.ConnPool, *dml.Conn or *dml.Tx.
 func NewDBClient(db dml.QueryExecPreparer) NewStorageFn {
-	panic("TODO")
+	return NewDBClientWithOptions(db, nil)
+}
+
+// NewDBClientWithOptions same as NewDBClient but applies the options. Argument
+// o can be nil.
+func NewDBClientWithOptions(db dml.QueryExecPreparer, o *DBOptions) NewStorageFn {
+	return func() (Storager, error) {
+		if o == nil {
+			o = new(DBOptions)
+		}
+		dc := &dbCache{
+			db:        db,
+			tableName: o.TableName,
+			log:       o.Log,
+			batchSize: o.BatchSize,
+			purgeStop: make(chan struct{}),
+			purgeDone: make(chan struct{}),
+		}
+		if dc.tableName == "" {
+			dc.tableName = TableNameDBCache
+		}
+		dc.tagTableName = dc.tableName + dbTagTableSuffix
+		if err := dml.IsValidIdentifier(dc.tagTableName); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if dc.batchSize < 1 {
+			dc.batchSize = 500 // just a guess
+		}
+		if o.PurgeInterval > 0 {
+			to := o.ContextTimeoutPurge
+			if to == 0 {
+				to = time.Second * 30 // just a guess
+			}
+			go dc.purgeDaemon(o.PurgeInterval, to)
+		} else {
+			close(dc.purgeDone)
+		}
+		return dc, nil
+	}
+}
+
+type dbCache struct {
+	db           dml.QueryExecPreparer
+	tableName    string
+	tagTableName string
+	log          log.Logger
+	batchSize    int
+
+	closeOnce sync.Once
+	purgeStop chan struct{}
+	purgeDone chan struct{}
+}
+
+func (dc *dbCache) purgeDaemon(interval, timeout time.Duration) {
+	defer close(dc.purgeDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dc.purgeStop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if _, err := dc.Purge(ctx); err != nil && dc.log != nil && dc.log.IsInfo() {
+				dc.log.Info("objcache.dbCache.purgeDaemon.Purge.Error", log.Err(err), log.String("table", dc.tableName))
+			}
+			cancel()
+		}
+	}
+}
+
+func (dc *dbCache) batches(n int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += dc.batchSize {
+		end := start + dc.batchSize
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Set writes all keys with a multi row INSERT ... ON DUPLICATE KEY UPDATE
+// statement.
+func (dc *dbCache) Set(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration) error {
+	hasExp := len(expirations) > 0
+	n := now()
+	return dc.batches(len(keys), func(start, end int) error {
+		args := make([]interface{}, 0, (end-start)*3)
+		for i := start; i < end; i++ {
+			var e int64
+			if hasExp && expirations[i] > 0 {
+				e = n.Add(expirations[i]).Unix()
+			}
+			args = append(args, keys[i], values[i], e)
+		}
+		ins := dml.NewInsert(dc.tableName).AddColumns("id", "value", "expires_at").SetRowCount(end - start)
+		ins.OnDuplicateKeys = dml.Conditions{dml.Column("value"), dml.Column("expires_at")}
+		ins.Log = dc.log
+		if _, err := ins.WithDB(dc.db).WithDBR().ExecContext(ctx, args...); err != nil {
+			return errors.Wrapf(err, "[objcache] dbCache.Set with keys %v", keys[start:end])
+		}
+		return nil
+	})
+}
+
+// Get loads all keys with an IN query. Expired rows get deleted, as long as
+// they are still expired.
+func (dc *dbCache) Get(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	idx := make(map[string][]int, len(keys))
+	for i, k := range keys {
+		idx[k] = append(idx[k], i)
+	}
+
+	n := now().Unix()
+	var expired []string
+	err := dc.batches(len(keys), func(start, end int) error {
+		sel := dml.NewSelect("id", "value", "expires_at").From(dc.tableName).Where(
+			dml.Column("id").In().PlaceHolder(),
+		)
+		sel.Log = dc.log
+		return sel.WithDB(dc.db).WithDBR().ExpandPlaceHolders().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+			var id string
+			var value []byte
+			var expiresAt int64
+			for cm.Next() {
+				switch c := cm.Column(); c {
+				case "id":
+					cm.String(&id)
+				case "value":
+					cm.Byte(&value)
+				case "expires_at":
+					cm.Int64(&expiresAt)
+				}
+			}
+			if err := cm.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			if expiresAt > 0 && expiresAt <= n {
+				expired = append(expired, id)
+				return nil
+			}
+			if value == nil {
+				value = []byte{}
+			}
+			for _, i := range idx[id] {
+				values[i] = value
+			}
+			return nil
+		}, keys[start:end])
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "[objcache] dbCache.Get with keys %v", keys)
+	}
+	if len(expired) > 0 {
+		if err := dc.deleteExpired(ctx, expired, n); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return values, nil
+}
+
+// deleteExpired removes the keys only if they are still expired at time n. A
+// concurrent Set between reading and deleting a row must not get lost.
+func (dc *dbCache) deleteExpired(ctx context.Context, keys []string, n int64) error {
+	return dc.batches(len(keys), func(start, end int) error {
+		del := dml.NewDelete(dc.tableName).Where(
+			dml.Column("id").In().PlaceHolder(),
+			dml.Column("expires_at").Greater().Int64(0),
+			dml.Column("expires_at").LessOrEqual().PlaceHolder(),
+		)
+		del.Log = dc.log
+		if _, err := del.WithDB(dc.db).WithDBR().ExpandPlaceHolders().ExecContext(ctx, keys[start:end], n); err != nil {
+			return errors.Wrapf(err, "[objcache] dbCache.deleteExpired with keys %v", keys[start:end])
+		}
+		return nil
+	})
+}
+
+// Delete removes all keys and their tags with an IN query.
+func (dc *dbCache) Delete(ctx context.Context, keys []string) error {
+	return dc.batches(len(keys), func(start, end int) error {
+		for _, tn := range [...]string{dc.tableName, dc.tagTableName} {
+			del := dml.NewDelete(tn).Where(dml.Column("id").In().PlaceHolder())
+			del.Log = dc.log
+			if _, err := del.WithDB(dc.db).WithDBR().ExpandPlaceHolders().ExecContext(ctx, keys[start:end]); err != nil {
+				return errors.Wrapf(err, "[objcache] dbCache.Delete on table %q with keys %v", tn, keys[start:end])
+			}
+		}
+		return nil
+	})
+}
+
+// SetWithTags writes the keys like Set and inserts the tags into the tag
+// table. Existing tags of a key stay.
+func (dc *dbCache) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error {
+	if err := dc.Set(ctx, keys, values, expirations); err != nil {
+		return errors.WithStack(err)
+	}
+	var args []interface{}
+	for i, key := range keys {
+		if i >= len(tags) {
+			break
+		}
+		for _, tag := range tags[i] {
+			args = append(args, key, tag)
+		}
+	}
+	return dc.batches(len(args)/2, func(start, end int) error {
+		ins := dml.NewInsert(dc.tagTableName).Ignore().AddColumns("id", "tag").SetRowCount(end - start)
+		ins.Log = dc.log
+		if _, err := ins.WithDB(dc.db).WithDBR().ExecContext(ctx, args[start*2:end*2]...); err != nil {
+			return errors.Wrapf(err, "[objcache] dbCache.SetWithTags with keys %v", keys)
+		}
+		return nil
+	})
+}
+
+// DeleteByTag loads the keys of the tags from the tag table and removes them.
+func (dc *dbCache) DeleteByTag(ctx context.Context, tags []string) error {
+	var keys []string
+	err := dc.batches(len(tags), func(start, end int) error {
+		sel := dml.NewSelect("id").Distinct().From(dc.tagTableName).Where(
+			dml.Column("tag").In().PlaceHolder(),
+		)
+		sel.Log = dc.log
+		return sel.WithDB(dc.db).WithDBR().ExpandPlaceHolders().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+			var id string
+			for cm.Next() {
+				cm.String(&id)
+			}
+			if err := cm.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			keys = append(keys, id)
+			return nil
+		}, tags[start:end])
+	})
+	if err != nil {
+		return errors.Wrapf(err, "[objcache] dbCache.DeleteByTag with tags %v", tags)
+	}
+	return dc.Delete(ctx, keys)
+}
+
+var dbLikeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// DeleteByPrefix removes all keys and their tags with a `LIKE 'prefix%'`
+// query.
+func (dc *dbCache) DeleteByPrefix(ctx context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return errors.WithStack(err)
+	}
+	conds := make(dml.Conditions, len(prefixes))
+	args := make([]interface{}, len(prefixes))
+	for i, p := range prefixes {
+		conds[i] = dml.Column("id").Like().PlaceHolder()
+		if i > 0 {
+			conds[i].Or()
+		}
+		args[i] = dbLikeEscaper.Replace(p) + "%"
+	}
+	for _, tn := range [...]string{dc.tableName, dc.tagTableName} {
+		del := dml.NewDelete(tn).Where(conds...)
+		del.Log = dc.log
+		if _, err := del.WithDB(dc.db).WithDBR().ExecContext(ctx, args...); err != nil {
+			return errors.Wrapf(err, "[objcache] dbCache.DeleteByPrefix on table %q with prefixes %v", tn, prefixes)
+		}
+	}
+	return nil
+}
+
+// Purge removes all expired rows and the tags of no longer existing keys. It
+// returns the number of removed cache rows.
+func (dc *dbCache) Purge(ctx context.Context) (int64, error) {
+	del := dml.NewDelete(dc.tableName).Where(
+		dml.Column("expires_at").Greater().Int64(0),
+		dml.Column("expires_at").LessOrEqual().PlaceHolder(),
+	)
+	del.Log = dc.log
+	res, err := del.WithDB(dc.db).WithDBR().ExecContext(ctx, now().Unix())
+	if err != nil {
+		return 0, errors.Wrapf(err, "[objcache] dbCache.Purge on table %q", dc.tableName)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	delTags := dml.NewDelete(dc.tagTableName).Where(
+		dml.Column("id").NotIn().Sub(dml.NewSelect("id").From(dc.tableName)),
+	)
+	delTags.Log = dc.log
+	if _, err := delTags.WithDB(dc.db).WithDBR().ExecContext(ctx); err != nil {
+		return ra, errors.Wrapf(err, "[objcache] dbCache.Purge on table %q", dc.tagTableName)
+	}
+	return ra, nil
+}
+
+// BackendStats counts the not expired rows and the total length of their
+// values.
+func (dc *dbCache) BackendStats(ctx context.Context) (bs BackendStats, _ error) {
+	sel := dml.NewSelect().AddColumnsConditions(
+		dml.Expr("COUNT(*)").Alias("items"),
+		dml.Expr("COALESCE(SUM(LENGTH(`value`)),0)").Alias("size"),
+	).From(dc.tableName).Where(
+		dml.Column("expires_at").Int64(0),
+		dml.Column("expires_at").Greater().PlaceHolder().Or(),
+	)
+	sel.Log = dc.log
+	err := sel.WithDB(dc.db).WithDBR().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		for cm.Next() {
+			switch c := cm.Column(); c {
+			case "items":
+				cm.Int64(&bs.Items)
+			case "size":
+				cm.Int64(&bs.Size)
+			}
+		}
+		return cm.Err()
+	}, now().Unix())
+	if err != nil {
+		return bs, errors.Wrapf(err, "[objcache] dbCache.BackendStats on table %q", dc.tableName)
+	}
+	return bs, nil
+}
+
+// Truncate removes all rows from the cache table and the tag table.
+func (dc *dbCache) Truncate(ctx context.Context) error {
+	for _, tn := range [...]string{dc.tableName, dc.tagTableName} {
+		if _, err := dc.db.ExecContext(ctx, "TRUNCATE TABLE "+dml.Quoter.Name(tn)); err != nil {
+			return errors.Wrapf(err, "[objcache] dbCache.Truncate table %q", tn)
+		}
+	}
+	return nil
+}
+
+// Close stops the background purging. It does not close the database
+// connection.
+func (dc *dbCache) Close() error {
+	dc.closeOnce.Do(func() { close(dc.purgeStop) })
+	<-dc.purgeDone
+	return nil
 }
@@ -0,0 +1,295 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build db csall
+
+package objcache_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestNewDBClient_Mock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `objcache` (`id`,`value`,`expires_at`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`), `expires_at`=VALUES(`expires_at`)")).
+			WithArgs("k1", []byte("v1"), sqlmock.AnyArg(), "k2", []byte("v2"), int64(0)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `value`, `expires_at` FROM `objcache` WHERE (`id` IN (?,?,?))")).
+			WithArgs("k1", "k3", "k2").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "value", "expires_at"}).
+				AddRow("k1", []byte("v1"), time.Now().Add(time.Hour).Unix()).
+				AddRow("k2", []byte("v2"), 0),
+			)
+
+		st, err := objcache.NewDBClient(dbc.DB)()
+		assert.NoError(t, err)
+
+		assert.NoError(t, st.Set(ctx, []string{"k1", "k2"}, [][]byte{[]byte("v1"), []byte("v2")}, []time.Duration{time.Hour, 0}))
+		vals, err := st.Get(ctx, []string{"k1", "k3", "k2"})
+		assert.NoError(t, err)
+		assert.Exactly(t, [][]byte{[]byte("v1"), nil, []byte("v2")}, vals)
+		assert.NoError(t, st.Close())
+	})
+
+	t.Run("Get deletes expired rows", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `value`, `expires_at` FROM `cache` WHERE (`id` IN (?))")).
+			WithArgs("k1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "value", "expires_at"}).
+				AddRow("k1", []byte("v1"), time.Now().Add(-time.Hour).Unix()),
+			)
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `cache` WHERE (`id` IN (?)) AND (`expires_at` > 0) AND (`expires_at` <= ?)")).
+			WithArgs("k1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		st, err := objcache.NewDBClientWithOptions(dbc.DB, &objcache.DBOptions{TableName: "cache"})()
+		assert.NoError(t, err)
+		vals, err := st.Get(ctx, []string{"k1"})
+		assert.NoError(t, err)
+		assert.Exactly(t, [][]byte{nil}, vals)
+	})
+
+	t.Run("Delete in batches and Truncate", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache` WHERE (`id` IN (?,?))")).
+			WithArgs("k1", "k2").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache_tag` WHERE (`id` IN (?,?))")).
+			WithArgs("k1", "k2").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache` WHERE (`id` IN (?))")).
+			WithArgs("k3").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache_tag` WHERE (`id` IN (?))")).
+			WithArgs("k3").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("TRUNCATE TABLE `objcache`")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("TRUNCATE TABLE `objcache_tag`")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		st, err := objcache.NewDBClientWithOptions(dbc.DB, &objcache.DBOptions{BatchSize: 2})()
+		assert.NoError(t, err)
+		assert.NoError(t, st.Delete(ctx, []string{"k1", "k2", "k3"}))
+		assert.NoError(t, st.Truncate(ctx))
+	})
+
+	t.Run("background purge", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache` WHERE (`expires_at` > 0) AND (`expires_at` <= ?)")).
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `objcache_tag` WHERE (`id` NOT IN (SELECT `id` FROM `objcache`))")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		st, err := objcache.NewDBClientWithOptions(dbc.DB, &objcache.DBOptions{PurgeInterval: time.Millisecond * 20})()
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond * 30)
+		assert.NoError(t, st.Close())
+	})
+
+	t.Run("BackendStats", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT COUNT(*) AS `items`, COALESCE(SUM(LENGTH(`value`)),0) AS `size` FROM `objcache` WHERE (`expires_at` = 0) OR (`expires_at` > ?)")).
+			WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"items", "size"}).AddRow(3, 42))
+
+		st, err := objcache.NewDBClient(dbc.DB)()
+		assert.NoError(t, err)
+		bs, err := st.(objcache.StatsReporter).BackendStats(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, objcache.BackendStats{Items: 3, Size: 42}, bs)
+	})
+
+	t.Run("invalid table name", func(t *testing.T) {
+		st, err := objcache.NewDBClientWithOptions(nil, &objcache.DBOptions{TableName: "obj-cache"})()
+		assert.Nil(t, st)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
+
+// dbInvalidatorMock registers the SQL statements which the dbCache sends while
+// running testInvalidatorConformance.
+type dbInvalidatorMock struct {
+	sqlmock.Sqlmock
+}
+
+func (m dbInvalidatorMock) truncate() {
+	for _, tn := range []string{"objcache", "objcache_tag"} {
+		m.ExpectExec(dmltest.SQLMockQuoteMeta("TRUNCATE TABLE `" + tn + "`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+func (m dbInvalidatorMock) set(key string, tags ...string) {
+	m.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `objcache` (`id`,`value`,`expires_at`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `value`=VALUES(`value`), `expires_at`=VALUES(`expires_at`)")).
+		WithArgs(key, []byte("v_"+key), int64(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if len(tags) == 0 {
+		return
+	}
+	args := make([]driver.Value, 0, len(tags)*2)
+	for _, tag := range tags {
+		args = append(args, key, tag)
+	}
+	m.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT IGNORE INTO `objcache_tag` (`id`,`tag`) VALUES " + placeHolders("(?,?)", len(tags)))).
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, int64(len(tags))))
+}
+
+func (m dbInvalidatorMock) get(exists bool, keys ...string) {
+	rows := sqlmock.NewRows([]string{"id", "value", "expires_at"})
+	args := make([]driver.Value, len(keys))
+	for i, key := range keys {
+		args[i] = key
+		if exists {
+			rows.AddRow(key, []byte("v_"+key), 0)
+		}
+	}
+	m.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `value`, `expires_at` FROM `objcache` WHERE (`id` IN (" + placeHolders("?", len(keys)) + "))")).
+		WithArgs(args...).
+		WillReturnRows(rows)
+}
+
+func (m dbInvalidatorMock) delete(keys ...string) {
+	args := make([]driver.Value, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	for _, tn := range []string{"objcache", "objcache_tag"} {
+		m.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `" + tn + "` WHERE (`id` IN (" + placeHolders("?", len(keys)) + "))")).
+			WithArgs(args...).
+			WillReturnResult(sqlmock.NewResult(0, int64(len(keys))))
+	}
+}
+
+func (m dbInvalidatorMock) deleteByTag(tags []string, keys ...string) {
+	args := make([]driver.Value, len(tags))
+	for i, tag := range tags {
+		args[i] = tag
+	}
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, key := range keys {
+		rows.AddRow(key)
+	}
+	m.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT DISTINCT `id` FROM `objcache_tag` WHERE (`tag` IN (" + placeHolders("?", len(tags)) + "))")).
+		WithArgs(args...).
+		WillReturnRows(rows)
+	if len(keys) > 0 {
+		m.delete(keys...)
+	}
+}
+
+func (m dbInvalidatorMock) deleteByPrefix(likes ...string) {
+	args := make([]driver.Value, len(likes))
+	conds := make([]string, len(likes))
+	for i, l := range likes {
+		args[i] = l
+		conds[i] = "(`id` LIKE ?)"
+	}
+	for _, tn := range []string{"objcache", "objcache_tag"} {
+		m.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `" + tn + "` WHERE " + strings.Join(conds, " OR "))).
+			WithArgs(args...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+func placeHolders(ph string, n int) string {
+	return strings.TrimSuffix(strings.Repeat(ph+",", n), ",")
+}
+
+func TestNewDBClient_Invalidator(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	m := dbInvalidatorMock{Sqlmock: dbMock}
+
+	// DeleteByTag
+	m.truncate()
+	m.set("block_1", "store_3", "product_42")
+	m.set("block_2", "product_42")
+	m.set("block_3", "store_3")
+	m.set("block_4")
+	m.deleteByTag([]string{"product_42"}, "block_1", "block_2")
+	m.get(false, "block_1", "block_2")
+	m.get(true, "block_3", "block_4")
+	m.deleteByTag([]string{"store_3", "not_existent"}, "block_3")
+	m.get(false, "block_3")
+	m.get(true, "block_4")
+
+	// tags are additive
+	m.truncate()
+	m.set("block_1", "store_3")
+	m.set("block_1")
+	m.set("block_1", "product_42")
+	m.get(true, "block_1")
+	m.deleteByTag([]string{"store_3"}, "block_1")
+	m.get(false, "block_1")
+
+	// Delete drops tags
+	m.truncate()
+	m.set("block_1", "store_3")
+	m.delete("block_1")
+	m.set("block_1")
+	m.deleteByTag([]string{"store_3"})
+	m.get(true, "block_1")
+
+	// DeleteByPrefix
+	m.truncate()
+	m.set("store_3_block_a", "cms")
+	m.set("store_3_block_b")
+	m.set("store_30_block_a")
+	m.set("store_4_block_a")
+	m.set("p*x_1")
+	m.set("pax_2")
+	m.deleteByPrefix(`store\_3\_%`, `p*x%`)
+	m.get(false, "store_3_block_a", "store_3_block_b", "p*x_1")
+	m.get(true, "store_30_block_a", "store_4_block_a", "pax_2")
+	m.set("store_3_block_a")
+	m.deleteByTag([]string{"cms"})
+	m.get(true, "store_3_block_a")
+	m.get(true, "store_3_block_a")
+
+	// Truncate drops tags
+	m.truncate()
+	m.set("block_1", "store_3")
+	m.truncate()
+	m.set("block_1")
+	m.deleteByTag([]string{"store_3"})
+	m.get(true, "block_1")
+
+	testInvalidatorConformance(t, objcache.NewDBClient(dbc.DB))
+}
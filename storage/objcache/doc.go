@@ -16,11 +16,37 @@
 // a cache reducing GC.
 //
 // A Cache can be either in memory or a persistent one. Cache adapters are
-// available for bigcache or Redis. To enable the cache adapter use build tags
-// "bigcache" or "redis" or "csall". More cache adapters might follow.
+// available for bigcache, Redis or a MySQL/MariaDB table. To enable the cache
+// adapter use build tags "bigcache", "redis", "db" or "csall". More cache
+// adapters might follow.
 //
 // Use case: Caching millions of Go types as a byte slice reduces the pressure
 // to the GC.
 //
+// Service.Fetch and Service.GetOrSet protect the backends against cache
+// stampedes: concurrent misses of the same key call the loader function only
+// once. Fetch supports additionally stale-while-revalidate, probabilistic early
+// expiration and negative caching.
+//
+// Backends which implement the Invalidator interface support cache tags and
+// the removal of keys by tag or by key prefix, see Service.SetWithTags,
+// Service.DeleteByTag and Service.DeleteByPrefix.
+//
+// ServiceOptions.InvalidationBus keeps the level1 caches of several nodes
+// coherent: each write or delete operation publishes the affected keys and all
+// other nodes evict them from their level1 cache. Transports are available
+// in-process (NewLocalInvalidationBus) or via Redis pub/sub
+// (NewRedisInvalidationBus, build tag "redis").
+//
+// Service.Stats reports per level hits, misses, sets, deletes and errors, the
+// codec timings and, if the backend implements StatsReporter, the number of
+// stored items. Service.HTTPHandler (build tag "http") renders the statistics
+// and allows operators to inspect and delete single keys.
+//
+// NewCompressionCodec (gzip, zstd, s2) and NewAESGCMCodec (authenticated
+// encryption with key rotation) wrap any Codecer and can be combined. Their
+// output starts with a header byte, hence values written without these codecs
+// can still be read.
+//
 // For more details regarding bigcache: https://godoc.org/github.com/allegro/bigcache
 package objcache
@@ -0,0 +1,298 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"bytes"
+	"context"
+	encbin "encoding/binary"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// randFloat64 returns a number in the interval (0,1]. Exchangeable in tests.
+var randFloat64 = func() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return 1 - randSource.Float64()
+}
+
+var (
+	randMu     sync.Mutex
+	randSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// FetchFn loads the object when it can't be found in the cache or when it must
+// be refreshed. Returning an error with kind NotFound enables negative caching,
+// see FetchOptions.NegativeTTL.
+type FetchFn func(ctx context.Context) (interface{}, error)
+
+// FetchOptions configures the behaviour of Service.Fetch.
+type FetchOptions struct {
+	// TTL defines how long a loaded object is considered fresh. If zero,
+	// ServiceOptions.DefaultExpires applies.
+	TTL time.Duration
+	// StaleTTL defines how long an object gets served after TTL has been
+	// reached. The first request serving a stale object triggers a refresh in
+	// the background. Zero disables stale-while-revalidate.
+	StaleTTL time.Duration
+	// NegativeTTL defines how long a NotFound error, returned from the FetchFn,
+	// gets cached. Zero disables negative caching.
+	NegativeTTL time.Duration
+	// EarlyExpirationBeta enables probabilistic early expiration (XFetch) when
+	// greater than zero. The higher the value the earlier objects get
+	// refreshed in the background before their TTL has been reached. A good
+	// default is 1.0. The duration of the last FetchFn call gets taken into
+	// account.
+	EarlyExpirationBeta float64
+	// RefreshTimeout limits the runtime of a shared FetchFn call and of a
+	// background refresh. Default 30s.
+	RefreshTimeout time.Duration
+}
+
+const (
+	fetchEnvelopeVersion  byte = 1
+	fetchEnvelopeNegative byte = 1 << 0
+	fetchEnvelopeHeader        = 18 // version + flags + expires + delta
+)
+
+// fetchEnvelope wraps the encoded object together with the data needed for
+// the freshness checks.
+type fetchEnvelope struct {
+	negative  bool
+	expiresAt int64 // unix nano, end of freshness
+	delta     int64 // nano seconds the FetchFn call took
+	payload   []byte
+}
+
+func (fe fetchEnvelope) marshal() []byte {
+	buf := make([]byte, fetchEnvelopeHeader, fetchEnvelopeHeader+len(fe.payload))
+	buf[0] = fetchEnvelopeVersion
+	if fe.negative {
+		buf[1] = fetchEnvelopeNegative
+	}
+	encbin.BigEndian.PutUint64(buf[2:10], uint64(fe.expiresAt))
+	encbin.BigEndian.PutUint64(buf[10:18], uint64(fe.delta))
+	return append(buf, fe.payload...)
+}
+
+func (fe *fetchEnvelope) unmarshal(data []byte) bool {
+	if len(data) < fetchEnvelopeHeader || data[0] != fetchEnvelopeVersion {
+		return false
+	}
+	fe.negative = data[1]&fetchEnvelopeNegative != 0
+	fe.expiresAt = int64(encbin.BigEndian.Uint64(data[2:10]))
+	fe.delta = int64(encbin.BigEndian.Uint64(data[10:18]))
+	fe.payload = data[fetchEnvelopeHeader:]
+	return true
+}
+
+// isFresh reports whether the envelope can be served without a refresh. With
+// beta > 0 the XFetch algorithm decides randomly to refresh before the TTL has
+// been reached: now - delta * beta * ln(rand()) >= expiry.
+func (fe fetchEnvelope) isFresh(n int64, beta float64) bool {
+	if beta > 0 && fe.delta > 0 {
+		n += int64(-float64(fe.delta) * beta * math.Log(randFloat64()))
+	}
+	return n < fe.expiresAt
+}
+
+// hardExpiresAt returns the end of the stale period.
+func (fe fetchEnvelope) hardExpiresAt(staleTTL time.Duration) int64 {
+	if fe.negative || staleTTL <= 0 || fe.expiresAt > math.MaxInt64-int64(staleTTL) {
+		return fe.expiresAt
+	}
+	return fe.expiresAt + int64(staleTTL)
+}
+
+// getRaw returns the raw bytes of a key from level1 or level2. A nil slice
+// indicates a cache miss.
+func (tr *Service) getRaw(ctx context.Context, key string) ([]byte, error) {
+	keys := [1]string{key}
+	if tr.level1 != nil {
+		vals, err := tr.level1.Get(ctx, keys[:])
+		tr.stats.level1.countGet(vals, err)
+		if err != nil && !errors.NotFound.Match(err) {
+			return nil, errors.Wrapf(err, "[objcache] Level1 with key %q", key)
+		}
+		if len(vals) == 1 && vals[0] != nil {
+			return vals[0], nil
+		}
+	}
+	vals, err := tr.level2.Get(ctx, keys[:])
+	tr.stats.level2.countGet(vals, err)
+	if err != nil && !errors.NotFound.Match(err) {
+		return nil, errors.Wrapf(err, "[objcache] Level2 with key %q", key)
+	}
+	if len(vals) == 1 {
+		return vals[0], nil
+	}
+	return nil, nil
+}
+
+func (tr *Service) setRaw(ctx context.Context, key string, value []byte, expires time.Duration) error {
+	keys := [1]string{key}
+	values := [1][]byte{value}
+	exp := [1]time.Duration{expires}
+	if err := tr.setLevels(ctx, keys[:], values[:], exp[:]); err != nil {
+		return errors.WithStack(err)
+	}
+	return tr.publish(ctx, InvalidationMessage{Keys: keys[:]})
+}
+
+// load calls the FetchFn and writes the result as an envelope into the
+// caches. Must only be called via the singleflight group.
+func (tr *Service) load(ctx context.Context, key string, o FetchOptions, fn FetchFn) (fetchEnvelope, error) {
+	start := now()
+	src, err := fn(ctx)
+	fe := fetchEnvelope{
+		delta: int64(now().Sub(start)),
+	}
+	ttl := o.TTL
+	switch {
+	case err != nil && errors.NotFound.Match(err) && o.NegativeTTL > 0:
+		fe.negative = true
+		ttl = o.NegativeTTL
+	case err != nil:
+		return fe, errors.WithStack(err)
+	default:
+		var buf bytes.Buffer
+		if err := tr.encode(&buf, key, src); err != nil {
+			return fe, errors.WithStack(err)
+		}
+		fe.payload = buf.Bytes()
+	}
+	switch {
+	case ttl <= 0:
+		fe.expiresAt = math.MaxInt64 // never expires
+		ttl = 0
+	case fe.negative:
+		fe.expiresAt = now().Add(ttl).UnixNano()
+	default:
+		fe.expiresAt = now().Add(ttl).UnixNano()
+		ttl += o.StaleTTL
+	}
+	if err2 := tr.setRaw(ctx, key, fe.marshal(), ttl); err2 != nil {
+		return fe, errors.WithStack(err2)
+	}
+	return fe, nil
+}
+
+// loadShared merges concurrent loads of the same key. A caller whose context
+// ends stops waiting, but the load continues for the other callers, limited
+// by the RefreshTimeout.
+func (tr *Service) loadShared(ctx context.Context, key string, o FetchOptions, fn FetchFn) (fetchEnvelope, error) {
+	v, err, _ := tr.fetchGroup.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, o.refreshTimeout())
+		defer cancel()
+		return tr.load(ctx, key, o, fn)
+	})
+	fe, _ := v.(fetchEnvelope)
+	return fe, err
+}
+
+func (o FetchOptions) refreshTimeout() time.Duration {
+	if o.RefreshTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return o.RefreshTimeout
+}
+
+// refresh reloads the key in the background. Only one goroutine per key
+// refreshes at a time, further stale hits return immediately. Concurrent Fetch
+// calls for the same key get merged. After Close no refresh gets started.
+func (tr *Service) refresh(key string, o FetchOptions, fn FetchFn) {
+	tr.refreshMu.Lock()
+	if _, ok := tr.refreshKeys[key]; ok || tr.closed {
+		tr.refreshMu.Unlock()
+		return
+	}
+	if tr.refreshKeys == nil {
+		tr.refreshKeys = make(map[string]struct{})
+	}
+	tr.refreshKeys[key] = struct{}{}
+	tr.fetchRefresh.Add(1)
+	tr.refreshMu.Unlock()
+
+	go func() {
+		defer tr.fetchRefresh.Done()
+		defer func() {
+			tr.refreshMu.Lock()
+			delete(tr.refreshKeys, key)
+			tr.refreshMu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), o.refreshTimeout())
+		defer cancel()
+		_, _ = tr.loadShared(ctx, key, o, fn) // errors get discarded, the stale object stays until its hard expiration.
+	}()
+}
+
+// Fetch looks up the key and decodes the object into `dst`. On a cache miss
+// the FetchFn gets called exactly once per key, even when many goroutines
+// request the same key at the same time (stampede protection). All waiting
+// callers receive the same result.
+//
+// With FetchOptions.StaleTTL an expired object gets still served while a
+// background goroutine refreshes it. With FetchOptions.EarlyExpirationBeta an
+// object gets refreshed in the background before it expires. With
+// FetchOptions.NegativeTTL the NotFound error of the FetchFn gets cached and
+// returned for the duration of the NegativeTTL.
+//
+// Keys written by Fetch store additional meta data and must only be read via
+// Fetch or GetOrSet. Data which has not been written by Fetch gets treated as
+// a cache miss and overwritten.
+func (tr *Service) Fetch(ctx context.Context, key string, dst interface{}, o FetchOptions, fn FetchFn) error {
+	if o.TTL == 0 {
+		o.TTL = tr.so.DefaultExpires
+	}
+	raw, err := tr.getRaw(ctx, key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var fe fetchEnvelope
+	if raw == nil || !fe.unmarshal(raw) {
+		if fe, err = tr.loadShared(ctx, key, o, fn); err != nil {
+			return errors.WithStack(err)
+		}
+	} else if n := now().UnixNano(); n >= fe.hardExpiresAt(o.StaleTTL) {
+		// the backend has not yet evicted the expired object.
+		if fe, err = tr.loadShared(ctx, key, o, fn); err != nil {
+			return errors.WithStack(err)
+		}
+	} else if !fe.negative && !fe.isFresh(n, o.EarlyExpirationBeta) {
+		// stale or early expired object: serve it and refresh in the background.
+		tr.refresh(key, o, fn)
+	}
+
+	if fe.negative {
+		return errors.NotFound.Newf("[objcache] Key %q not found (negative cached)", key)
+	}
+	if err := tr.decode(fe.payload, key, dst); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetOrSet looks up the key and decodes the object into `dst`. On a cache miss
+// the FetchFn gets called once per key, the result gets cached with the
+// `expires` duration and decoded into `dst`. It is a shortcut for Fetch.
+func (tr *Service) GetOrSet(ctx context.Context, key string, dst interface{}, expires time.Duration, fn FetchFn) error {
+	return tr.Fetch(ctx, key, dst, FetchOptions{TTL: expires}, fn)
+}
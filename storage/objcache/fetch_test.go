@@ -0,0 +1,258 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"context"
+	"encoding/gob"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// mockClock replaces the package level now function.
+type mockClock struct {
+	nano int64
+}
+
+func newMockClock(t *testing.T) (*mockClock, func()) {
+	mc := &mockClock{nano: time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano()}
+	now = func() time.Time { return time.Unix(0, atomic.LoadInt64(&mc.nano)) }
+	return mc, func() { now = time.Now }
+}
+
+func (mc *mockClock) add(d time.Duration) { atomic.AddInt64(&mc.nano, int64(d)) }
+
+type fetchGobCodec struct{}
+
+func (fetchGobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (fetchGobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+func newFetchService(t *testing.T) *Service {
+	srv, err := NewService(nil, NewCacheSimpleInmemory, &ServiceOptions{Codec: fetchGobCodec{}})
+	assert.NoError(t, err)
+	return srv
+}
+
+func TestService_Fetch_Stampede(t *testing.T) {
+	srv := newFetchService(t)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	var calls int32
+	start := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "product 4711", nil
+	}
+
+	const goroutines = 30
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			<-start
+			var dst string
+			assert.NoError(t, srv.Fetch(context.Background(), "prod_4711", &dst, FetchOptions{TTL: time.Minute}, fn))
+			assert.Exactly(t, "product 4711", dst)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Exactly(t, int32(1), atomic.LoadInt32(&calls))
+
+	var dst string
+	assert.NoError(t, srv.GetOrSet(context.Background(), "prod_4711", &dst, time.Minute, fn))
+	assert.Exactly(t, "product 4711", dst)
+	assert.Exactly(t, int32(1), atomic.LoadInt32(&calls), "served from cache")
+}
+
+func TestService_Fetch_StaleWhileRevalidate(t *testing.T) {
+	clock, reset := newMockClock(t)
+	defer reset()
+	srv := newFetchService(t)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		return int(atomic.AddInt32(&calls, 1)), nil
+	}
+	o := FetchOptions{TTL: time.Minute, StaleTTL: time.Hour}
+	ctx := context.Background()
+
+	var dst int
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 1, dst)
+
+	clock.add(2 * time.Minute) // stale
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 1, dst, "stale value must be served")
+	srv.fetchRefresh.Wait()
+	assert.Exactly(t, int32(2), atomic.LoadInt32(&calls))
+
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 2, dst, "refreshed value")
+
+	clock.add(2 * time.Hour) // beyond stale period, the cache has evicted the key
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 3, dst)
+	assert.Exactly(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestService_Fetch_NegativeCaching(t *testing.T) {
+	clock, reset := newMockClock(t)
+	defer reset()
+	srv := newFetchService(t)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.NotFound.Newf("product not found")
+	}
+	o := FetchOptions{TTL: time.Hour, NegativeTTL: time.Minute}
+	ctx := context.Background()
+
+	var dst string
+	for i := 0; i < 3; i++ {
+		err := srv.Fetch(ctx, "k", &dst, o, fn)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	}
+	assert.Exactly(t, int32(1), atomic.LoadInt32(&calls))
+
+	clock.add(2 * time.Minute)
+	err := srv.Fetch(ctx, "k", &dst, o, fn)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	assert.Exactly(t, int32(2), atomic.LoadInt32(&calls))
+
+	t.Run("disabled", func(t *testing.T) {
+		o.NegativeTTL = 0
+		for i := 0; i < 2; i++ {
+			err := srv.Fetch(ctx, "k2", &dst, o, fn)
+			assert.True(t, errors.NotFound.Match(err), "%+v", err)
+		}
+		assert.Exactly(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("other errors are not cached", func(t *testing.T) {
+		fnErr := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errors.ConnectionFailed.Newf("database gone")
+		}
+		for i := 0; i < 2; i++ {
+			err := srv.Fetch(ctx, "k3", &dst, o, fnErr)
+			assert.True(t, errors.ConnectionFailed.Match(err), "%+v", err)
+		}
+		assert.Exactly(t, int32(6), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestService_Fetch_EarlyExpiration(t *testing.T) {
+	clock, reset := newMockClock(t)
+	defer reset()
+	srv := newFetchService(t)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	var rnd = 1.0
+	origRand := randFloat64
+	randFloat64 = func() float64 { return rnd }
+	defer func() { randFloat64 = origRand }()
+
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		clock.add(time.Second) // the computation takes one second
+		return int(atomic.AddInt32(&calls, 1)), nil
+	}
+	o := FetchOptions{TTL: time.Minute, EarlyExpirationBeta: 1}
+	ctx := context.Background()
+
+	var dst int
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 1, dst)
+
+	// ln(1) = 0, no early expiration
+	clock.add(50 * time.Second)
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	srv.fetchRefresh.Wait()
+	assert.Exactly(t, int32(1), atomic.LoadInt32(&calls))
+
+	// -1s * ln(1e-9) ~= 20s, now+20s > expiry triggers a background refresh
+	rnd = 1e-9
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 1, dst)
+	srv.fetchRefresh.Wait()
+	assert.Exactly(t, int32(2), atomic.LoadInt32(&calls))
+
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	assert.Exactly(t, 2, dst)
+}
+
+func TestService_Fetch_ForeignData(t *testing.T) {
+	srv := newFetchService(t)
+	defer func() { assert.NoError(t, srv.Close()) }()
+	ctx := context.Background()
+
+	assert.NoError(t, srv.Set(ctx, "k", "written by Set", 0))
+	var dst string
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, FetchOptions{}, func(ctx context.Context) (interface{}, error) {
+		return "written by Fetch", nil
+	}))
+	assert.Exactly(t, "written by Fetch", dst)
+}
+
+func TestService_Fetch_OneRefreshPerKey(t *testing.T) {
+	clock, reset := newMockClock(t)
+	defer reset()
+	srv := newFetchService(t)
+
+	var calls int32
+	block := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-block
+		}
+		return int(atomic.LoadInt32(&calls)), nil
+	}
+	o := FetchOptions{TTL: time.Minute, StaleTTL: time.Hour}
+	ctx := context.Background()
+
+	var dst int
+	assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+	clock.add(2 * time.Minute) // stale
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, srv.Fetch(ctx, "k", &dst, o, fn))
+		assert.Exactly(t, 1, dst, "stale value must be served")
+	}
+	srv.refreshMu.Lock()
+	assert.Len(t, srv.refreshKeys, 1)
+	srv.refreshMu.Unlock()
+
+	close(block)
+	assert.NoError(t, srv.Close())
+	assert.Exactly(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Len(t, srv.refreshKeys, 0)
+
+	srv.refresh("k", o, fn) // must not start a goroutine after Close
+	srv.refreshMu.Lock()
+	assert.Len(t, srv.refreshKeys, 0)
+	srv.refreshMu.Unlock()
+}
@@ -21,8 +21,10 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -44,6 +46,11 @@ type FileSystemConfig struct {
 
 // NewFileSystemClient creates a new file system client. Argument `c` can be nil.
 // Warning: do not change manually the files mtime and atime.
+//
+// Next to the cache file, a file with the suffix ".key" stores the original
+// key for prefix invalidation and a file with the suffix ".tags" stores the
+// tags of the key. The directory "tags" contains for each tag a directory with
+// a marker file per key.
 func NewFileSystemClient(c *FileSystemConfig) NewStorageFn {
 	if c == nil {
 		c = &FileSystemConfig{}
@@ -126,6 +133,9 @@ func (fs *fileStorage) Set(_ context.Context, keys []string, values [][]byte, ex
 		if err := fs.writeFileContent(kfn, values[i], e); err != nil {
 			return errors.WithStack(err)
 		}
+		if err := ioutil.WriteFile(fs.baseName(kfn)+fileKeySuffix, []byte(key), fs.cfg.FileMode); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 	return nil
 }
@@ -146,7 +156,7 @@ func (fs *fileStorage) lookupFileContent(fileName string, values [][]byte) ([][]
 	}
 
 	if mt := fi.ModTime(); mt.Year() > 1970 && mt.Before(now()) { // too old, delete the file which cleans up the cache
-		err := os.Remove(fileName)
+		err := fs.removeFiles(fileName)
 		values = append(values, nil)
 		return values, err
 	}
@@ -187,6 +197,9 @@ func (fs *fileStorage) Delete(_ context.Context, keys []string) error {
 		if err = os.Remove(kfn); err != nil {
 			return errors.WithStack(err)
 		}
+		if err = fs.removeFiles(kfn); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 	return nil
 }
@@ -210,9 +223,7 @@ func (fs *fileStorage) getCacheFileName(key string) (string, error) {
 		return fileName, nil
 	}
 
-	m := sha1.New()
-	m.Write([]byte(key))
-	keyMd5 := hex.EncodeToString(m.Sum(nil))
+	keyMd5 := sha1Hex(key)
 	cachePath := fs.cfg.Path
 	switch fs.cfg.DirectoryLevel {
 	case 2:
@@ -249,3 +260,211 @@ func fileExists(path string) (bool, error) {
 	}
 	return false, err
 }
+
+const (
+	fileKeySuffix  = ".key"
+	fileTagsSuffix = ".tags"
+	fileTagsDir    = "tags"
+)
+
+func sha1Hex(s string) string {
+	m := sha1.New()
+	m.Write([]byte(s))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// baseName removes the file suffix from the cache file name.
+func (fs *fileStorage) baseName(fileName string) string {
+	return strings.TrimSuffix(fileName, fs.cfg.FileSuffix)
+}
+
+func (fs *fileStorage) tagDir(tag string) string {
+	return filepath.Join(fs.cfg.Path, fileTagsDir, sha1Hex(tag))
+}
+
+func removeIfExists(fileName string) error {
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// removeFiles removes the cache file, its key file, its tags file and the tag
+// markers. Missing files get ignored.
+func (fs *fileStorage) removeFiles(fileName string) error {
+	base := fs.baseName(fileName)
+	tags, err := ioutil.ReadFile(base + fileTagsSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	for _, tag := range strings.Split(string(tags), "\n") {
+		if tag == "" {
+			continue
+		}
+		if err := removeIfExists(filepath.Join(fs.tagDir(tag), filepath.Base(base))); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for _, fn := range [...]string{fileName, base + fileKeySuffix, base + fileTagsSuffix} {
+		if err := removeIfExists(fn); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// SetWithTags writes the keys and creates for each tag a marker file in the
+// tag directory.
+func (fs *fileStorage) SetWithTags(ctx context.Context, keys []string, values [][]byte, expires []time.Duration, tags [][]string) error {
+	if err := fs.Set(ctx, keys, values, expires); err != nil {
+		return errors.WithStack(err)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i, key := range keys {
+		if i >= len(tags) || len(tags[i]) == 0 {
+			continue
+		}
+		kfn, err := fs.getCacheFileName(key)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		base := fs.baseName(kfn)
+		current, err := ioutil.ReadFile(base + fileTagsSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		allTags := strings.Split(string(current), "\n")
+		for _, tag := range tags[i] {
+			td := fs.tagDir(tag)
+			if err := os.MkdirAll(td, fs.cfg.DirectoryMode); err != nil {
+				return errors.Wrapf(err, "[objcache] FileStorage tag directory %q", td)
+			}
+			if err := ioutil.WriteFile(filepath.Join(td, filepath.Base(base)), []byte(key), fs.cfg.FileMode); err != nil {
+				return errors.WithStack(err)
+			}
+			if !containsString(allTags, tag) {
+				allTags = append(allTags, tag)
+			}
+		}
+		if err := ioutil.WriteFile(base+fileTagsSuffix, []byte(strings.Join(allTags, "\n")), fs.cfg.FileMode); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func containsString(sl []string, s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteByTag reads the marker files of the tag directories and removes the
+// keys.
+func (fs *fileStorage) DeleteByTag(_ context.Context, tags []string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, tag := range tags {
+		td := fs.tagDir(tag)
+		markers, err := ioutil.ReadDir(td)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "[objcache] FileStorage tag directory %q", td)
+		}
+		for _, m := range markers {
+			key, err := ioutil.ReadFile(filepath.Join(td, m.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			if len(key) == 0 {
+				continue
+			}
+			kfn, err := fs.getCacheFileName(string(key))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := fs.removeFiles(kfn); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if err := os.RemoveAll(td); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// DeleteByPrefix walks the cache directory, reads all key files and removes
+// the keys which start with one of the prefixes.
+func (fs *fileStorage) DeleteByPrefix(_ context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return errors.WithStack(err)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	tagsDir := filepath.Join(fs.cfg.Path, fileTagsDir)
+	var cacheFiles []string
+	err := filepath.Walk(fs.cfg.Path, func(path string, info os.FileInfo, err error) error {
+		switch {
+		case os.IsNotExist(err):
+			return nil
+		case err != nil:
+			return err
+		case info.IsDir() && path == tagsDir:
+			return filepath.SkipDir
+		case info.IsDir() || !strings.HasSuffix(path, fileKeySuffix):
+			return nil
+		}
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if hasAnyPrefix(string(key), prefixes) {
+			cacheFiles = append(cacheFiles, strings.TrimSuffix(path, fileKeySuffix)+fs.cfg.FileSuffix)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "[objcache] FileStorage walking %q", fs.cfg.Path)
+	}
+	for _, cf := range cacheFiles {
+		if err := fs.removeFiles(cf); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// BackendStats walks the cache directory and counts the cache files and their
+// size in bytes. Expired files, which have not yet been removed, get counted
+// too.
+func (fs *fileStorage) BackendStats(_ context.Context) (bs BackendStats, _ error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	tagsDir := filepath.Join(fs.cfg.Path, fileTagsDir)
+	err := filepath.Walk(fs.cfg.Path, func(path string, info os.FileInfo, err error) error {
+		switch {
+		case os.IsNotExist(err):
+			return nil
+		case err != nil:
+			return err
+		case info.IsDir() && path == tagsDir:
+			return filepath.SkipDir
+		case info.IsDir() || !strings.HasSuffix(path, fs.cfg.FileSuffix):
+			return nil
+		}
+		bs.Items++
+		bs.Size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return bs, errors.Wrapf(err, "[objcache] FileStorage walking %q", fs.cfg.Path)
+	}
+	return bs, nil
+}
@@ -17,10 +17,13 @@
 package objcache_test
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
 )
 
 func TestNewFileSystemClient_Delete(t *testing.T) {
@@ -51,3 +54,22 @@ func TestNewFileSystemClient_ComplexParallel(t *testing.T) {
 	})
 
 }
+
+func TestNewFileSystemClient_Invalidator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objcache_invalidator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	testInvalidatorConformance(t, objcache.NewFileSystemClient(&objcache.FileSystemConfig{
+		Path: dir,
+	}))
+}
+
+func TestNewFileSystemClient_BackendStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objcache_stats")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bs := testBackendStats(t, objcache.NewFileSystemClient(&objcache.FileSystemConfig{
+		Path: dir,
+	}))
+	assert.Exactly(t, int64(4), bs.Size)
+}
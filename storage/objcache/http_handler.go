@@ -0,0 +1,125 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall http
+
+package objcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/net/mw"
+)
+
+// HTTPHandlerOptions can set different behaviour to the handler returned by
+// Service.HTTPHandler.
+type HTTPHandlerOptions struct {
+	// ErrorHandler custom error handler. Default error handler returns a status
+	// code and prints the whole stack trace. May leak sensitive information.
+	ErrorHandler mw.ErrorHandler
+	// StatusCodeError sets the HTTP status for erroneous operation, default
+	// http.StatusInternalServerError
+	StatusCodeError int
+	// ReadOnly rejects DELETE requests with http.StatusMethodNotAllowed.
+	ReadOnly bool
+}
+
+// httpKeyInfo extends KeyInfo with a printable representation of the value.
+type httpKeyInfo struct {
+	KeyInfo
+	Value       string `json:"value,omitempty"`
+	ValueBase64 []byte `json:"value_base64,omitempty"`
+}
+
+// HTTPHandler provides an endpoint for operators to inspect the cache. The
+// handler does not implement any authentication and must be protected by a
+// middleware.
+//
+//	GET                  renders the Stats as JSON.
+//	GET ?key=a           renders the KeyInfo of key `a` as JSON. The raw value
+//	                     gets printed as string if it is valid UTF-8, otherwise
+//	                     base64 encoded. Returns 404 if the key cannot be found.
+//	DELETE ?key=a&key=b  removes the keys from all levels and returns 204.
+func (tr *Service) HTTPHandler(ho HTTPHandlerOptions) http.Handler {
+	if ho.StatusCodeError == 0 {
+		ho.StatusCodeError = http.StatusInternalServerError
+	}
+	if ho.ErrorHandler == nil {
+		ho.ErrorHandler = mw.ErrorWithStatusCode(ho.StatusCodeError)
+	}
+	writeJSON := func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			ho.ErrorHandler(errors.WithStack(err)).ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write(data)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := r.URL.Query()["key"]
+		switch {
+		case r.Method == http.MethodGet && len(keys) == 0:
+			s, err := tr.Stats(r.Context())
+			if err != nil {
+				ho.ErrorHandler(err).ServeHTTP(w, r)
+				return
+			}
+			writeJSON(w, r, s)
+
+		case r.Method == http.MethodGet && len(keys) == 1:
+			ki, err := tr.Inspect(r.Context(), keys[0])
+			switch {
+			case errors.NotFound.Match(err):
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			case err != nil:
+				ho.ErrorHandler(err).ServeHTTP(w, r)
+				return
+			}
+			hki := httpKeyInfo{KeyInfo: ki}
+			if utf8.Valid(ki.Value) {
+				hki.Value = string(ki.Value)
+			} else {
+				hki.ValueBase64 = ki.Value
+			}
+			writeJSON(w, r, hki)
+
+		case r.Method == http.MethodGet:
+			http.Error(w, "Only one key can be inspected", http.StatusBadRequest)
+
+		case r.Method == http.MethodDelete && !ho.ReadOnly && len(keys) > 0:
+			if err := tr.Delete(r.Context(), keys...); err != nil {
+				ho.ErrorHandler(err).ServeHTTP(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case r.Method == http.MethodDelete && !ho.ReadOnly:
+			http.Error(w, "Missing query parameter key", http.StatusBadRequest)
+
+		default:
+			if ho.ReadOnly {
+				w.Header().Set("Allow", http.MethodGet)
+			} else {
+				w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+			}
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
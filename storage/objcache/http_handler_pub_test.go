@@ -0,0 +1,99 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall http
+
+package objcache_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestService_HTTPHandler(t *testing.T) {
+	ctx := context.Background()
+	level2 := sharedStorage(t, objcache.NewCacheSimpleInmemory)
+	p, err := objcache.NewService(objcache.NewLRU(nil), level2, newSrvOpt(JSONCodec{}))
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, p.Close()) }()
+
+	assert.NoError(t, p.Set(ctx, "k1", "v1", 0))
+	st, _ := level2()
+	assert.NoError(t, st.Set(ctx, []string{"k2"}, [][]byte{{0xff, 0xfe}}, nil))
+
+	serve := func(h http.Handler, method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+	hndlr := p.HTTPHandler(objcache.HTTPHandlerOptions{})
+
+	t.Run("GET stats", func(t *testing.T) {
+		w := serve(hndlr, "GET", "/")
+		assert.Exactly(t, http.StatusOK, w.Code)
+		assert.Exactly(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		var s objcache.Stats
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+		assert.Exactly(t, uint64(1), s.Level2.Sets)
+		assert.Exactly(t, int64(2), s.Level2.Backend.Items)
+	})
+
+	t.Run("GET key", func(t *testing.T) {
+		w := serve(hndlr, "GET", "/?key=k1")
+		assert.Exactly(t, http.StatusOK, w.Code)
+		assert.Exactly(t, `{"key":"k1","in_level1":true,"in_level2":true,"size":5,"value":"\"v1\"\n"}`, w.Body.String())
+	})
+
+	t.Run("GET binary key", func(t *testing.T) {
+		w := serve(hndlr, "GET", "/?key=k2")
+		assert.Exactly(t, http.StatusOK, w.Code)
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &m))
+		assert.Exactly(t, "//4=", m["value_base64"])
+		assert.Nil(t, m["value"])
+	})
+
+	t.Run("GET not found and bad request", func(t *testing.T) {
+		assert.Exactly(t, http.StatusNotFound, serve(hndlr, "GET", "/?key=k3").Code)
+		assert.Exactly(t, http.StatusBadRequest, serve(hndlr, "GET", "/?key=k1&key=k2").Code)
+	})
+
+	t.Run("DELETE", func(t *testing.T) {
+		assert.Exactly(t, http.StatusBadRequest, serve(hndlr, "DELETE", "/").Code)
+		assert.Exactly(t, http.StatusNoContent, serve(hndlr, "DELETE", "/?key=k1&key=k2").Code)
+		assert.Exactly(t, http.StatusNotFound, serve(hndlr, "GET", "/?key=k1").Code)
+	})
+
+	t.Run("ReadOnly and method not allowed", func(t *testing.T) {
+		ro := p.HTTPHandler(objcache.HTTPHandlerOptions{ReadOnly: true})
+		w := serve(ro, "DELETE", "/?key=k1")
+		assert.Exactly(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Exactly(t, "GET", w.Header().Get("Allow"))
+		assert.Exactly(t, http.StatusMethodNotAllowed, serve(hndlr, "POST", "/").Code)
+	})
+
+	t.Run("backend error", func(t *testing.T) {
+		p, err := objcache.NewService(nil, objcache.NewBlackHoleClient(errors.ConnectionFailed.Newf("Ups")), newSrvOpt(JSONCodec{}))
+		assert.NoError(t, err)
+		w := serve(p.HTTPHandler(objcache.HTTPHandlerOptions{StatusCodeError: http.StatusBadGateway}), "GET", "/?key=k1")
+		assert.Exactly(t, http.StatusBadGateway, w.Code)
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// Invalidator gets implemented by Storager backends which can remove groups
+// of keys. All backends share the same semantics:
+//   - Tags are additive. Setting a key again, with or without tags, keeps its
+//     previous tags.
+//   - Removing a key via Delete, DeleteByTag, DeleteByPrefix or Truncate drops
+//     all its tags.
+//   - DeleteByTag removes all keys which have at least one of the tags.
+//   - DeleteByPrefix removes all keys which start with one of the prefixes. An
+//     empty prefix returns an error with kind Empty.
+type Invalidator interface {
+	// SetWithTags writes the keys like Storager.Set and assigns the tags to
+	// the keys. The tags slice has the same length as the keys slice, an entry
+	// can be nil.
+	SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error
+	// DeleteByTag removes all keys which have at least one of the tags.
+	DeleteByTag(ctx context.Context, tags []string) error
+	// DeleteByPrefix removes all keys which start with one of the prefixes.
+	DeleteByPrefix(ctx context.Context, prefixes []string) error
+}
+
+func validatePrefixes(prefixes []string) error {
+	for _, p := range prefixes {
+		if p == "" {
+			return errors.Empty.Newf("[objcache] DeleteByPrefix does not support an empty prefix")
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetWithTags puts the item in the cache and assigns the tags to the key. The
+// encoding works like in function Set. A level1 cache which does not
+// implement the Invalidator interface stores the item without tags, it gets
+// truncated when calling DeleteByTag or DeleteByPrefix. A level2 cache without
+// Invalidator support returns an error with kind NotSupported.
+func (tr *Service) SetWithTags(ctx context.Context, key string, src interface{}, expires time.Duration, tags ...string) error {
+	if expires == 0 {
+		expires = tr.defaultExpiration
+	}
+
+	var buf bytes.Buffer
+	if err := tr.encode(&buf, key, src); err != nil {
+		return errors.WithStack(err)
+	}
+	keys := [1]string{key}
+	values := [1][]byte{buf.Bytes()}
+	exp := [1]time.Duration{expires}
+	tgs := [1][]string{tags}
+
+	l2, ok := tr.level2.(Invalidator)
+	if !ok {
+		return errors.NotSupported.Newf("[objcache] Level2 cache %T does not implement the Invalidator interface", tr.level2)
+	}
+	if tr.level1 != nil {
+		var err error
+		if l1, ok := tr.level1.(Invalidator); ok {
+			err = l1.SetWithTags(ctx, keys[:], values[:], exp[:], tgs[:])
+		} else {
+			err = tr.level1.Set(ctx, keys[:], values[:], exp[:])
+		}
+		tr.stats.level1.countSet(values[:], err)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	err := l2.SetWithTags(ctx, keys[:], values[:], exp[:], tgs[:])
+	tr.stats.level2.countSet(values[:], err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return tr.publish(ctx, InvalidationMessage{Keys: keys[:]})
+}
+
+func (tr *Service) invalidate(ctx context.Context, msg InvalidationMessage, fn func(Invalidator) error) error {
+	l2, ok := tr.level2.(Invalidator)
+	if !ok {
+		return errors.NotSupported.Newf("[objcache] Level2 cache %T does not implement the Invalidator interface", tr.level2)
+	}
+	if tr.level1 != nil {
+		var err error
+		if l1, ok := tr.level1.(Invalidator); ok {
+			err = fn(l1)
+		} else {
+			err = tr.level1.Truncate(ctx)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := fn(l2); err != nil {
+		return errors.WithStack(err)
+	}
+	return tr.publish(ctx, msg)
+}
+
+// DeleteByTag removes all keys which have at least one of the tags.
+func (tr *Service) DeleteByTag(ctx context.Context, tags ...string) error {
+	return tr.invalidate(ctx, InvalidationMessage{Tags: tags}, func(i Invalidator) error { return i.DeleteByTag(ctx, tags) })
+}
+
+// DeleteByPrefix removes all keys which start with one of the prefixes.
+func (tr *Service) DeleteByPrefix(ctx context.Context, prefixes ...string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return errors.WithStack(err)
+	}
+	return tr.invalidate(ctx, InvalidationMessage{Prefixes: prefixes}, func(i Invalidator) error { return i.DeleteByPrefix(ctx, prefixes) })
+}
+
+// tagIndex maps tags to keys and keys to tags for the in-memory backends.
+// Optionally it tracks all keys for backends which cannot list their keys.
+type tagIndex struct {
+	mu      sync.Mutex
+	tagKeys map[string]map[string]struct{}
+	keyTags map[string]map[string]struct{}
+	keys    map[string]struct{} // nil if keys are not tracked
+}
+
+func newTagIndex(trackKeys bool) *tagIndex {
+	ti := &tagIndex{}
+	ti.resetLocked(trackKeys)
+	return ti
+}
+
+// touch records the keys, if keys are tracked.
+func (ti *tagIndex) touch(keys []string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ti.keys == nil {
+		return
+	}
+	for _, key := range keys {
+		ti.keys[key] = struct{}{}
+	}
+}
+
+// keysByPrefix returns all tracked keys with one of the prefixes.
+func (ti *tagIndex) keysByPrefix(prefixes []string) []string {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	var keys []string
+	for key := range ti.keys {
+		if hasAnyPrefix(key, prefixes) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (ti *tagIndex) add(keys []string, tags [][]string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	for i, key := range keys {
+		if i >= len(tags) {
+			return
+		}
+		for _, tag := range tags[i] {
+			km, ok := ti.tagKeys[tag]
+			if !ok {
+				km = make(map[string]struct{})
+				ti.tagKeys[tag] = km
+			}
+			km[key] = struct{}{}
+			if ti.keys != nil {
+				ti.keys[key] = struct{}{}
+			}
+			tm, ok := ti.keyTags[key]
+			if !ok {
+				tm = make(map[string]struct{})
+				ti.keyTags[key] = tm
+			}
+			tm[tag] = struct{}{}
+		}
+	}
+}
+
+func (ti *tagIndex) removeKeys(keys []string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.removeKeysLocked(keys)
+}
+
+func (ti *tagIndex) removeKeysLocked(keys []string) {
+	for _, key := range keys {
+		for tag := range ti.keyTags[key] {
+			delete(ti.tagKeys[tag], key)
+			if len(ti.tagKeys[tag]) == 0 {
+				delete(ti.tagKeys, tag)
+			}
+		}
+		delete(ti.keyTags, key)
+		delete(ti.keys, key)
+	}
+}
+
+// keysByTags returns all keys of the tags and removes them from the index.
+func (ti *tagIndex) keysByTags(tags []string) []string {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	var keys []string
+	for _, tag := range tags {
+		for key := range ti.tagKeys[tag] {
+			keys = append(keys, key)
+		}
+	}
+	ti.removeKeysLocked(keys)
+	return keys
+}
+
+func (ti *tagIndex) reset() {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.resetLocked(ti.keys != nil)
+}
+
+func (ti *tagIndex) resetLocked(trackKeys bool) {
+	ti.tagKeys = make(map[string]map[string]struct{})
+	ti.keyTags = make(map[string]map[string]struct{})
+	ti.keys = nil
+	if trackKeys {
+		ti.keys = make(map[string]struct{})
+	}
+}
+
+// prune removes keys, which the backend has evicted, from the index, once the
+// index has grown much larger than the backend.
+func (ti *tagIndex) prune(backendLength int, exists func(key string) bool) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if len(ti.keyTags) <= 2*backendLength+1024 && len(ti.keys) <= 2*backendLength+1024 {
+		return
+	}
+	var evicted []string
+	for key := range ti.keyTags {
+		if !exists(key) {
+			evicted = append(evicted, key)
+		}
+	}
+	for key := range ti.keys {
+		if _, ok := ti.keyTags[key]; !ok && !exists(key) {
+			evicted = append(evicted, key)
+		}
+	}
+	ti.removeKeysLocked(evicted)
+}
@@ -0,0 +1,195 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// testInvalidatorConformance verifies that a Storager backend implements the
+// semantics of the Invalidator interface. Each backend test file calls it.
+func testInvalidatorConformance(t *testing.T, newStorage objcache.NewStorageFn) {
+	ctx := context.Background()
+
+	newInvalidator := func(t *testing.T) (objcache.Storager, objcache.Invalidator) {
+		st, err := newStorage()
+		assert.NoError(t, err)
+		assert.NoError(t, st.Truncate(ctx))
+		inv, ok := st.(objcache.Invalidator)
+		if !ok {
+			t.Fatalf("%T does not implement objcache.Invalidator", st)
+		}
+		return st, inv
+	}
+	set := func(t *testing.T, inv objcache.Invalidator, key string, tags ...string) {
+		assert.NoError(t, inv.SetWithTags(ctx, []string{key}, [][]byte{[]byte("v_" + key)}, []time.Duration{0}, [][]string{tags}))
+	}
+	assertKeys := func(t *testing.T, st objcache.Storager, exists bool, keys ...string) {
+		vals, err := st.Get(ctx, keys)
+		assert.NoError(t, err)
+		assert.Len(t, vals, len(keys))
+		for i, key := range keys {
+			if exists {
+				assert.Exactly(t, []byte("v_"+key), vals[i], "Key %q must exist", key)
+			} else {
+				assert.Nil(t, vals[i], "Key %q must not exist", key)
+			}
+		}
+	}
+
+	t.Run("DeleteByTag", func(t *testing.T) {
+		st, inv := newInvalidator(t)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		set(t, inv, "block_1", "store_3", "product_42")
+		set(t, inv, "block_2", "product_42")
+		set(t, inv, "block_3", "store_3")
+		set(t, inv, "block_4")
+
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"product_42"}))
+		assertKeys(t, st, false, "block_1", "block_2")
+		assertKeys(t, st, true, "block_3", "block_4")
+
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"store_3", "not_existent"}))
+		assertKeys(t, st, false, "block_3")
+		assertKeys(t, st, true, "block_4")
+	})
+
+	t.Run("tags are additive", func(t *testing.T) {
+		st, inv := newInvalidator(t)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		set(t, inv, "block_1", "store_3")
+		assert.NoError(t, st.Set(ctx, []string{"block_1"}, [][]byte{[]byte("v_block_1")}, []time.Duration{0}))
+		set(t, inv, "block_1", "product_42")
+		assertKeys(t, st, true, "block_1")
+
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"store_3"}))
+		assertKeys(t, st, false, "block_1")
+	})
+
+	t.Run("Delete drops tags", func(t *testing.T) {
+		st, inv := newInvalidator(t)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		set(t, inv, "block_1", "store_3")
+		assert.NoError(t, st.Delete(ctx, []string{"block_1"}))
+		set(t, inv, "block_1")
+
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"store_3"}))
+		assertKeys(t, st, true, "block_1")
+	})
+
+	t.Run("DeleteByPrefix", func(t *testing.T) {
+		st, inv := newInvalidator(t)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		set(t, inv, "store_3_block_a", "cms")
+		set(t, inv, "store_3_block_b")
+		set(t, inv, "store_30_block_a")
+		set(t, inv, "store_4_block_a")
+		set(t, inv, "p*x_1")
+		set(t, inv, "pax_2")
+
+		assert.NoError(t, inv.DeleteByPrefix(ctx, []string{"store_3_", "p*x"}))
+		assertKeys(t, st, false, "store_3_block_a", "store_3_block_b", "p*x_1")
+		assertKeys(t, st, true, "store_30_block_a", "store_4_block_a", "pax_2")
+
+		// the tag of the removed key has been dropped
+		set(t, inv, "store_3_block_a")
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"cms"}))
+		assertKeys(t, st, true, "store_3_block_a")
+
+		err := inv.DeleteByPrefix(ctx, []string{"store_", ""})
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+		assertKeys(t, st, true, "store_3_block_a")
+	})
+
+	t.Run("Truncate drops tags", func(t *testing.T) {
+		st, inv := newInvalidator(t)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		set(t, inv, "block_1", "store_3")
+		assert.NoError(t, st.Truncate(ctx))
+		set(t, inv, "block_1")
+		assert.NoError(t, inv.DeleteByTag(ctx, []string{"store_3"}))
+		assertKeys(t, st, true, "block_1")
+	})
+}
+
+func TestService_Invalidate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("level1 without Invalidator gets truncated", func(t *testing.T) {
+		p, err := objcache.NewService(newStoragerOnly(objcache.NewCacheSimpleInmemory), objcache.NewLRU(nil), newSrvOpt(JSONCodec{}))
+		assert.NoError(t, err)
+		defer func() { assert.NoError(t, p.Close()) }()
+
+		assert.NoError(t, p.SetWithTags(ctx, "block_1", 1, 0, "store_3"))
+		assert.NoError(t, p.SetWithTags(ctx, "block_2", 2, 0, "store_4"))
+		assert.NoError(t, p.DeleteByTag(ctx, "store_3"))
+
+		var v int
+		assert.NoError(t, p.Get(ctx, "block_1", &v))
+		assert.Exactly(t, 0, v)
+
+		assert.NoError(t, p.SetWithTags(ctx, "block_1", 1, 0, "store_3"))
+		assert.NoError(t, p.DeleteByPrefix(ctx, "block_"))
+		assert.NoError(t, p.Get(ctx, "block_1", &v))
+		assert.Exactly(t, 0, v)
+		assert.NoError(t, p.Get(ctx, "block_2", &v))
+		assert.Exactly(t, 0, v)
+
+		err = p.DeleteByPrefix(ctx, "")
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+
+	t.Run("level2 without Invalidator", func(t *testing.T) {
+		p, err := objcache.NewService(nil, newStoragerOnly(objcache.NewCacheSimpleInmemory), newSrvOpt(JSONCodec{}))
+		assert.NoError(t, err)
+		defer func() { assert.NoError(t, p.Close()) }()
+
+		err = p.SetWithTags(ctx, "block_1", 1, 0, "store_3")
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+		err = p.DeleteByTag(ctx, "store_3")
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+}
+
+func TestNewCacheSimpleInmemory_Invalidator(t *testing.T) {
+	testInvalidatorConformance(t, objcache.NewCacheSimpleInmemory)
+}
+
+func TestNewLRU_Invalidator(t *testing.T) {
+	testInvalidatorConformance(t, objcache.NewLRU(nil))
+}
+
+// storagerOnly hides the Invalidator interface of a backend.
+type storagerOnly struct {
+	objcache.Storager
+}
+
+func newStoragerOnly(fn objcache.NewStorageFn) objcache.NewStorageFn {
+	return func() (objcache.Storager, error) {
+		st, err := fn()
+		return storagerOnly{Storager: st}, err
+	}
+}
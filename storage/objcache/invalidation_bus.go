@@ -0,0 +1,139 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// InvalidationMessage describes which level1 entries other nodes must evict.
+type InvalidationMessage struct {
+	// NodeID identifies the sender. A Service ignores its own messages.
+	NodeID   string   `json:"node_id"`
+	Keys     []string `json:"keys,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Truncate bool     `json:"truncate,omitempty"`
+}
+
+// InvalidationBus transports InvalidationMessages between the nodes which
+// share the same level2 cache. A Service publishes a message after each write
+// or delete operation on level2 and evicts its level1 entries when it receives
+// a message from another node. Implementations must be safe for concurrent
+// use.
+type InvalidationBus interface {
+	// Publish sends the message to all subscribers, including the own node.
+	Publish(ctx context.Context, msg InvalidationMessage) error
+	// Subscribe calls fn for each received message until unsubscribe gets
+	// called.
+	Subscribe(fn func(InvalidationMessage)) (unsubscribe func() error, err error)
+}
+
+func randomNodeID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err) // should not happen
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// publish sends the message to the other nodes, if an InvalidationBus has
+// been set.
+func (tr *Service) publish(ctx context.Context, msg InvalidationMessage) error {
+	if tr.so.InvalidationBus == nil {
+		return nil
+	}
+	msg.NodeID = tr.so.NodeID
+	if err := tr.so.InvalidationBus.Publish(ctx, msg); err != nil {
+		return errors.Wrapf(err, "[objcache] InvalidationBus.Publish from node %q", tr.so.NodeID)
+	}
+	return nil
+}
+
+// evictLevel1 removes the entries of a message, received from another node,
+// from the level1 cache.
+func (tr *Service) evictLevel1(msg InvalidationMessage) {
+	if msg.NodeID == tr.so.NodeID || tr.level1 == nil {
+		return
+	}
+	ctx := context.Background()
+	var err error
+	inv, isInv := tr.level1.(Invalidator)
+	switch {
+	case msg.Truncate, !isInv && (len(msg.Tags) > 0 || len(msg.Prefixes) > 0):
+		err = tr.level1.Truncate(ctx)
+	default:
+		if len(msg.Keys) > 0 {
+			err = tr.level1.Delete(ctx, msg.Keys)
+		}
+		if len(msg.Tags) > 0 && err == nil {
+			err = inv.DeleteByTag(ctx, msg.Tags)
+		}
+		if len(msg.Prefixes) > 0 && err == nil {
+			err = inv.DeleteByPrefix(ctx, msg.Prefixes)
+		}
+	}
+	if err != nil && tr.so.Log != nil && tr.so.Log.IsInfo() {
+		tr.so.Log.Info("objcache.Service.evictLevel1.Error", log.Err(err), log.String("node_id", tr.so.NodeID),
+			log.String("sender_node_id", msg.NodeID), log.Strings("keys", msg.Keys...))
+	}
+}
+
+// LocalInvalidationBus delivers the messages synchronously to all subscribers
+// within the same process. Useful for tests or when several Services share
+// one level2 cache.
+type LocalInvalidationBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]func(InvalidationMessage)
+}
+
+// NewLocalInvalidationBus creates a new in-process InvalidationBus.
+func NewLocalInvalidationBus() *LocalInvalidationBus {
+	return &LocalInvalidationBus{
+		subs: make(map[int]func(InvalidationMessage)),
+	}
+}
+
+// Publish calls all subscribers.
+func (lb *LocalInvalidationBus) Publish(_ context.Context, msg InvalidationMessage) error {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	for _, fn := range lb.subs {
+		fn(msg)
+	}
+	return nil
+}
+
+// Subscribe registers fn.
+func (lb *LocalInvalidationBus) Subscribe(fn func(InvalidationMessage)) (func() error, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	id := lb.nextID
+	lb.nextID++
+	lb.subs[id] = fn
+	return func() error {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		delete(lb.subs, id)
+		return nil
+	}, nil
+}
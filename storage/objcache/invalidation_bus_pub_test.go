@@ -0,0 +1,122 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+// sharedStorage returns always the same Storager to simulate a level2 cache
+// which gets shared by several nodes.
+func sharedStorage(t *testing.T, fn objcache.NewStorageFn) objcache.NewStorageFn {
+	st, err := fn()
+	assert.NoError(t, err)
+	return func() (objcache.Storager, error) { return st, nil }
+}
+
+// testInvalidationBus runs two nodes which share the level2 cache and the bus.
+// Argument wait gets called after each write operation because some buses
+// deliver the messages asynchronously.
+func testInvalidationBus(t *testing.T, level2 objcache.NewStorageFn, newBus func() objcache.InvalidationBus, wait func()) {
+	ctx := context.Background()
+	newNode := func(nodeID string) *objcache.Service {
+		p, err := objcache.NewService(objcache.NewLRU(nil), level2, &objcache.ServiceOptions{
+			Codec:           JSONCodec{},
+			InvalidationBus: newBus(),
+			NodeID:          nodeID,
+		})
+		assert.NoError(t, err)
+		return p
+	}
+	nodeA := newNode("A")
+	defer func() { assert.NoError(t, nodeA.Close()) }()
+	nodeB := newNode("B")
+	defer func() { assert.NoError(t, nodeB.Close()) }()
+
+	assertValue := func(t *testing.T, p *objcache.Service, key, want string) {
+		var have string
+		assert.NoError(t, p.Get(ctx, key, &have))
+		assert.Exactly(t, want, have, "Key %q", key)
+	}
+
+	t.Run("Set", func(t *testing.T) {
+		assert.NoError(t, nodeB.Set(ctx, "product_42", "v1", 0))
+		wait()
+		assertValue(t, nodeB, "product_42", "v1")
+		assert.NoError(t, nodeA.Set(ctx, "product_42", "v2", 0))
+		wait()
+		assertValue(t, nodeB, "product_42", "v2")
+		assertValue(t, nodeA, "product_42", "v2")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.NoError(t, nodeB.Set(ctx, "product_43", "v1", 0))
+		wait()
+		assert.NoError(t, nodeA.Delete(ctx, "product_43"))
+		wait()
+		assertValue(t, nodeB, "product_43", "")
+	})
+
+	t.Run("DeleteByTag and DeleteByPrefix", func(t *testing.T) {
+		assert.NoError(t, nodeB.SetWithTags(ctx, "store_3_block_1", "v1", 0, "store_3"))
+		assert.NoError(t, nodeB.SetWithTags(ctx, "store_4_block_1", "v1", 0, "store_4"))
+		wait()
+		assert.NoError(t, nodeA.DeleteByTag(ctx, "store_3"))
+		wait()
+		assertValue(t, nodeB, "store_3_block_1", "")
+		assertValue(t, nodeB, "store_4_block_1", "v1")
+
+		assert.NoError(t, nodeA.DeleteByPrefix(ctx, "store_4_"))
+		wait()
+		assertValue(t, nodeB, "store_4_block_1", "")
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		assert.NoError(t, nodeB.Set(ctx, "product_44", "v1", 0))
+		wait()
+		assert.NoError(t, nodeA.Truncate(ctx))
+		wait()
+		assertValue(t, nodeB, "product_44", "")
+	})
+}
+
+func TestService_InvalidationBus_Local(t *testing.T) {
+	bus := objcache.NewLocalInvalidationBus()
+	testInvalidationBus(t,
+		sharedStorage(t, objcache.NewCacheSimpleInmemory),
+		func() objcache.InvalidationBus { return bus },
+		func() {},
+	)
+}
+
+func TestService_InvalidationBus_Without(t *testing.T) {
+	ctx := context.Background()
+	level2 := sharedStorage(t, objcache.NewCacheSimpleInmemory)
+	nodeA, err := objcache.NewService(objcache.NewLRU(nil), level2, newSrvOpt(JSONCodec{}))
+	assert.NoError(t, err)
+	nodeB, err := objcache.NewService(objcache.NewLRU(nil), level2, newSrvOpt(JSONCodec{}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, nodeB.Set(ctx, "product_42", "v1", time.Hour))
+	assert.NoError(t, nodeA.Set(ctx, "product_42", "v2", time.Hour))
+	var have string
+	assert.NoError(t, nodeB.Get(ctx, "product_42", &have))
+	assert.Exactly(t, "v1", have, "level1 of node B is stale")
+}
@@ -34,6 +34,7 @@ type LRUOptions struct {
 // lruCache is an LRU cache. It is safe for concurrent access.
 type lruCache struct {
 	opt LRUOptions
+	idx *tagIndex
 }
 
 // NewLRU creates a new LRU Storage. Expirations are not supported. Argument `o`
@@ -61,6 +62,7 @@ func NewLRU(o *LRUOptions) NewStorageFn {
 	return func() (Storager, error) {
 		return lruCache{
 			opt: *o,
+			idx: newTagIndex(false),
 		}, nil
 	}
 }
@@ -103,6 +105,7 @@ func (c lruCache) Get(_ context.Context, keys []string) (values [][]byte, err er
 
 func (c lruCache) Truncate(_ context.Context) (err error) {
 	c.opt.LRUCache.Clear()
+	c.idx.reset()
 	return nil
 }
 
@@ -110,10 +113,62 @@ func (c lruCache) Delete(_ context.Context, keys []string) (err error) {
 	for _, key := range keys {
 		c.opt.LRUCache.Delete(key)
 	}
+	c.idx.removeKeys(keys)
 	return nil
 }
 
+// SetWithTags writes the keys and assigns the tags in an in-memory index.
+// Evicted keys get pruned from the index once it grows too large.
+func (c lruCache) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error {
+	if err := c.Set(ctx, keys, values, expirations); err != nil {
+		return err
+	}
+	c.idx.add(keys, tags)
+	c.idx.prune(int(c.opt.LRUCache.Length()), func(key string) bool {
+		_, ok := c.opt.LRUCache.Peek(key)
+		return ok
+	})
+	return nil
+}
+
+func (c lruCache) DeleteByTag(_ context.Context, tags []string) error {
+	for _, key := range c.idx.keysByTags(tags) {
+		c.opt.LRUCache.Delete(key)
+	}
+	return nil
+}
+
+func (c lruCache) DeleteByPrefix(ctx context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return err
+	}
+	var keys []string
+	for _, key := range c.opt.LRUCache.Keys() {
+		if hasAnyPrefix(key, prefixes) {
+			keys = append(keys, key)
+		}
+	}
+	return c.Delete(ctx, keys)
+}
+
+// BackendStats returns the statistics of the underlying lru.Cache. Size and
+// Capacity contain bytes if TrackBySize has been enabled, otherwise the number
+// of objects.
+func (c lruCache) BackendStats(_ context.Context) (BackendStats, error) {
+	l, s, cp, e, _ := c.opt.LRUCache.Stats()
+	h, m := c.opt.LRUCache.HitsMisses()
+	return BackendStats{
+		Items:     l,
+		Size:      s,
+		Capacity:  cp,
+		Evictions: e,
+		Hits:      h,
+		Misses:    m,
+	}, nil
+}
+
 func (c lruCache) Close() error {
 	c.opt.LRUCache.Clear()
+	c.idx.reset()
 	return nil
 }
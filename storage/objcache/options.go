@@ -18,6 +18,8 @@ import (
 	"context"
 	"sync"
 	"time"
+
+	"github.com/corestoreio/log"
 )
 
 var now = time.Now
@@ -35,12 +37,22 @@ type ServiceOptions struct {
 	// information in the cache.
 	PrimeObjects   []interface{}
 	DefaultExpires time.Duration
+	// InvalidationBus, if set, keeps the level1 caches of several nodes
+	// coherent. Each write or delete operation publishes the affected keys and
+	// all other nodes evict them from their level1 cache.
+	InvalidationBus InvalidationBus
+	// NodeID identifies this Service in the InvalidationBus. Default: random
+	// value.
+	NodeID string
+	// Log optional logger to log errors which occur while evicting level1
+	// entries.
+	Log log.Logger
 }
 
 // NewCacheSimpleInmemory creates an in-memory map map[string]string as cache
 // backend which supports expiration.
 func NewCacheSimpleInmemory() (Storager, error) {
-	mc := &mapCache{}
+	mc := &mapCache{idx: newTagIndex(false)}
 	return mc, nil
 }
 
@@ -51,6 +63,7 @@ type mapCacheItem struct {
 
 type mapCache struct {
 	items sync.Map
+	idx   *tagIndex
 }
 
 func (mc *mapCache) Set(_ context.Context, keys []string, values [][]byte, expirations []time.Duration) (err error) {
@@ -85,19 +98,62 @@ func (mc *mapCache) Delete(_ context.Context, keys []string) (err error) {
 	for _, key := range keys {
 		mc.items.Delete(key)
 	}
+	mc.idx.removeKeys(keys)
+	return nil
+}
+
+func (mc *mapCache) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error {
+	if err := mc.Set(ctx, keys, values, expirations); err != nil {
+		return err
+	}
+	mc.idx.add(keys, tags)
+	return nil
+}
+
+func (mc *mapCache) DeleteByTag(ctx context.Context, tags []string) error {
+	for _, key := range mc.idx.keysByTags(tags) {
+		mc.items.Delete(key)
+	}
 	return nil
 }
+
+func (mc *mapCache) DeleteByPrefix(ctx context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return err
+	}
+	var keys []string
+	mc.items.Range(func(key, _ interface{}) bool {
+		if k := key.(string); hasAnyPrefix(k, prefixes) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return mc.Delete(ctx, keys)
+}
 func (mc *mapCache) Truncate(ctx context.Context) (err error) {
 	mc.items.Range(func(key, value interface{}) bool {
 		value = nil
 		mc.items.Delete(key)
 		return true
 	})
-	mc.items = sync.Map{}
+	mc.idx.reset()
 	return nil
 }
 func (mc *mapCache) Close() error { return nil }
 
+// BackendStats counts the not expired items and their size in bytes.
+func (mc *mapCache) BackendStats(_ context.Context) (bs BackendStats, _ error) {
+	n := now()
+	mc.items.Range(func(_, value interface{}) bool {
+		if v, ok := value.(*mapCacheItem); ok && (v.expiration.IsZero() || v.expiration.After(n)) {
+			bs.Items++
+			bs.Size += int64(len(v.value))
+		}
+		return true
+	})
+	return bs, nil
+}
+
 // NewBlackHoleClient creates a black hole client for testing with the ability
 // to return errors.
 func NewBlackHoleClient(optionalTestErr error) NewStorageFn {
@@ -118,7 +174,12 @@ func (mc blackHole) Get(_ context.Context, keys []string) (values [][]byte, err
 
 func (mc blackHole) Delete(_ context.Context, keys []string) (err error) { return mc.err }
 func (mc blackHole) Truncate(ctx context.Context) (err error)            { return mc.err }
-func (mc blackHole) Close() error                                        { return mc.err }
+func (mc blackHole) SetWithTags(_ context.Context, _ []string, _ [][]byte, _ []time.Duration, _ [][]string) (err error) {
+	return mc.err
+}
+func (mc blackHole) DeleteByTag(_ context.Context, _ []string) (err error)    { return mc.err }
+func (mc blackHole) DeleteByPrefix(_ context.Context, _ []string) (err error) { return mc.err }
+func (mc blackHole) Close() error                                             { return mc.err }
 
 // binary a simple type to use the Service as a set-algorithm to e.g. check if a
 // key exists.
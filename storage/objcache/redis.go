@@ -20,6 +20,7 @@ import (
 	"context"
 	gourl "net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/corestoreio/errors"
@@ -29,6 +30,9 @@ import (
 
 // RedisOption applies several options for the Redis client.
 type RedisOption struct {
+	// KeyPrefix gets prepended to all keys written to Redis. Truncate requires
+	// a KeyPrefix because it may only remove the keys of this cache and not
+	// the whole database.
 	KeyPrefix string
 }
 
@@ -190,9 +194,9 @@ func (w redisWrapper) Set(_ context.Context, keys []string, values [][]byte, exp
 	for i, key := range keys {
 		e := expirations[i].Seconds() // e = expires in x seconds
 		if e < 1 {
-			args = append(args, key, values[i])
+			args = append(args, w.keyPrefix+key, values[i])
 		} else {
-			if _, err2 := conn.Do("SETEX", key, e, values[i]); err2 != nil {
+			if _, err2 := conn.Do("SETEX", w.keyPrefix+key, e, values[i]); err2 != nil {
 				err = errors.Wrapf(err2, "[objcache] With key %q", key)
 				return
 			}
@@ -219,7 +223,7 @@ func (w redisWrapper) Get(_ context.Context, keys []string) (values [][]byte, er
 
 	if len(keys) == 1 {
 		var val []byte
-		val, err = redis.Bytes(conn.Do("GET", keys[0]))
+		val, err = redis.Bytes(conn.Do("GET", w.keyPrefix+keys[0]))
 		if err != nil {
 			if err == redis.ErrNil {
 				err = nil
@@ -232,7 +236,7 @@ func (w redisWrapper) Get(_ context.Context, keys []string) (values [][]byte, er
 		return
 	}
 
-	values, err = redis.ByteSlices(conn.Do("MGET", strSliceToIFaces(nil, keys)...))
+	values, err = redis.ByteSlices(conn.Do("MGET", w.prefixKeys(keys)...))
 	if err != nil {
 		err = errors.Wrapf(err, "[objcache] With keys %v", keys)
 		return
@@ -243,13 +247,12 @@ func (w redisWrapper) Get(_ context.Context, keys []string) (values [][]byte, er
 	return
 }
 
-func strSliceToIFaces(ret []interface{}, sl []string) []interface{} {
+// prefixKeys prepends the key prefix to all keys.
+func (w redisWrapper) prefixKeys(keys []string) []interface{} {
 	// TODO use a sync.Pool but write before hand appropriate concurrent running benchmarks
-	if ret == nil {
-		ret = make([]interface{}, 0, len(sl))
-	}
-	for _, s := range sl {
-		ret = append(ret, s)
+	ret := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, w.keyPrefix+k)
 	}
 	return ret
 }
@@ -261,17 +264,215 @@ func (w redisWrapper) Delete(_ context.Context, keys []string) (err error) {
 			err = err2
 		}
 	}()
-	if _, err = conn.Do("DEL", strSliceToIFaces(nil, keys)...); err != nil {
-		err = errors.Wrapf(err, "[objcache] With keys %v", keys)
+	return w.deleteWithTags(conn, keys)
+}
+
+// Truncate removes all keys with the key prefix including the tag index. The
+// database might be shared with other applications, hence Truncate never
+// flushes the database and returns a NotSupported error if no key prefix has
+// been set.
+func (w redisWrapper) Truncate(_ context.Context) (err error) {
+	if w.keyPrefix == "" {
+		return errors.NotSupported.Newf("[objcache] Redis Truncate requires a key prefix")
 	}
-	return
+	conn := w.Pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	return w.scan(conn, w.keyPrefix, func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		if _, err := conn.Do("DEL", redis.Args{}.AddFlat(keys)...); err != nil {
+			return errors.Wrapf(err, "[objcache] With prefix %q", w.keyPrefix)
+		}
+		return nil
+	})
 }
 
-func (w redisWrapper) Truncate(ctx context.Context) (err error) {
-	// TODO flush redis by key prefix
-	return nil
+// scan iterates over all keys starting with prefix and calls fn with each batch
+// of found keys. The keys contain the key prefix.
+func (w redisWrapper) scan(conn redis.Conn, prefix string, fn func(keys []string) error) error {
+	cursor := 0
+	for {
+		res, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisGlobEscaper.Replace(prefix)+"*", "COUNT", 500))
+		if err != nil {
+			return errors.Wrapf(err, "[objcache] With prefix %q", prefix)
+		}
+		var found []string
+		if _, err := redis.Scan(res, &cursor, &found); err != nil {
+			return errors.Wrapf(err, "[objcache] With prefix %q", prefix)
+		}
+		if err := fn(found); err != nil {
+			return errors.WithStack(err)
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// BackendStats returns the number of keys of the selected database via DBSIZE.
+// The number includes foreign keys and the keys of the tag index.
+func (w redisWrapper) BackendStats(_ context.Context) (bs BackendStats, err error) {
+	conn := w.Pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	if bs.Items, err = redis.Int64(conn.Do("DBSIZE")); err != nil {
+		err = errors.Wrap(err, "[objcache] Redis DBSIZE")
+	}
+	return bs, err
 }
 
 func (w redisWrapper) Close() error {
 	return w.Pool.Close()
 }
+
+const (
+	// redisTagPrefix prefixes the Redis sets which contain the keys of a tag.
+	redisTagPrefix = "objcache_tag:"
+	// redisKeyTagsPrefix prefixes the Redis sets which contain the tags of a
+	// key. These sets expire together with their key.
+	redisKeyTagsPrefix = "objcache_keytags:"
+)
+
+func (w redisWrapper) isIndexKey(key string) bool {
+	return strings.HasPrefix(key, w.keyPrefix+redisTagPrefix) || strings.HasPrefix(key, w.keyPrefix+redisKeyTagsPrefix)
+}
+
+// SetWithTags writes the keys and adds each key to the Redis sets of its tags.
+func (w redisWrapper) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) (err error) {
+	if err = w.Set(ctx, keys, values, expirations); err != nil {
+		return errors.WithStack(err)
+	}
+	conn := w.Pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	for i, key := range keys {
+		if i >= len(tags) || len(tags[i]) == 0 {
+			continue
+		}
+		ktKey := w.keyPrefix + redisKeyTagsPrefix + key
+		for _, tag := range tags[i] {
+			if err = conn.Send("SADD", w.keyPrefix+redisTagPrefix+tag, key); err != nil {
+				return errors.Wrapf(err, "[objcache] With key %q and tag %q", key, tag)
+			}
+		}
+		if err = conn.Send("SADD", redis.Args{}.Add(ktKey).AddFlat(tags[i])...); err != nil {
+			return errors.Wrapf(err, "[objcache] With key %q", key)
+		}
+		if e := int64(expirations[i].Seconds()); e >= 1 {
+			err = conn.Send("EXPIRE", ktKey, e)
+		} else {
+			err = conn.Send("PERSIST", ktKey)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "[objcache] With key %q", key)
+		}
+	}
+	if _, err = conn.Do(""); err != nil {
+		err = errors.Wrapf(err, "[objcache] With keys %v", keys)
+	}
+	return err
+}
+
+// deleteWithTags removes the keys and their tag associations.
+func (w redisWrapper) deleteWithTags(conn redis.Conn, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		ktKey := w.keyPrefix + redisKeyTagsPrefix + key
+		tags, err := redis.Strings(conn.Do("SMEMBERS", ktKey))
+		if err != nil {
+			return errors.Wrapf(err, "[objcache] With key %q", key)
+		}
+		for _, tag := range tags {
+			if err := conn.Send("SREM", w.keyPrefix+redisTagPrefix+tag, key); err != nil {
+				return errors.Wrapf(err, "[objcache] With key %q and tag %q", key, tag)
+			}
+		}
+		if err := conn.Send("DEL", w.keyPrefix+key, ktKey); err != nil {
+			return errors.Wrapf(err, "[objcache] With key %q", key)
+		}
+	}
+	if _, err := conn.Do(""); err != nil {
+		return errors.Wrapf(err, "[objcache] With keys %v", keys)
+	}
+	return nil
+}
+
+// DeleteByTag removes all keys of the tags. Keys which have already expired
+// might still be a member of a tag set, those get skipped.
+func (w redisWrapper) DeleteByTag(_ context.Context, tags []string) (err error) {
+	conn := w.Pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	for _, tag := range tags {
+		tagKey := w.keyPrefix + redisTagPrefix + tag
+		keys, err := redis.Strings(conn.Do("SMEMBERS", tagKey))
+		if err != nil {
+			return errors.Wrapf(err, "[objcache] With tag %q", tag)
+		}
+		var current []string
+		for _, key := range keys {
+			// the set of the key's tags expires together with the key.
+			ok, err := redis.Bool(conn.Do("SISMEMBER", w.keyPrefix+redisKeyTagsPrefix+key, tag))
+			if err != nil {
+				return errors.Wrapf(err, "[objcache] With key %q and tag %q", key, tag)
+			}
+			if ok {
+				current = append(current, key)
+			}
+		}
+		if err := w.deleteWithTags(conn, current); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := conn.Do("DEL", tagKey); err != nil {
+			return errors.Wrapf(err, "[objcache] With tag %q", tag)
+		}
+	}
+	return nil
+}
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// DeleteByPrefix scans for all keys with the prefixes and removes them
+// together with their tag associations.
+func (w redisWrapper) DeleteByPrefix(_ context.Context, prefixes []string) (err error) {
+	if err = validatePrefixes(prefixes); err != nil {
+		return errors.WithStack(err)
+	}
+	conn := w.Pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	for _, prefix := range prefixes {
+		err := w.scan(conn, w.keyPrefix+prefix, func(found []string) error {
+			keys := found[:0]
+			for _, key := range found {
+				if !w.isIndexKey(key) {
+					keys = append(keys, strings.TrimPrefix(key, w.keyPrefix))
+				}
+			}
+			return w.deleteWithTags(conn, keys)
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
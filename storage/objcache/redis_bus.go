@@ -0,0 +1,183 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build redis csall
+
+package objcache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisInvalidationChannel defines the default Redis pub/sub channel.
+const RedisInvalidationChannel = "objcache_invalidation"
+
+// RedisInvalidationBus transports InvalidationMessages via Redis pub/sub.
+type RedisInvalidationBus struct {
+	pool    *redis.Pool
+	channel string
+	// ReconnectDelay defines the waiting time after a subscription connection
+	// has been lost. Default one second.
+	ReconnectDelay time.Duration
+}
+
+// NewRedisInvalidationBus creates a new InvalidationBus which uses the Redis
+// pool for publishing and for the subscriptions. An empty channel falls back
+// to RedisInvalidationChannel. Each subscription uses its own connection.
+func NewRedisInvalidationBus(pool *redis.Pool, channel string) *RedisInvalidationBus {
+	if channel == "" {
+		channel = RedisInvalidationChannel
+	}
+	return &RedisInvalidationBus{
+		pool:           pool,
+		channel:        channel,
+		ReconnectDelay: time.Second,
+	}
+}
+
+// Publish sends the JSON encoded message to the channel.
+func (rb *RedisInvalidationBus) Publish(_ context.Context, msg InvalidationMessage) (err error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	conn := rb.pool.Get()
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = err2
+		}
+	}()
+	if _, err = conn.Do("PUBLISH", rb.channel, data); err != nil {
+		err = errors.Wrapf(err, "[objcache] RedisInvalidationBus.Publish to channel %q", rb.channel)
+	}
+	return err
+}
+
+// Subscribe subscribes to the channel and calls fn for each message. It
+// returns once the subscription has been confirmed. A lost connection gets
+// re-established in the background. Messages published while being
+// disconnected are lost, hence after each re-subscription fn receives a
+// message with Truncate set, so that the whole level1 cache gets evicted.
+// Messages which cannot be decoded get dropped.
+func (rb *RedisInvalidationBus) Subscribe(fn func(InvalidationMessage)) (func() error, error) {
+	rs := &redisSubscription{
+		bus:  rb,
+		fn:   fn,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	psc, err := rs.connect()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	go rs.run(psc)
+	return rs.close, nil
+}
+
+type redisSubscription struct {
+	bus  *RedisInvalidationBus
+	fn   func(InvalidationMessage)
+	mu   sync.Mutex
+	psc  redis.PubSubConn
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// connect subscribes and waits for the confirmation.
+func (rs *redisSubscription) connect() (redis.PubSubConn, error) {
+	psc := redis.PubSubConn{Conn: rs.bus.pool.Get()}
+	if err := psc.Subscribe(rs.bus.channel); err != nil {
+		_ = psc.Close()
+		return psc, errors.Wrapf(err, "[objcache] RedisInvalidationBus.Subscribe to channel %q", rs.bus.channel)
+	}
+	switch v := psc.Receive().(type) {
+	case redis.Subscription:
+	case error:
+		_ = psc.Close()
+		return psc, errors.Wrapf(v, "[objcache] RedisInvalidationBus.Subscribe to channel %q", rs.bus.channel)
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	select {
+	case <-rs.stop:
+		_ = psc.Close()
+		return psc, errors.Aborted.Newf("[objcache] RedisInvalidationBus subscription to channel %q has been closed", rs.bus.channel)
+	default:
+	}
+	rs.psc = psc
+	return psc, nil
+}
+
+func (rs *redisSubscription) run(psc redis.PubSubConn) {
+	defer close(rs.done)
+	for {
+		rs.receive(psc)
+		rs.mu.Lock() // close might still write to the connection
+		_ = psc.Close()
+		rs.mu.Unlock()
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-time.After(rs.bus.ReconnectDelay):
+			}
+			var err error
+			if psc, err = rs.connect(); err == nil {
+				break
+			}
+		}
+		rs.fn(InvalidationMessage{Truncate: true})
+	}
+}
+
+// receive reads messages until an error occurs or the subscription ends.
+func (rs *redisSubscription) receive(psc redis.PubSubConn) {
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			var msg InvalidationMessage
+			if err := json.Unmarshal(v.Data, &msg); err == nil {
+				rs.fn(msg)
+			}
+		case redis.Subscription:
+			if v.Count == 0 {
+				return
+			}
+		case error:
+			return
+		}
+	}
+}
+
+// close unsubscribes and waits until the receiving goroutine has stopped. A
+// broken connection gets closed instead.
+func (rs *redisSubscription) close() error {
+	rs.once.Do(func() {
+		close(rs.stop)
+		rs.mu.Lock()
+		if err := rs.psc.Unsubscribe(); err != nil {
+			_ = rs.psc.Close()
+		}
+		rs.mu.Unlock()
+		<-rs.done
+	})
+	return nil
+}
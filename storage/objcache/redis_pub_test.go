@@ -19,6 +19,7 @@ package objcache_test
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"testing"
 	"time"
 
@@ -117,7 +118,7 @@ func TestWithRedisURL_ConFailure(t *testing.T) {
 	}
 	for i, test := range dialErrors {
 		p, err := objcache.NewService(nil, objcache.NewRedisByURLClient(test.rawurl), newSrvOpt(JSONCodec{}))
-		if test.errBhf > 0 {
+		if test.errBhf != errors.NoKind {
 			assert.True(t, test.errBhf.Match(err), "Index %d Error %+v", i, err)
 			assert.Nil(t, p, "Index %d", i)
 		} else {
@@ -148,3 +149,110 @@ func TestWithRedisURLReal_Delete(t *testing.T) {
 	redConURL := lookupRedisEnv(t)
 	newTestServiceDelete(t, objcache.NewRedisByURLClient(redConURL))
 }
+
+func TestWithRedisURLMock_Invalidator(t *testing.T) {
+	mr := miniredis.NewMiniRedis()
+	assert.NoError(t, mr.Start())
+	defer mr.Close()
+	testInvalidatorConformance(t, objcache.NewRedisByURLClient(fmt.Sprintf("redis://%s/?db=2&key_prefix=objcache_", mr.Addr())))
+}
+
+func TestWithRedisURLReal_Invalidator(t *testing.T) {
+	testInvalidatorConformance(t, objcache.NewRedisByURLClient(withRedisKeyPrefix(t, lookupRedisEnv(t))))
+}
+
+func TestWithRedisURLMock_BackendStats(t *testing.T) {
+	mr := miniredis.NewMiniRedis()
+	assert.NoError(t, mr.Start())
+	defer mr.Close()
+	testBackendStats(t, objcache.NewRedisByURLClient(fmt.Sprintf("redis://%s/?db=2&key_prefix=objcache_", mr.Addr())))
+}
+
+// miniredis v2.5 does not support pub/sub, hence the level2 cache uses
+// miniredis and the nodes share the in-process bus.
+func TestWithRedisURLMock_InvalidationBus(t *testing.T) {
+	mr := miniredis.NewMiniRedis()
+	assert.NoError(t, mr.Start())
+	defer mr.Close()
+	bus := objcache.NewLocalInvalidationBus()
+	testInvalidationBus(t,
+		objcache.NewRedisByURLClient(fmt.Sprintf("redis://%s/?db=2&key_prefix=objcache_", mr.Addr())),
+		func() objcache.InvalidationBus { return bus },
+		func() {},
+	)
+}
+
+func TestWithRedisURLReal_InvalidationBus(t *testing.T) {
+	redConURL := lookupRedisEnv(t)
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) { return redis.DialURL(redConURL) },
+	}
+	defer pool.Close()
+	testInvalidationBus(t,
+		objcache.NewRedisByURLClient(withRedisKeyPrefix(t, redConURL)),
+		func() objcache.InvalidationBus { return objcache.NewRedisInvalidationBus(pool, "") },
+		func() { time.Sleep(50 * time.Millisecond) }, // pub/sub delivers asynchronously
+	)
+}
+
+// withRedisKeyPrefix adds a key prefix to the URL because Truncate requires it.
+func withRedisKeyPrefix(t testing.TB, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	assert.NoError(t, err)
+	q := u.Query()
+	q.Set("key_prefix", "objcache_test_")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestWithRedisURLMock_KeyPrefix(t *testing.T) {
+	mr := miniredis.NewMiniRedis()
+	assert.NoError(t, mr.Start())
+	defer mr.Close()
+	ctx := context.Background()
+	assert.NoError(t, mr.Set("foreign_key", "foreign"))
+
+	t.Run("Truncate without prefix", func(t *testing.T) {
+		st, err := objcache.NewRedisByURLClient(fmt.Sprintf("redis://%s/", mr.Addr()))()
+		assert.NoError(t, err)
+		defer func() { assert.NoError(t, st.Close()) }()
+
+		assert.NoError(t, st.Set(ctx, []string{"k1"}, [][]byte{[]byte("v1")}, []time.Duration{0}))
+		err = st.Truncate(ctx)
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+		assert.True(t, mr.Exists("k1"), "key k1 must still exist")
+		assert.True(t, mr.Exists("foreign_key"), "foreign key must still exist")
+		mr.Del("k1")
+	})
+
+	t.Run("Set Get Delete Truncate with prefix", func(t *testing.T) {
+		st, err := objcache.NewRedisByURLClient(fmt.Sprintf("redis://%s/?key_prefix=pfx_", mr.Addr()))()
+		assert.NoError(t, err)
+		defer func() { assert.NoError(t, st.Close()) }()
+		inv := st.(objcache.Invalidator)
+
+		assert.NoError(t, st.Set(ctx, []string{"k1", "k2"}, [][]byte{[]byte("v1"), []byte("v2")}, []time.Duration{0, time.Minute}))
+		assert.NoError(t, inv.SetWithTags(ctx, []string{"k3"}, [][]byte{[]byte("v3")}, []time.Duration{0}, [][]string{{"t1"}}))
+		assert.True(t, mr.Exists("pfx_k1"), "key pfx_k1 must exist")
+		assert.True(t, mr.Exists("pfx_k2"), "key pfx_k2 must exist")
+		assert.True(t, mr.Exists("pfx_k3"), "key pfx_k3 must exist")
+		assert.False(t, mr.Exists("k1"), "key k1 must not exist")
+
+		vals, err := st.Get(ctx, []string{"k1"})
+		assert.NoError(t, err)
+		assert.Exactly(t, [][]byte{[]byte("v1")}, vals)
+		vals, err = st.Get(ctx, []string{"k1", "k2", "k3"})
+		assert.NoError(t, err)
+		assert.Exactly(t, [][]byte{[]byte("v1"), []byte("v2"), []byte("v3")}, vals)
+
+		assert.NoError(t, st.Delete(ctx, []string{"k1"}))
+		assert.False(t, mr.Exists("pfx_k1"), "key pfx_k1 must be deleted")
+
+		assert.NoError(t, inv.DeleteByPrefix(ctx, []string{"k2"}))
+		assert.False(t, mr.Exists("pfx_k2"), "key pfx_k2 must be deleted")
+		assert.True(t, mr.Exists("pfx_k3"), "key pfx_k3 must exist")
+
+		assert.NoError(t, st.Truncate(ctx))
+		assert.Exactly(t, []string{"foreign_key"}, mr.Keys())
+	})
+}
@@ -16,4 +16,110 @@
 
 package objcache
 
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
 var _ Storager = (*redisWrapper)(nil)
+
+// fakePubSubConn answers SUBSCRIBE, UNSUBSCRIBE and ECHO commands and returns
+// the replies which a test sends to the replies channel.
+type fakePubSubConn struct {
+	replies chan interface{}
+	once    sync.Once
+	closed  chan struct{}
+}
+
+func newFakePubSubConn() *fakePubSubConn {
+	return &fakePubSubConn{
+		replies: make(chan interface{}, 10),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *fakePubSubConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+func (c *fakePubSubConn) Err() error                                     { return nil }
+func (c *fakePubSubConn) Do(string, ...interface{}) (interface{}, error) { return nil, nil }
+func (c *fakePubSubConn) Flush() error                                   { return nil }
+
+func (c *fakePubSubConn) Send(cmd string, args ...interface{}) error {
+	switch cmd {
+	case "SUBSCRIBE":
+		c.replies <- []interface{}{[]byte("subscribe"), []byte(args[0].(string)), int64(1)}
+	case "UNSUBSCRIBE":
+		c.replies <- []interface{}{[]byte("unsubscribe"), []byte(RedisInvalidationChannel), int64(0)}
+	case "ECHO": // the pool reads until the sentinel when it releases a subscribed connection
+		c.replies <- args[0]
+	}
+	return nil
+}
+
+func (c *fakePubSubConn) Receive() (interface{}, error) {
+	select {
+	case r := <-c.replies:
+		if err, ok := r.(error); ok {
+			return nil, err
+		}
+		return r, nil
+	case <-c.closed:
+		return nil, errors.New("use of closed connection")
+	}
+}
+
+func TestRedisInvalidationBus_TruncateLevel1AfterReconnect(t *testing.T) {
+	var mu sync.Mutex
+	var conns []*fakePubSubConn
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			c := newFakePubSubConn()
+			conns = append(conns, c)
+			return c, nil
+		},
+	}
+	bus := NewRedisInvalidationBus(pool, "")
+	bus.ReconnectDelay = time.Millisecond
+
+	ctx := context.Background()
+	srv, err := NewService(NewCacheSimpleInmemory, NewCacheSimpleInmemory, &ServiceOptions{
+		Codec:           fetchGobCodec{},
+		InvalidationBus: bus,
+	})
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	assert.NoError(t, srv.Set(ctx, "k", "v", 0))
+	vals, err := srv.level1.Get(ctx, []string{"k"})
+	assert.NoError(t, err)
+	assert.NotNil(t, vals[0], "level1 must contain the key before the connection gets lost")
+
+	mu.Lock()
+	conns[0].replies <- errors.New("connection reset by peer")
+	mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		vals, err = srv.level1.Get(ctx, []string{"k"})
+		assert.NoError(t, err)
+		if vals[0] == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, vals[0], "level1 must be truncated after the re-subscription")
+
+	vals, err = srv.level2.Get(ctx, []string{"k"})
+	assert.NoError(t, err)
+	assert.NotNil(t, vals[0], "level2 must still contain the key")
+}
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sync/singleflight"
 	"github.com/weiwolves/pkg/util/bufferpool"
 )
 
@@ -65,11 +66,16 @@ type Decoder interface {
 	Decode(dst interface{}) error
 }
 
-func writeMarshal(buf *bytes.Buffer, m func() ([]byte, error)) error {
+// writeMarshal writes the marshaled data and applies the compression or
+// encryption of the wrapper codecs.
+func writeMarshal(c Codecer, buf *bytes.Buffer, m func() ([]byte, error)) error {
 	data, err := m()
 	if err != nil {
 		return err
 	}
+	if data, err = packBytes(c, data); err != nil {
+		return err
+	}
 	_, err = buf.Write(data)
 	return err
 }
@@ -77,15 +83,15 @@ func writeMarshal(buf *bytes.Buffer, m func() ([]byte, error)) error {
 func encodeOne(c Codecer, buf *bytes.Buffer, key string, src interface{}) (err error) {
 	switch ot := src.(type) {
 	case marshaler:
-		if err = writeMarshal(buf, ot.Marshal); err != nil {
+		if err = writeMarshal(c, buf, ot.Marshal); err != nil {
 			return errors.Wrapf(err, "[objcache] With key %q and dst type %T", key, src)
 		}
 	case encoding.TextMarshaler:
-		if err = writeMarshal(buf, ot.MarshalText); err != nil {
+		if err = writeMarshal(c, buf, ot.MarshalText); err != nil {
 			return errors.Wrapf(err, "[objcache] With key %q and dst type %T", key, src)
 		}
 	case encoding.BinaryMarshaler:
-		if err = writeMarshal(buf, ot.MarshalBinary); err != nil {
+		if err = writeMarshal(c, buf, ot.MarshalBinary); err != nil {
 			return errors.Wrapf(err, "[objcache] With key %q and dst type %T", key, src)
 		}
 	default:
@@ -110,6 +116,12 @@ func encodeOne(c Codecer, buf *bytes.Buffer, key string, src interface{}) (err e
 }
 
 func decodeOne(c Codecer, data []byte, key string, dst interface{}) (err error) {
+	switch dst.(type) {
+	case unmarshaler, encoding.TextUnmarshaler, encoding.BinaryUnmarshaler:
+		if data, err = unpackBytes(c, data); err != nil {
+			return errors.Wrapf(err, "[objcache] With key %q and dst type %T", key, dst)
+		}
+	}
 	switch ot := dst.(type) {
 	case unmarshaler:
 		if err = ot.Unmarshal(data); err != nil {
@@ -146,6 +158,22 @@ func decodeOne(c Codecer, data []byte, key string, dst interface{}) (err error)
 	return err
 }
 
+// encode encodes one item and updates the statistics.
+func (tr *Service) encode(buf *bytes.Buffer, key string, src interface{}) error {
+	start := now()
+	err := encodeOne(tr.so.Codec, buf, key, src)
+	tr.stats.countEncode(1, start, err)
+	return err
+}
+
+// decode decodes one item and updates the statistics.
+func (tr *Service) decode(data []byte, key string, dst interface{}) error {
+	start := now()
+	err := decodeOne(tr.so.Codec, data, key, dst)
+	tr.stats.countDecode(1, start, err)
+	return err
+}
+
 // Encode encodes all items to their byte slice representation. Returns two
 // slices whose indexes match to the other. The data might be appended to the
 // optional arguments `keys` and `values`.
@@ -190,6 +218,19 @@ type Service struct {
 	level2            Storager
 	defaultExpiration time.Duration // in seconds
 	rawItemsPool      sync.Pool
+	// fetchGroup merges concurrent FetchFn calls for the same key.
+	fetchGroup singleflight.Group
+	// fetchRefresh tracks the running background refreshes.
+	fetchRefresh sync.WaitGroup
+	// refreshMu protects refreshKeys and closed.
+	refreshMu sync.Mutex
+	// refreshKeys contains the keys with a running background refresh.
+	refreshKeys map[string]struct{}
+	// closed gets set in Close to stop starting new background refreshes.
+	closed bool
+	// unsubscribe stops receiving messages from the InvalidationBus.
+	unsubscribe func() error
+	stats       serviceCounters
 }
 
 func (tr *Service) poolGetRawItems() *rawItems {
@@ -234,10 +275,20 @@ func NewService(level1, level2 NewStorageFn, so *ServiceOptions) (_ *Service, er
 	if s.level2, err = level2(); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if s.so.InvalidationBus != nil {
+		if s.so.NodeID == "" {
+			s.so.NodeID = randomNodeID()
+		}
+		if s.level1 != nil {
+			if s.unsubscribe, err = s.so.InvalidationBus.Subscribe(s.evictLevel1); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
 
-	if so != nil && len(so.PrimeObjects) > 0 {
-		so.Codec = newPooledCodec(so.Codec, so.PrimeObjects...)
-		so.PrimeObjects = nil
+	if len(s.so.PrimeObjects) > 0 {
+		s.so.Codec = newPrimedCodec(s.so.Codec, s.so.PrimeObjects...)
+		s.so.PrimeObjects = nil
 	}
 
 	return s, nil
@@ -264,23 +315,17 @@ func (tr *Service) Set(ctx context.Context, key string, src interface{}, expires
 	}
 
 	var buf bytes.Buffer
-	if err := encodeOne(tr.so.Codec, &buf, key, src); err != nil {
+	if err := tr.encode(&buf, key, src); err != nil {
 		return errors.WithStack(err)
 	}
 	ri.keys = append(ri.keys, key)
 	ri.values = append(ri.values, buf.Bytes())
 	ri.expires = append(ri.expires, expires)
 
-	if tr.level1 != nil {
-		if err := tr.level1.Set(ctx, ri.keys, ri.values, ri.expires); err != nil {
-			return errors.WithStack(err)
-		}
-	}
-
-	if err := tr.level2.Set(ctx, ri.keys, ri.values, ri.expires); err != nil {
+	if err := tr.setLevels(ctx, ri.keys, ri.values, ri.expires); err != nil {
 		return errors.WithStack(err)
 	}
-	return nil
+	return tr.publish(ctx, InvalidationMessage{Keys: ri.keys})
 }
 
 // SetMulti allows a cache to write several entities at once. For example using
@@ -293,20 +338,17 @@ func (tr *Service) SetMulti(ctx context.Context, keys []string, src []interface{
 	ri := tr.poolGetRawItems()
 	defer tr.poolPutRawItems(ri)
 
+	start := now()
 	ri, err := encodeAll(tr.so.Codec, ri, tr.defaultExpiration, keys, src, expires)
+	tr.stats.countEncode(len(keys), start, err)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if tr.level1 != nil {
-		if err := tr.level1.Set(ctx, ri.keys, ri.values, ri.expires); err != nil {
-			return errors.WithStack(err)
-		}
-	}
-	if err := tr.level2.Set(ctx, ri.keys, ri.values, ri.expires); err != nil {
+	if err := tr.setLevels(ctx, ri.keys, ri.values, ri.expires); err != nil {
 		return errors.WithStack(err)
 	}
-	return nil
+	return tr.publish(ctx, InvalidationMessage{Keys: ri.keys})
 }
 
 // unmarshaler is the interface representing objects that can
@@ -338,19 +380,20 @@ func (tr *Service) Get(ctx context.Context, key string, dst interface{}) (err er
 	var vals [][]byte
 	if tr.level1 != nil {
 		vals, err = tr.level1.Get(ctx, ri.keys)
+		tr.stats.level1.countGet(vals, err)
 		if err != nil {
 			return errors.Wrapf(err, "[objcache] Level1 with keys %v", ri.keys)
 		}
 	}
-	if lv := len(vals); lv == 0 {
+	if len(vals) == 0 || vals[0] == nil { // level1 miss
 		vals, err = tr.level2.Get(ctx, ri.keys)
+		tr.stats.level2.countGet(vals, err)
 		if err != nil {
 			return errors.Wrapf(err, "[objcache] Level2 with keys %v", ri.keys)
 		}
 	}
 	if err == nil {
-		idst := [1]interface{}{dst}
-		if err2 := decodeAll(tr.so.Codec, vals, ri.keys, idst[:]); err2 != nil {
+		if err2 := tr.decode(vals[0], key, dst); err2 != nil {
 			return errors.WithStack(err2)
 		}
 	}
@@ -366,27 +409,68 @@ func (tr *Service) GetMulti(ctx context.Context, keys []string, dst []interface{
 	var vals [][]byte
 	if tr.level1 != nil {
 		vals, err = tr.level1.Get(ctx, keys)
+		tr.stats.level1.countGet(vals, err)
 		if err != nil && !errors.NotFound.Match(err) {
 			return errors.Wrapf(err, "[objcache] Level1 with keys %v", keys)
 		}
 	}
 	if lv := len(vals); lv == 0 {
 		vals, err = tr.level2.Get(ctx, keys)
+		tr.stats.level2.countGet(vals, err)
 		if err != nil && !errors.NotFound.Match(err) {
 			return errors.Wrapf(err, "[objcache] Level2 with keys %v", keys)
 		}
+	} else if missing, idx := missingKeys(keys, vals); len(missing) > 0 {
+		var vals2 [][]byte
+		vals2, err = tr.level2.Get(ctx, missing)
+		tr.stats.level2.countGet(vals2, err)
+		if err != nil && !errors.NotFound.Match(err) {
+			return errors.Wrapf(err, "[objcache] Level2 with keys %v", missing)
+		}
+		for i, v := range vals2 {
+			vals[idx[i]] = v
+		}
 	}
 	if err != nil && errors.NotFound.Match(err) {
 		return errors.WithStack(err)
 	}
 
-	if err := decodeAll(tr.so.Codec, vals, keys, dst); err != nil {
+	start := now()
+	err = decodeAll(tr.so.Codec, vals, keys, dst)
+	tr.stats.countDecode(len(keys), start, err)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
 
+// missingKeys returns the keys, and their index, which have not been found in
+// the level1 cache.
+func missingKeys(keys []string, vals [][]byte) (missing []string, idx []int) {
+	for i, v := range vals {
+		if v == nil && i < len(keys) {
+			missing = append(missing, keys[i])
+			idx = append(idx, i)
+		}
+	}
+	return missing, idx
+}
+
+// setLevels writes the raw items to level1, if available, and to level2.
+func (tr *Service) setLevels(ctx context.Context, keys []string, values [][]byte, expires []time.Duration) error {
+	if tr.level1 != nil {
+		err := tr.level1.Set(ctx, keys, values, expires)
+		tr.stats.level1.countSet(values, err)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	err := tr.level2.Set(ctx, keys, values, expires)
+	tr.stats.level2.countSet(values, err)
+	return errors.WithStack(err)
+}
+
 // Truncate truncates all caches.
 func (tr *Service) Truncate(ctx context.Context) (err error) {
 	if tr.level1 != nil {
@@ -397,25 +481,38 @@ func (tr *Service) Truncate(ctx context.Context) (err error) {
 	if err := tr.level2.Truncate(ctx); err != nil {
 		return errors.WithStack(err)
 	}
-
-	return nil
+	return tr.publish(ctx, InvalidationMessage{Truncate: true})
 }
 
 // Delete removes keys from the storage.
 func (tr *Service) Delete(ctx context.Context, key ...string) error {
 	if tr.level1 != nil {
-		if err := tr.level1.Delete(ctx, key); err != nil {
+		err := tr.level1.Delete(ctx, key)
+		tr.stats.level1.countDelete(len(key), err)
+		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
-	if err := tr.level2.Delete(ctx, key); err != nil {
+	err := tr.level2.Delete(ctx, key)
+	tr.stats.level2.countDelete(len(key), err)
+	if err != nil {
 		return errors.WithStack(err)
 	}
-	return nil
+	return tr.publish(ctx, InvalidationMessage{Keys: key})
 }
 
-// Close closes the underlying storage engines.
+// Close waits for running background refreshes, unsubscribes from the
+// InvalidationBus and closes the underlying storage engines.
 func (tr *Service) Close() error {
+	tr.refreshMu.Lock()
+	tr.closed = true
+	tr.refreshMu.Unlock()
+	tr.fetchRefresh.Wait()
+	if tr.unsubscribe != nil {
+		if err := tr.unsubscribe(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	if tr.level1 != nil {
 		if err := tr.level1.Close(); err != nil {
 			return errors.WithStack(err)
@@ -0,0 +1,229 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// StatsReporter gets implemented by Storager backends which can report
+// statistics about their content.
+type StatsReporter interface {
+	BackendStats(ctx context.Context) (BackendStats, error)
+}
+
+// BackendStats contains the statistics reported by a Storager backend. A
+// field is zero if the backend does not support it.
+type BackendStats struct {
+	// Items contains the number of stored keys.
+	Items int64 `json:"items"`
+	// Size contains the total size of all values in bytes, or the number of
+	// objects if the backend tracks its capacity by object count.
+	Size int64 `json:"size"`
+	// Capacity contains the maximum Size of the backend.
+	Capacity  int64 `json:"capacity"`
+	Evictions int64 `json:"evictions"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+}
+
+// LevelStats contains the counters of one cache level, collected by the
+// Service.
+type LevelStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Sets    uint64 `json:"sets"`
+	Deletes uint64 `json:"deletes"`
+	Errors  uint64 `json:"errors"`
+	// BytesWritten sums up the length of all values written to the level.
+	BytesWritten uint64 `json:"bytes_written"`
+	// Backend is nil if the backend does not implement StatsReporter.
+	Backend *BackendStats `json:"backend,omitempty"`
+}
+
+// Stats contains a snapshot of the statistics of a Service.
+type Stats struct {
+	// Level1 is nil if the Service runs without level1 cache.
+	Level1         *LevelStats   `json:"level1,omitempty"`
+	Level2         LevelStats    `json:"level2"`
+	Encodes        uint64        `json:"encodes"`
+	Decodes        uint64        `json:"decodes"`
+	EncodeErrors   uint64        `json:"encode_errors"`
+	DecodeErrors   uint64        `json:"decode_errors"`
+	EncodeDuration time.Duration `json:"encode_duration"`
+	DecodeDuration time.Duration `json:"decode_duration"`
+}
+
+type levelCounters struct {
+	hits, misses, sets, deletes, errors, bytesWritten uint64
+}
+
+func (lc *levelCounters) countGet(values [][]byte, err error) {
+	if err != nil && !errors.NotFound.Match(err) {
+		atomic.AddUint64(&lc.errors, 1)
+		return
+	}
+	var hits uint64
+	for _, v := range values {
+		if v != nil {
+			hits++
+		}
+	}
+	atomic.AddUint64(&lc.hits, hits)
+	atomic.AddUint64(&lc.misses, uint64(len(values))-hits)
+}
+
+func (lc *levelCounters) countSet(values [][]byte, err error) {
+	if err != nil {
+		atomic.AddUint64(&lc.errors, 1)
+		return
+	}
+	var n uint64
+	for _, v := range values {
+		n += uint64(len(v))
+	}
+	atomic.AddUint64(&lc.sets, uint64(len(values)))
+	atomic.AddUint64(&lc.bytesWritten, n)
+}
+
+func (lc *levelCounters) countDelete(keys int, err error) {
+	if err != nil {
+		atomic.AddUint64(&lc.errors, 1)
+		return
+	}
+	atomic.AddUint64(&lc.deletes, uint64(keys))
+}
+
+func (lc *levelCounters) snapshot() LevelStats {
+	return LevelStats{
+		Hits:         atomic.LoadUint64(&lc.hits),
+		Misses:       atomic.LoadUint64(&lc.misses),
+		Sets:         atomic.LoadUint64(&lc.sets),
+		Deletes:      atomic.LoadUint64(&lc.deletes),
+		Errors:       atomic.LoadUint64(&lc.errors),
+		BytesWritten: atomic.LoadUint64(&lc.bytesWritten),
+	}
+}
+
+type serviceCounters struct {
+	level1, level2             levelCounters
+	encodes, decodes           uint64
+	encodeErrors, decodeErrors uint64
+	encodeNanos, decodeNanos   uint64
+}
+
+func (sc *serviceCounters) countEncode(items int, start time.Time, err error) {
+	if err != nil {
+		atomic.AddUint64(&sc.encodeErrors, 1)
+	}
+	atomic.AddUint64(&sc.encodes, uint64(items))
+	atomic.AddUint64(&sc.encodeNanos, uint64(now().Sub(start)))
+}
+
+func (sc *serviceCounters) countDecode(items int, start time.Time, err error) {
+	if err != nil {
+		atomic.AddUint64(&sc.decodeErrors, 1)
+	}
+	atomic.AddUint64(&sc.decodes, uint64(items))
+	atomic.AddUint64(&sc.decodeNanos, uint64(now().Sub(start)))
+}
+
+func backendStats(ctx context.Context, st Storager) (*BackendStats, error) {
+	sr, ok := st.(StatsReporter)
+	if !ok {
+		return nil, nil
+	}
+	bs, err := sr.BackendStats(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[objcache] BackendStats of %T", st)
+	}
+	return &bs, nil
+}
+
+// Stats returns a snapshot of the counters of the Service and the statistics
+// of the backends which implement the StatsReporter interface. The counters
+// start with the creation of the Service.
+func (tr *Service) Stats(ctx context.Context) (s Stats, err error) {
+	s = Stats{
+		Level2:         tr.stats.level2.snapshot(),
+		Encodes:        atomic.LoadUint64(&tr.stats.encodes),
+		Decodes:        atomic.LoadUint64(&tr.stats.decodes),
+		EncodeErrors:   atomic.LoadUint64(&tr.stats.encodeErrors),
+		DecodeErrors:   atomic.LoadUint64(&tr.stats.decodeErrors),
+		EncodeDuration: time.Duration(atomic.LoadUint64(&tr.stats.encodeNanos)),
+		DecodeDuration: time.Duration(atomic.LoadUint64(&tr.stats.decodeNanos)),
+	}
+	if tr.level1 != nil {
+		l1 := tr.stats.level1.snapshot()
+		if l1.Backend, err = backendStats(ctx, tr.level1); err != nil {
+			return s, errors.WithStack(err)
+		}
+		s.Level1 = &l1
+	}
+	if s.Level2.Backend, err = backendStats(ctx, tr.level2); err != nil {
+		return s, errors.WithStack(err)
+	}
+	return s, nil
+}
+
+// KeyInfo describes where a key has been found and contains its raw, encoded
+// value.
+type KeyInfo struct {
+	Key      string `json:"key"`
+	InLevel1 bool   `json:"in_level1"`
+	InLevel2 bool   `json:"in_level2"`
+	// Size contains the length of the raw value.
+	Size int `json:"size"`
+	// Value contains the raw value of level1, or of level2 if level1 does not
+	// contain the key.
+	Value []byte `json:"-"`
+}
+
+// Inspect looks up the key in both levels without decoding the value and
+// without touching the Service statistics. It returns an error with kind
+// NotFound if none of the levels contains the key.
+func (tr *Service) Inspect(ctx context.Context, key string) (ki KeyInfo, err error) {
+	ki.Key = key
+	keys := [1]string{key}
+	if tr.level1 != nil {
+		vals, err := tr.level1.Get(ctx, keys[:])
+		if err != nil && !errors.NotFound.Match(err) {
+			return ki, errors.Wrapf(err, "[objcache] Level1 with key %q", key)
+		}
+		if len(vals) == 1 && vals[0] != nil {
+			ki.InLevel1 = true
+			ki.Value = vals[0]
+		}
+	}
+	vals, err := tr.level2.Get(ctx, keys[:])
+	if err != nil && !errors.NotFound.Match(err) {
+		return ki, errors.Wrapf(err, "[objcache] Level2 with key %q", key)
+	}
+	if len(vals) == 1 && vals[0] != nil {
+		ki.InLevel2 = true
+		if ki.Value == nil {
+			ki.Value = vals[0]
+		}
+	}
+	if !ki.InLevel1 && !ki.InLevel2 {
+		return ki, errors.NotFound.Newf("[objcache] Key %q not found", key)
+	}
+	ki.Size = len(ki.Value)
+	return ki, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestService_Stats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("two levels", func(t *testing.T) {
+		p, err := objcache.NewService(objcache.NewLRU(nil), objcache.NewCacheSimpleInmemory, newSrvOpt(JSONCodec{}))
+		assert.NoError(t, err)
+		defer func() { assert.NoError(t, p.Close()) }()
+
+		assert.NoError(t, p.Set(ctx, "k1", "v1", 0))
+		assert.NoError(t, p.SetMulti(ctx, []string{"k2", "k3"}, []interface{}{"v2", "v3"}, nil))
+		assert.NoError(t, p.Delete(ctx, "k3"))
+
+		var v string
+		assert.NoError(t, p.Get(ctx, "k1", &v))
+		assert.NoError(t, p.Get(ctx, "k4", &v))
+		v2, v4 := "", ""
+		assert.NoError(t, p.GetMulti(ctx, []string{"k2", "k4"}, []interface{}{&v2, &v4}))
+
+		s, err := p.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(3), s.Encodes)
+		assert.Exactly(t, uint64(4), s.Decodes)
+		assert.Exactly(t, uint64(0), s.EncodeErrors)
+
+		assert.Exactly(t, objcache.LevelStats{
+			Hits: 2, Misses: 2, Sets: 3, Deletes: 1, BytesWritten: 15,
+			Backend: &objcache.BackendStats{Items: 2, Size: 2, Capacity: 5000, Hits: 2, Misses: 2},
+		}, *s.Level1)
+		assert.Exactly(t, objcache.LevelStats{
+			Hits: 0, Misses: 2, Sets: 3, Deletes: 1, BytesWritten: 15,
+			Backend: &objcache.BackendStats{Items: 2, Size: 10},
+		}, s.Level2)
+	})
+
+	t.Run("errors and without level1", func(t *testing.T) {
+		p, err := objcache.NewService(nil, objcache.NewBlackHoleClient(errors.ConnectionFailed.Newf("Ups")), newSrvOpt(JSONCodec{}))
+		assert.NoError(t, err)
+
+		var v string
+		assert.Error(t, p.Get(ctx, "k1", &v))
+		assert.Error(t, p.Set(ctx, "k1", "v1", time.Minute))
+		assert.Error(t, p.Set(ctx, "k1", make(chan int), time.Minute))
+
+		s, err := p.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, s.Level1)
+		assert.Exactly(t, objcache.LevelStats{Errors: 2}, s.Level2)
+		assert.Exactly(t, uint64(2), s.Encodes)
+		assert.Exactly(t, uint64(1), s.EncodeErrors)
+	})
+}
+
+func TestService_Inspect(t *testing.T) {
+	ctx := context.Background()
+	level2 := sharedStorage(t, objcache.NewCacheSimpleInmemory)
+	p, err := objcache.NewService(objcache.NewLRU(nil), level2, newSrvOpt(JSONCodec{}))
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, p.Close()) }()
+
+	assert.NoError(t, p.Set(ctx, "k1", "v1", 0))
+	ki, err := p.Inspect(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Exactly(t, objcache.KeyInfo{Key: "k1", InLevel1: true, InLevel2: true, Size: 5, Value: []byte("\"v1\"\n")}, ki)
+
+	st, _ := level2()
+	assert.NoError(t, st.Set(ctx, []string{"k2"}, [][]byte{[]byte("raw")}, nil))
+	ki, err = p.Inspect(ctx, "k2")
+	assert.NoError(t, err)
+	assert.Exactly(t, objcache.KeyInfo{Key: "k2", InLevel2: true, Size: 3, Value: []byte("raw")}, ki)
+
+	_, err = p.Inspect(ctx, "k3")
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+
+	s, err := p.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint64(0), s.Level1.Hits+s.Level1.Misses+s.Level2.Hits+s.Level2.Misses, "Inspect must not count")
+}
+
+// testBackendStats writes three keys, deletes one and verifies the number of
+// items reported by the backend. Each backend test file calls it.
+func testBackendStats(t *testing.T, newStorage objcache.NewStorageFn) objcache.BackendStats {
+	ctx := context.Background()
+	st, err := newStorage()
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, st.Close()) }()
+	assert.NoError(t, st.Truncate(ctx))
+
+	sr, ok := st.(objcache.StatsReporter)
+	if !ok {
+		t.Fatalf("%T does not implement objcache.StatsReporter", st)
+	}
+	assert.NoError(t, st.Set(ctx, []string{"k1", "k2", "k3"}, [][]byte{[]byte("v1"), []byte("v2"), []byte("v3")}, []time.Duration{0, 0, 0}))
+	assert.NoError(t, st.Delete(ctx, []string{"k2"}))
+
+	bs, err := sr.BackendStats(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, int64(2), bs.Items)
+	return bs
+}
+
+func TestNewCacheSimpleInmemory_BackendStats(t *testing.T) {
+	bs := testBackendStats(t, objcache.NewCacheSimpleInmemory)
+	assert.Exactly(t, int64(4), bs.Size)
+}
+
+func TestNewLRU_BackendStats(t *testing.T) {
+	bs := testBackendStats(t, objcache.NewLRU(&objcache.LRUOptions{TrackBySize: true, Capacity: 1024}))
+	assert.Exactly(t, int64(4), bs.Size)
+	assert.Exactly(t, int64(1024), bs.Capacity)
+}
@@ -0,0 +1,164 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/weiwolves/pkg/storage/tinylfu"
+)
+
+// TinyLFUOptions allows to track the cache items either by object count or
+// total size in bytes. If tracking by `TrackBySize` gets enabled then
+// `Capacity` must have the value in bytes. Default 64MB.
+type TinyLFUOptions struct {
+	tinylfu.Options // default Capacity 5000 objects
+	TrackBySize     bool
+	// Cache can be set to share a tinylfu.Cache, then Options get ignored.
+	Cache *tinylfu.Cache
+}
+
+// tinyLFUCache uses a W-TinyLFU cache. It is safe for concurrent access.
+type tinyLFUCache struct {
+	trackBySize bool
+	c           *tinylfu.Cache
+	idx         *tagIndex
+}
+
+// NewTinyLFU creates a new W-TinyLFU Storage which resists scans better than
+// the LRU. Expirations are supported. Argument `o` can be nil, if so default
+// values get applied.
+func NewTinyLFU(o *TinyLFUOptions) NewStorageFn {
+	if o == nil {
+		o = &TinyLFUOptions{}
+	}
+	if o.Capacity == 0 {
+		o.Capacity = 5000 // objects
+		if o.TrackBySize {
+			o.Capacity = 1 << 26 // 64MB
+		}
+	}
+	if o.Cache == nil {
+		o.Cache = tinylfu.NewWithOptions(o.Options)
+	}
+	return func() (Storager, error) {
+		return tinyLFUCache{
+			trackBySize: o.TrackBySize,
+			c:           o.Cache,
+			idx:         newTagIndex(false),
+		}, nil
+	}
+}
+
+func (c tinyLFUCache) Set(_ context.Context, keys []string, values [][]byte, expirations []time.Duration) (err error) {
+	for i, key := range keys {
+		var v tinylfu.Value = itemByCount(values[i])
+		if c.trackBySize {
+			v = itemBySize(values[i])
+		}
+		var e time.Duration
+		if len(expirations) > 0 {
+			e = expirations[i]
+		}
+		c.c.SetWithTTL(key, v, e)
+	}
+	return nil
+}
+
+func (c tinyLFUCache) Get(_ context.Context, keys []string) (values [][]byte, err error) {
+	for _, key := range keys {
+		itm, ok := c.c.Get(key)
+		switch {
+		case !ok:
+			values = append(values, nil)
+		case c.trackBySize:
+			values = append(values, []byte(itm.(itemBySize)))
+		default:
+			values = append(values, []byte(itm.(itemByCount)))
+		}
+	}
+	return
+}
+
+func (c tinyLFUCache) Truncate(_ context.Context) (err error) {
+	c.c.Clear()
+	c.idx.reset()
+	return nil
+}
+
+func (c tinyLFUCache) Delete(_ context.Context, keys []string) (err error) {
+	for _, key := range keys {
+		c.c.Delete(key)
+	}
+	c.idx.removeKeys(keys)
+	return nil
+}
+
+// SetWithTags writes the keys and assigns the tags in an in-memory index.
+// Evicted keys get pruned from the index once it grows too large.
+func (c tinyLFUCache) SetWithTags(ctx context.Context, keys []string, values [][]byte, expirations []time.Duration, tags [][]string) error {
+	if err := c.Set(ctx, keys, values, expirations); err != nil {
+		return err
+	}
+	c.idx.add(keys, tags)
+	c.idx.prune(int(c.c.Length()), func(key string) bool {
+		_, ok := c.c.Peek(key)
+		return ok
+	})
+	return nil
+}
+
+func (c tinyLFUCache) DeleteByTag(_ context.Context, tags []string) error {
+	for _, key := range c.idx.keysByTags(tags) {
+		c.c.Delete(key)
+	}
+	return nil
+}
+
+func (c tinyLFUCache) DeleteByPrefix(ctx context.Context, prefixes []string) error {
+	if err := validatePrefixes(prefixes); err != nil {
+		return err
+	}
+	var keys []string
+	for _, key := range c.c.Keys() {
+		if hasAnyPrefix(key, prefixes) {
+			keys = append(keys, key)
+		}
+	}
+	return c.Delete(ctx, keys)
+}
+
+// BackendStats returns the statistics of the underlying tinylfu.Cache. Size
+// and Capacity contain bytes if TrackBySize has been enabled, otherwise the
+// number of objects.
+func (c tinyLFUCache) BackendStats(_ context.Context) (BackendStats, error) {
+	l, s, cp, e, _ := c.c.Stats()
+	h, m := c.c.HitsMisses()
+	return BackendStats{
+		Items:     l,
+		Size:      s,
+		Capacity:  cp,
+		Evictions: e,
+		Hits:      h,
+		Misses:    m,
+	}, nil
+}
+
+func (c tinyLFUCache) Close() error {
+	c.c.Clear()
+	c.idx.reset()
+	return nil
+}
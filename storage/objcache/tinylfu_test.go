@@ -0,0 +1,62 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weiwolves/pkg/storage/objcache"
+	"github.com/weiwolves/pkg/storage/tinylfu"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestNewTinyLFU_Delete(t *testing.T) {
+	newTestServiceDelete(t, objcache.NewTinyLFU(nil))
+}
+
+func TestNewTinyLFU_Expires(t *testing.T) {
+	testExpiration(t, func() {
+		time.Sleep(time.Second * 2)
+	}, objcache.NewTinyLFU(nil), newSrvOpt(JSONCodec{}))
+}
+
+func TestNewTinyLFU_ComplexParallel(t *testing.T) {
+	t.Run("gob", func(t *testing.T) {
+		newServiceComplexParallelTest(t, objcache.NewTinyLFU(nil), nil)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		newServiceComplexParallelTest(t, objcache.NewTinyLFU(&objcache.TinyLFUOptions{
+			TrackBySize: true,
+			Options:     tinylfu.Options{Capacity: 1 << 20},
+		}), &objcache.ServiceOptions{
+			Codec: JSONCodec{},
+		})
+	})
+}
+
+func TestNewTinyLFU_Invalidator(t *testing.T) {
+	testInvalidatorConformance(t, objcache.NewTinyLFU(nil))
+}
+
+func TestNewTinyLFU_BackendStats(t *testing.T) {
+	bs := testBackendStats(t, objcache.NewTinyLFU(&objcache.TinyLFUOptions{
+		TrackBySize: true,
+		Options:     tinylfu.Options{Capacity: 1024},
+	}))
+	assert.Exactly(t, int64(4), bs.Size)
+	assert.Exactly(t, int64(1024), bs.Capacity)
+}
@@ -0,0 +1,94 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15 // like 4 bit counters
+)
+
+// cmSketch is a count-min sketch which estimates the access frequency of a
+// key. Once the number of additions reaches the sample size, all counters get
+// halved to let old popular keys age out. It is not safe for concurrent use.
+type cmSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCMSketch(width int) *cmSketch {
+	w := 16
+	for w < width {
+		w <<= 1
+	}
+	s := &cmSketch{
+		mask:       uint64(w - 1),
+		sampleSize: 10 * w,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// index returns the column of a row. The hash gets remixed per row, so that
+// the rows use independent columns.
+func (s *cmSketch) index(h uint64, row int) uint64 {
+	h ^= uint64(row+1) * 0x9e3779b97f4a7c15
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 31
+	return h & s.mask
+}
+
+func (s *cmSketch) add(h uint64) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < sketchMaxCounter {
+			*c++
+		}
+	}
+	if s.additions++; s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(h uint64) uint8 {
+	min := uint8(sketchMaxCounter)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// reset halves all counters.
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *cmSketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,562 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tinylfu implements a sharded W-TinyLFU cache.
+//
+// Each shard consists of a small window LRU, which takes all new entries, and
+// a segmented LRU main space with a probation and a protected segment. An
+// entry evicted from the window gets only admitted to the main space if a
+// count-min sketch estimates its access frequency higher than the frequency of
+// the entry which would be evicted from the main space. Hence a scan of many
+// keys cannot flush the hot keys out of the cache. Capacity is the total cost
+// of all entries, where the cost of an entry is the Size() of its value.
+// Entries can have a time to live.
+//
+// The API follows package storage/lru.
+package tinylfu
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var now = time.Now
+
+// Value is the interface values that go into Cache need to satisfy.
+type Value interface {
+	// Size returns the cost of the value. If you want to just track the cache
+	// by number of objects, you may return the size as 1.
+	Size() int
+}
+
+// Item is what is stored in the cache.
+type Item struct {
+	Key   string
+	Value Value
+	// ExpiresAt is zero if the item does not expire.
+	ExpiresAt time.Time
+}
+
+// Options configures a new Cache.
+type Options struct {
+	// Capacity defines the maximum total cost of all entries. Default 10000.
+	Capacity int64
+	// Shards defines the number of lock striped shards, rounded up to the
+	// next power of two. Each shard gets Capacity/Shards. Default 16 and for
+	// small capacities fewer shards.
+	Shards int
+	// ExpectedItems sizes the frequency sketch. Default is the Capacity
+	// limited to 100000.
+	ExpectedItems int
+	// DefaultTTL applies to Set. Zero means entries do not expire.
+	DefaultTTL time.Duration
+}
+
+// Cache is a W-TinyLFU cache. It is safe for concurrent access.
+type Cache struct {
+	shards     []*shard
+	mask       uint64
+	defaultTTL time.Duration
+}
+
+// New creates a new empty cache with the given capacity and default options.
+func New(capacity int64) *Cache {
+	return NewWithOptions(Options{Capacity: capacity})
+}
+
+// NewWithOptions creates a new empty cache.
+func NewWithOptions(o Options) *Cache {
+	if o.Capacity <= 0 {
+		o.Capacity = 10000
+	}
+	if o.Shards <= 0 {
+		o.Shards = 16
+		for o.Shards > 1 && o.Capacity/int64(o.Shards) < 64 {
+			o.Shards >>= 1
+		}
+	}
+	shards := 1
+	for shards < o.Shards {
+		shards <<= 1
+	}
+	if o.ExpectedItems <= 0 {
+		o.ExpectedItems = 100000
+		if o.Capacity < int64(o.ExpectedItems) {
+			o.ExpectedItems = int(o.Capacity)
+		}
+	}
+
+	c := &Cache{
+		shards:     make([]*shard, shards),
+		mask:       uint64(shards - 1),
+		defaultTTL: o.DefaultTTL,
+	}
+	capacity := o.Capacity / int64(shards)
+	if capacity < 1 {
+		capacity = 1
+	}
+	for i := range c.shards {
+		c.shards[i] = newShard(capacity, o.ExpectedItems/shards)
+	}
+	return c
+}
+
+// hashKey implements FNV-1a.
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (c *Cache) shard(key string) (*shard, uint64) {
+	h := hashKey(key)
+	return c.shards[(h>>32)&c.mask], h
+}
+
+// Get returns a value from the cache and records the access.
+func (c *Cache) Get(key string) (v Value, ok bool) {
+	s, h := c.shard(key)
+	return s.get(key, h)
+}
+
+// Peek returns a value from the cache without recording the access.
+func (c *Cache) Peek(key string) (v Value, ok bool) {
+	s, _ := c.shard(key)
+	return s.peek(key)
+}
+
+// Set sets a value in the cache with the default TTL. A value whose cost
+// exceeds the capacity of a shard does not get stored.
+func (c *Cache) Set(key string, value Value) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL sets a value in the cache which expires after ttl. A zero ttl
+// never expires.
+func (c *Cache) SetWithTTL(key string, value Value, ttl time.Duration) {
+	s, h := c.shard(key)
+	s.set(key, h, value, ttl, false)
+}
+
+// SetIfAbsent will set the value in the cache if not present. If the value
+// exists in the cache, we don't set it.
+func (c *Cache) SetIfAbsent(key string, value Value) {
+	s, h := c.shard(key)
+	s.set(key, h, value, c.defaultTTL, true)
+}
+
+// Delete removes an entry from the cache, and returns if the entry existed.
+func (c *Cache) Delete(key string) bool {
+	s, _ := c.shard(key)
+	return s.delete(key)
+}
+
+// Clear will clear the entire cache including the frequency sketch.
+func (c *Cache) Clear() {
+	for _, s := range c.shards {
+		s.clear()
+	}
+}
+
+// Stats returns a few stats on the cache.
+func (c *Cache) Stats() (length, size, capacity, evictions int64, oldest time.Time) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		length += int64(len(s.table))
+		size += s.cost()
+		capacity += s.capacity
+		evictions += s.evictions
+		if o := s.oldest(); !o.IsZero() && (oldest.IsZero() || o.Before(oldest)) {
+			oldest = o
+		}
+		s.mu.Unlock()
+	}
+	return
+}
+
+// StatsJSON returns stats as a JSON object in a string.
+func (c *Cache) StatsJSON() string {
+	if c == nil {
+		return "{}"
+	}
+	l, s, cp, e, o := c.Stats()
+	h, m := c.HitsMisses()
+	return fmt.Sprintf("{\"Length\": %v, \"Size\": %v, \"Capacity\": %v, \"Evictions\": %v, \"Hits\": %v, \"Misses\": %v, \"OldestAccess\": \"%v\"}", l, s, cp, e, h, m, o)
+}
+
+// Length returns how many elements are in the cache.
+func (c *Cache) Length() int64 {
+	l, _, _, _, _ := c.Stats()
+	return l
+}
+
+// Size returns the sum of the objects' Size() method.
+func (c *Cache) Size() int64 {
+	_, s, _, _, _ := c.Stats()
+	return s
+}
+
+// Capacity returns the cache maximum capacity.
+func (c *Cache) Capacity() int64 {
+	_, _, cp, _, _ := c.Stats()
+	return cp
+}
+
+// Evictions returns the eviction count. Rejected admissions and expired
+// entries count as evictions.
+func (c *Cache) Evictions() int64 {
+	_, _, _, e, _ := c.Stats()
+	return e
+}
+
+// HitsMisses returns how often Get has found or not found a key. Peek does not
+// change the counters.
+func (c *Cache) HitsMisses() (hits, misses int64) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		hits += s.hits
+		misses += s.misses
+		s.mu.Unlock()
+	}
+	return
+}
+
+// Oldest returns the access time of the least recently used element, or a
+// IsZero() time if cache is empty.
+func (c *Cache) Oldest() time.Time {
+	_, _, _, _, o := c.Stats()
+	return o
+}
+
+// Keys returns all the not expired keys of the cache in no particular order.
+func (c *Cache) Keys() []string {
+	var keys []string
+	for _, s := range c.shards {
+		s.each(func(e *entry) { keys = append(keys, e.key) })
+	}
+	return keys
+}
+
+// Items returns all the not expired items of the cache in no particular
+// order.
+func (c *Cache) Items() []Item {
+	var items []Item
+	for _, s := range c.shards {
+		s.each(func(e *entry) {
+			itm := Item{Key: e.key, Value: e.value}
+			if e.expiresAt > 0 {
+				itm.ExpiresAt = time.Unix(0, e.expiresAt)
+			}
+			items = append(items, itm)
+		})
+	}
+	return items
+}
+
+const (
+	segWindow uint8 = iota
+	segProbation
+	segProtected
+)
+
+type entry struct {
+	key          string
+	hash         uint64
+	value        Value
+	cost         int64
+	expiresAt    int64 // unix nano, zero never expires
+	timeAccessed time.Time
+	segment      uint8
+}
+
+func (e *entry) expired(n int64) bool {
+	return e.expiresAt > 0 && e.expiresAt <= n
+}
+
+type shard struct {
+	mu sync.Mutex
+
+	table     map[string]*list.Element
+	segments  [3]*list.List
+	segCost   [3]int64
+	capacity  int64
+	windowCap int64
+	mainCap   int64
+	protCap   int64
+	sketch    *cmSketch
+
+	evictions, hits, misses int64
+}
+
+func newShard(capacity int64, expectedItems int) *shard {
+	s := &shard{
+		table:    make(map[string]*list.Element),
+		capacity: capacity,
+		sketch:   newCMSketch(expectedItems),
+	}
+	for i := range s.segments {
+		s.segments[i] = list.New()
+	}
+	s.windowCap = capacity / 100
+	if s.windowCap < 1 {
+		s.windowCap = 1
+	}
+	s.mainCap = capacity - s.windowCap
+	s.protCap = s.mainCap * 8 / 10
+	return s
+}
+
+func (s *shard) cost() int64 {
+	return s.segCost[segWindow] + s.segCost[segProbation] + s.segCost[segProtected]
+}
+
+func (s *shard) mainCost() int64 {
+	return s.segCost[segProbation] + s.segCost[segProtected]
+}
+
+func (s *shard) oldest() (oldest time.Time) {
+	for _, l := range s.segments {
+		if b := l.Back(); b != nil {
+			if ta := b.Value.(*entry).timeAccessed; oldest.IsZero() || ta.Before(oldest) {
+				oldest = ta
+			}
+		}
+	}
+	return
+}
+
+func (s *shard) get(key string, h uint64) (Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sketch.add(h)
+	elem := s.table[key]
+	if elem == nil {
+		s.misses++
+		return nil, false
+	}
+	n := now()
+	e := elem.Value.(*entry)
+	if e.expired(n.UnixNano()) {
+		s.remove(elem)
+		s.evictions++
+		s.misses++
+		return nil, false
+	}
+	s.hits++
+	e.timeAccessed = n
+	s.touch(elem)
+	return e.value, true
+}
+
+func (s *shard) peek(key string) (Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem := s.table[key]
+	if elem == nil {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if e.expired(now().UnixNano()) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// touch moves an accessed entry to the front of its segment. An entry in the
+// probation segment gets promoted to the protected segment.
+func (s *shard) touch(elem *list.Element) {
+	e := elem.Value.(*entry)
+	if e.segment != segProbation {
+		s.segments[e.segment].MoveToFront(elem)
+		return
+	}
+	s.remove(elem)
+	s.pushFront(e, segProtected)
+	// demote the least recently used protected entries
+	for s.segCost[segProtected] > s.protCap {
+		b := s.segments[segProtected].Back()
+		if b == nil || b.Value.(*entry) == e {
+			break
+		}
+		be := b.Value.(*entry)
+		s.remove(b)
+		s.pushFront(be, segProbation)
+	}
+}
+
+func (s *shard) pushFront(e *entry, segment uint8) {
+	e.segment = segment
+	s.table[e.key] = s.segments[segment].PushFront(e)
+	s.segCost[segment] += e.cost
+}
+
+func (s *shard) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	s.segments[e.segment].Remove(elem)
+	s.segCost[e.segment] -= e.cost
+	delete(s.table, e.key)
+}
+
+func (s *shard) set(key string, h uint64, value Value, ttl time.Duration, ifAbsent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := now()
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = n.Add(ttl).UnixNano()
+	}
+	s.sketch.add(h)
+	cost := int64(value.Size())
+
+	if elem := s.table[key]; elem != nil {
+		e := elem.Value.(*entry)
+		if ifAbsent && !e.expired(n.UnixNano()) {
+			e.timeAccessed = n
+			s.touch(elem)
+			return
+		}
+		s.remove(elem)
+		if cost > s.capacity {
+			return
+		}
+		e.value, e.cost, e.expiresAt, e.timeAccessed = value, cost, expiresAt, n
+		s.pushFront(e, e.segment)
+		s.evict(n.UnixNano())
+		return
+	}
+	if cost > s.capacity {
+		s.evictions++
+		return
+	}
+	s.pushFront(&entry{
+		key:          key,
+		hash:         h,
+		value:        value,
+		cost:         cost,
+		expiresAt:    expiresAt,
+		timeAccessed: n,
+	}, segWindow)
+	s.evict(n.UnixNano())
+}
+
+// evict moves the overflowing window entries as candidates to the main space
+// and shrinks the main space to its capacity.
+func (s *shard) evict(n int64) {
+	for s.segCost[segWindow] > s.windowCap {
+		b := s.segments[segWindow].Back()
+		if b == nil {
+			break
+		}
+		cand := b.Value.(*entry)
+		s.remove(b)
+		s.admit(cand, n)
+	}
+	// updated values might have increased the cost of the main space.
+	for s.mainCost() > s.mainCap {
+		victim := s.mainVictim()
+		if victim == nil {
+			break
+		}
+		s.remove(victim)
+		s.evictions++
+	}
+}
+
+// mainVictim returns the least recently used entry of the probation segment
+// or, if empty, of the protected segment.
+func (s *shard) mainVictim() *list.Element {
+	if b := s.segments[segProbation].Back(); b != nil {
+		return b
+	}
+	return s.segments[segProtected].Back()
+}
+
+// nextVictim returns the entry which gets evicted after elem by mainVictim.
+func (s *shard) nextVictim(elem *list.Element) *list.Element {
+	if p := elem.Prev(); p != nil {
+		return p
+	}
+	if elem.Value.(*entry).segment == segProbation {
+		return s.segments[segProtected].Back()
+	}
+	return nil
+}
+
+// admit adds the candidate to the probation segment if its estimated frequency
+// is higher than the frequency of all entries which must be evicted to make
+// room. Otherwise the candidate gets dropped and the main space stays
+// unchanged.
+func (s *shard) admit(cand *entry, n int64) {
+	if cand.expired(n) || cand.cost > s.mainCap {
+		s.evictions++
+		return
+	}
+	candFreq := s.sketch.estimate(cand.hash)
+	need := s.mainCost() + cand.cost - s.mainCap
+	for elem := s.mainVictim(); need > 0 && elem != nil; elem = s.nextVictim(elem) {
+		ve := elem.Value.(*entry)
+		if !ve.expired(n) && candFreq <= s.sketch.estimate(ve.hash) {
+			s.evictions++
+			return
+		}
+		need -= ve.cost
+	}
+	for s.mainCost()+cand.cost > s.mainCap {
+		s.remove(s.mainVictim())
+		s.evictions++
+	}
+	s.pushFront(cand, segProbation)
+}
+
+func (s *shard) delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem := s.table[key]
+	if elem == nil {
+		return false
+	}
+	s.remove(elem)
+	return true
+}
+
+func (s *shard) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table = make(map[string]*list.Element)
+	for i := range s.segments {
+		s.segments[i].Init()
+		s.segCost[i] = 0
+	}
+	s.sketch.clear()
+}
+
+func (s *shard) each(fn func(e *entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := now().UnixNano()
+	for _, l := range s.segments {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			if e := elem.Value.(*entry); !e.expired(n) {
+				fn(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tinylfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type cacheValue struct {
+	size int
+}
+
+func (cv *cacheValue) Size() int {
+	return cv.size
+}
+
+func TestSetGetDelete(t *testing.T) {
+	cache := New(100)
+	data := &cacheValue{1}
+	cache.Set("key", data)
+
+	if v, ok := cache.Get("key"); !ok || v.(*cacheValue) != data {
+		t.Errorf("Cache has incorrect value: %v != %v", data, v)
+	}
+	if v, ok := cache.Peek("key"); !ok || v.(*cacheValue) != data {
+		t.Errorf("Peek has incorrect value: %v != %v", data, v)
+	}
+	if _, ok := cache.Get("notthere"); ok {
+		t.Error("Cache returned a value for a missing key")
+	}
+
+	cache.SetIfAbsent("key", &cacheValue{2})
+	if v, _ := cache.Get("key"); v.(*cacheValue) != data {
+		t.Errorf("SetIfAbsent has overwritten the value: %v", v)
+	}
+	cache.Set("key", &cacheValue{3})
+	if l, sz, _, _, _ := cache.Stats(); l != 1 || sz != 3 {
+		t.Errorf("cache.Stats() length %d size %d, expected 1 and 3", l, sz)
+	}
+
+	if !cache.Delete("key") {
+		t.Error("Delete must report an existing key")
+	}
+	if cache.Delete("key") {
+		t.Error("Delete must not report a missing key")
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Cache returned a deleted value")
+	}
+
+	cache.Set("key1", data)
+	cache.Set("key2", data)
+	cache.Clear()
+	if l := cache.Length(); l != 0 {
+		t.Errorf("cache.Length() = %d after Clear", l)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	n := time.Unix(1000, 0)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+
+	cache := NewWithOptions(Options{Capacity: 100, DefaultTTL: time.Minute})
+	cache.Set("default", &cacheValue{1})
+	cache.SetWithTTL("short", &cacheValue{1}, time.Second)
+	cache.SetWithTTL("forever", &cacheValue{1}, 0)
+
+	n = n.Add(2 * time.Second)
+	if _, ok := cache.Get("short"); ok {
+		t.Error("short must be expired")
+	}
+	if _, ok := cache.Peek("default"); !ok {
+		t.Error("default must not be expired")
+	}
+	keys := cache.Keys()
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[default forever]" {
+		t.Errorf("cache.Keys() = %v", keys)
+	}
+
+	n = n.Add(time.Minute)
+	if _, ok := cache.Get("default"); ok {
+		t.Error("default must be expired")
+	}
+	if _, ok := cache.Get("forever"); !ok {
+		t.Error("forever must not expire")
+	}
+	items := cache.Items()
+	if len(items) != 1 || items[0].Key != "forever" || !items[0].ExpiresAt.IsZero() {
+		t.Errorf("cache.Items() = %v", items)
+	}
+}
+
+func TestCapacityIsObeyed(t *testing.T) {
+	cache := NewWithOptions(Options{Capacity: 100, Shards: 1})
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), &cacheValue{10})
+		if sz := cache.Size(); sz > 100 {
+			t.Fatalf("cache.Size() = %d exceeds the capacity", sz)
+		}
+	}
+	if e := cache.Evictions(); e < 990 {
+		t.Errorf("cache.Evictions() = %d, expected at least 990", e)
+	}
+
+	cache.Set("too_large", &cacheValue{101})
+	if _, ok := cache.Peek("too_large"); ok {
+		t.Error("A value larger than the capacity must not be stored")
+	}
+}
+
+// TestScanResistance verifies that a scan of many keys, each accessed once,
+// does not evict the frequently used keys, which happens with an LRU.
+func TestScanResistance(t *testing.T) {
+	cache := NewWithOptions(Options{Capacity: 100, Shards: 1})
+	hot := func(i int) string { return fmt.Sprintf("hot%d", i) }
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			if _, ok := cache.Get(hot(i)); !ok {
+				cache.Set(hot(i), &cacheValue{1})
+			}
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("scan%d", i), &cacheValue{1})
+	}
+	var found int
+	for i := 0; i < 50; i++ {
+		if _, ok := cache.Peek(hot(i)); ok {
+			found++
+		}
+	}
+	if found < 45 {
+		t.Errorf("Only %d of 50 hot keys survived the scan", found)
+	}
+}
+
+func TestStats(t *testing.T) {
+	cache := New(100)
+	cache.Set("key", &cacheValue{1})
+	cache.Get("key")
+	cache.Get("key")
+	cache.Get("notthere")
+	cache.Peek("key")
+
+	if h, m := cache.HitsMisses(); h != 2 || m != 1 {
+		t.Errorf("cache.HitsMisses() = %d, %d, expected 2, 1", h, m)
+	}
+	if c := cache.Capacity(); c != 100 {
+		t.Errorf("cache.Capacity() = %d", c)
+	}
+	if o := cache.Oldest(); o.IsZero() {
+		t.Error("cache.Oldest() must not be zero")
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(cache.StatsJSON()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["Length"].(float64) != 1 || m["Hits"].(float64) != 2 {
+		t.Errorf("cache.StatsJSON() returned bad data: %v", m)
+	}
+
+	cache = nil
+	if s := cache.StatsJSON(); s != "{}" {
+		t.Errorf("cache.StatsJSON() on nil object returned %v", s)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	cache := NewWithOptions(Options{Capacity: 1000, DefaultTTL: time.Hour})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("key%d", (i*(g+1))%1500)
+				switch i % 4 {
+				case 0:
+					cache.Set(key, &cacheValue{1})
+				case 1:
+					cache.Get(key)
+				case 2:
+					cache.Delete(key)
+				default:
+					cache.Peek(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if sz := cache.Size(); sz > 1000 {
+		t.Errorf("cache.Size() = %d exceeds the capacity", sz)
+	}
+}
+
+func TestCMSketch(t *testing.T) {
+	s := newCMSketch(64)
+	for i := 0; i < 20; i++ {
+		s.add(hashKey("hot"))
+	}
+	s.add(hashKey("cold"))
+	if e := s.estimate(hashKey("hot")); e != sketchMaxCounter {
+		t.Errorf("estimate hot = %d, expected %d", e, sketchMaxCounter)
+	}
+	if e := s.estimate(hashKey("cold")); e < 1 || e > 2 {
+		t.Errorf("estimate cold = %d, expected about 1", e)
+	}
+	s.reset()
+	if e := s.estimate(hashKey("hot")); e != sketchMaxCounter/2 {
+		t.Errorf("estimate hot after reset = %d, expected %d", e, sketchMaxCounter/2)
+	}
+}
+
+// TestAdmitKeepsVictims verifies that a rejected candidate does not evict the
+// victims which have been checked before the candidate lost.
+func TestAdmitKeepsVictims(t *testing.T) {
+	newTestShard := func(candFreq int) (*shard, *entry) {
+		s := newShard(100, 1<<16)
+		add := func(key string, freq int) *entry {
+			e := &entry{key: key, hash: hashKey(key), cost: 1}
+			for i := 0; i < freq; i++ {
+				s.sketch.add(e.hash)
+			}
+			return e
+		}
+		// the least recently used entry, the first victim, is rarely used.
+		s.pushFront(add("cold", 1), segProbation)
+		for i := int64(1); i < s.mainCap; i++ {
+			s.pushFront(add(fmt.Sprintf("hot%d", i), 10), segProbation)
+		}
+		cand := add("cand", candFreq)
+		cand.cost = 5
+		return s, cand
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		s, cand := newTestShard(3)
+		s.admit(cand, 0)
+		if _, ok := s.table["cand"]; ok {
+			t.Error("candidate must be rejected")
+		}
+		if _, ok := s.table["cold"]; !ok {
+			t.Error("cold must not be evicted by a rejected candidate")
+		}
+		if c := s.mainCost(); c != s.mainCap {
+			t.Errorf("mainCost = %d, expected %d", c, s.mainCap)
+		}
+		if s.evictions != 1 {
+			t.Errorf("evictions = %d, expected 1", s.evictions)
+		}
+	})
+
+	t.Run("admitted", func(t *testing.T) {
+		s, cand := newTestShard(20)
+		s.admit(cand, 0)
+		if _, ok := s.table["cand"]; !ok {
+			t.Error("candidate must be admitted")
+		}
+		for _, key := range []string{"cold", "hot1", "hot2", "hot3", "hot4"} {
+			if _, ok := s.table[key]; ok {
+				t.Errorf("%s must be evicted", key)
+			}
+		}
+		if _, ok := s.table["hot5"]; !ok {
+			t.Error("hot5 must not be evicted")
+		}
+		if c := s.mainCost(); c != s.mainCap {
+			t.Errorf("mainCost = %d, expected %d", c, s.mainCap)
+		}
+	})
+}
@@ -43,6 +43,28 @@
 //
 // Those three objects also represents the tables in the database.
 //
+// Modifications
+//
+// The Service functions DeleteWebsite, DeleteGroup and DeleteStore cascade the
+// deletion to the child entities. The admin entities with ID 0 and the default
+// website, group and store cannot be deleted. If a deleted group or store has
+// been the default of its parent, the parent gets re-pointed to the next
+// available child. UpdateWebsite, UpdateGroup and UpdateStore replace existing
+// entities. A modification gets applied to a copy of the tree and swapped in
+// once it validates, a failed modification leaves the Service untouched. The
+// option WithSaveToDB writes only the changed and deleted rows to the database
+// and never touches rows this Service does not know about.
+//
+// Subscriptions and Reloading
+//
+// A ChangeReceiver subscribed via Service.Subscribe gets notified with an Event
+// whenever the store tree changes. Service.Reload replaces the whole tree, for
+// example with the data from WithLoadFromDB. The new tree gets built aside and
+// swapped at once, readers are not blocked while loading and an invalid tree
+// gets rejected. WithReloadInterval reloads periodically and the subpackage
+// storebinlog reloads when the binlog, read by package mycanal, reports
+// changes of the tables store, store_group or store_website.
+//
 // Sub package Scope
 //
 // The subpackage scope depends on these structure except that the group has
@@ -14,7 +14,13 @@
 
 package store
 
-import "github.com/corestoreio/errors"
+import (
+	"context"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
 
 // DefaultStoreID is always 0.
 const DefaultStoreID int64 = 0
@@ -123,3 +129,81 @@ func WithWebsites(websites ...*StoreWebsite) Option {
 		},
 	}
 }
+
+// WithOnChange calls fn in a separate goroutine after options have been
+// applied, websites, groups or stores have been updated or deleted or the store
+// tree has been reloaded. Changes
+// which happen while fn still runs get merged into one call. The goroutine
+// terminates when the context gets cancelled or the Service gets closed. Use
+// case: rebuilding lookup tables which depend on the store tree.
+func WithOnChange(ctx context.Context, fn func(*Service)) Option {
+	return Option{
+		sortOrder: sortOrderSubscriber + 1,
+		fn: func(s *Service) error {
+			subscriptionID, chanEvent := s.subscribe()
+
+			go func() {
+				defer s.unsubscribe(subscriptionID)
+				for {
+					var e Event
+					select {
+					case ev, ok := <-chanEvent:
+						if !ok {
+							return
+						}
+						e = ev
+					case <-ctx.Done():
+						return
+					case <-s.chanClose:
+						return
+					}
+					if e == EventClosed {
+						return
+					}
+					if s.log != nil && s.log.IsDebug() {
+						s.log.Debug("store.WithOnChange.Event", log.Stringer("event", e))
+					}
+					fn(s)
+				}
+			}()
+			return nil
+		},
+	}
+}
+
+// WithReloadInterval reloads the store tree periodically with the provided
+// options, for example WithLoadFromDB, see Service.Reload. Errors get sent to
+// chanErr, if not nil. The reloading stops when the context gets cancelled or
+// the Service gets closed.
+func WithReloadInterval(ctx context.Context, interval time.Duration, chanErr chan<- error, opts ...Option) Option {
+	return Option{
+		sortOrder: sortOrderSubscriber + 2,
+		fn: func(s *Service) error {
+			if interval <= 0 {
+				return errors.NotValid.Newf("[store] WithReloadInterval: interval %s must be greater than zero", interval)
+			}
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+					case <-ctx.Done():
+						return
+					case <-s.chanClose:
+						return
+					}
+					if err := s.Reload(opts...); err != nil {
+						if s.log != nil && s.log.IsInfo() {
+							s.log.Info("store.WithReloadInterval.Reload", log.Err(err))
+						}
+						if chanErr != nil {
+							chanErr <- errors.WithStack(err)
+						}
+					}
+				}
+			}()
+			return nil
+		},
+	}
+}
@@ -18,10 +18,12 @@ package store
 
 import (
 	"context"
+	"sort"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
 )
 
 // WithLoadFromDB loads the store,group and website data from the database.
@@ -63,42 +65,44 @@ func WithLoadFromDB(ctx context.Context, tbls *ddl.Tables) Option {
 }
 
 // WithSaveToDB persists the stores, groups and websites to the database when
-// options have been applied.
+// options have been applied or when websites, groups or stores have been
+// updated or deleted. A reload of the store tree does not trigger a save. Each
+// save runs in a transaction. After applying options all entities get
+// upserted. A modification upserts only the changed rows and deletes only the
+// rows of the removed entities, including the cascaded children. Rows of other
+// entities never get deleted, even if the Service does not know them. The admin
+// entities with ID 0 are never written nor deleted. Changes which failed to
+// save get retried with the next save. Errors get sent to chanErr, if not nil.
+// The saving stops when the context gets cancelled or the Service gets closed.
 func WithSaveToDB(ctx context.Context, tbls *ddl.Tables, chanErr chan<- error) Option {
-
-	stmtStore := tbls.MustTable(TableNameStore).Insert().OnDuplicateKey().WithDBR()
-	stmtGroup := tbls.MustTable(TableNameStoreGroup).Insert().OnDuplicateKey().WithDBR()
-	stmtWebsite := tbls.MustTable(TableNameStoreWebsite).Insert().OnDuplicateKey().WithDBR()
-
 	return Option{
-		sortOrder: 100000,
+		sortOrder: sortOrderSubscriber,
 		fn: func(s *Service) error {
-
-			s.chanEventSubscriber = append(s.chanEventSubscriber, make(chan int))
-			newEventIDX := len(s.chanEventSubscriber) - 1
+			subscriptionID, chanEvent := s.subscribe()
+			s.trackChanges(subscriptionID)
 
 			handleChanErr := func(msg string, err error) {
 				if err != nil {
 					if s.log != nil && s.log.IsInfo() {
 						s.log.Info(msg, log.Err(err))
 					}
-					chanErr <- errors.WithStack(err)
+					if chanErr != nil {
+						chanErr <- errors.WithStack(err)
+					}
 				}
 			}
 
 			go func() {
-				defer func() {
-					close(s.chanEventSubscriber[newEventIDX])
-					s.chanEventSubscriber[newEventIDX] = nil
-
-					handleChanErr("store.WithSaveToDB.stmtStore.Close", stmtStore.Close())
-					handleChanErr("store.WithSaveToDB.stmtGroup.Close", stmtGroup.Close())
-					handleChanErr("store.WithSaveToDB.stmtWebsite.Close", stmtWebsite.Close())
-				}()
+				defer s.untrackChanges(subscriptionID)
+				defer s.unsubscribe(subscriptionID)
 				for {
-					var eventID int
+					var e Event
 					select {
-					case eventID = <-s.chanEventSubscriber[newEventIDX]:
+					case ev, ok := <-chanEvent:
+						if !ok {
+							return
+						}
+						e = ev
 					case <-ctx.Done():
 						if s.log != nil && s.log.IsDebug() {
 							s.log.Debug("store.WithSaveToDB.Context", log.Err(ctx.Err()))
@@ -112,16 +116,21 @@ func WithSaveToDB(ctx context.Context, tbls *ddl.Tables, chanErr chan<- error) O
 					}
 
 					if s.log != nil && s.log.IsDebug() {
-						s.log.Debug("store.WithSaveToDB.Event", log.Int("event_id", eventID))
+						s.log.Debug("store.WithSaveToDB.Event", log.Stringer("event", e))
+					}
+					if e == EventClosed {
+						return
+					}
+					// A reload does not record changes, the data has just
+					// been loaded from the database.
+					cs := s.takeChanges(subscriptionID)
+					if e == EventOptionsApplied {
+						cs.merge(s.allEntities())
+					}
+					if err := s.saveToDB(ctx, tbls, cs); err != nil {
+						s.returnChanges(subscriptionID, cs)
+						handleChanErr("store.WithSaveToDB.saveToDB", err)
 					}
-
-					// now save the data from memory to DB
-					s.mu.RLock()
-					_ = stmtStore
-					_ = stmtGroup
-					_ = stmtWebsite
-					chanErr <- errors.ConnectionFailed.Newf("todo error handling")
-					s.mu.RUnlock()
 				}
 			}()
 
@@ -129,3 +138,114 @@ func WithSaveToDB(ctx context.Context, tbls *ddl.Tables, chanErr chan<- error) O
 		},
 	}
 }
+
+// allEntities returns all websites, groups and stores as upserts.
+func (s *Service) allEntities() *changeSet {
+	cs := newChangeSet()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.websites.Data {
+		cs.websites[w.WebsiteID] = w
+	}
+	for _, g := range s.groups.Data {
+		cs.groups[g.GroupID] = g
+	}
+	for _, st := range s.stores.Data {
+		cs.stores[st.StoreID] = st
+	}
+	return cs
+}
+
+// saveToDB writes the changes into the database. The entities of a changeSet
+// never change because modifications of the Service replace the entities.
+func (s *Service) saveToDB(ctx context.Context, tbls *ddl.Tables, cs *changeSet) error {
+	var websites StoreWebsites
+	var groups StoreGroups
+	var stores Stores
+	var delWebsiteIDs, delGroupIDs, delStoreIDs []uint64
+	for id, w := range cs.websites {
+		switch {
+		case id == 0: // the admin must never be written nor deleted
+		case w == nil:
+			delWebsiteIDs = append(delWebsiteIDs, uint64(id))
+		default:
+			websites.Data = append(websites.Data, w)
+		}
+	}
+	for id, g := range cs.groups {
+		switch {
+		case id == 0:
+		case g == nil:
+			delGroupIDs = append(delGroupIDs, uint64(id))
+		default:
+			groups.Data = append(groups.Data, g)
+		}
+	}
+	for id, st := range cs.stores {
+		switch {
+		case id == 0:
+		case st == nil:
+			delStoreIDs = append(delStoreIDs, uint64(id))
+		default:
+			stores.Data = append(stores.Data, st)
+		}
+	}
+	if len(websites.Data)+len(groups.Data)+len(stores.Data)+len(delWebsiteIDs)+len(delGroupIDs)+len(delStoreIDs) == 0 {
+		return nil
+	}
+	sort.Slice(websites.Data, func(i, j int) bool { return websites.Data[i].WebsiteID < websites.Data[j].WebsiteID })
+	sort.Slice(groups.Data, func(i, j int) bool { return groups.Data[i].GroupID < groups.Data[j].GroupID })
+	sort.Slice(stores.Data, func(i, j int) bool { return stores.Data[i].StoreID < stores.Data[j].StoreID })
+	for _, ids := range [...][]uint64{delWebsiteIDs, delGroupIDs, delStoreIDs} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	return tbls.Transaction(ctx, nil, func(tx *dml.Tx) error {
+		// Delete the children first and insert the parents first because of
+		// the foreign keys.
+		if len(delStoreIDs) > 0 {
+			if _, err := tx.WithQueryBuilder(tbls.MustTable(TableNameStore).Delete().Where(
+				dml.Column("store_id").In().Uint64s(delStoreIDs...),
+			)).ExecContext(ctx); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if len(delGroupIDs) > 0 {
+			if _, err := tx.WithQueryBuilder(tbls.MustTable(TableNameStoreGroup).Delete().Where(
+				dml.Column("group_id").In().Uint64s(delGroupIDs...),
+			)).ExecContext(ctx); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if len(delWebsiteIDs) > 0 {
+			if _, err := tx.WithQueryBuilder(tbls.MustTable(TableNameStoreWebsite).Delete().Where(
+				dml.Column("website_id").In().Uint64s(delWebsiteIDs...),
+			)).ExecContext(ctx); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if len(websites.Data) > 0 {
+			if _, err := tbls.MustTable(TableNameStoreWebsite).Insert().
+				AddColumns("website_id").AddOnDuplicateKeyExclude("website_id").OnDuplicateKey().
+				WithDBR().WithTx(tx).ExecContext(ctx, dml.Qualify("", &websites)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if len(groups.Data) > 0 {
+			if _, err := tbls.MustTable(TableNameStoreGroup).Insert().
+				AddColumns("group_id").AddOnDuplicateKeyExclude("group_id").OnDuplicateKey().
+				WithDBR().WithTx(tx).ExecContext(ctx, dml.Qualify("", &groups)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if len(stores.Data) > 0 {
+			if _, err := tbls.MustTable(TableNameStore).Insert().
+				AddColumns("store_id").AddOnDuplicateKeyExclude("store_id").OnDuplicateKey().
+				WithDBR().WithTx(tx).ExecContext(ctx, dml.Qualify("", &stores)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
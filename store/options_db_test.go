@@ -21,9 +21,14 @@ import (
 	"flag"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
 	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
 	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/storage/null"
 	"github.com/weiwolves/pkg/store"
 	"github.com/weiwolves/pkg/store/scope"
 	"github.com/weiwolves/pkg/util/assert"
@@ -63,3 +68,174 @@ func TestWithLoadFromDB(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Exactly(t, "StoreID 7 WebsiteID 1", fmt.Sprintf("StoreID %d WebsiteID %d", storeID, websiteID))
 }
+
+func newStoreTables(t *testing.T, dbc *dml.ConnPool) *ddl.Tables {
+	tbls, err := ddl.NewTables(
+		ddl.WithConnPool(dbc),
+		ddl.WithTable(store.TableNameStore,
+			&ddl.Column{Field: "store_id", ColumnType: "smallint(5) unsigned", Key: "PRI", Extra: "auto_increment"},
+			&ddl.Column{Field: "code", ColumnType: "varchar(32)"},
+			&ddl.Column{Field: "website_id", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "group_id", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "name", ColumnType: "varchar(255)"},
+			&ddl.Column{Field: "sort_order", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "is_active", ColumnType: "smallint(5) unsigned"},
+		),
+		ddl.WithTable(store.TableNameStoreGroup,
+			&ddl.Column{Field: "group_id", ColumnType: "smallint(5) unsigned", Key: "PRI", Extra: "auto_increment"},
+			&ddl.Column{Field: "website_id", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "name", ColumnType: "varchar(255)"},
+			&ddl.Column{Field: "root_category_id", ColumnType: "int(10) unsigned"},
+			&ddl.Column{Field: "default_store_id", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "code", ColumnType: "varchar(32)"},
+		),
+		ddl.WithTable(store.TableNameStoreWebsite,
+			&ddl.Column{Field: "website_id", ColumnType: "smallint(5) unsigned", Key: "PRI", Extra: "auto_increment"},
+			&ddl.Column{Field: "code", ColumnType: "varchar(32)"},
+			&ddl.Column{Field: "name", ColumnType: "varchar(64)"},
+			&ddl.Column{Field: "sort_order", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "default_group_id", ColumnType: "smallint(5) unsigned"},
+			&ddl.Column{Field: "is_default", ColumnType: "smallint(5) unsigned"},
+		),
+	)
+	assert.NoError(t, err)
+	return tbls
+}
+
+func TestWithSaveToDB(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	tbls := newStoreTables(t, dbc)
+
+	chanErr := make(chan error, 1)
+	waitForExpectations := func(t *testing.T) {
+		deadline := time.Now().Add(3 * time.Second)
+		for dbMock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+			select {
+			case err := <-chanErr:
+				t.Fatalf("%+v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	}
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `store_website` (`code`,`name`,`sort_order`,`default_group_id`,`is_default`,`website_id`) VALUES (?,?,?,?,?,?),(?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `code`=VALUES(`code`), `name`=VALUES(`name`), `sort_order`=VALUES(`sort_order`), `default_group_id`=VALUES(`default_group_id`), `is_default`=VALUES(`is_default`)")).
+		WithArgs("euro", "Europe", 0, 1, true, 1, "oz", "Oceania", 0, 2, false, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `store_group` (`website_id`,`name`,`root_category_id`,`default_store_id`,`code`,`group_id`) VALUES (?,?,?,?,?,?),(?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `website_id`=VALUES(`website_id`), `name`=VALUES(`name`), `root_category_id`=VALUES(`root_category_id`), `default_store_id`=VALUES(`default_store_id`), `code`=VALUES(`code`)")).
+		WithArgs(1, "DACH Group", 2, 1, "dach", 1, 2, "OZ Group", 2, 3, "oz", 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `store` (`code`,`website_id`,`group_id`,`name`,`sort_order`,`is_active`,`store_id`) VALUES (?,?,?,?,?,?,?),(?,?,?,?,?,?,?),(?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `code`=VALUES(`code`), `website_id`=VALUES(`website_id`), `group_id`=VALUES(`group_id`), `name`=VALUES(`name`), `sort_order`=VALUES(`sort_order`), `is_active`=VALUES(`is_active`)")).
+		WithArgs("de", 1, 1, "Germany", 10, true, 1, "at", 1, 1, "Austria", 20, true, 2, "au", 2, 2, "Australia", 30, true, 3).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	dbMock.ExpectCommit()
+
+	srv, err := store.NewService(
+		store.WithWebsites(
+			&store.StoreWebsite{WebsiteID: 0, Code: "admin", Name: null.MakeString("Admin")},
+			&store.StoreWebsite{WebsiteID: 1, Code: "euro", Name: null.MakeString("Europe"), DefaultGroupID: 1, IsDefault: true},
+			&store.StoreWebsite{WebsiteID: 2, Code: "oz", Name: null.MakeString("Oceania"), DefaultGroupID: 2},
+		),
+		store.WithGroups(
+			&store.StoreGroup{GroupID: 0, WebsiteID: 0, Name: "Default", Code: "admin"},
+			&store.StoreGroup{GroupID: 1, WebsiteID: 1, Name: "DACH Group", Code: "dach", RootCategoryID: 2, DefaultStoreID: 1},
+			&store.StoreGroup{GroupID: 2, WebsiteID: 2, Name: "OZ Group", Code: "oz", RootCategoryID: 2, DefaultStoreID: 3},
+		),
+		store.WithStores(
+			&store.Store{StoreID: 0, Code: "admin", Name: "Admin", IsActive: true},
+			&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, Name: "Germany", SortOrder: 10, IsActive: true},
+			&store.Store{StoreID: 2, Code: "at", WebsiteID: 1, GroupID: 1, Name: "Austria", SortOrder: 20, IsActive: true},
+			&store.Store{StoreID: 3, Code: "au", WebsiteID: 2, GroupID: 2, Name: "Australia", SortOrder: 30, IsActive: true},
+		),
+		store.WithSaveToDB(context.Background(), tbls, chanErr),
+	)
+	assert.NoError(t, err)
+	waitForExpectations(t)
+
+	// Only the deleted store gets removed, rows unknown to the Service stay.
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `store` WHERE (`store_id` IN (2))")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	assert.NoError(t, srv.DeleteStore(2))
+	waitForExpectations(t)
+
+	// Only the changed store gets upserted.
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `store` (`code`,`website_id`,`group_id`,`name`,`sort_order`,`is_active`,`store_id`) VALUES (?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE")).
+		WithArgs("de", 1, 1, "Deutschland", 10, true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	assert.NoError(t, srv.UpdateStore(&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, Name: "Deutschland", SortOrder: 10, IsActive: true}))
+	waitForExpectations(t)
+
+	// Deleting a website removes the cascaded children by their IDs.
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `store` WHERE (`store_id` IN (3))")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `store_group` WHERE (`group_id` IN (2))")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `store_website` WHERE (`website_id` IN (2))")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	assert.NoError(t, srv.DeleteWebsite(2))
+	waitForExpectations(t)
+
+	assert.NoError(t, srv.Close())
+	select {
+	case err := <-chanErr:
+		t.Fatalf("%+v", err)
+	default:
+	}
+}
+
+func TestService_Reload_WithLoadFromDB(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	tbls := newStoreTables(t, dbc)
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `store_id`, `code`, `website_id`, `group_id`, `name`, `sort_order`, `is_active` FROM `store` AS `main_table`")).
+		WillReturnRows(sqlmock.NewRows([]string{"store_id", "code", "website_id", "group_id", "name", "sort_order", "is_active"}).
+			AddRow(0, "admin", 0, 0, "Admin", 0, true).
+			AddRow(1, "de", 1, 1, "Germany", 10, true).
+			AddRow(2, "at", 1, 1, "Austria", 20, true))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `group_id`, `website_id`, `name`, `root_category_id`, `default_store_id`, `code` FROM `store_group` AS `main_table`")).
+		WillReturnRows(sqlmock.NewRows([]string{"group_id", "website_id", "name", "root_category_id", "default_store_id", "code"}).
+			AddRow(0, 0, "Default", 0, 0, "admin").
+			AddRow(1, 1, "DACH Group", 2, 2, "dach"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `website_id`, `code`, `name`, `sort_order`, `default_group_id`, `is_default` FROM `store_website` AS `main_table`")).
+		WillReturnRows(sqlmock.NewRows([]string{"website_id", "code", "name", "sort_order", "default_group_id", "is_default"}).
+			AddRow(0, "admin", "Admin", 0, 0, false).
+			AddRow(1, "euro", "Europe", 0, 1, true))
+
+	srv, err := store.NewService(
+		store.WithWebsites(&store.StoreWebsite{WebsiteID: 1, Code: "euro", DefaultGroupID: 1, IsDefault: true}),
+		store.WithGroups(&store.StoreGroup{GroupID: 1, WebsiteID: 1, Code: "dach", DefaultStoreID: 1}),
+		store.WithStores(&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, IsActive: true}),
+	)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	assert.NoError(t, srv.Reload(store.WithLoadFromDB(context.Background(), tbls)))
+	sts := srv.Stores()
+	assert.Exactly(t, []uint32{0, 1, 2}, sts.StoreIDs())
+	st, err := srv.DefaultStoreView()
+	assert.NoError(t, err)
+	assert.Exactly(t, "at", st.Code)
+
+	t.Run("database error keeps the current tree", func(t *testing.T) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `store_id`, `code`, `website_id`, `group_id`, `name`, `sort_order`, `is_active` FROM `store` AS `main_table`")).
+			WillReturnError(errors.ConnectionLost.Newf("Upsss"))
+
+		err := srv.Reload(store.WithLoadFromDB(context.Background(), tbls))
+		assert.ErrorIsKind(t, errors.ConnectionLost, err)
+		sts := srv.Stores()
+		assert.Exactly(t, []uint32{0, 1, 2}, sts.StoreIDs())
+	})
+}
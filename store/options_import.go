@@ -151,7 +151,7 @@ func WithLoadFromYAML(pathToFile string, yo YAMLOptions) Option {
 			}
 			unlocked = true
 			s.mu.Unlock()
-			return s.Options(
+			return s.applyOptions(
 				WithWebsites(websites.Data...),
 				WithGroups(groups.Data...),
 				WithStores(stores.Data...),
@@ -57,10 +57,22 @@ type Finder interface {
 type Service struct {
 	// defaultStore someone must be always the default guy. Handled via atomic
 	// package.
-	defaultStoreID      int64
-	chanClose           chan struct{}
-	chanEventSubscriber []chan int
-	log                 log.Logger
+	defaultStoreID int64
+	chanClose      chan struct{}
+	log            log.Logger
+
+	// subMu protects the subscribers and the last subscription ID.
+	subMu          sync.RWMutex
+	subscribers    map[int]chan Event
+	subscriptionID int
+
+	// modMu serializes the modifications of the store tree by Options,
+	// Reload and modify.
+	modMu sync.Mutex
+	// changeMu protects the changes collected for each WithSaveToDB
+	// subscription.
+	changeMu sync.Mutex
+	changes  map[int]*changeSet
 
 	// mu protects the following fields ... maybe use more mutexes
 	mu sync.RWMutex
@@ -81,26 +93,30 @@ type Option struct {
 	fn        func(*Service) error
 }
 
-const (
-	eventOptionsApplied = iota + 1
-	eventClose
-)
+// sortOrderSubscriber marks options with a sort order equal or greater as
+// options which subscribe to events of the Service.
+const sortOrderSubscriber = 100000
 
 // NewService creates a new store Service which handles websites, groups and
 // stores. You must either provide the functional options or call LoadFromDB()
 // to setup the internal cache.
 func NewService(opts ...Option) (*Service, error) {
-	srv := &Service{
+	srv := newService()
+	if err := srv.Options(opts...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return srv, nil
+}
+
+func newService() *Service {
+	return &Service{
 		chanClose:      make(chan struct{}),
 		defaultStoreID: -1, // means not set, because 0 can be admin store.
+		subscribers:    make(map[int]chan Event),
 		cacheWebsite:   make(map[uint32]*StoreWebsite),
 		cacheGroup:     make(map[uint32]*StoreGroup),
 		cacheStore:     make(map[uint32]*Store),
 	}
-	if err := srv.Options(opts...); err != nil {
-		return nil, errors.WithStack(err)
-	}
-	return srv, nil
 }
 
 // MustNewService same as NewService, but panics on error.
@@ -114,6 +130,13 @@ func MustNewService(opts ...Option) *Service {
 
 // Options applies various options to the running store service.
 func (s *Service) Options(opts ...Option) error {
+	s.modMu.Lock()
+	defer s.modMu.Unlock()
+	return s.applyOptions(opts...)
+}
+
+// applyOptions applies the options. The caller must hold modMu.
+func (s *Service) applyOptions(opts ...Option) error {
 	sort.Slice(opts, func(i, j int) bool {
 		return opts[i].sortOrder < opts[j].sortOrder // ascending 0-9 sorting ;-)
 	})
@@ -127,7 +150,43 @@ func (s *Service) Options(opts ...Option) error {
 	if err := s.validate(); err != nil {
 		return errors.WithStack(err)
 	}
-	s.dispatchEvent(eventOptionsApplied)
+	s.dispatchEvent(EventOptionsApplied)
+	return nil
+}
+
+// Reload replaces all websites, groups and stores with the ones provided by the
+// options, for example WithLoadFromDB or WithWebsites, WithGroups and
+// WithStores. The new store tree gets built and validated in a separate
+// Service, hence readers of the current tree are not blocked while loading. On
+// success the websites, groups and stores get swapped at once, the caches get
+// cleared and the subscribers receive EventReloaded. On error the current tree
+// stays untouched. Options which subscribe to events, like WithSaveToDB or
+// WithOnChange, get ignored.
+func (s *Service) Reload(opts ...Option) error {
+	dataOpts := make([]Option, 0, len(opts))
+	for _, opt := range opts {
+		if opt.sortOrder < sortOrderSubscriber {
+			dataOpts = append(dataOpts, opt)
+		}
+	}
+
+	next := newService()
+	next.log = s.log
+	defer close(next.chanClose)
+	if err := next.Options(dataOpts...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.modMu.Lock()
+	s.mu.Lock()
+	s.websites = next.websites
+	s.groups = next.groups
+	s.stores = next.stores
+	s.resetCaches()
+	s.mu.Unlock()
+	s.modMu.Unlock()
+
+	s.dispatchEvent(EventReloaded)
 	return nil
 }
 
@@ -284,14 +343,10 @@ func (s *Service) validate() error {
 	return nil
 }
 
-func (s *Service) dispatchEvent(id int) {
-	for _, ces := range s.chanEventSubscriber {
-		ces <- id
-	}
-}
-
+// Close terminates all subscriptions and the goroutines started by the
+// options.
 func (s *Service) Close() error {
-	s.dispatchEvent(eventClose)
+	s.dispatchEvent(EventClosed)
 	close(s.chanClose)
 	return nil
 }
@@ -351,11 +406,11 @@ func (s *Service) IsAllowedStoreID(runMode scope.TypeID, storeID uint32) (isAllo
 func (s *Service) DefaultStoreView() (*Store, error) {
 	s.mu.RLock()
 
-	dsID := atomic.LoadInt64(&s.defaultStoreID)
-	if dsID >= 0 {
-		cs, ok := s.cacheStore[uint32(dsID)]
-		s.mu.RUnlock()
-		if ok {
+	// The default store ID might be outdated after a reload of the store tree,
+	// then the cache misses and the default store gets searched again.
+	if dsID := atomic.LoadInt64(&s.defaultStoreID); dsID >= 0 {
+		if cs, ok := s.cacheStore[uint32(dsID)]; ok {
+			s.mu.RUnlock()
 			return cs, nil
 		}
 	}
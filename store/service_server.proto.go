@@ -132,8 +132,16 @@ func (sp *ServiceServer) AddWebsite(ctx context.Context, r *StoreWebsite) (*type
 	return &types.Empty{}, nil
 }
 
-func (sp *ServiceServer) DeleteWebsite(context.Context, *ProtoIDRequest) (*types.Empty, error) {
-	return nil, errors.NotImplemented.Newf("[store] DeleteWebsite not yet implemented")
+func (sp *ServiceServer) DeleteWebsite(ctx context.Context, r *ProtoIDRequest) (*types.Empty, error) {
+	err := sp.service.DeleteWebsite(r.ID)
+	if sp.Log != nil && sp.Log.IsInfo() {
+		sp.Log.Info("store.ServiceServer.DeleteWebsite", log.Err(err), log.Stringer("request", r))
+	}
+	if err != nil {
+		sp.RecordError(ctx)
+		return nil, status.Error(modificationCode(err), err.Error())
+	}
+	return &types.Empty{}, nil
 }
 
 func (sp *ServiceServer) WebsiteByID(ctx context.Context, r *ProtoIDRequest) (*StoreWebsite, error) {
@@ -165,8 +173,16 @@ func (sp *ServiceServer) AddGroup(ctx context.Context, r *StoreGroup) (*types.Em
 	return &types.Empty{}, nil
 }
 
-func (sp *ServiceServer) DeleteGroup(context.Context, *ProtoIDRequest) (*types.Empty, error) {
-	return nil, errors.NotImplemented.Newf("[store] DeleteGroup not yet implemented")
+func (sp *ServiceServer) DeleteGroup(ctx context.Context, r *ProtoIDRequest) (*types.Empty, error) {
+	err := sp.service.DeleteGroup(r.ID)
+	if sp.Log != nil && sp.Log.IsInfo() {
+		sp.Log.Info("store.ServiceServer.DeleteGroup", log.Err(err), log.Stringer("request", r))
+	}
+	if err != nil {
+		sp.RecordError(ctx)
+		return nil, status.Error(modificationCode(err), err.Error())
+	}
+	return &types.Empty{}, nil
 }
 
 func (sp *ServiceServer) GroupByID(ctx context.Context, r *ProtoIDRequest) (*StoreGroup, error) {
@@ -198,8 +214,16 @@ func (sp *ServiceServer) AddStore(ctx context.Context, r *Store) (*types.Empty,
 	return &types.Empty{}, nil
 }
 
-func (sp *ServiceServer) DeleteStore(context.Context, *ProtoIDRequest) (*types.Empty, error) {
-	return nil, errors.NotImplemented.Newf("[store] DeleteStore not yet implemented")
+func (sp *ServiceServer) DeleteStore(ctx context.Context, r *ProtoIDRequest) (*types.Empty, error) {
+	err := sp.service.DeleteStore(r.ID)
+	if sp.Log != nil && sp.Log.IsInfo() {
+		sp.Log.Info("store.ServiceServer.DeleteStore", log.Err(err), log.Stringer("request", r))
+	}
+	if err != nil {
+		sp.RecordError(ctx)
+		return nil, status.Error(modificationCode(err), err.Error())
+	}
+	return &types.Empty{}, nil
 }
 
 func (sp *ServiceServer) StoreByID(ctx context.Context, r *ProtoIDRequest) (*Store, error) {
@@ -218,3 +242,14 @@ func (sp *ServiceServer) ListStores(ctx context.Context, _ *types.Empty) (*Store
 	d := sp.service.Stores()
 	return &d, nil
 }
+
+// modificationCode maps the error of a Delete* function to a gRPC status code.
+func modificationCode(err error) codes.Code {
+	switch {
+	case errors.NotFound.Match(err):
+		return codes.NotFound
+	case errors.NotAllowed.Match(err):
+		return codes.FailedPrecondition
+	}
+	return codes.InvalidArgument
+}
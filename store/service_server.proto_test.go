@@ -90,7 +90,7 @@ func initServer(t *testing.T) (port int, _ func()) {
 	}()
 	return port, func() {
 		t.Run("FinishedSpans Server", func(t *testing.T) {
-			assert.Len(t, mockTracerServer.FinishedSpans(), 26)
+			assert.Len(t, mockTracerServer.FinishedSpans(), 31)
 		})
 		s.Stop()
 		lis.Close() // do not check for error "close tcp 127.0.0.1:61497: use of closed network connection"; no idea
@@ -114,7 +114,7 @@ func initClient(t *testing.T, port int) (store.StoreServiceClient, func()) {
 	client := store.NewStoreServiceClient(conn)
 	return client, func() {
 		t.Run("FinishedSpans Client", func(t *testing.T) {
-			assert.Len(t, mockTracerClient.FinishedSpans(), 26)
+			assert.Len(t, mockTracerClient.FinishedSpans(), 31)
 		})
 		cstesting.Close(t, conn)
 	}
@@ -310,4 +310,25 @@ func TestNewServiceRPC(t *testing.T) {
 		assert.Exactly(t, "nz", protoWs.Data[6].Code)
 		assert.Exactly(t, "mo", protoWs.Data[7].Code)
 	})
+
+	t.Run("DeleteStore_OK", func(t *testing.T) {
+		_, err := client.DeleteStore(ctxToken, &store.ProtoIDRequest{ID: 6})
+		assert.NoError(t, err)
+	})
+	t.Run("DeleteStore_Err", func(t *testing.T) {
+		_, err := client.DeleteStore(ctxToken, &store.ProtoIDRequest{ID: 2})
+		assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = [store] Store ID 2 is the admin or default store and cannot be deleted")
+	})
+	t.Run("DeleteGroup_Err", func(t *testing.T) {
+		_, err := client.DeleteGroup(ctxToken, &store.ProtoIDRequest{ID: 1})
+		assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = [store] Group ID 1 is the admin or default group and cannot be deleted")
+	})
+	t.Run("DeleteWebsite_OK", func(t *testing.T) {
+		_, err := client.DeleteWebsite(ctxToken, &store.ProtoIDRequest{ID: 3})
+		assert.NoError(t, err)
+	})
+	t.Run("DeleteWebsite_Err", func(t *testing.T) {
+		_, err := client.DeleteWebsite(ctxToken, &store.ProtoIDRequest{ID: 3})
+		assert.EqualError(t, err, "rpc error: code = NotFound desc = [store] Cannot find Website ID 3")
+	})
 }
@@ -0,0 +1,175 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// Event identifies the kind of change of the store tree which gets sent to the
+// subscribers.
+type Event uint8
+
+// Events which get sent to the subscribers.
+const (
+	// EventOptionsApplied gets sent after Service.Options has been called.
+	EventOptionsApplied Event = iota + 1
+	// EventClosed gets sent when the Service gets closed. It is always the
+	// last event a ChangeReceiver receives.
+	EventClosed
+	// EventDeleted gets sent after a website, group or store has been deleted.
+	EventDeleted
+	// EventUpdated gets sent after a website, group or store has been updated.
+	EventUpdated
+	// EventReloaded gets sent after the store tree has been replaced by
+	// Service.Reload.
+	EventReloaded
+)
+
+func (e Event) String() string {
+	switch e {
+	case EventOptionsApplied:
+		return "OptionsApplied"
+	case EventClosed:
+		return "Closed"
+	case EventDeleted:
+		return "Deleted"
+	case EventUpdated:
+		return "Updated"
+	case EventReloaded:
+		return "Reloaded"
+	}
+	return fmt.Sprintf("Event(%d)", e)
+}
+
+// ChangeReceiver allows you to listen to changes of the websites, groups and
+// stores. The Service calls each ChangeReceiver in its own goroutine. Events
+// which happen while StoreChanged still runs get merged into the latest one,
+// hence a ChangeReceiver must read the current state from the Service and not
+// rely on receiving every single event. If a ChangeReceiver panics, it gets
+// removed without crashing the whole system.
+type ChangeReceiver interface {
+	// StoreChanged gets called after the store tree has been changed. If an
+	// error will be returned, the subscriber gets unsubscribed/removed.
+	StoreChanged(Event) error
+}
+
+// ChangeReceiverFunc is an adapter to allow the use of ordinary functions as
+// ChangeReceiver.
+type ChangeReceiverFunc func(Event) error
+
+// StoreChanged calls fn(e).
+func (fn ChangeReceiverFunc) StoreChanged(e Event) error {
+	return fn(e)
+}
+
+// Subscribe adds a ChangeReceiver to be called when the store tree changes.
+// Returns a unique identifier for the subscriber for later removal, or an error
+// with behaviour AlreadyClosed if the Service has been closed.
+func (s *Service) Subscribe(cr ChangeReceiver) (subscriptionID int, err error) {
+	select {
+	case <-s.chanClose:
+		return 0, errors.AlreadyClosed.Newf("[store] Service.Subscribe: Service already closed")
+	default:
+	}
+
+	subscriptionID, chanEvent := s.subscribe()
+	go func() {
+		defer s.unsubscribe(subscriptionID)
+		for {
+			var e Event
+			select {
+			case ev, ok := <-chanEvent:
+				if !ok {
+					return // unsubscribed
+				}
+				e = ev
+			case <-s.chanClose:
+				e = EventClosed
+			}
+			if err := s.sendEventRecoverable(subscriptionID, cr, e); err != nil {
+				if s.log != nil && s.log.IsDebug() {
+					s.log.Debug("store.Service.Subscribe.StoreChanged", log.Err(err), log.Int("subscription_id", subscriptionID), log.Stringer("event", e))
+				}
+				return
+			}
+			if e == EventClosed {
+				return
+			}
+		}
+	}()
+	return subscriptionID, nil
+}
+
+// Unsubscribe removes a subscriber with a specific ID. The ChangeReceiver does
+// not receive any further events. Returns an error with behaviour NotFound if
+// the ID does not exist.
+func (s *Service) Unsubscribe(subscriptionID int) error {
+	if !s.unsubscribe(subscriptionID) {
+		return errors.NotFound.Newf("[store] Service.Unsubscribe: Subscription ID %d not found", subscriptionID)
+	}
+	return nil
+}
+
+func (s *Service) sendEventRecoverable(id int, cr ChangeReceiver, e Event) (err error) {
+	defer func() { // protect ... you'll never know
+		if r := recover(); r != nil {
+			err = errors.Fatal.Newf("[store] Service.Subscribe: ChangeReceiver with subscription ID %d panicked: %v", id, r)
+		}
+	}()
+	return cr.StoreChanged(e)
+}
+
+// subscribe registers a new buffered event channel. The channel stays
+// registered until unsubscribe gets called, which closes the channel.
+func (s *Service) subscribe() (subscriptionID int, chanEvent chan Event) {
+	chanEvent = make(chan Event, 1)
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	s.subscriptionID++
+	s.subscribers[s.subscriptionID] = chanEvent
+	return s.subscriptionID, chanEvent
+}
+
+// unsubscribe removes and closes the event channel and reports whether it has
+// been registered.
+func (s *Service) unsubscribe(subscriptionID int) bool {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	chanEvent, ok := s.subscribers[subscriptionID]
+	if ok {
+		delete(s.subscribers, subscriptionID)
+		close(chanEvent)
+	}
+	return ok
+}
+
+// dispatchEvent sends the event to all subscribers without blocking. The
+// subscriber channels are buffered, if a subscriber still has an event pending,
+// the new event gets dropped because the subscriber reads the latest state of
+// the Service anyway.
+func (s *Service) dispatchEvent(e Event) {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+	for _, chanEvent := range s.subscribers {
+		select {
+		case chanEvent <- e:
+		default:
+		}
+	}
+}
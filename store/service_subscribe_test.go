@@ -0,0 +1,116 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/store"
+	storemock "github.com/weiwolves/pkg/store/mock"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func waitForEvent(t *testing.T, chanEvent <-chan store.Event, want store.Event) {
+	select {
+	case have := <-chanEvent:
+		assert.Exactly(t, want, have, "want %s have %s", want, have)
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for event %s", want)
+	}
+}
+
+func TestService_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	t.Run("events until close", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ()
+		chanEvent := make(chan store.Event, 5)
+		id, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+			chanEvent <- e
+			return nil
+		}))
+		assert.NoError(t, err)
+		assert.True(t, id > 0, "ID must be greater than zero: %d", id)
+
+		assert.NoError(t, eurSrv.DeleteStore(6))
+		waitForEvent(t, chanEvent, store.EventDeleted)
+
+		st, err := eurSrv.Store(5)
+		assert.NoError(t, err)
+		st = st.Copy()
+		st.Name = "Down Under"
+		assert.NoError(t, eurSrv.UpdateStore(st))
+		waitForEvent(t, chanEvent, store.EventUpdated)
+
+		assert.NoError(t, eurSrv.Close())
+		waitForEvent(t, chanEvent, store.EventClosed)
+
+		_, err = eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error { return nil }))
+		assert.ErrorIsKind(t, errors.AlreadyClosed, err)
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ()
+		defer eurSrv.Close()
+
+		chanEvent := make(chan store.Event, 5)
+		id, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+			chanEvent <- e
+			return nil
+		}))
+		assert.NoError(t, err)
+		assert.NoError(t, eurSrv.Unsubscribe(id))
+		assert.ErrorIsKind(t, errors.NotFound, eurSrv.Unsubscribe(id))
+
+		assert.NoError(t, eurSrv.DeleteStore(6))
+		select {
+		case e := <-chanEvent:
+			t.Fatalf("Unexpected event %s", e)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("error and panic remove the receiver", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ()
+		defer eurSrv.Close()
+
+		chanEvent := make(chan store.Event, 5)
+		idErr, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+			chanEvent <- e
+			return errors.Aborted.Newf("I'm done")
+		}))
+		assert.NoError(t, err)
+		idPanic, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+			chanEvent <- e
+			panic("Upsss")
+		}))
+		assert.NoError(t, err)
+
+		assert.NoError(t, eurSrv.DeleteStore(6))
+		waitForEvent(t, chanEvent, store.EventDeleted)
+		waitForEvent(t, chanEvent, store.EventDeleted)
+
+		time.Sleep(50 * time.Millisecond) // wait until the goroutines have been terminated
+		assert.ErrorIsKind(t, errors.NotFound, eurSrv.Unsubscribe(idErr))
+		assert.ErrorIsKind(t, errors.NotFound, eurSrv.Unsubscribe(idPanic))
+	})
+}
+
+func TestEvent_String(t *testing.T) {
+	assert.Exactly(t, "Reloaded", store.EventReloaded.String())
+	assert.Exactly(t, "Event(99)", store.Event(99).String())
+}
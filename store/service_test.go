@@ -15,8 +15,10 @@
 package store_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/corestoreio/errors"
 	"github.com/weiwolves/pkg/storage/null"
@@ -528,3 +530,138 @@ func TestNewServiceEuroOZ_WithStores(t *testing.T) {
 	)
 	assert.NoError(t, err)
 }
+
+func TestWithOnChange(t *testing.T) {
+	chanStores := make(chan int, 5)
+	eurSrv := storemock.NewServiceEuroOZ(
+		store.WithOnChange(context.Background(), func(s *store.Service) {
+			chanStores <- len(s.Stores().Data)
+		}),
+	)
+	waitFor := func(want int) {
+		select {
+		case have := <-chanStores:
+			assert.Exactly(t, want, have)
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for the change function")
+		}
+	}
+	waitFor(7)
+	assert.NoError(t, eurSrv.DeleteStore(6))
+	waitFor(6)
+	assert.NoError(t, eurSrv.Close())
+}
+
+func TestService_Reload(t *testing.T) {
+	eurSrv := storemock.NewServiceEuroOZ()
+	defer eurSrv.Close()
+
+	chanEvent := make(chan store.Event, 5)
+	_, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+		chanEvent <- e
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	oldStores := eurSrv.Stores()
+
+	// readers must not be affected by the reload
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			st, err := eurSrv.DefaultStoreView()
+			if err != nil {
+				t.Errorf("%+v", err)
+				return
+			}
+			if st.Code != "de" && st.Code != "at" {
+				t.Errorf("Unexpected default store %q", st.Code)
+				return
+			}
+			_ = eurSrv.Stores()
+		}
+	}()
+
+	assert.NoError(t, eurSrv.Reload(
+		store.WithWebsites(
+			&store.StoreWebsite{WebsiteID: 0, Code: "admin", Name: null.MakeString("Admin")},
+			&store.StoreWebsite{WebsiteID: 1, Code: "euro", Name: null.MakeString("Europe"), DefaultGroupID: 1, IsDefault: true},
+		),
+		store.WithGroups(
+			&store.StoreGroup{GroupID: 0, WebsiteID: 0, Name: "Default", Code: "admin"},
+			&store.StoreGroup{GroupID: 1, WebsiteID: 1, Name: "DACH Group", Code: "dach", RootCategoryID: 2, DefaultStoreID: 1},
+		),
+		store.WithStores(
+			&store.Store{StoreID: 0, Code: "admin", Name: "Admin", IsActive: true},
+			&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, Name: "Germany", SortOrder: 10, IsActive: true},
+		),
+	))
+	<-done
+	waitForEvent(t, chanEvent, store.EventReloaded)
+
+	assert.Exactly(t, []uint32{0, 1}, websiteIDs(eurSrv))
+	assert.Exactly(t, []uint32{0, 1}, groupIDs(eurSrv))
+	assert.Exactly(t, []uint32{0, 1}, storeIDs(eurSrv))
+	assert.Exactly(t, []uint32{0, 1, 2, 3, 4, 5, 6}, oldStores.StoreIDs(), "Previously returned slice must not change")
+
+	_, err = eurSrv.Store(5)
+	assert.ErrorIsKind(t, errors.NotFound, err)
+	st, err := eurSrv.DefaultStoreView()
+	assert.NoError(t, err)
+	assert.Exactly(t, "de", st.Code)
+	w, err := eurSrv.Website(1)
+	assert.NoError(t, err)
+	assert.Exactly(t, []uint32{1}, w.Stores.StoreIDs())
+
+	t.Run("invalid tree keeps the current one", func(t *testing.T) {
+		err := eurSrv.Reload(
+			store.WithWebsites(&store.StoreWebsite{WebsiteID: 1, Code: "euro", DefaultGroupID: 9, IsDefault: true}),
+		)
+		assert.ErrorIsKind(t, errors.NotValid, err)
+		assert.Exactly(t, []uint32{0, 1}, storeIDs(eurSrv))
+		select {
+		case e := <-chanEvent:
+			t.Fatalf("Unexpected event %s", e)
+		case <-time.After(20 * time.Millisecond):
+		}
+	})
+}
+
+func TestWithReloadInterval(t *testing.T) {
+	t.Run("invalid interval", func(t *testing.T) {
+		_, err := store.NewService(store.WithReloadInterval(context.Background(), 0, nil))
+		assert.ErrorIsKind(t, errors.NotValid, err)
+	})
+
+	t.Run("reloads", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		chanEvent := make(chan store.Event, 5)
+		chanErr := make(chan error, 1)
+		eurSrv := storemock.NewServiceEuroOZ(
+			store.WithReloadInterval(ctx, 10*time.Millisecond, chanErr,
+				store.WithWebsites(&store.StoreWebsite{WebsiteID: 1, Code: "euro", DefaultGroupID: 1, IsDefault: true}),
+				store.WithGroups(&store.StoreGroup{GroupID: 1, WebsiteID: 1, Code: "dach", DefaultStoreID: 1}),
+				store.WithStores(&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, IsActive: true}),
+			),
+		)
+		defer eurSrv.Close()
+		_, err := eurSrv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+			if e == store.EventReloaded {
+				chanEvent <- e
+			}
+			return nil
+		}))
+		assert.NoError(t, err)
+
+		waitForEvent(t, chanEvent, store.EventReloaded)
+		assert.Exactly(t, []uint32{1}, storeIDs(eurSrv))
+		select {
+		case err := <-chanErr:
+			t.Fatalf("%+v", err)
+		default:
+		}
+	})
+}
@@ -0,0 +1,481 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"sync/atomic"
+
+	"github.com/corestoreio/errors"
+)
+
+// DeleteWebsite removes a website and cascades the deletion to all of its
+// groups and stores. The admin website with ID 0 and the default website
+// cannot be deleted, an error of kind NotAllowed gets returned. An unknown ID
+// returns a NotFound error. On success the caches get cleared and the
+// subscribers, like WithSaveToDB, receive an event.
+func (s *Service) DeleteWebsite(id uint32) error {
+	return s.modify(EventDeleted, func(tree *Service) error {
+		w := tree.websites.findByID(id)
+		if w == nil {
+			return errors.NotFound.Newf("[store] Cannot find Website ID %d", id)
+		}
+		if id == 0 || w.IsDefault {
+			return errors.NotAllowed.Newf("[store] Website ID %d is the admin or default website and cannot be deleted", id)
+		}
+		tree.websites.Filter(func(w *StoreWebsite) bool { return w.WebsiteID != id })
+		tree.groups.Filter(func(g *StoreGroup) bool { return g.WebsiteID != id })
+		tree.stores.Filter(func(st *Store) bool { return st.WebsiteID != id })
+		return nil
+	})
+}
+
+// DeleteGroup removes a group and cascades the deletion to all of its stores.
+// The admin group with ID 0 and the default group of the default website
+// cannot be deleted. If the group is the default group of its website, the
+// website's DefaultGroupID gets re-pointed to the next available group of that
+// website. Deleting the last group of a website is not allowed, delete the
+// website instead.
+func (s *Service) DeleteGroup(id uint32) error {
+	return s.modify(EventDeleted, func(tree *Service) error {
+		g := tree.groups.findByID(id)
+		if g == nil {
+			return errors.NotFound.Newf("[store] Cannot find Group ID %d", id)
+		}
+		if _, dgID, _ := tree.defaultIDs(); id == 0 || id == dgID {
+			return errors.NotAllowed.Newf("[store] Group ID %d is the admin or default group and cannot be deleted", id)
+		}
+		if w := tree.websites.findByID(g.WebsiteID); w != nil && w.DefaultGroupID == id {
+			var next *StoreGroup
+			for _, g2 := range tree.groups.Data {
+				if g2.WebsiteID == g.WebsiteID && g2.GroupID != id {
+					next = g2
+					break
+				}
+			}
+			if next == nil {
+				return errors.NotAllowed.Newf("[store] Group ID %d is the last group of Website ID %d. Delete the website instead.", id, g.WebsiteID)
+			}
+			w2 := w.Copy()
+			w2.DefaultGroupID = next.GroupID
+			tree.websites.replace(w2)
+		}
+		tree.groups.Filter(func(g *StoreGroup) bool { return g.GroupID != id })
+		tree.stores.Filter(func(st *Store) bool { return st.GroupID != id })
+		return nil
+	})
+}
+
+// DeleteStore removes a store. The admin store with ID 0 and the default store
+// view cannot be deleted. If the store is the default store of its group, the
+// group's DefaultStoreID gets re-pointed to the next active store of that
+// group, or if none is active, to the next store. Deleting the last store of
+// a group is not allowed, delete the group instead.
+func (s *Service) DeleteStore(id uint32) error {
+	return s.modify(EventDeleted, func(tree *Service) error {
+		st := tree.stores.findByID(id)
+		if st == nil {
+			return errors.NotFound.Newf("[store] Cannot find Store ID %d", id)
+		}
+		if _, _, dsID := tree.defaultIDs(); id == 0 || id == dsID {
+			return errors.NotAllowed.Newf("[store] Store ID %d is the admin or default store and cannot be deleted", id)
+		}
+		if g := tree.groups.findByID(st.GroupID); g != nil && g.DefaultStoreID == id {
+			var next *Store
+			for _, st2 := range tree.stores.Data {
+				if st2.GroupID == st.GroupID && st2.StoreID != id && (next == nil || (!next.IsActive && st2.IsActive)) {
+					next = st2
+				}
+			}
+			if next == nil {
+				return errors.NotAllowed.Newf("[store] Store ID %d is the last store of Group ID %d. Delete the group instead.", id, st.GroupID)
+			}
+			g2 := g.Copy()
+			g2.DefaultStoreID = next.StoreID
+			tree.groups.replace(g2)
+		}
+		tree.stores.Filter(func(st *Store) bool { return st.StoreID != id })
+		return nil
+	})
+}
+
+// UpdateWebsite replaces an existing website in-place. The website must exist,
+// otherwise a NotFound error gets returned. Its DefaultGroupID must point to a
+// group of the same website. Setting IsDefault moves the default flag from the
+// current default website to this one. Removing the flag from the default
+// website is not allowed, mark another website as default instead.
+func (s *Service) UpdateWebsite(w *StoreWebsite) error {
+	if err := w.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	return s.modify(EventUpdated, func(tree *Service) error {
+		old := tree.websites.findByID(w.WebsiteID)
+		if old == nil {
+			return errors.NotFound.Newf("[store] Cannot find Website ID %d", w.WebsiteID)
+		}
+		if old.IsDefault && !w.IsDefault {
+			return errors.NotAllowed.Newf("[store] Website ID %d is the default website. Set another website as default instead.", w.WebsiteID)
+		}
+		if g := tree.groups.findByID(w.DefaultGroupID); g == nil || g.WebsiteID != w.WebsiteID {
+			return errors.NotValid.Newf("[store] Website[%d].DefaultGroupID[%d] not found in the groups of the website.", w.WebsiteID, w.DefaultGroupID)
+		}
+		if w.IsDefault && !old.IsDefault {
+			for _, w2 := range tree.websites.Data {
+				if w2.IsDefault {
+					w2 = w2.Copy()
+					w2.IsDefault = false
+					tree.websites.replace(w2)
+				}
+			}
+		}
+		w2 := w.Copy()
+		w2.Stores = nil
+		w2.StoreGroups = nil
+		tree.websites.replace(w2)
+		return nil
+	})
+}
+
+// UpdateGroup replaces an existing group in-place. The group must exist,
+// otherwise a NotFound error gets returned. Its DefaultStoreID must point to a
+// store of the same group. Moving a group to another website moves all of its
+// stores too, but the default group of a website cannot be moved.
+func (s *Service) UpdateGroup(g *StoreGroup) error {
+	if err := g.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	return s.modify(EventUpdated, func(tree *Service) error {
+		old := tree.groups.findByID(g.GroupID)
+		if old == nil {
+			return errors.NotFound.Newf("[store] Cannot find Group ID %d", g.GroupID)
+		}
+		if st := tree.stores.findByID(g.DefaultStoreID); st == nil || st.GroupID != g.GroupID {
+			return errors.NotValid.Newf("[store] Group[%d].DefaultStoreID[%d] not found in the stores of the group.", g.GroupID, g.DefaultStoreID)
+		}
+		if old.WebsiteID != g.WebsiteID {
+			if w := tree.websites.findByID(old.WebsiteID); w != nil && w.DefaultGroupID == g.GroupID {
+				return errors.NotAllowed.Newf("[store] Group ID %d is the default group of Website ID %d and cannot be moved", g.GroupID, old.WebsiteID)
+			}
+			for _, st := range tree.stores.Data {
+				if st.GroupID == g.GroupID {
+					st = st.Copy()
+					st.WebsiteID = g.WebsiteID
+					tree.stores.replace(st)
+				}
+			}
+		}
+		g2 := g.Copy()
+		g2.StoreWebsite = nil
+		tree.groups.replace(g2)
+		return nil
+	})
+}
+
+// UpdateStore replaces an existing store in-place. The store must exist,
+// otherwise a NotFound error gets returned. Its WebsiteID must match the
+// website of its group. The default store of a group cannot be moved to
+// another group and the default store view cannot be deactivated.
+func (s *Service) UpdateStore(st *Store) error {
+	if err := st.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	return s.modify(EventUpdated, func(tree *Service) error {
+		old := tree.stores.findByID(st.StoreID)
+		if old == nil {
+			return errors.NotFound.Newf("[store] Cannot find Store ID %d", st.StoreID)
+		}
+		if g := tree.groups.findByID(st.GroupID); g == nil || g.WebsiteID != st.WebsiteID {
+			return errors.NotValid.Newf("[store] Store[%d].GroupID[%d] not found in the groups of Website ID %d.", st.StoreID, st.GroupID, st.WebsiteID)
+		}
+		if old.GroupID != st.GroupID {
+			if g := tree.groups.findByID(old.GroupID); g != nil && g.DefaultStoreID == st.StoreID {
+				return errors.NotAllowed.Newf("[store] Store ID %d is the default store of Group ID %d and cannot be moved", st.StoreID, old.GroupID)
+			}
+		}
+		if _, _, dsID := tree.defaultIDs(); dsID == st.StoreID && !st.IsActive {
+			return errors.NotAllowed.Newf("[store] Store ID %d is the default store and cannot be deactivated", st.StoreID)
+		}
+		st2 := st.Copy()
+		st2.StoreGroup = nil
+		st2.StoreWebsite = nil
+		tree.stores.replace(st2)
+		return nil
+	})
+}
+
+// modify runs fn on a copy of the store tree, fn must not modify the entities
+// in-place but replace them with a copy. The modified tree gets validated and
+// swapped at once under the write lock, like Reload does, hence readers never
+// see a partially modified or an invalid tree. Modifications run one after
+// another. On success the caches get cleared, the changed entities get
+// recorded for WithSaveToDB and the event gets dispatched to the subscribers.
+func (s *Service) modify(e Event, fn func(tree *Service) error) error {
+	s.modMu.Lock()
+	defer s.modMu.Unlock()
+
+	cur := &Service{}
+	next := newService()
+	next.log = s.log
+	defer close(next.chanClose)
+	s.mu.RLock()
+	cur.websites, cur.groups, cur.stores = s.websites, s.groups, s.stores
+	next.websites.Data = append([]*StoreWebsite(nil), s.websites.Data...)
+	next.groups.Data = append([]*StoreGroup(nil), s.groups.Data...)
+	next.stores.Data = append([]*Store(nil), s.stores.Data...)
+	s.mu.RUnlock()
+
+	if err := fn(next); err != nil {
+		return errors.WithStack(err)
+	}
+	cs := newChangeSet()
+	cs.diff(cur, next)
+
+	// apply2ndLevelData changes the entities, so the readers of the current
+	// tree must not see them.
+	for i, w := range next.websites.Data {
+		w = w.Copy()
+		w.Stores = nil
+		w.StoreGroups = nil
+		next.websites.Data[i] = w
+	}
+	for i, g := range next.groups.Data {
+		next.groups.Data[i] = g.Copy()
+	}
+	for i, st := range next.stores.Data {
+		next.stores.Data[i] = st.Copy()
+	}
+	next.sort()
+	next.apply2ndLevelData()
+	if err := next.validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.mu.Lock()
+	s.websites = next.websites
+	s.groups = next.groups
+	s.stores = next.stores
+	s.resetCaches()
+	s.mu.Unlock()
+
+	s.recordChanges(cs)
+	s.dispatchEvent(e)
+	return nil
+}
+
+// changeSet collects the upserted and the deleted entities of modifications
+// until WithSaveToDB writes them. A nil entity marks a deletion.
+type changeSet struct {
+	websites map[uint32]*StoreWebsite
+	groups   map[uint32]*StoreGroup
+	stores   map[uint32]*Store
+}
+
+func newChangeSet() *changeSet {
+	return &changeSet{
+		websites: make(map[uint32]*StoreWebsite),
+		groups:   make(map[uint32]*StoreGroup),
+		stores:   make(map[uint32]*Store),
+	}
+}
+
+// merge adds the newer changes of o.
+func (cs *changeSet) merge(o *changeSet) {
+	for id, w := range o.websites {
+		cs.websites[id] = w
+	}
+	for id, g := range o.groups {
+		cs.groups[id] = g
+	}
+	for id, st := range o.stores {
+		cs.stores[id] = st
+	}
+}
+
+// diff records the entities which have been added or replaced in next and the
+// entities which are missing in next.
+func (cs *changeSet) diff(cur, next *Service) {
+	curWebsites := make(map[uint32]*StoreWebsite, len(cur.websites.Data))
+	for _, w := range cur.websites.Data {
+		curWebsites[w.WebsiteID] = w
+	}
+	for _, w := range next.websites.Data {
+		if curWebsites[w.WebsiteID] != w {
+			cs.websites[w.WebsiteID] = w
+		}
+		delete(curWebsites, w.WebsiteID)
+	}
+	for id := range curWebsites {
+		cs.websites[id] = nil
+	}
+
+	curGroups := make(map[uint32]*StoreGroup, len(cur.groups.Data))
+	for _, g := range cur.groups.Data {
+		curGroups[g.GroupID] = g
+	}
+	for _, g := range next.groups.Data {
+		if curGroups[g.GroupID] != g {
+			cs.groups[g.GroupID] = g
+		}
+		delete(curGroups, g.GroupID)
+	}
+	for id := range curGroups {
+		cs.groups[id] = nil
+	}
+
+	curStores := make(map[uint32]*Store, len(cur.stores.Data))
+	for _, st := range cur.stores.Data {
+		curStores[st.StoreID] = st
+	}
+	for _, st := range next.stores.Data {
+		if curStores[st.StoreID] != st {
+			cs.stores[st.StoreID] = st
+		}
+		delete(curStores, st.StoreID)
+	}
+	for id := range curStores {
+		cs.stores[id] = nil
+	}
+}
+
+// trackChanges starts collecting the changes for the subscription ID.
+func (s *Service) trackChanges(subscriptionID int) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	if s.changes == nil {
+		s.changes = make(map[int]*changeSet)
+	}
+	s.changes[subscriptionID] = newChangeSet()
+}
+
+// untrackChanges stops collecting the changes for the subscription ID.
+func (s *Service) untrackChanges(subscriptionID int) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	delete(s.changes, subscriptionID)
+}
+
+// recordChanges adds the changes to all tracking subscriptions.
+func (s *Service) recordChanges(cs *changeSet) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	for _, c := range s.changes {
+		c.merge(cs)
+	}
+}
+
+// takeChanges returns the collected changes of the subscription ID and starts
+// a new collection.
+func (s *Service) takeChanges(subscriptionID int) *changeSet {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	cs := s.changes[subscriptionID]
+	if cs == nil {
+		return newChangeSet()
+	}
+	s.changes[subscriptionID] = newChangeSet()
+	return cs
+}
+
+// returnChanges puts changes, which could not be written, back in front of the
+// changes collected in the meantime.
+func (s *Service) returnChanges(subscriptionID int, cs *changeSet) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	c, ok := s.changes[subscriptionID]
+	if !ok {
+		return
+	}
+	cs.merge(c)
+	s.changes[subscriptionID] = cs
+}
+
+// resetCaches clears the website, group and store caches and the default store
+// ID. The caller must hold the write lock.
+func (s *Service) resetCaches() {
+	s.cacheWebsite = make(map[uint32]*StoreWebsite, len(s.websites.Data))
+	s.cacheGroup = make(map[uint32]*StoreGroup, len(s.groups.Data))
+	s.cacheStore = make(map[uint32]*Store, len(s.stores.Data))
+	atomic.StoreInt64(&s.defaultStoreID, -1)
+}
+
+// defaultIDs returns the IDs of the default website, its default group and the
+// default store of that group. The caller must hold the lock.
+func (s *Service) defaultIDs() (websiteID, groupID, storeID uint32) {
+	// use a value which cannot be an ID because 0 is the admin entity.
+	websiteID, groupID, storeID = ^uint32(0), ^uint32(0), ^uint32(0)
+	for _, w := range s.websites.Data {
+		if w.IsDefault {
+			websiteID, groupID = w.WebsiteID, w.DefaultGroupID
+			if g := s.groups.findByID(groupID); g != nil {
+				storeID = g.DefaultStoreID
+			}
+			return
+		}
+	}
+	return
+}
+
+func (cc *StoreWebsites) findByID(id uint32) *StoreWebsite {
+	for _, w := range cc.Data {
+		if w.WebsiteID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+func (cc *StoreWebsites) replace(w *StoreWebsite) {
+	for i, w2 := range cc.Data {
+		if w2.WebsiteID == w.WebsiteID {
+			cc.Data[i] = w
+			return
+		}
+	}
+}
+
+func (cc *StoreGroups) findByID(id uint32) *StoreGroup {
+	for _, g := range cc.Data {
+		if g.GroupID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+func (cc *StoreGroups) replace(g *StoreGroup) {
+	for i, g2 := range cc.Data {
+		if g2.GroupID == g.GroupID {
+			cc.Data[i] = g
+			return
+		}
+	}
+}
+
+func (cc *Stores) findByID(id uint32) *Store {
+	for _, st := range cc.Data {
+		if st.StoreID == id {
+			return st
+		}
+	}
+	return nil
+}
+
+func (cc *Stores) replace(st *Store) {
+	for i, st2 := range cc.Data {
+		if st2.StoreID == st.StoreID {
+			cc.Data[i] = st
+			return
+		}
+	}
+}
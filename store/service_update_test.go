@@ -0,0 +1,219 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/storage/null"
+	"github.com/weiwolves/pkg/store"
+	storemock "github.com/weiwolves/pkg/store/mock"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func websiteIDs(srv *store.Service) []uint32 {
+	ws := srv.Websites()
+	return ws.WebsiteIDs()
+}
+
+func groupIDs(srv *store.Service) []uint32 {
+	gs := srv.Groups()
+	return gs.GroupIDs()
+}
+
+func storeIDs(srv *store.Service) []uint32 {
+	sts := srv.Stores()
+	return sts.StoreIDs()
+}
+
+func TestService_DeleteWebsite(t *testing.T) {
+	t.Parallel()
+	eurSrv := storemock.NewServiceEuroOZ()
+
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteWebsite(0))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteWebsite(1))
+	assert.ErrorIsKind(t, errors.NotFound, eurSrv.DeleteWebsite(99))
+
+	w, err := eurSrv.Website(2)
+	assert.NoError(t, err)
+	assert.Exactly(t, "oz", w.Code)
+
+	assert.NoError(t, eurSrv.DeleteWebsite(2))
+	assert.Exactly(t, []uint32{0, 1}, websiteIDs(eurSrv))
+	assert.Exactly(t, []uint32{0, 1, 2}, groupIDs(eurSrv))
+	assert.Exactly(t, []uint32{0, 1, 2, 3, 4}, storeIDs(eurSrv))
+
+	_, err = eurSrv.Website(2)
+	assert.ErrorIsKind(t, errors.NotFound, err)
+	_, err = eurSrv.Store(6)
+	assert.ErrorIsKind(t, errors.NotFound, err)
+
+	w, err = eurSrv.Website(1)
+	assert.NoError(t, err)
+	assert.Exactly(t, []uint32{1, 2, 3, 4}, w.Stores.StoreIDs())
+}
+
+func TestService_DeleteGroup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not allowed", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ()
+		assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteGroup(0))
+		assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteGroup(1)) // default group
+		assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteGroup(3)) // last group of website 2
+		assert.ErrorIsKind(t, errors.NotFound, eurSrv.DeleteGroup(99))
+		assert.Exactly(t, []uint32{0, 1, 2, 3}, groupIDs(eurSrv))
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ()
+		assert.NoError(t, eurSrv.DeleteGroup(2))
+		assert.Exactly(t, []uint32{0, 1, 3}, groupIDs(eurSrv))
+		assert.Exactly(t, []uint32{0, 1, 2, 3, 5, 6}, storeIDs(eurSrv))
+	})
+
+	t.Run("re-point default group", func(t *testing.T) {
+		eurSrv := storemock.NewServiceEuroOZ(
+			store.WithGroups(&store.StoreGroup{GroupID: 4, WebsiteID: 2, Name: `New Zealand`, Code: `nz`, RootCategoryID: 2, DefaultStoreID: 7}),
+			store.WithStores(&store.Store{StoreID: 7, Code: `wlg`, WebsiteID: 2, GroupID: 4, Name: `Wellington`, SortOrder: 40, IsActive: true}),
+		)
+		assert.NoError(t, eurSrv.DeleteGroup(3))
+		w, err := eurSrv.Website(2)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint32(4), w.DefaultGroupID)
+		assert.Exactly(t, []uint32{4}, w.StoreGroups.GroupIDs())
+		assert.Exactly(t, []uint32{7}, w.Stores.StoreIDs())
+	})
+}
+
+func TestService_DeleteStore(t *testing.T) {
+	t.Parallel()
+	eurSrv := storemock.NewServiceEuroOZ()
+
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteStore(0))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteStore(2)) // default store view
+	assert.ErrorIsKind(t, errors.NotFound, eurSrv.DeleteStore(99))
+
+	assert.NoError(t, eurSrv.DeleteStore(5))
+	g, err := eurSrv.Group(3)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint32(6), g.DefaultStoreID)
+
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.DeleteStore(6)) // last store of group 3
+
+	wID, sID, err := eurSrv.DefaultStoreID(0)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint32(1), wID)
+	assert.Exactly(t, uint32(2), sID)
+	assert.Exactly(t, []uint32{0, 1, 2, 3, 4, 6}, storeIDs(eurSrv))
+}
+
+func TestService_UpdateWebsite(t *testing.T) {
+	t.Parallel()
+	eurSrv := storemock.NewServiceEuroOZ()
+
+	st, err := eurSrv.DefaultStoreView()
+	assert.NoError(t, err)
+	assert.Exactly(t, "at", st.Code)
+
+	assert.ErrorIsKind(t, errors.NotFound, eurSrv.UpdateWebsite(
+		&store.StoreWebsite{WebsiteID: 99, Code: `mars`, DefaultGroupID: 3},
+	))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.UpdateWebsite(
+		&store.StoreWebsite{WebsiteID: 1, Code: `euro`, Name: null.MakeString(`Europe`), DefaultGroupID: 1, IsDefault: false},
+	))
+	assert.ErrorIsKind(t, errors.NotValid, eurSrv.UpdateWebsite(
+		&store.StoreWebsite{WebsiteID: 2, Code: `oz`, Name: null.MakeString(`OZ`), DefaultGroupID: 1},
+	))
+
+	assert.NoError(t, eurSrv.UpdateWebsite(
+		&store.StoreWebsite{WebsiteID: 2, Code: `oceania`, Name: null.MakeString(`Oceania`), SortOrder: 20, DefaultGroupID: 3, IsDefault: true},
+	))
+	w, err := eurSrv.Website(1)
+	assert.NoError(t, err)
+	assert.False(t, w.IsDefault)
+	w, err = eurSrv.Website(2)
+	assert.NoError(t, err)
+	assert.True(t, w.IsDefault)
+	assert.Exactly(t, "oceania", w.Code)
+	assert.Exactly(t, []uint32{5, 6}, w.Stores.StoreIDs())
+
+	st, err = eurSrv.DefaultStoreView()
+	assert.NoError(t, err)
+	assert.Exactly(t, "au", st.Code)
+	assert.Exactly(t, "oceania", st.StoreWebsite.Code)
+}
+
+func TestService_UpdateGroup(t *testing.T) {
+	t.Parallel()
+	eurSrv := storemock.NewServiceEuroOZ()
+
+	assert.ErrorIsKind(t, errors.NotFound, eurSrv.UpdateGroup(
+		&store.StoreGroup{GroupID: 99, WebsiteID: 1, Code: `xx`, DefaultStoreID: 1},
+	))
+	assert.ErrorIsKind(t, errors.NotValid, eurSrv.UpdateGroup(
+		&store.StoreGroup{GroupID: 1, WebsiteID: 1, Name: `DACH Group`, Code: `dach`, RootCategoryID: 2, DefaultStoreID: 5},
+	))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.UpdateGroup(
+		&store.StoreGroup{GroupID: 1, WebsiteID: 2, Name: `DACH Group`, Code: `dach`, RootCategoryID: 2, DefaultStoreID: 2},
+	))
+
+	assert.NoError(t, eurSrv.UpdateGroup(
+		&store.StoreGroup{GroupID: 2, WebsiteID: 2, Name: `UK Group`, Code: `uk`, RootCategoryID: 3, DefaultStoreID: 4},
+	))
+	st, err := eurSrv.Store(4)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint32(2), st.WebsiteID)
+	assert.Exactly(t, uint32(3), st.StoreGroup.RootCategoryID)
+
+	w, err := eurSrv.Website(2)
+	assert.NoError(t, err)
+	assert.Exactly(t, []uint32{2, 3}, w.StoreGroups.GroupIDs())
+	assert.Exactly(t, []uint32{4, 5, 6}, w.Stores.StoreIDs())
+}
+
+func TestService_UpdateStore(t *testing.T) {
+	t.Parallel()
+	eurSrv := storemock.NewServiceEuroOZ()
+
+	assert.ErrorIsKind(t, errors.NotFound, eurSrv.UpdateStore(
+		&store.Store{StoreID: 99, Code: `xx`, WebsiteID: 1, GroupID: 1},
+	))
+	assert.ErrorIsKind(t, errors.NotValid, eurSrv.UpdateStore(
+		&store.Store{StoreID: 1, Code: `de`, WebsiteID: 1, GroupID: 3, Name: `Germany`, IsActive: true},
+	))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.UpdateStore(
+		&store.Store{StoreID: 4, Code: `uk`, WebsiteID: 1, GroupID: 1, Name: `UK`, IsActive: true},
+	))
+	assert.ErrorIsKind(t, errors.NotAllowed, eurSrv.UpdateStore(
+		&store.Store{StoreID: 2, Code: `at`, WebsiteID: 1, GroupID: 1, Name: `Österreich`, IsActive: false},
+	))
+
+	assert.NoError(t, eurSrv.UpdateStore(
+		&store.Store{StoreID: 1, Code: `de`, WebsiteID: 1, GroupID: 2, Name: `Deutschland`, SortOrder: 10, IsActive: true},
+	))
+	st, err := eurSrv.Store(1)
+	assert.NoError(t, err)
+	assert.Exactly(t, "Deutschland", st.Name)
+	assert.Exactly(t, "uk", st.StoreGroup.Code)
+
+	g, err := eurSrv.Group(1)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint32(2), g.DefaultStoreID)
+	w, err := eurSrv.Website(1)
+	assert.NoError(t, err)
+	assert.Exactly(t, []uint32{2, 3, 1, 4}, w.Stores.StoreIDs()) // sorted by group
+}
@@ -0,0 +1,109 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storebinlog
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/store"
+)
+
+// reloaderCount makes the handler name unique per Reloader.
+var reloaderCount uint64
+
+// Reloader implements mycanal.RowsEventHandler. Every row change of the tables
+// store, store_group and store_website triggers a reload of the store tree
+// from the database, see store.Service.Reload. Row changes which arrive while a
+// reload runs get merged into one further reload.
+type Reloader struct {
+	name       string
+	chanReload chan struct{}
+}
+
+func newReloader() *Reloader {
+	return &Reloader{
+		name:       "storebinlog.Reloader." + strconv.FormatUint(atomic.AddUint64(&reloaderCount, 1), 10),
+		chanReload: make(chan struct{}, 1),
+	}
+}
+
+// Register adds a new Reloader as RowsEventHandler to the canal and starts
+// reloading the Service. Errors of the reload get sent to chanErr, if not nil.
+// The Reloader gets deregistered when the context gets cancelled or the
+// Service gets closed. Returns an error with behaviour AlreadyClosed if the
+// Service has been closed. This function panics if the tables do not exists in
+// the ddl.Tables object.
+func Register(ctx context.Context, c *mycanal.Canal, srv *store.Service, tbls *ddl.Tables, chanErr chan<- error) (*Reloader, error) {
+	tableNames := []string{
+		tbls.MustTable(store.TableNameStore).Name,
+		tbls.MustTable(store.TableNameStoreGroup).Name,
+		tbls.MustTable(store.TableNameStoreWebsite).Name,
+	}
+
+	chanClosed := make(chan struct{})
+	subscriptionID, err := srv.Subscribe(store.ChangeReceiverFunc(func(e store.Event) error {
+		if e == store.EventClosed {
+			close(chanClosed)
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	loadFromDB := store.WithLoadFromDB(ctx, tbls)
+	r := newReloader()
+	c.RegisterRowsEventHandler(tableNames, r)
+
+	go func() {
+		defer c.DeregisterRowsEventHandler(tableNames, r.String())
+		for {
+			select {
+			case <-r.chanReload:
+			case <-ctx.Done():
+				_ = srv.Unsubscribe(subscriptionID)
+				return
+			case <-chanClosed:
+				return
+			}
+			if err := srv.Reload(loadFromDB); err != nil && chanErr != nil {
+				chanErr <- errors.WithStack(err)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Do signals a reload without blocking the canal.
+func (r *Reloader) Do(_ context.Context, _ string, _ *ddl.Table, _ [][]interface{}) error {
+	select {
+	case r.chanReload <- struct{}{}:
+	default: // a reload is already pending
+	}
+	return nil
+}
+
+// Complete does nothing.
+func (r *Reloader) Complete(_ context.Context) error { return nil }
+
+// String returns the unique name of the RowsEventHandler.
+func (r *Reloader) String() string { return r.name }
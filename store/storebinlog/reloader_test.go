@@ -0,0 +1,148 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storebinlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/sql/mycanal"
+	"github.com/weiwolves/pkg/store"
+	"github.com/weiwolves/pkg/store/storebinlog"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newStoreTables(t *testing.T, dbc *dml.ConnPool) *ddl.Tables {
+	tbls, err := ddl.NewTables(
+		ddl.WithConnPool(dbc),
+		ddl.WithTable(store.TableNameStore, &ddl.Column{Field: "store_id", Key: "PRI"}),
+		ddl.WithTable(store.TableNameStoreGroup, &ddl.Column{Field: "group_id", Key: "PRI"}),
+		ddl.WithTable(store.TableNameStoreWebsite, &ddl.Column{Field: "website_id", Key: "PRI"}),
+	)
+	assert.NoError(t, err)
+	return tbls
+}
+
+func newService(t *testing.T) *store.Service {
+	srv, err := store.NewService(
+		store.WithWebsites(&store.StoreWebsite{WebsiteID: 1, Code: "euro", DefaultGroupID: 1, IsDefault: true}),
+		store.WithGroups(&store.StoreGroup{GroupID: 1, WebsiteID: 1, Code: "dach", DefaultStoreID: 1}),
+		store.WithStores(&store.Store{StoreID: 1, Code: "de", WebsiteID: 1, GroupID: 1, IsActive: true}),
+	)
+	assert.NoError(t, err)
+	return srv
+}
+
+func waitForHandlers(t *testing.T, c *mycanal.Canal, want int) {
+	deadline := time.Now().Add(time.Second)
+	for len(c.HandlerStats()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d RowsEventHandler, have %d", want, len(c.HandlerStats()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	tbls := newStoreTables(t, dbc)
+
+	t.Run("unique names and deregister on close", func(t *testing.T) {
+		c := new(mycanal.Canal)
+		srv := newService(t)
+
+		r1, err := storebinlog.Register(context.Background(), c, srv, tbls, nil)
+		assert.NoError(t, err)
+		r2, err := storebinlog.Register(context.Background(), c, srv, tbls, nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, r1.String(), r2.String())
+
+		hs := c.HandlerStats()
+		assert.Len(t, hs, 6)
+		names := map[string]int{}
+		for _, h := range hs {
+			names[h.Handler]++
+		}
+		assert.Exactly(t, map[string]int{r1.String(): 3, r2.String(): 3}, names)
+
+		assert.NoError(t, srv.Close())
+		waitForHandlers(t, c, 0)
+	})
+
+	t.Run("deregister on context cancel", func(t *testing.T) {
+		c := new(mycanal.Canal)
+		srv := newService(t)
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := storebinlog.Register(ctx, c, srv, tbls, nil)
+		assert.NoError(t, err)
+		assert.Len(t, c.HandlerStats(), 3)
+		cancel()
+		waitForHandlers(t, c, 0)
+	})
+
+	t.Run("service already closed", func(t *testing.T) {
+		c := new(mycanal.Canal)
+		srv := newService(t)
+		assert.NoError(t, srv.Close())
+
+		r, err := storebinlog.Register(context.Background(), c, srv, tbls, nil)
+		assert.ErrorIsKind(t, errors.AlreadyClosed, err)
+		assert.Nil(t, r)
+		assert.Len(t, c.HandlerStats(), 0)
+	})
+}
+
+func TestReloader_Do(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	tbls := newStoreTables(t, dbc)
+
+	c := new(mycanal.Canal)
+	srv := newService(t)
+	defer srv.Close()
+
+	// At most two reloads run, the second one fails with an unexpected query.
+	chanErr := make(chan error, 2)
+	r, err := storebinlog.Register(context.Background(), c, srv, tbls, chanErr)
+	assert.NoError(t, err)
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("FROM `store` AS `main_table`")).
+		WillReturnError(errors.ConnectionLost.Newf("Upsss"))
+
+	// Do must never block the canal, the signals get merged.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.Do(context.Background(), "insert", nil, nil))
+	}
+	assert.NoError(t, r.Complete(context.Background()))
+
+	select {
+	case err := <-chanErr:
+		assert.ErrorIsKind(t, errors.ConnectionLost, err)
+	case <-time.After(time.Second):
+		t.Fatal("reload has not been triggered")
+	}
+	sts := srv.Stores()
+	assert.Exactly(t, []uint32{1}, sts.StoreIDs())
+}
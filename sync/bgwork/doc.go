@@ -14,6 +14,9 @@
 
 // Package bgwork handles background work or jobs distributed over many machines.
 //
+// Durable jobs which survive a restart are provided by package
+// sync/jobqueue, which runs its workers with AutoScaling.
+//
 // TODO: gather ideas
 // - https://blog.gobuffalo.io/buffalo-v0-9-0-released-68fcf0844473
 // - https://github.com/gocraft/work
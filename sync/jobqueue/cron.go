@@ -0,0 +1,206 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// CronSchedule calculates the occurrences of a cron expression.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// every, if set, describes an @every interval.
+	every time.Duration
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = [5]cronField{
+	{min: 0, max: 59},
+	{min: 0, max: 23},
+	{min: 1, max: 31},
+	{min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}},
+	{min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}},
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses the standard five field cron expression "minute hour
+// day-of-month month day-of-week". Each field supports the wildcard *, lists
+// 1,2,3, ranges 1-5 and steps */15 or 1-30/5. Month and day-of-week accept
+// the three letter English names. Sunday is 0 or 7. If both day fields are
+// restricted, a day matches if one of them matches. Furthermore the
+// descriptors @yearly, @monthly, @weekly, @daily, @hourly and "@every
+// <duration>" are supported. @every occurrences are multiples of the duration
+// since the Unix epoch, so that all processes calculate the same times.
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, errors.NotValid.New(err, "[jobqueue] ParseCron invalid duration in %q", spec)
+		}
+		if d < time.Second {
+			return nil, errors.NotValid.Newf("[jobqueue] ParseCron duration in %q must be at least one second", spec)
+		}
+		return &CronSchedule{every: d}, nil
+	}
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.NotValid.Newf("[jobqueue] ParseCron expects %d fields in %q", len(cronFields), spec)
+	}
+	var bitsets [5]uint64
+	for i, f := range fields {
+		b, err := cronFields[i].parse(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "[jobqueue] ParseCron invalid field %d in %q", i+1, spec)
+		}
+		bitsets[i] = b
+	}
+	cs := &CronSchedule{
+		minute: bitsets[0],
+		hour:   bitsets[1],
+		dom:    bitsets[2],
+		month:  bitsets[3],
+		dow:    bitsets[4],
+	}
+	if cs.dow&(1<<7) != 0 {
+		cs.dow = (cs.dow | 1) &^ (1 << 7) // 7 is also Sunday
+	}
+	return cs, nil
+}
+
+// MustParseCron same as ParseCron but panics on error.
+func MustParseCron(spec string) *CronSchedule {
+	cs, err := ParseCron(spec)
+	if err != nil {
+		panic(err)
+	}
+	return cs
+}
+
+func (cf cronField) value(s string) (int, error) {
+	if v, ok := cf.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.NotValid.New(err, "[jobqueue] Invalid cron value %q", s)
+	}
+	if v < cf.min || v > cf.max {
+		return 0, errors.OutOfRange.Newf("[jobqueue] Cron value %d out of range [%d,%d]", v, cf.min, cf.max)
+	}
+	return v, nil
+}
+
+func (cf cronField) parse(field string) (b uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, errors.NotValid.Newf("[jobqueue] Invalid cron step in %q", part)
+			}
+		}
+		from, to := cf.min, cf.max
+		switch i := strings.IndexByte(rng, '-'); {
+		case rng == "*":
+		case i > 0:
+			if from, err = cf.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if to, err = cf.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, errors.NotValid.Newf("[jobqueue] Invalid cron range %q", rng)
+			}
+		default:
+			if from, err = cf.value(rng); err != nil {
+				return 0, err
+			}
+			if step == 1 {
+				to = from
+			}
+		}
+		for v := from; v <= to; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+func (cs *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := cs.dom&(1<<uint(t.Day())) != 0
+	dowMatch := cs.dow&(1<<uint(t.Weekday())) != 0
+	domAll := bits.OnesCount64(cs.dom) == 31
+	dowAll := bits.OnesCount64(cs.dow) == 7
+	if domAll || dowAll {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first occurrence after t, in the location of t. It
+// returns the zero time if no occurrence can be found within five years, for
+// example for the 30th of February.
+func (cs *CronSchedule) Next(t time.Time) time.Time {
+	if cs.every > 0 {
+		return time.Unix(0, 0).Add(t.Sub(time.Unix(0, 0)).Truncate(cs.every) + cs.every).In(t.Location())
+	}
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if cs.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if cs.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if cs.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
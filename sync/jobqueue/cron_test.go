@@ -0,0 +1,62 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sync/jobqueue"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	start := time.Date(2020, 3, 14, 15, 9, 26, 0, time.UTC) // Saturday
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"* * * * *", []string{"2020-03-14 15:10", "2020-03-14 15:11"}},
+		{"*/15 * * * *", []string{"2020-03-14 15:15", "2020-03-14 15:30"}},
+		{"0 9-17/4 * * *", []string{"2020-03-14 17:00", "2020-03-15 09:00", "2020-03-15 13:00"}},
+		{"30 2 * * mon-fri", []string{"2020-03-16 02:30", "2020-03-17 02:30"}},
+		{"0 0 1,15 * *", []string{"2020-03-15 00:00", "2020-04-01 00:00"}},
+		{"0 0 13 * 5", []string{"2020-03-20 00:00", "2020-03-27 00:00", "2020-04-03 00:00", "2020-04-10 00:00", "2020-04-13 00:00"}},
+		{"0 12 * feb 7", []string{"2021-02-07 12:00"}},
+		{"0 0 29 2 *", []string{"2024-02-29 00:00"}},
+		{"@monthly", []string{"2020-04-01 00:00", "2020-05-01 00:00"}},
+		{"@every 1h30m", []string{"2020-03-14 16:30", "2020-03-14 18:00"}},
+	}
+	for _, test := range tests {
+		cs, err := jobqueue.ParseCron(test.spec)
+		assert.NoError(t, err, "%q", test.spec)
+		var have []string
+		n := start
+		for range test.want {
+			n = cs.Next(n)
+			have = append(have, n.Format("2006-01-02 15:04"))
+		}
+		assert.Exactly(t, test.want, have, "%q", test.spec)
+	}
+
+	assert.True(t, jobqueue.MustParseCron("0 0 30 2 *").Next(start).IsZero())
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * abc *", "@every 1ms", "@every x"} {
+		_, err := jobqueue.ParseCron(spec)
+		assert.True(t, errors.NotValid.Match(err) || errors.OutOfRange.Match(err), "%q: %+v", spec, err)
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build db csall
+
+package jobqueue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/weiwolves/pkg/sql/ddl"
+	"github.com/weiwolves/pkg/sql/dml"
+	"github.com/weiwolves/pkg/storage/null"
+)
+
+// TableNameDB defines the default table name for the database storage.
+const TableNameDB = "jobqueue"
+
+const dbCreateTable = "CREATE TABLE IF NOT EXISTS `%s` (\n" +
+	"  `id` CHAR(26) NOT NULL COMMENT 'ULID',\n" +
+	"  `queue` VARCHAR(128) NOT NULL,\n" +
+	"  `type` VARCHAR(128) NOT NULL,\n" +
+	"  `payload` LONGBLOB NULL,\n" +
+	"  `unique_key` VARCHAR(255) NULL COMMENT 'NULL once the job succeeded or died',\n" +
+	"  `status` ENUM('pending','running','dead') NOT NULL DEFAULT 'pending',\n" +
+	"  `attempts` INT UNSIGNED NOT NULL DEFAULT 0,\n" +
+	"  `max_attempts` INT UNSIGNED NOT NULL DEFAULT 0,\n" +
+	"  `run_at` BIGINT NOT NULL COMMENT 'Unix milliseconds',\n" +
+	"  `locked_until` BIGINT NOT NULL DEFAULT 0 COMMENT 'Unix milliseconds',\n" +
+	"  `last_error` TEXT NULL,\n" +
+	"  `created_at` BIGINT NOT NULL COMMENT 'Unix milliseconds',\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `UNQ_UNIQUE_KEY` (`unique_key`),\n" +
+	"  KEY `IDX_QUEUE_STATUS_RUN_AT` (`queue`,`status`,`run_at`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='jobqueue'"
+
+// WithDBCreateTable creates the job table if it does not yet exists. An empty
+// tableName falls back to TableNameDB.
+//		tbls, err := ddl.NewTables(ddl.WithConnPool(dbc), jobqueue.WithDBCreateTable(ctx, ""))
+func WithDBCreateTable(ctx context.Context, tableName string) ddl.TableOption {
+	if tableName == "" {
+		tableName = TableNameDB
+	}
+	return ddl.WithCreateTable(ctx, tableName, fmt.Sprintf(dbCreateTable, tableName))
+}
+
+// DBOptions applies several options to the database storage.
+type DBOptions struct {
+	// TableName if set, specifies the alternate table name, default:
+	// `jobqueue` aka constant TableNameDB.
+	TableName string
+	Log       log.Logger
+}
+
+// NewDB creates a new database backed Storager. The table must exist, see
+// function WithDBCreateTable. Jobs get claimed with SELECT ... FOR UPDATE
+// SKIP LOCKED which requires MySQL >= 8.0.1 or MariaDB >= 10.6.
+func NewDB(db *dml.ConnPool, o *DBOptions) (Storager, error) {
+	if o == nil {
+		o = new(DBOptions)
+	}
+	ds := &dbStorage{
+		db:        db,
+		tableName: o.TableName,
+		log:       o.Log,
+	}
+	if ds.tableName == "" {
+		ds.tableName = TableNameDB
+	}
+	if err := dml.IsValidIdentifier(ds.tableName); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ds, nil
+}
+
+type dbStorage struct {
+	db        *dml.ConnPool
+	tableName string
+	log       log.Logger
+}
+
+var dbColumns = []string{"id", "queue", "type", "payload", "unique_key", "status", "attempts", "max_attempts", "run_at", "locked_until", "last_error", "created_at"}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func scanJob(cm *dml.ColumnMap) (*Job, error) {
+	j := new(Job)
+	var status string
+	var runAt, lockedUntil, createdAt int64
+	var uniqueKey, lastError null.String
+	for cm.Next() {
+		switch c := cm.Column(); c {
+		case "id":
+			cm.String(&j.ID)
+		case "queue":
+			cm.String(&j.Queue)
+		case "type":
+			cm.String(&j.Type)
+		case "payload":
+			cm.Byte(&j.Payload)
+		case "unique_key":
+			cm.NullString(&uniqueKey)
+		case "status":
+			cm.String(&status)
+		case "attempts":
+			cm.Int(&j.Attempts)
+		case "max_attempts":
+			cm.Int(&j.MaxAttempts)
+		case "run_at":
+			cm.Int64(&runAt)
+		case "locked_until":
+			cm.Int64(&lockedUntil)
+		case "last_error":
+			cm.NullString(&lastError)
+		case "created_at":
+			cm.Int64(&createdAt)
+		}
+	}
+	if err := cm.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var err error
+	if j.Status, err = parseStatus(status); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	j.UniqueKey = uniqueKey.Data
+	j.LastError = lastError.Data
+	j.RunAt = fromUnixMilli(runAt)
+	j.LockedUntil = fromUnixMilli(lockedUntil)
+	j.CreatedAt = fromUnixMilli(createdAt)
+	return j, nil
+}
+
+// Enqueue inserts the job. A duplicate unique key gets reported as
+// errors.AlreadyExists.
+func (ds *dbStorage) Enqueue(ctx context.Context, j *Job) error {
+	ins := dml.NewInsert(ds.tableName).AddColumns(dbColumns...)
+	ins.Log = ds.log
+	_, err := ins.WithDB(ds.db.DB).WithDBR().ExecContext(ctx,
+		j.ID, j.Queue, j.Type, j.Payload, nullString(j.UniqueKey), StatusPending.String(), j.Attempts, j.MaxAttempts,
+		unixMilli(j.RunAt), int64(0), nullString(j.LastError), unixMilli(j.CreatedAt),
+	)
+	if dml.MySQLNumberFromError(err) == 1062 { // ER_DUP_ENTRY
+		return errors.AlreadyExists.New(err, "[jobqueue] Job %q with unique key %q already exists", j.ID, j.UniqueKey)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "[jobqueue] dbStorage.Enqueue job %q", j.ID)
+	}
+	return nil
+}
+
+// Claim selects the ready jobs with FOR UPDATE SKIP LOCKED and marks them as
+// running within one transaction.
+func (ds *dbStorage) Claim(ctx context.Context, queues []string, limit int, lockedUntil time.Time) (jobs []*Job, err error) {
+	n := unixMilli(now())
+	lu := unixMilli(lockedUntil)
+	err = ds.db.Transaction(ctx, nil, func(tx *dml.Tx) error {
+		sel := dml.NewSelect(dbColumns...).From(ds.tableName).Where(
+			dml.Column("queue").In().PlaceHolder(),
+			dml.Column("status").In().Strs(StatusPending.String(), StatusRunning.String()),
+			dml.Expr("((`status` = 'pending' AND `run_at` <= ?) OR (`status` = 'running' AND `locked_until` <= ?))").Int64(n).Int64(n),
+		).OrderBy("run_at", "id").Limit(0, uint64(limit)).ForUpdateSkipLocked()
+		sel.Log = ds.log
+		err := sel.WithDB(tx.DB).WithDBR().ExpandPlaceHolders().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+			j, err := scanJob(cm)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			jobs = append(jobs, j)
+			return nil
+		}, queues)
+		if err != nil || len(jobs) == 0 {
+			return errors.WithStack(err)
+		}
+
+		ids := make([]string, len(jobs))
+		for i, j := range jobs {
+			ids[i] = j.ID
+			j.Status = StatusRunning
+			j.Attempts++
+			j.LockedUntil = fromUnixMilli(lu)
+		}
+		up := dml.NewUpdate(ds.tableName).AddClauses(
+			dml.Column("status").Str(StatusRunning.String()),
+			dml.Column("attempts").Expr("`attempts`+1"),
+			dml.Column("locked_until").Int64(lu),
+		).Where(dml.Column("id").In().PlaceHolder())
+		up.Log = ds.log
+		_, err = up.WithDB(tx.DB).WithDBR().ExpandPlaceHolders().ExecContext(ctx, ids)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "[jobqueue] dbStorage.Claim from queues %v", queues)
+	}
+	return jobs, nil
+}
+
+// claimedConditions restricts a statement to the job, argument ID, as long as
+// it is still claimed with the lease returned by Claim.
+func claimedConditions(j *Job) dml.Conditions {
+	return dml.Conditions{
+		dml.Column("id").PlaceHolder(),
+		dml.Column("status").Str(StatusRunning.String()),
+		dml.Column("attempts").Int(j.Attempts),
+		dml.Column("locked_until").Int64(unixMilli(j.LockedUntil)),
+	}
+}
+
+func checkClaimed(j *Job, res sql.Result) error {
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if ra == 0 {
+		return errLeaseExpired(j)
+	}
+	return nil
+}
+
+// Complete deletes the job.
+func (ds *dbStorage) Complete(ctx context.Context, j *Job) error {
+	del := dml.NewDelete(ds.tableName).Where(claimedConditions(j)...)
+	del.Log = ds.log
+	res, err := del.WithDB(ds.db.DB).WithDBR().ExecContext(ctx, j.ID)
+	if err != nil {
+		return errors.Wrapf(err, "[jobqueue] dbStorage.Complete job %q", j.ID)
+	}
+	return checkClaimed(j, res)
+}
+
+func (ds *dbStorage) update(ctx context.Context, j *Job, clauses ...*dml.Condition) error {
+	up := dml.NewUpdate(ds.tableName).AddClauses(clauses...).Where(claimedConditions(j)...)
+	up.Log = ds.log
+	res, err := up.WithDB(ds.db.DB).WithDBR().ExecContext(ctx, j.ID)
+	if err != nil {
+		return errors.Wrapf(err, "[jobqueue] dbStorage.update job %q", j.ID)
+	}
+	return checkClaimed(j, res)
+}
+
+// Retry sets the job back to pending.
+func (ds *dbStorage) Retry(ctx context.Context, j *Job) error {
+	return ds.update(ctx, j,
+		dml.Column("status").Str(StatusPending.String()),
+		dml.Column("run_at").Int64(unixMilli(j.RunAt)),
+		dml.Column("locked_until").Int64(0),
+		dml.Column("last_error").Str(j.LastError),
+	)
+}
+
+// Bury moves the job into the dead state and releases the unique key.
+func (ds *dbStorage) Bury(ctx context.Context, j *Job) error {
+	return ds.update(ctx, j,
+		dml.Column("status").Str(StatusDead.String()),
+		dml.Column("locked_until").Int64(0),
+		dml.Column("last_error").Str(j.LastError),
+		dml.Column("unique_key").Expr("NULL"),
+	)
+}
+
+// Requeue sets dead jobs back to pending.
+func (ds *dbStorage) Requeue(ctx context.Context, ids ...string) (int, error) {
+	up := dml.NewUpdate(ds.tableName).AddClauses(
+		dml.Column("status").Str(StatusPending.String()),
+		dml.Column("attempts").Int(0),
+		dml.Column("run_at").Int64(unixMilli(now())),
+	).Where(
+		dml.Column("id").In().PlaceHolder(),
+		dml.Column("status").Str(StatusDead.String()),
+	)
+	up.Log = ds.log
+	res, err := up.WithDB(ds.db.DB).WithDBR().ExpandPlaceHolders().ExecContext(ctx, ids)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[jobqueue] dbStorage.Requeue jobs %v", ids)
+	}
+	ra, err := res.RowsAffected()
+	return int(ra), errors.WithStack(err)
+}
+
+// Delete removes the jobs.
+func (ds *dbStorage) Delete(ctx context.Context, ids ...string) (int, error) {
+	del := dml.NewDelete(ds.tableName).Where(dml.Column("id").In().PlaceHolder())
+	del.Log = ds.log
+	res, err := del.WithDB(ds.db.DB).WithDBR().ExpandPlaceHolders().ExecContext(ctx, ids)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[jobqueue] dbStorage.Delete jobs %v", ids)
+	}
+	ra, err := res.RowsAffected()
+	return int(ra), errors.WithStack(err)
+}
+
+// Jobs selects the jobs matching the filter.
+func (ds *dbStorage) Jobs(ctx context.Context, f Filter) (jobs []*Job, _ error) {
+	sel := dml.NewSelect(dbColumns...).From(ds.tableName).OrderBy("run_at", "id").Limit(0, uint64(f.Limit))
+	var args []interface{}
+	if f.Queue != "" {
+		sel.Where(dml.Column("queue").PlaceHolder())
+		args = append(args, f.Queue)
+	}
+	if f.Status > 0 {
+		sel.Where(dml.Column("status").PlaceHolder())
+		args = append(args, f.Status.String())
+	}
+	sel.Log = ds.log
+	err := sel.WithDB(ds.db.DB).WithDBR().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		j, err := scanJob(cm)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		jobs = append(jobs, j)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[jobqueue] dbStorage.Jobs with filter %#v", f)
+	}
+	return jobs, nil
+}
+
+// Stats counts the jobs grouped by queue.
+func (ds *dbStorage) Stats(ctx context.Context) (stats []QueueStats, _ error) {
+	sel := dml.NewSelect("queue").AddColumnsConditions(
+		dml.Expr("SUM(`status` = 'pending' AND `run_at` <= ?)").Int64(unixMilli(now())).Alias("pending"),
+		dml.Expr("SUM(`status` = 'pending' AND `run_at` > ?)").Int64(unixMilli(now())).Alias("delayed"),
+		dml.Expr("SUM(`status` = 'running')").Alias("running"),
+		dml.Expr("SUM(`status` = 'dead')").Alias("dead"),
+	).From(ds.tableName).GroupBy("queue").OrderBy("queue")
+	sel.Log = ds.log
+	err := sel.WithDB(ds.db.DB).WithDBR().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		var qs QueueStats
+		for cm.Next() {
+			switch c := cm.Column(); c {
+			case "queue":
+				cm.String(&qs.Queue)
+			case "pending":
+				cm.Int64(&qs.Pending)
+			case "delayed":
+				cm.Int64(&qs.Delayed)
+			case "running":
+				cm.Int64(&qs.Running)
+			case "dead":
+				cm.Int64(&qs.Dead)
+			}
+		}
+		stats = append(stats, qs)
+		return cm.Err()
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "[jobqueue] dbStorage.Stats on table %q", ds.tableName)
+	}
+	return stats, nil
+}
+
+// Close does nothing. It does not close the database connection.
+func (ds *dbStorage) Close() error { return nil }
@@ -0,0 +1,149 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build db csall
+
+package jobqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/weiwolves/pkg/sql/dmltest"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func TestNewDB_Mock(t *testing.T) {
+	ctx := context.Background()
+	n := time.Unix(1584000000, 0)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+	nMilli := n.UnixNano() / int64(time.Millisecond)
+
+	t.Run("Enqueue", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		ins := dmltest.SQLMockQuoteMeta("INSERT INTO `jobqueue` (`id`,`queue`,`type`,`payload`,`unique_key`,`status`,`attempts`,`max_attempts`,`run_at`,`locked_until`,`last_error`,`created_at`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)")
+		dbMock.ExpectExec(ins).
+			WithArgs("01A", "q1", "test", []byte(`{"id":"01A"}`), nil, "pending", 0, 3, nMilli, 0, nil, nMilli).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(ins).
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+		st, err := NewDB(dbc, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("01A", "q1", n)))
+		j := newTestJob("01B", "q1", n)
+		j.UniqueKey = "once"
+		err = st.Enqueue(ctx, j)
+		assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+	})
+
+	t.Run("Claim", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		lockedUntil := n.Add(time.Minute)
+		dbMock.ExpectBegin()
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `queue`, `type`, `payload`, `unique_key`, `status`, `attempts`, `max_attempts`, `run_at`, `locked_until`, `last_error`, `created_at` FROM `jobs` WHERE (`queue` IN (?,?)) AND (`status` IN ('pending','running')) AND (((`status` = 'pending' AND `run_at` <= 1584000000000) OR (`status` = 'running' AND `locked_until` <= 1584000000000))) ORDER BY `run_at`, `id` LIMIT 0,5 FOR UPDATE SKIP LOCKED")).
+			WithArgs("q1", "q2").
+			WillReturnRows(sqlmock.NewRows(dbColumns).
+				AddRow("01A", "q1", "test", []byte(`{}`), nil, "pending", 0, 3, nMilli, 0, nil, nMilli).
+				AddRow("01B", "q2", "test", nil, "once", "running", 1, 3, nMilli, nMilli, "timeout", nMilli),
+			)
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `jobs` SET `status`='running', `attempts`=`attempts`+1, `locked_until`=1584000060000 WHERE (`id` IN (?,?))")).
+			WithArgs("01A", "01B").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		dbMock.ExpectCommit()
+
+		st, err := NewDB(dbc, &DBOptions{TableName: "jobs"})
+		assert.NoError(t, err)
+		jobs, err := st.Claim(ctx, []string{"q1", "q2"}, 5, lockedUntil)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 2)
+		assert.Exactly(t, &Job{
+			ID: "01A", Queue: "q1", Type: "test", Payload: []byte(`{}`), Status: StatusRunning,
+			Attempts: 1, MaxAttempts: 3, RunAt: n, LockedUntil: lockedUntil, CreatedAt: n,
+		}, jobs[0])
+		assert.Exactly(t, "once", jobs[1].UniqueKey)
+		assert.Exactly(t, "timeout", jobs[1].LastError)
+		assert.Exactly(t, 2, jobs[1].Attempts)
+	})
+
+	t.Run("Retry Bury Requeue Delete", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		const claimed = " AND (`status` = 'running') AND (`attempts` = 2) AND (`locked_until` = 1584000300000)"
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `jobqueue` SET `status`='pending', `run_at`=1584000000000, `locked_until`=0, `last_error`='failed' WHERE (`id` = ?)" + claimed)).
+			WithArgs("01A").WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `jobqueue` SET `status`='dead', `locked_until`=0, `last_error`='failed', `unique_key`=NULL WHERE (`id` = ?)" + claimed)).
+			WithArgs("01A").WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `jobqueue` SET `status`='pending', `attempts`=0, `run_at`=1584000000000 WHERE (`id` IN (?,?)) AND (`status` = 'dead')")).
+			WithArgs("01A", "01B").WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `jobqueue` WHERE (`id` = ?)" + claimed)).
+			WithArgs("01A").WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `jobqueue` WHERE (`id` = ?)" + claimed)).
+			WithArgs("01A").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		st, err := NewDB(dbc, nil)
+		assert.NoError(t, err)
+		j := &Job{ID: "01A", Status: StatusRunning, Attempts: 2, RunAt: n, LockedUntil: n.Add(5 * time.Minute), LastError: "failed"}
+		assert.NoError(t, st.Retry(ctx, j))
+		assert.NoError(t, st.Bury(ctx, j))
+		c, err := st.Requeue(ctx, "01A", "01B")
+		assert.NoError(t, err)
+		assert.Exactly(t, 1, c)
+		assert.NoError(t, st.Complete(ctx, j))
+		err = st.Complete(ctx, j)
+		assert.True(t, errors.Expired.Match(err), "the lease has been taken over: %+v", err)
+	})
+
+	t.Run("Jobs and Stats", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `queue`, `type`, `payload`, `unique_key`, `status`, `attempts`, `max_attempts`, `run_at`, `locked_until`, `last_error`, `created_at` FROM `jobqueue` WHERE (`queue` = ?) AND (`status` = ?) ORDER BY `run_at`, `id` LIMIT 0,10")).
+			WithArgs("q1", "dead").
+			WillReturnRows(sqlmock.NewRows(dbColumns).
+				AddRow("01A", "q1", "test", nil, nil, "dead", 3, 3, nMilli, 0, "failed", nMilli),
+			)
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `queue`, SUM(`status` = 'pending' AND `run_at` <= 1584000000000) AS `pending`, SUM(`status` = 'pending' AND `run_at` > 1584000000000) AS `delayed`, SUM(`status` = 'running') AS `running`, SUM(`status` = 'dead') AS `dead` FROM `jobqueue` GROUP BY `queue` ORDER BY `queue`")).
+			WillReturnRows(sqlmock.NewRows([]string{"queue", "pending", "delayed", "running", "dead"}).
+				AddRow("q1", 1, 2, 3, 4),
+			)
+
+		st, err := NewDB(dbc, nil)
+		assert.NoError(t, err)
+		jobs, err := st.Jobs(ctx, Filter{Queue: "q1", Status: StatusDead, Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, StatusDead, jobs[0].Status)
+		assert.Exactly(t, "failed", jobs[0].LastError)
+
+		stats, err := st.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, []QueueStats{{Queue: "q1", Pending: 1, Delayed: 2, Running: 3, Dead: 4}}, stats)
+	})
+
+	t.Run("invalid table name", func(t *testing.T) {
+		_, err := NewDB(nil, &DBOptions{TableName: "job queue"})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
@@ -0,0 +1,44 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jobqueue provides a durable job queue with workers on top of
+// package bgwork.
+//
+// Jobs get enqueued into a Storager, which can be MySQL/MariaDB (build tag
+// `db`), Redis (build tag `redis`) or the in-memory storage for tests and
+// single process applications. Jobs survive a restart of the application when
+// a persistent Storager gets used.
+//
+// A job has a type, which maps to a registered HandlerFunc, and a raw
+// payload. The Service claims ready jobs from the Storager and runs them with
+// bgwork.AutoScaling workers. A claimed job receives a lease. If the process
+// dies while running a job, the job gets claimed again after its lease has
+// expired. Only the worker holding the current lease can complete, retry or
+// bury a job. The database storage claims jobs with SELECT ... FOR UPDATE SKIP
+// LOCKED, so many processes can work on the same queues.
+//
+// A failed job gets retried with an increasing backoff until it reaches its
+// maximum attempts. Then the job gets moved into the dead letter state, from
+// where it can be inspected, requeued or deleted. A handler returns an error
+// of kind errors.NotRecoverable to skip all further retries.
+//
+// Jobs can be delayed, scheduled at a specific time or scheduled periodically
+// with a cron expression. A unique key prevents enqueuing the same job twice
+// as long as the first job waits or runs. Cron jobs use a unique key per
+// occurrence, hence many processes can run the same schedule and each
+// occurrence gets enqueued only once.
+//
+// Service.Stats, Service.Jobs, Service.Requeue and Service.Delete form the
+// status API to inspect the queues.
+package jobqueue
@@ -0,0 +1,142 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// DefaultQueue defines the name of the queue used when no queue has been
+// provided.
+const DefaultQueue = "default"
+
+// Status defines the state of a job.
+type Status uint8
+
+// Available job states. Succeeded jobs get removed from the Storager.
+const (
+	// StatusPending waits for its RunAt time to get claimed.
+	StatusPending Status = iota + 1
+	// StatusRunning has been claimed by a worker.
+	StatusRunning
+	// StatusDead has failed too often or with an unrecoverable error.
+	StatusDead
+)
+
+// String returns the name of the status as used in the storage backends.
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusRunning:
+		return "running"
+	case StatusDead:
+		return "dead"
+	}
+	return ""
+}
+
+func parseStatus(s string) (Status, error) {
+	switch s {
+	case "pending":
+		return StatusPending, nil
+	case "running":
+		return StatusRunning, nil
+	case "dead":
+		return StatusDead, nil
+	}
+	return 0, errors.NotValid.Newf("[jobqueue] Unknown job status %q", s)
+}
+
+// unixMilli converts t into Unix milliseconds as used in the storage
+// backends. The zero time becomes 0.
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Job defines a unit of work. The Type maps to a registered HandlerFunc.
+type Job struct {
+	ID      string
+	Queue   string
+	Type    string
+	Payload []byte
+	// UniqueKey, if not empty, prevents enqueuing another job with the same
+	// key as long as this job is pending or running.
+	UniqueKey string
+	Status    Status
+	// Attempts counts how often the job has been claimed.
+	Attempts    int
+	MaxAttempts int
+	// RunAt defines the earliest time when the job can be claimed.
+	RunAt time.Time
+	// LockedUntil defines the end of the lease of a running job.
+	LockedUntil time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// Unmarshal decodes the JSON payload into v. See Service.EnqueueJSON.
+func (j *Job) Unmarshal(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return errors.BadEncoding.New(err, "[jobqueue] Job %q of type %q cannot unmarshal payload", j.ID, j.Type)
+	}
+	return nil
+}
+
+// EnqueueOptions configures a single job.
+type EnqueueOptions struct {
+	// Queue defaults to DefaultQueue.
+	Queue string
+	// Delay postpones the job, if RunAt is empty.
+	Delay time.Duration
+	// RunAt defines when to run the job. Default now.
+	RunAt time.Time
+	// UniqueKey see Job.UniqueKey.
+	UniqueKey string
+	// MaxAttempts defaults to Options.MaxAttempts.
+	MaxAttempts int
+}
+
+// QueueStats contains the number of jobs per state of a queue.
+type QueueStats struct {
+	Queue string `json:"queue"`
+	// Pending jobs are ready to run.
+	Pending int64 `json:"pending"`
+	// Delayed jobs are pending but their RunAt time lies in the future.
+	Delayed int64 `json:"delayed"`
+	Running int64 `json:"running"`
+	Dead    int64 `json:"dead"`
+}
+
+// Filter selects jobs for Service.Jobs. Empty fields match all jobs.
+type Filter struct {
+	Queue  string
+	Status Status
+	// Limit defaults to 100.
+	Limit int
+}
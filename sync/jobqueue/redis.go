@@ -0,0 +1,437 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build redis csall
+
+package jobqueue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisKeyPrefix defines the default prefix of all Redis keys.
+const RedisKeyPrefix = "jobqueue:"
+
+// RedisOptions applies several options to the Redis storage.
+type RedisOptions struct {
+	// KeyPrefix defaults to RedisKeyPrefix.
+	KeyPrefix string
+}
+
+// The scripts derive the keys from the prefix in ARGV[1], hence Redis Cluster
+// is not supported. Key layout:
+//	<prefix>job:<id>          hash with the job fields
+//	<prefix>q:<queue>:pending sorted set of job IDs, score run_at
+//	<prefix>q:<queue>:running sorted set of job IDs, score locked_until
+//	<prefix>q:<queue>:dead    sorted set of job IDs, score run_at
+//	<prefix>queues            set of all queue names
+//	<prefix>unique            hash unique key => job ID
+// All times are Unix milliseconds.
+
+// ARGV: prefix, id, queue, unique_key, run_at, field/value pairs ...
+var redisEnqueue = redis.NewScript(0, `
+local p, id, q, uk = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+if redis.call('EXISTS', p..'job:'..id) == 1 then return 0 end
+if uk ~= '' and redis.call('HSETNX', p..'unique', uk, id) == 0 then return 0 end
+redis.call('HMSET', p..'job:'..id, unpack(ARGV, 6))
+redis.call('ZADD', p..'q:'..q..':pending', ARGV[5], id)
+redis.call('SADD', p..'queues', q)
+return 1`)
+
+// ARGV: prefix, queue, now, limit, locked_until
+var redisClaim = redis.NewScript(0, `
+local p, q, now, limit, lu = ARGV[1], ARGV[2], ARGV[3], tonumber(ARGV[4]), ARGV[5]
+local pending, running = p..'q:'..q..':pending', p..'q:'..q..':running'
+local ids = redis.call('ZRANGEBYSCORE', pending, '-inf', now, 'LIMIT', 0, limit)
+for _, id in ipairs(ids) do redis.call('ZREM', pending, id) end
+if #ids < limit then
+	local expired = redis.call('ZRANGEBYSCORE', running, '-inf', now, 'LIMIT', 0, limit - #ids)
+	for _, id in ipairs(expired) do table.insert(ids, id) end
+end
+for _, id in ipairs(ids) do
+	redis.call('ZADD', running, lu, id)
+	redis.call('HMSET', p..'job:'..id, 'status', 'running', 'locked_until', lu)
+	redis.call('HINCRBY', p..'job:'..id, 'attempts', 1)
+end
+return ids`)
+
+// ARGV: prefix, ids ...
+var redisRemove = redis.NewScript(0, `
+local p, count = ARGV[1], 0
+for i = 2, #ARGV do
+	local id = ARGV[i]
+	local job = redis.call('HMGET', p..'job:'..id, 'queue', 'unique_key')
+	if job[1] then
+		local q = p..'q:'..job[1]
+		if job[2] and job[2] ~= '' and redis.call('HGET', p..'unique', job[2]) == id then
+			redis.call('HDEL', p..'unique', job[2])
+		end
+		redis.call('ZREM', q..':pending', id)
+		redis.call('ZREM', q..':running', id)
+		redis.call('ZREM', q..':dead', id)
+		redis.call('DEL', p..'job:'..id)
+		count = count + 1
+	end
+end
+return count`)
+
+// redisClaimed aborts a script with 0 if the job is no longer claimed with
+// the lease returned by Claim. ARGV: prefix, id, attempts, locked_until, ...
+const redisClaimed = `
+local p, id = ARGV[1], ARGV[2]
+local claim = redis.call('HMGET', p..'job:'..id, 'status', 'attempts', 'locked_until')
+if claim[1] ~= 'running' or claim[2] ~= ARGV[3] or claim[3] ~= ARGV[4] then return 0 end`
+
+// ARGV: prefix, id, attempts, locked_until
+var redisComplete = redis.NewScript(0, redisClaimed+`
+local job = redis.call('HMGET', p..'job:'..id, 'queue', 'unique_key')
+if job[2] ~= '' and redis.call('HGET', p..'unique', job[2]) == id then
+	redis.call('HDEL', p..'unique', job[2])
+end
+redis.call('ZREM', p..'q:'..job[1]..':running', id)
+redis.call('DEL', p..'job:'..id)
+return 1`)
+
+// ARGV: prefix, id, attempts, locked_until, run_at, last_error
+var redisRetry = redis.NewScript(0, redisClaimed+`
+local q = redis.call('HGET', p..'job:'..id, 'queue')
+redis.call('ZREM', p..'q:'..q..':running', id)
+redis.call('ZADD', p..'q:'..q..':pending', ARGV[5], id)
+redis.call('HMSET', p..'job:'..id, 'status', 'pending', 'run_at', ARGV[5], 'locked_until', 0, 'last_error', ARGV[6])
+return 1`)
+
+// ARGV: prefix, id, attempts, locked_until, last_error
+var redisBury = redis.NewScript(0, redisClaimed+`
+local job = redis.call('HMGET', p..'job:'..id, 'queue', 'unique_key', 'run_at')
+local q = p..'q:'..job[1]
+if job[2] ~= '' and redis.call('HGET', p..'unique', job[2]) == id then
+	redis.call('HDEL', p..'unique', job[2])
+end
+redis.call('ZREM', q..':running', id)
+redis.call('ZADD', q..':dead', job[3], id)
+redis.call('HMSET', p..'job:'..id, 'status', 'dead', 'locked_until', 0, 'last_error', ARGV[5], 'unique_key', '')
+return 1`)
+
+// ARGV: prefix, now, ids ...
+var redisRequeue = redis.NewScript(0, `
+local p, now, count = ARGV[1], ARGV[2], 0
+for i = 3, #ARGV do
+	local id = ARGV[i]
+	local job = redis.call('HMGET', p..'job:'..id, 'queue', 'status')
+	if job[1] and job[2] == 'dead' then
+		redis.call('ZREM', p..'q:'..job[1]..':dead', id)
+		redis.call('ZADD', p..'q:'..job[1]..':pending', now, id)
+		redis.call('HMSET', p..'job:'..id, 'status', 'pending', 'attempts', 0, 'run_at', now)
+		count = count + 1
+	end
+end
+return count`)
+
+// NewRedis creates a new Redis backed Storager and checks the connection with
+// a PING. The scripts require Redis >= 3.2.
+func NewRedis(pool *redis.Pool, o *RedisOptions) (Storager, error) {
+	if o == nil {
+		o = new(RedisOptions)
+	}
+	rs := &redisStorage{
+		pool:   pool,
+		prefix: o.KeyPrefix,
+	}
+	if rs.prefix == "" {
+		rs.prefix = RedisKeyPrefix
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		return nil, errors.ConnectionFailed.New(err, "[jobqueue] Redis Ping failed")
+	}
+	return rs, nil
+}
+
+type redisStorage struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+func (rs *redisStorage) do(ctx context.Context, fn func(redis.Conn) error) (err error) {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[jobqueue] Redis failed to get a connection")
+	}
+	defer func() {
+		if err2 := conn.Close(); err == nil && err2 != nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+	return fn(conn)
+}
+
+func (rs *redisStorage) Enqueue(ctx context.Context, j *Job) error {
+	return rs.do(ctx, func(conn redis.Conn) error {
+		ok, err := redis.Bool(redisEnqueue.Do(conn,
+			rs.prefix, j.ID, j.Queue, j.UniqueKey, unixMilli(j.RunAt),
+			"queue", j.Queue,
+			"type", j.Type,
+			"payload", j.Payload,
+			"unique_key", j.UniqueKey,
+			"status", StatusPending.String(),
+			"attempts", j.Attempts,
+			"max_attempts", j.MaxAttempts,
+			"run_at", unixMilli(j.RunAt),
+			"locked_until", 0,
+			"last_error", j.LastError,
+			"created_at", unixMilli(j.CreatedAt),
+		))
+		if err != nil {
+			return errors.Wrapf(err, "[jobqueue] redisStorage.Enqueue job %q", j.ID)
+		}
+		if !ok {
+			return errors.AlreadyExists.Newf("[jobqueue] Job %q or unique key %q already exists", j.ID, j.UniqueKey)
+		}
+		return nil
+	})
+}
+
+func (rs *redisStorage) loadJobs(conn redis.Conn, ids []string) ([]*Job, error) {
+	for _, id := range ids {
+		if err := conn.Send("HGETALL", rs.prefix+"job:"+id); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		m, err := redis.StringMap(conn.Receive())
+		if err != nil {
+			return nil, errors.Wrapf(err, "[jobqueue] redisStorage failed to load job %q", id)
+		}
+		if len(m) == 0 {
+			continue // removed in the meantime
+		}
+		j, err := redisParseJob(id, m)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func redisParseJob(id string, m map[string]string) (j *Job, err error) {
+	j = &Job{
+		ID:        id,
+		Queue:     m["queue"],
+		Type:      m["type"],
+		UniqueKey: m["unique_key"],
+		LastError: m["last_error"],
+	}
+	if p := m["payload"]; p != "" {
+		j.Payload = []byte(p)
+	}
+	if j.Status, err = parseStatus(m["status"]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ints := [...]struct {
+		field string
+		dst   *int64
+	}{
+		{"attempts", new(int64)},
+		{"max_attempts", new(int64)},
+		{"run_at", new(int64)},
+		{"locked_until", new(int64)},
+		{"created_at", new(int64)},
+	}
+	for _, i := range ints {
+		if *i.dst, err = strconv.ParseInt(m[i.field], 10, 64); err != nil {
+			return nil, errors.CorruptData.New(err, "[jobqueue] Job %q has an invalid field %q", id, i.field)
+		}
+	}
+	j.Attempts = int(*ints[0].dst)
+	j.MaxAttempts = int(*ints[1].dst)
+	j.RunAt = fromUnixMilli(*ints[2].dst)
+	j.LockedUntil = fromUnixMilli(*ints[3].dst)
+	j.CreatedAt = fromUnixMilli(*ints[4].dst)
+	return j, nil
+}
+
+// Claim runs the claim script per queue until the limit has been reached.
+func (rs *redisStorage) Claim(ctx context.Context, queues []string, limit int, lockedUntil time.Time) (jobs []*Job, _ error) {
+	n := unixMilli(now())
+	lu := unixMilli(lockedUntil)
+	err := rs.do(ctx, func(conn redis.Conn) error {
+		var ids []string
+		for _, q := range queues {
+			if len(ids) >= limit {
+				break
+			}
+			qIDs, err := redis.Strings(redisClaim.Do(conn, rs.prefix, q, n, limit-len(ids), lu))
+			if err != nil {
+				return errors.Wrapf(err, "[jobqueue] redisStorage.Claim from queue %q", q)
+			}
+			ids = append(ids, qIDs...)
+		}
+		var err error
+		jobs, err = rs.loadJobs(conn, ids)
+		return err
+	})
+	return jobs, err
+}
+
+// finish runs one of the scripts which require a claimed job.
+func (rs *redisStorage) finish(ctx context.Context, script *redis.Script, op string, j *Job, args ...interface{}) error {
+	return rs.do(ctx, func(conn redis.Conn) error {
+		ok, err := redis.Bool(script.Do(conn, append([]interface{}{rs.prefix, j.ID, j.Attempts, unixMilli(j.LockedUntil)}, args...)...))
+		if err != nil {
+			return errors.Wrapf(err, "[jobqueue] redisStorage.%s job %q", op, j.ID)
+		}
+		if !ok {
+			return errLeaseExpired(j)
+		}
+		return nil
+	})
+}
+
+func (rs *redisStorage) Complete(ctx context.Context, j *Job) error {
+	return rs.finish(ctx, redisComplete, "Complete", j)
+}
+
+func (rs *redisStorage) Retry(ctx context.Context, j *Job) error {
+	return rs.finish(ctx, redisRetry, "Retry", j, unixMilli(j.RunAt), j.LastError)
+}
+
+func (rs *redisStorage) Bury(ctx context.Context, j *Job) error {
+	return rs.finish(ctx, redisBury, "Bury", j, j.LastError)
+}
+
+func (rs *redisStorage) Requeue(ctx context.Context, ids ...string) (count int, _ error) {
+	err := rs.do(ctx, func(conn redis.Conn) (err error) {
+		args := make([]interface{}, 0, len(ids)+2)
+		args = append(args, rs.prefix, unixMilli(now()))
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		count, err = redis.Int(redisRequeue.Do(conn, args...))
+		return errors.Wrapf(err, "[jobqueue] redisStorage.Requeue jobs %v", ids)
+	})
+	return count, err
+}
+
+func (rs *redisStorage) Delete(ctx context.Context, ids ...string) (count int, _ error) {
+	err := rs.do(ctx, func(conn redis.Conn) (err error) {
+		args := make([]interface{}, 0, len(ids)+1)
+		args = append(args, rs.prefix)
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		count, err = redis.Int(redisRemove.Do(conn, args...))
+		return errors.Wrapf(err, "[jobqueue] redisStorage.Delete jobs %v", ids)
+	})
+	return count, err
+}
+
+func (rs *redisStorage) queues(conn redis.Conn) ([]string, error) {
+	qs, err := redis.Strings(conn.Do("SMEMBERS", rs.prefix+"queues"))
+	if err != nil {
+		return nil, errors.Wrap(err, "[jobqueue] redisStorage failed to load the queues")
+	}
+	sort.Strings(qs)
+	return qs, nil
+}
+
+// Jobs loads at most Limit jobs per queue and state, and sorts them.
+func (rs *redisStorage) Jobs(ctx context.Context, f Filter) (jobs []*Job, _ error) {
+	err := rs.do(ctx, func(conn redis.Conn) (err error) {
+		queues := []string{f.Queue}
+		if f.Queue == "" {
+			if queues, err = rs.queues(conn); err != nil {
+				return err
+			}
+		}
+		states := []Status{StatusPending, StatusRunning, StatusDead}
+		if f.Status > 0 {
+			states = []Status{f.Status}
+		}
+		var ids []string
+		for _, q := range queues {
+			for _, s := range states {
+				qIDs, err := redis.Strings(conn.Do("ZRANGE", rs.prefix+"q:"+q+":"+s.String(), 0, f.Limit-1))
+				if err != nil {
+					return errors.Wrapf(err, "[jobqueue] redisStorage.Jobs from queue %q", q)
+				}
+				ids = append(ids, qIDs...)
+			}
+		}
+		jobs, err = rs.loadJobs(conn, ids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortJobs(jobs)
+	if len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs, nil
+}
+
+// Stats counts the members of the sorted sets of each queue.
+func (rs *redisStorage) Stats(ctx context.Context) (stats []QueueStats, _ error) {
+	n := unixMilli(now())
+	err := rs.do(ctx, func(conn redis.Conn) error {
+		queues, err := rs.queues(conn)
+		if err != nil {
+			return err
+		}
+		for _, q := range queues {
+			k := rs.prefix + "q:" + q + ":"
+			for _, args := range [][]interface{}{
+				{"ZCOUNT", k + "pending", "-inf", n},
+				{"ZCOUNT", k + "pending", "(" + strconv.FormatInt(n, 10), "+inf"},
+				{"ZCARD", k + "running"},
+				{"ZCARD", k + "dead"},
+			} {
+				if err := conn.Send(args[0].(string), args[1:]...); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, q := range queues {
+			qs := QueueStats{Queue: q}
+			for _, dst := range []*int64{&qs.Pending, &qs.Delayed, &qs.Running, &qs.Dead} {
+				if *dst, err = redis.Int64(conn.Receive()); err != nil {
+					return errors.Wrapf(err, "[jobqueue] redisStorage.Stats for queue %q", q)
+				}
+			}
+			if qs != (QueueStats{Queue: q}) {
+				stats = append(stats, qs)
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Close does nothing. It does not close the pool.
+func (rs *redisStorage) Close() error { return nil }
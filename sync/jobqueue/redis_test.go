@@ -0,0 +1,73 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build redis csall
+
+package jobqueue
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/corestoreio/errors"
+	"github.com/gomodule/redigo/redis"
+	"github.com/weiwolves/pkg/net/url"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTestRedisPool(addr string, db int) *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialDatabase(db))
+		},
+	}
+}
+
+func TestNewRedis(t *testing.T) {
+	t.Run("miniredis", func(t *testing.T) {
+		mr := miniredis.NewMiniRedis()
+		assert.NoError(t, mr.Start())
+		defer mr.Close()
+
+		st, err := NewRedis(newTestRedisPool(mr.Addr(), 0), nil)
+		assert.NoError(t, err)
+		// miniredis does not run Lua scripts atomically.
+		testStorager(t, st, false)
+		assert.NoError(t, st.Close())
+	})
+
+	t.Run("real redis", func(t *testing.T) {
+		redConURL := os.Getenv("CS_REDIS_TEST")
+		if redConURL == "" {
+			t.Skip(`Skipping live test because environment CS_REDIS_TEST variable not found.
+	export CS_REDIS_TEST="redis://127.0.0.1:6379/?db=3"
+		`)
+		}
+		addr, _, _, params, err := url.ParseConnection(redConURL)
+		assert.NoError(t, err)
+		db, _ := strconv.Atoi(params.Get("db"))
+		pool := newTestRedisPool(addr, db)
+
+		st, err := NewRedis(pool, &RedisOptions{KeyPrefix: "jq_test:"})
+		assert.NoError(t, err)
+		testStorager(t, st, true)
+	})
+
+	t.Run("connection failure", func(t *testing.T) {
+		_, err := NewRedis(newTestRedisPool("127.0.0.1:1", 0), nil)
+		assert.True(t, errors.ConnectionFailed.Match(err), "%+v", err)
+	})
+}
@@ -0,0 +1,468 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/oklog/ulid"
+	"github.com/weiwolves/pkg/sync/bgwork"
+)
+
+// HandlerFunc processes a job. A returned error triggers a retry. An error of
+// kind errors.NotRecoverable moves the job immediately into the dead state.
+// The context gets cancelled when the lease of the job expires or the Service
+// stops.
+type HandlerFunc func(ctx context.Context, j *Job) error
+
+// Options configures the Service.
+type Options struct {
+	// Queues defines the queues from which the workers claim jobs. Default
+	// DefaultQueue.
+	Queues []string
+	// MaxAttempts defines the default maximum attempts of a job before it
+	// gets moved into the dead state. Default 25.
+	MaxAttempts int
+	// Lease defines how long a claimed job belongs to a worker. After the
+	// lease expires the job can be claimed again. Default five minutes.
+	Lease time.Duration
+	// PollInterval defines the waiting time between two claims if no job is
+	// ready. Default one second.
+	PollInterval time.Duration
+	// BatchSize defines the maximum number of jobs to claim at once. Default
+	// Scaling.MaxWorkers.
+	BatchSize int
+	// Backoff calculates the delay of the next attempt. Default
+	// DefaultBackoff.
+	Backoff func(attempt int) time.Duration
+	// FinishTimeout limits the time to write the outcome of a job into the
+	// Storager. Default ten seconds.
+	FinishTimeout time.Duration
+	// Scaling configures the bgwork.AutoScaling workers.
+	Scaling bgwork.ScalingOptions
+	Log     log.Logger
+}
+
+// DefaultBackoff returns an increasing delay of attempt^4 + 15 seconds plus
+// some jitter, with a maximum of one day.
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 19 {
+		return 24 * time.Hour
+	}
+	a := attempt * attempt * attempt * attempt
+	return time.Duration(a+15+mrand.Intn(30)*(attempt+1)) * time.Second
+}
+
+// Stats contains the job counts of all queues and the processing counters of
+// the current Service since its creation.
+type Stats struct {
+	Queues []QueueStats `json:"queues"`
+	// Processed counts all jobs handled by this Service.
+	Processed uint64 `json:"processed"`
+	Succeeded uint64 `json:"succeeded"`
+	// Retried counts failed jobs which have been scheduled for another
+	// attempt.
+	Retried uint64 `json:"retried"`
+	// Buried counts failed jobs which have been moved into the dead state.
+	Buried uint64 `json:"buried"`
+}
+
+type cronEntry struct {
+	name     string
+	schedule *CronSchedule
+	jobType  string
+	payload  []byte
+	eo       EnqueueOptions
+	next     time.Time
+}
+
+// Service enqueues jobs and runs them with the registered handlers.
+type Service struct {
+	st Storager
+	o  Options
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	crons    []*cronEntry
+
+	entropyMu sync.Mutex
+	entropy   io.Reader
+
+	processed, succeeded, retried, buried uint64
+}
+
+// NewService creates a new job Service. Call Run to start the workers.
+func NewService(st Storager, o Options) (*Service, error) {
+	if st == nil {
+		return nil, errors.Empty.Newf("[jobqueue] Storager cannot be nil")
+	}
+	if len(o.Queues) == 0 {
+		o.Queues = []string{DefaultQueue}
+	}
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = 25
+	}
+	if o.Lease <= 0 {
+		o.Lease = 5 * time.Minute
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.Scaling.MaxWorkers == 0 {
+		o.Scaling.MaxWorkers = 16
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = int(o.Scaling.MaxWorkers)
+	}
+	if o.Backoff == nil {
+		o.Backoff = DefaultBackoff
+	}
+	if o.FinishTimeout <= 0 {
+		o.FinishTimeout = 10 * time.Second
+	}
+	return &Service{
+		st:       st,
+		o:        o,
+		handlers: make(map[string]HandlerFunc),
+		entropy:  ulid.Monotonic(rand.Reader, 0),
+	}, nil
+}
+
+// Register sets the handler for a job type. An already registered handler
+// gets replaced.
+func (s *Service) Register(jobType string, fn HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[jobType] = fn
+	s.mu.Unlock()
+}
+
+func (s *Service) newID(t time.Time) (string, error) {
+	s.entropyMu.Lock()
+	defer s.entropyMu.Unlock()
+	id, err := ulid.New(ulid.Timestamp(t), s.entropy)
+	if err != nil {
+		return "", errors.Fatal.New(err, "[jobqueue] Failed to create job ID")
+	}
+	return id.String(), nil
+}
+
+// Enqueue creates a new job and stores it. If the UniqueKey already exists,
+// an error of kind errors.AlreadyExists gets returned.
+func (s *Service) Enqueue(ctx context.Context, jobType string, payload []byte, eo EnqueueOptions) (*Job, error) {
+	if jobType == "" {
+		return nil, errors.Empty.Newf("[jobqueue] Job type cannot be empty")
+	}
+	n := now()
+	id, err := s.newID(n)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	j := &Job{
+		ID:          id,
+		Queue:       eo.Queue,
+		Type:        jobType,
+		Payload:     payload,
+		UniqueKey:   eo.UniqueKey,
+		Status:      StatusPending,
+		MaxAttempts: eo.MaxAttempts,
+		RunAt:       eo.RunAt,
+		CreatedAt:   n,
+	}
+	if j.Queue == "" {
+		j.Queue = DefaultQueue
+	}
+	if j.MaxAttempts < 1 {
+		j.MaxAttempts = s.o.MaxAttempts
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = n.Add(eo.Delay)
+	}
+	if err := s.st.Enqueue(ctx, j); err != nil {
+		return nil, errors.Wrapf(err, "[jobqueue] Enqueue job type %q into queue %q", j.Type, j.Queue)
+	}
+	return j, nil
+}
+
+// EnqueueJSON same as Enqueue but encodes v as JSON payload. Use Job.Unmarshal
+// in the handler to decode the payload.
+func (s *Service) EnqueueJSON(ctx context.Context, jobType string, v interface{}, eo EnqueueOptions) (*Job, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.BadEncoding.New(err, "[jobqueue] EnqueueJSON cannot marshal payload of job type %q", jobType)
+	}
+	return s.Enqueue(ctx, jobType, payload, eo)
+}
+
+// Schedule enqueues the job periodically according to the cron expression,
+// see ParseCron, as long as Run is running. The name must be unique. Each
+// occurrence gets enqueued with the unique key "cron:<name>:<unix time>" and
+// RunAt set to the occurrence, hence many processes can share the same
+// schedule without enqueuing an occurrence twice.
+func (s *Service) Schedule(name, spec, jobType string, payload []byte, eo EnqueueOptions) error {
+	cs, err := ParseCron(spec)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ce := range s.crons {
+		if ce.name == name {
+			return errors.AlreadyExists.Newf("[jobqueue] Schedule %q already exists", name)
+		}
+	}
+	s.crons = append(s.crons, &cronEntry{
+		name:     name,
+		schedule: cs,
+		jobType:  jobType,
+		payload:  payload,
+		eo:       eo,
+	})
+	return nil
+}
+
+// enqueueCrons makes sure that the next occurrence of each schedule has been
+// enqueued.
+func (s *Service) enqueueCrons(ctx context.Context) {
+	n := now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ce := range s.crons {
+		if ce.next.After(n) {
+			continue
+		}
+		ce.next = ce.schedule.Next(n)
+		if ce.next.IsZero() {
+			continue
+		}
+		eo := ce.eo
+		eo.RunAt = ce.next
+		eo.UniqueKey = fmt.Sprintf("cron:%s:%d", ce.name, ce.next.Unix())
+		if _, err := s.Enqueue(ctx, ce.jobType, ce.payload, eo); err != nil && !errors.AlreadyExists.Match(err) {
+			ce.next = time.Time{} // try again
+			s.logErr("jobqueue.Service.enqueueCrons", err, log.String("schedule", ce.name))
+		}
+	}
+}
+
+func (s *Service) logErr(msg string, err error, fields ...log.Field) {
+	if s.o.Log != nil && s.o.Log.IsInfo() {
+		s.o.Log.Info(msg, append(fields, log.Err(err))...)
+	}
+}
+
+// Run claims the jobs and runs them in bgwork.AutoScaling workers. It blocks
+// until the context gets cancelled and all running jobs have finished. Jobs
+// get only claimed for idle workers, so the lease of a job does not expire
+// while it waits for a worker.
+func (s *Service) Run(ctx context.Context) error {
+	jobs := make(chan interface{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bgwork.AutoScaling(ctx, jobs, func(event interface{}) {
+			s.process(ctx, event)
+		}, s.o.Scaling)
+	}()
+	defer wg.Wait()
+
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	for {
+		s.enqueueCrons(ctx)
+		slots, ok := s.reserveWorkers(ctx, jobs, &inFlight)
+		if !ok {
+			return nil
+		}
+		claimed, err := s.st.Claim(ctx, s.o.Queues, len(slots), now().Add(s.o.Lease))
+		if err != nil && ctx.Err() == nil {
+			s.logErr("jobqueue.Service.Run.Claim", err)
+		}
+		for i, slot := range slots {
+			if i < len(claimed) {
+				slot.job <- claimed[i]
+			}
+			close(slot.job)
+		}
+		if len(claimed) == len(slots) {
+			continue // there might be more ready jobs
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.o.PollInterval):
+		}
+	}
+}
+
+// workerSlot gets handed to an idle worker, which waits for a claimed job. A
+// closed job channel without a job releases the worker.
+type workerSlot struct {
+	job chan *Job
+	wg  *sync.WaitGroup
+}
+
+// reserveWorkers blocks until at least one worker is idle and reserves up to
+// BatchSize idle workers. It returns false if the context has been cancelled.
+func (s *Service) reserveWorkers(ctx context.Context, jobs chan<- interface{}, inFlight *sync.WaitGroup) ([]*workerSlot, bool) {
+	slots := make([]*workerSlot, 0, s.o.BatchSize)
+	for len(slots) < s.o.BatchSize {
+		slot := &workerSlot{job: make(chan *Job, 1), wg: inFlight}
+		inFlight.Add(1)
+		if len(slots) == 0 {
+			select {
+			case jobs <- slot:
+			case <-ctx.Done():
+				inFlight.Done()
+				return nil, false
+			}
+		} else {
+			select {
+			case jobs <- slot:
+			default:
+				inFlight.Done()
+				return slots, true
+			}
+		}
+		slots = append(slots, slot)
+	}
+	return slots, true
+}
+
+// release hands back claimed but not started jobs.
+func (s *Service) release(jobs []*Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.o.FinishTimeout)
+	defer cancel()
+	for _, j := range jobs {
+		j.RunAt = now()
+		if err := s.st.Retry(ctx, j); err != nil {
+			s.logErr("jobqueue.Service.release.Retry", err, log.String("job_id", j.ID))
+		}
+	}
+}
+
+func (s *Service) handler(jobType string) HandlerFunc {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.handlers[jobType]
+}
+
+func (s *Service) runHandler(ctx context.Context, j *Job) (err error) {
+	fn := s.handler(j.Type)
+	if fn == nil {
+		return errors.NotRecoverable.Newf("[jobqueue] No handler registered for job type %q", j.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Fatal.Newf("[jobqueue] Handler for job type %q panicked: %v", j.Type, r)
+		}
+	}()
+	ctx, cancel := context.WithDeadline(ctx, j.LockedUntil)
+	defer cancel()
+	return fn(ctx, j)
+}
+
+func (s *Service) process(ctx context.Context, event interface{}) {
+	slot := event.(*workerSlot)
+	defer slot.wg.Done()
+	j, ok := <-slot.job
+	if !ok {
+		return
+	}
+	if ctx.Err() != nil {
+		s.release([]*Job{j})
+		return
+	}
+	hErr := s.runHandler(ctx, j)
+	atomic.AddUint64(&s.processed, 1)
+
+	fctx, cancel := context.WithTimeout(context.Background(), s.o.FinishTimeout)
+	defer cancel()
+	var err error
+	switch {
+	case hErr == nil:
+		atomic.AddUint64(&s.succeeded, 1)
+		err = s.st.Complete(fctx, j)
+	case ctx.Err() != nil:
+		// the Service stops, so try again as soon as possible.
+		j.LastError = hErr.Error()
+		j.RunAt = now()
+		err = s.st.Retry(fctx, j)
+	case errors.NotRecoverable.Match(hErr) || j.Attempts >= j.MaxAttempts:
+		atomic.AddUint64(&s.buried, 1)
+		j.LastError = hErr.Error()
+		err = s.st.Bury(fctx, j)
+	default:
+		atomic.AddUint64(&s.retried, 1)
+		j.LastError = hErr.Error()
+		j.RunAt = now().Add(s.o.Backoff(j.Attempts))
+		err = s.st.Retry(fctx, j)
+	}
+	if err != nil {
+		s.logErr("jobqueue.Service.process", err, log.String("job_id", j.ID), log.String("job_type", j.Type))
+	}
+}
+
+// Stats returns the job counts of all queues and the processing counters.
+func (s *Service) Stats(ctx context.Context) (Stats, error) {
+	qs, err := s.st.Stats(ctx)
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	return Stats{
+		Queues:    qs,
+		Processed: atomic.LoadUint64(&s.processed),
+		Succeeded: atomic.LoadUint64(&s.succeeded),
+		Retried:   atomic.LoadUint64(&s.retried),
+		Buried:    atomic.LoadUint64(&s.buried),
+	}, nil
+}
+
+// Jobs lists the jobs matching the filter, ordered by their RunAt time.
+func (s *Service) Jobs(ctx context.Context, f Filter) ([]*Job, error) {
+	if f.Limit < 1 {
+		f.Limit = 100
+	}
+	jobs, err := s.st.Jobs(ctx, f)
+	return jobs, errors.WithStack(err)
+}
+
+// Requeue moves dead jobs back into their queue with reset attempts.
+func (s *Service) Requeue(ctx context.Context, ids ...string) (int, error) {
+	n, err := s.st.Requeue(ctx, ids...)
+	return n, errors.WithStack(err)
+}
+
+// Delete removes jobs from the storage.
+func (s *Service) Delete(ctx context.Context, ids ...string) (int, error) {
+	n, err := s.st.Delete(ctx, ids...)
+	return n, errors.WithStack(err)
+}
+
+// Close closes the Storager.
+func (s *Service) Close() error {
+	return errors.WithStack(s.st.Close())
+}
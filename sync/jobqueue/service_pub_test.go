@@ -0,0 +1,209 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/sync/bgwork"
+	"github.com/weiwolves/pkg/sync/jobqueue"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTestService(t *testing.T) *jobqueue.Service {
+	srv, err := jobqueue.NewService(jobqueue.NewInMemory(), jobqueue.Options{
+		Queues:       []string{jobqueue.DefaultQueue, "mails"},
+		MaxAttempts:  3,
+		PollInterval: 10 * time.Millisecond,
+		Backoff:      func(int) time.Duration { return 0 },
+		Scaling: bgwork.ScalingOptions{
+			MaxWorkers:          4,
+			WorkerCheckInterval: 10 * time.Millisecond,
+		},
+	})
+	assert.NoError(t, err)
+	return srv
+}
+
+// runUntil runs the Service until cond returns true or a timeout occurs.
+func runUntil(t *testing.T, srv *jobqueue.Service, cond func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Error("timeout waiting for the jobs")
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+type mailJob struct {
+	To string
+}
+
+func TestService_Run(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestService(t)
+
+	var mu sync.Mutex
+	var mailed []string
+	srv.Register("mail", func(_ context.Context, j *jobqueue.Job) error {
+		var m mailJob
+		if err := j.Unmarshal(&m); err != nil {
+			return err
+		}
+		mu.Lock()
+		mailed = append(mailed, m.To)
+		mu.Unlock()
+		return nil
+	})
+	var flaky int32
+	srv.Register("flaky", func(context.Context, *jobqueue.Job) error {
+		if atomic.AddInt32(&flaky, 1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	srv.Register("broken", func(context.Context, *jobqueue.Job) error {
+		return errors.NotRecoverable.Newf("invalid data")
+	})
+	srv.Register("panic", func(context.Context, *jobqueue.Job) error {
+		panic("oh no")
+	})
+
+	_, err := srv.EnqueueJSON(ctx, "mail", mailJob{To: "gopher@example.com"}, jobqueue.EnqueueOptions{Queue: "mails"})
+	assert.NoError(t, err)
+	_, err = srv.EnqueueJSON(ctx, "mail", mailJob{To: "delayed@example.com"}, jobqueue.EnqueueOptions{Queue: "mails", Delay: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	_, err = srv.EnqueueJSON(ctx, "mail", mailJob{To: "other@example.com"}, jobqueue.EnqueueOptions{Queue: "other"})
+	assert.NoError(t, err)
+	_, err = srv.Enqueue(ctx, "flaky", nil, jobqueue.EnqueueOptions{})
+	assert.NoError(t, err)
+	broken, err := srv.Enqueue(ctx, "broken", nil, jobqueue.EnqueueOptions{})
+	assert.NoError(t, err)
+	_, err = srv.Enqueue(ctx, "panic", nil, jobqueue.EnqueueOptions{MaxAttempts: 2})
+	assert.NoError(t, err)
+	_, err = srv.Enqueue(ctx, "unknown", nil, jobqueue.EnqueueOptions{})
+	assert.NoError(t, err)
+
+	runUntil(t, srv, func() bool {
+		st, err := srv.Stats(ctx)
+		assert.NoError(t, err)
+		return st.Succeeded == 3 && st.Buried == 3
+	})
+
+	mu.Lock()
+	assert.Exactly(t, []string{"gopher@example.com", "delayed@example.com"}, mailed)
+	mu.Unlock()
+	assert.Exactly(t, int32(3), atomic.LoadInt32(&flaky))
+
+	st, err := srv.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, uint64(9), st.Processed)
+	assert.Exactly(t, uint64(3), st.Retried)
+	assert.Exactly(t, []jobqueue.QueueStats{
+		{Queue: "default", Dead: 3},
+		{Queue: "other", Pending: 1},
+	}, st.Queues)
+
+	dead, err := srv.Jobs(ctx, jobqueue.Filter{Status: jobqueue.StatusDead})
+	assert.NoError(t, err)
+	assert.Len(t, dead, 3)
+	for _, j := range dead {
+		switch j.Type {
+		case "broken":
+			assert.Exactly(t, 1, j.Attempts)
+			assert.Contains(t, j.LastError, "invalid data")
+		case "panic":
+			assert.Exactly(t, 2, j.Attempts)
+			assert.Contains(t, j.LastError, "oh no")
+		case "unknown":
+			assert.Contains(t, j.LastError, "No handler registered")
+		}
+	}
+
+	srv.Register("broken", func(context.Context, *jobqueue.Job) error { return nil })
+	n, err := srv.Requeue(ctx, broken.ID)
+	assert.NoError(t, err)
+	assert.Exactly(t, 1, n)
+	runUntil(t, srv, func() bool {
+		st, err := srv.Stats(ctx)
+		assert.NoError(t, err)
+		return st.Succeeded == 4
+	})
+
+	n, err = srv.Delete(ctx, dead[0].ID, dead[1].ID, dead[2].ID)
+	assert.NoError(t, err)
+	assert.Exactly(t, 2, n)
+	assert.NoError(t, srv.Close())
+}
+
+func TestService_Enqueue(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestService(t)
+
+	j, err := srv.Enqueue(ctx, "mail", []byte("x"), jobqueue.EnqueueOptions{UniqueKey: "welcome:1"})
+	assert.NoError(t, err)
+	assert.Len(t, j.ID, 26)
+	assert.Exactly(t, jobqueue.DefaultQueue, j.Queue)
+	assert.Exactly(t, 3, j.MaxAttempts)
+	assert.Exactly(t, jobqueue.StatusPending, j.Status)
+
+	_, err = srv.Enqueue(ctx, "mail", []byte("x"), jobqueue.EnqueueOptions{UniqueKey: "welcome:1"})
+	assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+
+	_, err = srv.Enqueue(ctx, "", nil, jobqueue.EnqueueOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	runAt := time.Now().Add(time.Hour)
+	j, err = srv.Enqueue(ctx, "mail", nil, jobqueue.EnqueueOptions{RunAt: runAt, Delay: time.Minute})
+	assert.NoError(t, err)
+	assert.Exactly(t, runAt, j.RunAt)
+
+	_, err = jobqueue.NewService(nil, jobqueue.Options{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+}
+
+func TestService_Schedule(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestService(t)
+	var runs int32
+	srv.Register("report", func(context.Context, *jobqueue.Job) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	assert.NoError(t, srv.Schedule("report", "@every 1s", "report", nil, jobqueue.EnqueueOptions{}))
+	err := srv.Schedule("report", "* * * * *", "report", nil, jobqueue.EnqueueOptions{})
+	assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+	err = srv.Schedule("invalid", "* * *", "report", nil, jobqueue.EnqueueOptions{})
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+	runUntil(t, srv, func() bool { return atomic.LoadInt32(&runs) >= 2 })
+
+	jobs, err := srv.Jobs(ctx, jobqueue.Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1, "the next occurrence must be enqueued")
+	assert.Regexp(t, `^cron:report:\d+$`, jobs[0].UniqueKey)
+}
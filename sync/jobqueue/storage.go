@@ -0,0 +1,287 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+// now gets used by the Service and the storage backends. It can be changed
+// in tests.
+var now = time.Now
+
+// Storager persists the jobs. All functions must be safe for concurrent use.
+type Storager interface {
+	// Enqueue stores a new pending job. It must return an error of kind
+	// errors.AlreadyExists if a pending or running job with the same
+	// UniqueKey exists.
+	Enqueue(ctx context.Context, j *Job) error
+	// Claim returns at most `limit` pending jobs of the queues whose RunAt time
+	// has been reached, and running jobs whose lease has expired. Each job
+	// gets the running state, the lease `lockedUntil` and its attempts
+	// increased by one. A job must not be claimed twice.
+	Claim(ctx context.Context, queues []string, limit int, lockedUntil time.Time) ([]*Job, error)
+	// Complete removes a succeeded job. Complete, Retry and Bury must only
+	// modify the job if it is still running with the Attempts and LockedUntil
+	// values returned by Claim. Otherwise the lease has expired and the job
+	// might have been claimed again, then an error of kind errors.Expired must
+	// be returned.
+	Complete(ctx context.Context, j *Job) error
+	// Retry moves a failed job back into the pending state and sets the
+	// RunAt and LastError fields.
+	Retry(ctx context.Context, j *Job) error
+	// Bury moves a failed job into the dead state and sets the LastError
+	// field. The UniqueKey gets released.
+	Bury(ctx context.Context, j *Job) error
+	// Requeue moves dead jobs with the given IDs back into the pending state
+	// and resets their attempts. It returns the number of requeued jobs.
+	Requeue(ctx context.Context, ids ...string) (int, error)
+	// Delete removes jobs, running jobs included. It returns the number of
+	// removed jobs.
+	Delete(ctx context.Context, ids ...string) (int, error)
+	// Jobs lists jobs ordered by their RunAt time.
+	Jobs(ctx context.Context, f Filter) ([]*Job, error)
+	// Stats counts the jobs per queue.
+	Stats(ctx context.Context) ([]QueueStats, error)
+	// Close closes the storage but not any underlying connection.
+	Close() error
+}
+
+type memoryStorage struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	unique map[string]string // unique key => job ID
+}
+
+// NewInMemory creates a new Storager which stores all jobs in memory. Jobs do
+// not survive a restart. Mostly useful for tests.
+func NewInMemory() Storager {
+	return &memoryStorage{
+		jobs:   make(map[string]*Job),
+		unique: make(map[string]string),
+	}
+}
+
+func cloneJob(j *Job) *Job {
+	j2 := *j
+	return &j2
+}
+
+func (ms *memoryStorage) Enqueue(_ context.Context, j *Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.jobs[j.ID]; ok {
+		return errors.AlreadyExists.Newf("[jobqueue] Job ID %q already exists", j.ID)
+	}
+	if j.UniqueKey != "" {
+		if id, ok := ms.unique[j.UniqueKey]; ok {
+			return errors.AlreadyExists.Newf("[jobqueue] Job %q with unique key %q already exists", id, j.UniqueKey)
+		}
+		ms.unique[j.UniqueKey] = j.ID
+	}
+	ms.jobs[j.ID] = cloneJob(j)
+	return nil
+}
+
+func sortJobs(jobs []*Job) {
+	sort.Slice(jobs, func(i, k int) bool {
+		if jobs[i].RunAt.Equal(jobs[k].RunAt) {
+			return jobs[i].ID < jobs[k].ID
+		}
+		return jobs[i].RunAt.Before(jobs[k].RunAt)
+	})
+}
+
+func containsStr(sl []string, s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms *memoryStorage) Claim(_ context.Context, queues []string, limit int, lockedUntil time.Time) ([]*Job, error) {
+	n := now()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var ready []*Job
+	for _, j := range ms.jobs {
+		if !containsStr(queues, j.Queue) {
+			continue
+		}
+		if (j.Status == StatusPending && !j.RunAt.After(n)) || (j.Status == StatusRunning && !j.LockedUntil.After(n)) {
+			ready = append(ready, j)
+		}
+	}
+	sortJobs(ready)
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+	claimed := make([]*Job, 0, len(ready))
+	for _, j := range ready {
+		j.Status = StatusRunning
+		j.LockedUntil = lockedUntil
+		j.Attempts++
+		claimed = append(claimed, cloneJob(j))
+	}
+	return claimed, nil
+}
+
+// claimed returns the stored job if it is still claimed with the lease of j.
+func (ms *memoryStorage) claimed(j *Job) (*Job, error) {
+	sj, ok := ms.jobs[j.ID]
+	if !ok || sj.Status != StatusRunning || sj.Attempts != j.Attempts || !sj.LockedUntil.Equal(j.LockedUntil) {
+		return nil, errLeaseExpired(j)
+	}
+	return sj, nil
+}
+
+func errLeaseExpired(j *Job) error {
+	return errors.Expired.Newf("[jobqueue] Lease of job %q with attempt %d has expired", j.ID, j.Attempts)
+}
+
+func (ms *memoryStorage) Complete(_ context.Context, j *Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, err := ms.claimed(j); err != nil {
+		return errors.WithStack(err)
+	}
+	ms.remove(j.ID)
+	return nil
+}
+
+func (ms *memoryStorage) remove(id string) bool {
+	j, ok := ms.jobs[id]
+	if !ok {
+		return false
+	}
+	if j.UniqueKey != "" && ms.unique[j.UniqueKey] == id {
+		delete(ms.unique, j.UniqueKey)
+	}
+	delete(ms.jobs, id)
+	return true
+}
+
+func (ms *memoryStorage) Retry(_ context.Context, j *Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sj, err := ms.claimed(j)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sj.Status = StatusPending
+	sj.RunAt = j.RunAt
+	sj.LockedUntil = time.Time{}
+	sj.LastError = j.LastError
+	return nil
+}
+
+func (ms *memoryStorage) Bury(_ context.Context, j *Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sj, err := ms.claimed(j)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if sj.UniqueKey != "" && ms.unique[sj.UniqueKey] == sj.ID {
+		delete(ms.unique, sj.UniqueKey)
+	}
+	sj.Status = StatusDead
+	sj.LockedUntil = time.Time{}
+	sj.LastError = j.LastError
+	sj.UniqueKey = ""
+	return nil
+}
+
+func (ms *memoryStorage) Requeue(_ context.Context, ids ...string) (int, error) {
+	n := now()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var count int
+	for _, id := range ids {
+		if j, ok := ms.jobs[id]; ok && j.Status == StatusDead {
+			j.Status = StatusPending
+			j.Attempts = 0
+			j.RunAt = n
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ms *memoryStorage) Delete(_ context.Context, ids ...string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var count int
+	for _, id := range ids {
+		if ms.remove(id) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ms *memoryStorage) Jobs(_ context.Context, f Filter) ([]*Job, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var jobs []*Job
+	for _, j := range ms.jobs {
+		if (f.Queue == "" || f.Queue == j.Queue) && (f.Status == 0 || f.Status == j.Status) {
+			jobs = append(jobs, cloneJob(j))
+		}
+	}
+	sortJobs(jobs)
+	if len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs, nil
+}
+
+func (ms *memoryStorage) Stats(_ context.Context) ([]QueueStats, error) {
+	n := now()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	idx := map[string]int{}
+	var stats []QueueStats
+	for _, j := range ms.jobs {
+		i, ok := idx[j.Queue]
+		if !ok {
+			i = len(stats)
+			idx[j.Queue] = i
+			stats = append(stats, QueueStats{Queue: j.Queue})
+		}
+		qs := &stats[i]
+		switch {
+		case j.Status == StatusPending && j.RunAt.After(n):
+			qs.Delayed++
+		case j.Status == StatusPending:
+			qs.Pending++
+		case j.Status == StatusRunning:
+			qs.Running++
+		case j.Status == StatusDead:
+			qs.Dead++
+		}
+	}
+	sort.Slice(stats, func(i, k int) bool { return stats[i].Queue < stats[k].Queue })
+	return stats, nil
+}
+
+func (ms *memoryStorage) Close() error { return nil }
@@ -0,0 +1,237 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/weiwolves/pkg/util/assert"
+)
+
+func newTestJob(id, queue string, runAt time.Time) *Job {
+	return &Job{
+		ID:          id,
+		Queue:       queue,
+		Type:        "test",
+		Payload:     []byte(`{"id":"` + id + `"}`),
+		Status:      StatusPending,
+		MaxAttempts: 3,
+		RunAt:       runAt,
+		CreatedAt:   now(),
+	}
+}
+
+// testStorager checks that a Storager implementation behaves correctly. The
+// parallel claims run only if concurrentClaims is true.
+func testStorager(t *testing.T, st Storager, concurrentClaims bool) {
+	ctx := context.Background()
+	n := now()
+	past := n.Add(-time.Minute)
+	future := n.Add(time.Hour)
+	lease := n.Add(time.Minute)
+
+	t.Run("enqueue and claim", func(t *testing.T) {
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("01A", "q1", past.Add(time.Second))))
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("01B", "q1", past)))
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("01C", "q1", future)))
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("01D", "q2", past)))
+
+		stats, err := st.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, []QueueStats{
+			{Queue: "q1", Pending: 2, Delayed: 1},
+			{Queue: "q2", Pending: 1},
+		}, stats)
+
+		jobs, err := st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 2)
+		assert.Exactly(t, "01B", jobs[0].ID)
+		assert.Exactly(t, "01A", jobs[1].ID)
+		assert.Exactly(t, StatusRunning, jobs[0].Status)
+		assert.Exactly(t, 1, jobs[0].Attempts)
+		assert.Exactly(t, 3, jobs[0].MaxAttempts)
+		assert.Exactly(t, "test", jobs[0].Type)
+		assert.Exactly(t, []byte(`{"id":"01B"}`), jobs[0].Payload)
+		assert.Exactly(t, lease.Unix(), jobs[0].LockedUntil.Unix())
+
+		jobs, err = st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 0, "jobs must not be claimed twice")
+
+		stats, err = st.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, []QueueStats{
+			{Queue: "q1", Running: 2, Delayed: 1},
+			{Queue: "q2", Pending: 1},
+		}, stats)
+	})
+
+	t.Run("complete retry bury requeue", func(t *testing.T) {
+		running, err := st.Jobs(ctx, Filter{Status: StatusRunning, Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, running, 2)
+		assert.Exactly(t, "01A", running[1].ID)
+		assert.NoError(t, st.Complete(ctx, running[1]))
+
+		j := running[0]
+		j.RunAt = past
+		j.LastError = "failed once"
+		assert.NoError(t, st.Retry(ctx, j))
+		jobs, err := st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, 2, jobs[0].Attempts)
+		assert.Exactly(t, "failed once", jobs[0].LastError)
+
+		j = jobs[0]
+		j.LastError = "failed twice"
+		assert.NoError(t, st.Bury(ctx, j))
+		jobs, err = st.Jobs(ctx, Filter{Status: StatusDead, Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, "01B", jobs[0].ID)
+		assert.Exactly(t, "failed twice", jobs[0].LastError)
+
+		c, err := st.Requeue(ctx, "01B", "01C")
+		assert.NoError(t, err)
+		assert.Exactly(t, 1, c, "only dead jobs can be requeued")
+		jobs, err = st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, 1, jobs[0].Attempts)
+
+		err = st.Complete(ctx, &Job{ID: "01B"})
+		assert.True(t, errors.Expired.Match(err), "a job without its lease cannot be completed: %+v", err)
+		err = st.Retry(ctx, &Job{ID: "01C", Attempts: 0})
+		assert.True(t, errors.Expired.Match(err), "a pending job cannot be retried: %+v", err)
+
+		jobs, err = st.Jobs(ctx, Filter{Queue: "q1", Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 2)
+		assert.Exactly(t, "01B", jobs[0].ID)
+		assert.Exactly(t, "01C", jobs[1].ID)
+
+		c, err = st.Delete(ctx, "01B", "01C", "01D", "01X")
+		assert.NoError(t, err)
+		assert.Exactly(t, 3, c)
+		stats, err := st.Stats(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, stats, 0)
+	})
+
+	t.Run("expired lease", func(t *testing.T) {
+		assert.NoError(t, st.Enqueue(ctx, newTestJob("02A", "q1", past)))
+		stale, err := st.Claim(ctx, []string{"q1"}, 10, past)
+		assert.NoError(t, err)
+		assert.Len(t, stale, 1)
+		jobs, err := st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, 2, jobs[0].Attempts)
+
+		// the first worker must not finish the job of the second worker.
+		err = st.Complete(ctx, stale[0])
+		assert.True(t, errors.Expired.Match(err), "%+v", err)
+		err = st.Retry(ctx, stale[0])
+		assert.True(t, errors.Expired.Match(err), "%+v", err)
+		err = st.Bury(ctx, stale[0])
+		assert.True(t, errors.Expired.Match(err), "%+v", err)
+
+		assert.NoError(t, st.Complete(ctx, jobs[0]))
+		err = st.Complete(ctx, jobs[0])
+		assert.True(t, errors.Expired.Match(err), "%+v", err)
+	})
+
+	t.Run("unique key", func(t *testing.T) {
+		j := newTestJob("03A", "q1", past)
+		j.UniqueKey = "once"
+		assert.NoError(t, st.Enqueue(ctx, j))
+		j2 := newTestJob("03B", "q1", past)
+		j2.UniqueKey = "once"
+		err := st.Enqueue(ctx, j2)
+		assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+
+		jobs, err := st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Exactly(t, "once", jobs[0].UniqueKey)
+		assert.NoError(t, st.Complete(ctx, jobs[0]))
+		assert.NoError(t, st.Enqueue(ctx, j2), "unique key must be released")
+
+		jobs, err = st.Claim(ctx, []string{"q1"}, 10, lease)
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.NoError(t, st.Bury(ctx, jobs[0]))
+		j3 := newTestJob("03C", "q1", future)
+		j3.UniqueKey = "once"
+		assert.NoError(t, st.Enqueue(ctx, j3), "unique key must be released")
+		_, err = st.Delete(ctx, "03B", "03C")
+		assert.NoError(t, err)
+	})
+
+	t.Run("parallel claims", func(t *testing.T) {
+		if !concurrentClaims {
+			t.Skip("Storager does not support concurrent claims")
+		}
+		const count = 50
+		for i := 0; i < count; i++ {
+			assert.NoError(t, st.Enqueue(ctx, newTestJob(fmt.Sprintf("04%03d", i), "q3", past)))
+		}
+		var mu sync.Mutex
+		seen := map[string]bool{}
+		var wg sync.WaitGroup
+		for w := 0; w < 5; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					jobs, err := st.Claim(ctx, []string{"q3"}, 3, lease)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if len(jobs) == 0 {
+						return
+					}
+					mu.Lock()
+					for _, j := range jobs {
+						if seen[j.ID] {
+							t.Errorf("job %q claimed twice", j.ID)
+						}
+						seen[j.ID] = true
+					}
+					mu.Unlock()
+					for _, j := range jobs {
+						if err := st.Complete(ctx, j); err != nil {
+							t.Error(err)
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, seen, count)
+	})
+}
+
+func TestNewInMemory(t *testing.T) {
+	testStorager(t, NewInMemory(), true)
+}
@@ -4,31 +4,91 @@
 
 // Package singleflight provides a duplicate function call suppression
 // mechanism.
+//
+// Additionally to the original implementation, a Group supports context
+// aware calls with DoContext, keeps successful results for ResultTTL,
+// propagates a panic of the function to all waiting callers and provides
+// statistics about the in-flight calls.
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// now can be changed in tests.
+var now = time.Now
+
+// PanicError gets passed to all waiting callers when the function panicked.
+// Do and DoContext panic with a *PanicError, DoChan receives it as error.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func newPanicError(v interface{}) *PanicError {
+	stack := debug.Stack()
+	// The first line of the stack trace is of the form "goroutine N
+	// [status]:" but by the time the panic reaches the waiting callers the
+	// goroutine may no longer exist and its status will have changed. Trim
+	// out the misleading line.
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &PanicError{Value: v, Stack: stack}
+}
+
+// Error implements the error interface.
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("[singleflight] %v\n\n%s", p.Value, p.Stack)
+}
 
 // call is an in-flight or completed singleflight.Do call
 type call struct {
-	wg sync.WaitGroup
+	done chan struct{} // gets closed when the call has finished
 
-	// These fields are written once before the WaitGroup is done
-	// and are only read after the WaitGroup is done.
-	val interface{}
-	err error
+	// These fields are written once before done gets closed
+	// and are only read after done has been closed.
+	val      interface{}
+	err      error
+	panicErr *PanicError
 
 	// These fields are read and written with the singleflight
-	// mutex held before the WaitGroup is done, and are read but
-	// not written after the WaitGroup is done.
-	dups  int
-	chans []chan<- Result
+	// mutex held before done gets closed, and are read but
+	// not written after done has been closed.
+	dups    int
+	waiters int
+	started time.Time
+	chans   []chan<- Result
+}
+
+type cachedResult struct {
+	val       interface{}
+	expiresAt time.Time
 }
 
 // Group represents a class of work and forms a namespace in
 // which units of work can be executed with duplicate suppression.
 type Group struct {
-	mu sync.Mutex       // protects m
-	m  map[string]*call // lazily initialized
+	// ResultTTL, if greater than zero, keeps the successful result of a call
+	// for the duration. Calls within the TTL return the kept result as
+	// shared. Must be set before the first call.
+	ResultTTL time.Duration
+	// CallTimeout, if greater than zero, limits the runtime of the function
+	// passed to DoContext. Must be set before the first call.
+	CallTimeout time.Duration
+
+	mu        sync.Mutex       // protects all fields below
+	m         map[string]*call // lazily initialized
+	cache     map[string]cachedResult
+	lastPurge time.Time
+	stats     Stats
 }
 
 // Result holds the results of Do, so they can be passed
@@ -39,73 +99,271 @@ type Result struct {
 	Shared bool
 }
 
+// InFlight describes a running call of a key.
+type InFlight struct {
+	Key string
+	// Waiters counts the callers currently waiting for the result.
+	Waiters int
+	// Duplicates counts the callers which joined the call.
+	Duplicates int
+	Started    time.Time
+}
+
+// Stats contains the counters of a Group.
+type Stats struct {
+	// Calls counts the executed functions.
+	Calls uint64
+	// Shared counts the callers which joined an in-flight call.
+	Shared uint64
+	// CacheHits counts the callers which received a result kept for
+	// ResultTTL.
+	CacheHits uint64
+	Panics    uint64
+	// Cancelled counts the DoContext callers whose context ended before
+	// the call finished.
+	Cancelled uint64
+	// InFlight lists the running calls ordered by key.
+	InFlight []InFlight
+}
+
+// lookup returns a kept result or joins an in-flight call or creates a new
+// call. If leader is true, the caller has created the call and must execute
+// the function. Must be called with the mutex held.
+func (g *Group) lookup(key string) (c *call, leader, cached bool, val interface{}) {
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if cr, ok := g.cache[key]; ok {
+		if now().Before(cr.expiresAt) {
+			g.stats.CacheHits++
+			return nil, false, true, cr.val
+		}
+		delete(g.cache, key)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		g.stats.Shared++
+		return c, false, false, nil
+	}
+	c = &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+		started: now(),
+	}
+	g.m[key] = c
+	g.stats.Calls++
+	return c, true, false, nil
+}
+
 // Do executes and returns the results of the given function, making
 // sure that only one execution is in-flight for a given key at a
 // time. If a duplicate comes in, the duplicate caller waits for the
 // original to complete and receives the same results.
 // The return value shared indicates whether v was given to multiple callers.
+// If the function panics, all waiting callers panic with a *PanicError. If
+// the function calls runtime.Goexit, the calling goroutine exits and the
+// other waiting callers receive an error.
 func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
-	if g.m == nil {
-		g.m = make(map[string]*call)
+	c, leader, cached, val := g.lookup(key)
+	g.mu.Unlock()
+	if cached {
+		return val, nil, true
 	}
-	if c, ok := g.m[key]; ok {
-		c.dups++
-		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err, true
+	if leader {
+		g.doCall(c, key, fn)
+	} else {
+		<-c.done
 	}
-	c := new(call)
-	c.wg.Add(1)
-	g.m[key] = c
+	if c.panicErr != nil {
+		panic(c.panicErr)
+	}
+	return c.val, c.err, c.dups > 0
+}
+
+// DoContext is like Do but the caller stops waiting when its context ends
+// and returns the context error. The shared call continues to run, so that
+// other callers and later callers of the same key can use its result. The
+// function receives a context which carries the values of the first
+// caller's context but neither its deadline nor its cancellation. Use
+// CallTimeout to limit the runtime of the function. If the function panics,
+// all waiting callers panic with a *PanicError.
+func (g *Group) DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	c, leader, cached, val := g.lookup(key)
 	g.mu.Unlock()
+	if cached {
+		return val, nil, true
+	}
+	if leader {
+		go g.doCall(c, key, func() (interface{}, error) {
+			cctx := context.Context(detachedContext{parent: ctx})
+			if g.CallTimeout > 0 {
+				var cancel context.CancelFunc
+				cctx, cancel = context.WithTimeout(cctx, g.CallTimeout)
+				defer cancel()
+			}
+			return fn(cctx)
+		})
+	}
 
-	g.doCall(c, key, fn)
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		select {
+		case <-c.done: // finished in the meantime
+			g.mu.Unlock()
+		default:
+			c.waiters--
+			g.stats.Cancelled++
+			shared = c.dups > 0
+			g.mu.Unlock()
+			return nil, ctx.Err(), shared
+		}
+	}
+	if c.panicErr != nil {
+		panic(c.panicErr)
+	}
 	return c.val, c.err, c.dups > 0
 }
 
 // DoChan is like Do but returns a channel that will receive the
-// results when they are ready.
+// results when they are ready. If the function panics, the Result contains
+// a *PanicError.
 func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
 	ch := make(chan Result, 1)
 	g.mu.Lock()
-	if g.m == nil {
-		g.m = make(map[string]*call)
-	}
-	if c, ok := g.m[key]; ok {
-		c.dups++
-		c.chans = append(c.chans, ch)
+	c, leader, cached, val := g.lookup(key)
+	if cached {
 		g.mu.Unlock()
+		ch <- Result{Val: val, Shared: true}
 		return ch
 	}
-	c := &call{chans: []chan<- Result{ch}}
-	c.wg.Add(1)
-	g.m[key] = c
+	c.chans = append(c.chans, ch)
 	g.mu.Unlock()
 
-	go g.doCall(c, key, fn)
-
+	if leader {
+		go g.doCall(c, key, fn)
+	}
 	return ch
 }
 
+// errGoexit gets passed to the waiting callers when the function called
+// runtime.Goexit.
+var errGoexit = errors.New("[singleflight] runtime.Goexit was called")
+
 // doCall handles the single call for a key.
 func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
-	c.val, c.err = fn()
-	c.wg.Done()
+	normalReturn := false
+	recovered := false
 
-	g.mu.Lock()
-	delete(g.m, key)
-	for _, ch := range c.chans {
-		ch <- Result{c.val, c.err, c.dups > 0}
+	// use double-defer to distinguish panic from runtime.Goexit, more
+	// details see https://golang.org/cl/134395
+	defer func() {
+		// the given function invoked runtime.Goexit
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		// Forget might have removed the call and a new call might have
+		// taken its place, so only the current call can keep its result.
+		current := g.m[key] == c
+		if current {
+			delete(g.m, key)
+		}
+		if c.panicErr != nil {
+			g.stats.Panics++
+		}
+		if current && c.err == nil && g.ResultTTL > 0 {
+			g.keep(key, c.val)
+		}
+		close(c.done)
+		for _, ch := range c.chans {
+			ch <- Result{c.val, c.err, c.dups > 0}
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// Ideally, we would wait to take a stack trace until we've
+				// determined whether this is a panic or a runtime.Goexit.
+				// Unfortunately, the only way we can distinguish the two
+				// is to see whether the recover stopped the goroutine from
+				// terminating, and by the time we know that, the part of
+				// the stack trace relevant to the panic has been discarded.
+				if r := recover(); r != nil {
+					c.panicErr = newPanicError(r)
+					c.err = c.panicErr
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
 	}
-	g.mu.Unlock()
+}
+
+// keep stores a successful result and removes expired results once per
+// ResultTTL. Must be called with the mutex held.
+func (g *Group) keep(key string, val interface{}) {
+	n := now()
+	if g.cache == nil {
+		g.cache = make(map[string]cachedResult)
+	}
+	if n.Sub(g.lastPurge) > g.ResultTTL {
+		for k, cr := range g.cache {
+			if !n.Before(cr.expiresAt) {
+				delete(g.cache, k)
+			}
+		}
+		g.lastPurge = n
+	}
+	g.cache[key] = cachedResult{val: val, expiresAt: n.Add(g.ResultTTL)}
 }
 
 // Forget tells the singleflight to forget about a key.  Future calls
 // to Do for this key will call the function rather than waiting for
-// an earlier call to complete.
+// an earlier call to complete. A kept result gets removed.
 func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
+	delete(g.cache, key)
 	g.mu.Unlock()
 }
+
+// Stats returns the counters and the in-flight calls.
+func (g *Group) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.stats
+	s.InFlight = make([]InFlight, 0, len(g.m))
+	for key, c := range g.m {
+		s.InFlight = append(s.InFlight, InFlight{
+			Key:        key,
+			Waiters:    c.waiters,
+			Duplicates: c.dups,
+			Started:    c.started,
+		})
+	}
+	sort.Slice(s.InFlight, func(i, j int) bool { return s.InFlight[i].Key < s.InFlight[j].Key })
+	return s
+}
+
+// detachedContext keeps the values of its parent but not the deadline and
+// the cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (dc detachedContext) Value(key interface{}) interface{}    { return dc.parent.Value(key) }
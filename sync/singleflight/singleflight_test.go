@@ -5,8 +5,11 @@
 package singleflight
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -85,3 +88,232 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want over 0 and less than %d", got, n)
 	}
 }
+
+type ctxKey struct{}
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("context must not have a deadline")
+		}
+		if v, _ := ctx.Value(ctxKey{}).(string); v != "gopher" {
+			t.Errorf("context value = %q; want gopher", v)
+		}
+		<-release
+		return "bar", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "gopher"), 10*time.Millisecond)
+	defer cancel()
+	v, err, _ := g.DoContext(ctx, "key", fn)
+	if err != context.DeadlineExceeded || v != nil {
+		t.Fatalf("DoContext = %v, %v; want nil, DeadlineExceeded", v, err)
+	}
+
+	done := make(chan Result)
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", fn)
+		done <- Result{v, err, shared}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if s := g.Stats(); len(s.InFlight) != 1 || s.InFlight[0].Waiters != 1 || s.InFlight[0].Duplicates != 1 || s.Cancelled != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+	close(release)
+	r := <-done
+	if r.Val != "bar" || r.Err != nil || !r.Shared {
+		t.Errorf("DoContext = %+v; want bar, nil, shared", r)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+	if s := g.Stats(); len(s.InFlight) != 0 || s.Calls != 1 || s.Shared != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+}
+
+func TestDoContextCallTimeout(t *testing.T) {
+	g := Group{CallTimeout: 10 * time.Millisecond}
+	_, err, _ := g.DoContext(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("DoContext error = %v; want DeadlineExceeded", err)
+	}
+}
+
+func TestResultTTL(t *testing.T) {
+	n := time.Unix(1000, 0)
+	now = func() time.Time { return n }
+	defer func() { now = time.Now }()
+
+	g := Group{ResultTTL: time.Second}
+	var calls int
+	fn := func() (interface{}, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("failed")
+		}
+		return calls, nil
+	}
+	for i := 0; i < 3; i++ {
+		if v, err, shared := g.Do("key", fn); v != 1 || err != nil || shared != (i > 0) {
+			t.Errorf("Do = %v, %v, %v; want 1, nil, %v", v, err, shared, i > 0)
+		}
+	}
+	if r := <-g.DoChan("key", fn); r.Val != 1 || !r.Shared {
+		t.Errorf("DoChan = %+v; want kept result", r)
+	}
+	n = n.Add(time.Second)
+	if _, err, _ := g.Do("key", fn); err == nil {
+		t.Error("Do must call fn after the TTL and not keep errors")
+	}
+	if v, _, _ := g.Do("key", fn); v != 3 {
+		t.Errorf("Do = %v; want 3", v)
+	}
+	g.Forget("key")
+	if v, _, _ := g.Do("key", fn); v != 4 {
+		t.Errorf("Do = %v; want 4 after Forget", v)
+	}
+	if s := g.Stats(); s.Calls != 4 || s.CacheHits != 3 {
+		t.Errorf("Stats = %+v", s)
+	}
+}
+
+func TestPanicPropagation(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("oh no")
+	}
+	recoverPanic := func(f func()) (pe *PanicError) {
+		defer func() {
+			pe, _ = recover().(*PanicError)
+		}()
+		f()
+		return nil
+	}
+
+	const n = 5
+	panics := make(chan *PanicError, n+1)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			panics <- recoverPanic(func() {
+				if i%2 == 0 {
+					g.Do("key", fn)
+				} else {
+					g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) { return fn() })
+				}
+			})
+		}(i)
+	}
+	ch := g.DoChan("key", fn)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(panics)
+	for pe := range panics {
+		if pe == nil || pe.Value != "oh no" || !strings.Contains(pe.Error(), "singleflight_test.go") {
+			t.Errorf("Waiter did not receive the panic: %#v", pe)
+		}
+	}
+	if r := <-ch; r.Err == nil {
+		t.Error("DoChan must receive the panic as error")
+	} else if _, ok := r.Err.(*PanicError); !ok {
+		t.Errorf("DoChan error type %T; want *PanicError", r.Err)
+	}
+	if s := g.Stats(); s.Panics != 1 || s.Calls != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+}
+
+func TestForgetWhileRunning(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	time.Sleep(5 * time.Millisecond)
+	g.Forget("key")
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 2, nil
+	})
+	close(release)
+	if r1, r2 := <-ch1, <-ch2; r1.Val != 1 || r2.Val != 2 {
+		t.Errorf("DoChan = %v, %v; want 1, 2", r1.Val, r2.Val)
+	}
+}
+
+func TestForgetWhileRunningResultTTL(t *testing.T) {
+	g := Group{ResultTTL: time.Minute}
+	release1 := make(chan struct{})
+	release2 := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release1
+		return 1, nil
+	})
+	time.Sleep(5 * time.Millisecond)
+	g.Forget("key")
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		<-release2
+		return 2, nil
+	})
+	close(release1)
+	if r := <-ch1; r.Val != 1 {
+		t.Errorf("DoChan = %v; want 1", r.Val)
+	}
+	close(release2)
+	if r := <-ch2; r.Val != 2 {
+		t.Errorf("DoChan = %v; want 2", r.Val)
+	}
+	if v, _, _ := g.Do("key", func() (interface{}, error) { return 3, nil }); v != 2 {
+		t.Errorf("Do = %v; want the kept result 2 of the current call", v)
+	}
+}
+
+func TestGoexit(t *testing.T) {
+	var g Group
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		g.Do("key", func() (interface{}, error) {
+			runtime.Goexit()
+			return nil, nil
+		})
+		t.Error("Do must not return after runtime.Goexit")
+	}()
+	<-exited
+
+	release := make(chan struct{})
+	ch := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(release)
+	}()
+	if _, err, shared := g.DoContext(ctx, "key", func(context.Context) (interface{}, error) { return nil, nil }); err != errGoexit || !shared {
+		t.Errorf("DoContext = %v, %v; want errGoexit, shared", err, shared)
+	}
+	if r := <-ch; r.Err != errGoexit {
+		t.Errorf("DoChan error = %v; want errGoexit", r.Err)
+	}
+	if s := g.Stats(); len(s.InFlight) != 0 || s.Panics != 0 || s.Calls != 2 {
+		t.Errorf("Stats = %+v", s)
+	}
+}